@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var (
+	a11yImgRe  = regexp.MustCompile(`(?i)<img\b[^>]*>`)
+	a11yAltRe  = regexp.MustCompile(`(?i)\salt\s*=\s*("[^"]*"|'[^']*'|[^\s>]+)`)
+	a11ySrcRe  = regexp.MustCompile(`(?i)\ssrc\s*=\s*("[^"]*"|'[^']*'|[^\s>]+)`)
+	a11yHrefRe = regexp.MustCompile(`(?i)\shref\s*=\s*("[^"]*"|'[^']*'|[^\s>]+)`)
+	// Images marked decorative may have an empty alt
+	a11yDecorativeRe = regexp.MustCompile(`(?i)\s(?:role\s*=\s*["']?(?:presentation|none)\b|aria-hidden\s*=\s*["']?true\b)`)
+	a11yHeadingRe    = regexp.MustCompile(`(?i)<h([1-6])\b`)
+	a11yLinkRe       = regexp.MustCompile(`(?is)<a\b([^>]*)>(.*?)</a>`)
+	a11yLabelRe      = regexp.MustCompile(`(?i)\s(aria-label|aria-labelledby|title)\s*=\s*("[^"]+"|'[^']+'|[^\s>"']+)`)
+	a11yStyleRe      = regexp.MustCompile(`(?i)\sstyle\s*=\s*("[^"]*"|'[^']*')`)
+	a11yColorRe      = regexp.MustCompile(`(?i)(?:^|[;\s"'])color\s*:`)
+	a11yBgRe         = regexp.MustCompile(`(?i)background(?:-color)?\s*:`)
+	anyTagRe         = regexp.MustCompile(`<[^>]*>`)
+)
+
+func attrValue(re *regexp.Regexp, tag []byte) (string, bool) {
+	m := re.FindSubmatch(tag)
+	if m == nil {
+		return "", false
+	}
+	return html.UnescapeString(strings.Trim(string(m[len(m)-1]), `"'`)), true
+}
+
+// a11yProblems lists accessibility issues in page: images without alt
+// text (unless marked decorative), skipped heading levels, links without text, and inline styles that
+// set a text or background color without the other, which leaves contrast
+// to the reader's defaults.
+func a11yProblems(page []byte) []htmlProblem {
+	var problems []htmlProblem
+	lineAt := func(i int) int { return bytes.Count(page[:i], []byte("\n")) + 1 }
+	for _, loc := range a11yImgRe.FindAllIndex(page, -1) {
+		tag := page[loc[0]:loc[1]]
+		if a11yDecorativeRe.Match(tag) {
+			continue
+		}
+		if alt, _ := attrValue(a11yAltRe, tag); strings.TrimSpace(alt) == "" {
+			src, _ := attrValue(a11ySrcRe, tag)
+			problems = append(problems, htmlProblem{lineAt(loc[0]), fmt.Sprintf("image without alt text (%s)", src)})
+		}
+	}
+	prev := 0
+	for _, m := range a11yHeadingRe.FindAllSubmatchIndex(page, -1) {
+		level := int(page[m[2]] - '0')
+		if prev > 0 && level > prev+1 {
+			problems = append(problems, htmlProblem{lineAt(m[0]), fmt.Sprintf("heading level skipped: h%d follows h%d", level, prev)})
+		}
+		prev = level
+	}
+	for _, m := range a11yLinkRe.FindAllSubmatchIndex(page, -1) {
+		attrs, inner := page[m[2]:m[3]], page[m[4]:m[5]]
+		if _, ok := attrValue(a11yLabelRe, attrs); ok {
+			continue
+		}
+		text := strings.TrimSpace(html.UnescapeString(string(anyTagRe.ReplaceAll(inner, nil))))
+		for _, img := range a11yImgRe.FindAll(inner, -1) {
+			alt, _ := attrValue(a11yAltRe, img)
+			text += strings.TrimSpace(alt)
+		}
+		if text == "" {
+			href, _ := attrValue(a11yHrefRe, attrs)
+			problems = append(problems, htmlProblem{lineAt(m[0]), fmt.Sprintf("link without text (%s)", href)})
+		}
+	}
+	for _, m := range a11yStyleRe.FindAllSubmatchIndex(page, -1) {
+		style := page[m[2]:m[3]]
+		color, bg := a11yColorRe.Match(style), a11yBgRe.Match(style)
+		if color != bg {
+			problems = append(problems, htmlProblem{lineAt(m[0]), "contrast: inline style sets only one of color and background"})
+		}
+	}
+	return problems
+}
+
+// a11yReport writes the accessibility problems of every generated page
+// under docsDir to w, grouped by file, and returns how many it found.
+func a11yReport(docsDir string, w io.Writer) (int, error) {
+	n := 0
+	err := walkExports(docsDir, func(p string, b []byte) {
+		problems := a11yProblems(b)
+		if len(problems) == 0 {
+			return
+		}
+		fmt.Fprintln(w, p)
+		for _, prob := range problems {
+			fmt.Fprintf(w, "  %s\n", prob)
+		}
+		n += len(problems)
+	})
+	return n, err
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestA11yProblems(t *testing.T) {
+	page := `<h1>Title</h1>
+<p><img src="a.png" alt=""><img src="b.png"><img src="c.png" alt="Chart"><img src="d.png" alt="" role="presentation"></p>
+<h3>Skipped</h3>
+<h2>Fine</h2><h3>Fine</h3>
+<a href="x.html"></a> <a href="y.html"><img src="i.png" alt="Home"></a> <a href="z.html" aria-label="Close">×</a>
+<a href="w.html"> <span></span> </a>
+<p style="color: #777">grey</p><p style="color:#fff;background:#000">ok</p><p style="background-color:red">bg</p>`
+	var got []string
+	for _, p := range a11yProblems([]byte(page)) {
+		got = append(got, p.String())
+	}
+	want := []string{
+		"line 2: image without alt text (a.png)",
+		"line 2: image without alt text (b.png)",
+		"line 3: heading level skipped: h3 follows h1",
+		"line 5: link without text (x.html)",
+		"line 6: link without text (w.html)",
+		"line 7: contrast: inline style sets only one of color and background",
+		"line 7: contrast: inline style sets only one of color and background",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestBuild_A11yReport(t *testing.T) {
+	chdirTemp(t)
+	fakeCmarkOnPath(t)
+	writeFiles(t, map[string]string{"a.md": "![](pic.png)", "b.md": "fine"})
+	var out bytes.Buffer
+	if err := runBuild([]string{"-a11y"}, &out); err != nil || !strings.Contains(out.String(), "0 accessibility problems\n") {
+		t.Fatalf("err = %v\n%s", err, out.String())
+	}
+	// The fake cmark wraps the raw line in <p>, so the image is verbatim
+	if err := os.WriteFile(filepath.Join("docs", "a.html"), []byte(`<p><img src="pic.png" alt=""></p>`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if n, err := a11yReport("docs", &out); err != nil || n != 1 {
+		t.Fatalf("n = %d err = %v", n, err)
+	}
+	want := filepath.Join("docs", "a.html") + "\n  line 1: image without alt text (pic.png)\n"
+	if out.String() != want {
+		t.Fatalf("report = %q", out.String())
+	}
+	if strings.Contains(out.String(), "b.html") {
+		t.Fatalf("clean file reported")
+	}
+}
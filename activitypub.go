@@ -0,0 +1,630 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// activityPubConfig makes the published site a followable ActivityPub
+// account: dated notes are delivered to its followers when exported.
+type activityPubConfig struct {
+	// ServerURL is the public URL of this server, which serves the actor,
+	// its inbox and WebFinger.
+	ServerURL string `json:"server_url"`
+	// Username is the account name, as in @blog@notes.example.com.
+	Username string `json:"username"`
+	// Name and Summary describe the account; Name defaults to the site name.
+	Name    string `json:"name,omitempty"`
+	Summary string `json:"summary,omitempty"`
+}
+
+const (
+	activityStreams = "https://www.w3.org/ns/activitystreams"
+	activityJSON    = "application/activity+json"
+	apPublic        = activityStreams + "#Public"
+	// apReadLimit bounds activities and actor documents read.
+	apReadLimit = 1 << 20
+	// apClockSkew is how far a signed request's Date may be off.
+	apClockSkew = 12 * time.Hour
+)
+
+// apKeyPath holds the actor's RSA key, created on first use.
+var apKeyPath = filepath.Join(".minimark", "activitypub.pem")
+
+var apStatePath = filepath.Join(".minimark", "activitypub.json")
+
+// apClient fetches actors and delivers to inboxes. Inbox requests name
+// both, so it only connects to public addresses, redirects included.
+var apClient = newPublicClient()
+
+var apUsernameRe = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+var (
+	apKeyMu sync.Mutex
+	apKey   *rsa.PrivateKey
+)
+
+// apStore records followers and the notes already delivered, persisted to
+// .minimark/activitypub.json.
+type apStore struct {
+	mu        sync.Mutex
+	loaded    bool
+	Followers map[string]string    `json:"followers"` // actor -> inbox
+	Published map[string]time.Time `json:"published"` // note -> when delivered
+}
+
+var apState = &apStore{}
+
+// apDeliverMu serializes publishing, so quick saves deliver a note once.
+var apDeliverMu sync.Mutex
+
+func validateActivityPub(a *activityPubConfig, siteURL string) error {
+	if a == nil {
+		return nil
+	}
+	if siteURL == "" {
+		return errors.New("activitypub: requires site_url")
+	}
+	if u, err := url.Parse(a.ServerURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+		return fmt.Errorf("activitypub: server_url %q must be the absolute http or https URL of the server's root", a.ServerURL)
+	}
+	if !apUsernameRe.MatchString(a.Username) {
+		return fmt.Errorf("activitypub: invalid username %q", a.Username)
+	}
+	return nil
+}
+
+// load reads the persisted state once. Callers hold mu.
+func (s *apStore) load() {
+	if s.loaded {
+		return
+	}
+	s.loaded = true
+	if b, err := os.ReadFile(wsPath(apStatePath)); err == nil {
+		if err := json.Unmarshal(b, s); err != nil {
+			log.Printf("ignoring corrupt ActivityPub state: %v", err)
+		}
+	}
+	if s.Followers == nil {
+		s.Followers = map[string]string{}
+	}
+	if s.Published == nil {
+		s.Published = map[string]time.Time{}
+	}
+}
+
+// save persists the state. Callers hold mu.
+func (s *apStore) save() {
+	b, err := json.Marshal(s)
+	if err == nil {
+		err = os.MkdirAll(wsPath(filepath.Dir(apStatePath)), 0755)
+	}
+	if err == nil {
+		err = os.WriteFile(wsPath(apStatePath), b, 0644)
+	}
+	if err != nil {
+		log.Printf("ActivityPub state not saved: %v", err)
+	}
+}
+
+// apPrivateKey returns the actor's key, creating apKeyPath on first use.
+func apPrivateKey() (*rsa.PrivateKey, error) {
+	apKeyMu.Lock()
+	defer apKeyMu.Unlock()
+	if apKey != nil {
+		return apKey, nil
+	}
+	if b, err := os.ReadFile(wsPath(apKeyPath)); err == nil {
+		if block, _ := pem.Decode(b); block != nil {
+			if k, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+				apKey = k
+				return apKey, nil
+			}
+		}
+	}
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(wsPath(filepath.Dir(apKeyPath)), 0755); err != nil {
+		return nil, err
+	}
+	b := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)})
+	if err := os.WriteFile(wsPath(apKeyPath), b, 0600); err != nil {
+		return nil, err
+	}
+	apKey = k
+	return apKey, nil
+}
+
+func apURL(p string) string {
+	return strings.TrimSuffix(config.ActivityPub.ServerURL, "/") + p
+}
+
+func apActorID() string { return apURL("/ap/actor") }
+
+// apActor is the account's actor document.
+func apActor() (map[string]any, error) {
+	a := config.ActivityPub
+	key, err := apPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	name := a.Name
+	if name == "" {
+		name = siteName()
+	}
+	return map[string]any{
+		"@context":          []string{activityStreams, "https://w3id.org/security/v1"},
+		"id":                apActorID(),
+		"type":              "Person",
+		"preferredUsername": a.Username,
+		"name":              name,
+		"summary":           html.EscapeString(a.Summary),
+		"url":               config.SiteURL,
+		"inbox":             apURL("/ap/inbox"),
+		"outbox":            apURL("/ap/outbox"),
+		"followers":         apURL("/ap/followers"),
+		"publicKey": map[string]string{
+			"id":           apActorID() + "#main-key",
+			"owner":        apActorID(),
+			"publicKeyPem": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+		},
+	}, nil
+}
+
+// apNote is the Note federated for a published note.
+func apNote(name string, md []byte, published time.Time) map[string]any {
+	outName := htmlOutNameFor(name)
+	link := sitePageURL(outName)
+	m := buildPageMeta(name, outName, md)
+	var content strings.Builder
+	fmt.Fprintf(&content, "<p><strong>%s</strong></p>", html.EscapeString(m.Title))
+	if m.Excerpt != "" {
+		fmt.Fprintf(&content, "<p>%s</p>", html.EscapeString(m.Excerpt))
+	}
+	fmt.Fprintf(&content, `<p><a href="%s">%s</a></p>`, html.EscapeString(link), html.EscapeString(link))
+	return map[string]any{
+		"id":           apURL("/ap/notes/" + url.PathEscape(contentSlug(name))),
+		"type":         "Note",
+		"attributedTo": apActorID(),
+		"url":          link,
+		"content":      content.String(),
+		"published":    published.UTC().Format(time.RFC3339),
+		"to":           []string{apPublic},
+		"cc":           []string{apURL("/ap/followers")},
+	}
+}
+
+func apCreate(note map[string]any) map[string]any {
+	return map[string]any{
+		"@context":  activityStreams,
+		"id":        note["id"].(string) + "#create",
+		"type":      "Create",
+		"actor":     apActorID(),
+		"published": note["published"],
+		"to":        note["to"],
+		"cc":        note["cc"],
+		"object":    note,
+	}
+}
+
+// federatable reads the note name when it would be federated: published,
+// public and dated.
+func federatable(name string) ([]byte, bool) {
+	md, err := os.ReadFile(wsPath(name))
+	if err != nil || !publicNote(md) {
+		return nil, false
+	}
+	fields, _ := parseFrontMatter(md)
+	_, dated := parseFrontMatterDate(fields["date"])
+	return md, dated
+}
+
+// publishActivity delivers the note name to every follower the first time
+// it is exported dated and public.
+func publishActivity(name string) {
+	apDeliverMu.Lock()
+	defer apDeliverMu.Unlock()
+	md, ok := federatable(name)
+	if !ok {
+		return
+	}
+	apState.mu.Lock()
+	apState.load()
+	_, done := apState.Published[name]
+	inboxes := map[string]bool{}
+	for _, inbox := range apState.Followers {
+		inboxes[inbox] = true
+	}
+	apState.mu.Unlock()
+	if done {
+		return
+	}
+	now := time.Now()
+	activity, err := json.Marshal(apCreate(apNote(name, md, now)))
+	if err != nil {
+		return
+	}
+	for inbox := range inboxes {
+		if err := apDeliver(inbox, activity); err != nil {
+			log.Printf("ActivityPub delivery to %s failed: %v", inbox, err)
+		}
+	}
+	apState.mu.Lock()
+	apState.Published[name] = now
+	apState.save()
+	apState.mu.Unlock()
+}
+
+// apDeliver posts an activity to inbox, signed with the actor's key.
+func apDeliver(inbox string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, inbox, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", activityJSON)
+	if err := apSign(req, body); err != nil {
+		return err
+	}
+	resp, err := apClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("inbox returned %s", resp.Status)
+	}
+	return nil
+}
+
+func apDigest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "SHA-256=" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// apSigningString is the string an HTTP signature covers.
+func apSigningString(r *http.Request, headers []string) string {
+	lines := make([]string, len(headers))
+	for i, h := range headers {
+		switch h {
+		case "(request-target)":
+			lines[i] = h + ": " + strings.ToLower(r.Method) + " " + r.URL.RequestURI()
+		case "host":
+			host := r.Host
+			if host == "" {
+				host = r.URL.Host
+			}
+			lines[i] = "host: " + host
+		default:
+			lines[i] = h + ": " + r.Header.Get(h)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// apSign adds a Digest and an HTTP signature (draft-cavage-http-signatures,
+// as the Fediverse uses it) to req.
+func apSign(req *http.Request, body []byte) error {
+	key, err := apPrivateKey()
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("Digest", apDigest(body))
+	headers := []string{"(request-target)", "host", "date", "digest"}
+	sum := sha256.Sum256([]byte(apSigningString(req, headers)))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Signature", fmt.Sprintf(`keyId="%s#main-key",algorithm="rsa-sha256",headers="%s",signature="%s"`,
+		apActorID(), strings.Join(headers, " "), base64.StdEncoding.EncodeToString(sig)))
+	return nil
+}
+
+var apSigParamRe = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// apRemoteActor is what is needed from another server's actor.
+type apRemoteActor struct {
+	ID        string `json:"id"`
+	Inbox     string `json:"inbox"`
+	PublicKey struct {
+		ID    string `json:"id"`
+		Owner string `json:"owner"`
+		PEM   string `json:"publicKeyPem"`
+	} `json:"publicKey"`
+}
+
+// fetchActor reads the actor document at id.
+func fetchActor(id string) (apRemoteActor, error) {
+	var a apRemoteActor
+	req, err := http.NewRequest(http.MethodGet, id, nil)
+	if err != nil {
+		return a, err
+	}
+	req.Header.Set("Accept", activityJSON)
+	resp, err := apClient.Do(req)
+	if err != nil {
+		return a, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return a, fmt.Errorf("%s returned %s", id, resp.Status)
+	}
+	err = json.NewDecoder(io.LimitReader(resp.Body, apReadLimit)).Decode(&a)
+	return a, err
+}
+
+var errBadSignature = errors.New("missing or invalid HTTP signature")
+
+// apVerify checks the HTTP signature and digest of a request sent by
+// actorID and returns that actor. The key must be the one actorID's own
+// document names, so another server cannot sign in its name.
+func apVerify(r *http.Request, body []byte, actorID string) (apRemoteActor, error) {
+	params := map[string]string{}
+	for _, m := range apSigParamRe.FindAllStringSubmatch(r.Header.Get("Signature"), -1) {
+		params[m[1]] = m[2]
+	}
+	headers := strings.Fields(strings.ToLower(params["headers"]))
+	for _, h := range []string{"(request-target)", "digest", "date"} {
+		if !slices.Contains(headers, h) {
+			return apRemoteActor{}, errBadSignature
+		}
+	}
+	keyID := params["keyId"]
+	if keyID == "" || actorID == "" {
+		return apRemoteActor{}, errBadSignature
+	}
+	if r.Header.Get("Digest") != apDigest(body) {
+		return apRemoteActor{}, errBadSignature
+	}
+	date, err := http.ParseTime(r.Header.Get("Date"))
+	if err != nil || time.Since(date).Abs() > apClockSkew {
+		return apRemoteActor{}, errBadSignature
+	}
+	sig, err := base64.StdEncoding.DecodeString(params["signature"])
+	if err != nil {
+		return apRemoteActor{}, errBadSignature
+	}
+	keyURL, _, _ := strings.Cut(keyID, "#")
+	ku, err := url.Parse(keyURL)
+	if err != nil {
+		return apRemoteActor{}, errBadSignature
+	}
+	keyDoc, err := fetchActor(keyURL)
+	if err != nil {
+		return keyDoc, err
+	}
+	// The key document must be served by the host it claims to be from
+	if du, err := url.Parse(keyDoc.ID); err != nil || du.Host != ku.Host {
+		return keyDoc, errBadSignature
+	}
+	actor := keyDoc
+	if keyDoc.ID != actorID {
+		if actor, err = fetchActor(actorID); err != nil {
+			return actor, err
+		}
+	}
+	block, _ := pem.Decode([]byte(actor.PublicKey.PEM))
+	if block == nil || actor.ID != actorID || actor.PublicKey.ID != keyID {
+		return actor, errBadSignature
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if err != nil || !ok {
+		return actor, errBadSignature
+	}
+	sum := sha256.Sum256([]byte(apSigningString(r, headers)))
+	if rsa.VerifyPKCS1v15(rsaPub, crypto.SHA256, sum[:], sig) != nil {
+		return actor, errBadSignature
+	}
+	return actor, nil
+}
+
+// apActivity is an incoming activity; Object is an id or an embedded
+// activity, as for Undo.
+type apActivity struct {
+	ID     string          `json:"id"`
+	Type   string          `json:"type"`
+	Actor  string          `json:"actor"`
+	Object json.RawMessage `json:"object"`
+}
+
+// handleAPInbox accepts Follow and Undo Follow from other servers,
+// answering follows with a signed Accept. Other activities are ignored.
+func handleAPInbox(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, apReadLimit))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var act apActivity
+	if err := json.Unmarshal(body, &act); err != nil {
+		http.Error(w, "invalid activity", http.StatusBadRequest)
+		return
+	}
+	signer, err := apVerify(r, body, act.Actor)
+	if err != nil || signer.ID != act.Actor || signer.PublicKey.Owner != act.Actor {
+		http.Error(w, errBadSignature.Error(), http.StatusUnauthorized)
+		return
+	}
+	switch act.Type {
+	case "Follow":
+		if signer.Inbox == "" {
+			http.Error(w, "actor has no inbox", http.StatusBadRequest)
+			return
+		}
+		// The Accept goes to the inbox, which must be on the actor's server
+		inbox, err := url.Parse(signer.Inbox)
+		actorURL, _ := url.Parse(signer.ID)
+		if err != nil || actorURL == nil || inbox.Host != actorURL.Host || (inbox.Scheme != "http" && inbox.Scheme != "https") {
+			http.Error(w, "inbox is not on the actor's server", http.StatusBadRequest)
+			return
+		}
+		apState.mu.Lock()
+		apState.load()
+		apState.Followers[act.Actor] = signer.Inbox
+		apState.save()
+		apState.mu.Unlock()
+		accept, _ := json.Marshal(map[string]any{
+			"@context": activityStreams,
+			"id":       apURL("/ap/accept/") + base64.RawURLEncoding.EncodeToString(sha256Sum([]byte(act.ID))),
+			"type":     "Accept",
+			"actor":    apActorID(),
+			"object":   json.RawMessage(body),
+		})
+		go func() {
+			if err := apDeliver(signer.Inbox, accept); err != nil {
+				log.Printf("ActivityPub accept to %s failed: %v", signer.Inbox, err)
+			}
+		}()
+	case "Undo":
+		var inner apActivity
+		if json.Unmarshal(act.Object, &inner) == nil && inner.Type == "Follow" && inner.Actor == act.Actor {
+			apState.mu.Lock()
+			apState.load()
+			delete(apState.Followers, act.Actor)
+			apState.save()
+			apState.mu.Unlock()
+		}
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func sha256Sum(b []byte) []byte {
+	sum := sha256.Sum256(b)
+	return sum[:]
+}
+
+func writeActivityJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", activityJSON+"; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// handleActivityPub serves the actor, its outbox and followers, and the
+// federated notes under /ap/.
+func handleActivityPub(w http.ResponseWriter, r *http.Request) {
+	if config.ActivityPub == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.URL.Path == "/ap/inbox" {
+		handleAPInbox(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	apState.mu.Lock()
+	apState.load()
+	published := map[string]time.Time{}
+	for k, v := range apState.Published {
+		published[k] = v
+	}
+	followers := len(apState.Followers)
+	apState.mu.Unlock()
+	switch p := r.URL.Path; {
+	case p == "/ap/actor":
+		actor, err := apActor()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeActivityJSON(w, actor)
+	case p == "/ap/followers":
+		writeActivityJSON(w, map[string]any{
+			"@context":   activityStreams,
+			"id":         apURL("/ap/followers"),
+			"type":       "OrderedCollection",
+			"totalItems": followers,
+		})
+	case p == "/ap/outbox":
+		var names []string
+		for name := range published {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool { return published[names[i]].After(published[names[j]]) })
+		items := []any{}
+		for _, name := range names {
+			if md, ok := federatable(name); ok {
+				items = append(items, apCreate(apNote(name, md, published[name])))
+			}
+		}
+		writeActivityJSON(w, map[string]any{
+			"@context":     activityStreams,
+			"id":           apURL("/ap/outbox"),
+			"type":         "OrderedCollection",
+			"totalItems":   len(items),
+			"orderedItems": items,
+		})
+	case strings.HasPrefix(p, "/ap/notes/"):
+		name := noteForPage(strings.TrimPrefix(p, "/ap/notes/") + ".html")
+		when, ok := published[name]
+		md, public := federatable(name)
+		if name == "" || !ok || !public {
+			http.NotFound(w, r)
+			return
+		}
+		note := apNote(name, md, when)
+		note["@context"] = activityStreams
+		writeActivityJSON(w, note)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleWebFinger answers WebFinger lookups for the account, which is how
+// other servers find the actor from @user@host.
+func handleWebFinger(w http.ResponseWriter, r *http.Request) {
+	a := config.ActivityPub
+	if a == nil {
+		http.NotFound(w, r)
+		return
+	}
+	u, _ := url.Parse(a.ServerURL)
+	if !strings.EqualFold(r.URL.Query().Get("resource"), "acct:"+a.Username+"@"+u.Host) {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/jrd+json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"subject": "acct:" + a.Username + "@" + u.Host,
+		"links": []map[string]string{
+			{"rel": "self", "type": activityJSON, "href": apActorID()},
+			{"rel": "http://webfinger.net/rel/profile-page", "type": "text/html", "href": config.SiteURL},
+		},
+	})
+}
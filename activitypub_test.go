@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func resetActivityPub(t *testing.T, serverURL string) {
+	t.Helper()
+	config.SiteURL = "https://example.com/"
+	config.ActivityPub = &activityPubConfig{ServerURL: serverURL, Username: "blog"}
+	apKey, apState = nil, &apStore{}
+	// The test servers are on loopback, which apClient refuses
+	client := apClient
+	apClient = &http.Client{Timeout: 10 * time.Second}
+	t.Cleanup(func() {
+		config.SiteURL, config.ActivityPub = "", nil
+		apKey, apState = nil, &apStore{}
+		apClient = client
+	})
+}
+
+// remoteActor is another server's account that follows the blog.
+type remoteActor struct {
+	srv      *httptest.Server
+	key      *rsa.PrivateKey
+	received chan string    // types of activities delivered to its inbox
+	inbox    string         // the inbox its actor names; its own by default
+	keyID    string         // the keyId it signs with; its actor's key by default
+	docs     map[string]any // other documents it serves, by path
+}
+
+func newRemoteActor(t *testing.T) *remoteActor {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ra := &remoteActor{key: key, received: make(chan string, 10)}
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	ra.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/actor":
+			inbox := ra.inbox
+			if inbox == "" {
+				inbox = ra.srv.URL + "/inbox"
+			}
+			json.NewEncoder(w).Encode(map[string]any{
+				"id":    ra.srv.URL + "/actor",
+				"inbox": inbox,
+				"publicKey": map[string]string{
+					"id":           ra.srv.URL + "/actor#key",
+					"owner":        ra.srv.URL + "/actor",
+					"publicKeyPem": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+				},
+			})
+		case "/inbox":
+			body, _ := io.ReadAll(r.Body)
+			if _, err := apVerify(r, body, apActorID()); err != nil {
+				t.Errorf("delivery not signed by the blog: %v", err)
+			}
+			var act apActivity
+			json.Unmarshal(body, &act)
+			ra.received <- act.Type
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			if doc, ok := ra.docs[r.URL.Path]; ok {
+				json.NewEncoder(w).Encode(doc)
+				return
+			}
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(ra.srv.Close)
+	return ra
+}
+
+// post signs and posts an activity to inbox as the remote actor.
+func (ra *remoteActor) post(t *testing.T, inbox string, activity map[string]any, sign bool) int {
+	t.Helper()
+	body, _ := json.Marshal(activity)
+	req, _ := http.NewRequest(http.MethodPost, inbox, bytes.NewReader(body))
+	req.Header.Set("Content-Type", activityJSON)
+	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("Digest", apDigest(body))
+	if sign {
+		headers := []string{"(request-target)", "host", "date", "digest"}
+		sum := sha256.Sum256([]byte(apSigningString(req, headers)))
+		sig, _ := rsa.SignPKCS1v15(rand.Reader, ra.key, crypto.SHA256, sum[:])
+		keyID := ra.keyID
+		if keyID == "" {
+			keyID = ra.srv.URL + "/actor#key"
+		}
+		req.Header.Set("Signature", fmt.Sprintf(`keyId="%s",headers="%s",signature="%s"`,
+			keyID, strings.Join(headers, " "), base64.StdEncoding.EncodeToString(sig)))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func (ra *remoteActor) expect(t *testing.T, typ string) {
+	t.Helper()
+	select {
+	case got := <-ra.received:
+		if got != typ {
+			t.Fatalf("delivered %s, want %s", got, typ)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no %s delivered", typ)
+	}
+}
+
+func TestLoadConfig_ActivityPub(t *testing.T) {
+	chdirTemp(t)
+	for _, bad := range []string{
+		`{"activitypub": {"server_url": "https://notes.example.com", "username": "blog"}}`,
+		`{"site_url": "https://example.com/", "activitypub": {"server_url": "https://notes.example.com/sub", "username": "blog"}}`,
+		`{"site_url": "https://example.com/", "activitypub": {"server_url": "https://notes.example.com", "username": "a b"}}`,
+	} {
+		if err := os.WriteFile("minimark.json", []byte(bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadConfig("minimark.json"); err == nil {
+			t.Errorf("%s accepted", bad)
+		}
+	}
+}
+
+func TestWebFinger(t *testing.T) {
+	chdirTemp(t)
+	resetActivityPub(t, "https://notes.example.com")
+	rr := httptest.NewRecorder()
+	handleWebFinger(rr, httptest.NewRequest(http.MethodGet, "/.well-known/webfinger?resource=acct:blog@notes.example.com", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"href":"https://notes.example.com/ap/actor"`) {
+		t.Errorf("%d %s", rr.Code, rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	handleWebFinger(rr, httptest.NewRequest(http.MethodGet, "/.well-known/webfinger?resource=acct:other@notes.example.com", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("unknown account: %d", rr.Code)
+	}
+}
+
+func TestActivityPubFollowAndPublish(t *testing.T) {
+	chdirTemp(t)
+	local := httptest.NewServer(http.HandlerFunc(handleActivityPub))
+	defer local.Close()
+	resetActivityPub(t, local.URL)
+	ra := newRemoteActor(t)
+	follow := map[string]any{
+		"id":     ra.srv.URL + "/follows/1",
+		"type":   "Follow",
+		"actor":  ra.srv.URL + "/actor",
+		"object": local.URL + "/ap/actor",
+	}
+
+	if code := ra.post(t, local.URL+"/ap/inbox", follow, false); code != http.StatusUnauthorized {
+		t.Fatalf("unsigned follow: %d", code)
+	}
+	if code := ra.post(t, local.URL+"/ap/inbox", follow, true); code != http.StatusAccepted {
+		t.Fatalf("follow: %d", code)
+	}
+	ra.expect(t, "Accept")
+
+	writeFiles(t, map[string]string{
+		"post.md":  "---\ntitle: Hello\ndate: 2024-05-01\n---\nFirst post.\n",
+		"draft.md": "Undated.\n",
+	})
+	publishActivity("draft.md")
+	publishActivity("post.md")
+	ra.expect(t, "Create")
+	publishActivity("post.md")
+	select {
+	case typ := <-ra.received:
+		t.Fatalf("delivered again: %s", typ)
+	default:
+	}
+
+	resp, err := http.Get(local.URL + "/ap/outbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var outbox struct {
+		TotalItems   int `json:"totalItems"`
+		OrderedItems []struct {
+			Object map[string]any `json:"object"`
+		} `json:"orderedItems"`
+	}
+	json.NewDecoder(resp.Body).Decode(&outbox)
+	resp.Body.Close()
+	if outbox.TotalItems != 1 || outbox.OrderedItems[0].Object["url"] != "https://example.com/post.html" ||
+		!strings.Contains(outbox.OrderedItems[0].Object["content"].(string), "First post.") {
+		t.Errorf("outbox %+v", outbox)
+	}
+	if resp, err := http.Get(local.URL + "/ap/notes/post"); err != nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("note: %v %v", resp, err)
+	}
+
+	undo := map[string]any{"id": ra.srv.URL + "/undo/1", "type": "Undo", "actor": ra.srv.URL + "/actor", "object": follow}
+	if code := ra.post(t, local.URL+"/ap/inbox", undo, true); code != http.StatusAccepted {
+		t.Fatalf("undo: %d", code)
+	}
+	if n := len(apState.Followers); n != 0 {
+		t.Errorf("%d followers after undo", n)
+	}
+}
+
+func TestActivityPubInbox_ForgedActor(t *testing.T) {
+	chdirTemp(t)
+	local := httptest.NewServer(http.HandlerFunc(handleActivityPub))
+	defer local.Close()
+	resetActivityPub(t, local.URL)
+	victim := newRemoteActor(t)
+	alice := victim.srv.URL + "/actor"
+	follow := map[string]any{"id": victim.srv.URL + "/follows/1", "type": "Follow", "actor": alice, "object": local.URL + "/ap/actor"}
+	if code := victim.post(t, local.URL+"/ap/inbox", follow, true); code != http.StatusAccepted {
+		t.Fatalf("follow: %d", code)
+	}
+	victim.expect(t, "Accept")
+
+	// The attacker signs with their own key, from documents naming alice
+	evil := newRemoteActor(t)
+	der, _ := x509.MarshalPKIXPublicKey(&evil.key.PublicKey)
+	pemKey := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	evil.docs = map[string]any{
+		"/key": map[string]any{"id": alice, "publicKey": map[string]string{"id": evil.srv.URL + "/key", "owner": alice, "publicKeyPem": pemKey}},
+		"/own": map[string]any{"id": evil.srv.URL + "/own", "publicKey": map[string]string{"id": evil.srv.URL + "/own", "owner": alice, "publicKeyPem": pemKey}},
+	}
+	undo := map[string]any{"id": evil.srv.URL + "/undo/1", "type": "Undo", "actor": alice, "object": follow}
+	for _, key := range []string{"/key", "/own"} {
+		evil.keyID = evil.srv.URL + key
+		if code := evil.post(t, local.URL+"/ap/inbox", undo, true); code != http.StatusUnauthorized {
+			t.Errorf("undo signed with %s: %d", key, code)
+		}
+	}
+	if n := len(apState.Followers); n != 1 {
+		t.Errorf("%d followers after forged undo", n)
+	}
+}
+
+func TestActivityPubInbox_Refused(t *testing.T) {
+	chdirTemp(t)
+	local := httptest.NewServer(http.HandlerFunc(handleActivityPub))
+	defer local.Close()
+	resetActivityPub(t, local.URL)
+	ra := newRemoteActor(t)
+	follow := map[string]any{"id": ra.srv.URL + "/follows/1", "type": "Follow", "actor": ra.srv.URL + "/actor", "object": local.URL + "/ap/actor"}
+
+	// The Accept would go to another server
+	ra.inbox = "http://localhost:1/inbox"
+	if code := ra.post(t, local.URL+"/ap/inbox", follow, true); code != http.StatusBadRequest {
+		t.Errorf("follow with a foreign inbox: %d", code)
+	}
+
+	// A keyId on loopback is never fetched
+	ra.inbox = ""
+	apClient = newPublicClient()
+	if code := ra.post(t, local.URL+"/ap/inbox", follow, true); code != http.StatusUnauthorized {
+		t.Errorf("follow signed by a loopback key: %d", code)
+	}
+	if n := len(apState.Followers); n != 0 {
+		t.Errorf("%d followers", n)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+)
+
+// analyticsConfig adds a Plausible, GoatCounter or Google Analytics snippet
+// to every exported page except those with "analytics: false".
+type analyticsConfig struct {
+	Provider string `json:"provider"` // "plausible", "goatcounter" or "ga"
+	// ID is the site domain (Plausible), site code (GoatCounter) or
+	// measurement ID (GA).
+	ID string `json:"id"`
+	// Src overrides the script URL, e.g. for a self-hosted Plausible.
+	Src string `json:"src,omitempty"`
+}
+
+// analyticsHook marks where the snippet goes; without it the snippet goes
+// before </head>.
+const analyticsHook = "{{analytics}}"
+
+var analyticsIDRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+func validateAnalytics(a *analyticsConfig) error {
+	if a == nil {
+		return nil
+	}
+	switch a.Provider {
+	case "plausible", "goatcounter", "ga":
+	default:
+		return fmt.Errorf("analytics: unknown provider %q", a.Provider)
+	}
+	if !analyticsIDRe.MatchString(a.ID) {
+		return fmt.Errorf("analytics: invalid id %q", a.ID)
+	}
+	if a.Src != "" && !isRemoteAsset(a.Src) {
+		return fmt.Errorf("analytics: src %q must be a URL", a.Src)
+	}
+	return nil
+}
+
+// analyticsSnippet returns the tracking script for the configured provider.
+func analyticsSnippet() string {
+	a := config.Analytics
+	id := html.EscapeString(a.ID)
+	src := html.EscapeString(a.Src)
+	switch a.Provider {
+	case "plausible":
+		if src == "" {
+			src = "https://plausible.io/js/script.js"
+		}
+		return fmt.Sprintf(`<script defer data-domain="%s" src="%s"></script>`+"\n", id, src)
+	case "goatcounter":
+		if src == "" {
+			src = "https://gc.zgo.at/count.js"
+		}
+		return fmt.Sprintf(`<script data-goatcounter="https://%s.goatcounter.com/count" async src="%s"></script>`+"\n", id, src)
+	default:
+		if src == "" {
+			src = "https://www.googletagmanager.com/gtag/js?id=" + id
+		}
+		return fmt.Sprintf(`<script async src="%s"></script>`+"\n"+
+			`<script>window.dataLayer=window.dataLayer||[];function gtag(){dataLayer.push(arguments)}gtag('js',new Date());gtag('config','%s');</script>`+"\n", src, id)
+	}
+}
+
+// applyAnalytics adds the analytics snippet for page md to its header, or
+// at the {{analytics}} hook. The hook is removed when the page opts out.
+func applyAnalytics(md, header, footer []byte) ([]byte, []byte) {
+	snippet := ""
+	if config.Analytics != nil {
+		fields, _ := parseFrontMatter(md)
+		if on, err := strconv.ParseBool(fields["analytics"]); err != nil || on {
+			snippet = analyticsSnippet()
+		}
+	}
+	hook := []byte(analyticsHook)
+	if bytes.Contains(header, hook) || bytes.Contains(footer, hook) {
+		return bytes.ReplaceAll(header, hook, []byte(snippet)), bytes.ReplaceAll(footer, hook, []byte(snippet))
+	}
+	if snippet == "" {
+		return header, footer
+	}
+	if h := insertBeforeTag(header, "</head>", snippet); len(h) > len(header) {
+		return h, footer
+	}
+	return append([]byte(snippet), header...), footer
+}
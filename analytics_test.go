@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestApplyAnalytics(t *testing.T) {
+	header := []byte("<html><head><title>x</title></head><body>")
+	if h, _ := applyAnalytics([]byte("# x"), header, nil); string(h) != string(header) {
+		t.Fatalf("unconfigured: %q", h)
+	}
+
+	withConfig(t, siteConfig{Analytics: &analyticsConfig{Provider: "plausible", ID: "docs.example.com"}})
+	h, _ := applyAnalytics([]byte("# x"), header, nil)
+	want := "<html><head><title>x</title><script defer data-domain=\"docs.example.com\" src=\"https://plausible.io/js/script.js\"></script>\n</head><body>"
+	if string(h) != want {
+		t.Fatalf("header = %q", h)
+	}
+	if h, _ := applyAnalytics([]byte("---\nanalytics: false\n---\n# x"), header, nil); string(h) != string(header) {
+		t.Fatalf("opted out: %q", h)
+	}
+	// Without </head> the snippet starts the page
+	if h, _ := applyAnalytics(nil, []byte("<p>"), nil); string(h) != "<script defer data-domain=\"docs.example.com\" src=\"https://plausible.io/js/script.js\"></script>\n<p>" {
+		t.Fatalf("header = %q", h)
+	}
+
+	withConfig(t, siteConfig{Analytics: &analyticsConfig{Provider: "goatcounter", ID: "mysite"}})
+	h, f := applyAnalytics(nil, header, []byte("{{analytics}}</body>"))
+	if string(h) != string(header) || string(f) != "<script data-goatcounter=\"https://mysite.goatcounter.com/count\" async src=\"https://gc.zgo.at/count.js\"></script>\n</body>" {
+		t.Fatalf("got %q %q", h, f)
+	}
+	if _, f := applyAnalytics([]byte("---\nanalytics: false\n---\n"), header, []byte("{{analytics}}</body>")); string(f) != "</body>" {
+		t.Fatalf("hook not removed: %q", f)
+	}
+}
+
+func TestLoadConfig_Analytics(t *testing.T) {
+	chdirTemp(t)
+	for _, bad := range []string{
+		`{"analytics": {"provider": "matomo", "id": "x"}}`,
+		`{"analytics": {"provider": "ga", "id": "G-1'); alert(1); ('"}}`,
+		`{"analytics": {"provider": "plausible", "id": "x.com", "src": "js/p.js"}}`,
+	} {
+		if err := os.WriteFile("minimark.json", []byte(bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadConfig("minimark.json"); err == nil {
+			t.Errorf("%s accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// archiveDir is where the archive pages go inside docs.
+const archiveDir = "archive"
+
+var monthHeadingRe = regexp.MustCompile(`<h2>([A-Z][a-z]+)</h2>`)
+
+// writeArchives exports docs/archive/index.html, listing the years and
+// months that have dated pages, and docs/archive/<year>/index.html, listing
+// that year's pages by month, newest first. Pages are dated by their front
+// matter date:. Enabled by archive in minimark.json.
+func writeArchives(cmark, docsDir string) {
+	if !config.Archive {
+		return
+	}
+	docs, err := docIndex.refresh(".")
+	if err != nil {
+		log.Printf("archives not written: %v", err)
+		return
+	}
+	docs = publishedDocs(docs)
+	var dated []docMeta
+	for _, d := range docs {
+		if !d.Date.IsZero() {
+			dated = append(dated, d)
+		}
+	}
+	sort.Slice(dated, func(i, j int) bool {
+		if !dated[i].Date.Equal(dated[j].Date) {
+			return dated[i].Date.After(dated[j].Date)
+		}
+		return strings.ToLower(docTitle(dated[i])) < strings.ToLower(docTitle(dated[j]))
+	})
+	root := filepath.Join(docsDir, archiveDir)
+	_ = os.RemoveAll(wsPath(root)) // drop years that no longer have pages
+
+	var index strings.Builder
+	index.WriteString("# Archive\n")
+	for i := 0; i < len(dated); {
+		year := dated[i].Date.Year()
+		j := i
+		for j < len(dated) && dated[j].Date.Year() == year {
+			j++
+		}
+		posts := dated[i:j]
+		fmt.Fprintf(&index, "\n## [%d](%s/%d/index.html)\n\n", year, archiveDir, year)
+
+		var page strings.Builder
+		fmt.Fprintf(&page, "# %d\n", year)
+		for k := 0; k < len(posts); {
+			month := posts[k].Date.Month()
+			n := 0
+			fmt.Fprintf(&page, "\n## %s\n\n", month)
+			for ; k < len(posts) && posts[k].Date.Month() == month; k++ {
+				d := posts[k]
+				fmt.Fprintf(&page, "- %s [%s](%s)\n", d.Date.Format("2006-01-02"), markdownLinkText(docTitle(d)), htmlOutNameFor(d.Name))
+				n++
+			}
+			fmt.Fprintf(&index, "- [%s](%s/%d/index.html#%s) (%d)\n", month, archiveDir, year, strings.ToLower(month.String()), n)
+		}
+		yearPage, err := nestedPage(cmark, "../../", page.String())
+		writeNestedPage(filepath.Join(root, strconv.Itoa(year), "index.html"), monthAnchors(yearPage), err)
+		i = j
+	}
+	indexPage, err := nestedPage(cmark, "../", index.String())
+	writeNestedPage(filepath.Join(root, "index.html"), indexPage, err)
+}
+
+// monthAnchors gives the month headings of a year page ids ("march") for
+// the archive index to link to.
+func monthAnchors(page []byte) []byte {
+	return monthHeadingRe.ReplaceAllFunc(page, func(h []byte) []byte {
+		month := monthHeadingRe.FindSubmatch(h)[1]
+		return []byte(fmt.Sprintf(`<h2 id="%s">%s</h2>`, strings.ToLower(string(month)), month))
+	})
+}
+
+// nestedPage renders md as a page that lives in a folder below docs,
+// adding a <base> so links and the header's assets resolve against the
+// docs root, base being the path back to it.
+func nestedPage(cmark, base, md string) ([]byte, error) {
+	page, err := renderPage(cmark, []byte(md))
+	if err != nil {
+		return nil, err
+	}
+	return withBase(page, base), nil
+}
+
+// withBase adds a <base href> to page, right after <head> when it has one.
+func withBase(page []byte, base string) []byte {
+	tag := `<base href="` + html.EscapeString(base) + `">` + "\n"
+	if loc := headOpenRe.FindIndex(page); loc != nil {
+		return append(append(append([]byte{}, page[:loc[1]]...), "\n"+tag...), page[loc[1]:]...)
+	}
+	return append([]byte(tag), page...)
+}
+
+// writeNestedPage writes page to path, creating its folder, and logs
+// failures, including err from rendering it.
+func writeNestedPage(path string, page []byte, err error) {
+	if err == nil {
+		if err = os.MkdirAll(wsPath(filepath.Dir(path)), 0755); err == nil {
+			err = os.WriteFile(wsPath(path), page, 0644)
+		}
+	}
+	if err != nil {
+		log.Printf("%s not written: %v", path, err)
+	}
+}
+
+// markdownLinkText escapes the characters that would end link text early.
+func markdownLinkText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`).Replace(s)
+}
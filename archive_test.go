@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// echoCmark installs a cmark-gfm stand-in that outputs its input unchanged
+// and returns its path.
+func echoCmark(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows")
+	}
+	bin := t.TempDir()
+	path := filepath.Join(bin, "cmark-gfm")
+	script := "#!/bin/sh\nwhile IFS= read -r line; do printf '%s\\n' \"$line\"; done\n"
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestWriteArchives(t *testing.T) {
+	chdirTemp(t)
+	docIndex = &metaIndex{}
+	cmark := echoCmark(t)
+	if err := os.MkdirAll("_includes", 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, map[string]string{
+		filepath.Join("_includes", "header.html"): "<html><head><link rel=\"stylesheet\" href=\"neat.css\"></head><body>\n",
+		"a.md":     "---\ndate: 2024-03-05\n---\n# Spring [draft]",
+		"b.md":     "---\ndate: 2024-03-20\n---\n# Later",
+		"c.md":     "---\ndate: 2024-11-01\n---\n# Autumn",
+		"d.md":     "---\ndate: 2023-01-15\n---\n# Old",
+		"plain.md": "# Undated",
+	})
+	if err := os.MkdirAll(filepath.Join("docs", archiveDir, "1999"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	writeArchives(cmark, "docs")
+	if _, err := os.Stat(filepath.Join("docs", archiveDir, "index.html")); !os.IsNotExist(err) {
+		t.Fatalf("archives written without archive set")
+	}
+	withConfig(t, siteConfig{Archive: true})
+	writeArchives(cmark, "docs")
+
+	read := func(parts ...string) string {
+		b, err := os.ReadFile(filepath.Join(append([]string{"docs", archiveDir}, parts...)...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	index := read("index.html")
+	wantIndex := "# Archive\n\n## [2024](archive/2024/index.html)\n\n- [November](archive/2024/index.html#november) (1)\n- [March](archive/2024/index.html#march) (2)\n\n## [2023](archive/2023/index.html)\n\n- [January](archive/2023/index.html#january) (1)\n"
+	if !strings.HasPrefix(index, "<html><head>\n<base href=\"../\">\n<link") || !strings.HasSuffix(index, wantIndex) {
+		t.Fatalf("index = %q", index)
+	}
+	year := read("2024", "index.html")
+	wantYear := "# 2024\n\n## November\n\n- 2024-11-01 [Autumn](c.html)\n\n## March\n\n- 2024-03-20 [Later](b.html)\n- 2024-03-05 [Spring \\[draft\\]](a.html)\n"
+	if !strings.Contains(year, "<base href=\"../../\">") || !strings.HasSuffix(year, wantYear) {
+		t.Fatalf("2024 = %q", year)
+	}
+	if _, err := os.Stat(filepath.Join("docs", archiveDir, "1999")); !os.IsNotExist(err) {
+		t.Fatalf("stale year kept")
+	}
+}
+
+func TestMonthAnchors(t *testing.T) {
+	got := string(monthAnchors([]byte("<h2>March</h2>\n<h2><a href=\"x\">2024</a></h2>")))
+	if got != "<h2 id=\"march\">March</h2>\n<h2><a href=\"x\">2024</a></h2>" {
+		t.Fatalf("got %q", got)
+	}
+}
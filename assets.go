@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// defaultAssets are embedded files every exported site needs. Each is
+// written to docs unless _includes supplies its own.
+var defaultAssets = []string{"print.css", "theme-light.css", "theme-dark.css", "theme.js", "footnotes.css"}
+
+// writeDefaultAssets installs the embedded default assets into dstDir,
+// leaving any file already there untouched.
+func writeDefaultAssets(dstDir string) error {
+	for _, name := range defaultAssets {
+		dst := filepath.Join(dstDir, name)
+		if _, err := os.Stat(wsPath(dst)); err == nil {
+			continue
+		}
+		b, err := embeddedIncludes.ReadFile("static/" + name)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(wsPath(dst), b, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
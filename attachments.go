@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// attachment is one file in uploadsDir, as listed by /attachments.
+type attachment struct {
+	Name  string   `json:"name"`
+	Path  string   `json:"path"`
+	Size  int64    `json:"size"`
+	Notes []string `json:"notes"` // notes linking the file; empty when orphaned
+}
+
+// referencesUpload reports whether md links the upload name, as
+// assets/<name> not followed by more of a file name.
+func referencesUpload(md []byte, name string) bool {
+	ref := []byte(uploadsDir + "/" + name)
+	for i := 0; ; {
+		j := bytes.Index(md[i:], ref)
+		if j < 0 {
+			return false
+		}
+		i += j + len(ref)
+		rest := md[i:]
+		// A dot ends the name unless more of one follows, as in a.png.bak
+		if len(rest) > 0 && rest[0] == '.' {
+			rest = rest[1:]
+		}
+		if len(rest) == 0 || !uploadNameByte(rest[0]) {
+			return true
+		}
+	}
+}
+
+// uploadNameByte reports whether c can be part of an upload name other
+// than a dot.
+func uploadNameByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// uploadReferences returns, for each name, the notes linking it, and the
+// notes that could not be read, such as encrypted ones without the key.
+func uploadReferences(names []string) (map[string][]string, []string, error) {
+	refs := make(map[string][]string, len(names))
+	var unread []string
+	notes, err := listMarkdownFiles(".")
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, note := range notes {
+		md, err := readNote(note)
+		if err != nil {
+			unread = append(unread, note)
+			continue
+		}
+		if !bytes.Contains(md, []byte(uploadsDir+"/")) {
+			continue
+		}
+		for _, name := range names {
+			if referencesUpload(md, name) {
+				refs[name] = append(refs[name], note)
+			}
+		}
+	}
+	sort.Strings(unread)
+	return refs, unread, nil
+}
+
+// listAttachments returns the files in uploadsDir by name, with the notes
+// linking each.
+func listAttachments() ([]attachment, error) {
+	entries, err := os.ReadDir(wsPath(uploadsDir))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	list := []attachment{}
+	var names []string
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !info.Mode().IsRegular() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		names = append(names, e.Name())
+		list = append(list, attachment{Name: e.Name(), Path: uploadsDir + "/" + e.Name(), Size: info.Size()})
+	}
+	refs, _, err := uploadReferences(names)
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		list[i].Notes = append([]string{}, refs[list[i].Name]...)
+		sort.Strings(list[i].Notes)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// handleAttachments lists the uploaded files with their sizes and the notes
+// linking them; ?unused=true lists only those no note links.
+func handleAttachments(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	list, err := listAttachments()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if r.URL.Query().Get("unused") == "true" {
+		unused := []attachment{}
+		for _, a := range list {
+			if len(a.Notes) == 0 {
+				unused = append(unused, a)
+			}
+		}
+		list = unused
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(list)
+}
+
+// handleDeleteAttachment removes the upload given by `name` and its copy in
+// the export directory. It answers 409 while a note still links the file,
+// or while some note could not be read unless `force=true` is given.
+func handleDeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.URL.Query().Get("name")
+	if name == "" || filepath.Base(name) != name || strings.HasPrefix(name, ".") {
+		http.Error(w, "invalid filename", http.StatusBadRequest)
+		return
+	}
+	path := filepath.Join(uploadsDir, name)
+	if info, err := os.Stat(wsPath(path)); err != nil || !info.Mode().IsRegular() {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	refs, unread, err := uploadReferences([]string{name})
+	if err != nil {
+		http.Error(w, "cannot check links: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if notes := refs[name]; len(notes) > 0 {
+		sort.Strings(notes)
+		http.Error(w, "still linked from "+strings.Join(notes, ", "), http.StatusConflict)
+		return
+	}
+	if len(unread) > 0 && r.URL.Query().Get("force") != "true" {
+		http.Error(w, "cannot check links in "+strings.Join(unread, ", ")+"; pass force=true to delete anyway", http.StatusConflict)
+		return
+	}
+	if err := os.Remove(wsPath(path)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_ = os.Remove(wsPath(filepath.Join(exportDir, uploadsDir, name)))
+	w.WriteHeader(http.StatusNoContent)
+}
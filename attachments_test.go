@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReferencesUpload(t *testing.T) {
+	tests := []struct {
+		md   string
+		want bool
+	}{
+		{"![](assets/a.png)", true},
+		{"see assets/a.png.", true},
+		{`<img src="/assets/a.png">`, true},
+		{"assets/a.png", true},
+		{"![](assets/a.png.bak)", false},
+		{"![](assets/a.png-1)", false},
+		{"![](assets/ba.png)", false},
+		{"![](assets/aa.png) then assets/a.png", true},
+		{"a.png", false},
+	}
+	for _, tt := range tests {
+		if got := referencesUpload([]byte(tt.md), "a.png"); got != tt.want {
+			t.Errorf("referencesUpload(%q) = %v, want %v", tt.md, got, tt.want)
+		}
+	}
+}
+
+func TestHandleAttachments(t *testing.T) {
+	chdirTemp(t)
+	if err := os.Mkdir(uploadsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, map[string]string{
+		"one.md":          "![](assets/shot.png)\n",
+		"two.md":          "[pdf](assets/doc.pdf) and ![](assets/shot.png)\n",
+		"assets/shot.png": "png",
+		"assets/doc.pdf":  "pdf!",
+		"assets/old.gif":  "gif",
+	})
+	get := func(url string) []attachment {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		handleAttachments(rr, httptest.NewRequest(http.MethodGet, url, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d", url, rr.Code)
+		}
+		var list []attachment
+		if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+			t.Fatal(err)
+		}
+		return list
+	}
+	list := get("/attachments")
+	if len(list) != 3 {
+		t.Fatalf("list = %+v", list)
+	}
+	if a := list[0]; a.Name != "doc.pdf" || a.Path != "assets/doc.pdf" || a.Size != 4 || strings.Join(a.Notes, ",") != "two.md" {
+		t.Errorf("doc.pdf = %+v", a)
+	}
+	if a := list[1]; a.Name != "old.gif" || a.Notes == nil || len(a.Notes) != 0 {
+		t.Errorf("old.gif = %+v", a)
+	}
+	if a := list[2]; a.Name != "shot.png" || strings.Join(a.Notes, ",") != "one.md,two.md" {
+		t.Errorf("shot.png = %+v", a)
+	}
+	if list := get("/attachments?unused=true"); len(list) != 1 || list[0].Name != "old.gif" {
+		t.Errorf("unused = %+v", list)
+	}
+}
+
+func TestHandleAttachments_NoUploads(t *testing.T) {
+	chdirTemp(t)
+	rr := httptest.NewRecorder()
+	handleAttachments(rr, httptest.NewRequest(http.MethodGet, "/attachments", nil))
+	if rr.Code != http.StatusOK || strings.TrimSpace(rr.Body.String()) != "[]" {
+		t.Errorf("GET = %d %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestHandleDeleteAttachment(t *testing.T) {
+	chdirTemp(t)
+	if err := os.MkdirAll(filepath.Join(exportDir, uploadsDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(uploadsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, map[string]string{
+		"one.md":          "![](assets/shot.png)\n",
+		"assets/shot.png": "png",
+		"assets/old.gif":  "gif",
+		filepath.Join(exportDir, uploadsDir, "old.gif"): "gif",
+	})
+	del := func(method, name string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handleDeleteAttachment(rr, httptest.NewRequest(method, "/attachments/delete?name="+name, nil))
+		return rr
+	}
+	if rr := del(http.MethodGet, "old.gif"); rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET = %d", rr.Code)
+	}
+	for _, name := range []string{"", "..%2Fone.md", ".hidden"} {
+		if rr := del(http.MethodPost, name); rr.Code != http.StatusBadRequest {
+			t.Errorf("name %q = %d", name, rr.Code)
+		}
+	}
+	if rr := del(http.MethodPost, "missing.png"); rr.Code != http.StatusNotFound {
+		t.Errorf("missing = %d", rr.Code)
+	}
+
+	// A linked file is kept
+	rr := del(http.MethodPost, "shot.png")
+	if rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), "one.md") {
+		t.Errorf("linked = %d %q", rr.Code, rr.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(uploadsDir, "shot.png")); err != nil {
+		t.Error("linked file removed")
+	}
+
+	// An orphan is removed with its export
+	if rr := del(http.MethodPost, "old.gif"); rr.Code != http.StatusNoContent {
+		t.Fatalf("orphan = %d %q", rr.Code, rr.Body.String())
+	}
+	for _, p := range []string{filepath.Join(uploadsDir, "old.gif"), filepath.Join(exportDir, uploadsDir, "old.gif")} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s still there", p)
+		}
+	}
+}
+
+func TestHandleDeleteAttachment_UnreadNote(t *testing.T) {
+	chdirTemp(t)
+	withNoteSecret(t, "s3cret")
+	if err := os.Mkdir(uploadsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := sealNote([]byte("![](assets/old.gif)\n"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, map[string]string{"diary.md": string(sealed), "assets/old.gif": "gif"})
+	noteSecret = nil
+	noteKeys = map[string][]byte{}
+
+	del := func(query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handleDeleteAttachment(rr, httptest.NewRequest(http.MethodPost, "/attachments/delete?"+query, nil))
+		return rr
+	}
+	rr := del("name=old.gif")
+	if rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), "diary.md") {
+		t.Errorf("unread note = %d %q", rr.Code, rr.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(uploadsDir, "old.gif")); err != nil {
+		t.Fatal("file removed while a note could not be checked")
+	}
+	if rr := del("name=old.gif&force=true"); rr.Code != http.StatusNoContent {
+		t.Errorf("force = %d %q", rr.Code, rr.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(uploadsDir, "old.gif")); !os.IsNotExist(err) {
+		t.Error("forced delete kept the file")
+	}
+}
+
+func TestHandleDeleteAttachment_ListError(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can list any directory")
+	}
+	dir := chdirTemp(t)
+	if err := os.Mkdir(uploadsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, map[string]string{"note.md": "![](assets/old.gif)\n", "assets/old.gif": "gif"})
+	// The workspace can be entered but not listed
+	if err := os.Chmod(dir, 0300); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chmod(dir, 0755) })
+	rr := httptest.NewRecorder()
+	handleDeleteAttachment(rr, httptest.NewRequest(http.MethodPost, "/attachments/delete?name=old.gif", nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("list error = %d %q", rr.Code, rr.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(uploadsDir, "old.gif")); err != nil {
+		t.Fatal("file removed while notes could not be listed")
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// batchRequest is the JSON body accepted by POST /batch.
+type batchRequest struct {
+	Ops []batchOp `json:"ops"`
+	// Atomic (the default) applies all operations or none; with false,
+	// valid operations are applied even when others fail.
+	Atomic *bool `json:"atomic,omitempty"`
+}
+
+// batchOp is a single housekeeping operation:
+//
+//	{"op": "rename", "file": "a.md", "to": "b.md"}
+//	{"op": "move",   "file": "a.md", "to": "archive"}
+//	{"op": "tag",    "file": "a.md", "add": ["x"], "remove": ["y"]}
+//
+// The workspace is flat, so move archives a note out of it: the note is
+// kept on disk in the folder but is no longer listed, indexed or exported.
+type batchOp struct {
+	Op     string   `json:"op"`
+	File   string   `json:"file"`
+	To     string   `json:"to,omitempty"`
+	Add    []string `json:"add,omitempty"`
+	Remove []string `json:"remove,omitempty"`
+}
+
+type batchResult struct {
+	Index  int    `json:"index"`
+	Op     string `json:"op"`
+	File   string `json:"file"`
+	OK     bool   `json:"ok"`
+	Result string `json:"result,omitempty"` // new path for rename/move, tags for tag
+	Error  string `json:"error,omitempty"`
+}
+
+type batchResponse struct {
+	Applied bool          `json:"applied"`
+	Results []batchResult `json:"results"`
+}
+
+// handleBatch applies a list of rename/move/tag operations. Every file is
+// locked for the duration of the batch. In atomic mode a failure rolls back
+// the operations already applied.
+func handleBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req batchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Ops) == 0 {
+		http.Error(w, "no operations", http.StatusBadRequest)
+		return
+	}
+	atomic := req.Atomic == nil || *req.Atomic
+	resp := runBatch(req.Ops, atomic)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func runBatch(ops []batchOp, atomic bool) batchResponse {
+	results := make([]batchResult, len(ops))
+	valid := make([]bool, len(ops))
+	anyInvalid := false
+	seen := map[string]bool{}    // files touched by the batch
+	targets := map[string]bool{} // rename/move destinations
+	for i, op := range ops {
+		results[i] = batchResult{Index: i, Op: op.Op, File: op.File}
+		err := validateBatchOp(op, seen, targets)
+		if err == nil {
+			// Lock now so no editor can change the file mid-batch
+			tok, ok := acquireLock(op.File)
+			if !ok {
+				err = fmt.Errorf("file is locked by another editor")
+			} else {
+				defer releaseLock(op.File, tok)
+			}
+		}
+		if err != nil {
+			results[i].Error = err.Error()
+			anyInvalid = true
+			continue
+		}
+		valid[i] = true
+	}
+	if atomic && anyInvalid {
+		for i := range results {
+			if results[i].Error == "" {
+				results[i].Error = "not applied"
+			}
+		}
+		return batchResponse{Results: results}
+	}
+
+	var undos []func()
+	var commits []func()
+	for i, op := range ops {
+		if !valid[i] {
+			continue
+		}
+		result, undo, commit, err := applyBatchOp(op)
+		if err != nil {
+			results[i].Error = err.Error()
+			if atomic {
+				for j := len(undos) - 1; j >= 0; j-- {
+					undos[j]()
+				}
+				for k := range results {
+					results[k].OK = false
+					results[k].Result = ""
+					if results[k].Error == "" {
+						results[k].Error = "rolled back"
+					}
+				}
+				return batchResponse{Results: results}
+			}
+			continue
+		}
+		results[i].OK = true
+		results[i].Result = result
+		undos = append(undos, undo)
+		commits = append(commits, commit)
+	}
+	// Side effects that cannot be rolled back (exports, undo history) run
+	// once the batch has succeeded.
+	for _, c := range commits {
+		c()
+	}
+	return batchResponse{Applied: true, Results: results}
+}
+
+func validateBatchOp(op batchOp, seen, targets map[string]bool) error {
+	if op.File == "" || filepath.Base(op.File) != op.File || !strings.EqualFold(filepath.Ext(op.File), ".md") {
+		return fmt.Errorf("invalid filename %q", op.File)
+	}
+	if seen[op.File] {
+		return fmt.Errorf("file appears in more than one operation")
+	}
+	if _, err := os.Stat(wsPath(op.File)); err != nil {
+		return fmt.Errorf("file not found")
+	}
+	seen[op.File] = true
+	switch op.Op {
+	case "rename":
+		if op.To == "" || filepath.Base(op.To) != op.To || !strings.EqualFold(filepath.Ext(op.To), ".md") {
+			return fmt.Errorf("invalid target %q", op.To)
+		}
+		return claimTarget(op.To, targets)
+	case "move":
+		dir := filepath.Clean(op.To)
+		if op.To == "" || dir == "." || filepath.IsAbs(dir) || dir == ".." || strings.HasPrefix(dir, ".."+string(filepath.Separator)) || strings.HasPrefix(dir, ".") || reservedPath(dir) {
+			return fmt.Errorf("invalid folder %q", op.To)
+		}
+		return claimTarget(filepath.Join(dir, op.File), targets)
+	case "tag":
+		if len(op.Add) == 0 && len(op.Remove) == 0 {
+			return fmt.Errorf("tag needs add or remove")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown op %q", op.Op)
+}
+
+// claimTarget ensures path is free on disk and not claimed by an earlier
+// operation in the same batch.
+func claimTarget(path string, targets map[string]bool) error {
+	if targets[path] {
+		return fmt.Errorf("target %q used by more than one operation", path)
+	}
+	if _, err := os.Stat(wsPath(path)); err == nil {
+		return fmt.Errorf("target %q already exists", path)
+	}
+	targets[path] = true
+	return nil
+}
+
+// applyBatchOp performs op. It returns a description of the result, a func
+// that reverts it, and a func that runs follow-up side effects once the whole
+// batch is committed.
+func applyBatchOp(op batchOp) (string, func(), func(), error) {
+	switch op.Op {
+	case "rename", "move":
+		to := op.To
+		if op.Op == "move" {
+			to = filepath.Join(filepath.Clean(op.To), op.File)
+			if err := os.MkdirAll(wsPath(filepath.Dir(to)), 0755); err != nil {
+				return "", nil, nil, err
+			}
+		}
+		orig, err := os.ReadFile(wsPath(op.File))
+		if err != nil {
+			return "", nil, nil, err
+		}
+		if err := moveNote(op.File, to); err != nil {
+			return "", nil, nil, err
+		}
+		undo := func() { _ = os.Rename(wsPath(to), wsPath(op.File)) }
+		if !isEncryptedNote(orig) && encryptedNote(to) {
+			// A note sealed on the way is put back as it was
+			undo = func() {
+				if err := os.WriteFile(wsPath(op.File), orig, 0644); err == nil {
+					_ = os.Remove(wsPath(to))
+				}
+			}
+		}
+		commit := func() {
+			removeExport(exportDir, htmlOutNameFor(op.File))
+			docIndex.update(".", op.File)
+			if op.Op == "rename" {
+				renameUndo(op.File, to)
+				renameSnapshots(op.File, to)
+				afterSave(to)
+			}
+		}
+		return filepath.ToSlash(to), undo, commit, nil
+	case "tag":
+		prev, err := readNote(op.File)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		fields, _ := parseFrontMatter(prev)
+		tags := retag(frontMatterList(fields["tags"]), op.Add, op.Remove)
+		data := setFrontMatterField(prev, "tags", formatFrontMatterList(tags))
+		if err := writeNote(op.File, data); err != nil {
+			return "", nil, nil, err
+		}
+		undo := func() { _ = writeNote(op.File, prev) }
+		commit := func() {
+			pushUndo(op.File, prev, data)
+			afterSave(op.File)
+		}
+		return strings.Join(tags, ", "), undo, commit, nil
+	}
+	return "", nil, nil, fmt.Errorf("unknown op %q", op.Op)
+}
+
+// retag returns tags with add appended (skipping duplicates) and remove
+// dropped, compared case-insensitively.
+func retag(tags, add, remove []string) []string {
+	var out []string
+	has := func(list []string, t string) bool {
+		for _, x := range list {
+			if strings.EqualFold(x, t) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, t := range append(tags, add...) {
+		if !has(remove, t) && !has(out, t) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func postBatch(t *testing.T, body string) (int, batchResponse) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	handleBatch(rr, httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(body)))
+	var resp batchResponse
+	if rr.Code == http.StatusOK {
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rr.Code, resp
+}
+
+func writeFiles(t *testing.T, files map[string]string) {
+	t.Helper()
+	for name, body := range files {
+		if err := os.WriteFile(name, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestHandleBatch_Applies(t *testing.T) {
+	chdirTemp(t)
+	locks = make(map[string]lockInfo)
+	writeFiles(t, map[string]string{"a.md": "a", "b.md": "b", "c.md": "---\ntags: [old, keep]\n---\nc"})
+	code, resp := postBatch(t, `{"ops":[
+		{"op":"rename","file":"a.md","to":"alpha.md"},
+		{"op":"move","file":"b.md","to":"archive"},
+		{"op":"tag","file":"c.md","add":["new","KEEP"],"remove":["old"]}
+	]}`)
+	if code != http.StatusOK || !resp.Applied {
+		t.Fatalf("batch = %d %+v", code, resp)
+	}
+	if _, err := os.Stat("alpha.md"); err != nil {
+		t.Fatalf("rename missing: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join("archive", "b.md")); err != nil {
+		t.Fatalf("move missing: %v", err)
+	}
+	if b, _ := os.ReadFile("c.md"); string(b) != "---\ntags: [keep, new]\n---\nc" {
+		t.Fatalf("c.md = %q", string(b))
+	}
+	if resp.Results[1].Result != "archive/b.md" || !resp.Results[2].OK {
+		t.Fatalf("results = %+v", resp.Results)
+	}
+	// A moved note is archived out of the flat workspace
+	files, err := listMarkdownFiles(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slices.Contains(files, "b.md") || slices.Contains(files, "archive/b.md") || !slices.Contains(files, "alpha.md") {
+		t.Errorf("files after move = %v", files)
+	}
+	if len(locks) != 0 {
+		t.Fatalf("locks should be released: %v", locks)
+	}
+}
+
+func TestHandleBatch_RenameKeepsSnapshots(t *testing.T) {
+	chdirTemp(t)
+	locks = make(map[string]lockInfo)
+	writeFiles(t, map[string]string{"a.md": "a2"})
+	snapshotNote("a.md", []byte("a1"), []byte("a2"))
+	if _, resp := postBatch(t, `{"ops":[{"op":"rename","file":"a.md","to":"alpha.md"}]}`); !resp.Applied {
+		t.Fatalf("results = %+v", resp.Results)
+	}
+	if snaps := listSnapshots("alpha.md"); len(snaps) != 1 {
+		t.Errorf("snapshots after rename = %+v", snaps)
+	}
+}
+
+func TestHandleBatch_AtomicRejectsInvalid(t *testing.T) {
+	chdirTemp(t)
+	locks = make(map[string]lockInfo)
+	writeFiles(t, map[string]string{"a.md": "a", "b.md": "b", "taken.md": "t"})
+	locks["b.md"] = lockInfo{token: "other", expires: time.Now().Add(time.Hour)}
+	_, resp := postBatch(t, `{"ops":[
+		{"op":"rename","file":"a.md","to":"fresh.md"},
+		{"op":"tag","file":"b.md","add":["x"]},
+		{"op":"rename","file":"missing.md","to":"y.md"}
+	]}`)
+	if resp.Applied {
+		t.Fatalf("atomic batch should not apply")
+	}
+	if resp.Results[0].Error != "not applied" || !strings.Contains(resp.Results[1].Error, "locked") || resp.Results[2].Error == "" {
+		t.Fatalf("results = %+v", resp.Results)
+	}
+	if _, err := os.Stat("a.md"); err != nil {
+		t.Fatalf("a.md should be untouched")
+	}
+
+	// Non-atomic applies the valid operations
+	_, resp = postBatch(t, `{"atomic":false,"ops":[
+		{"op":"rename","file":"a.md","to":"fresh.md"},
+		{"op":"rename","file":"taken.md","to":"fresh.md"}
+	]}`)
+	if !resp.Applied || !resp.Results[0].OK || resp.Results[1].OK {
+		t.Fatalf("results = %+v", resp.Results)
+	}
+	if _, err := os.Stat("fresh.md"); err != nil {
+		t.Fatalf("fresh.md missing")
+	}
+}
+
+func TestHandleBatch_MoveRejectsReservedFolders(t *testing.T) {
+	chdirTemp(t)
+	locks = make(map[string]lockInfo)
+	oldOut := exportDir
+	exportDir = "site"
+	t.Cleanup(func() { exportDir = oldOut })
+	writeFiles(t, map[string]string{"a.md": "a"})
+	for _, dir := range []string{"_includes", "_layouts/sub", "_data", "assets", "site", "site/notes", ".minimark", "../out"} {
+		_, resp := postBatch(t, `{"ops":[{"op":"move","file":"a.md","to":"`+dir+`"}]}`)
+		if resp.Applied || !strings.Contains(resp.Results[0].Error, "invalid folder") {
+			t.Errorf("move to %s: %+v", dir, resp.Results)
+		}
+	}
+	if _, err := os.Stat("a.md"); err != nil {
+		t.Fatalf("a.md moved: %v", err)
+	}
+}
+
+func TestHandleBatch_RollsBack(t *testing.T) {
+	chdirTemp(t)
+	locks = make(map[string]lockInfo)
+	writeFiles(t, map[string]string{"a.md": "a", "b.md": "b"})
+	// A file where the move target directory should be blocks MkdirAll
+	writeFiles(t, map[string]string{"blocked": "x"})
+	_, resp := postBatch(t, `{"ops":[
+		{"op":"rename","file":"a.md","to":"z.md"},
+		{"op":"move","file":"b.md","to":"blocked/sub"}
+	]}`)
+	if resp.Applied || resp.Results[0].Error != "rolled back" || resp.Results[1].Error == "" {
+		t.Fatalf("results = %+v", resp.Results)
+	}
+	if _, err := os.Stat("a.md"); err != nil {
+		t.Fatalf("rename should be rolled back")
+	}
+}
+
+func TestHandleBatch_RenameSeals(t *testing.T) {
+	chdirTemp(t)
+	locks = make(map[string]lockInfo)
+	withNoteSecret(t, "s3cret")
+	withConfig(t, siteConfig{Encrypt: []string{"diary*.md"}})
+	writeFiles(t, map[string]string{"a.md": "Dear diary", "b.md": "b", "blocked": "x"})
+	if _, resp := postBatch(t, `{"ops":[{"op":"rename","file":"a.md","to":"diary.md"}]}`); !resp.Applied {
+		t.Fatalf("results = %+v", resp.Results)
+	}
+	if b, _ := os.ReadFile("diary.md"); !isEncryptedNote(b) {
+		t.Fatalf("stored in the clear: %q", b)
+	}
+	if b, err := readNote("diary.md"); err != nil || string(b) != "Dear diary" {
+		t.Fatalf("readNote = %q, %v", b, err)
+	}
+
+	// Rolling back puts the plaintext note back
+	_, resp := postBatch(t, `{"ops":[
+		{"op":"rename","file":"b.md","to":"diary2.md"},
+		{"op":"move","file":"diary.md","to":"blocked/sub"}
+	]}`)
+	if resp.Applied {
+		t.Fatalf("results = %+v", resp.Results)
+	}
+	if b, _ := os.ReadFile("b.md"); string(b) != "b" {
+		t.Fatalf("b.md = %q", b)
+	}
+	if _, err := os.Stat("diary2.md"); !os.IsNotExist(err) {
+		t.Fatal("sealed copy left behind")
+	}
+}
+
+func TestHandleBatch_BadRequests(t *testing.T) {
+	chdirTemp(t)
+	rr := httptest.NewRecorder()
+	handleBatch(rr, httptest.NewRequest(http.MethodGet, "/batch", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("got %d", rr.Code)
+	}
+	for _, body := range []string{`{`, `{"ops":[]}`} {
+		if code, _ := postBatch(t, body); code != http.StatusBadRequest {
+			t.Errorf("%s = %d", body, code)
+		}
+	}
+	writeFiles(t, map[string]string{"a.md": "a"})
+	for _, op := range []string{
+		`{"op":"explode","file":"a.md"}`,
+		`{"op":"rename","file":"a.md","to":"../x.md"}`,
+		`{"op":"move","file":"a.md","to":"../out"}`,
+		`{"op":"move","file":"a.md","to":".hidden"}`,
+		`{"op":"tag","file":"a.md"}`,
+	} {
+		_, resp := postBatch(t, `{"ops":[`+op+`]}`)
+		if resp.Applied || resp.Results[0].Error == "" {
+			t.Errorf("%s should be rejected: %+v", op, resp.Results)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// benchResult is what `minimark bench` measures; durations are in
+// milliseconds in the JSON output.
+type benchResult struct {
+	Files        int                      `json:"files"`
+	Bytes        int64                    `json:"bytes"`
+	IndexLoad    benchDuration            `json:"index_load_ms"`
+	IndexRefresh benchDuration            `json:"index_refresh_ms"`
+	List         map[string]benchDuration `json:"list_ms"`   // by sort
+	Search       map[string]benchLatency  `json:"search_ms"` // by query
+	Export       *benchExport             `json:"export,omitempty"`
+}
+
+// benchLatency summarizes repeated runs of one operation.
+type benchLatency struct {
+	Median benchDuration `json:"median"`
+	P95    benchDuration `json:"p95"`
+}
+
+type benchExport struct {
+	Duration    benchDuration `json:"ms"`
+	FilesPerSec float64       `json:"files_per_sec"`
+	MBPerSec    float64       `json:"mb_per_sec"`
+}
+
+// benchDuration marshals as fractional milliseconds.
+type benchDuration time.Duration
+
+func (d benchDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(float64(d) / float64(time.Millisecond))
+}
+
+func (d benchDuration) String() string { return time.Duration(d).Round(10 * time.Microsecond).String() }
+
+// benchSearches are the workspace-wide searches timed by bench, run the way
+// /replace scans files.
+var benchSearches = []struct {
+	name string
+	req  replaceRequest
+}{
+	{"literal", replaceRequest{Pattern: "lorem"}},
+	{"regex", replaceRequest{Pattern: `\b[A-Z][a-z]+ing\b`, Regex: true}},
+}
+
+// runBench measures index, listing, search and export times on a copy of
+// the workspace, or on a generated one with -generate, so the index and
+// render cache it writes stay out of the user's notes.
+func runBench(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	generate := fs.Int("generate", 0, "benchmark a generated workspace of this many notes instead of the current one")
+	seed := fs.Int64("seed", 1, "random seed for -generate")
+	runs := fs.Int("runs", 10, "repetitions of each listing and search")
+	noExport := fs.Bool("no-export", false, "skip the export benchmark")
+	asJSON := fs.Bool("json", false, "print the results as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 || *runs < 1 || *generate < 0 {
+		return fmt.Errorf("usage: minimark bench [-generate n] [-seed n] [-runs n] [-no-export] [-json]")
+	}
+	dir, err := os.MkdirTemp("", "minimark-bench-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	if *generate > 0 {
+		err = generateVault(dir, *generate, *seed)
+	} else {
+		err = copyBenchWorkspace(dir)
+	}
+	if err != nil {
+		return err
+	}
+	root := workspaceRoot
+	workspaceRoot = dir
+	defer func() { workspaceRoot = root }()
+	cmark := ""
+	if !*noExport {
+		cmark = findConverter()
+	}
+	res, err := bench(cmark, *runs)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	}
+	printBench(stdout, res)
+	return nil
+}
+
+// bench measures the workspace in the current directory. Export is skipped
+// when cmark is "".
+func bench(cmark string, runs int) (benchResult, error) {
+	var res benchResult
+	files, err := listMarkdownFiles(".")
+	if err != nil {
+		return res, err
+	}
+	res.Files = len(files)
+	for _, name := range files {
+		if info, err := os.Stat(wsPath(name)); err == nil {
+			res.Bytes += info.Size()
+		}
+	}
+
+	// A fresh index reads the persisted one, if any, then every changed file
+	idx := &metaIndex{}
+	start := time.Now()
+	if _, err := idx.refresh("."); err != nil {
+		return res, err
+	}
+	res.IndexLoad = benchDuration(time.Since(start))
+	start = time.Now()
+	if _, err := idx.refresh("."); err != nil {
+		return res, err
+	}
+	res.IndexRefresh = benchDuration(time.Since(start))
+
+	res.List = map[string]benchDuration{}
+	for _, s := range []string{"alpha", "recent"} {
+		lat, err := timeRuns(runs, func() error {
+			_, err := queryMarkdownFiles(".", listQuery{sort: s})
+			return err
+		})
+		if err != nil {
+			return res, err
+		}
+		res.List[s] = lat.Median
+	}
+
+	res.Search = map[string]benchLatency{}
+	for _, s := range benchSearches {
+		replace, err := newReplacer(s.req)
+		if err != nil {
+			return res, err
+		}
+		lat, err := timeRuns(runs, func() error {
+			for _, name := range files {
+				b, err := os.ReadFile(wsPath(name))
+				if err != nil {
+					return err
+				}
+				replace(string(b))
+			}
+			return nil
+		})
+		if err != nil {
+			return res, err
+		}
+		res.Search[s.name] = lat
+	}
+
+	if cmark == "" {
+		return res, nil
+	}
+	out, err := os.MkdirTemp("", "minimark-bench-docs-")
+	if err != nil {
+		return res, err
+	}
+	defer os.RemoveAll(out)
+	start = time.Now()
+	for _, name := range files {
+		if err := exportMarkdownTo(cmark, name, filepath.Join(out, htmlOutNameFor(name))); err != nil {
+			return res, fmt.Errorf("export %s: %w", name, err)
+		}
+	}
+	d := time.Since(start)
+	res.Export = &benchExport{
+		Duration:    benchDuration(d),
+		FilesPerSec: float64(len(files)) / d.Seconds(),
+		MBPerSec:    float64(res.Bytes) / (1 << 20) / d.Seconds(),
+	}
+	return res, nil
+}
+
+// copyBenchWorkspace copies what bench reads from the workspace to dir: the
+// notes, the ignore file, the persisted index, and the folders pages are
+// laid out with.
+func copyBenchWorkspace(dir string) error {
+	files, err := listMarkdownFiles(".")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(indexPath)), 0755); err != nil {
+		return err
+	}
+	for _, name := range append(files, ignoreFileName, indexPath) {
+		if err := copyFile(name, filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	// Without _includes pages get the bundled theme, so only folders that
+	// exist are created
+	for _, d := range []string{"_includes", layoutsDir, dataDir} {
+		if info, err := os.Stat(wsPath(d)); err != nil || !info.IsDir() {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Join(dir, d), 0755); err != nil {
+			return err
+		}
+		if err := copyTree(d, filepath.Join(dir, d)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// timeRuns runs f n times and summarizes how long it took.
+func timeRuns(n int, f func() error) (benchLatency, error) {
+	times := make([]time.Duration, n)
+	for i := range times {
+		start := time.Now()
+		if err := f(); err != nil {
+			return benchLatency{}, err
+		}
+		times[i] = time.Since(start)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	return benchLatency{
+		Median: benchDuration(times[len(times)/2]),
+		P95:    benchDuration(times[(len(times)*95+99)/100-1]),
+	}, nil
+}
+
+func printBench(w io.Writer, res benchResult) {
+	fmt.Fprintf(w, "files            %d (%.1f MB)\n", res.Files, float64(res.Bytes)/(1<<20))
+	fmt.Fprintf(w, "index load       %s\n", res.IndexLoad)
+	fmt.Fprintf(w, "index refresh    %s\n", res.IndexRefresh)
+	for _, s := range []string{"alpha", "recent"} {
+		fmt.Fprintf(w, "list %-11s %s\n", s, res.List[s])
+	}
+	for _, s := range benchSearches {
+		lat := res.Search[s.name]
+		fmt.Fprintf(w, "search %-9s median %s, p95 %s\n", s.name, lat.Median, lat.P95)
+	}
+	if res.Export != nil {
+		fmt.Fprintf(w, "export           %s (%.0f files/s, %.2f MB/s)\n", res.Export.Duration, res.Export.FilesPerSec, res.Export.MBPerSec)
+	}
+}
+
+// benchWords is the vocabulary of generated notes.
+var benchWords = strings.Fields(`lorem ipsum dolor sit amet consectetur adipiscing elit sed do
+eiusmod tempor incididunt ut labore et dolore magna aliqua markdown notes editing
+Writing Reading Testing server export index search link tag draft review`)
+
+// generateVault writes n synthetic notes to dir: headings, paragraphs,
+// lists, code, tags and links between notes.
+func generateVault(dir string, n int, seed int64) error {
+	rnd := rand.New(rand.NewSource(seed))
+	words := func(k int) string {
+		w := make([]string, k)
+		for i := range w {
+			w[i] = benchWords[rnd.Intn(len(benchWords))]
+		}
+		return strings.Join(w, " ")
+	}
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		var b strings.Builder
+		fmt.Fprintf(&b, "---\ntags: [%s, %s]\ndate: %s\n---\n", benchWords[rnd.Intn(len(benchWords))], benchWords[rnd.Intn(len(benchWords))], start.AddDate(0, 0, i%1500).Format("2006-01-02"))
+		fmt.Fprintf(&b, "# Note %d %s\n\n", i, words(3))
+		for s := 0; s < 3+rnd.Intn(5); s++ {
+			fmt.Fprintf(&b, "## %s\n\n%s.\n\n", words(2), words(60+rnd.Intn(120)))
+			fmt.Fprintf(&b, "- %s\n- see [note %d](note-%d.md)\n\n", words(8), rnd.Intn(n), rnd.Intn(n))
+			if rnd.Intn(3) == 0 {
+				fmt.Fprintf(&b, "```go\nfunc f%d() string { return %q }\n```\n\n", s, words(4))
+			}
+		}
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("note-%d.md", i)), []byte(b.String()), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBench(t *testing.T) {
+	dir := chdirTemp(t)
+	if err := generateVault(dir, 20, 1); err != nil {
+		t.Fatal(err)
+	}
+	res, err := bench(echoCmark(t), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Files != 20 || res.Bytes == 0 || res.Export == nil || res.Export.FilesPerSec <= 0 || len(res.Search) != len(benchSearches) {
+		t.Fatalf("res = %+v", res)
+	}
+	var out bytes.Buffer
+	printBench(&out, res)
+	if !strings.Contains(out.String(), "files            20 (") || !strings.Contains(out.String(), "search regex") {
+		t.Fatalf("report = %s", out.String())
+	}
+}
+
+func TestRunBench_LeavesWorkspaceAlone(t *testing.T) {
+	dir := chdirTemp(t)
+	if err := generateVault(dir, 5, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir("_includes", 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, map[string]string{filepath.Join("_includes", "header.html"): "<body>\n"})
+	var out bytes.Buffer
+	if err := runBench([]string{"-runs", "1", "-json"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `"files": 5`) {
+		t.Fatalf("res = %s", out.String())
+	}
+	for _, p := range []string{".minimark", exportDir} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("bench wrote %s: %v", p, err)
+		}
+	}
+}
+
+func TestRunBench_GenerateJSON(t *testing.T) {
+	dir := chdirTemp(t)
+	var out bytes.Buffer
+	if err := runBench([]string{"-generate", "5", "-runs", "2", "-no-export", "-json"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	var res map[string]any
+	if err := json.Unmarshal(out.Bytes(), &res); err != nil {
+		t.Fatalf("%v: %s", err, out.String())
+	}
+	if res["files"] != float64(5) || res["export"] != nil {
+		t.Fatalf("res = %v", res)
+	}
+	// The generated workspace is temporary and the working directory restored
+	if wd, _ := os.Getwd(); wd != dir {
+		t.Fatalf("cwd = %s", wd)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("workspace touched: %v", entries)
+	}
+	if err := runBench([]string{"extra"}, &out); err == nil {
+		t.Fatal("expected usage error")
+	}
+}
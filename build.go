@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// manifestPath records the source hash of every exported Markdown file so
+// later builds can skip files that have not changed.
+var manifestPath = filepath.Join(".minimark", "manifest.json")
+
+type buildManifest struct {
+	Files map[string]string `json:"files"` // markdown basename -> sha256 of source
+	// Templates is the templatesHash of the build; every page is rendered
+	// with them.
+	Templates string `json:"templates,omitempty"`
+	// Related holds the names in each page's related list, so pages whose
+	// list changed, or names a changed note, are exported again.
+	Related map[string][]string `json:"related,omitempty"`
+}
+
+// runBuild exports the whole workspace into docs. With -changed it only
+// exports files whose content differs from the manifest or that git reports
+// as modified, with their translations, series members and the pages whose
+// related list they appear in, and removes the exports of files that no
+// longer exist. A change to _includes or _layouts exports everything. Link
+// cards show the linked page as fetched, not the note, so pages with a
+// card for a changed note keep it until the cached preview is refetched.
+func runBuild(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("build", flag.ContinueOnError)
+	changed := fs.Bool("changed", false, "export only files changed since the last build")
+	check := fs.Bool("check", false, "validate the exported HTML and fail on problems")
+	a11y := fs.Bool("a11y", false, "report accessibility problems in the exported HTML")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("usage: minimark build [-changed] [-check] [-a11y]")
+	}
+	cmarkPath = findConverter()
+
+	files, err := listMarkdownFiles(".")
+	if err != nil {
+		return err
+	}
+	hashes := make(map[string]string, len(files))
+	for _, name := range files {
+		h, err := hashFile(name)
+		if err != nil {
+			return err
+		}
+		hashes[name] = h
+	}
+	templates, err := templatesHash()
+	if err != nil {
+		return err
+	}
+	manifest := buildManifest{Files: hashes, Templates: templates}
+	if manifest.Related, err = relatedLists(); err != nil {
+		return err
+	}
+	var prev buildManifest
+	if *changed {
+		if prev, err = loadManifest(manifestPath); err != nil {
+			return err
+		}
+	}
+
+	if !*changed || prev.Templates != templates {
+		if err := cleanAndExportAll(exportDir); err != nil {
+			return err
+		}
+		if err := copyIncludesToDocs("_includes", exportDir); err != nil {
+			return err
+		}
+		if err := copyConfigAssets(exportDir); err != nil {
+			return err
+		}
+		if err := copyUploads(exportDir); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "exported %d files\n", len(files))
+		if err := saveManifest(manifestPath, manifest); err != nil {
+			return err
+		}
+		return checkBuild(*check, *a11y, stdout)
+	}
+
+	dirty := gitChangedFiles()
+	var exported []string
+	for _, name := range files {
+		if prev.Files[name] == hashes[name] && !dirty[name] {
+			continue
+		}
+		outPath := filepath.Join(exportDir, htmlOutNameFor(name))
+		if err := exportMarkdownTo(cmarkPath, name, outPath); err != nil {
+			return fmt.Errorf("export %s: %w", name, err)
+		}
+		if err := publishUploads(name, exportDir); err != nil {
+			return fmt.Errorf("export %s: %w", name, err)
+		}
+		fmt.Fprintln(stdout, name)
+		exported = append(exported, name)
+	}
+	// Pages that link to the changed ones in their navigation
+	for _, name := range exported {
+		exportTranslations(cmarkPath, name)
+		exportSeriesMembers(cmarkPath, name)
+	}
+	stale := map[string]bool{}
+	for _, name := range exported {
+		stale[name] = true
+	}
+	// Drop exports of files removed since the last build.
+	for name := range prev.Files {
+		if _, ok := hashes[name]; !ok {
+			removeExport(exportDir, htmlOutNameFor(name))
+			fmt.Fprintf(stdout, "removed %s\n", name)
+			stale[name] = true
+		}
+	}
+	// Pages whose related list changed or names a changed page
+	for _, name := range files {
+		if stale[name] || !relatedStale(prev.Related[name], manifest.Related[name], stale) {
+			continue
+		}
+		if err := exportMarkdownTo(cmarkPath, name, filepath.Join(exportDir, htmlOutNameFor(name))); err != nil {
+			return fmt.Errorf("export %s: %w", name, err)
+		}
+	}
+	writeSitePages(cmarkPath, exportDir)
+	fmt.Fprintf(stdout, "exported %d of %d files\n", len(exported), len(files))
+	if err := saveManifest(manifestPath, manifest); err != nil {
+		return err
+	}
+	return checkBuild(*check, *a11y, stdout)
+}
+
+// checkBuild runs the checks the build asked for on docs. Accessibility
+// problems are reported; HTML problems also fail the build.
+func checkBuild(check, a11y bool, stdout io.Writer) error {
+	if a11y {
+		n, err := a11yReport(exportDir, stdout)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "%d accessibility problems\n", n)
+	}
+	if !check {
+		return nil
+	}
+	n, err := checkExports(exportDir, stdout)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return fmt.Errorf("%d HTML problems found", n)
+	}
+	return nil
+}
+
+// relatedStale reports whether a page's related list must be rendered
+// again: it differs from the last build's, or lists a changed page.
+func relatedStale(prev, cur []string, changed map[string]bool) bool {
+	if !slices.Equal(prev, cur) {
+		return true
+	}
+	for _, name := range cur {
+		if changed[name] {
+			return true
+		}
+	}
+	return false
+}
+
+func hashFile(name string) (string, error) {
+	b, err := os.ReadFile(wsPath(name))
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// templatesHash hashes the names and contents of the files every page is
+// rendered with: those under _includes, layoutsDir and dataDir, and the
+// configuration. Builds use it to tell when all pages are stale.
+func templatesHash() (string, error) {
+	h := sha256.New()
+	for _, dir := range []string{"_includes", layoutsDir, dataDir, configPath} {
+		err := walkWorkspace(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if path == dir && os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if info, err := os.Stat(wsPath(path)); err != nil || info.IsDir() {
+				return err
+			}
+			b, err := os.ReadFile(wsPath(path))
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "%s %d\n", filepath.ToSlash(path), len(b))
+			h.Write(b)
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// loadManifest reads the build manifest. A missing manifest is empty, so
+// every file counts as changed.
+func loadManifest(path string) (buildManifest, error) {
+	m := buildManifest{Files: map[string]string{}}
+	b, err := os.ReadFile(wsPath(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return m, nil
+		}
+		return m, err
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return m, fmt.Errorf("read %s: %w", path, err)
+	}
+	if m.Files == nil {
+		m.Files = map[string]string{}
+	}
+	return m, nil
+}
+
+func saveManifest(path string, m buildManifest) error {
+	if err := os.MkdirAll(wsPath(filepath.Dir(path)), 0755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(wsPath(path), b, 0644)
+}
+
+// gitChangedFiles returns the top-level files git reports as modified
+// (staged or not) or untracked. Outside a git repository it returns an empty
+// set.
+func gitChangedFiles() map[string]bool {
+	files := map[string]bool{}
+	cmds := [][]string{
+		{"diff", "--name-only", "--relative", "HEAD", "--", "."},
+		{"ls-files", "--others", "--exclude-standard", "--", "."},
+	}
+	for _, args := range cmds {
+		out, err := workspaceCommand("git", args...).Output()
+		if err != nil {
+			continue
+		}
+		sc := bufio.NewScanner(bytes.NewReader(out))
+		for sc.Scan() {
+			path := strings.TrimSpace(sc.Text())
+			if path != "" && filepath.Base(path) == path {
+				files[path] = true
+			}
+		}
+	}
+	return files
+}
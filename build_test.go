@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakeCmarkOnPath installs a fake cmark-gfm as the only program on PATH
+// and prefers it over the built-in renderer.
+func fakeCmarkOnPath(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows")
+	}
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "cmark-gfm"), []byte("#!/bin/sh\nread -r line\nprintf '<p>%s</p>' \"$line\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+	preferCmark = true
+	t.Cleanup(func() { cmarkPath, preferCmark = "", false })
+}
+
+func TestBuild_FullThenChanged(t *testing.T) {
+	chdirTemp(t)
+	fakeCmarkOnPath(t)
+	for name, body := range map[string]string{"a.md": "alpha", "b.md": "beta", "gone.md": "bye"} {
+		if err := os.WriteFile(name, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var out bytes.Buffer
+	if _, err := runSubcommand([]string{"build"}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join("docs", "b.html")); err != nil {
+		t.Fatalf("full build missing export: %v", err)
+	}
+	m, err := loadManifest(manifestPath)
+	if err != nil || len(m.Files) != 3 {
+		t.Fatalf("manifest = %v err=%v", m, err)
+	}
+
+	// Change a.md, remove gone.md; only a.md is re-exported
+	if err := os.WriteFile("a.md", []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove("gone.md"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join("docs", "b.html"), []byte("untouched"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if _, err := runSubcommand([]string{"build", "-changed"}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(filepath.Join("docs", "a.html")); string(b) != "<p>changed</p>" {
+		t.Fatalf("a.html = %q", string(b))
+	}
+	if b, _ := os.ReadFile(filepath.Join("docs", "b.html")); string(b) != "untouched" {
+		t.Fatalf("b.html should be skipped, got %q", string(b))
+	}
+	if _, err := os.Stat(filepath.Join("docs", "gone.html")); !os.IsNotExist(err) {
+		t.Fatalf("gone.html should be removed")
+	}
+	if !strings.Contains(out.String(), "exported 1 of 2 files") {
+		t.Fatalf("output = %q", out.String())
+	}
+}
+
+func TestBuild_ChangedTemplates(t *testing.T) {
+	chdirTemp(t)
+	fakeCmarkOnPath(t)
+	writeFiles(t, map[string]string{"a.md": "alpha", "b.md": "beta"})
+	var out bytes.Buffer
+	if _, err := runSubcommand([]string{"build"}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new footer changes every page, so nothing is skipped
+	if err := os.Mkdir("_includes", 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, map[string]string{filepath.Join("_includes", "footer.html"): "<footer>f</footer>"})
+	if err := os.WriteFile(filepath.Join("docs", "b.html"), []byte("stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if _, err := runSubcommand([]string{"build", "-changed"}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(filepath.Join("docs", "b.html")); !strings.Contains(string(b), "<footer>f</footer>") {
+		t.Fatalf("b.html = %q", b)
+	}
+	if !strings.Contains(out.String(), "exported 2 files") {
+		t.Fatalf("output = %q", out.String())
+	}
+
+	// Unchanged templates skip unchanged files again
+	out.Reset()
+	if _, err := runSubcommand([]string{"build", "-changed"}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "exported 0 of 2 files") {
+		t.Fatalf("output = %q", out.String())
+	}
+}
+
+func TestBuild_ChangedRelated(t *testing.T) {
+	chdirTemp(t)
+	fakeCmarkOnPath(t)
+	if err := os.Mkdir("_includes", 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, map[string]string{
+		filepath.Join("_includes", "footer.html"): "{{related}}",
+		"a.md": "---\ntitle: Alpha\ntags: [x]\n---\na",
+		"b.md": "---\ntitle: Beta\ntags: [x]\n---\nb",
+		"c.md": "---\ntitle: Gamma\ntags: [y]\n---\nc",
+	})
+	build := func() {
+		t.Helper()
+		for _, name := range []string{"b.html", "c.html"} {
+			if err := os.WriteFile(filepath.Join("docs", name), []byte("stale"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := runSubcommand([]string{"build", "-changed"}, nil, &bytes.Buffer{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := runSubcommand([]string{"build"}, nil, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// b lists a, so a new title for a is exported to b as well
+	writeFiles(t, map[string]string{"a.md": "---\ntitle: Apple\ntags: [x]\n---\na"})
+	build()
+	if b, _ := os.ReadFile(filepath.Join("docs", "b.html")); !strings.Contains(string(b), "Apple") {
+		t.Errorf("b.html = %q", b)
+	}
+	if b, _ := os.ReadFile(filepath.Join("docs", "c.html")); string(b) != "stale" {
+		t.Errorf("unrelated c.html exported: %q", b)
+	}
+
+	// Once a shares nothing with b, b drops it
+	writeFiles(t, map[string]string{"a.md": "---\ntitle: Apple\ntags: [z]\n---\na"})
+	build()
+	if b, _ := os.ReadFile(filepath.Join("docs", "b.html")); string(b) == "stale" || strings.Contains(string(b), "Apple") {
+		t.Errorf("b.html = %q", b)
+	}
+}
+
+func TestTemplatesHash(t *testing.T) {
+	chdirTemp(t)
+	empty, err := templatesHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.MkdirAll(filepath.Join(layoutsDir, "partials"), 0755)
+	writeFiles(t, map[string]string{filepath.Join(layoutsDir, "partials", "nav.html"): "<nav>"})
+	withLayout, _ := templatesHash()
+	writeFiles(t, map[string]string{filepath.Join(layoutsDir, "partials", "nav.html"): "<nav >"})
+	edited, _ := templatesHash()
+	if empty == withLayout || withLayout == edited {
+		t.Errorf("hashes did not change: %s %s %s", empty, withLayout, edited)
+	}
+	writeFiles(t, map[string]string{configPath: `{"name": "Site"}`})
+	if configured, _ := templatesHash(); configured == edited {
+		t.Error("hash ignores the configuration")
+	}
+}
+
+func TestBuild_ChangedData(t *testing.T) {
+	chdirTemp(t)
+	fakeCmarkOnPath(t)
+	os.Mkdir(dataDir, 0755)
+	writeFiles(t, map[string]string{"a.md": "alpha", "b.md": "beta", filepath.Join(dataDir, "team.yml"): "lead: Ann\n"})
+	var out bytes.Buffer
+	if _, err := runSubcommand([]string{"build"}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	// Any page may show the data, so a data edit rebuilds everything
+	writeFiles(t, map[string]string{filepath.Join(dataDir, "team.yml"): "lead: Bob\n"})
+	out.Reset()
+	if _, err := runSubcommand([]string{"build", "-changed"}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "exported 2 files") {
+		t.Errorf("data change did not rebuild all: %q", out.String())
+	}
+	out.Reset()
+	if _, err := runSubcommand([]string{"build", "-changed"}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "exported 0 of 2 files") {
+		t.Errorf("unchanged build = %q", out.String())
+	}
+}
+
+func TestBuild_Uploads(t *testing.T) {
+	chdirTemp(t)
+	fakeCmarkOnPath(t)
+	os.Mkdir(uploadsDir, 0755)
+	writeFiles(t, map[string]string{
+		"a.md":         "![](assets/a.png)",
+		"b.md":         "---\nprivate: true\n---\n![](assets/b.png)",
+		"assets/a.png": "a",
+		"assets/b.png": "b",
+	})
+	var out bytes.Buffer
+	if _, err := runSubcommand([]string{"build"}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join("docs", uploadsDir, "a.png")); err != nil {
+		t.Errorf("linked upload not exported: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join("docs", uploadsDir, "b.png")); !os.IsNotExist(err) {
+		t.Errorf("upload of a private note exported: %v", err)
+	}
+
+	// A changed note publishes the uploads it links
+	writeFiles(t, map[string]string{"a.md": "![](assets/b.png)"})
+	if _, err := runSubcommand([]string{"build", "-changed"}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join("docs", uploadsDir, "b.png")); err != nil {
+		t.Errorf("newly linked upload not exported: %v", err)
+	}
+}
+
+func TestBuild_Errors(t *testing.T) {
+	chdirTemp(t)
+	var out bytes.Buffer
+	if _, err := runSubcommand([]string{"build", "extra"}, nil, &out); err == nil {
+		t.Fatalf("expected usage error")
+	}
+}
+
+func TestLoadManifest_MissingAndCorrupt(t *testing.T) {
+	chdirTemp(t)
+	m, err := loadManifest("missing.json")
+	if err != nil || m.Files == nil || len(m.Files) != 0 {
+		t.Fatalf("unexpected: %v %v", m, err)
+	}
+	if err := os.WriteFile("bad.json", []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadManifest("bad.json"); err == nil {
+		t.Fatalf("expected parse error")
+	}
+}
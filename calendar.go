@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// calendarDefaultSpan is the range /calendar covers without from=.
+const calendarDefaultSpan = 365 * 24 * time.Hour
+
+type calendarNote struct {
+	File  string `json:"file"`
+	Title string `json:"title"`
+}
+
+type calendarDay struct {
+	Date  string         `json:"date"`
+	Count int            `json:"count"`
+	Notes []calendarNote `json:"notes"`
+}
+
+type calendarRange struct {
+	From string        `json:"from"`
+	To   string        `json:"to"`
+	Days []calendarDay `json:"days"`
+}
+
+// noteDay is the day a note belongs to on the calendar: its front matter
+// date, else the day it was last modified.
+func noteDay(d docMeta) string {
+	if !d.Date.IsZero() {
+		return d.Date.Format("2006-01-02")
+	}
+	return d.ModTime.Local().Format("2006-01-02")
+}
+
+// handleCalendar buckets notes by day for a heatmap or calendar:
+//
+//	GET /calendar?from=2024-01-01&to=2024-12-31
+//
+// Both bounds are inclusive dates; to defaults to today and from to a year
+// before to. Only days with notes are listed, in order.
+func handleCalendar(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	to := time.Now()
+	if v := q.Get("to"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			http.Error(w, "to must be a date like 2024-12-31", http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+	from := to.Add(-calendarDefaultSpan)
+	if v := q.Get("from"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			http.Error(w, "from must be a date like 2024-01-01", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	first, last := from.Format("2006-01-02"), to.Format("2006-01-02")
+	if first > last {
+		http.Error(w, "from is after to", http.StatusBadRequest)
+		return
+	}
+	docs, err := docIndex.refresh(".")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	byDay := map[string]*calendarDay{}
+	for _, d := range docs {
+		day := noteDay(d)
+		if day < first || day > last {
+			continue
+		}
+		b := byDay[day]
+		if b == nil {
+			b = &calendarDay{Date: day}
+			byDay[day] = b
+		}
+		b.Notes = append(b.Notes, calendarNote{File: d.Name, Title: docTitle(d)})
+		b.Count++
+	}
+	out := calendarRange{From: first, To: last, Days: []calendarDay{}}
+	for _, b := range byDay {
+		sort.Slice(b.Notes, func(i, j int) bool { return b.Notes[i].File < b.Notes[j].File })
+		out.Days = append(out.Days, *b)
+	}
+	sort.Slice(out.Days, func(i, j int) bool { return out.Days[i].Date < out.Days[j].Date })
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(out)
+}
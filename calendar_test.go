@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestHandleCalendar(t *testing.T) {
+	chdirTemp(t)
+	writeFiles(t, map[string]string{
+		"standup.md": "---\ndate: 2024-03-04\n---\n# Standup\n",
+		"retro.md":   "---\ndate: 2024-03-04 16:00\ntitle: Retro\n---\n",
+		"journal.md": "---\ndate: 2024-03-10\n---\nDear diary\n",
+		"undated.md": "# Undated\n",
+		"later.md":   "---\ndate: 2025-01-01\n---\n",
+	})
+	mtime := time.Date(2024, 3, 7, 12, 0, 0, 0, time.Local)
+	if err := os.Chtimes("undated.md", mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	get := func(query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handleCalendar(rr, httptest.NewRequest(http.MethodGet, "/calendar?"+query, nil))
+		return rr
+	}
+	rr := get("from=2024-03-01&to=2024-03-31")
+	var cal calendarRange
+	if err := json.Unmarshal(rr.Body.Bytes(), &cal); err != nil {
+		t.Fatalf("%v: %s", err, rr.Body.String())
+	}
+	if len(cal.Days) != 3 {
+		t.Fatalf("days = %+v", cal.Days)
+	}
+	if d := cal.Days[0]; d.Date != "2024-03-04" || d.Count != 2 || d.Notes[0].Title != "Retro" || d.Notes[1].Title != "Standup" {
+		t.Errorf("first day = %+v", d)
+	}
+	if d := cal.Days[1]; d.Date != "2024-03-07" || d.Notes[0].File != "undated.md" {
+		t.Errorf("mtime day = %+v", d)
+	}
+	if d := cal.Days[2]; d.Date != "2024-03-10" || d.Notes[0].Title != "journal" {
+		t.Errorf("last day = %+v", d)
+	}
+	for _, bad := range []string{"from=yesterday", "to=2024-13-01", "from=2024-04-01&to=2024-03-01"} {
+		if rr := get(bad); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: %d", bad, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// categoryDir is where the category listing pages go inside docs.
+const categoryDir = "category"
+
+// breadcrumbsHook expands to the trail from the home page through the
+// page's category to the page itself.
+const breadcrumbsHook = "{{breadcrumbs}}"
+
+// normalizeCategory cleans a front matter category such as
+// "Guides / Networking/" into "Guides/Networking".
+func normalizeCategory(s string) string {
+	var parts []string
+	for _, p := range strings.Split(unquote(strings.TrimSpace(s)), "/") {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// categoryURL returns the listing page of category cat, relative to the
+// docs root.
+func categoryURL(cat string) string {
+	var segs []string
+	for _, p := range strings.Split(cat, "/") {
+		s := strings.Trim(slugify(p), "-")
+		if s == "" {
+			s = url.PathEscape(strings.ToLower(p))
+		}
+		segs = append(segs, s)
+	}
+	return categoryDir + "/" + strings.Join(segs, "/") + "/index.html"
+}
+
+// categoryTrail returns the Markdown links to each level of cat.
+func categoryTrail(cat string) []string {
+	parts := strings.Split(cat, "/")
+	trail := make([]string, len(parts))
+	for i, p := range parts {
+		trail[i] = fmt.Sprintf("[%s](%s)", markdownLinkText(p), categoryURL(strings.Join(parts[:i+1], "/")))
+	}
+	return trail
+}
+
+// breadcrumbs renders the trail for the page md: Home, each level of its
+// category, and its title.
+func breadcrumbs(md []byte) string {
+	fields, _ := parseFrontMatter(md)
+	var b strings.Builder
+	b.WriteString(`<nav class="breadcrumbs" aria-label="Breadcrumb"><a href="index.html">Home</a>`)
+	if cat := normalizeCategory(fields["category"]); cat != "" {
+		parts := strings.Split(cat, "/")
+		for i, p := range parts {
+			fmt.Fprintf(&b, ` › <a href="%s">%s</a>`, html.EscapeString(categoryURL(strings.Join(parts[:i+1], "/"))), html.EscapeString(p))
+		}
+	}
+	fmt.Fprintf(&b, ` › <span aria-current="page">%s</span></nav>`, html.EscapeString(pageTitle(md)))
+	return b.String()
+}
+
+// applyBreadcrumbs expands {{breadcrumbs}} in a page's header and footer.
+func applyBreadcrumbs(name string, md, header, footer []byte) ([]byte, []byte) {
+	hook := []byte(breadcrumbsHook)
+	if !bytes.Contains(header, hook) && !bytes.Contains(footer, hook) {
+		return header, footer
+	}
+	trail := ""
+	if name != "" {
+		trail = breadcrumbs(md)
+	}
+	return bytes.ReplaceAll(header, hook, []byte(trail)), bytes.ReplaceAll(footer, hook, []byte(trail))
+}
+
+// categoryNode is one category and what is filed under it. Categories
+// differing only in case are the same; the first spelling seen is shown.
+type categoryNode struct {
+	path     string // e.g. "Guides/Networking"
+	pages    []docMeta
+	children []*categoryNode
+	total    int // pages here and below
+}
+
+func (n *categoryNode) name() string { return n.path[strings.LastIndex(n.path, "/")+1:] }
+
+// writeCategories exports docs/category/index.html, the tree of all
+// categories, and a listing page for every category with its subcategories
+// and pages. Pages are filed by their front matter category:.
+func writeCategories(cmark, docsDir string) {
+	docs, err := docIndex.refresh(".")
+	if err != nil {
+		log.Printf("category pages not written: %v", err)
+		return
+	}
+	docs = publishedDocs(docs)
+	nodes := map[string]*categoryNode{} // by lowercased path
+	var top []*categoryNode
+	node := func(path string) *categoryNode {
+		key := strings.ToLower(path)
+		n, ok := nodes[key]
+		if !ok {
+			n = &categoryNode{path: path}
+			nodes[key] = n
+			if i := strings.LastIndex(key, "/"); i >= 0 {
+				parent := nodes[key[:i]]
+				n.path = parent.path + path[i:]
+				parent.children = append(parent.children, n)
+			} else {
+				top = append(top, n)
+			}
+		}
+		return n
+	}
+	for _, d := range docs {
+		if d.Category == "" {
+			continue
+		}
+		parts := strings.Split(d.Category, "/")
+		for i := range parts {
+			n := node(strings.Join(parts[:i+1], "/"))
+			n.total++
+			if i == len(parts)-1 {
+				n.pages = append(n.pages, d)
+			}
+		}
+	}
+	root := filepath.Join(docsDir, categoryDir)
+	_ = os.RemoveAll(wsPath(root)) // drop categories that no longer have pages
+	if len(nodes) == 0 {
+		return
+	}
+	byName := func(list []*categoryNode) {
+		sort.Slice(list, func(i, j int) bool { return strings.ToLower(list[i].path) < strings.ToLower(list[j].path) })
+	}
+	for _, n := range nodes {
+		byName(n.children)
+		sort.Slice(n.pages, func(i, j int) bool {
+			return strings.ToLower(docTitle(n.pages[i])) < strings.ToLower(docTitle(n.pages[j]))
+		})
+	}
+	byName(top)
+
+	var index strings.Builder
+	index.WriteString("# Categories\n\n")
+	var tree func(list []*categoryNode, depth int)
+	tree = func(list []*categoryNode, depth int) {
+		for _, n := range list {
+			fmt.Fprintf(&index, "%s- [%s](%s) (%d)\n", strings.Repeat("  ", depth), markdownLinkText(n.name()), categoryURL(n.path), n.total)
+			tree(n.children, depth+1)
+		}
+	}
+	tree(top, 0)
+	page, err := nestedPage(cmark, "../", index.String())
+	writeNestedPage(filepath.Join(root, "index.html"), page, err)
+
+	for _, n := range nodes {
+		var md strings.Builder
+		fmt.Fprintf(&md, "# %s\n\n", n.name())
+		trail := append([]string{fmt.Sprintf("[Categories](%s/index.html)", categoryDir)}, categoryTrail(n.path)...)
+		fmt.Fprintf(&md, "%s\n", strings.Join(trail[:len(trail)-1], " › "))
+		if len(n.children) > 0 {
+			md.WriteString("\n## Subcategories\n\n")
+			for _, c := range n.children {
+				fmt.Fprintf(&md, "- [%s](%s) (%d)\n", markdownLinkText(c.name()), categoryURL(c.path), c.total)
+			}
+		}
+		if len(n.pages) > 0 {
+			md.WriteString("\n## Pages\n\n")
+			for _, d := range n.pages {
+				fmt.Fprintf(&md, "- [%s](%s)\n", markdownLinkText(docTitle(d)), htmlOutNameFor(d.Name))
+			}
+		}
+		out := categoryURL(n.path)
+		page, err := nestedPage(cmark, strings.Repeat("../", strings.Count(out, "/")), md.String())
+		writeNestedPage(filepath.Join(docsDir, filepath.FromSlash(out)), page, err)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeCategory(t *testing.T) {
+	cases := map[string]string{
+		"guides/networking":        "guides/networking",
+		` "Guides / Networking/" `: "Guides/Networking",
+		"/":                        "",
+		"":                         "",
+	}
+	for in, want := range cases {
+		if got := normalizeCategory(in); got != want {
+			t.Errorf("normalizeCategory(%q) = %q; want %q", in, got, want)
+		}
+	}
+	if got := categoryURL("Guides/Networking & DNS"); got != "category/guides/networking-dns/index.html" {
+		t.Fatalf("categoryURL = %q", got)
+	}
+}
+
+func TestBreadcrumbs(t *testing.T) {
+	md := []byte("---\ncategory: Guides/Networking\n---\n# Ports <and> sockets")
+	want := `<nav class="breadcrumbs" aria-label="Breadcrumb"><a href="index.html">Home</a>` +
+		` › <a href="category/guides/index.html">Guides</a> › <a href="category/guides/networking/index.html">Networking</a>` +
+		` › <span aria-current="page">Ports &lt;and&gt; sockets</span></nav>`
+	header, _ := applyBreadcrumbs("ports.md", md, []byte("<body>{{breadcrumbs}}"), nil)
+	if string(header) != "<body>"+want {
+		t.Fatalf("header = %q", header)
+	}
+	if header, _ := applyBreadcrumbs("", md, []byte("{{breadcrumbs}}"), nil); string(header) != "" {
+		t.Fatalf("unnamed page: %q", header)
+	}
+}
+
+func TestWriteCategories(t *testing.T) {
+	chdirTemp(t)
+	docIndex = &metaIndex{}
+	cmark := echoCmark(t)
+	// Spellings differing in case are one category; the first file's wins
+	writeFiles(t, map[string]string{
+		"ports.md": "---\ncategory: guides/networking\n---\n# Ports",
+		"dns.md":   "---\ncategory: Guides/Networking\n---\n# DNS",
+		"start.md": "---\ncategory: Guides\n---\n# Start",
+		"faq.md":   "---\ncategory: Help\n---\n# FAQ",
+		"misc.md":  "# Uncategorized",
+	})
+	if err := os.MkdirAll(filepath.Join("docs", categoryDir, "gone"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeCategories(cmark, "docs")
+
+	read := func(parts ...string) string {
+		b, err := os.ReadFile(filepath.Join(append([]string{"docs", categoryDir}, parts...)...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	wantIndex := "<base href=\"../\">\n# Categories\n\n- [Guides](category/guides/index.html) (3)\n  - [Networking](category/guides/networking/index.html) (2)\n- [Help](category/help/index.html) (1)\n"
+	if got := read("index.html"); got != wantIndex {
+		t.Fatalf("index = %q", got)
+	}
+	wantGuides := "<base href=\"../../\">\n# Guides\n\n[Categories](category/index.html)\n\n## Subcategories\n\n- [Networking](category/guides/networking/index.html) (2)\n\n## Pages\n\n- [Start](start.html)\n"
+	if got := read("guides", "index.html"); got != wantGuides {
+		t.Fatalf("guides = %q", got)
+	}
+	net := read("guides", "networking", "index.html")
+	if !strings.HasPrefix(net, "<base href=\"../../../\">\n# Networking\n\n[Categories](category/index.html) › [Guides](category/guides/index.html)\n") ||
+		!strings.HasSuffix(net, "## Pages\n\n- [DNS](dns.html)\n- [Ports](ports.html)\n") {
+		t.Fatalf("networking = %q", net)
+	}
+	if _, err := os.Stat(filepath.Join("docs", categoryDir, "gone")); !os.IsNotExist(err) {
+		t.Fatalf("stale category kept")
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runSubcommand executes the CLI subcommand named by args[0]. It reports
+// whether the name was recognised, and any error from running it.
+func runSubcommand(args []string, stdin io.Reader, stdout io.Writer) (bool, error) {
+	switch args[0] {
+	case "cat":
+		return true, runCat(args[1:], stdout)
+	case "put":
+		return true, runPut(args[1:], stdin, stdout)
+	case "ls":
+		return true, runLs(args[1:], stdout)
+	case "render":
+		return true, runRender(args[1:], stdin, stdout)
+	case "build":
+		return true, runBuild(args[1:], stdout)
+	case "bench":
+		return true, runBench(args[1:], stdout)
+	}
+	return false, nil
+}
+
+// localSubcommand reports whether the subcommand name renders the
+// workspace itself rather than talking to a running server.
+func localSubcommand(name string) bool {
+	switch name {
+	case "render", "build", "bench":
+		return true
+	}
+	return false
+}
+
+// defaultServer returns the server URL used by client subcommands, taken from
+// MINIMARK_SERVER when set.
+func defaultServer() string {
+	if s := os.Getenv("MINIMARK_SERVER"); s != "" {
+		return s
+	}
+	return "http://localhost:8080"
+}
+
+// clientFlags parses the flags shared by all client subcommands and returns
+// the client and the remaining positional arguments.
+func clientFlags(name string, args []string) (*apiClient, []string, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	server := fs.String("server", defaultServer(), "URL of a running minimark server")
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	return &apiClient{base: strings.TrimRight(*server, "/"), http: http.DefaultClient}, fs.Args(), nil
+}
+
+func runCat(args []string, stdout io.Writer) error {
+	c, rest, err := clientFlags("cat", args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return fmt.Errorf("usage: minimark cat <file.md>")
+	}
+	return c.cat(rest[0], stdout)
+}
+
+func runPut(args []string, stdin io.Reader, stdout io.Writer) error {
+	c, rest, err := clientFlags("put", args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return fmt.Errorf("usage: minimark put <file.md> < input")
+	}
+	saved, err := c.put(rest[0], stdin)
+	if err != nil {
+		return err
+	}
+	// Saving may rename the file from its H1; tell the caller where it went.
+	if saved != rest[0] {
+		fmt.Fprintln(stdout, saved)
+	}
+	return nil
+}
+
+func runLs(args []string, stdout io.Writer) error {
+	c, rest, err := clientFlags("ls", args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return fmt.Errorf("usage: minimark ls")
+	}
+	files, err := c.ls()
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		fmt.Fprintln(stdout, f)
+	}
+	return nil
+}
+
+// runRender is a pure filter: Markdown on stdin, exported HTML on stdout.
+func runRender(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: minimark render < in.md > out.html")
+	}
+	md, err := io.ReadAll(stdin)
+	if err != nil {
+		return err
+	}
+	page, err := renderPage(findConverter(), md)
+	if err != nil {
+		return err
+	}
+	_, err = stdout.Write(page)
+	return err
+}
+
+// --------- HTTP API client ---------
+
+// apiClient speaks to a running minimark server over its HTTP API.
+type apiClient struct {
+	base string
+	http *http.Client
+}
+
+func (c *apiClient) url(path, file string) string {
+	u := c.base + path
+	if file != "" {
+		u += "?file=" + url.QueryEscape(file)
+	}
+	return u
+}
+
+// statusError turns an unexpected response into an error carrying the
+// server's message.
+func statusError(op string, res *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+	return fmt.Errorf("%s: %s: %s", op, res.Status, strings.TrimSpace(string(msg)))
+}
+
+// cat copies the contents of the named file to w.
+func (c *apiClient) cat(name string, w io.Writer) error {
+	res, err := c.http.Get(c.url("/open", name))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return statusError("cat "+name, res)
+	}
+	_, err = io.Copy(w, res.Body)
+	return err
+}
+
+// ls returns the markdown files known to the server.
+func (c *apiClient) ls() ([]string, error) {
+	res, err := c.http.Get(c.url("/files", ""))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, statusError("ls", res)
+	}
+	var files []string
+	if err := json.NewDecoder(res.Body).Decode(&files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// putLockTTL is the lock lifetime put asks for, which the server caps at
+// its -max-lock-ttl.
+const putLockTTL = time.Minute
+
+// put replaces the named file with the contents of r. It acquires the file's
+// lock for the duration of the save, refreshing it while a slow upload
+// runs, and releases it afterwards. It returns the filename the server
+// saved to, which differs from name after a rename.
+func (c *apiClient) put(name string, r io.Reader) (string, error) {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	tok, ttl, err := c.lock(name, "")
+	if err != nil {
+		return "", err
+	}
+	defer c.unlock(name, tok)
+	stop := c.keepLock(name, tok, ttl)
+	defer stop()
+
+	req, err := http.NewRequest(http.MethodPost, c.url("/save", name), bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	req.Header.Set("X-Lock", tok)
+	res, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		return "", statusError("put "+name, res)
+	}
+	if n := res.Header.Get("X-Filename"); n != "" {
+		return n, nil
+	}
+	return name, nil
+}
+
+// lock acquires the lock for name for putLockTTL, or refreshes it when tok
+// is given, and returns its token and the lifetime the server granted.
+func (c *apiClient) lock(name, tok string) (string, time.Duration, error) {
+	req, err := http.NewRequest(http.MethodPost, c.url("/lock", name)+"&ttl="+putLockTTL.String(), nil)
+	if err != nil {
+		return "", 0, err
+	}
+	if tok != "" {
+		req.Header.Set("X-Lock", tok)
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusCreated && res.StatusCode != http.StatusOK {
+		return "", 0, statusError("lock "+name, res)
+	}
+	ttl := putLockTTL
+	if s, err := strconv.ParseFloat(res.Header.Get("X-Lock-TTL"), 64); err == nil && s > 0 {
+		ttl = time.Duration(s * float64(time.Second))
+	}
+	return res.Header.Get("X-Lock"), ttl, nil
+}
+
+// keepLock refreshes the lock tok on name at half its lifetime ttl until
+// the returned function is called. A refresh that fails is not retried:
+// the save then fails on the lost lock.
+func (c *apiClient) keepLock(name, tok string, ttl time.Duration) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		t := time.NewTicker(ttl / 2)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				if _, _, err := c.lock(name, tok); err != nil {
+					return
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// unlock releases the lock for name (best-effort).
+func (c *apiClient) unlock(name, tok string) {
+	req, err := http.NewRequest(http.MethodPost, c.url("/unlock", name), nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("X-Lock", tok)
+	if res, err := c.http.Do(req); err == nil {
+		res.Body.Close()
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startTestServer serves the full API from the current directory.
+func startTestServer(t *testing.T) string {
+	t.Helper()
+	locks = make(map[string]lockInfo)
+	srv := httptest.NewServer(newMux())
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestRunSubcommand_Unknown(t *testing.T) {
+	if ok, _ := runSubcommand([]string{"nope"}, nil, nil); ok {
+		t.Fatalf("expected unknown command")
+	}
+}
+
+func TestLocalSubcommand(t *testing.T) {
+	for name, local := range map[string]bool{"cat": false, "put": false, "ls": false, "render": true, "build": true, "bench": true} {
+		if got := localSubcommand(name); got != local {
+			t.Errorf("localSubcommand(%q) = %v", name, got)
+		}
+	}
+}
+
+func TestCLI_CatPutLs(t *testing.T) {
+	chdirTemp(t)
+	url := startTestServer(t)
+	if err := os.WriteFile("a.md", []byte("alpha"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// cat
+	var out bytes.Buffer
+	if _, err := runSubcommand([]string{"cat", "-server", url, "a.md"}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "alpha" {
+		t.Fatalf("cat = %q", out.String())
+	}
+
+	// put without rename prints nothing
+	out.Reset()
+	if _, err := runSubcommand([]string{"put", "-server", url, "a.md"}, strings.NewReader("beta"), &out); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile("a.md"); string(b) != "beta" {
+		t.Fatalf("a.md = %q", string(b))
+	}
+	if out.Len() != 0 {
+		t.Fatalf("unexpected output %q", out.String())
+	}
+	// Lock released after put
+	if _, ok := locks["a.md"]; ok {
+		t.Fatalf("lock should be released")
+	}
+
+	// put with rename prints the new name
+	out.Reset()
+	if _, err := runSubcommand([]string{"put", "-server", url, "a.md"}, strings.NewReader("# Gamma"), &out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(out.String()) != "gamma.md" {
+		t.Fatalf("put output = %q", out.String())
+	}
+
+	// ls
+	out.Reset()
+	if _, err := runSubcommand([]string{"ls", "-server", url}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(out.String()) != "gamma.md" {
+		t.Fatalf("ls = %q", out.String())
+	}
+}
+
+func TestCLI_PutKeepsLock(t *testing.T) {
+	chdirTemp(t)
+	locks = make(map[string]lockInfo)
+	oldTTL, oldMax := lockTTL, maxLockTTL
+	lockTTL, maxLockTTL = 50*time.Millisecond, 100*time.Millisecond
+	t.Cleanup(func() { lockTTL, maxLockTTL = oldTTL, oldMax })
+	var asked string
+	mux := newMux()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/lock":
+			if r.Header.Get("X-Lock") == "" {
+				asked = r.URL.Query().Get("ttl")
+			}
+		case "/save":
+			// An upload outlasting the lock's TTL
+			time.Sleep(3 * maxLockTTL)
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	if err := os.WriteFile("a.md", []byte("alpha"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if _, err := runSubcommand([]string{"put", "-server", srv.URL, "a.md"}, strings.NewReader("beta"), &out); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile("a.md"); string(b) != "beta" {
+		t.Errorf("a.md = %q", b)
+	}
+	if d, err := time.ParseDuration(asked); err != nil || d != putLockTTL {
+		t.Errorf("asked for ttl %q", asked)
+	}
+}
+
+func TestCLI_Errors(t *testing.T) {
+	chdirTemp(t)
+	url := startTestServer(t)
+	var out bytes.Buffer
+	// Missing file
+	if _, err := runSubcommand([]string{"cat", "-server", url, "missing.md"}, nil, &out); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("expected 404 error, got %v", err)
+	}
+	// Usage errors
+	if _, err := runSubcommand([]string{"cat", "-server", url}, nil, &out); err == nil {
+		t.Fatalf("expected usage error")
+	}
+	if _, err := runSubcommand([]string{"put", "-server", url}, strings.NewReader(""), &out); err == nil {
+		t.Fatalf("expected usage error")
+	}
+	if _, err := runSubcommand([]string{"ls", "-server", url, "extra"}, nil, &out); err == nil {
+		t.Fatalf("expected usage error")
+	}
+	// Put against a file locked by someone else
+	locks["b.md"] = lockInfo{token: "other", expires: time.Now().Add(time.Hour)}
+	if _, err := runSubcommand([]string{"put", "-server", url, "b.md"}, strings.NewReader("x"), &out); err == nil || !strings.Contains(err.Error(), "423") {
+		t.Fatalf("expected lock error, got %v", err)
+	}
+}
+
+func TestDefaultServer(t *testing.T) {
+	t.Setenv("MINIMARK_SERVER", "http://example:1")
+	if got := defaultServer(); got != "http://example:1" {
+		t.Fatalf("got %q", got)
+	}
+	t.Setenv("MINIMARK_SERVER", "")
+	if got := defaultServer(); got != "http://localhost:8080" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestCLI_Render(t *testing.T) {
+	chdirTemp(t)
+	fakeCmarkOnPath(t)
+	if err := os.MkdirAll("_includes", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join("_includes", "header.html"), []byte("<h>H</h>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if _, err := runSubcommand([]string{"render"}, strings.NewReader("hello"), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "<h>H</h><p>hello</p>" {
+		t.Fatalf("render = %q", out.String())
+	}
+	if _, err := runSubcommand([]string{"render", "extra"}, strings.NewReader(""), &out); err == nil {
+		t.Fatalf("expected usage error")
+	}
+	// Without cmark-gfm the built-in renderer takes over
+	t.Setenv("PATH", t.TempDir())
+	out.Reset()
+	if _, err := runSubcommand([]string{"render"}, strings.NewReader("*hi*"), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "<h>H</h><p><em>hi</em></p>\n" {
+		t.Fatalf("built-in render = %q", out.String())
+	}
+}
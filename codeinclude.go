@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// codeShortcode includes lines of a source file as a fenced code block:
+//
+//	{{code path=src/main.go lines=10-42 lang=go}}
+//
+// path is relative to the workspace and must stay inside the configured
+// code_root, the workspace unless set; set "code_root": ".." to include
+// files from beside it, such as ../src/main.go. The workspace's own folders
+// and unpublished notes are never included. lines is optional ("10-42", "10-" or "7"); lang
+// defaults to the file extension.
+func codeShortcode(a shortcodeArgs) (string, string, error) {
+	p := a.named["path"]
+	if p == "" && len(a.positional) > 0 {
+		p = a.positional[0]
+	}
+	if p == "" {
+		return "", "", fmt.Errorf("missing path")
+	}
+	path, err := codePath(p)
+	if err != nil {
+		return "", "", err
+	}
+	b, err := os.ReadFile(wsPath(path))
+	if err != nil {
+		return "", "", fmt.Errorf("cannot read %s", p)
+	}
+	lines := strings.Split(strings.TrimRight(string(b), "\n"), "\n")
+	if spec := a.named["lines"]; spec != "" {
+		from, to, err := parseLineRange(spec, len(lines))
+		if err != nil {
+			return "", "", err
+		}
+		lines = lines[from-1 : to]
+	}
+	lang := a.named["lang"]
+	if lang == "" {
+		lang = strings.TrimPrefix(filepath.Ext(p), ".")
+	}
+	code := strings.Join(lines, "\n")
+	// The fence must be longer than any backtick run in the code
+	fence := "```"
+	for strings.Contains(code, fence) {
+		fence += "`"
+	}
+	return fence + lang + "\n" + code + "\n" + fence, "", nil
+}
+
+// codePath resolves p against the workspace and checks that it stays inside
+// the code root, following symlinks, and out of the workspace's own
+// folders, which hold lock tokens and deleted notes. Markdown notes must be
+// published ones: private, draft, encrypted and password-protected notes
+// are refused.
+func codePath(p string) (string, error) {
+	rootRel := config.CodeRoot
+	if rootRel == "" {
+		rootRel = "."
+	}
+	root, err := realPath(wsPath(rootRel))
+	if err != nil {
+		return "", err
+	}
+	abs, err := realPath(wsPath(filepath.FromSlash(p)))
+	if err != nil {
+		return "", fmt.Errorf("cannot read %s", p)
+	}
+	if !within(root, abs) {
+		return "", fmt.Errorf("%s is outside the code root", p)
+	}
+	ws, err := realPath(wsPath("."))
+	if err != nil {
+		return "", err
+	}
+	rel, _ := filepath.Rel(ws, abs)
+	inside := within(ws, abs)
+	if inside && reservedPath(rel) {
+		return "", fmt.Errorf("%s is in a workspace folder", p)
+	}
+	// Notes that are not published would be included in the clear
+	if strings.EqualFold(filepath.Ext(abs), ".md") {
+		md, err := os.ReadFile(abs)
+		if err != nil {
+			return "", fmt.Errorf("cannot read %s", p)
+		}
+		if !publicNote(md) || (inside && encryptedNote(rel)) {
+			return "", fmt.Errorf("%s is not a published note", p)
+		}
+	}
+	return abs, nil
+}
+
+// realPath is the absolute path of p with symlinks resolved.
+func realPath(p string) (string, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
+
+// within reports whether path is dir or lies below it.
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// parseLineRange parses "a-b", "a-" or "a" into a 1-based inclusive range
+// within n lines.
+func parseLineRange(spec string, n int) (int, int, error) {
+	fromS, toS, isRange := strings.Cut(spec, "-")
+	from, err := strconv.Atoi(fromS)
+	to := from
+	if err == nil && isRange {
+		to = n
+		if toS != "" {
+			to, err = strconv.Atoi(toS)
+		}
+	}
+	if err != nil || from < 1 || to < from || to > n {
+		return 0, 0, fmt.Errorf("invalid lines %q for a %d-line file", spec, n)
+	}
+	return from, to, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCodePath_Escapes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on windows")
+	}
+	dir := chdirTemp(t)
+	outside := t.TempDir()
+	writeFiles(t, map[string]string{
+		filepath.Join(outside, "secret.go"): "package secret",
+		"main.go":                           "package main",
+	})
+	for _, d := range []string{".minimark", ".trash", "_data", "src"} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFiles(t, map[string]string{
+		filepath.Join(".minimark", "state.json"): `{"locks":{}}`,
+		filepath.Join(".trash", "old.md"):        "old",
+		filepath.Join("_data", "site.json"):      "{}",
+	})
+	if err := os.Symlink(outside, filepath.Join("src", "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, ".minimark"), "state"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := codePath("main.go"); err != nil {
+		t.Fatalf("main.go: %v", err)
+	}
+	for _, p := range []string{
+		"../secret.go",
+		filepath.Join(outside, "secret.go"),
+		"src/link/secret.go",
+		".minimark/state.json",
+		".trash/old.md",
+		"_data/site.json",
+		"state/state.json",
+	} {
+		if _, err := codePath(p); err == nil {
+			t.Errorf("%s: included", p)
+		}
+	}
+	out, _ := expandShortcodes([]byte("{{code path=.minimark/state.json}}"))
+	if strings.Contains(string(out), "locks") {
+		t.Errorf("state included: %q", out)
+	}
+
+	// A code root above the workspace still keeps its folders out
+	withConfig(t, siteConfig{CodeRoot: ".."})
+	if _, err := codePath(".minimark/state.json"); err == nil {
+		t.Error("state included with code_root ..")
+	}
+}
+
+func TestCodePath_UnpublishedNotes(t *testing.T) {
+	chdirTemp(t)
+	withConfig(t, siteConfig{Encrypt: []string{"diary-*.md"}})
+	writeFiles(t, map[string]string{
+		"public.md":  "# Public\n",
+		"private.md": "---\nprivate: true\n---\nsecret",
+		"draft.md":   "---\ndraft: true\n---\nsecret",
+		"locked.md":  "---\npassword: hunter2\n---\nsecret",
+		"diary-1.md": "secret, not sealed yet",
+		"sealed.md":  encryptedNoteMagic + "ciphertext",
+	})
+
+	if _, err := codePath("public.md"); err != nil {
+		t.Errorf("public.md: %v", err)
+	}
+	for _, p := range []string{"private.md", "draft.md", "locked.md", "diary-1.md", "sealed.md"} {
+		if _, err := codePath(p); err == nil {
+			t.Errorf("%s: included", p)
+		}
+	}
+	out, _ := expandShortcodes([]byte("{{code path=private.md}}"))
+	if strings.Contains(string(out), "secret") {
+		t.Errorf("private note included: %q", out)
+	}
+}
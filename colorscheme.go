@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+)
+
+// Color schemes for exported pages.
+const (
+	schemeAuto  = "auto" // follow prefers-color-scheme
+	schemeLight = "light"
+	schemeDark  = "dark"
+)
+
+// colorScheme is the scheme published pages use until a reader toggles it.
+var colorScheme = schemeAuto
+
+// Template hooks recognised in _includes/header.html and footer.html.
+const (
+	themeHook       = "{{theme}}"        // theme stylesheets and toggle script
+	themeToggleHook = "{{theme-toggle}}" // toggle button
+	titleHook       = "{{title}}"        // page title
+	dateHook        = "{{date}}"         // front matter date:, as 2006-01-02
+	tagsHook        = "{{tags}}"         // front matter tags:, comma-separated
+)
+
+const themeToggleButton = `<button type="button" class="theme-toggle" data-theme-toggle aria-label="Toggle dark mode">◐</button>`
+
+func validColorScheme(t string) error {
+	switch t {
+	case schemeAuto, schemeLight, schemeDark:
+		return nil
+	}
+	return fmt.Errorf("invalid color scheme %q (want %q, %q or %q)", t, schemeAuto, schemeLight, schemeDark)
+}
+
+// themeHead returns the <head> markup linking both theme stylesheets, with
+// media queries selecting the default, and the toggle script.
+func themeHead(theme string) string {
+	lightMedia, darkMedia := "(prefers-color-scheme: light)", "(prefers-color-scheme: dark)"
+	switch theme {
+	case schemeLight:
+		lightMedia, darkMedia = "all", "not all"
+	case schemeDark:
+		lightMedia, darkMedia = "not all", "all"
+	}
+	return fmt.Sprintf(`<link rel="stylesheet" type="text/css" href="theme-light.css" media="%s" id="theme-light">
+<link rel="stylesheet" type="text/css" href="theme-dark.css" media="%s" id="theme-dark">
+<script src="theme.js" data-default="%s"></script>
+`, lightMedia, darkMedia, theme)
+}
+
+// applyPageHooks expands the template hooks in an include for the page
+// rendered from md: {{title}}, {{date}} and {{tags}} plus the theme hooks.
+func applyPageHooks(b, md []byte) []byte {
+	fields, _ := parseFrontMatter(md)
+	date := fields["date"]
+	if t, ok := parseFrontMatterDate(date); ok {
+		date = t.Format("2006-01-02")
+	}
+	b = bytes.ReplaceAll(b, []byte(titleHook), []byte(html.EscapeString(pageTitle(md))))
+	b = bytes.ReplaceAll(b, []byte(dateHook), []byte(html.EscapeString(date)))
+	b = bytes.ReplaceAll(b, []byte(tagsHook), []byte(html.EscapeString(strings.Join(frontMatterList(fields["tags"]), ", "))))
+	return applyThemeHooks(b)
+}
+
+// applyThemeHooks expands the theme hooks in an include. When a header has
+// no {{theme}} hook the theme markup is added before </head>, unless the
+// header already references theme.js.
+func applyThemeHooks(b []byte) []byte {
+	b = bytes.ReplaceAll(b, []byte(themeToggleHook), []byte(themeToggleButton))
+	head := []byte(themeHead(colorScheme))
+	if bytes.Contains(b, []byte(themeHook)) {
+		return bytes.ReplaceAll(b, []byte(themeHook), head)
+	}
+	if bytes.Contains(b, []byte("theme.js")) {
+		return b
+	}
+	return insertBeforeTag(b, "</head>", string(head))
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyThemeHooks(t *testing.T) {
+	t.Cleanup(func() { colorScheme = schemeAuto })
+	cases := []struct {
+		theme, in string
+		want      []string
+		not       []string
+	}{
+		{schemeAuto, "<head></head>", []string{`media="(prefers-color-scheme: dark)" id="theme-dark"`, `data-default="auto"`, "</head>"}, nil},
+		{schemeDark, "<head>{{theme}}</head>", []string{`media="all" id="theme-dark"`, `media="not all" id="theme-light"`}, []string{"{{theme}}"}},
+		{schemeLight, "<p>{{theme-toggle}}</p>", []string{"data-theme-toggle"}, []string{"theme.js", "{{theme-toggle}}"}},
+		{schemeAuto, `<head><script src="theme.js"></script></head>`, nil, []string{"theme-light.css"}},
+	}
+	for _, c := range cases {
+		colorScheme = c.theme
+		got := string(applyThemeHooks([]byte(c.in)))
+		for _, w := range c.want {
+			if !strings.Contains(got, w) {
+				t.Errorf("%s %q: missing %q in %q", c.theme, c.in, w, got)
+			}
+		}
+		for _, n := range c.not {
+			if strings.Contains(got, n) {
+				t.Errorf("%s %q: unexpected %q in %q", c.theme, c.in, n, got)
+			}
+		}
+	}
+}
+
+func TestValidColorScheme(t *testing.T) {
+	for _, th := range []string{"auto", "light", "dark"} {
+		if err := validColorScheme(th); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if validColorScheme("sepia") == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// commentsConfig adds a giscus or utterances comments widget to exported
+// pages. With OptIn, only pages with "comments: true" get it; otherwise
+// every page does unless it sets "comments: false".
+type commentsConfig struct {
+	Provider   string `json:"provider"` // "giscus" or "utterances"
+	Repo       string `json:"repo"`     // owner/name
+	RepoID     string `json:"repo_id,omitempty"`
+	Category   string `json:"category,omitempty"`
+	CategoryID string `json:"category_id,omitempty"`
+	Mapping    string `json:"mapping,omitempty"` // default "pathname"
+	Label      string `json:"label,omitempty"`
+	Theme      string `json:"theme,omitempty"`
+	OptIn      bool   `json:"opt_in,omitempty"`
+}
+
+// commentsHook marks where the widget goes in a header or footer; without
+// it the widget follows the page body.
+const commentsHook = "{{comments}}"
+
+var repoRe = regexp.MustCompile(`^[A-Za-z0-9_.-]+/[A-Za-z0-9_.-]+$`)
+
+func validateComments(c *commentsConfig) error {
+	if c == nil {
+		return nil
+	}
+	if !repoRe.MatchString(c.Repo) {
+		return fmt.Errorf("comments: repo %q must be owner/name", c.Repo)
+	}
+	switch c.Provider {
+	case "giscus":
+		if c.RepoID == "" || c.CategoryID == "" {
+			return fmt.Errorf("comments: giscus needs repo_id and category_id")
+		}
+	case "utterances":
+	default:
+		return fmt.Errorf("comments: unknown provider %q", c.Provider)
+	}
+	return nil
+}
+
+// commentsEnabled reports whether the page md gets a comments widget.
+func commentsEnabled(md []byte) bool {
+	c := config.Comments
+	if c == nil {
+		return false
+	}
+	fields, _ := parseFrontMatter(md)
+	if v, err := strconv.ParseBool(fields["comments"]); err == nil {
+		return v
+	}
+	return !c.OptIn
+}
+
+// commentsWidget returns the embed script for the configured provider.
+func commentsWidget(lang string) string {
+	c := config.Comments
+	attr := func(name, value string) string {
+		return fmt.Sprintf(` %s="%s"`, name, html.EscapeString(value))
+	}
+	or := func(v, def string) string {
+		if v == "" {
+			return def
+		}
+		return v
+	}
+	var b strings.Builder
+	b.WriteString(`<section class="comments">` + "\n")
+	if c.Provider == "giscus" {
+		b.WriteString(`<script src="https://giscus.app/client.js"`)
+		b.WriteString(attr("data-repo", c.Repo) + attr("data-repo-id", c.RepoID))
+		b.WriteString(attr("data-category", c.Category) + attr("data-category-id", c.CategoryID))
+		b.WriteString(attr("data-mapping", or(c.Mapping, "pathname")) + attr("data-reactions-enabled", "1"))
+		b.WriteString(attr("data-theme", or(c.Theme, "preferred_color_scheme")) + attr("data-lang", or(lang, "en")))
+		b.WriteString(attr("data-loading", "lazy"))
+	} else {
+		b.WriteString(`<script src="https://utteranc.es/client.js"`)
+		b.WriteString(attr("repo", c.Repo) + attr("issue-term", or(c.Mapping, "pathname")))
+		if c.Label != "" {
+			b.WriteString(attr("label", c.Label))
+		}
+		b.WriteString(attr("theme", or(c.Theme, "preferred-color-scheme")))
+	}
+	b.WriteString(` crossorigin="anonymous" async></script>` + "\n</section>\n")
+	return b.String()
+}
+
+// applyComments places the comments widget for page md at the hook in the
+// header or footer, else after body. The hook is removed when the page has
+// no comments.
+func applyComments(md []byte, lang string, header, footer, body []byte) ([]byte, []byte, []byte) {
+	widget := ""
+	if commentsEnabled(md) {
+		widget = commentsWidget(lang)
+	}
+	hook := []byte(commentsHook)
+	if bytes.Contains(header, hook) || bytes.Contains(footer, hook) {
+		if header != nil {
+			header = bytes.ReplaceAll(header, hook, []byte(widget))
+		}
+		if footer != nil {
+			footer = bytes.ReplaceAll(footer, hook, []byte(widget))
+		}
+		return header, footer, body
+	}
+	return header, footer, append(body, widget...)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestApplyComments(t *testing.T) {
+	withConfig(t, siteConfig{Comments: &commentsConfig{Provider: "utterances", Repo: "me/site", Label: "comments"}})
+	_, _, body := applyComments([]byte("# Hi"), "", nil, nil, []byte("<h1>Hi</h1>\n"))
+	want := "<h1>Hi</h1>\n<section class=\"comments\">\n<script src=\"https://utteranc.es/client.js\" repo=\"me/site\" issue-term=\"pathname\" label=\"comments\" theme=\"preferred-color-scheme\" crossorigin=\"anonymous\" async></script>\n</section>\n"
+	if string(body) != want {
+		t.Fatalf("body = %q", body)
+	}
+	// Turned off in front matter; the hook is removed
+	header, footer, body := applyComments([]byte("---\ncomments: false\n---\n"), "", []byte("<h>"), []byte("{{comments}}</body>"), []byte("<p>x</p>"))
+	if string(header) != "<h>" || string(footer) != "</body>" || string(body) != "<p>x</p>" {
+		t.Fatalf("got %q %q %q", header, footer, body)
+	}
+
+	// Opt-in giscus, placed at the hook
+	withConfig(t, siteConfig{Comments: &commentsConfig{Provider: "giscus", Repo: "me/site", RepoID: "R1", Category: "Q&A", CategoryID: "C1", OptIn: true}})
+	_, footer, body = applyComments([]byte("# Hi"), "de", nil, []byte("{{comments}}"), []byte("<p>x</p>"))
+	if string(footer) != "" || string(body) != "<p>x</p>" {
+		t.Fatalf("not opted in: %q %q", footer, body)
+	}
+	_, footer, body = applyComments([]byte("---\ncomments: true\n---\n"), "de", nil, []byte("{{comments}}"), []byte("<p>x</p>"))
+	if string(body) != "<p>x</p>" || !strings.Contains(string(footer), `data-category="Q&amp;A" data-category-id="C1"`) || !strings.Contains(string(footer), `data-lang="de"`) {
+		t.Fatalf("footer = %q", footer)
+	}
+}
+
+func TestLoadConfig_Comments(t *testing.T) {
+	chdirTemp(t)
+	for _, bad := range []string{
+		`{"comments": {"provider": "disqus", "repo": "me/site"}}`,
+		`{"comments": {"provider": "utterances", "repo": "site"}}`,
+		`{"comments": {"provider": "giscus", "repo": "me/site"}}`,
+	} {
+		if err := os.WriteFile("minimark.json", []byte(bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadConfig("minimark.json"); err == nil {
+			t.Errorf("%s accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// --------- Transparent gzip for responses and uploads ---------
+
+// gzipMinSize is the smallest response worth compressing; smaller bodies
+// are sent as they are.
+const gzipMinSize = 1024
+
+// maxInflatedBody bounds a decompressed request body.
+const maxInflatedBody = 64 << 20
+
+var gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+
+// compression gzips compressible responses for clients that accept it and
+// inflates request bodies sent with Content-Encoding: gzip.
+func compression(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if enc := r.Header.Get("Content-Encoding"); enc != "" && !strings.EqualFold(enc, "identity") {
+			if !strings.EqualFold(enc, "gzip") {
+				http.Error(w, "unsupported content encoding", http.StatusUnsupportedMediaType)
+				return
+			}
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, "invalid gzip body", http.StatusBadRequest)
+				return
+			}
+			defer zr.Close()
+			r.Body = http.MaxBytesReader(w, zr, maxInflatedBody)
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		// Ranges refer to the uncompressed bytes, so leave them alone
+		if !acceptsGzip(r) || r.Header.Get("Range") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer gw.finish()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip reports whether r's Accept-Encoding allows gzip.
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		q := strings.ReplaceAll(params, " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+	return false
+}
+
+// compressible reports whether responses of content type ct shrink under
+// gzip.
+func compressible(ct string) bool {
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mt, "text/"), strings.HasSuffix(mt, "+json"), strings.HasSuffix(mt, "+xml"):
+		return true
+	}
+	switch mt {
+	case "application/json", "application/javascript", "application/xml", "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// gzipResponseWriter buffers the start of a response to decide whether to
+// compress it: only compressible types of at least gzipMinSize bytes are.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	status  int
+	buf     []byte
+	zw      *gzip.Writer
+	decided bool // headers sent, either compressed (zw != nil) or not
+}
+
+func (g *gzipResponseWriter) WriteHeader(status int) {
+	if g.status == 0 {
+		g.status = status
+	}
+}
+
+func (g *gzipResponseWriter) Write(p []byte) (int, error) {
+	if g.status == 0 {
+		g.status = http.StatusOK
+	}
+	if !g.decided {
+		g.buf = append(g.buf, p...)
+		if len(g.buf) < gzipMinSize {
+			return len(p), nil
+		}
+		if err := g.start(true); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if g.zw != nil {
+		return g.zw.Write(p)
+	}
+	return g.ResponseWriter.Write(p)
+}
+
+// start sends the headers, compressing when full (enough was written) and
+// the response qualifies, then the buffered bytes.
+func (g *gzipResponseWriter) start(full bool) error {
+	g.decided = true
+	h := g.Header()
+	if h.Get("Content-Type") == "" && len(g.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(g.buf))
+	}
+	if full && g.status == http.StatusOK && h.Get("Content-Encoding") == "" && compressible(h.Get("Content-Type")) {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", "gzip")
+		g.zw = gzipWriters.Get().(*gzip.Writer)
+		g.zw.Reset(g.ResponseWriter)
+	}
+	if g.status != 0 {
+		g.ResponseWriter.WriteHeader(g.status)
+	}
+	buf := g.buf
+	g.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if g.zw != nil {
+		_, err = g.zw.Write(buf)
+	} else {
+		_, err = g.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush sends what was written so far, uncompressed if it is still below
+// gzipMinSize, so streamed responses such as /events reach the client.
+func (g *gzipResponseWriter) Flush() {
+	if !g.decided {
+		_ = g.start(false)
+	}
+	if g.zw != nil {
+		_ = g.zw.Flush()
+	}
+	_ = http.NewResponseController(g.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (g *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
+
+// finish flushes a response that never reached gzipMinSize and closes the
+// compressor.
+func (g *gzipResponseWriter) finish() {
+	if !g.decided {
+		_ = g.start(false)
+	}
+	if g.zw != nil {
+		_ = g.zw.Close()
+		g.zw.Reset(io.Discard)
+		gzipWriters.Put(g.zw)
+	}
+}
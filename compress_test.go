@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func gzipBytes(t *testing.T, s string) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	if _, err := zw.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestCompression_Responses(t *testing.T) {
+	big := strings.Repeat("markdown ", 500)
+	h := compression(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/big":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Header().Set("ETag", `"abc"`)
+			io.WriteString(w, big[:600])
+			io.WriteString(w, big[600:])
+		case "/small":
+			io.WriteString(w, "tiny")
+		case "/png":
+			w.Header().Set("Content-Type", "image/png")
+			io.WriteString(w, big)
+		case "/missing":
+			http.Error(w, big, http.StatusNotFound)
+		}
+	}))
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Encoding", accept)
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("/big", "br, gzip")
+	if rr.Header().Get("Content-Encoding") != "gzip" || rr.Header().Get("Vary") != "Accept-Encoding" || rr.Header().Get("ETag") != `"abc"` {
+		t.Fatalf("headers = %v", rr.Header())
+	}
+	zr, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := io.ReadAll(zr); string(b) != big {
+		t.Fatalf("body = %q", b)
+	}
+	for path, accept := range map[string]string{"/big": "gzip;q=0", "/small": "gzip", "/png": "gzip", "/missing": "gzip"} {
+		rr := get(path, accept)
+		if rr.Header().Get("Content-Encoding") != "" || rr.Body.Len() == 0 {
+			t.Errorf("%s (%s): compressed or empty: %v", path, accept, rr.Header())
+		}
+	}
+	if rr := get("/missing", "gzip"); rr.Code != http.StatusNotFound {
+		t.Fatalf("status = %d", rr.Code)
+	}
+}
+
+func TestCompression_Uploads(t *testing.T) {
+	h := compression(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Write(b)
+	}))
+	post := func(enc string, body []byte) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/save", bytes.NewReader(body))
+		req.Header.Set("Content-Encoding", enc)
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+	if rr := post("gzip", gzipBytes(t, "# Note\n")); rr.Code != http.StatusOK || rr.Body.String() != "# Note\n" {
+		t.Fatalf("gzip upload = %d %q", rr.Code, rr.Body.String())
+	}
+	if rr := post("gzip", []byte("not gzip")); rr.Code != http.StatusBadRequest {
+		t.Fatalf("bad gzip = %d", rr.Code)
+	}
+	if rr := post("br", []byte("x")); rr.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("br = %d", rr.Code)
+	}
+}
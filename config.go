@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// configPath is the optional workspace configuration file.
+var configPath = "minimark.json"
+
+// siteConfig is the workspace configuration read from configPath.
+type siteConfig struct {
+	// Styles and Scripts are added to every exported page. Entries are
+	// URLs, or paths relative to the workspace that are copied into docs.
+	Styles  []string `json:"styles,omitempty"`
+	Scripts []string `json:"scripts,omitempty"`
+	// Icon is a square-ish image in the workspace (PNG, JPEG or GIF) from
+	// which the favicon and web manifest icons are generated.
+	Icon string `json:"icon,omitempty"`
+	// Name is the site name used in the web manifest; it defaults to the
+	// workspace folder name.
+	Name string `json:"name,omitempty"`
+	// Languages enables multi-language sites: "guide.de.md" is the German
+	// translation of "guide.md", whose language is the first listed.
+	Languages []string `json:"languages,omitempty"`
+	// CodeRoot bounds the files {{code}} may include, relative to the
+	// workspace (default: the workspace itself).
+	CodeRoot string `json:"code_root,omitempty"`
+	// PlantUMLServer (e.g. "https://www.plantuml.com/plantuml") or
+	// PlantUMLJar, a local plantuml.jar run with java, renders ```plantuml
+	// fences. The jar wins when both are set.
+	PlantUMLServer string `json:"plantuml_server,omitempty"`
+	PlantUMLJar    string `json:"plantuml_jar,omitempty"`
+	// OEmbed lists the hosts whose bare links are expanded into embeds.
+	OEmbed []oembedProvider `json:"oembed,omitempty"`
+	// Comments configures a comments widget for exported pages.
+	Comments *commentsConfig `json:"comments,omitempty"`
+	// Analytics configures a tracking snippet for exported pages.
+	Analytics *analyticsConfig `json:"analytics,omitempty"`
+	// Headers tunes the editor server's security headers.
+	Headers headersConfig `json:"headers,omitempty"`
+	// ExportCSP emits a Content-Security-Policy for exported pages as a
+	// meta tag ("meta") or a docs/_headers file ("headers").
+	ExportCSP string `json:"export_csp,omitempty"`
+	// SRI adds integrity hashes to exported pages' local stylesheets and
+	// scripts.
+	SRI bool `json:"sri,omitempty"`
+	// LinkCards renders paragraphs that only hold an external link as
+	// preview cards.
+	LinkCards bool `json:"link_cards,omitempty"`
+	// Footnotes shows each footnote beside its reference as a hover
+	// popover ("popover") or a margin note ("sidenotes").
+	Footnotes string `json:"footnotes,omitempty"`
+	// Converter is a command that renders Markdown to HTML in place of the
+	// built-in renderer, such as "pandoc -f gfm -t html5 {input}".
+	Converter string `json:"converter,omitempty"`
+	// Out is the folder exports are written to, in place of docs.
+	Out string `json:"out,omitempty"`
+	// Archive generates year and month archive pages for dated pages.
+	Archive bool `json:"archive,omitempty"`
+	// Taxonomies declares custom groupings such as authors or products.
+	Taxonomies []taxonomyConfig `json:"taxonomies,omitempty"`
+	// SiteURL is where docs is published, e.g. "https://example.com/";
+	// setting it writes docs/sitemap.xml.
+	SiteURL string `json:"site_url,omitempty"`
+	// Encrypt lists filename patterns (e.g. "journal-*.md") of notes kept
+	// encrypted on disk; see -key-file.
+	Encrypt []string `json:"encrypt,omitempty"`
+	// SMTP is the mail server notes are emailed through.
+	SMTP *smtpConfig `json:"smtp,omitempty"`
+	// Webmention receives and sends webmentions for the published site.
+	Webmention *webmentionConfig `json:"webmention,omitempty"`
+	// ActivityPub federates dated notes to followers on the Fediverse.
+	ActivityPub *activityPubConfig `json:"activitypub,omitempty"`
+	// Micropub lets IndieWeb clients post notes.
+	Micropub *micropubConfig `json:"micropub,omitempty"`
+}
+
+var config siteConfig
+
+// Template hooks for the configured assets.
+const (
+	stylesHook  = "{{styles}}"
+	scriptsHook = "{{scripts}}"
+)
+
+// loadConfig reads the configuration in file. A missing file is an empty
+// configuration.
+func loadConfig(file string) (siteConfig, error) {
+	var c siteConfig
+	b, err := os.ReadFile(wsPath(file))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+		return c, err
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, fmt.Errorf("read %s: %w", file, err)
+	}
+	for _, ref := range append(append([]string{}, c.Styles...), c.Scripts...) {
+		if isRemoteAsset(ref) {
+			continue
+		}
+		if !insideWorkspace(ref) {
+			return c, fmt.Errorf("%s: asset %q must be a URL or a path inside the workspace", file, ref)
+		}
+	}
+	for _, l := range c.Languages {
+		if !langCodeRe.MatchString(l) {
+			return c, fmt.Errorf("%s: invalid language %q", file, l)
+		}
+	}
+	if err := validateOEmbed(c.OEmbed); err != nil {
+		return c, fmt.Errorf("%s: %w", file, err)
+	}
+	if err := validateComments(c.Comments); err != nil {
+		return c, fmt.Errorf("%s: %w", file, err)
+	}
+	if err := validateAnalytics(c.Analytics); err != nil {
+		return c, fmt.Errorf("%s: %w", file, err)
+	}
+	if err := validateTaxonomies(c.Taxonomies, c.Languages); err != nil {
+		return c, fmt.Errorf("%s: %w", file, err)
+	}
+	if err := validEncryptPatterns(c.Encrypt); err != nil {
+		return c, fmt.Errorf("%s: %w", file, err)
+	}
+	if err := validateSMTP(c.SMTP); err != nil {
+		return c, fmt.Errorf("%s: %w", file, err)
+	}
+	if err := validateSiteURL(c.SiteURL); err != nil {
+		return c, fmt.Errorf("%s: %w", file, err)
+	}
+	if err := validateWebmention(c.Webmention, c.SiteURL); err != nil {
+		return c, fmt.Errorf("%s: %w", file, err)
+	}
+	if err := validateActivityPub(c.ActivityPub, c.SiteURL); err != nil {
+		return c, fmt.Errorf("%s: %w", file, err)
+	}
+	if err := validateMicropub(c.Micropub); err != nil {
+		return c, fmt.Errorf("%s: %w", file, err)
+	}
+	if err := validateFootnotes(c.Footnotes); err != nil {
+		return c, fmt.Errorf("%s: %w", file, err)
+	}
+	if err := validateConverter(c.Converter); err != nil {
+		return c, fmt.Errorf("%s: %w", file, err)
+	}
+	if err := validateOut(c.Out); err != nil {
+		return c, fmt.Errorf("%s: %w", file, err)
+	}
+	if c.ExportCSP != "" && c.ExportCSP != cspMeta && c.ExportCSP != cspHeaders {
+		return c, fmt.Errorf("%s: export_csp must be %q or %q", file, cspMeta, cspHeaders)
+	}
+	if c.Icon != "" && !insideWorkspace(c.Icon) {
+		return c, fmt.Errorf("%s: icon %q must be a path inside the workspace", file, c.Icon)
+	}
+	return c, nil
+}
+
+// insideWorkspace reports whether ref is a relative path that stays inside
+// the workspace.
+func insideWorkspace(ref string) bool {
+	clean := path.Clean(ref)
+	return !(ref == "" || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../"))
+}
+
+func isRemoteAsset(ref string) bool {
+	return strings.Contains(ref, "://") || strings.HasPrefix(ref, "//")
+}
+
+func styleTags() string {
+	var b strings.Builder
+	b.WriteString(iconTags())
+	for _, ref := range config.Styles {
+		fmt.Fprintf(&b, "<link rel=\"stylesheet\" type=\"text/css\" href=\"%s\">\n", html.EscapeString(ref))
+	}
+	return b.String()
+}
+
+func scriptTags() string {
+	var b strings.Builder
+	for _, ref := range config.Scripts {
+		fmt.Fprintf(&b, "<script src=\"%s\"></script>\n", html.EscapeString(ref))
+	}
+	return b.String()
+}
+
+// injectAssets adds the configured styles and scripts to a page's header
+// and footer. The {{styles}} and {{scripts}} hooks place them explicitly;
+// otherwise styles go before </head> and scripts before </body>, or at the
+// start and end of the page when the includes lack those tags.
+func injectAssets(header, footer []byte) ([]byte, []byte) {
+	styles, scripts := styleTags(), scriptTags()
+	if bytes.Contains(header, []byte(stylesHook)) || bytes.Contains(footer, []byte(stylesHook)) {
+		header = bytes.ReplaceAll(header, []byte(stylesHook), []byte(styles))
+		footer = bytes.ReplaceAll(footer, []byte(stylesHook), []byte(styles))
+	} else if styles != "" {
+		if h := insertBeforeTag(header, "</head>", styles); len(h) > len(header) {
+			header = h
+		} else {
+			header = append([]byte(styles), header...)
+		}
+	}
+	if bytes.Contains(header, []byte(scriptsHook)) || bytes.Contains(footer, []byte(scriptsHook)) {
+		header = bytes.ReplaceAll(header, []byte(scriptsHook), []byte(scripts))
+		footer = bytes.ReplaceAll(footer, []byte(scriptsHook), []byte(scripts))
+	} else if scripts != "" {
+		if f := insertBeforeTag(footer, "</body>", scripts); len(f) > len(footer) {
+			footer = f
+		} else {
+			footer = append(footer, scripts...)
+		}
+	}
+	return header, footer
+}
+
+// copyConfigAssets copies the configured local styles and scripts into
+// dstDir, keeping their relative paths, and generates the site icons.
+func copyConfigAssets(dstDir string) error {
+	for _, ref := range append(append([]string{}, config.Styles...), config.Scripts...) {
+		if isRemoteAsset(ref) {
+			continue
+		}
+		dst := filepath.Join(dstDir, filepath.FromSlash(path.Clean(ref)))
+		if err := os.MkdirAll(wsPath(filepath.Dir(dst)), 0755); err != nil {
+			return err
+		}
+		if err := copyFile(filepath.FromSlash(ref), dst); err != nil {
+			return err
+		}
+	}
+	return writeSiteIcons(dstDir)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func withConfig(t *testing.T, c siteConfig) {
+	t.Helper()
+	config = c
+	t.Cleanup(func() { config = siteConfig{} })
+}
+
+func TestLoadConfig(t *testing.T) {
+	chdirTemp(t)
+	if c, err := loadConfig("minimark.json"); err != nil || len(c.Styles) != 0 {
+		t.Fatalf("missing config: %v %v", c, err)
+	}
+	writeFiles(t, map[string]string{"minimark.json": `{"styles": ["css/site.css", "https://cdn.example.com/x.css"], "scripts": ["//cdn.example.com/x.js"]}`})
+	c, err := loadConfig("minimark.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Styles) != 2 || len(c.Scripts) != 1 {
+		t.Fatalf("got %+v", c)
+	}
+	for _, bad := range []string{`{"styles": ["../x.css"]}`, `{"scripts": ["/etc/x.js"]}`, `{"styles": [""]}`, `{`} {
+		writeFiles(t, map[string]string{"minimark.json": bad})
+		if _, err := loadConfig("minimark.json"); err == nil {
+			t.Fatalf("expected error for %s", bad)
+		}
+	}
+}
+
+func TestInjectAssets(t *testing.T) {
+	withConfig(t, siteConfig{Styles: []string{"a.css"}, Scripts: []string{"b.js"}})
+	cases := []struct{ header, footer, want string }{
+		{"<head></head><body>", "</body>", `<head><link rel="stylesheet" type="text/css" href="a.css">` + "\n" + `</head><body>|<script src="b.js"></script>` + "\n</body>"},
+		{"<head>{{styles}}{{scripts}}</head>", "</body>", `<head><link rel="stylesheet" type="text/css" href="a.css">` + "\n" + `<script src="b.js"></script>` + "\n</head>|</body>"},
+		{"", "", `<link rel="stylesheet" type="text/css" href="a.css">` + "\n" + `|<script src="b.js"></script>` + "\n"},
+	}
+	for _, c := range cases {
+		h, f := injectAssets([]byte(c.header), []byte(c.footer))
+		if got := string(h) + "|" + string(f); got != c.want {
+			t.Errorf("injectAssets(%q, %q) = %q; want %q", c.header, c.footer, got, c.want)
+		}
+	}
+
+	config = siteConfig{}
+	h, f := injectAssets([]byte("<head></head>"), nil)
+	if string(h) != "<head></head>" || len(f) != 0 {
+		t.Fatalf("empty config should not change includes: %q %q", h, f)
+	}
+}
+
+func TestCopyConfigAssets(t *testing.T) {
+	chdirTemp(t)
+	withConfig(t, siteConfig{Styles: []string{"css/site.css", "https://cdn.example.com/x.css"}, Scripts: []string{"app.js"}})
+	if err := os.MkdirAll("css", 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, map[string]string{filepath.Join("css", "site.css"): "body{}", "app.js": "//"})
+	if err := copyConfigAssets("docs"); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{filepath.Join("docs", "css", "site.css"), filepath.Join("docs", "app.js")} {
+		if _, err := os.Stat(p); err != nil {
+			t.Fatalf("%s not copied: %v", p, err)
+		}
+	}
+	entries, _ := os.ReadDir("docs")
+	for _, e := range entries {
+		if strings.Contains(e.Name(), "cdn") {
+			t.Fatalf("remote asset should not be copied")
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// contentETag is the ETag sent with a file's content. Saves carrying
+// If-Match are refused when the file on disk no longer matches it.
+func contentETag(b []byte) string {
+	sum := sha256.Sum256(b)
+	return formatETag(sum[:])
+}
+
+// formatETag turns a sha256 sum into an ETag.
+func formatETag(sum []byte) string {
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// setRevision sends etag, a contentETag, as the ETag and, without quotes,
+// as X-Revision.
+func setRevision(h http.Header, etag string) {
+	h.Set("ETag", etag)
+	h.Set("X-Revision", strings.Trim(etag, `"`))
+}
+
+// sameRevision reports whether the If-Match value want names etag. Bare
+// X-Revision values and weak ETags are accepted too.
+func sameRevision(want, etag string) bool {
+	want = strings.Trim(strings.TrimPrefix(strings.TrimSpace(want), "W/"), `"`)
+	return want != "" && want == strings.Trim(etag, `"`)
+}
+
+// ifMatchFails reports whether the If-Match header of r rules out
+// overwriting a file whose current content is cur (exists false when the
+// file is missing). No header means no precondition.
+func ifMatchFails(r *http.Request, cur []byte, exists bool) bool {
+	want := r.Header.Get("If-Match")
+	switch {
+	case want == "":
+		return false
+	case !exists:
+		return true
+	case want == "*":
+		return false
+	}
+	return !sameRevision(want, contentETag(cur))
+}
+
+// diffOp is one run of a word diff: "=" for text in both versions, "-" for
+// text only on disk, "+" for text only in the submission.
+type diffOp struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// saveConflict is the 412 response to a save whose If-Match is stale.
+type saveConflict struct {
+	Error string   `json:"error"`
+	File  string   `json:"file"`
+	ETag  string   `json:"etag,omitempty"` // of the content on disk
+	Diff  []diffOp `json:"diff,omitempty"` // from the content on disk to the submission
+}
+
+// writeSaveConflict answers a stale save of file with the word diff from
+// the content on disk (cur) to the submission.
+func writeSaveConflict(w http.ResponseWriter, file string, cur []byte, exists bool, submitted []byte) {
+	c := saveConflict{Error: "file changed on disk", File: file, Diff: wordDiff(string(cur), string(submitted))}
+	if exists {
+		c.ETag = contentETag(cur)
+		setRevision(w.Header(), c.ETag)
+	} else {
+		c.Error = "file no longer exists"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusPreconditionFailed)
+	_ = json.NewEncoder(w).Encode(c)
+}
+
+var diffTokenRe = regexp.MustCompile(`\s+|[^\s]+`)
+
+// maxDiffCells bounds the table used to diff the changed middle of two
+// texts; beyond it the middle is reported as replaced wholesale.
+const maxDiffCells = 4 << 20
+
+// wordDiff diffs a and b by words and the whitespace between them. Adjacent
+// runs of the same kind are merged.
+func wordDiff(a, b string) []diffOp {
+	var ops []diffOp
+	diffSeq(diffTokenRe.FindAllString(a, -1), diffTokenRe.FindAllString(b, -1), func(op byte, text string) {
+		if n := len(ops); n > 0 && ops[n-1].Op == string(op) {
+			ops[n-1].Text += text
+		} else {
+			ops = append(ops, diffOp{Op: string(op), Text: text})
+		}
+	})
+	return ops
+}
+
+// diffSeq diffs the token sequences x and y, calling add in order with '='
+// for each token in both, '-' for one only in x and '+' for one only in y.
+func diffSeq(x, y []string, add func(op byte, text string)) {
+	pre := 0
+	for pre < len(x) && pre < len(y) && x[pre] == y[pre] {
+		add('=', x[pre])
+		pre++
+	}
+	suf := 0
+	for suf < len(x)-pre && suf < len(y)-pre && x[len(x)-1-suf] == y[len(y)-1-suf] {
+		suf++
+	}
+	mx, my := x[pre:len(x)-suf], y[pre:len(y)-suf]
+	if (len(mx)+1)*(len(my)+1) > maxDiffCells {
+		for _, t := range mx {
+			add('-', t)
+		}
+		for _, t := range my {
+			add('+', t)
+		}
+	} else {
+		// lcs[i][j] is the longest common subsequence of mx[i:] and my[j:]
+		lcs := make([][]int32, len(mx)+1)
+		for i := range lcs {
+			lcs[i] = make([]int32, len(my)+1)
+		}
+		for i := len(mx) - 1; i >= 0; i-- {
+			for j := len(my) - 1; j >= 0; j-- {
+				if mx[i] == my[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(mx) || j < len(my) {
+			switch {
+			case i < len(mx) && j < len(my) && mx[i] == my[j]:
+				add('=', mx[i])
+				i++
+				j++
+			case i < len(mx) && (j == len(my) || lcs[i+1][j] >= lcs[i][j+1]):
+				add('-', mx[i])
+				i++
+			default:
+				add('+', my[j])
+				j++
+			}
+		}
+	}
+	for _, t := range x[len(x)-suf:] {
+		add('=', t)
+	}
+}
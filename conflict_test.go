@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWordDiff(t *testing.T) {
+	got := wordDiff("the quick brown fox\njumps", "the slow brown fox\njumps high")
+	want := []diffOp{
+		{"=", "the "}, {"-", "quick"}, {"+", "slow"}, {"=", " brown fox\njumps"}, {"+", " high"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("diff = %q", got)
+	}
+	if got := wordDiff("same", "same"); !reflect.DeepEqual(got, []diffOp{{"=", "same"}}) {
+		t.Fatalf("equal diff = %q", got)
+	}
+	if got := wordDiff("", "new"); !reflect.DeepEqual(got, []diffOp{{"+", "new"}}) {
+		t.Fatalf("insert diff = %q", got)
+	}
+}
+
+func TestHandleSave_IfMatchConflict(t *testing.T) {
+	chdirTemp(t)
+	locks = make(map[string]lockInfo)
+	writeFiles(t, map[string]string{"note.md": "one two three"})
+	tok := lockFile(t, "note.md")
+	etag := contentETag([]byte("one two three"))
+
+	save := func(ifMatch, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/save?file=note.md", strings.NewReader(body))
+		req.Header.Set("X-Lock", tok)
+		req.Header.Set("If-Match", ifMatch)
+		handleSave(rr, req)
+		return rr
+	}
+	rr := save(etag, "one 2 three")
+	if rr.Code != http.StatusNoContent || rr.Header().Get("ETag") != contentETag([]byte("one 2 three")) {
+		t.Fatalf("save = %d %q", rr.Code, rr.Header().Get("ETag"))
+	}
+
+	// The old ETag is now stale: the save is refused with a diff
+	rr = save(etag, "one two four")
+	if rr.Code != http.StatusPreconditionFailed {
+		t.Fatalf("stale save = %d", rr.Code)
+	}
+	var c saveConflict
+	if err := json.Unmarshal(rr.Body.Bytes(), &c); err != nil {
+		t.Fatal(err)
+	}
+	want := []diffOp{{"=", "one "}, {"-", "2"}, {"+", "two"}, {"=", " "}, {"-", "three"}, {"+", "four"}}
+	if c.ETag != contentETag([]byte("one 2 three")) || !reflect.DeepEqual(c.Diff, want) {
+		t.Fatalf("conflict = %+v", c)
+	}
+	if b, _ := os.ReadFile("note.md"); string(b) != "one 2 three" {
+		t.Fatalf("file overwritten: %q", b)
+	}
+	if _, err := os.Stat(recoveryDir); err != nil {
+		t.Fatalf("submission not stashed: %v", err)
+	}
+
+	if rr := save("*", "one two four"); rr.Code != http.StatusNoContent {
+		t.Fatalf("If-Match * = %d", rr.Code)
+	}
+}
+
+func TestHandleSave_XRevision(t *testing.T) {
+	chdirTemp(t)
+	locks = make(map[string]lockInfo)
+	writeFiles(t, map[string]string{"note.md": "first"})
+	tok := lockFile(t, "note.md")
+
+	rr := httptest.NewRecorder()
+	openLastMarkdown(rr, httptest.NewRequest(http.MethodGet, "/open?file=note.md", nil))
+	rev := rr.Header().Get("X-Revision")
+	if rev == "" || `"`+rev+`"` != rr.Header().Get("ETag") {
+		t.Fatalf("X-Revision = %q, ETag = %q", rev, rr.Header().Get("ETag"))
+	}
+
+	save := func(ifMatch, body string) int {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/save?file=note.md", strings.NewReader(body))
+		req.Header.Set("X-Lock", tok)
+		req.Header.Set("If-Match", ifMatch)
+		handleSave(rr, req)
+		return rr.Code
+	}
+	// A second tab saves with the revision both loaded; the first tab's
+	// save of the same revision is then stale
+	if code := save(rev, "second"); code != http.StatusNoContent {
+		t.Fatalf("save with X-Revision = %d", code)
+	}
+	if code := save(rev, "stale"); code != http.StatusPreconditionFailed {
+		t.Fatalf("stale save = %d", code)
+	}
+	if code := save(`W/"`+strings.Trim(contentETag([]byte("second")), `"`)+`"`, "third"); code != http.StatusNoContent {
+		t.Fatalf("weak ETag save = %d", code)
+	}
+}
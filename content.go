@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// contentEntry is a page as listed by GET /content: its slug and the same
+// metadata export writes to docs/<slug>.json.
+type contentEntry struct {
+	Slug string `json:"slug"`
+	pageMeta
+}
+
+// contentPage is one page from GET /content/<slug>.
+type contentPage struct {
+	contentEntry
+	FrontMatter map[string]string `json:"front_matter"`
+	Markdown    string            `json:"markdown"`
+	HTML        string            `json:"html,omitempty"` // needs cmark-gfm
+}
+
+// contentSlug is the slug of the note name: its page name without ".html".
+func contentSlug(name string) string {
+	return strings.TrimSuffix(htmlOutNameFor(name), ".html")
+}
+
+// publicNote reports whether md, the content of a note, may be served to
+// content consumers: it is not private, encrypted or password protected.
+func publicNote(md []byte) bool {
+	return !isEncryptedNote(md) && !notePrivate(md) && pagePassword(md) == ""
+}
+
+// serveContentJSON writes v as JSON with an ETag and Last-Modified, so
+// frontends can revalidate cheaply; http.ServeContent answers conditional
+// requests with 304.
+func serveContentJSON(w http.ResponseWriter, r *http.Request, v any, modTime time.Time) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("ETag", contentETag(b))
+	http.ServeContent(w, r, "", modTime, bytes.NewReader(b))
+}
+
+// handleContent serves the workspace as a headless CMS. GET /content lists
+// every published page, newest first; GET /content/<slug> returns one page
+// with its front matter, Markdown and rendered HTML. Private, encrypted and
+// password-protected notes are left out.
+func handleContent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	slug := strings.Trim(strings.TrimPrefix(r.URL.Path, "/content"), "/")
+	if slug == "" {
+		listContent(w, r)
+		return
+	}
+	name := noteForPage(slug + ".html")
+	if name == "" || strings.Contains(slug, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	info, err := os.Stat(wsPath(name))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	md, err := os.ReadFile(wsPath(name))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !publicNote(md) {
+		http.NotFound(w, r)
+		return
+	}
+	fields, body := parseFrontMatter(md)
+	if fields == nil {
+		fields = map[string]string{}
+	}
+	page := contentPage{
+		contentEntry: contentEntry{Slug: slug, pageMeta: buildPageMeta(name, htmlOutNameFor(name), md)},
+		FrontMatter:  fields,
+		Markdown:     string(body),
+	}
+	if cmarkPath != "" {
+		h, err := convertMarkdown(cmarkPath, body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		page.HTML = string(h)
+	}
+	serveContentJSON(w, r, page, info.ModTime())
+}
+
+func listContent(w http.ResponseWriter, r *http.Request) {
+	docs, err := docIndex.refresh(".")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	docs = publishedDocs(docs)
+	sort.SliceStable(docs, func(i, j int) bool { return docs[i].Updated.After(docs[j].Updated) })
+	entries := []contentEntry{}
+	var latest time.Time
+	for _, d := range docs {
+		md, err := os.ReadFile(wsPath(d.Name))
+		if err != nil || !publicNote(md) {
+			continue
+		}
+		entries = append(entries, contentEntry{Slug: contentSlug(d.Name), pageMeta: buildPageMeta(d.Name, htmlOutNameFor(d.Name), md)})
+		if d.ModTime.After(latest) {
+			latest = d.ModTime
+		}
+	}
+	serveContentJSON(w, r, entries, latest)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleContent(t *testing.T) {
+	chdirTemp(t)
+	cmarkPath = echoCmark(t)
+	t.Cleanup(func() { cmarkPath = "" })
+	writeFiles(t, map[string]string{
+		"README.md": "# Home\n",
+		"old.md":    "---\ntitle: Old\nupdated: 2020-01-01\n---\nOld post.\n",
+		"new.md":    "---\ntitle: New\nupdated: 2024-01-01\nlayout: post\n---\n<p>New post.</p>\n",
+		"hidden.md": "---\nprivate: true\n---\nHidden.\n",
+		"locked.md": "---\npassword: s3cret\n---\nLocked.\n",
+	})
+	get := func(p string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, p, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rr := httptest.NewRecorder()
+		handleContent(rr, req)
+		return rr
+	}
+
+	rr := get("/content")
+	var list []contentEntry
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("%v: %s", err, rr.Body.String())
+	}
+	var slugs []string
+	for _, e := range list {
+		slugs = append(slugs, e.Slug)
+	}
+	// README's date is its mtime, which is newest
+	if strings.Join(slugs, ",") != "index,new,old" {
+		t.Errorf("slugs = %v", slugs)
+	}
+	etag := rr.Header().Get("ETag")
+	if etag == "" || rr.Header().Get("Last-Modified") == "" {
+		t.Errorf("missing caching headers: %v", rr.Header())
+	}
+	if rr := get("/content", "If-None-Match", etag); rr.Code != http.StatusNotModified {
+		t.Errorf("revalidation: %d", rr.Code)
+	}
+
+	rr = get("/content/new")
+	var page contentPage
+	if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+		t.Fatalf("%v: %s", err, rr.Body.String())
+	}
+	if page.Slug != "new" || page.Title != "New" || page.FrontMatter["layout"] != "post" ||
+		page.Markdown != "<p>New post.</p>\n" || !strings.Contains(page.HTML, "<p>New post.</p>") {
+		t.Errorf("page = %+v", page)
+	}
+	for _, p := range []string{"/content/hidden", "/content/locked", "/content/missing", "/content/a/b"} {
+		if rr := get(p); rr.Code != http.StatusNotFound {
+			t.Errorf("%s: %d, want 404", p, rr.Code)
+		}
+	}
+}
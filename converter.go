@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// inputPlaceholder in a converter command stands for a file holding the
+// Markdown; commands without it read the Markdown on stdin.
+const inputPlaceholder = "{input}"
+
+// converterFlag is the -converter command, which overrides converter in
+// minimark.json.
+var converterFlag string
+
+// converterTemplate returns the configured converter command, if any.
+func converterTemplate() string {
+	if converterFlag != "" {
+		return converterFlag
+	}
+	return config.Converter
+}
+
+// splitCommand splits a command line into arguments the way a shell would
+// for simple cases: on unquoted whitespace, with '...' and "..." quoting and
+// backslash escapes outside single quotes.
+func splitCommand(s string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	inArg := false
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				cur.WriteByte(c)
+			}
+		case c == '\\' && i+1 < len(s) && (quote == 0 || strings.IndexByte(`"\$`+"`", s[i+1]) >= 0):
+			cur.WriteByte(s[i+1])
+			i++
+			inArg = true
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else {
+				cur.WriteByte(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteByte(c)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
+
+func validateConverter(tmpl string) error {
+	if tmpl == "" {
+		return nil
+	}
+	args, err := splitCommand(tmpl)
+	if err == nil && len(args) == 0 {
+		err = fmt.Errorf("no command")
+	}
+	if err != nil {
+		return fmt.Errorf("converter %q: %w", tmpl, err)
+	}
+	return nil
+}
+
+// checkConverter validates the converter in effect once minimark.json is
+// loaded, from -converter or the config: the command must parse and its
+// program must exist, as a file in the workspace or on PATH.
+func checkConverter() error {
+	tmpl := converterTemplate()
+	if tmpl == "" {
+		return nil
+	}
+	if err := validateConverter(tmpl); err != nil {
+		return err
+	}
+	prog := tmpl
+	if info, err := os.Stat(wsPath(tmpl)); err != nil || info.IsDir() {
+		args, _ := splitCommand(tmpl)
+		prog = args[0]
+		if !strings.ContainsAny(prog, "/"+string(filepath.Separator)) {
+			if _, err := exec.LookPath(prog); err != nil {
+				return fmt.Errorf("converter %q: %s not found on PATH", tmpl, prog)
+			}
+			return nil
+		}
+	}
+	if info, err := os.Stat(wsPath(prog)); err != nil || info.IsDir() || info.Mode()&0111 == 0 {
+		return fmt.Errorf("converter %q: %s is not an executable file", tmpl, prog)
+	}
+	return nil
+}
+
+// converterProgram returns the program cmark runs, for cache keys: cmark
+// itself when it names a file, else the first word of the command.
+func converterProgram(cmark string) string {
+	if info, err := os.Stat(wsPath(cmark)); err == nil && !info.IsDir() {
+		return cmark
+	}
+	if args, err := splitCommand(cmark); err == nil && len(args) > 0 {
+		if path, err := exec.LookPath(args[0]); err == nil {
+			return path
+		}
+	}
+	return cmark
+}
+
+// runConverter converts md with cmark, which is either the path of a
+// program that reads Markdown on stdin, such as cmark-gfm, or a command
+// template like "pandoc -f gfm -t html5 {input}". Anything the converter
+// writes to stderr is logged, and included in the error when it fails.
+func runConverter(cmark string, md []byte) ([]byte, error) {
+	var cmd *exec.Cmd
+	if info, err := os.Stat(wsPath(cmark)); err == nil && !info.IsDir() {
+		cmd = workspaceCommand(cmark, converterArgs()...)
+		cmd.Stdin = bytes.NewReader(md)
+	} else {
+		args, err := splitCommand(cmark)
+		if err != nil {
+			return nil, err
+		}
+		if len(args) == 0 {
+			return nil, fmt.Errorf("empty converter command")
+		}
+		if strings.Contains(cmark, inputPlaceholder) {
+			f, err := os.CreateTemp("", "minimark-*.md")
+			if err != nil {
+				return nil, err
+			}
+			defer os.Remove(f.Name())
+			_, err = f.Write(md)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return nil, err
+			}
+			for i, a := range args {
+				args[i] = strings.ReplaceAll(a, inputPlaceholder, f.Name())
+			}
+		}
+		cmd = workspaceCommand(args[0], args[1:]...)
+		if !strings.Contains(cmark, inputPlaceholder) {
+			cmd.Stdin = bytes.NewReader(md)
+		}
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	body, err := cmd.Output()
+	msg := strings.TrimSpace(stderr.String())
+	if err != nil {
+		if msg != "" {
+			return nil, fmt.Errorf("%s: %w: %s", cmd.Args[0], err, msg)
+		}
+		return nil, fmt.Errorf("%s: %w", cmd.Args[0], err)
+	}
+	if msg != "" {
+		log.Printf("%s: %s", cmd.Args[0], msg)
+	}
+	return body, nil
+}
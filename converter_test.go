@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSplitCommand(t *testing.T) {
+	cases := map[string][]string{
+		"pandoc -f gfm -t html5 {input}":  {"pandoc", "-f", "gfm", "-t", "html5", "{input}"},
+		`  conv  'a b' "c \"d\"" e\ f  `:  {"conv", "a b", `c "d"`, "e f"},
+		`conv 'open`:                      nil,
+		`conv --meta='a "b"' "\n" --x=""`: {"conv", `--meta=a "b"`, `\n`, "--x="},
+	}
+	for in, want := range cases {
+		got, err := splitCommand(in)
+		if want == nil {
+			if err == nil {
+				t.Errorf("splitCommand(%q) = %q, want error", in, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("splitCommand(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if got, _ := splitCommand(`c '' ""`); !reflect.DeepEqual(got, []string{"c", "", ""}) {
+		t.Errorf("empty quoted args = %q", got)
+	}
+	for _, bad := range []string{"   ", `pandoc "x`} {
+		if err := validateConverter(bad); err == nil {
+			t.Errorf("validateConverter(%q) accepted", bad)
+		}
+	}
+}
+
+func TestRunConverter(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows")
+	}
+	dir := t.TempDir()
+	conv := filepath.Join(dir, "conv")
+	script := "#!/bin/sh\necho \"warning: $1\" >&2\nif [ -n \"$2\" ]; then exec sed 's/^/<p>/' \"$2\"; fi\nexec sed 's/^/<q>/'\n"
+	if err := os.WriteFile(conv, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	out, err := runConverter(conv+" 'from gfm' {input}", []byte("hi\n"))
+	if err != nil || string(out) != "<p>hi\n" {
+		t.Fatalf("with {input}: %q, %v", out, err)
+	}
+	if !strings.Contains(logged.String(), "warning: from gfm") {
+		t.Errorf("stderr not logged: %q", logged.String())
+	}
+	out, err = runConverter(conv+" stdin", []byte("hi\n"))
+	if err != nil || string(out) != "<q>hi\n" {
+		t.Fatalf("on stdin: %q, %v", out, err)
+	}
+
+	fail := filepath.Join(dir, "fail")
+	if err := os.WriteFile(fail, []byte("#!/bin/sh\necho 'bad input' >&2\nexit 3\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runConverter(fail+" {input}", []byte("x")); err == nil || !strings.Contains(err.Error(), "bad input") {
+		t.Errorf("failure error = %v", err)
+	}
+	if _, err := runConverter("minimark-no-such-converter {input}", []byte("x")); err == nil {
+		t.Error("missing converter accepted")
+	}
+}
+
+func TestFindConverter_Template(t *testing.T) {
+	t.Cleanup(func() { converterFlag, config.Converter = "", "" })
+	config.Converter = "pandoc {input}"
+	if got := findConverter(); got != "pandoc {input}" {
+		t.Errorf("config converter = %q", got)
+	}
+	converterFlag = "other"
+	if got := findConverter(); got != "other" {
+		t.Errorf("flag converter = %q", got)
+	}
+}
+
+func TestCheckConverter(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows")
+	}
+	chdirTemp(t)
+	t.Cleanup(func() { converterFlag, config.Converter = "", "" })
+	writeFiles(t, map[string]string{"notes.txt": "x"})
+	if err := os.WriteFile("conv", []byte("#!/bin/sh\ncat\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, ok := range []string{"", "conv", "./conv {input}", "sh -c cat"} {
+		config.Converter = ok
+		if err := checkConverter(); err != nil {
+			t.Errorf("%q: %v", ok, err)
+		}
+	}
+	// The config is checked too, not only -converter
+	for _, bad := range []string{"no-such-converter-xyz {input}", "./notes.txt", "./missing", `pandoc "x`} {
+		config.Converter = bad
+		if err := checkConverter(); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+	config.Converter = "no-such-converter-xyz"
+	converterFlag = "conv"
+	if err := checkConverter(); err != nil {
+		t.Errorf("flag overrides config: %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Export CSP modes (export_csp in minimark.json).
+const (
+	cspMeta    = "meta"    // a <meta http-equiv> tag in every page
+	cspHeaders = "headers" // a docs/_headers file for Netlify/Cloudflare Pages
+)
+
+// headersFile is the per-path headers file understood by Netlify and
+// Cloudflare Pages.
+const headersFile = "_headers"
+
+var (
+	scriptTagRe = regexp.MustCompile(`(?is)<script\b([^>]*)>(.*?)</script>`)
+	styleTagRe  = regexp.MustCompile(`(?is)<style\b[^>]*>(.*?)</style>`)
+	linkTagRe   = regexp.MustCompile(`(?i)<link\b([^>]*)>`)
+	mediaTagRe  = regexp.MustCompile(`(?i)<(img|iframe|video|audio|source)\b([^>]*)>`)
+	styleAttrRe = regexp.MustCompile(`(?i)<[a-z][^>]*\sstyle\s*=`)
+	tagAttrRe   = regexp.MustCompile(`(?i)\s([a-z-]+)\s*=\s*("[^"]*"|'[^']*'|[^\s>]+)`)
+	headOpenRe  = regexp.MustCompile(`(?i)<head\b[^>]*>`)
+)
+
+// cspExtras lists what some widgets need beyond their script's origin.
+var cspExtras = map[string]map[string][]string{
+	"https://www.googletagmanager.com": {
+		"connect-src": {"https://*.google-analytics.com", "https://*.analytics.google.com"},
+		"img-src":     {"https://*.google-analytics.com"},
+	},
+}
+
+func tagAttrs(s string) map[string]string {
+	attrs := map[string]string{}
+	for _, m := range tagAttrRe.FindAllStringSubmatch(s, -1) {
+		attrs[strings.ToLower(m[1])] = html.UnescapeString(strings.Trim(m[2], `"'`))
+	}
+	return attrs
+}
+
+// assetOrigin returns the origin of an absolute or protocol-relative URL,
+// or "" for a same-origin reference.
+func assetOrigin(ref string) string {
+	if strings.HasPrefix(ref, "//") {
+		ref = "https:" + ref
+	}
+	u, err := url.Parse(ref)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// pageCSP computes a Content-Security-Policy allowing exactly what page
+// references: its external origins and hashes of its inline scripts and
+// style blocks. Origins of external scripts may also be framed and
+// contacted, since comment and analytics widgets talk back to them.
+func pageCSP(page []byte) string {
+	src := map[string]map[string]bool{}
+	add := func(dir, v string) {
+		if v == "" {
+			return
+		}
+		if src[dir] == nil {
+			src[dir] = map[string]bool{}
+		}
+		src[dir][v] = true
+	}
+	hash := func(b []byte) string {
+		sum := sha256.Sum256(b)
+		return "'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'"
+	}
+	for _, m := range scriptTagRe.FindAllSubmatch(page, -1) {
+		attrs := tagAttrs(string(m[1]))
+		if s, ok := attrs["src"]; ok {
+			o := assetOrigin(s)
+			add("script-src", o)
+			add("connect-src", o)
+			add("frame-src", o)
+			for dir, vals := range cspExtras[o] {
+				for _, v := range vals {
+					add(dir, v)
+				}
+			}
+			add("connect-src", assetOrigin(attrs["data-goatcounter"]))
+		} else if len(bytes.TrimSpace(m[2])) > 0 {
+			add("script-src", hash(m[2]))
+		}
+	}
+	for _, m := range styleTagRe.FindAllSubmatch(page, -1) {
+		add("style-src", hash(m[1]))
+	}
+	if styleAttrRe.Match(page) {
+		add("style-src", "'unsafe-inline'")
+	}
+	for _, m := range linkTagRe.FindAllSubmatch(page, -1) {
+		attrs := tagAttrs(string(m[1]))
+		o := assetOrigin(attrs["href"])
+		switch rel := strings.ToLower(attrs["rel"]); {
+		case strings.Contains(rel, "stylesheet"):
+			add("style-src", o)
+			add("font-src", o)
+		case strings.Contains(rel, "icon"):
+			add("img-src", o)
+		}
+	}
+	for _, m := range mediaTagRe.FindAllSubmatch(page, -1) {
+		dir := "img-src"
+		switch strings.ToLower(string(m[1])) {
+		case "iframe":
+			dir = "frame-src"
+		case "video", "audio", "source":
+			dir = "media-src"
+		}
+		add(dir, assetOrigin(tagAttrs(string(m[2]))["src"]))
+	}
+
+	// 'unsafe-inline' is ignored by browsers once a hash is present
+	if src["style-src"]["'unsafe-inline'"] {
+		for v := range src["style-src"] {
+			if strings.HasPrefix(v, "'sha256-") {
+				delete(src["style-src"], v)
+			}
+		}
+	}
+	parts := []string{"default-src 'self'"}
+	for _, dir := range []string{"script-src", "style-src", "img-src", "font-src", "media-src", "connect-src", "frame-src"} {
+		vals := []string{"'self'"}
+		if dir == "img-src" {
+			vals = append(vals, "data:")
+		}
+		extra := make([]string, 0, len(src[dir]))
+		for v := range src[dir] {
+			extra = append(extra, v)
+		}
+		if len(extra) == 0 && dir != "img-src" {
+			continue
+		}
+		sort.Strings(extra)
+		parts = append(parts, dir+" "+strings.Join(append(vals, extra...), " "))
+	}
+	parts = append(parts, "object-src 'none'", "base-uri 'self'")
+	return strings.Join(parts, "; ")
+}
+
+// applyExportCSP adds a CSP meta tag to page right after <head> (or at the
+// start) when export_csp is "meta".
+func applyExportCSP(page []byte) []byte {
+	if config.ExportCSP != cspMeta {
+		return page
+	}
+	tag := fmt.Sprintf("\n<meta http-equiv=\"Content-Security-Policy\" content=\"%s\">\n", html.EscapeString(pageCSP(page)))
+	if loc := headOpenRe.FindIndex(page); loc != nil {
+		out := make([]byte, 0, len(page)+len(tag))
+		out = append(append(append(out, page[:loc[1]]...), tag...), page[loc[1]:]...)
+		return out
+	}
+	return append([]byte(strings.TrimPrefix(tag, "\n")), page...)
+}
+
+// writeCSPHeaders writes docsDir/_headers with a CSP for every exported page
+// when export_csp is "headers". A _headers file in _includes wins.
+func writeCSPHeaders(docsDir string) {
+	if config.ExportCSP != cspHeaders {
+		return
+	}
+	if _, err := os.Stat(wsPath(filepath.Join("_includes", headersFile))); err == nil {
+		return
+	}
+	var b strings.Builder
+	err := walkWorkspace(docsDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.EqualFold(filepath.Ext(p), ".html") {
+			return err
+		}
+		page, err := os.ReadFile(wsPath(p))
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(docsDir, p)
+		rel = "/" + filepath.ToSlash(rel)
+		// Hosts also serve pages without the extension ("pretty URLs")
+		pretty := strings.TrimSuffix(rel, filepath.Ext(rel))
+		if path.Base(pretty) == "index" {
+			pretty = strings.TrimSuffix(pretty, "index")
+		}
+		csp := pageCSP(page)
+		for _, u := range []string{rel, pretty} {
+			fmt.Fprintf(&b, "%s\n  Content-Security-Policy: %s\n\n", u, csp)
+		}
+		return nil
+	})
+	if err == nil {
+		err = os.WriteFile(wsPath(filepath.Join(docsDir, headersFile)), []byte(b.String()), 0644)
+	}
+	if err != nil {
+		log.Printf("%s not written: %v", headersFile, err)
+	}
+}
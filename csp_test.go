@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPageCSP(t *testing.T) {
+	page := `<html><head>
+<link rel="stylesheet" href="neat.css">
+<link rel="stylesheet" href="https://cdn.example.com/x.css">
+<link rel="icon" href="//img.example.com/i.png">
+<script src="theme.js"></script>
+<script defer data-domain="d" src="https://plausible.io/js/script.js"></script>
+<script>gtag()</script>
+</head><body>
+<img src="https://img.example.com/a.png"><img src="local.png">
+<div class="video"><iframe src="https://www.youtube-nocookie.com/embed/x"></iframe></div>
+<pre><code>&lt;script src="https://evil.example/x.js"&gt;&lt;/script&gt;</code></pre>
+</body></html>`
+	want := "default-src 'self'; " +
+		"script-src 'self' 'sha256-okMPrDphyHONjglaAuDcRYdC8g3p5nZ7H/5C+fnFtMg=' https://plausible.io; " + // sha256 of gtag()
+		"style-src 'self' https://cdn.example.com; " +
+		"img-src 'self' data: https://img.example.com; " +
+		"font-src 'self' https://cdn.example.com; " +
+		"connect-src 'self' https://plausible.io; " +
+		"frame-src 'self' https://plausible.io https://www.youtube-nocookie.com; " +
+		"object-src 'none'; base-uri 'self'"
+	if got := pageCSP([]byte(page)); got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+
+	// Inline style attributes (e.g. from SVG diagrams) need 'unsafe-inline'
+	got := pageCSP([]byte(`<style>p{}</style><svg style="width:1px"></svg>`))
+	if !strings.Contains(got, "style-src 'self' 'unsafe-inline';") {
+		t.Fatalf("got %s", got)
+	}
+}
+
+func TestApplyExportCSP(t *testing.T) {
+	page := []byte("<html><head><title>x</title></head><body></body></html>")
+	if got := applyExportCSP(page); string(got) != string(page) {
+		t.Fatalf("off: %s", got)
+	}
+	withConfig(t, siteConfig{ExportCSP: cspMeta})
+	got := string(applyExportCSP(page))
+	if !strings.HasPrefix(got, "<html><head>\n<meta http-equiv=\"Content-Security-Policy\" content=\"default-src &#39;self&#39;; img-src") {
+		t.Fatalf("got %s", got)
+	}
+}
+
+func TestWriteCSPHeaders(t *testing.T) {
+	chdirTemp(t)
+	withConfig(t, siteConfig{ExportCSP: cspHeaders})
+	if err := os.MkdirAll(filepath.Join("docs", readerDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, map[string]string{
+		filepath.Join("docs", "index.html"):           "<p>x</p>",
+		filepath.Join("docs", "note.html"):            `<img src="https://img.example.com/a.png">`,
+		filepath.Join("docs", readerDir, "note.html"): "<style>p{}</style>",
+		filepath.Join("docs", "neat.css"):             "p{}",
+	})
+	writeCSPHeaders("docs")
+	b, err := os.ReadFile(filepath.Join("docs", headersFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(b)
+	for _, want := range []string{
+		"/index.html\n  Content-Security-Policy: default-src 'self'; img-src 'self' data:; object-src 'none'; base-uri 'self'\n",
+		"/\n  Content-Security-Policy:",
+		"/note\n  Content-Security-Policy: default-src 'self'; img-src 'self' data: https://img.example.com;",
+		"/reader/note.html\n  Content-Security-Policy: default-src 'self'; style-src 'self' 'sha256-",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "neat.css") {
+		t.Errorf("non-HTML file listed:\n%s", got)
+	}
+}
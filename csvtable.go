@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"html"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// embedCSV replaces paragraphs that only link to a local .csv file with the
+// file's contents as a table.
+var embedCSV bool
+
+var (
+	csvFenceRe = regexp.MustCompile(`(?s)<pre><code class="language-csv">(.*?)</code></pre>`)
+	csvLinkRe  = regexp.MustCompile(`<p>\s*<a href="([^"]+\.csv)"[^>]*>[^<]*</a>\s*</p>`)
+)
+
+// csvTables renders ```csv fences, and with embedCSV linked .csv files, as
+// HTML tables. The first row is the header. Blocks that fail to parse are
+// left as they are.
+func csvTables(body []byte) []byte {
+	body = csvFenceRe.ReplaceAllFunc(body, func(m []byte) []byte {
+		src := html.UnescapeString(string(csvFenceRe.FindSubmatch(m)[1]))
+		if t, ok := csvToTable(src); ok {
+			return t
+		}
+		return m
+	})
+	if !embedCSV {
+		return body
+	}
+	return csvLinkRe.ReplaceAllFunc(body, func(m []byte) []byte {
+		href := html.UnescapeString(string(csvLinkRe.FindSubmatch(m)[1]))
+		if isRemoteAsset(href) || !insideWorkspace(href) {
+			return m
+		}
+		b, err := os.ReadFile(wsPath(filepath.FromSlash(path.Clean(href))))
+		if err != nil {
+			return m
+		}
+		if t, ok := csvToTable(string(b)); ok {
+			return t
+		}
+		return m
+	})
+}
+
+// csvToTable parses CSV text into an HTML table.
+func csvToTable(src string) ([]byte, bool) {
+	r := csv.NewReader(strings.NewReader(src))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	rows, err := r.ReadAll()
+	if err != nil || len(rows) == 0 {
+		return nil, false
+	}
+	var b bytes.Buffer
+	b.WriteString("<table>\n<thead>\n<tr>\n")
+	for _, cell := range rows[0] {
+		b.WriteString("<th>" + html.EscapeString(cell) + "</th>\n")
+	}
+	b.WriteString("</tr>\n</thead>\n")
+	if len(rows) > 1 {
+		b.WriteString("<tbody>\n")
+		for _, row := range rows[1:] {
+			b.WriteString("<tr>\n")
+			for _, cell := range row {
+				b.WriteString("<td>" + html.EscapeString(cell) + "</td>\n")
+			}
+			b.WriteString("</tr>\n")
+		}
+		b.WriteString("</tbody>\n")
+	}
+	b.WriteString("</table>\n")
+	return b.Bytes(), true
+}
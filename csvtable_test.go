@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCSVTables_Fence(t *testing.T) {
+	in := "<p>x</p>\n<pre><code class=\"language-csv\">name, qty\n&quot;Nuts, salted&quot;,3\n&lt;b&gt;,4\n</code></pre>\n"
+	got := string(csvTables([]byte(in)))
+	for _, want := range []string{"<th>name</th>", "<th>qty</th>", "<td>Nuts, salted</td>", "<td>&lt;b&gt;</td>", "<p>x</p>"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in %s", want, got)
+		}
+	}
+	if strings.Contains(got, "<pre>") {
+		t.Errorf("fence not replaced: %s", got)
+	}
+
+	// Unparseable CSV stays a code block
+	bad := "<pre><code class=\"language-csv\">a,&quot;b\n</code></pre>"
+	if got := string(csvTables([]byte(bad))); got != bad {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestCSVTables_LinkedFile(t *testing.T) {
+	chdirTemp(t)
+	writeFiles(t, map[string]string{"data.csv": "a,b\n1,2\n"})
+	in := `<p><a href="data.csv">data</a></p><p><a href="missing.csv">m</a></p><p><a href="../x.csv">x</a></p>`
+	if got := string(csvTables([]byte(in))); got != in {
+		t.Fatalf("linked files need -embed-csv: %s", got)
+	}
+	embedCSV = true
+	t.Cleanup(func() { embedCSV = false })
+	got := string(csvTables([]byte(in)))
+	if !strings.Contains(got, "<td>1</td>") || strings.Contains(got, `href="data.csv"`) {
+		t.Fatalf("data.csv not embedded: %s", got)
+	}
+	if !strings.Contains(got, `href="missing.csv"`) || !strings.Contains(got, `href="../x.csv"`) {
+		t.Fatalf("missing or outside files should stay links: %s", got)
+	}
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// dataDir holds the site's data files: YAML or JSON that layouts and pages
+// read with {{data path}}. _data/team.yml is "team" and _data/shop/plans.json
+// is "shop.plans"; keys and list indexes follow, as in "team.0.name".
+const dataDir = "_data"
+
+// dataHookRe matches {{data path}} in headers, footers and partials.
+var dataHookRe = regexp.MustCompile(`\{\{data\s+([A-Za-z0-9_.-]+)\s*\}\}`)
+
+// dataMap is a mapping from a data file, keeping its keys in file order so
+// tables and lists render in the order they were written. Values are
+// strings, []any or *dataMap.
+type dataMap struct {
+	keys   []string
+	values map[string]any
+}
+
+func newDataMap() *dataMap {
+	return &dataMap{values: map[string]any{}}
+}
+
+func (m *dataMap) set(key string, v any) {
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = v
+}
+
+// loadSiteData reads every .yml, .yaml and .json file below dir into one
+// tree keyed by path. Files that fail to parse are logged and skipped.
+func loadSiteData(dir string) *dataMap {
+	root := newDataMap()
+	_ = walkWorkspace(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		ext := strings.ToLower(filepath.Ext(p))
+		if ext != ".yml" && ext != ".yaml" && ext != ".json" {
+			return nil
+		}
+		b, err := os.ReadFile(wsPath(p))
+		if err != nil {
+			log.Printf("data file %s: %v", p, err)
+			return nil
+		}
+		var v any
+		if ext == ".json" {
+			v, err = parseJSONData(b)
+		} else {
+			v, err = parseYAMLData(b)
+		}
+		if err != nil {
+			log.Printf("data file %s: %v", p, err)
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, p)
+		parts := strings.Split(filepath.ToSlash(strings.TrimSuffix(rel, filepath.Ext(rel))), "/")
+		m := root
+		for _, part := range parts[:len(parts)-1] {
+			sub, ok := m.values[part].(*dataMap)
+			if !ok {
+				sub = newDataMap()
+				m.set(part, sub)
+			}
+			m = sub
+		}
+		m.set(parts[len(parts)-1], v)
+		return nil
+	})
+	return root
+}
+
+// lookupData follows the dot-separated path through v.
+func lookupData(v any, path string) (any, bool) {
+	for _, seg := range strings.Split(path, ".") {
+		switch n := v.(type) {
+		case *dataMap:
+			next, ok := n.values[seg]
+			if !ok {
+				return nil, false
+			}
+			v = next
+		case []any:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(n) {
+				return nil, false
+			}
+			v = n[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// renderData renders a data value as HTML: text for a scalar, a list for a
+// list of scalars, a table for a list of mappings (one column per key), and
+// a definition list for a mapping.
+func renderData(v any) string {
+	switch n := v.(type) {
+	case string:
+		return html.EscapeString(n)
+	case *dataMap:
+		var b strings.Builder
+		b.WriteString(`<dl class="data">` + "\n")
+		for _, k := range n.keys {
+			fmt.Fprintf(&b, "<dt>%s</dt><dd>%s</dd>\n", html.EscapeString(k), renderData(n.values[k]))
+		}
+		b.WriteString("</dl>\n")
+		return b.String()
+	case []any:
+		var cols []string
+		seen := map[string]bool{}
+		for _, item := range n {
+			m, ok := item.(*dataMap)
+			if !ok {
+				cols = nil
+				break
+			}
+			for _, k := range m.keys {
+				if !seen[k] {
+					seen[k] = true
+					cols = append(cols, k)
+				}
+			}
+		}
+		var b strings.Builder
+		if cols == nil {
+			b.WriteString(`<ul class="data">` + "\n")
+			for _, item := range n {
+				fmt.Fprintf(&b, "<li>%s</li>\n", renderData(item))
+			}
+			b.WriteString("</ul>\n")
+			return b.String()
+		}
+		b.WriteString(`<table class="data">` + "\n<thead>\n<tr>")
+		for _, c := range cols {
+			fmt.Fprintf(&b, "<th>%s</th>", html.EscapeString(c))
+		}
+		b.WriteString("</tr>\n</thead>\n<tbody>\n")
+		for _, item := range n {
+			b.WriteString("<tr>")
+			for _, c := range cols {
+				cell := ""
+				if v, ok := item.(*dataMap).values[c]; ok {
+					cell = renderData(v)
+				}
+				fmt.Fprintf(&b, "<td>%s</td>", cell)
+			}
+			b.WriteString("</tr>\n")
+		}
+		b.WriteString("</tbody>\n</table>\n")
+		return b.String()
+	}
+	return ""
+}
+
+// applyData expands {{data path}} in a page's header and footer. Unknown
+// paths are logged and expand to nothing.
+func applyData(header, footer []byte) ([]byte, []byte) {
+	if !bytes.Contains(header, []byte("{{data")) && !bytes.Contains(footer, []byte("{{data")) {
+		return header, footer
+	}
+	site := loadSiteData(dataDir)
+	expand := func(b []byte) []byte {
+		return dataHookRe.ReplaceAllFunc(b, func(m []byte) []byte {
+			path := string(dataHookRe.FindSubmatch(m)[1])
+			v, ok := lookupData(site, path)
+			if !ok {
+				log.Printf("data %q not found", path)
+				return nil
+			}
+			return []byte(renderData(v))
+		})
+	}
+	return expand(header), expand(footer)
+}
+
+// dataShortcode inserts site data into a page:
+//
+//	{{data pricing.plans}}
+func dataShortcode(a shortcodeArgs) (string, string, error) {
+	path := a.named["path"]
+	if path == "" && len(a.positional) > 0 {
+		path = a.positional[0]
+	}
+	if path == "" {
+		return "", "", errors.New("missing path")
+	}
+	v, ok := lookupData(loadSiteData(dataDir), path)
+	if !ok {
+		return "", "", fmt.Errorf("%s not found", path)
+	}
+	return "", renderData(v), nil
+}
+
+// parseJSONData decodes a JSON document into data values, keeping object
+// keys in order. Numbers and booleans become their text; null becomes "".
+func parseJSONData(b []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	v, err := decodeJSONValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("unexpected data after JSON value")
+	}
+	return v, nil
+}
+
+func decodeJSONValue(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		if t == '[' {
+			list := []any{}
+			for dec.More() {
+				v, err := decodeJSONValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, v)
+			}
+			_, err := dec.Token()
+			return list, err
+		}
+		m := newDataMap()
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := decodeJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			m.set(key.(string), v)
+		}
+		_, err := dec.Token()
+		return m, err
+	case string:
+		return t, nil
+	case json.Number:
+		return t.String(), nil
+	case bool:
+		return strconv.FormatBool(t), nil
+	}
+	return "", nil
+}
+
+// yamlLine is a significant line of a YAML data file.
+type yamlLine struct {
+	indent int
+	text   string
+}
+
+// parseYAMLData parses the block-style YAML used for data files: nested
+// mappings and "- item" lists, scalars, and inline [a, b] lists. Anchors,
+// multi-line strings and flow mappings are not supported.
+func parseYAMLData(b []byte) (any, error) {
+	var lines []yamlLine
+	for _, raw := range strings.Split(string(b), "\n") {
+		raw = strings.TrimRight(raw, " \t\r")
+		text := strings.TrimLeft(raw, " ")
+		if text == "" || text == "---" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if strings.HasPrefix(text, "\t") {
+			return nil, errors.New("tabs are not allowed for indentation")
+		}
+		lines = append(lines, yamlLine{len(raw) - len(text), stripYAMLComment(text)})
+	}
+	if len(lines) == 0 {
+		return newDataMap(), nil
+	}
+	v, next := parseYAMLBlock(lines, 0)
+	if next < len(lines) {
+		return nil, fmt.Errorf("unexpected indentation at %q", lines[next].text)
+	}
+	return v, nil
+}
+
+// stripYAMLComment drops a trailing " # comment" outside quotes.
+func stripYAMLComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && i > 0 && s[i-1] == ' ':
+			return strings.TrimRight(s[:i], " ")
+		}
+	}
+	return s
+}
+
+// yamlKey splits "key: value" or "key:"; ok is false for a plain scalar.
+func yamlKey(s string) (key, value string, ok bool) {
+	if strings.HasPrefix(s, `"`) || strings.HasPrefix(s, "'") {
+		if end := strings.IndexByte(s[1:], s[0]); end >= 0 {
+			rest := s[end+2:]
+			if rest == ":" || strings.HasPrefix(rest, ": ") {
+				return s[1 : end+1], strings.TrimSpace(rest[1:]), true
+			}
+		}
+		return "", "", false
+	}
+	if i := strings.Index(s, ": "); i > 0 {
+		return s[:i], strings.TrimSpace(s[i+2:]), true
+	}
+	if strings.HasSuffix(s, ":") && len(s) > 1 {
+		return s[:len(s)-1], "", true
+	}
+	return "", "", false
+}
+
+func yamlScalar(s string) any {
+	if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+		list := []any{}
+		for _, item := range frontMatterList(s) {
+			list = append(list, item)
+		}
+		return list
+	}
+	return unquote(s)
+}
+
+func isYAMLItem(s string) bool {
+	return s == "-" || strings.HasPrefix(s, "- ")
+}
+
+// parseYAMLBlock parses the block starting at lines[i], returning its value
+// and the index of the first line after it.
+func parseYAMLBlock(lines []yamlLine, i int) (any, int) {
+	indent := lines[i].indent
+	if isYAMLItem(lines[i].text) {
+		list := []any{}
+		for i < len(lines) && lines[i].indent == indent && isYAMLItem(lines[i].text) {
+			item := strings.TrimSpace(strings.TrimPrefix(lines[i].text, "-"))
+			if item == "" {
+				if i+1 < len(lines) && lines[i+1].indent > indent {
+					var v any
+					v, i = parseYAMLBlock(lines, i+1)
+					list = append(list, v)
+				} else {
+					list = append(list, "")
+					i++
+				}
+				continue
+			}
+			if _, _, ok := yamlKey(item); ok {
+				// "- key: value" starts a mapping indented past the dash
+				lines[i] = yamlLine{indent + len(lines[i].text) - len(item), item}
+				var v any
+				v, i = parseYAMLBlock(lines, i)
+				list = append(list, v)
+				continue
+			}
+			list = append(list, yamlScalar(item))
+			i++
+		}
+		return list, i
+	}
+	m := newDataMap()
+	for i < len(lines) && lines[i].indent == indent {
+		key, value, ok := yamlKey(lines[i].text)
+		if !ok {
+			break
+		}
+		i++
+		if value != "" {
+			m.set(key, yamlScalar(value))
+			continue
+		}
+		// A nested block, which for lists may sit at the key's own indent
+		if i < len(lines) && (lines[i].indent > indent || lines[i].indent == indent && isYAMLItem(lines[i].text)) {
+			var v any
+			v, i = parseYAMLBlock(lines, i)
+			m.set(key, v)
+			continue
+		}
+		m.set(key, "")
+	}
+	return m, i
+}
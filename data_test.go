@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const teamYAML = `# Team members
+title: "Our team"
+members:
+- name: Ada
+  role: Engineer # founder
+- name: Grace
+  role: Admiral
+  tags: [navy, cobol]
+offices:
+  - Paris
+  - "Tokyo"
+contact:
+  email: hi@example.com
+`
+
+func TestParseYAMLData(t *testing.T) {
+	v, err := parseYAMLData([]byte(teamYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]string{
+		"title":            "Our team",
+		"members.0.name":   "Ada",
+		"members.0.role":   "Engineer",
+		"members.1.tags.1": "cobol",
+		"offices.1":        "Tokyo",
+		"contact.email":    "hi@example.com",
+	} {
+		got, ok := lookupData(v, path)
+		if !ok || got != want {
+			t.Errorf("%s = %v, %v; want %q", path, got, ok, want)
+		}
+	}
+	if m := v.(*dataMap); strings.Join(m.keys, ",") != "title,members,offices,contact" {
+		t.Errorf("keys out of order: %v", m.keys)
+	}
+	if _, err := parseYAMLData([]byte("a: 1\n    b: 2\n")); err == nil {
+		t.Error("expected error for stray indentation")
+	}
+}
+
+func TestParseJSONData(t *testing.T) {
+	v, err := parseJSONData([]byte(`{"plans": [{"name": "Free", "price": 0, "popular": false}, {"name": "Pro", "price": 9.5, "note": null}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := renderData(mustLookup(t, v, "plans"))
+	want := `<table class="data">
+<thead>
+<tr><th>name</th><th>price</th><th>popular</th><th>note</th></tr>
+</thead>
+<tbody>
+<tr><td>Free</td><td>0</td><td>false</td><td></td></tr>
+<tr><td>Pro</td><td>9.5</td><td></td><td></td></tr>
+</tbody>
+</table>
+`
+	if got != want {
+		t.Fatalf("table:\n%s\nwant:\n%s", got, want)
+	}
+	if _, err := parseJSONData([]byte(`{"a": 1} {}`)); err == nil {
+		t.Error("expected error for trailing data")
+	}
+}
+
+func mustLookup(t *testing.T, v any, path string) any {
+	t.Helper()
+	got, ok := lookupData(v, path)
+	if !ok {
+		t.Fatalf("%s not found", path)
+	}
+	return got
+}
+
+func TestDataInLayoutsAndShortcodes(t *testing.T) {
+	chdirTemp(t)
+	os.MkdirAll(filepath.Join(dataDir, "shop"), 0755)
+	os.WriteFile(filepath.Join(dataDir, "team.yml"), []byte(teamYAML), 0644)
+	os.WriteFile(filepath.Join(dataDir, "shop", "plans.json"), []byte(`[{"name": "<Free>"}]`), 0644)
+	os.WriteFile(filepath.Join(dataDir, "broken.json"), []byte(`{`), 0644)
+
+	header, footer := applyData([]byte(`<title>{{data team.title}}</title>{{data missing.key}}`), []byte(`{{data team.offices}}`))
+	if string(header) != "<title>Our team</title>" {
+		t.Errorf("header = %q", header)
+	}
+	if string(footer) != "<ul class=\"data\">\n<li>Paris</li>\n<li>Tokyo</li>\n</ul>\n" {
+		t.Errorf("footer = %q", footer)
+	}
+
+	md, blocks := expandShortcodes([]byte("Plans:\n\n{{data shop.plans}}\n\n{{data nope}}\n"))
+	if len(blocks) != 1 || !strings.Contains(blocks[0], "<td>&lt;Free&gt;</td>") {
+		t.Fatalf("blocks = %q", blocks)
+	}
+	if !strings.Contains(string(md), "**data: nope not found**") {
+		t.Errorf("md = %q", md)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines around each hunk.
+const diffContext = 3
+
+// unifiedDiff returns a unified diff from a to b, with oldName and newName
+// in the file headers, or "" when they are equal. applyUnifiedDiff turns a
+// back into b with it.
+func unifiedDiff(oldName, newName, a, b string) string {
+	if a == b {
+		return ""
+	}
+	var lines []diffLine
+	diffSeq(splitLines(a), splitLines(b), func(op byte, text string) {
+		if op == '=' {
+			op = ' '
+		}
+		lines = append(lines, diffLine{op, text})
+	})
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+	oldLine, newLine := 0, 0 // lines before lines[i] in a and b
+	for i := 0; i < len(lines); {
+		if lines[i].op == ' ' {
+			oldLine++
+			newLine++
+			i++
+			continue
+		}
+		// A hunk runs from the context before this change to the context
+		// after the last change that is at most 2*diffContext lines apart
+		start := max(i-diffContext, 0)
+		end := i
+		for j := i; j < len(lines); j++ {
+			if lines[j].op != ' ' {
+				end = j + 1
+			} else if j-end >= 2*diffContext {
+				break
+			}
+		}
+		end = min(end+diffContext, len(lines))
+		oldStart, newStart := oldLine-(i-start), newLine-(i-start)
+		oldCount, newCount := 0, 0
+		for _, l := range lines[start:end] {
+			if l.op != '+' {
+				oldCount++
+			}
+			if l.op != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", unifiedRange(oldStart, oldCount), unifiedRange(newStart, newCount))
+		for _, l := range lines[start:end] {
+			out.WriteByte(l.op)
+			out.WriteString(l.text)
+			if !strings.HasSuffix(l.text, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		oldLine += oldCount - (i - start)
+		newLine += newCount - (i - start)
+		i = end
+	}
+	return out.String()
+}
+
+// splitLines splits s after each newline, keeping a last line without one.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// unifiedRange formats a hunk header range for the count lines after the
+// first start; an empty range names the line before it.
+func unifiedRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprint(start + 1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// handleDiff returns a unified diff from the note given by `file`, as
+// saved, to the request body, so an editor can show what a save would
+// overwrite. The ETag of the saved note is sent along for a following
+// /save with If-Match. A note that does not exist yet diffs as empty.
+func handleDiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.URL.Query().Get("file")
+	if name == "" || filepath.Base(name) != name {
+		http.Error(w, "invalid filename", http.StatusBadRequest)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	oldName := "a/" + name
+	cur, err := readNote(name)
+	if os.IsNotExist(err) {
+		oldName = "/dev/null"
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else {
+		setRevision(w.Header(), contentETag(cur))
+	}
+	w.Header().Set("Content-Type", "text/x-diff; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = io.WriteString(w, unifiedDiff(oldName, "b/"+name, string(cur), string(body)))
+}
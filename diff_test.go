@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	var long []string
+	for i := 1; i <= 20; i++ {
+		long = append(long, fmt.Sprintf("line %d\n", i))
+	}
+	base := strings.Join(long, "")
+	edited := strings.Replace(strings.Replace(base, "line 2\n", "two\n", 1), "line 18\n", "", 1)
+	cases := []struct{ a, b string }{
+		{base, edited},
+		{base, base + "more"},
+		{"", "new\n"},
+		{"old\n", ""},
+		{"a\nb", "a\nc"},
+		{"x\n", "y\n"},
+	}
+	for _, c := range cases {
+		d := unifiedDiff("a/n.md", "b/n.md", c.a, c.b)
+		got, err := applyUnifiedDiff(c.a, d)
+		if err != nil || got != c.b {
+			t.Errorf("diff %q -> %q does not apply: %q, %v\n%s", c.a, c.b, got, err, d)
+		}
+	}
+	d := unifiedDiff("a/n.md", "b/n.md", base, edited)
+	if strings.Count(d, "@@ -") != 2 || !strings.Contains(d, "@@ -1,5 +1,5 @@\n line 1\n-line 2\n+two\n") {
+		t.Errorf("hunks:\n%s", d)
+	}
+	if !strings.Contains(unifiedDiff("a", "b", "a\nb", "a\nc"), "+c\n\\ No newline at end of file\n") {
+		t.Error("missing no-newline marker")
+	}
+	if d := unifiedDiff("a", "b", base, base); d != "" {
+		t.Errorf("equal texts diff = %q", d)
+	}
+}
+
+func TestHandleDiff(t *testing.T) {
+	chdirTemp(t)
+	writeFiles(t, map[string]string{"note.md": "# Note\n\nold text\n"})
+
+	req := httptest.NewRequest(http.MethodPost, "/diff?file=note.md", strings.NewReader("# Note\n\nnew text\n"))
+	rr := httptest.NewRecorder()
+	handleDiff(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rr.Code, rr.Body.String())
+	}
+	want := "--- a/note.md\n+++ b/note.md\n@@ -1,3 +1,3 @@\n # Note\n \n-old text\n+new text\n"
+	if rr.Body.String() != want {
+		t.Errorf("diff =\n%s\nwant\n%s", rr.Body.String(), want)
+	}
+	if rr.Header().Get("ETag") != contentETag([]byte("# Note\n\nold text\n")) {
+		t.Errorf("ETag = %q", rr.Header().Get("ETag"))
+	}
+
+	rr = httptest.NewRecorder()
+	handleDiff(rr, httptest.NewRequest(http.MethodPost, "/diff?file=note.md", strings.NewReader("# Note\n\nold text\n")))
+	if rr.Code != http.StatusOK || rr.Body.Len() != 0 {
+		t.Errorf("unchanged: %d %q", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handleDiff(rr, httptest.NewRequest(http.MethodPost, "/diff?file=new.md", strings.NewReader("hi\n")))
+	if !strings.HasPrefix(rr.Body.String(), "--- /dev/null\n") || rr.Header().Get("ETag") != "" {
+		t.Errorf("missing file: %q etag %q", rr.Body.String(), rr.Header().Get("ETag"))
+	}
+	if _, err := os.Stat("new.md"); !os.IsNotExist(err) {
+		t.Error("diff created the file")
+	}
+
+	for _, c := range []struct {
+		method, target string
+		code           int
+	}{
+		{http.MethodGet, "/diff?file=note.md", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/diff?file=../note.md", http.StatusBadRequest},
+		{http.MethodPost, "/diff", http.StatusBadRequest},
+	} {
+		rr := httptest.NewRecorder()
+		handleDiff(rr, httptest.NewRequest(c.method, c.target, nil))
+		if rr.Code != c.code {
+			t.Errorf("%s %s = %d, want %d", c.method, c.target, rr.Code, c.code)
+		}
+	}
+}
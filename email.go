@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// smtpConfig is the mail server /email sends through. The password is read
+// from MINIMARK_SMTP_PASSWORD so it stays out of minimark.json.
+type smtpConfig struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port,omitempty"` // default 587
+	Username string `json:"username,omitempty"`
+	From     string `json:"from"`
+}
+
+// maxEmailRecipients bounds the addresses one /email request may send to.
+const maxEmailRecipients = 50
+
+// sendMail delivers a message; tests replace it.
+var sendMail = smtp.SendMail
+
+func validateSMTP(s *smtpConfig) error {
+	if s == nil {
+		return nil
+	}
+	if s.Host == "" {
+		return errors.New("smtp: host is required")
+	}
+	if s.Port < 0 || s.Port > 65535 {
+		return fmt.Errorf("smtp: invalid port %d", s.Port)
+	}
+	if _, err := mail.ParseAddress(s.From); err != nil {
+		return fmt.Errorf("smtp: invalid from address %q", s.From)
+	}
+	return nil
+}
+
+// emailStyles are the inline styles given to the tags of an emailed note,
+// since mail clients drop stylesheets.
+var emailStyles = map[string]string{
+	"h1":         "font-size:26px;margin:0 0 16px;",
+	"h2":         "font-size:21px;margin:24px 0 12px;",
+	"h3":         "font-size:18px;margin:20px 0 8px;",
+	"p":          "margin:0 0 14px;",
+	"a":          "color:#0366d6;",
+	"blockquote": "margin:0 0 14px;padding:0 12px;border-left:4px solid #ddd;color:#555;",
+	"pre":        "background:#f6f8fa;padding:12px;overflow:auto;font:13px/1.4 Menlo,Consolas,monospace;",
+	"code":       "background:#f6f8fa;font:13px Menlo,Consolas,monospace;",
+	"table":      "border-collapse:collapse;margin:0 0 14px;",
+	"th":         "border:1px solid #ddd;padding:6px 10px;background:#f6f8fa;text-align:left;",
+	"td":         "border:1px solid #ddd;padding:6px 10px;",
+	"img":        "max-width:100%;",
+	"hr":         "border:0;border-top:1px solid #ddd;margin:20px 0;",
+}
+
+var emailTagRe = regexp.MustCompile(`<(h1|h2|h3|p|a|blockquote|pre|code|table|th|td|img|hr)(\s[^>]*)?>`)
+
+// inlineStyles adds emailStyles to the tags in body. Tags that already have
+// a style attribute keep theirs.
+func inlineStyles(body []byte) []byte {
+	return emailTagRe.ReplaceAllFunc(body, func(m []byte) []byte {
+		sub := emailTagRe.FindSubmatch(m)
+		attrs := bytes.TrimSuffix(sub[2], []byte("/"))
+		if bytes.Contains(bytes.ToLower(attrs), []byte("style=")) {
+			return m
+		}
+		return []byte(fmt.Sprintf(`<%s%s style="%s">`, sub[1], bytes.TrimRight(attrs, " "), emailStyles[string(sub[1])]))
+	})
+}
+
+// emailHTML wraps a rendered note in a minimal document for mail clients.
+func emailHTML(title string, body []byte) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>%s</title>
+</head>
+<body style="margin:0;padding:0;">
+<div style="max-width:680px;margin:0 auto;padding:24px;font:16px/1.5 -apple-system,Helvetica,Arial,sans-serif;color:#24292e;">
+`, html.EscapeString(title))
+	b.Write(inlineStyles(body))
+	b.WriteString("</div>\n</body>\n</html>\n")
+	return b.Bytes()
+}
+
+// buildEmail returns a multipart/alternative message with the note's
+// Markdown as the text part and its rendering as the HTML part.
+func buildEmail(from string, to []string, subject string, text, htmlBody []byte) ([]byte, error) {
+	var msg bytes.Buffer
+	mw := multipart.NewWriter(&msg)
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", mw.Boundary())
+	for _, part := range []struct {
+		typ  string
+		body []byte
+	}{{"text/plain", text}, {"text/html", htmlBody}} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.typ + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		enc := base64.StdEncoding.EncodeToString(part.body)
+		for len(enc) > 76 {
+			fmt.Fprintf(w, "%s\r\n", enc[:76])
+			enc = enc[76:]
+		}
+		fmt.Fprintf(w, "%s\r\n", enc)
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
+
+// emailRecipients parses the to parameters, each of which may hold
+// comma-separated addresses.
+func emailRecipients(values []string) ([]string, error) {
+	var to []string
+	for _, v := range values {
+		list, err := mail.ParseAddressList(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient %q", v)
+		}
+		for _, a := range list {
+			to = append(to, a.Address)
+		}
+	}
+	if len(to) == 0 {
+		return nil, errors.New("missing recipient")
+	}
+	if len(to) > maxEmailRecipients {
+		return nil, fmt.Errorf("at most %d recipients", maxEmailRecipients)
+	}
+	return to, nil
+}
+
+type emailResult struct {
+	File string   `json:"file"`
+	To   []string `json:"to"`
+}
+
+// handleEmail renders a note and sends it to the given addresses through
+// the smtp server in minimark.json:
+//
+//	POST /email?file=notes.md&to=team@example.com
+func handleEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s := config.SMTP
+	if s == nil {
+		http.Error(w, "email is not configured; add smtp to minimark.json", http.StatusServiceUnavailable)
+		return
+	}
+	if cmarkPath == "" {
+		http.Error(w, "HTML export is disabled", http.StatusServiceUnavailable)
+		return
+	}
+	name := r.URL.Query().Get("file")
+	if name == "" || filepath.Base(name) != name || !strings.EqualFold(filepath.Ext(name), ".md") {
+		http.Error(w, "invalid filename", http.StatusBadRequest)
+		return
+	}
+	to, err := emailRecipients(r.URL.Query()["to"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	md, err := readNote(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, text := parseFrontMatter(md)
+	body, err := convertMarkdown(cmarkPath, text)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	subject := pageTitle(md)
+	if subject == "" {
+		subject = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	from, _ := mail.ParseAddress(s.From)
+	msg, err := buildEmail(from.String(), to, subject, text, emailHTML(subject, body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	port := s.Port
+	if port == 0 {
+		port = 587
+	}
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, os.Getenv("MINIMARK_SMTP_PASSWORD"), s.Host)
+	}
+	if err := sendMail(net.JoinHostPort(s.Host, strconv.Itoa(port)), auth, from.Address, to, msg); err != nil {
+		http.Error(w, "send failed: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(emailResult{File: name, To: to})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"testing"
+)
+
+func TestInlineStyles(t *testing.T) {
+	got := string(inlineStyles([]byte(`<h1>T</h1><p>x <a href="/a">a</a></p><p style="color:red">y</p><img src="i.png" /><pre><code class="language-go">c</code></pre>`)))
+	for _, want := range []string{
+		`<h1 style="` + emailStyles["h1"] + `">`,
+		`<a href="/a" style="` + emailStyles["a"] + `">`,
+		`<p style="color:red">`,
+		`<img src="i.png" style="` + emailStyles["img"] + `">`,
+		`<code class="language-go" style="`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %s in %s", want, got)
+		}
+	}
+}
+
+func TestHandleEmail(t *testing.T) {
+	chdirTemp(t)
+	cmarkPath = echoCmark(t)
+	config.SMTP = &smtpConfig{Host: "mail.example.com", Username: "me", From: "Notes <notes@example.com>"}
+	t.Cleanup(func() { cmarkPath = ""; config.SMTP = nil; sendMail = smtp.SendMail })
+	writeFiles(t, map[string]string{"meeting.md": "---\ntitle: Weekly sync\n---\n<p>Agenda</p>\n"})
+
+	var addr, from string
+	var to []string
+	var msg []byte
+	sendMail = func(a string, _ smtp.Auth, f string, t []string, m []byte) error {
+		addr, from, to, msg = a, f, t, m
+		return nil
+	}
+	post := func(query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handleEmail(rr, httptest.NewRequest(http.MethodPost, "/email?"+query, nil))
+		return rr
+	}
+	for query, code := range map[string]int{
+		"file=../meeting.md&to=a@example.com": http.StatusBadRequest,
+		"file=meeting.md":                     http.StatusBadRequest,
+		"file=meeting.md&to=not-an-address":   http.StatusBadRequest,
+		"file=missing.md&to=a@example.com":    http.StatusNotFound,
+	} {
+		if rr := post(query); rr.Code != code {
+			t.Errorf("%s: %d, want %d", query, rr.Code, code)
+		}
+	}
+
+	rr := post("file=meeting.md&to=a@example.com,b@example.com&to=c@example.com")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rr.Code, rr.Body.String())
+	}
+	if addr != "mail.example.com:587" || from != "notes@example.com" || strings.Join(to, " ") != "a@example.com b@example.com c@example.com" {
+		t.Fatalf("sent to %s from %s to %v", addr, from, to)
+	}
+	m, err := mail.ReadMessage(strings.NewReader(string(msg)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := m.Header.Get("Subject"); s != "Weekly sync" {
+		t.Errorf("subject %q", s)
+	}
+	_, params, _ := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	var parts []string
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		b, _ := io.ReadAll(base64.NewDecoder(base64.StdEncoding, p))
+		parts = append(parts, string(b))
+	}
+	if len(parts) != 2 || strings.Contains(parts[0], "title:") || !strings.Contains(parts[1], `<p style="`+emailStyles["p"]+`">Agenda`) {
+		t.Fatalf("parts %q", parts)
+	}
+
+	sendMail = func(string, smtp.Auth, string, []string, []byte) error { return errors.New("refused") }
+	if rr := post("file=meeting.md&to=a@example.com"); rr.Code != http.StatusBadGateway {
+		t.Errorf("send failure: %d", rr.Code)
+	}
+	config.SMTP = nil
+	if rr := post("file=meeting.md&to=a@example.com"); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("unconfigured: %d", rr.Code)
+	}
+}
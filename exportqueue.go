@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Export job states reported by /export/status. Finished exports are
+// dropped from the report.
+const (
+	exportPending = "pending"
+	exportRunning = "running"
+	exportFailed  = "failed"
+)
+
+// exportJob is the export state of one note.
+type exportJob struct {
+	File    string    `json:"file"`
+	State   string    `json:"state"`
+	Error   string    `json:"error,omitempty"`
+	Updated time.Time `json:"updated"`
+}
+
+// exportQueue exports saved notes one at a time in the background, so
+// saves answer without waiting for the converter. A note saved again
+// before its export ran is exported once.
+type exportQueue struct {
+	mu       sync.Mutex
+	pending  []string
+	pageOnly map[string]bool // pending notes whose page alone is exported
+	jobs     map[string]*exportJob
+	wake     chan struct{}
+	export   func(name string) error
+	// exportPage exports the notes queued by enqueuePage.
+	exportPage func(name string) error
+}
+
+// exportMu serializes writes to the export directory: the queue's note
+// exports, full re-exports after layout changes, and site page updates
+// from the note watcher and /delete, which run on goroutines of their own.
+var exportMu sync.Mutex
+
+// exports is the queue used by afterSave while the server runs; when nil,
+// as for builds, notes are exported straight away.
+var exports *exportQueue
+
+func newExportQueue() *exportQueue {
+	return &exportQueue{pageOnly: map[string]bool{}, jobs: map[string]*exportJob{}, wake: make(chan struct{}, 1), export: exportNote, exportPage: exportPage}
+}
+
+// enqueue schedules name for export.
+func (q *exportQueue) enqueue(name string) {
+	q.add(name, false)
+}
+
+// enqueuePage schedules only the page of name for export, for changes
+// that leave the note itself as it was. A full export of name queued
+// meanwhile covers it.
+func (q *exportQueue) enqueuePage(name string) {
+	q.add(name, true)
+}
+
+func (q *exportQueue) add(name string, pageOnly bool) {
+	q.mu.Lock()
+	if j := q.jobs[name]; j == nil || j.State != exportPending {
+		q.pending = append(q.pending, name)
+		q.jobs[name] = &exportJob{File: name, State: exportPending, Updated: time.Now()}
+		q.pageOnly[name] = pageOnly
+	} else if !pageOnly {
+		q.pageOnly[name] = false
+	}
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next takes the oldest pending note off the queue and marks it running.
+func (q *exportQueue) next() (string, bool) {
+	name, _, ok := q.nextJob()
+	return name, ok
+}
+
+// nextJob is next, also reporting whether only the note's page is due.
+func (q *exportQueue) nextJob() (name string, pageOnly, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) == 0 {
+		return "", false, false
+	}
+	name = q.pending[0]
+	q.pending = q.pending[1:]
+	pageOnly = q.pageOnly[name]
+	delete(q.pageOnly, name)
+	q.jobs[name] = &exportJob{File: name, State: exportRunning, Updated: time.Now()}
+	return name, pageOnly, true
+}
+
+// finish records the outcome of exporting name, unless it was queued
+// again meanwhile.
+func (q *exportQueue) finish(name string, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if j := q.jobs[name]; j == nil || j.State != exportRunning {
+		return
+	}
+	if err != nil {
+		q.jobs[name] = &exportJob{File: name, State: exportFailed, Error: err.Error(), Updated: time.Now()}
+		return
+	}
+	delete(q.jobs, name)
+}
+
+// drain exports every pending note.
+func (q *exportQueue) drain() {
+	for name, pageOnly, ok := q.nextJob(); ok; name, pageOnly, ok = q.nextJob() {
+		export := q.export
+		if pageOnly {
+			export = q.exportPage
+		}
+		q.finish(name, export(name))
+	}
+}
+
+// run drains the queue whenever notes are added. It never returns.
+func (q *exportQueue) run() {
+	for range q.wake {
+		q.drain()
+	}
+}
+
+// status returns the jobs for pending, running and failed exports, by
+// file name.
+func (q *exportQueue) status() []exportJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := make([]exportJob, 0, len(q.jobs))
+	for _, j := range q.jobs {
+		jobs = append(jobs, *j)
+	}
+	sort.Slice(jobs, func(i, k int) bool { return jobs[i].File < jobs[k].File })
+	return jobs
+}
+
+type exportStatus struct {
+	Jobs []exportJob `json:"jobs"`
+}
+
+// handleExportStatus reports the background exports that are pending or
+// running, and those that failed.
+func handleExportStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	resp := exportStatus{Jobs: []exportJob{}}
+	if exports != nil {
+		resp.Jobs = exports.status()
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(resp)
+}
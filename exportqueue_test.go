@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestExportQueue(t *testing.T) {
+	q := newExportQueue()
+	var ran []string
+	q.export = func(name string) error {
+		ran = append(ran, name)
+		if name == "bad.md" {
+			return errors.New("converter failed")
+		}
+		return nil
+	}
+	q.enqueue("a.md")
+	q.enqueue("bad.md")
+	q.enqueue("a.md") // still pending, so exported once
+	states := func() map[string]string {
+		m := map[string]string{}
+		for _, j := range q.status() {
+			m[j.File] = j.State + j.Error
+		}
+		return m
+	}
+	if got := states(); !reflect.DeepEqual(got, map[string]string{"a.md": exportPending, "bad.md": exportPending}) {
+		t.Errorf("queued: %v", got)
+	}
+	q.drain()
+	if !reflect.DeepEqual(ran, []string{"a.md", "bad.md"}) {
+		t.Errorf("exported %v", ran)
+	}
+	if got := states(); !reflect.DeepEqual(got, map[string]string{"bad.md": exportFailed + "converter failed"}) {
+		t.Errorf("after drain: %v", got)
+	}
+
+	// A note saved again while exporting is exported again
+	q.enqueue("b.md")
+	name, _ := q.next()
+	q.enqueue("b.md")
+	q.finish(name, nil)
+	if got := states()["b.md"]; got != exportPending {
+		t.Errorf("requeued while running: %q", got)
+	}
+	q.enqueue("bad.md")
+	ran = nil
+	q.drain()
+	if !reflect.DeepEqual(ran, []string{"b.md", "bad.md"}) {
+		t.Errorf("second drain exported %v", ran)
+	}
+}
+
+func TestExportQueue_PageOnly(t *testing.T) {
+	q := newExportQueue()
+	var ran []string
+	q.export = func(name string) error {
+		ran = append(ran, "note "+name)
+		return nil
+	}
+	q.exportPage = func(name string) error {
+		ran = append(ran, "page "+name)
+		return nil
+	}
+	q.enqueuePage("a.md")
+	q.enqueuePage("b.md")
+	q.enqueue("b.md") // a full export covers the page
+	q.enqueuePage("b.md")
+	q.drain()
+	if want := []string{"page a.md", "note b.md"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("exported %v, want %v", ran, want)
+	}
+}
+
+func TestHandleExportStatus(t *testing.T) {
+	t.Cleanup(func() { exports = nil })
+	exports = newExportQueue()
+	exports.enqueue("trip.md")
+	rr := httptest.NewRecorder()
+	handleExportStatus(rr, httptest.NewRequest(http.MethodGet, "/export/status", nil))
+	var resp exportStatus
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || len(resp.Jobs) != 1 || resp.Jobs[0].File != "trip.md" || resp.Jobs[0].State != exportPending {
+		t.Errorf("status %s, %v", rr.Body.String(), err)
+	}
+	exports = nil
+	rr = httptest.NewRecorder()
+	handleExportStatus(rr, httptest.NewRequest(http.MethodGet, "/export/status", nil))
+	if rr.Body.String() != "{\"jobs\":[]}\n" {
+		t.Errorf("without a queue: %q", rr.Body.String())
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// numberFigures prefixes figure captions with "Figure N:".
+var numberFigures bool
+
+// figureRe matches an image with title text that stands alone in a
+// paragraph, as cmark-gfm renders ![alt](src "title").
+var figureRe = regexp.MustCompile(`<p>\s*(<img\b[^>]*\btitle="([^"]+)"[^>]*>)\s*</p>`)
+
+// figurize wraps standalone titled images in <figure> with the title as
+// <figcaption>. The title is already HTML-escaped in the attribute.
+func figurize(body []byte) []byte {
+	n := 0
+	return figureRe.ReplaceAllFunc(body, func(m []byte) []byte {
+		sub := figureRe.FindSubmatch(m)
+		img, title := sub[1], sub[2]
+		n++
+		if numberFigures {
+			return []byte(fmt.Sprintf(`<figure id="figure-%d">%s<figcaption><span class="figure-number">Figure %d:</span> %s</figcaption></figure>`, n, img, n, title))
+		}
+		return []byte(fmt.Sprintf(`<figure>%s<figcaption>%s</figcaption></figure>`, img, title))
+	})
+}
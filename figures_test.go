@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestFigurize(t *testing.T) {
+	cases := []struct {
+		in, want string
+		number   bool
+	}{
+		{
+			in:   `<p><img src="a.png" alt="A" title="A &amp; B" /></p>`,
+			want: `<figure><img src="a.png" alt="A" title="A &amp; B" /><figcaption>A &amp; B</figcaption></figure>`,
+		},
+		{
+			// Untitled and inline images are left alone
+			in:   `<p><img src="a.png" alt="A" /></p><p>see <img src="b.png" alt="" title="B" /> here</p>`,
+			want: `<p><img src="a.png" alt="A" /></p><p>see <img src="b.png" alt="" title="B" /> here</p>`,
+		},
+		{
+			in:     "<p><img src=\"a.png\" alt=\"\" title=\"One\" /></p>\n<p><img src=\"b.png\" alt=\"\" title=\"Two\" /></p>",
+			want:   "<figure id=\"figure-1\"><img src=\"a.png\" alt=\"\" title=\"One\" /><figcaption><span class=\"figure-number\">Figure 1:</span> One</figcaption></figure>\n<figure id=\"figure-2\"><img src=\"b.png\" alt=\"\" title=\"Two\" /><figcaption><span class=\"figure-number\">Figure 2:</span> Two</figcaption></figure>",
+			number: true,
+		},
+	}
+	t.Cleanup(func() { numberFigures = false })
+	for _, c := range cases {
+		numberFigures = c.number
+		if got := string(figurize([]byte(c.in))); got != c.want {
+			t.Errorf("figurize(%q) =\n%q\nwant\n%q", c.in, got, c.want)
+		}
+	}
+}
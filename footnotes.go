@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+)
+
+// Footnote styles for footnotes: in minimark.json. Both keep the endnotes
+// cmark-gfm writes at the end of the page and repeat each note beside its
+// reference, shown on hover ("popover") or in the margin ("sidenotes").
+const (
+	footnotesPopover   = "popover"
+	footnotesSidenotes = "sidenotes"
+)
+
+// footnotesLink references the stylesheet that lays out popovers and
+// sidenotes.
+const footnotesLink = `<link rel="stylesheet" type="text/css" href="footnotes.css">`
+
+var (
+	// footnoteRefRe matches a reference as cmark-gfm renders it:
+	// <sup class="footnote-ref"><a href="#fn-1" id="fnref-1" data-footnote-ref>1</a></sup>.
+	footnoteRefRe = regexp.MustCompile(`<sup class="footnote-ref"><a href="#([^"]+)" id="([^"]+)"([^>]*)>([^<]*)</a></sup>`)
+	// footnoteSectionRe matches the endnotes section and its opening tag.
+	footnoteSectionRe = regexp.MustCompile(`(?s)<section class="footnotes"([^>]*)>.*?</section>`)
+	footnoteItemRe    = regexp.MustCompile(`(?s)<li id="([^"]+)">(.*?)</li>`)
+	footnoteBackrefRe = regexp.MustCompile(`<a href="#[^"]*" class="footnote-backref"([^>]*)>`)
+	// footnoteBackrefLinkRe matches a whole back-reference link, to drop it
+	// from the copy shown beside the reference.
+	footnoteBackrefLinkRe = regexp.MustCompile(`\s*<a href="#[^"]*" class="footnote-backref"[^>]*>.*?</a>`)
+)
+
+func validateFootnotes(style string) error {
+	if style != "" && style != footnotesPopover && style != footnotesSidenotes {
+		return fmt.Errorf("footnotes must be %q or %q", footnotesPopover, footnotesSidenotes)
+	}
+	return nil
+}
+
+// converterArgs are the arguments cmark-gfm is run with. Footnote syntax is
+// only parsed when a footnote style is configured, so other converters and
+// existing sites see no change.
+func converterArgs() []string {
+	if config.Footnotes != "" {
+		return []string{"--footnotes"}
+	}
+	return nil
+}
+
+// ensureFootnotesLink adds the footnotes stylesheet link to a header when
+// a footnote style is configured and the header does not reference it yet.
+func ensureFootnotesLink(header []byte) []byte {
+	if config.Footnotes == "" || bytes.Contains(header, []byte("footnotes.css")) {
+		return header
+	}
+	return insertBeforeTag(header, "</head>", footnotesLink+"\n")
+}
+
+// footnoteText flattens a rendered footnote into inline HTML that fits in a
+// <span>: the back-references are dropped and paragraphs become line breaks.
+func footnoteText(note []byte) []byte {
+	note = footnoteBackrefLinkRe.ReplaceAll(note, nil)
+	note = bytes.TrimSpace(note)
+	note = bytes.TrimPrefix(note, []byte("<p>"))
+	note = bytes.TrimSuffix(note, []byte("</p>"))
+	note = bytes.ReplaceAll(note, []byte("</p>\n<p>"), []byte("<br>"))
+	return bytes.TrimSpace(note)
+}
+
+// footnoteMarkup adds the markup the configured footnote style needs:
+// ARIA roles on references, endnotes and back-references, and a copy of
+// each note in a span right after its reference, described by it. Without
+// a style, or on pages without footnotes, body is returned unchanged.
+func footnoteMarkup(body []byte) []byte {
+	if config.Footnotes == "" {
+		return body
+	}
+	section := footnoteSectionRe.Find(body)
+	if section == nil {
+		return body
+	}
+	notes := map[string][]byte{}
+	for _, m := range footnoteItemRe.FindAllSubmatch(section, -1) {
+		notes[string(m[1])] = footnoteText(m[2])
+	}
+	class := "footnote-popover"
+	if config.Footnotes == footnotesSidenotes {
+		class = "sidenote"
+	}
+
+	body = footnoteRefRe.ReplaceAllFunc(body, func(m []byte) []byte {
+		sub := footnoteRefRe.FindSubmatch(m)
+		target, id, attrs, label := sub[1], sub[2], sub[3], sub[4]
+		note, ok := notes[string(target)]
+		if !ok {
+			return m
+		}
+		noteID := string(id) + "-note"
+		return []byte(fmt.Sprintf(`<sup class="footnote-ref"><a href="#%s" id="%s"%s role="doc-noteref" aria-describedby="%s">%s</a></sup>`+
+			`<span class="%s" id="%s" role="note"><span class="footnote-number">%s</span> %s</span>`,
+			target, id, attrs, noteID, label, class, noteID, label, note))
+	})
+
+	return footnoteSectionRe.ReplaceAllFunc(body, func(s []byte) []byte {
+		open := footnoteSectionRe.FindSubmatch(s)[1]
+		inner := s[bytes.IndexByte(s, '>')+1:]
+		inner = footnoteItemRe.ReplaceAllFunc(inner, func(li []byte) []byte {
+			return bytes.Replace(li, []byte("<li "), []byte(`<li role="doc-endnote" `), 1)
+		})
+		inner = footnoteBackrefRe.ReplaceAllFunc(inner, func(a []byte) []byte {
+			if !bytes.Contains(a, []byte("aria-label=")) {
+				a = bytes.Replace(a, []byte(">"), []byte(` aria-label="Back to reference">`), 1)
+			}
+			return bytes.Replace(a, []byte(">"), []byte(` role="doc-backlink">`), 1)
+		})
+		return []byte(fmt.Sprintf(`<section class="footnotes footnotes-%s"%s role="doc-endnotes">%s`, config.Footnotes, open, inner))
+	})
+}
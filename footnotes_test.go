@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// cmarkFootnotes is cmark-gfm --footnotes output for a note referenced
+// twice and a two-paragraph note.
+const cmarkFootnotes = `<p>Claim<sup class="footnote-ref"><a href="#fn-a" id="fnref-a" data-footnote-ref>1</a></sup> and again<sup class="footnote-ref"><a href="#fn-a" id="fnref-a-2" data-footnote-ref>1</a></sup>, then more<sup class="footnote-ref"><a href="#fn-b" id="fnref-b" data-footnote-ref>2</a></sup>.</p>
+<section class="footnotes" data-footnotes>
+<ol>
+<li id="fn-a">
+<p>A <em>source</em>. <a href="#fnref-a" class="footnote-backref" data-footnote-backref data-footnote-backref-idx="1" aria-label="Back to reference 1">↩</a> <a href="#fnref-a-2" class="footnote-backref" data-footnote-backref data-footnote-backref-idx="1-2" aria-label="Back to reference 1-2">↩<sup class="footnote-ref">2</sup></a></p>
+</li>
+<li id="fn-b">
+<p>First.</p>
+<p>Second. <a href="#fnref-b" class="footnote-backref">↩</a></p>
+</li>
+</ol>
+</section>
+`
+
+func TestFootnoteMarkup(t *testing.T) {
+	t.Cleanup(func() { config.Footnotes = "" })
+	if got := string(footnoteMarkup([]byte(cmarkFootnotes))); got != cmarkFootnotes {
+		t.Errorf("changed without a style:\n%s", got)
+	}
+
+	config.Footnotes = footnotesPopover
+	got := string(footnoteMarkup([]byte(cmarkFootnotes)))
+	for _, want := range []string{
+		`<a href="#fn-a" id="fnref-a" data-footnote-ref role="doc-noteref" aria-describedby="fnref-a-note">1</a></sup><span class="footnote-popover" id="fnref-a-note" role="note"><span class="footnote-number">1</span> A <em>source</em>.</span>`,
+		`aria-describedby="fnref-a-2-note">1</a></sup><span class="footnote-popover" id="fnref-a-2-note"`,
+		`<span class="footnote-number">2</span> First.<br>Second.</span>`,
+		`<section class="footnotes footnotes-popover" data-footnotes role="doc-endnotes">`,
+		`<li role="doc-endnote" id="fn-a">`,
+		`aria-label="Back to reference 1" role="doc-backlink">↩</a>`,
+		`<a href="#fnref-b" class="footnote-backref" aria-label="Back to reference" role="doc-backlink">`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %s in:\n%s", want, got)
+		}
+	}
+
+	config.Footnotes = footnotesSidenotes
+	got = string(footnoteMarkup([]byte(cmarkFootnotes)))
+	if !strings.Contains(got, `<span class="sidenote" id="fnref-b-note" role="note">`) || !strings.Contains(got, `class="footnotes footnotes-sidenotes"`) {
+		t.Errorf("sidenotes:\n%s", got)
+	}
+}
+
+func TestFootnotesConfigAndLink(t *testing.T) {
+	chdirTemp(t)
+	t.Cleanup(func() { config.Footnotes = "" })
+	if err := os.WriteFile("minimark.json", []byte(`{"footnotes": "margin"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig("minimark.json"); err == nil {
+		t.Error("unknown footnote style accepted")
+	}
+
+	header := []byte("<head></head>")
+	if got := string(ensureFootnotesLink(header)); got != "<head></head>" || converterArgs() != nil {
+		t.Errorf("without a style: %s %v", got, converterArgs())
+	}
+	config.Footnotes = footnotesSidenotes
+	if got := string(ensureFootnotesLink(header)); got != "<head>"+footnotesLink+"\n</head>" {
+		t.Errorf("link: %s", got)
+	}
+	if args := converterArgs(); len(args) != 1 || args[0] != "--footnotes" {
+		t.Errorf("args %v", args)
+	}
+}
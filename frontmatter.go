@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+)
+
+// parseFrontMatter splits an optional leading "---" block of "key: value"
+// lines from content. It returns the fields (keys lowercased) and the
+// remaining body. Content without front matter yields nil fields and the
+// unchanged content.
+func parseFrontMatter(content []byte) (map[string]string, []byte) {
+	if !bytes.HasPrefix(content, []byte("---")) {
+		return nil, content
+	}
+	r := bufio.NewReader(bytes.NewReader(content))
+	fields, n, ok := readFrontMatterFields(r)
+	if !ok {
+		return nil, content
+	}
+	return fields, content[n:]
+}
+
+// readFrontMatterFields reads a front matter block from r. It returns the
+// fields, the number of bytes consumed, and false if r does not start with a
+// complete block.
+func readFrontMatterFields(r *bufio.Reader) (map[string]string, int, bool) {
+	first, err := r.ReadString('\n')
+	if strings.TrimRight(first, "\r\n") != "---" || err != nil {
+		return nil, 0, false
+	}
+	n := len(first)
+	fields := map[string]string{}
+	listKey := "" // key whose value continues as "- item" lines
+	for {
+		line, err := r.ReadString('\n')
+		n += len(line)
+		trimmed := strings.TrimRight(line, "\r\n")
+		if trimmed == "---" || trimmed == "..." {
+			return fields, n, true
+		}
+		if err != nil {
+			return nil, 0, false
+		}
+		if item, ok := strings.CutPrefix(strings.TrimSpace(trimmed), "- "); ok && listKey != "" {
+			if fields[listKey] != "" {
+				fields[listKey] += ", "
+			}
+			fields[listKey] += unquote(strings.TrimSpace(item))
+			continue
+		}
+		key, value, found := strings.Cut(trimmed, ":")
+		if !found || strings.HasPrefix(trimmed, " ") || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		fields[key] = unquote(strings.TrimSpace(value))
+		listKey = ""
+		if fields[key] == "" {
+			listKey = key
+		}
+	}
+}
+
+// frontMatterList splits a list-valued field written either inline
+// ("[a, b]" or "a, b") or as "- item" lines.
+func frontMatterList(value string) []string {
+	value = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(value), "["), "]")
+	var out []string
+	for _, part := range strings.Split(value, ",") {
+		if part = unquote(strings.TrimSpace(part)); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// frontMatterReadLimit bounds how much of a file is read when only the front
+// matter is needed.
+const frontMatterReadLimit = 16 << 10
+
+// readFileFrontMatter returns the front matter fields of the file at path
+// without reading the whole file.
+func readFileFrontMatter(path string) map[string]string {
+	f, err := os.Open(wsPath(path))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	fields, _, ok := readFrontMatterFields(bufio.NewReader(io.LimitReader(f, frontMatterReadLimit)))
+	if !ok {
+		return nil
+	}
+	return fields
+}
+
+var frontMatterDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseFrontMatterDate parses the date formats commonly used in front matter.
+func parseFrontMatterDate(s string) (time.Time, bool) {
+	for _, layout := range frontMatterDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// docTime returns the time used to order a document: its front matter
+// `updated:` or `date:` field when present and valid, otherwise the file's
+// modification time. Sync tools routinely clobber mtimes, so front matter
+// wins.
+func docTime(path string, info fs.FileInfo) time.Time {
+	fields := readFileFrontMatter(path)
+	for _, key := range []string{"updated", "date"} {
+		if t, ok := parseFrontMatterDate(fields[key]); ok {
+			return t
+		}
+	}
+	return info.ModTime()
+}
+
+// setFrontMatterField returns content with the front matter field key set to
+// value, adding a front matter block if needed. An empty value removes the
+// field. Other fields and the body are left untouched.
+func setFrontMatterField(content []byte, key, value string) []byte {
+	_, body := parseFrontMatter(content)
+	var lines []string
+	if len(body) != len(content) {
+		block := strings.TrimRight(string(content[:len(content)-len(body)]), "\r\n")
+		lines = strings.Split(block, "\n")
+		lines = lines[1 : len(lines)-1] // drop the "---" delimiters
+	}
+	var out []string
+	found, inList := false, false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(strings.TrimRight(line, "\r"))
+		if inList && (strings.HasPrefix(trimmed, "- ") || strings.HasPrefix(line, " ")) {
+			continue // continuation of the replaced field
+		}
+		inList = false
+		k, _, ok := strings.Cut(line, ":")
+		if ok && !strings.HasPrefix(line, " ") && strings.EqualFold(strings.TrimSpace(k), key) {
+			found, inList = true, true
+			if value != "" {
+				out = append(out, key+": "+value)
+			}
+			continue
+		}
+		out = append(out, strings.TrimRight(line, "\r"))
+	}
+	if !found && value != "" {
+		out = append(out, key+": "+value)
+	}
+	if len(out) == 0 {
+		return body
+	}
+	return []byte("---\n" + strings.Join(out, "\n") + "\n---\n" + string(body))
+}
+
+// formatFrontMatterList renders values as an inline list, e.g. "[a, b]".
+func formatFrontMatterList(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return "[" + strings.Join(values, ", ") + "]"
+}
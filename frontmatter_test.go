@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseFrontMatter(t *testing.T) {
+	fields, body := parseFrontMatter([]byte("---\ntitle: \"Hello: World\"\nDate: 2024-03-01\n  nested: skip\n---\n# Body\n"))
+	if fields["title"] != "Hello: World" || fields["date"] != "2024-03-01" {
+		t.Fatalf("fields = %v", fields)
+	}
+	if _, ok := fields["nested"]; ok {
+		t.Fatalf("indented lines should be skipped")
+	}
+	if string(body) != "# Body\n" {
+		t.Fatalf("body = %q", string(body))
+	}
+	// No front matter, or an unterminated block, leaves content untouched
+	for _, in := range []string{"# Title\n", "---\ntitle: x\n"} {
+		fields, body := parseFrontMatter([]byte(in))
+		if fields != nil || string(body) != in {
+			t.Fatalf("parseFrontMatter(%q) = %v, %q", in, fields, string(body))
+		}
+	}
+}
+
+func TestParseFrontMatterDate(t *testing.T) {
+	for _, s := range []string{"2024-03-01", "2024-03-01 10:30", "2024-03-01T10:30:00Z", "2024-03-01T10:30:00"} {
+		if _, ok := parseFrontMatterDate(s); !ok {
+			t.Errorf("expected %q to parse", s)
+		}
+	}
+	if _, ok := parseFrontMatterDate("yesterday"); ok {
+		t.Errorf("expected failure")
+	}
+}
+
+func TestFindLastMarkdownFile_PrefersFrontMatterDate(t *testing.T) {
+	chdirTemp(t)
+	// old.md has the newest mtime but an old front matter date
+	if err := os.WriteFile("old.md", []byte("---\ndate: 2001-01-01\n---\nold"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("new.md", []byte("---\ndate: 2001-01-01\nupdated: 2030-01-01\n---\nnew"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("plain.md", []byte("plain"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes("new.md", past, past); err != nil {
+		t.Fatal(err)
+	}
+	p, err := findLastMarkdownFile(".")
+	if err != nil || filepath.Base(p) != "new.md" {
+		t.Fatalf("expected new.md, got %q err=%v", p, err)
+	}
+}
+
+func TestSetFrontMatterField(t *testing.T) {
+	cases := []struct {
+		in, key, value, want string
+	}{
+		{"# Body\n", "tags", "[a]", "---\ntags: [a]\n---\n# Body\n"},
+		{"---\ntitle: T\ntags:\n  - x\n  - y\ndate: 2024-01-01\n---\nbody", "tags", "[z]", "---\ntitle: T\ntags: [z]\ndate: 2024-01-01\n---\nbody"},
+		{"---\ntitle: T\n---\nbody", "Private", "true", "---\ntitle: T\nPrivate: true\n---\nbody"},
+		{"---\ntags: [a]\n---\nbody", "tags", "", "body"},
+	}
+	for _, c := range cases {
+		if got := string(setFrontMatterField([]byte(c.in), c.key, c.value)); got != c.want {
+			t.Errorf("setFrontMatterField(%q, %q, %q) = %q; want %q", c.in, c.key, c.value, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// headersConfig overrides the security headers sent by the editor server.
+// Empty fields use the defaults below; "off" leaves a header out.
+type headersConfig struct {
+	// ContentSecurityPolicy applies to the editor UI and its API.
+	ContentSecurityPolicy string `json:"content_security_policy,omitempty"`
+	// DocsContentSecurityPolicy applies to exported pages under /docs/ and
+	// pages rendered under /view/ and /shared/, which may load configured
+	// CDN assets, embeds and widgets, so it has no default beyond
+	// frame-ancestors.
+	DocsContentSecurityPolicy string `json:"docs_content_security_policy,omitempty"`
+	ReferrerPolicy            string `json:"referrer_policy,omitempty"`
+	// FrameAncestors is the CSP frame-ancestors source list.
+	FrameAncestors string `json:"frame_ancestors,omitempty"`
+}
+
+// Defaults compatible with the embedded UI: everything is served from the
+// editor itself, and minimark.js only sets styles through the DOM.
+const (
+	defaultCSP            = "default-src 'self'; img-src 'self' data: blob:; object-src 'none'; base-uri 'self'; form-action 'self'"
+	defaultReferrerPolicy = "same-origin"
+	defaultFrameAncestors = "'self'"
+)
+
+const headerOff = "off"
+
+// headerValue returns v, or def when v is empty, or "" when v is "off".
+func headerValue(v, def string) string {
+	switch v {
+	case "":
+		return def
+	case headerOff:
+		return ""
+	}
+	return v
+}
+
+// renderedPagePath reports whether p serves published pages, which get
+// the docs policy: exported ones under /docs/, live ones under /view/,
+// shared ones under /shared/ and previews from /preview.
+func renderedPagePath(p string) bool {
+	if p == "/preview" {
+		return true
+	}
+	for _, prefix := range []string{"/docs/", "/view/", "/shared/"} {
+		if strings.HasPrefix(p, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// securityHeaders sets Content-Security-Policy, X-Content-Type-Options and
+// Referrer-Policy on every response from next.
+func securityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := config.Headers
+		csp := headerValue(c.ContentSecurityPolicy, defaultCSP)
+		if renderedPagePath(r.URL.Path) {
+			csp = headerValue(c.DocsContentSecurityPolicy, "")
+		}
+		if fa := headerValue(c.FrameAncestors, defaultFrameAncestors); fa != "" && !strings.Contains(csp, "frame-ancestors") {
+			if csp != "" {
+				csp += "; "
+			}
+			csp += "frame-ancestors " + fa
+		}
+		h := w.Header()
+		if csp != "" {
+			h.Set("Content-Security-Policy", csp)
+		}
+		h.Set("X-Content-Type-Options", "nosniff")
+		if rp := headerValue(c.ReferrerPolicy, defaultReferrerPolicy); rp != "" {
+			h.Set("Referrer-Policy", rp)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
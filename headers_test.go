@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	h := securityHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	get := func(path string) http.Header {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr.Header()
+	}
+
+	hdr := get("/")
+	if hdr.Get("Content-Security-Policy") != defaultCSP+"; frame-ancestors 'self'" ||
+		hdr.Get("X-Content-Type-Options") != "nosniff" || hdr.Get("Referrer-Policy") != "same-origin" {
+		t.Fatalf("defaults = %v", hdr)
+	}
+	if csp := get("/docs/index.html").Get("Content-Security-Policy"); csp != "frame-ancestors 'self'" {
+		t.Fatalf("docs csp = %q", csp)
+	}
+
+	withConfig(t, siteConfig{Headers: headersConfig{
+		ContentSecurityPolicy:     "default-src 'self'; frame-ancestors https://wiki.example.com",
+		DocsContentSecurityPolicy: "default-src https:",
+		ReferrerPolicy:            "off",
+		FrameAncestors:            "'none'",
+	}})
+	hdr = get("/save")
+	if hdr.Get("Content-Security-Policy") != "default-src 'self'; frame-ancestors https://wiki.example.com" {
+		t.Fatalf("csp = %q", hdr.Get("Content-Security-Policy"))
+	}
+	if _, ok := hdr["Referrer-Policy"]; ok {
+		t.Fatalf("referrer policy not turned off")
+	}
+	if csp := get("/docs/a.html").Get("Content-Security-Policy"); csp != "default-src https:; frame-ancestors 'none'" {
+		t.Fatalf("docs csp = %q", csp)
+	}
+}
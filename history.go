@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// gitRevRe matches the abbreviated or full commit hashes /restore accepts,
+// which also keeps revisions from being read as git options.
+var gitRevRe = regexp.MustCompile(`^[0-9a-fA-F]{4,40}$`)
+
+// historyEntry is one commit in the /history response.
+type historyEntry struct {
+	Rev     string    `json:"rev"`
+	Author  string    `json:"author"`
+	Date    time.Time `json:"date"`
+	Subject string    `json:"subject"`
+	// Path is the file as named in the commit, which differs from the
+	// current name when it was renamed since.
+	Path string `json:"path"`
+}
+
+// gitHistory returns the commits touching name, newest first, following
+// renames. It fails outside a git repository.
+func gitHistory(name string) ([]historyEntry, error) {
+	out, err := workspaceCommand("git", "log", "--follow", "--name-only", "--format=%x1e%H%x1f%an%x1f%aI%x1f%s", "--", name).Output()
+	if err != nil {
+		return nil, err
+	}
+	top, err := workspaceCommand("git", "rev-parse", "--show-prefix").Output()
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.TrimSpace(string(top))
+	entries := []historyEntry{}
+	for _, rec := range strings.Split(string(out), "\x1e") {
+		head, files, _ := strings.Cut(strings.TrimSpace(rec), "\n")
+		f := strings.Split(head, "\x1f")
+		if len(f) != 4 {
+			continue
+		}
+		e := historyEntry{Rev: f[0], Author: f[1], Subject: f[3], Path: name}
+		e.Date, _ = time.Parse(time.RFC3339, f[2])
+		if p := strings.TrimSpace(files); p != "" {
+			e.Path = strings.TrimPrefix(strings.Split(p, "\n")[0], prefix)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// gitShow returns the content of the note name as of commit rev, which
+// must be one of the commits touching it.
+func gitShow(rev, name string) ([]byte, error) {
+	entries, err := gitHistory(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Rev, strings.ToLower(rev)) {
+			return workspaceCommand("git", "show", e.Rev+":./"+e.Path).Output()
+		}
+	}
+	return nil, fmt.Errorf("%s does not change %s", rev, name)
+}
+
+// handleHistory lists the git commits touching the note given by the
+// `file` query param.
+func handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.URL.Query().Get("file")
+	if name == "" || filepath.Base(name) != name {
+		http.Error(w, "invalid filename", http.StatusBadRequest)
+		return
+	}
+	entries, err := gitHistory(name)
+	if err != nil {
+		http.Error(w, "no git history: "+err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(entries)
+}
+
+// handleRestore writes the note given by `file` back as it was in the
+// commit `rev` and re-exports it. The caller must hold the note's lock;
+// the replaced content can be brought back with /undo.
+func handleRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	name, rev := q.Get("file"), q.Get("rev")
+	if name == "" || filepath.Base(name) != name {
+		http.Error(w, "invalid filename", http.StatusBadRequest)
+		return
+	}
+	if !gitRevRe.MatchString(rev) {
+		http.Error(w, "invalid rev", http.StatusBadRequest)
+		return
+	}
+	if !hasValidLock(name, r.Header.Get("X-Lock")) {
+		lockedError(w, name)
+		return
+	}
+	old, err := gitShow(rev, name)
+	if err != nil {
+		http.Error(w, "not found at "+rev, http.StatusNotFound)
+		return
+	}
+	data, err := openNote(old)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	prev, prevErr := readNote(name)
+	if prevErr != nil && !os.IsNotExist(prevErr) {
+		http.Error(w, prevErr.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := writeNote(name, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if prevErr == nil && !bytes.Equal(prev, data) {
+		pushUndo(name, prev, data)
+	}
+	outName := afterSave(name)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Filename", name)
+	w.Header().Set("X-HTML-Filename", outName)
+	setRevision(w.Header(), contentETag(data))
+	_, _ = w.Write(data)
+}
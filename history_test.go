@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+// gitCommit commits everything in the current directory with message.
+func gitCommit(t *testing.T, message string) {
+	t.Helper()
+	for _, args := range [][]string{
+		{"add", "-A"},
+		{"-c", "user.name=Ann", "-c", "user.email=ann@example.com", "commit", "-q", "-m", message},
+	} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v %s", args, err, out)
+		}
+	}
+}
+
+func TestHistoryAndRestore(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	chdirTemp(t)
+	locks = make(map[string]lockInfo)
+	get := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handleHistory(rr, httptest.NewRequest(http.MethodGet, "/history?file=note.md", nil))
+		return rr
+	}
+	if rr := get(); rr.Code != http.StatusNotFound {
+		t.Errorf("outside git: %d", rr.Code)
+	}
+	if out, err := exec.Command("git", "init", "-q").CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v %s", err, out)
+	}
+	body := "\nA paragraph long enough for git to see the rename.\n"
+	writeFiles(t, map[string]string{"old.md": "# First\n" + body})
+	gitCommit(t, "Start")
+	if err := os.Rename("old.md", "note.md"); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, map[string]string{"note.md": "# Second\n" + body})
+	gitCommit(t, "Rename and edit")
+	writeFiles(t, map[string]string{"note.md": "# Working copy\n"})
+
+	rr := get()
+	var hist []historyEntry
+	if err := json.Unmarshal(rr.Body.Bytes(), &hist); err != nil || len(hist) != 2 {
+		t.Fatalf("history %s, %v", rr.Body.String(), err)
+	}
+	if hist[0].Subject != "Rename and edit" || hist[0].Path != "note.md" || hist[1].Path != "old.md" || hist[1].Author != "Ann" || hist[1].Date.IsZero() {
+		t.Errorf("history %+v", hist)
+	}
+
+	tok, _ := acquireLock("note.md")
+	restore := func(rev, tok string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/restore?file=note.md&rev="+rev, nil)
+		req.Header.Set("X-Lock", tok)
+		handleRestore(rr, req)
+		return rr
+	}
+	for rev, code := range map[string]int{"--help": http.StatusBadRequest, "ffff": http.StatusNotFound} {
+		if rr := restore(rev, tok); rr.Code != code {
+			t.Errorf("rev %s: %d, want %d", rev, rr.Code, code)
+		}
+	}
+	if rr := restore(hist[1].Rev, "wrong"); rr.Code != http.StatusLocked {
+		t.Errorf("wrong token: %d", rr.Code)
+	}
+	rr = restore(hist[1].Rev[:7], tok)
+	if rr.Code != http.StatusOK || rr.Body.String() != "# First\n"+body {
+		t.Fatalf("restore: %d %q", rr.Code, rr.Body.String())
+	}
+	if b, _ := os.ReadFile("note.md"); string(b) != "# First\n"+body {
+		t.Errorf("note.md = %q", b)
+	}
+	if prev, ok := popUndo("note.md"); !ok || string(prev) != "# Working copy\n" {
+		t.Errorf("undo %q %v", prev, ok)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// checkHTML makes the server validate every page it exports and log the
+// problems found (see -check-html).
+var checkHTML bool
+
+// htmlProblem is a structural problem in an HTML document.
+type htmlProblem struct {
+	Line int
+	Msg  string
+}
+
+func (p htmlProblem) String() string { return fmt.Sprintf("line %d: %s", p.Line, p.Msg) }
+
+var (
+	voidElements = setOf("area", "base", "br", "col", "embed", "hr", "img", "input", "link", "meta", "source", "track", "wbr")
+	// Elements whose end tag may be left out
+	optionalEnd = setOf("html", "head", "body", "p", "li", "dt", "dd", "tr", "td", "th", "thead", "tbody", "tfoot", "option", "colgroup")
+	// Elements whose start tag closes an open <p>
+	closesP = setOf("address", "article", "aside", "blockquote", "details", "div", "dl", "fieldset", "figcaption", "figure",
+		"footer", "form", "h1", "h2", "h3", "h4", "h5", "h6", "header", "hr", "main", "nav", "ol", "p", "pre", "section", "table", "ul")
+	// Elements whose start tag closes an open sibling of the listed kinds
+	closesSibling = map[string]map[string]bool{
+		"li": setOf("li"), "dt": setOf("dt", "dd"), "dd": setOf("dt", "dd"),
+		"tr": setOf("tr", "td", "th"), "td": setOf("td", "th"), "th": setOf("td", "th"),
+		"thead": setOf("thead", "tbody", "tr", "td", "th"), "tbody": setOf("thead", "tbody", "tr", "td", "th"),
+		"tfoot": setOf("thead", "tbody", "tr", "td", "th"), "option": setOf("option"),
+	}
+	rawTextElements = setOf("script", "style", "textarea", "title")
+
+	tagNameRe = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9:-]*`)
+	idAttrRe  = regexp.MustCompile(`(?i)\sid\s*=\s*("[^"]*"|'[^']*'|[^\s>]+)`)
+)
+
+func setOf(names ...string) map[string]bool {
+	m := make(map[string]bool, len(names))
+	for _, n := range names {
+		m[n] = true
+	}
+	return m
+}
+
+// validateHTML checks that b is well formed enough to publish: tags and
+// comments are terminated, elements are closed in order (allowing the end
+// tags HTML lets you leave out), and ids are unique.
+func validateHTML(b []byte) []htmlProblem {
+	var problems []htmlProblem
+	type open struct {
+		name string
+		line int
+	}
+	var stack []open
+	ids := map[string]int{}
+	lineAt := func(i int) int { return bytes.Count(b[:i], []byte("\n")) + 1 }
+	report := func(i int, format string, args ...interface{}) {
+		problems = append(problems, htmlProblem{lineAt(i), fmt.Sprintf(format, args...)})
+	}
+	for i := 0; i < len(b); {
+		lt := bytes.IndexByte(b[i:], '<')
+		if lt < 0 {
+			break
+		}
+		i += lt
+		rest := b[i:]
+		switch {
+		case bytes.HasPrefix(rest, []byte("<!--")):
+			end := bytes.Index(rest[4:], []byte("-->"))
+			if end < 0 {
+				report(i, "unterminated comment")
+				return problems
+			}
+			i += 4 + end + 3
+			continue
+		case bytes.HasPrefix(rest, []byte("<!")), bytes.HasPrefix(rest, []byte("<?")):
+			end := bytes.IndexByte(rest, '>')
+			if end < 0 {
+				report(i, "unterminated declaration")
+				return problems
+			}
+			i += end + 1
+			continue
+		}
+		closing := bytes.HasPrefix(rest, []byte("</"))
+		nameStart := 1
+		if closing {
+			nameStart = 2
+		}
+		name := strings.ToLower(string(tagNameRe.Find(rest[nameStart:])))
+		if name == "" {
+			i++ // a stray "<" in text
+			continue
+		}
+		end := tagEnd(rest)
+		if end < 0 {
+			report(i, "unterminated <%s> tag", name)
+			return problems
+		}
+		tag := rest[:end+1]
+		start := i
+		i += end + 1
+
+		if closing {
+			found := -1
+			for j := len(stack) - 1; j >= 0; j-- {
+				if stack[j].name == name {
+					found = j
+					break
+				}
+			}
+			if found < 0 {
+				report(start, "stray </%s>", name)
+				continue
+			}
+			for j := len(stack) - 1; j > found; j-- {
+				if !optionalEnd[stack[j].name] {
+					report(stack[j].line, "<%s> not closed before </%s>", stack[j].name, name)
+				}
+			}
+			stack = stack[:found]
+			continue
+		}
+
+		if m := idAttrRe.FindSubmatch(tag); m != nil {
+			id := strings.Trim(string(m[1]), `"'`)
+			if first, dup := ids[id]; dup {
+				report(start, "duplicate id %q (first on line %d)", id, first)
+			} else {
+				ids[id] = lineAt(start)
+			}
+		}
+		if closesP[name] && len(stack) > 0 && stack[len(stack)-1].name == "p" {
+			stack = stack[:len(stack)-1]
+		}
+		if siblings := closesSibling[name]; siblings != nil {
+			for len(stack) > 0 && siblings[stack[len(stack)-1].name] {
+				stack = stack[:len(stack)-1]
+			}
+		}
+		if voidElements[name] || bytes.HasSuffix(tag, []byte("/>")) {
+			continue
+		}
+		if rawTextElements[name] {
+			closeTag := []byte("</" + name)
+			end := bytes.Index(bytes.ToLower(b[i:]), closeTag)
+			if end < 0 {
+				report(start, "<%s> not closed", name)
+				return problems
+			}
+			i += end
+			if close := tagEnd(b[i:]); close >= 0 {
+				i += close + 1
+			}
+			continue
+		}
+		stack = append(stack, open{name, lineAt(start)})
+	}
+	for _, o := range stack {
+		if !optionalEnd[o.name] {
+			problems = append(problems, htmlProblem{o.line, fmt.Sprintf("<%s> not closed", o.name)})
+		}
+	}
+	return problems
+}
+
+// tagEnd returns the index of the ">" ending the tag at the start of b,
+// skipping quoted attribute values, or -1.
+func tagEnd(b []byte) int {
+	var quote byte
+	for j := 1; j < len(b); j++ {
+		switch c := b[j]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return j
+		case c == '<':
+			return -1
+		}
+	}
+	return -1
+}
+
+// checkExports validates every generated HTML file under docsDir, writes
+// the problems to w, and returns how many it found.
+func checkExports(docsDir string, w io.Writer) (int, error) {
+	n := 0
+	err := walkExports(docsDir, func(p string, b []byte) {
+		for _, prob := range validateHTML(b) {
+			fmt.Fprintf(w, "%s:%d: %s\n", p, prob.Line, prob.Msg)
+			n++
+		}
+	})
+	return n, err
+}
+
+// walkExports calls fn with every generated HTML file under docsDir. Files
+// copied from _includes, such as header.html fragments, are skipped.
+func walkExports(docsDir string, fn func(path string, b []byte)) error {
+	return walkWorkspace(docsDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.EqualFold(filepath.Ext(p), ".html") {
+			return err
+		}
+		rel, _ := filepath.Rel(docsDir, p)
+		if _, err := os.Stat(wsPath(filepath.Join("_includes", rel))); err == nil {
+			return nil
+		}
+		b, err := os.ReadFile(wsPath(p))
+		if err != nil {
+			return err
+		}
+		fn(p, b)
+		return nil
+	})
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateHTML(t *testing.T) {
+	cases := []struct {
+		in   string
+		want []string
+	}{
+		{"<!DOCTYPE html>\n<html><head><title>a < b</title></head><body>\n<p>one<p>two\n<ul><li>x<li>y</ul>\n<img src=x><br/>\n<!-- <div> -->\n<script>if (a < b) {}</script>\n</body></html>", nil},
+		{"<table><tr><td>1<td>2<tr><td>3</table>", nil},
+		{"<svg><path d=\"M0 0\"/></svg><p title='a>b'>x</p>", nil},
+		{"<div>\n<p>x</p>\n", []string{"line 1: <div> not closed"}},
+		{"<p>a</em></p>", []string{"line 1: stray </em>"}},
+		{"<div><span>x</div>", []string{"line 1: <span> not closed before </div>"}},
+		{"<h2 id=\"a\">A</h2>\n<h2 id=a>B</h2>", []string{`line 2: duplicate id "a" (first on line 1)`}},
+		{"<p>x</p>\n<a href=\"y", []string{"line 2: unterminated <a> tag"}},
+		{"<p>x</p><!-- open", []string{"line 1: unterminated comment"}},
+		{"<style>p{}", []string{"line 1: <style> not closed"}},
+	}
+	for _, c := range cases {
+		var got []string
+		for _, p := range validateHTML([]byte(c.in)) {
+			got = append(got, p.String())
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q: got %q; want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestBuild_Check(t *testing.T) {
+	chdirTemp(t)
+	fakeCmarkOnPath(t)
+	if err := os.MkdirAll("_includes", 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, map[string]string{
+		"good.md": "fine",
+		filepath.Join("_includes", "header.html"): "<div class=\"wrap\">",
+		filepath.Join("_includes", "footer.html"): "</div>",
+	})
+	var out bytes.Buffer
+	if err := runBuild([]string{"-check"}, &out); err != nil {
+		t.Fatalf("clean build: %v\n%s", err, out.String())
+	}
+
+	writeFiles(t, map[string]string{"bad.md": "<div>"})
+	out.Reset()
+	err := runBuild([]string{"-check"}, &out)
+	if err == nil || !strings.Contains(out.String(), filepath.Join("docs", "bad.html")+":1: stray </p>") {
+		t.Fatalf("err = %v\n%s", err, out.String())
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Template hooks for multi-language sites.
+const (
+	hreflangHook  = "{{hreflang}}"  // <link rel="alternate" hreflang> tags
+	languagesHook = "{{languages}}" // language switcher
+)
+
+// pageLanguage splits a markdown filename into the name shared by its
+// translations and its language: with languages ["en", "de"], "guide.de.md"
+// is ("guide", "de") and "guide.md" is ("guide", "en"). Without configured
+// languages the language is "".
+func pageLanguage(name string) (base, lang string) {
+	base = strings.TrimSuffix(name, filepath.Ext(name))
+	if len(config.Languages) == 0 {
+		return base, ""
+	}
+	if ext := filepath.Ext(base); ext != "" {
+		for _, l := range config.Languages {
+			if strings.EqualFold(ext[1:], l) {
+				return strings.TrimSuffix(base, ext), l
+			}
+		}
+	}
+	return base, config.Languages[0]
+}
+
+// translationKey identifies the document d is a variant of: the base name of
+// its translation_of target, else its own base name.
+func translationKey(d docMeta) string {
+	name := d.Name
+	if d.TranslationOf != "" {
+		name = filepath.Base(d.TranslationOf)
+	}
+	base, _ := pageLanguage(name)
+	return base
+}
+
+// docLang is the language of d: its front matter lang, else the language of
+// its filename.
+func docLang(d docMeta) string {
+	if langCodeRe.MatchString(d.Lang) {
+		return d.Lang
+	}
+	_, lang := pageLanguage(d.Name)
+	return lang
+}
+
+// translations returns the variants of name in dir, including name itself,
+// keyed by language, plus the language of the original: the default
+// language when languages are configured, else the page the others name in
+// translation_of. Variants without a known language are left out.
+func translations(dir, name string) (map[string]string, string) {
+	out := map[string]string{}
+	docs, err := docIndex.refresh(dir)
+	if err != nil {
+		return out, ""
+	}
+	docs = publishedDocs(docs)
+	key := ""
+	for _, d := range docs {
+		if d.Name == name {
+			key = translationKey(d)
+		}
+	}
+	if key == "" {
+		return out, ""
+	}
+	original := ""
+	for _, d := range docs {
+		lang := docLang(d)
+		if lang == "" || translationKey(d) != key {
+			continue
+		}
+		if _, dup := out[lang]; !dup || d.Name == name {
+			out[lang] = d.Name
+		}
+		if d.TranslationOf == "" {
+			if base, _ := pageLanguage(d.Name); base == key {
+				original = lang
+			}
+		}
+	}
+	if len(config.Languages) > 0 {
+		original = config.Languages[0]
+	}
+	return out, original
+}
+
+// langCodeRe matches BCP 47 style language tags such as "de" or "pt-BR".
+var langCodeRe = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// exportTranslations re-exports the other variants of name so their hreflang
+// tags and switchers include it.
+func exportTranslations(cmark, name string) {
+	trans, _ := translations(".", name)
+	for _, f := range trans {
+		if f == name || loadIgnore(".").Match(f, false) {
+			continue
+		}
+		if err := exportMarkdownTo(cmark, f, filepath.Join(exportDir, htmlOutNameFor(f))); err != nil {
+			log.Printf("export error for %s: %v", f, err)
+		}
+	}
+}
+
+// languageLinks returns the hreflang tags and the switcher markup for the
+// page exported from name, or empty strings when it has no translations.
+func languageLinks(name string) (hreflang, switcher string) {
+	trans, original := translations(filepath.Dir(name), filepath.Base(name))
+	if len(trans) < 2 {
+		return "", ""
+	}
+	// Configured languages first, then the rest alphabetically
+	var langs []string
+	for _, l := range config.Languages {
+		if _, ok := trans[l]; ok {
+			langs = append(langs, l)
+		}
+	}
+	var rest []string
+	for l := range trans {
+		if !hasTag(langs, l) {
+			rest = append(rest, l)
+		}
+	}
+	sort.Strings(rest)
+	langs = append(langs, rest...)
+
+	var tags, nav strings.Builder
+	nav.WriteString(`<nav class="language-switcher">`)
+	for _, l := range langs {
+		f := trans[l]
+		href := html.EscapeString(htmlOutNameFor(f))
+		fmt.Fprintf(&tags, "<link rel=\"alternate\" hreflang=\"%s\" href=\"%s\">\n", l, href)
+		if l == original {
+			fmt.Fprintf(&tags, "<link rel=\"alternate\" hreflang=\"x-default\" href=\"%s\">\n", href)
+		}
+		if f == filepath.Base(name) {
+			fmt.Fprintf(&nav, ` <strong lang="%s">%s</strong>`, l, l)
+		} else {
+			fmt.Fprintf(&nav, ` <a href="%s" hreflang="%s" lang="%s">%s</a>`, href, l, l, l)
+		}
+	}
+	nav.WriteString(" </nav>\n")
+	return tags.String(), nav.String()
+}
+
+// applyLanguages adds hreflang tags and the language switcher to a page.
+// Without hooks, the tags go before </head> and the switcher above the
+// content.
+func applyLanguages(name string, header, footer, body []byte) ([]byte, []byte, []byte) {
+	hreflang, switcher := languageLinks(name)
+	if bytes.Contains(header, []byte(hreflangHook)) {
+		header = bytes.ReplaceAll(header, []byte(hreflangHook), []byte(hreflang))
+	} else if hreflang != "" {
+		header = insertBeforeTag(header, "</head>", hreflang)
+	}
+	if bytes.Contains(header, []byte(languagesHook)) || bytes.Contains(footer, []byte(languagesHook)) {
+		header = bytes.ReplaceAll(header, []byte(languagesHook), []byte(switcher))
+		footer = bytes.ReplaceAll(footer, []byte(languagesHook), []byte(switcher))
+	} else if switcher != "" {
+		body = append([]byte(switcher), body...)
+	}
+	return header, footer, body
+}
+
+// writeLanguageIndexes exports docs/index.<lang>.html for every configured
+// language, listing that language's pages by title. A language whose
+// index.<lang>.md exists keeps that page instead.
+func writeLanguageIndexes(cmark, docsDir string) {
+	if len(config.Languages) == 0 {
+		return
+	}
+	docs, err := docIndex.refresh(".")
+	if err != nil {
+		log.Printf("language indexes not written: %v", err)
+		return
+	}
+	docs = publishedDocs(docs)
+	pages := map[string][]docMeta{}
+	for _, d := range docs {
+		_, lang := pageLanguage(d.Name)
+		pages[lang] = append(pages[lang], d)
+	}
+	for _, lang := range config.Languages {
+		indexName := "index." + lang
+		if fileExistsLower(indexName + ".md") {
+			continue
+		}
+		list := pages[lang]
+		sort.Slice(list, func(i, j int) bool { return strings.ToLower(docTitle(list[i])) < strings.ToLower(docTitle(list[j])) })
+		var md strings.Builder
+		fmt.Fprintf(&md, "# %s\n\n", lang)
+		for _, d := range list {
+			fmt.Fprintf(&md, "- [%s](%s)\n", docTitle(d), htmlOutNameFor(d.Name))
+		}
+		page, err := renderPage(cmark, []byte(md.String()))
+		if err == nil {
+			err = os.WriteFile(wsPath(filepath.Join(docsDir, indexName+".html")), page, 0644)
+		}
+		if err != nil {
+			log.Printf("language index %s not written: %v", lang, err)
+		}
+	}
+}
+
+// docTitle is d's title, falling back to its filename.
+func docTitle(d docMeta) string {
+	if d.Title != "" {
+		return d.Title
+	}
+	return strings.TrimSuffix(d.Name, filepath.Ext(d.Name))
+}
+
+// rtlLanguages are the primary language subtags written right to left.
+var rtlLanguages = map[string]bool{
+	"ar": true, "arc": true, "ckb": true, "dv": true, "fa": true, "he": true,
+	"ps": true, "sd": true, "ug": true, "ur": true, "yi": true,
+}
+
+// textDirection returns "rtl" for right-to-left languages, else "ltr".
+func textDirection(lang string) string {
+	primary, _, _ := strings.Cut(strings.ToLower(lang), "-")
+	if rtlLanguages[primary] {
+		return "rtl"
+	}
+	return "ltr"
+}
+
+// pageLang returns the language of the page exported from name: its front
+// matter lang, else the language of its filename when languages are
+// configured.
+func pageLang(name string, md []byte) string {
+	fields, _ := parseFrontMatter(md)
+	if l := fields["lang"]; langCodeRe.MatchString(l) {
+		return l
+	}
+	if name == "" {
+		return ""
+	}
+	_, lang := pageLanguage(filepath.Base(name))
+	return lang
+}
+
+var htmlTagRe = regexp.MustCompile(`(?i)<html\b[^>]*>`)
+var langDirAttrRe = regexp.MustCompile(`(?i)\s(lang|dir)\s*=\s*("[^"]*"|'[^']*'|[^\s>]+)`)
+
+// setHTMLLang sets lang and dir on the first <html> element in b. It
+// reports false when b has no <html> element.
+func setHTMLLang(b []byte, lang string) ([]byte, bool) {
+	loc := htmlTagRe.FindIndex(b)
+	if loc == nil {
+		return b, false
+	}
+	tag := langDirAttrRe.ReplaceAll(b[loc[0]:loc[1]], nil)
+	attrs := fmt.Sprintf(` lang="%s"`, lang)
+	if dir := textDirection(lang); dir == "rtl" {
+		attrs += ` dir="rtl"`
+	}
+	tag = append(append(append([]byte{}, tag[:5]...), attrs...), tag[5:]...)
+	out := make([]byte, 0, len(b)+len(attrs))
+	out = append(out, b[:loc[0]]...)
+	out = append(out, tag...)
+	return append(out, b[loc[1]:]...), true
+}
+
+// applyPageLang marks a page with its language and direction: on the
+// header's <html> element, or on a wrapper around the content when there is
+// none.
+func applyPageLang(lang string, header, body []byte) ([]byte, []byte) {
+	if lang == "" {
+		return header, body
+	}
+	if h, ok := setHTMLLang(header, lang); ok {
+		return h, body
+	}
+	attrs := fmt.Sprintf(`lang="%s"`, lang)
+	if textDirection(lang) == "rtl" {
+		attrs += ` dir="rtl"`
+	}
+	return header, append(append([]byte("<div "+attrs+">\n"), body...), "</div>\n"...)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPageLanguage(t *testing.T) {
+	withConfig(t, siteConfig{Languages: []string{"en", "de", "pt-BR"}})
+	cases := []struct{ name, base, lang string }{
+		{"guide.md", "guide", "en"},
+		{"guide.de.md", "guide", "de"},
+		{"guide.DE.md", "guide", "de"},
+		{"guide.pt-BR.md", "guide", "pt-BR"},
+		{"guide.fr.md", "guide.fr", "en"},
+		{"v1.2.md", "v1.2", "en"},
+	}
+	for _, c := range cases {
+		if base, lang := pageLanguage(c.name); base != c.base || lang != c.lang {
+			t.Errorf("pageLanguage(%q) = %q, %q; want %q, %q", c.name, base, lang, c.base, c.lang)
+		}
+	}
+	config = siteConfig{}
+	if _, lang := pageLanguage("guide.de.md"); lang != "" {
+		t.Fatalf("no languages configured, got %q", lang)
+	}
+}
+
+func TestApplyLanguages(t *testing.T) {
+	chdirTemp(t)
+	withConfig(t, siteConfig{Languages: []string{"en", "de", "fr"}})
+	writeFiles(t, map[string]string{"guide.md": "a", "guide.de.md": "b", "other.md": "c"})
+
+	header, footer, body := applyLanguages("guide.de.md", []byte("<head></head>"), []byte("{{languages}}"), []byte("<p>x</p>"))
+	for _, want := range []string{
+		`<link rel="alternate" hreflang="en" href="guide.html">`,
+		`<link rel="alternate" hreflang="x-default" href="guide.html">`,
+		`<link rel="alternate" hreflang="de" href="guide.de.html">`,
+	} {
+		if !strings.Contains(string(header), want) {
+			t.Errorf("header missing %q: %s", want, header)
+		}
+	}
+	if strings.Contains(string(header), `hreflang="fr"`) {
+		t.Errorf("no French translation exists: %s", header)
+	}
+	if !strings.Contains(string(footer), `<a href="guide.html" hreflang="en" lang="en">en</a>`) || !strings.Contains(string(footer), `<strong lang="de">de</strong>`) {
+		t.Errorf("switcher = %s", footer)
+	}
+	if string(body) != "<p>x</p>" {
+		t.Errorf("switcher placed by hook should leave body alone: %s", body)
+	}
+
+	// Without a hook the switcher goes above the content
+	_, _, body = applyLanguages("guide.md", nil, nil, []byte("<p>x</p>"))
+	if !strings.HasPrefix(string(body), `<nav class="language-switcher">`) {
+		t.Errorf("body = %s", body)
+	}
+	// Untranslated pages are left alone
+	header, _, body = applyLanguages("other.md", []byte("<head></head>"), nil, []byte("<p>x</p>"))
+	if string(header) != "<head></head>" || string(body) != "<p>x</p>" {
+		t.Errorf("untranslated page changed: %s %s", header, body)
+	}
+}
+
+func TestWriteLanguageIndexes(t *testing.T) {
+	chdirTemp(t)
+	fakeCmarkOnPath(t)
+	cmark, err := exec.LookPath("cmark-gfm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	withConfig(t, siteConfig{Languages: []string{"en", "de"}})
+	writeFiles(t, map[string]string{"guide.md": "# Guide", "guide.de.md": "# Anleitung", "index.en.md": "# Home"})
+	if err := os.MkdirAll("docs", 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeLanguageIndexes(cmark, "docs")
+	if b, err := os.ReadFile(filepath.Join("docs", "index.de.html")); err != nil || !strings.Contains(string(b), "<p># de</p>") {
+		t.Fatalf("index.de.html = %q, %v", b, err)
+	}
+	if _, err := os.Stat(filepath.Join("docs", "index.en.html")); !os.IsNotExist(err) {
+		t.Fatalf("index.en.md exists, so no English index should be generated")
+	}
+}
+
+func TestLoadConfig_InvalidLanguage(t *testing.T) {
+	chdirTemp(t)
+	writeFiles(t, map[string]string{"minimark.json": `{"languages": ["en", "<de>"]}`})
+	if _, err := loadConfig("minimark.json"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestSetHTMLLang(t *testing.T) {
+	cases := []struct{ in, lang, want string }{
+		{"<!DOCTYPE html>\n<html>\n<head>", "ar", "<!DOCTYPE html>\n<html lang=\"ar\" dir=\"rtl\">\n<head>"},
+		{`<HTML lang="en" class="x">`, "he-IL", `<HTML lang="he-IL" dir="rtl" class="x">`},
+		{`<html dir='rtl' lang=en>`, "de", `<html lang="de">`},
+	}
+	for _, c := range cases {
+		got, ok := setHTMLLang([]byte(c.in), c.lang)
+		if !ok || string(got) != c.want {
+			t.Errorf("setHTMLLang(%q, %q) = %q, %v; want %q", c.in, c.lang, got, ok, c.want)
+		}
+	}
+	if _, ok := setHTMLLang([]byte("<h>H</h>"), "ar"); ok {
+		t.Error("no <html> element should report false")
+	}
+}
+
+func TestApplyPageLang(t *testing.T) {
+	withConfig(t, siteConfig{})
+	md := []byte("---\nlang: fa\n---\nسلام\n")
+	lang := pageLang("note.md", md)
+	if lang != "fa" {
+		t.Fatalf("lang = %q", lang)
+	}
+	header, body := applyPageLang(lang, []byte("<html><head></head><body>"), []byte("<p>x</p>"))
+	if !strings.Contains(string(header), `<html lang="fa" dir="rtl">`) || string(body) != "<p>x</p>" {
+		t.Fatalf("header = %q body = %q", header, body)
+	}
+	// Fragment pages get a wrapper
+	_, body = applyPageLang(lang, nil, []byte("<p>x</p>"))
+	if string(body) != "<div lang=\"fa\" dir=\"rtl\">\n<p>x</p></div>\n" {
+		t.Fatalf("body = %q", body)
+	}
+	// No language: untouched
+	header, body = applyPageLang(pageLang("note.md", []byte("x")), []byte("<html>"), []byte("x"))
+	if string(header) != "<html>" || string(body) != "x" {
+		t.Fatalf("header = %q body = %q", header, body)
+	}
+	// The filename's language applies when languages are configured
+	config = siteConfig{Languages: []string{"en", "he"}}
+	if got := pageLang("note.he.md", []byte("x")); got != "he" {
+		t.Fatalf("lang = %q", got)
+	}
+}
+
+func TestLanguageLinks_TranslationOf(t *testing.T) {
+	chdirTemp(t)
+	withConfig(t, siteConfig{})
+	writeFiles(t, map[string]string{
+		"setup.md":       "---\nlang: en\n---\n# Setup",
+		"einrichtung.md": "---\nlang: de\ntranslation_of: setup.md\n---\n# Einrichtung",
+		"installer.md":   "---\nlang: fr\ntranslation_of: setup.md\n---\n# Installer",
+		"other.md":       "---\nlang: de\n---\n# Other",
+	})
+	for _, name := range []string{"setup.md", "einrichtung.md", "installer.md"} {
+		hreflang, switcher := languageLinks(name)
+		for _, want := range []string{
+			`hreflang="de" href="einrichtung.html"`,
+			`hreflang="en" href="setup.html"`,
+			`hreflang="fr" href="installer.html"`,
+			`hreflang="x-default" href="setup.html"`,
+		} {
+			if !strings.Contains(hreflang, want) {
+				t.Errorf("%s: missing %q in %s", name, want, hreflang)
+			}
+		}
+		if strings.Contains(hreflang, "other.html") {
+			t.Errorf("%s: unrelated page linked", name)
+		}
+		if strings.Count(switcher, "<a ") != 2 || !strings.Contains(switcher, "<strong") {
+			t.Errorf("%s: switcher = %s", name, switcher)
+		}
+	}
+	if hreflang, _ := languageLinks("other.md"); hreflang != "" {
+		t.Errorf("other.md has no translations: %s", hreflang)
+	}
+}
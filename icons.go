@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+)
+
+// Icon files generated from the configured source image.
+const (
+	faviconName        = "favicon.ico"
+	appleTouchIconName = "apple-touch-icon.png"
+	manifestName       = "site.webmanifest"
+)
+
+var (
+	faviconSizes  = []int{16, 32, 48}
+	manifestSizes = []int{192, 512}
+)
+
+// iconTags returns the <head> markup referencing the generated icons, or ""
+// when no icon is configured.
+func iconTags() string {
+	if config.Icon == "" {
+		return ""
+	}
+	return `<link rel="icon" href="` + faviconName + `" sizes="any">
+<link rel="apple-touch-icon" href="` + appleTouchIconName + `">
+<link rel="manifest" href="` + manifestName + `">
+`
+}
+
+// writeSiteIcons generates favicon.ico, apple-touch-icon.png, the manifest
+// icons, and site.webmanifest in dstDir from the configured icon image.
+func writeSiteIcons(dstDir string) error {
+	if config.Icon == "" {
+		return nil
+	}
+	f, err := os.Open(wsPath(filepath.FromSlash(config.Icon)))
+	if err != nil {
+		return err
+	}
+	src, _, err := image.Decode(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("decode %s: %w", config.Icon, err)
+	}
+
+	var pngs [][]byte
+	for _, size := range faviconSizes {
+		b, err := encodePNG(resizeSquare(src, size))
+		if err != nil {
+			return err
+		}
+		pngs = append(pngs, b)
+	}
+	if err := os.WriteFile(wsPath(filepath.Join(dstDir, faviconName)), encodeICO(faviconSizes, pngs), 0644); err != nil {
+		return err
+	}
+	if err := writePNG(filepath.Join(dstDir, appleTouchIconName), resizeSquare(src, 180)); err != nil {
+		return err
+	}
+
+	type manifestIcon struct {
+		Src   string `json:"src"`
+		Sizes string `json:"sizes"`
+		Type  string `json:"type"`
+	}
+	var icons []manifestIcon
+	for _, size := range manifestSizes {
+		name := fmt.Sprintf("icon-%d.png", size)
+		if err := writePNG(filepath.Join(dstDir, name), resizeSquare(src, size)); err != nil {
+			return err
+		}
+		icons = append(icons, manifestIcon{Src: name, Sizes: fmt.Sprintf("%dx%d", size, size), Type: "image/png"})
+	}
+	name := siteName()
+	manifest, err := json.MarshalIndent(map[string]any{
+		"name":       name,
+		"short_name": name,
+		"icons":      icons,
+		"start_url":  ".",
+		"display":    "standalone",
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(wsPath(filepath.Join(dstDir, manifestName)), manifest, 0644)
+}
+
+// resizeSquare crops src to a centred square and scales it to size×size,
+// averaging the source pixels that fall in each target pixel.
+func resizeSquare(src image.Image, size int) *image.NRGBA {
+	b := src.Bounds()
+	side := b.Dx()
+	if b.Dy() < side {
+		side = b.Dy()
+	}
+	x0, y0 := b.Min.X+(b.Dx()-side)/2, b.Min.Y+(b.Dy()-side)/2
+	dst := image.NewNRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		sy0, sy1 := y0+y*side/size, y0+(y+1)*side/size
+		if sy1 <= sy0 {
+			sy1 = sy0 + 1
+		}
+		for x := 0; x < size; x++ {
+			sx0, sx1 := x0+x*side/size, x0+(x+1)*side/size
+			if sx1 <= sx0 {
+				sx1 = sx0 + 1
+			}
+			var r, g, bl, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			c := color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: uint16(a / n)}
+			dst.Set(x, y, c)
+		}
+	}
+	return dst
+}
+
+func encodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writePNG(path string, img image.Image) error {
+	b, err := encodePNG(img)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(wsPath(path), b, 0644)
+}
+
+// encodeICO packs PNG images into an .ico container, which all current
+// browsers accept.
+func encodeICO(sizes []int, pngs [][]byte) []byte {
+	var buf bytes.Buffer
+	le := binary.LittleEndian
+	_ = binary.Write(&buf, le, [3]uint16{0, 1, uint16(len(pngs))})
+	offset := 6 + 16*len(pngs)
+	for i, p := range pngs {
+		dim := uint8(sizes[i] % 256) // 0 means 256
+		_ = binary.Write(&buf, le, struct {
+			W, H, Colors, Reserved uint8
+			Planes, BitCount       uint16
+			Size, Offset           uint32
+		}{dim, dim, 0, 0, 1, 32, uint32(len(p)), uint32(offset)})
+		offset += len(p)
+	}
+	for _, p := range pngs {
+		buf.Write(p)
+	}
+	return buf.Bytes()
+}
+
+// siteName is the configured site name, defaulting to the workspace folder
+// name.
+func siteName() string {
+	if config.Name != "" {
+		return config.Name
+	}
+	if root, err := filepath.Abs(wsPath(".")); err == nil {
+		return filepath.Base(root)
+	}
+	return ""
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteSiteIcons(t *testing.T) {
+	chdirTemp(t)
+	src := image.NewNRGBA(image.Rect(0, 0, 64, 40))
+	f, err := os.Create("logo.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, src); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if err := os.MkdirAll("docs", 0755); err != nil {
+		t.Fatal(err)
+	}
+	withConfig(t, siteConfig{Icon: "logo.png", Name: "Notes"})
+	if err := writeSiteIcons("docs"); err != nil {
+		t.Fatal(err)
+	}
+
+	ico, err := os.ReadFile(filepath.Join("docs", faviconName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ, n := binary.LittleEndian.Uint16(ico[2:]), binary.LittleEndian.Uint16(ico[4:]); typ != 1 || int(n) != len(faviconSizes) {
+		t.Fatalf("bad ico header: type %d count %d", typ, n)
+	}
+	if ico[6] != 16 || ico[22] != 32 {
+		t.Fatalf("unexpected ico sizes %d %d", ico[6], ico[22])
+	}
+
+	af, err := os.Open(filepath.Join("docs", appleTouchIconName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer af.Close()
+	cfg, err := png.DecodeConfig(af)
+	if err != nil || cfg.Width != 180 || cfg.Height != 180 {
+		t.Fatalf("apple-touch-icon: %+v %v", cfg, err)
+	}
+
+	var m struct {
+		Name  string `json:"name"`
+		Icons []struct {
+			Src string `json:"src"`
+		} `json:"icons"`
+	}
+	b, _ := os.ReadFile(filepath.Join("docs", manifestName))
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Name != "Notes" || len(m.Icons) != len(manifestSizes) {
+		t.Fatalf("manifest = %+v", m)
+	}
+	for _, icon := range m.Icons {
+		if _, err := os.Stat(filepath.Join("docs", icon.Src)); err != nil {
+			t.Fatalf("manifest icon missing: %v", err)
+		}
+	}
+
+	h, _ := injectAssets([]byte("<head></head>"), nil)
+	if !strings.Contains(string(h), `rel="manifest"`) {
+		t.Fatalf("icon links not injected: %q", h)
+	}
+}
+
+func TestResizeSquare_Averages(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	// Left and right columns are cropped away; the centre is black and white
+	src.Set(1, 0, color.Black)
+	src.Set(1, 1, color.Black)
+	src.Set(2, 0, color.White)
+	src.Set(2, 1, color.White)
+	got := resizeSquare(src, 1).NRGBAAt(0, 0)
+	if got.A != 255 || got.R < 126 || got.R > 128 {
+		t.Fatalf("got %+v; want mid grey", got)
+	}
+}
+
+func TestWriteSiteIcons_NoIcon(t *testing.T) {
+	chdirTemp(t)
+	if err := writeSiteIcons("docs"); err != nil {
+		t.Fatal(err)
+	}
+	if iconTags() != "" {
+		t.Fatal("no tags expected without an icon")
+	}
+}
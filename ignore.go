@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// ignoreFileName lists gitignore-style patterns for paths that every
+// workspace scan (file listing, export, most-recent lookup) should skip.
+const ignoreFileName = ".minimarkignore"
+
+type ignoreRule struct {
+	re      *regexp.Regexp
+	negate  bool // "!pattern" re-includes a previously ignored path
+	dirOnly bool // "pattern/" only matches directories
+	hasDir  bool // pattern contains a slash and matches the full path
+}
+
+// ignoreMatcher holds the rules from a .minimarkignore file. A nil matcher
+// ignores nothing.
+type ignoreMatcher struct {
+	rules []ignoreRule
+}
+
+// loadIgnore reads the .minimarkignore file in dir. A missing or unreadable
+// file yields a nil matcher.
+func loadIgnore(dir string) *ignoreMatcher {
+	f, err := os.Open(wsPath(filepath.Join(dir, ignoreFileName)))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var m ignoreMatcher
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if r, ok := parseIgnoreRule(sc.Text()); ok {
+			m.rules = append(m.rules, r)
+		}
+	}
+	return &m
+}
+
+func parseIgnoreRule(line string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+	var r ignoreRule
+	if strings.HasPrefix(line, "!") {
+		r.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		r.hasDir = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+	re, err := regexp.Compile("^" + globToRegexp(line) + "$")
+	if err != nil {
+		return ignoreRule{}, false
+	}
+	r.re = re
+	return r, true
+}
+
+// globToRegexp translates a gitignore glob into a regular expression:
+// "*" and "?" stay within one path segment, "**" spans segments.
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			if class, end, ok := globClass(glob, i); ok {
+				b.WriteString(class)
+				i = end
+			} else {
+				b.WriteString(`\[`)
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// globClass translates the bracket expression starting at glob[i] into a
+// regular expression class and returns the index of its closing "]". A
+// leading "!" or "^" negates it, a "]" right after the opening is literal,
+// a backslash escapes the next character, and "/" is never matched, since
+// brackets stay within one path segment like "*" and "?" do.
+func globClass(glob string, i int) (string, int, bool) {
+	j := i + 1
+	negate := j < len(glob) && (glob[j] == '!' || glob[j] == '^')
+	if negate {
+		j++
+	}
+	type span struct{ lo, hi rune }
+	var spans []span
+	// next reads one possibly escaped character of the class
+	next := func() (rune, bool) {
+		if j < len(glob) && glob[j] == '\\' {
+			j++
+		}
+		if j >= len(glob) {
+			return 0, false
+		}
+		r, n := utf8.DecodeRuneInString(glob[j:])
+		j += n
+		return r, true
+	}
+	for first := true; ; first = false {
+		if j >= len(glob) {
+			return "", 0, false
+		}
+		if glob[j] == ']' && !first {
+			break
+		}
+		lo, ok := next()
+		if !ok {
+			return "", 0, false
+		}
+		hi := lo
+		if j+1 < len(glob) && glob[j] == '-' && glob[j+1] != ']' {
+			j++
+			if hi, ok = next(); !ok {
+				return "", 0, false
+			}
+		}
+		if lo <= hi {
+			spans = append(spans, span{lo, hi})
+		}
+	}
+	var b strings.Builder
+	b.WriteByte('[')
+	if negate {
+		b.WriteString("^/")
+	}
+	for _, sp := range spans {
+		// Keep "/" out of the characters matched
+		parts := []span{sp}
+		if !negate && sp.lo <= '/' && '/' <= sp.hi {
+			parts = []span{{sp.lo, '/' - 1}, {'/' + 1, sp.hi}}
+		}
+		for _, p := range parts {
+			if p.lo > p.hi {
+				continue
+			}
+			b.WriteString(classChar(p.lo))
+			if p.hi != p.lo {
+				b.WriteByte('-')
+				b.WriteString(classChar(p.hi))
+			}
+		}
+	}
+	if b.Len() == 1 {
+		// Only "/" was listed, which no segment holds
+		return `[^\x00-\x{10FFFF}]`, j, true
+	}
+	b.WriteByte(']')
+	return b.String(), j, true
+}
+
+// classChar quotes r for use inside a regular expression class.
+func classChar(r rune) string {
+	if strings.ContainsRune(`\]^-[`, r) {
+		return `\` + string(r)
+	}
+	return string(r)
+}
+
+// Match reports whether rel, a slash-separated path relative to the
+// workspace root, is ignored. A path is also ignored when any of its parent
+// directories is.
+func (m *ignoreMatcher) Match(rel string, isDir bool) bool {
+	if m == nil || len(m.rules) == 0 {
+		return false
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i := range parts {
+		last := i == len(parts)-1
+		if m.matchOne(strings.Join(parts[:i+1], "/"), parts[i], isDir || !last) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchOne applies the rules in order to a single path; the last matching
+// rule wins.
+func (m *ignoreMatcher) matchOne(path, name string, isDir bool) bool {
+	ignored := false
+	for _, r := range m.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		subject := name
+		if r.hasDir {
+			subject = path
+		}
+		if r.re.MatchString(subject) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
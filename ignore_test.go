@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestIgnoreMatcher(t *testing.T) {
+	chdirTemp(t)
+	rules := "# comment\n\nnode_modules/\n*.draft.md\n!keep.draft.md\n/templates/*.md\narchive/**/old.md\ndraft[!s].md\nlog[0-9].md\nx[\\]].md\na[--0]b.md\n"
+	if err := os.WriteFile(ignoreFileName, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := loadIgnore(".")
+	cases := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"note.md", false, false},
+		{"node_modules", true, true},
+		{"node_modules", false, false},
+		{"node_modules/pkg/readme.md", false, true},
+		{"sub/node_modules/x.md", false, true},
+		{"idea.draft.md", false, true},
+		{"keep.draft.md", false, false},
+		{"templates/post.md", false, true},
+		{"sub/templates/post.md", false, false},
+		{"archive/old.md", false, true},
+		{"archive/2020/01/old.md", false, true},
+		{"archive/new.md", false, false},
+		{"drafta.md", false, true},
+		{"drafts.md", false, false},
+		{"draft/.md", false, false},
+		{"log7.md", false, true},
+		{"logx.md", false, false},
+		{"x].md", false, true},
+		{`x\.md`, false, false},
+		{"a-b.md", false, true},
+		{"a0b.md", false, true},
+		{"a/b.md", false, false},
+	}
+	for _, c := range cases {
+		if got := m.Match(c.path, c.isDir); got != c.want {
+			t.Errorf("Match(%q, %v) = %v; want %v", c.path, c.isDir, got, c.want)
+		}
+	}
+}
+
+func TestIgnoreMatcher_NilAndMissing(t *testing.T) {
+	chdirTemp(t)
+	m := loadIgnore(".")
+	if m != nil || m.Match("anything.md", false) {
+		t.Fatalf("missing file should ignore nothing")
+	}
+}
+
+func TestIgnore_HonoredByScans(t *testing.T) {
+	chdirTemp(t)
+	if err := os.WriteFile(ignoreFileName, []byte("secret.md\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("a.md", []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("secret.md", []byte("s"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Make the ignored file the most recent
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes("secret.md", future, future); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := findLastMarkdownFile("."); err != nil || p != "a.md" {
+		t.Fatalf("findLastMarkdownFile = %q err=%v", p, err)
+	}
+	rr := httptest.NewRecorder()
+	handleFiles(rr, httptest.NewRequest(http.MethodGet, "/files", nil))
+	var files []string
+	if err := json.Unmarshal(rr.Body.Bytes(), &files); err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0] != "a.md" {
+		t.Fatalf("files = %v", files)
+	}
+	if fileExistsLower("secret.md") {
+		t.Fatalf("ignored file should be treated as absent")
+	}
+}
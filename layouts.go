@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// layoutsDir holds html/template layouts that wrap exported pages in place
+// of _includes/header.html and footer.html.
+const layoutsDir = "_layouts"
+
+// defaultLayout is used for pages without a layout: front matter field.
+const defaultLayout = "default"
+
+// layoutContentMark stands in for the page body while a layout runs, so the
+// output can be split into the header and footer the export works with.
+const layoutContentMark = "<!--minimark:content-->"
+
+// layoutData is what a layout sees as its dot.
+type layoutData struct {
+	Title   string
+	Content template.HTML
+	Date    string   // front matter date:, as 2006-01-02 when it parses
+	Tags    []string // front matter tags:
+	Name    string   // the source Markdown file
+	Fields  map[string]string
+}
+
+// pageLayout renders the layout for the page name, whose content is md,
+// and splits the result around {{ .Content }}. The layout is
+// _layouts/<layout>.html for a front matter layout:, else
+// _layouts/default.html; other files in _layouts can be pulled in with
+// {{ template "nav.html" . }}. It returns false when there is no such
+// layout or it fails, which is logged, so the includes are used instead.
+func pageLayout(name string, md []byte) (header, footer []byte, ok bool) {
+	fields, _ := parseFrontMatter(md)
+	layout := fields["layout"]
+	if layout == "" {
+		layout = defaultLayout
+	}
+	file, valid := partialPath(layout)
+	if !valid {
+		log.Printf("invalid layout name %q", layout)
+		return nil, nil, false
+	}
+	if _, err := os.Stat(wsPath(filepath.Join(layoutsDir, file))); err != nil {
+		return nil, nil, false
+	}
+	tmpl, err := template.ParseGlob(wsPath(filepath.Join(layoutsDir, "*.html")))
+	if err == nil && filepath.Dir(file) != "." {
+		tmpl, err = tmpl.ParseFiles(wsPath(filepath.Join(layoutsDir, file)))
+	}
+	if err != nil {
+		log.Printf("layout %s: %v", layout, err)
+		return nil, nil, false
+	}
+	date := fields["date"]
+	if t, ok := parseFrontMatterDate(date); ok {
+		date = t.Format("2006-01-02")
+	}
+	data := layoutData{
+		Title:   pageTitle(md),
+		Content: template.HTML(layoutContentMark),
+		Date:    date,
+		Tags:    frontMatterList(fields["tags"]),
+		Name:    filepath.ToSlash(name),
+		Fields:  fields,
+	}
+	var out bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&out, filepath.Base(file), data); err != nil {
+		log.Printf("layout %s: %v", layout, err)
+		return nil, nil, false
+	}
+	header, footer, found := bytes.Cut(out.Bytes(), []byte(layoutContentMark))
+	if !found {
+		log.Printf("layout %s has no {{ .Content }}; the page is added at the end", layout)
+	}
+	return header, footer, true
+}
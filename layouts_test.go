@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPageLayout(t *testing.T) {
+	chdirTemp(t)
+	if err := os.MkdirAll(layoutsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	md := []byte("---\ntitle: Trip <1>\ndate: 2024-05-01\ntags: [a, b]\nauthor: Ann\n---\n# Rome\n")
+	if _, _, ok := pageLayout("trip.md", md); ok {
+		t.Fatal("layout used without _layouts/default.html")
+	}
+	writeFiles(t, map[string]string{
+		filepath.Join(layoutsDir, "default.html"): `<title>{{ .Title }}</title>{{ template "by.html" . }}<time>{{ .Date }}</time>{{ .Content }}{{ range .Tags }}<i>{{ . }}</i>{{ end }}`,
+		filepath.Join(layoutsDir, "by.html"):      `<p>{{ .Fields.author }} ({{ .Name }})</p>`,
+		filepath.Join(layoutsDir, "post.html"):    `<main>{{ .Content }}</main>`,
+		filepath.Join(layoutsDir, "broken.html"):  `{{ .Missing }}`,
+	})
+	header, footer, ok := pageLayout("trip.md", md)
+	if !ok || string(header) != "<title>Trip &lt;1&gt;</title><p>Ann (trip.md)</p><time>2024-05-01</time>" || string(footer) != "<i>a</i><i>b</i>" {
+		t.Errorf("default layout = %q + %q, %v", header, footer, ok)
+	}
+
+	page, err := renderPageAs(builtinConverter, "post.md", []byte("---\nlayout: post\n---\n*hi*\n"))
+	if err != nil || !strings.Contains(string(page), "<main><p><em>hi</em></p>\n</main>") {
+		t.Errorf("post layout page = %q, %v", page, err)
+	}
+	for _, layout := range []string{"broken", "missing", "../x"} {
+		if _, _, ok := pageLayout("x.md", []byte("---\nlayout: "+layout+"\n---\n")); ok {
+			t.Errorf("layout %q used", layout)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// linkMeta is the preview information for an external URL.
+type linkMeta struct {
+	URL         string    `json:"url"`
+	Title       string    `json:"title"`
+	Description string    `json:"description,omitempty"`
+	Favicon     string    `json:"favicon,omitempty"`
+	Fetched     time.Time `json:"fetched"`
+}
+
+// linkMetaCache keeps fetched previews and persists them to
+// .minimark/linkmeta.json; entries older than linkMetaTTL are refetched.
+type linkMetaCache struct {
+	mu      sync.Mutex
+	entries map[string]linkMeta
+}
+
+var linkMetas = &linkMetaCache{}
+
+var linkMetaPath = filepath.Join(".minimark", "linkmeta.json")
+
+const (
+	linkMetaTTL       = 7 * 24 * time.Hour
+	linkMetaReadLimit = 512 << 10
+	maxDescription    = 300
+)
+
+var (
+	titleTagRe = regexp.MustCompile(`(?is)<title\b[^>]*>(.*?)</title>`)
+	metaTagRe  = regexp.MustCompile(`(?i)<meta\b([^>]*)>`)
+	spaceRunRe = regexp.MustCompile(`\s+`)
+)
+
+var linkMetaClient = &http.Client{Timeout: 10 * time.Second}
+
+// get returns the preview for u, fetching it when it is not cached or stale.
+func (c *linkMetaCache) get(u string) (linkMeta, error) {
+	c.mu.Lock()
+	c.load()
+	m, ok := c.entries[u]
+	c.mu.Unlock()
+	if ok && time.Since(m.Fetched) < linkMetaTTL {
+		return m, nil
+	}
+	m, err := fetchLinkMeta(u)
+	if err != nil {
+		return m, err
+	}
+	c.mu.Lock()
+	c.entries[u] = m
+	c.save()
+	c.mu.Unlock()
+	return m, nil
+}
+
+// load reads the persisted cache once. Callers hold mu.
+func (c *linkMetaCache) load() {
+	if c.entries != nil {
+		return
+	}
+	c.entries = map[string]linkMeta{}
+	if b, err := os.ReadFile(wsPath(linkMetaPath)); err == nil {
+		if err := json.Unmarshal(b, &c.entries); err != nil {
+			log.Printf("ignoring corrupt link preview cache: %v", err)
+			c.entries = map[string]linkMeta{}
+		}
+	}
+}
+
+// save persists the cache. Callers hold mu.
+func (c *linkMetaCache) save() {
+	b, err := json.Marshal(c.entries)
+	if err == nil {
+		err = os.MkdirAll(wsPath(filepath.Dir(linkMetaPath)), 0755)
+	}
+	if err == nil {
+		err = os.WriteFile(wsPath(linkMetaPath), b, 0644)
+	}
+	if err != nil {
+		log.Printf("link preview cache not saved: %v", err)
+	}
+}
+
+// fetchLinkMeta reads the title, description and favicon of the page at u,
+// preferring Open Graph tags.
+func fetchLinkMeta(u string) (linkMeta, error) {
+	m := linkMeta{URL: u, Fetched: time.Now()}
+	resp, err := linkMetaClient.Get(u)
+	if err != nil {
+		return m, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return m, fmt.Errorf("%s returned %s", u, resp.Status)
+	}
+	base := resp.Request.URL // after redirects
+	m.Favicon = base.ResolveReference(&url.URL{Path: "/favicon.ico"}).String()
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt != "text/html" && mt != "application/xhtml+xml" {
+		m.Title = pathTitle(base)
+		return m, nil
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, linkMetaReadLimit))
+	if err != nil {
+		return m, err
+	}
+	clean := func(s string) string {
+		return strings.TrimSpace(spaceRunRe.ReplaceAllString(html.UnescapeString(s), " "))
+	}
+	if t := titleTagRe.FindSubmatch(b); t != nil {
+		m.Title = clean(string(t[1]))
+	}
+	for _, tag := range metaTagRe.FindAllSubmatch(b, -1) {
+		attrs := tagAttrs(string(tag[1]))
+		key := strings.ToLower(attrs["property"] + attrs["name"])
+		switch v := clean(attrs["content"]); key {
+		case "og:title":
+			if v != "" {
+				m.Title = v
+			}
+		case "og:description":
+			if v != "" {
+				m.Description = v
+			}
+		case "description":
+			if m.Description == "" {
+				m.Description = v
+			}
+		}
+	}
+	for _, tag := range linkTagRe.FindAllSubmatch(b, -1) {
+		attrs := tagAttrs(string(tag[1]))
+		if rel := strings.Fields(strings.ToLower(attrs["rel"])); len(rel) > 0 && rel[len(rel)-1] == "icon" && attrs["href"] != "" {
+			if ref, err := url.Parse(attrs["href"]); err == nil {
+				m.Favicon = base.ResolveReference(ref).String()
+				break
+			}
+		}
+	}
+	if m.Title == "" {
+		m.Title = pathTitle(base)
+	}
+	if r := []rune(m.Description); len(r) > maxDescription {
+		m.Description = string(r[:maxDescription-1]) + "…"
+	}
+	return m, nil
+}
+
+// pathTitle names a page without a title after its host and last path
+// segment.
+func pathTitle(u *url.URL) string {
+	if seg := strings.Trim(u.Path, "/"); seg != "" {
+		return u.Host + ": " + seg[strings.LastIndex(seg, "/")+1:]
+	}
+	return u.Host
+}
+
+// linkedFromNotes reports whether any note links to u.
+func linkedFromNotes(u string) (bool, error) {
+	docs, err := docIndex.refresh(".")
+	if err != nil {
+		return false, err
+	}
+	for _, d := range docs {
+		for _, l := range d.Links {
+			if l == u {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// handleLinkMeta returns the preview for ?url= as JSON. Only external URLs
+// that a note links to are fetched, so the server is not an open proxy.
+func handleLinkMeta(w http.ResponseWriter, r *http.Request) {
+	u := r.URL.Query().Get("url")
+	if p, err := url.Parse(u); err != nil || (p.Scheme != "http" && p.Scheme != "https") || p.Host == "" {
+		http.Error(w, "invalid url", http.StatusBadRequest)
+		return
+	}
+	linked, err := linkedFromNotes(u)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !linked {
+		http.Error(w, "url is not linked from any note", http.StatusForbidden)
+		return
+	}
+	m, err := linkMetas.get(u)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(m)
+}
+
+// A paragraph holding only an external link, labelled or not.
+var cardLinkRe = regexp.MustCompile(`<p>(?:<a href="(https?://[^"]+)">([^<]*)</a>|(https?://[^\s<"]+))</p>`)
+
+// linkCards renders paragraphs that only hold an external link as preview
+// cards, when link_cards is enabled. Links whose preview can't be fetched
+// stay as they are.
+func linkCards(body []byte) []byte {
+	if !config.LinkCards {
+		return body
+	}
+	return cardLinkRe.ReplaceAllFunc(body, func(p []byte) []byte {
+		sub := cardLinkRe.FindSubmatch(p)
+		link, label := string(sub[1]), string(sub[2])
+		if link == "" {
+			link = string(sub[3])
+		}
+		link = html.UnescapeString(link)
+		// Like /linkmeta, only fetch pages a note links to, so rendering
+		// posted Markdown (e.g. /preview) cannot fetch arbitrary URLs
+		if linked, err := linkedFromNotes(link); err != nil || !linked {
+			return p
+		}
+		m, err := linkMetas.get(link)
+		if err != nil {
+			log.Printf("link card %s: %v", link, err)
+			return p
+		}
+		title := html.EscapeString(m.Title)
+		if label != "" && label != html.EscapeString(link) {
+			title = label // the author's label is already escaped
+		}
+		host := link
+		if u, err := url.Parse(link); err == nil {
+			host = u.Host
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, `<a class="link-card" href="%s">`, html.EscapeString(link))
+		if m.Favicon != "" {
+			fmt.Fprintf(&b, `<img class="link-card-icon" src="%s" alt="" role="presentation" width="16" height="16">`, html.EscapeString(m.Favicon))
+		}
+		fmt.Fprintf(&b, `<span class="link-card-title">%s</span>`, title)
+		if m.Description != "" {
+			fmt.Fprintf(&b, `<span class="link-card-description">%s</span>`, html.EscapeString(m.Description))
+		}
+		fmt.Fprintf(&b, `<span class="link-card-host">%s</span></a>`, html.EscapeString(host))
+		return []byte(b.String())
+	})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+)
+
+func linkPreviewServer(t *testing.T, hits *int) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*hits++
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(`<html><head><title>Plain  &amp; simple</title>
+<meta property="og:title" content="Rich &amp; Title">
+<meta name="description" content="About the page.">
+<link rel="shortcut icon" href="/static/fav.png"></head></html>`))
+		case "/file.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	linkMetas = &linkMetaCache{}
+	t.Cleanup(func() { linkMetas = &linkMetaCache{} })
+	return srv
+}
+
+func TestHandleLinkMeta(t *testing.T) {
+	chdirTemp(t)
+	docIndex = &metaIndex{}
+	hits := 0
+	srv := linkPreviewServer(t, &hits)
+	writeFiles(t, map[string]string{"a.md": "See [the page](" + srv.URL + "/page) and <" + srv.URL + "/file.pdf>"})
+
+	get := func(u string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handleLinkMeta(rr, httptest.NewRequest(http.MethodGet, "/linkmeta?url="+url.QueryEscape(u), nil))
+		return rr
+	}
+	rr := get(srv.URL + "/page")
+	var m linkMeta
+	if err := json.Unmarshal(rr.Body.Bytes(), &m); err != nil {
+		t.Fatalf("%d %s", rr.Code, rr.Body.String())
+	}
+	if m.Title != "Rich & Title" || m.Description != "About the page." || m.Favicon != srv.URL+"/static/fav.png" {
+		t.Fatalf("meta = %+v", m)
+	}
+	get(srv.URL + "/page")
+	if hits != 1 {
+		t.Fatalf("fetched %d times", hits)
+	}
+	// The cache is persisted
+	if _, err := os.Stat(linkMetaPath); err != nil {
+		t.Fatal(err)
+	}
+
+	rr = get(srv.URL + "/file.pdf")
+	if err := json.Unmarshal(rr.Body.Bytes(), &m); err != nil || m.Favicon != srv.URL+"/favicon.ico" {
+		t.Fatalf("pdf: %s", rr.Body.String())
+	}
+	if rr := get(srv.URL + "/elsewhere"); rr.Code != http.StatusForbidden {
+		t.Fatalf("unlinked url: %d", rr.Code)
+	}
+	if rr := get("file:///etc/passwd"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("file url: %d", rr.Code)
+	}
+}
+
+func TestLinkCards(t *testing.T) {
+	chdirTemp(t)
+	docIndex = &metaIndex{}
+	hits := 0
+	srv := linkPreviewServer(t, &hits)
+	writeFiles(t, map[string]string{"links.md": srv.URL + "/page\n\n" + srv.URL + "/missing\n"})
+	in := []byte("<p>" + srv.URL + "/page</p>\n<p><a href=\"" + srv.URL + "/page\">Mine</a></p>\n<p>see " + srv.URL + "/page</p>\n<p>" + srv.URL + "/missing</p>")
+	if got := linkCards(in); string(got) != string(in) {
+		t.Fatalf("disabled: %s", got)
+	}
+	withConfig(t, siteConfig{LinkCards: true})
+	host := srv.Listener.Addr().String()
+	card := func(title string) string {
+		return `<a class="link-card" href="` + srv.URL + `/page"><img class="link-card-icon" src="` + srv.URL + `/static/fav.png" alt="" role="presentation" width="16" height="16">` +
+			`<span class="link-card-title">` + title + `</span><span class="link-card-description">About the page.</span><span class="link-card-host">` + host + `</span></a>`
+	}
+	want := card("Rich &amp; Title") + "\n" + card("Mine") + "\n<p>see " + srv.URL + "/page</p>\n<p>" + srv.URL + "/missing</p>"
+	if got := string(linkCards(in)); got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+
+	// Pages no note links to are not fetched
+	hits = 0
+	other := "<p>" + srv.URL + "/other</p>"
+	if got := string(linkCards([]byte(other))); got != other || hits != 0 {
+		t.Fatalf("unlinked page: %s, %d fetches", got, hits)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// listQuery holds the sort and filter options accepted by /files and /open.
+type listQuery struct {
+	sort   string    // "alpha" (default), "recent", "created", or "size"
+	tag    string    // only files whose front matter tags include tag
+	folder string    // only files in this folder; the workspace is flat, so only "" or "."
+	since  time.Time // only files whose document time is at or after since
+}
+
+// hasListQuery reports whether q carries any sort or filter option.
+func hasListQuery(q url.Values) bool {
+	for _, k := range []string{"sort", "tag", "folder", "since"} {
+		if q.Get(k) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// parseListQuery validates the listing options in q. defaultSort applies
+// when no sort is given.
+func parseListQuery(q url.Values, defaultSort string) (listQuery, error) {
+	lq := listQuery{
+		sort:   q.Get("sort"),
+		tag:    strings.TrimSpace(q.Get("tag")),
+		folder: strings.Trim(q.Get("folder"), "/"),
+	}
+	if lq.sort == "" {
+		lq.sort = defaultSort
+	}
+	switch lq.sort {
+	case "alpha", "recent", "created", "size":
+	default:
+		return lq, fmt.Errorf("unknown sort %q", lq.sort)
+	}
+	if s := q.Get("since"); s != "" {
+		t, ok := parseFrontMatterDate(s)
+		if !ok {
+			return lq, fmt.Errorf("invalid since %q", s)
+		}
+		lq.since = t
+	}
+	return lq, nil
+}
+
+// queryMarkdownFiles lists the markdown files in dir that pass the filters
+// in lq, ordered by lq.sort.
+func queryMarkdownFiles(dir string, lq listQuery) ([]string, error) {
+	docs, err := queryMarkdownDocs(dir, lq)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(docs))
+	for _, d := range docs {
+		files = append(files, d.Name)
+	}
+	return files, nil
+}
+
+// queryMarkdownDocs is queryMarkdownFiles returning the files' entries in
+// the metadata index.
+func queryMarkdownDocs(dir string, lq listQuery) ([]docMeta, error) {
+	if lq.folder != "" && lq.folder != "." {
+		return []docMeta{}, nil
+	}
+	docs, err := docIndex.refresh(dir)
+	if err != nil {
+		return nil, err
+	}
+	type entry struct {
+		doc     docMeta
+		created time.Time // front matter date, else mtime
+	}
+	var entries []entry
+	for _, d := range docs {
+		if lq.tag != "" && !hasTag(d.Tags, lq.tag) {
+			continue
+		}
+		e := entry{doc: d, created: d.ModTime}
+		if !d.Date.IsZero() {
+			e.created = d.Date
+		}
+		if !lq.since.IsZero() && d.Updated.Before(lq.since) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		switch lq.sort {
+		case "recent":
+			return a.doc.Updated.After(b.doc.Updated)
+		case "created":
+			return a.created.After(b.created)
+		case "size":
+			return a.doc.Size > b.doc.Size
+		}
+		return strings.ToLower(a.doc.Name) < strings.ToLower(b.doc.Name)
+	})
+	out := make([]docMeta, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, e.doc)
+	}
+	return out, nil
+}
+
+// hasTag reports whether tags include tag (case-insensitive).
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// listFields are the per-file details /files returns on request with
+// fields=, keyed by field name.
+var listFields = map[string]func(d docMeta) any{
+	"name":  func(d docMeta) any { return d.Name },
+	"title": func(d docMeta) any { return docTitle(d) },
+	"html":  func(d docMeta) any { return htmlOutNameFor(d.Name) },
+	"tags": func(d docMeta) any {
+		if d.Tags == nil {
+			return []string{}
+		}
+		return d.Tags
+	},
+	"date": func(d docMeta) any {
+		if d.Date.IsZero() {
+			return nil
+		}
+		return d.Date
+	},
+	"updated":  func(d docMeta) any { return d.Updated },
+	"size":     func(d docMeta) any { return d.Size },
+	"words":    func(d docMeta) any { return d.Words },
+	"lang":     func(d docMeta) any { return d.Lang },
+	"category": func(d docMeta) any { return d.Category },
+}
+
+// listPage holds the pagination and field options of /files.
+type listPage struct {
+	limit  int // 0 for all remaining files
+	offset int
+	fields []string
+}
+
+// hasListPage reports whether q asks for a paged listing.
+func hasListPage(q url.Values) bool {
+	for _, k := range []string{"limit", "offset", "fields"} {
+		if q.Has(k) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseListPage validates the pagination and field options in q.
+func parseListPage(q url.Values) (listPage, error) {
+	p := listPage{fields: []string{"name"}}
+	for _, k := range []string{"limit", "offset"} {
+		v := q.Get(k)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || (k == "limit" && n == 0) {
+			return p, fmt.Errorf("invalid %s %q", k, v)
+		}
+		if k == "limit" {
+			p.limit = n
+		} else {
+			p.offset = n
+		}
+	}
+	if v := q.Get("fields"); v != "" {
+		p.fields = p.fields[:0]
+		for _, f := range strings.Split(v, ",") {
+			f = strings.TrimSpace(f)
+			if listFields[f] == nil {
+				return p, fmt.Errorf("unknown field %q", f)
+			}
+			p.fields = append(p.fields, f)
+		}
+	}
+	return p, nil
+}
+
+// fileListPage is a paged /files response.
+type fileListPage struct {
+	Files []map[string]any `json:"files"`
+	Total int              `json:"total"` // files matching the query
+	// NextOffset requests the following page; absent on the last one.
+	NextOffset int `json:"next_offset,omitempty"`
+}
+
+// paginate cuts the page p out of docs, keeping only the requested fields.
+func paginate(docs []docMeta, p listPage) fileListPage {
+	page := fileListPage{Files: []map[string]any{}, Total: len(docs)}
+	start := min(p.offset, len(docs))
+	end := len(docs)
+	if p.limit > 0 && start+p.limit < end {
+		end = start + p.limit
+		page.NextOffset = end
+	}
+	for _, d := range docs[start:end] {
+		f := make(map[string]any, len(p.fields))
+		for _, name := range p.fields {
+			f[name] = listFields[name](d)
+		}
+		page.Files = append(page.Files, f)
+	}
+	return page
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeListingFixtures(t *testing.T) {
+	t.Helper()
+	files := map[string]string{
+		"b.md": "---\ndate: 2020-01-01\nupdated: 2024-06-01\ntags: [go, notes]\n---\nbbbbbbbbbb",
+		"A.md": "---\ndate: 2022-01-01\ntags:\n  - journal\n---\na",
+		"c.md": "---\ndate: 2021-01-01\n---\nccccc",
+	}
+	for name, body := range files {
+		if err := os.WriteFile(name, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func getFiles(t *testing.T, query string) (int, []string) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	handleFiles(rr, httptest.NewRequest(http.MethodGet, "/files"+query, nil))
+	if rr.Code != http.StatusOK {
+		return rr.Code, nil
+	}
+	var files []string
+	if err := json.Unmarshal(rr.Body.Bytes(), &files); err != nil {
+		t.Fatal(err)
+	}
+	return rr.Code, files
+}
+
+func TestHandleFiles_SortAndFilter(t *testing.T) {
+	chdirTemp(t)
+	writeListingFixtures(t)
+	cases := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"A.md", "b.md", "c.md"}},
+		{"?sort=recent", []string{"b.md", "A.md", "c.md"}},
+		{"?sort=created", []string{"A.md", "c.md", "b.md"}},
+		{"?sort=size", []string{"b.md", "A.md", "c.md"}},
+		{"?tag=journal", []string{"A.md"}},
+		{"?tag=GO", []string{"b.md"}},
+		{"?since=2022-01-01&sort=recent", []string{"b.md", "A.md"}},
+		{"?folder=.", []string{"A.md", "b.md", "c.md"}},
+		{"?folder=sub", []string{}},
+	}
+	for _, c := range cases {
+		code, got := getFiles(t, c.query)
+		if code != http.StatusOK || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("/files%s = %d %v; want %v", c.query, code, got, c.want)
+		}
+	}
+	for _, q := range []string{"?sort=bogus", "?since=soon"} {
+		if code, _ := getFiles(t, q); code != http.StatusBadRequest {
+			t.Errorf("/files%s = %d; want 400", q, code)
+		}
+	}
+}
+
+func TestOpenLastMarkdown_WithFilters(t *testing.T) {
+	chdirTemp(t)
+	writeListingFixtures(t)
+	// Newest mtime on c.md must not matter once filters are given
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes("c.md", future, future); err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	openLastMarkdown(rr, httptest.NewRequest(http.MethodGet, "/open?tag=journal", nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("X-Filename") != "A.md" {
+		t.Fatalf("got %d %q", rr.Code, rr.Header().Get("X-Filename"))
+	}
+	rr = httptest.NewRecorder()
+	openLastMarkdown(rr, httptest.NewRequest(http.MethodGet, "/open?tag=none", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	openLastMarkdown(rr, httptest.NewRequest(http.MethodGet, "/open?sort=bogus", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rr.Code)
+	}
+}
+
+func TestHandleFiles_Paged(t *testing.T) {
+	chdirTemp(t)
+	writeListingFixtures(t)
+	getPage := func(query string) (int, fileListPage) {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		handleFiles(rr, httptest.NewRequest(http.MethodGet, "/files"+query, nil))
+		var p fileListPage
+		if rr.Code == http.StatusOK {
+			if err := json.Unmarshal(rr.Body.Bytes(), &p); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rr.Code, p
+	}
+	code, p := getPage("?limit=2")
+	if code != http.StatusOK || p.Total != 3 || p.NextOffset != 2 || !reflect.DeepEqual(p.Files, []map[string]any{{"name": "A.md"}, {"name": "b.md"}}) {
+		t.Fatalf("first page = %d %+v", code, p)
+	}
+	_, p = getPage("?limit=2&offset=2&fields=name,title,tags,size&sort=alpha")
+	want := []map[string]any{{"name": "c.md", "title": "c", "tags": []any{}, "size": float64(30)}}
+	if p.Total != 3 || p.NextOffset != 0 || !reflect.DeepEqual(p.Files, want) {
+		t.Fatalf("last page = %+v", p)
+	}
+	if _, p = getPage("?tag=go&fields=html,date"); len(p.Files) != 1 || p.Files[0]["html"] != "b.html" || p.Files[0]["date"] != "2020-01-01T00:00:00Z" {
+		t.Fatalf("filtered page = %+v", p)
+	}
+	if _, p = getPage("?offset=9"); p.Total != 3 || len(p.Files) != 0 {
+		t.Fatalf("past the end = %+v", p)
+	}
+	for _, bad := range []string{"?limit=0", "?limit=x", "?offset=-1", "?fields=name,secret"} {
+		if code, _ := getPage(bad); code != http.StatusBadRequest {
+			t.Errorf("%s: status %d", bad, code)
+		}
+	}
+}
+
+func TestHandleList(t *testing.T) {
+	chdirTemp(t)
+	writeListingFixtures(t)
+	if err := os.WriteFile("d.md", []byte("# Dee\n\ntext\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2024, 6, 1, 9, 30, 0, 0, time.UTC)
+	if err := os.Chtimes("d.md", mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handleList(rr, httptest.NewRequest(http.MethodGet, "/list?tag=go", nil))
+	var got []listEntry
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil || len(got) != 1 || got[0].Name != "b.md" {
+		t.Fatalf("filtered list = %+v, %v", got, err)
+	}
+	rr = httptest.NewRecorder()
+	handleList(rr, httptest.NewRequest(http.MethodGet, "/list", nil))
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil || len(got) != 4 {
+		t.Fatalf("list = %+v, %v", got, err)
+	}
+	if d := got[3]; d.Name != "d.md" || d.Title != "Dee" || d.Size != 12 || !d.MTime.Equal(mtime) {
+		t.Errorf("d.md entry = %+v", d)
+	}
+	rr = httptest.NewRecorder()
+	handleList(rr, httptest.NewRequest(http.MethodPost, "/list", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: %d", rr.Code)
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// liveReload makes pages previewed under /docs/ and /view/ reload when they are
+// re-exported, and re-exports the site when _includes or _data changes.
+var liveReload = true
+
+// includesPollInterval is how often _includes is checked for changes.
+var includesPollInterval = time.Second
+
+// liveReloadTag is added to HTML pages served under /docs/; exported files
+// are left alone.
+const liveReloadTag = `<script src="/livereload.js"></script>` + "\n"
+
+// reloadAll is the event sent when every page changed.
+const reloadAll = "*"
+
+// reloadHub fans reload events out to the connected /events clients.
+type reloadHub struct {
+	mu      sync.Mutex
+	clients map[chan string]bool
+}
+
+var reloads = &reloadHub{clients: map[chan string]bool{}}
+
+func (h *reloadHub) subscribe() chan string {
+	ch := make(chan string, 8)
+	h.mu.Lock()
+	h.clients[ch] = true
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *reloadHub) unsubscribe(ch chan string) {
+	h.mu.Lock()
+	delete(h.clients, ch)
+	h.mu.Unlock()
+}
+
+// broadcast tells clients that page (an HTML filename under docs, or
+// reloadAll) changed. Clients that fall behind miss events rather than
+// block the export.
+func (h *reloadHub) broadcast(page string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.clients {
+		select {
+		case ch <- page:
+		default:
+		}
+	}
+}
+
+// handleEvents streams reload events as server-sent events: "reload" with
+// the changed page as data, and "file" with a note changed on disk.
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	rc := http.NewResponseController(w)
+	// The stream outlives the server's write timeout
+	_ = rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	ch := reloads.subscribe()
+	defer reloads.unsubscribe(ch)
+	files := fileChanges.subscribe()
+	defer fileChanges.unsubscribe(files)
+	fmt.Fprint(w, "retry: 2000\n\n")
+	if err := rc.Flush(); err != nil {
+		return
+	}
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case page := <-ch:
+			fmt.Fprintf(w, "event: reload\ndata: %s\n\n", page)
+		case name := <-files:
+			fmt.Fprintf(w, "event: file\ndata: %s\n\n", name)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": ping\n\n")
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// withLiveReload adds liveReloadTag to the HTML pages served by next.
+func withLiveReload(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.Header.Get("Range") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		lw := &liveReloadWriter{ResponseWriter: w}
+		next.ServeHTTP(lw, r)
+		lw.finish()
+	})
+}
+
+// liveReloadWriter holds back successful HTML responses so the tag can be
+// inserted; everything else passes straight through.
+type liveReloadWriter struct {
+	http.ResponseWriter
+	status  int
+	html    bool
+	decided bool
+	buf     bytes.Buffer
+}
+
+func (l *liveReloadWriter) decide() {
+	if l.decided {
+		return
+	}
+	l.decided = true
+	if l.status == 0 {
+		l.status = http.StatusOK
+	}
+	l.html = l.status == http.StatusOK && strings.HasPrefix(l.Header().Get("Content-Type"), "text/html")
+	if !l.html {
+		l.ResponseWriter.WriteHeader(l.status)
+	}
+}
+
+func (l *liveReloadWriter) WriteHeader(status int) {
+	if l.status == 0 {
+		l.status = status
+	}
+}
+
+func (l *liveReloadWriter) Write(p []byte) (int, error) {
+	l.decide()
+	if l.html {
+		return l.buf.Write(p)
+	}
+	return l.ResponseWriter.Write(p)
+}
+
+func (l *liveReloadWriter) finish() {
+	l.decide()
+	if !l.html {
+		return
+	}
+	page := l.buf.Bytes()
+	if p := insertBeforeTag(page, "</body>", liveReloadTag); len(p) > len(page) {
+		page = p
+	} else {
+		page = append(page, liveReloadTag...)
+	}
+	l.Header().Set("Content-Length", strconv.Itoa(len(page)))
+	l.ResponseWriter.WriteHeader(l.status)
+	_, _ = l.ResponseWriter.Write(page)
+}
+
+// exportSite rebuilds docs from scratch: every page, then the includes,
+// configured assets and uploads.
+func exportSite() {
+	exportMu.Lock()
+	defer exportMu.Unlock()
+	if err := cleanAndExportAll(exportDir); err != nil {
+		log.Printf("docs export failed: %v", err)
+	}
+	// Copy any local includes to docs (best-effort), after cleaning
+	if err := copyIncludesToDocs("_includes", exportDir); err != nil {
+		log.Printf("copy includes failed: %v", err)
+	}
+	if err := copyConfigAssets(exportDir); err != nil {
+		log.Printf("copy configured assets failed: %v", err)
+	}
+	if err := copyUploads(exportDir); err != nil {
+		log.Printf("copy uploads failed: %v", err)
+	}
+}
+
+// includesState summarizes the files below dir by name, size and mtime; it
+// changes whenever one is added, removed or edited.
+func includesState(dir string) string {
+	var b strings.Builder
+	_ = walkWorkspace(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := os.Stat(wsPath(path)); err == nil && !info.IsDir() {
+			fmt.Fprintf(&b, "%s %d %d\n", path, info.Size(), info.ModTime().UnixNano())
+		}
+		return nil
+	})
+	return b.String()
+}
+
+// watchIncludes polls dir and calls changed after it was modified, until
+// stop is closed; with a nil stop it never returns.
+func watchIncludes(dir string, changed func(), stop <-chan struct{}) {
+	last := includesState(dir)
+	tick := time.NewTicker(includesPollInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-tick.C:
+		}
+		if cur := includesState(dir); cur != last {
+			last = cur
+			changed()
+		}
+	}
+}
+
+// reloadIncludes re-exports the site after _includes or _data changed and
+// tells previews to reload.
+func reloadIncludes() {
+	log.Printf("layout files changed; re-exporting docs")
+	exportSite()
+	reloads.broadcast(reloadAll)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithLiveReload_TagsHTMLOnly(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "page.html"), []byte("<html><body><p>hi</p></body></html>"), 0644)
+	os.WriteFile(filepath.Join(dir, "site.css"), []byte("body{}"), 0644)
+	h := withLiveReload(http.FileServer(http.Dir(dir)))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/page.html", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status %d", rr.Code)
+	}
+	if body := rr.Body.String(); !strings.Contains(body, liveReloadTag+"</body>") {
+		t.Fatalf("tag not inserted before </body>: %q", body)
+	}
+	if got := rr.Header().Get("Content-Length"); got != "" && got != strconv.Itoa(rr.Body.Len()) {
+		t.Fatalf("Content-Length %s for %d bytes", got, rr.Body.Len())
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/site.css", nil))
+	if rr.Body.String() != "body{}" {
+		t.Fatalf("css changed: %q", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/missing.html", nil))
+	if rr.Code != http.StatusNotFound || strings.Contains(rr.Body.String(), "livereload") {
+		t.Fatalf("404 got %d %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestHandleEvents_StreamsBroadcasts(t *testing.T) {
+	srv := httptest.NewServer(compression(http.HandlerFunc(handleEvents)))
+	defer srv.Close()
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type %q", ct)
+	}
+	sc := bufio.NewScanner(res.Body)
+	// The retry line arrives once the client is subscribed
+	for sc.Scan() && sc.Text() != "" {
+	}
+	reloads.broadcast("page.html")
+	var lines []string
+	for sc.Scan() && sc.Text() != "" {
+		lines = append(lines, sc.Text())
+	}
+	if got := strings.Join(lines, "\n"); got != "event: reload\ndata: page.html" {
+		t.Fatalf("event %q", got)
+	}
+}
+
+func TestWatchIncludes_NotifiesOnChange(t *testing.T) {
+	old := includesPollInterval
+	includesPollInterval = 10 * time.Millisecond
+	defer func() { includesPollInterval = old }()
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "header.html"), []byte("<header>"), 0644)
+	changed := make(chan bool, 1)
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		watchIncludes(dir, func() {
+			select {
+			case changed <- true:
+			default:
+			}
+		}, stop)
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+	time.Sleep(30 * time.Millisecond)
+	os.WriteFile(filepath.Join(dir, "footer.html"), []byte("<footer>"), 0644)
+	select {
+	case <-changed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("change to includes not noticed")
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// activeLock is one entry of the GET /locks response.
+type activeLock struct {
+	File    string    `json:"file"`
+	Expires time.Time `json:"expires"`
+	// Owner identifies the lock holder without revealing its token.
+	Owner  string    `json:"owner"`
+	Editor string    `json:"editor,omitempty"` // from X-Editor
+	Since  time.Time `json:"since"`
+}
+
+// lockOwner returns a short fingerprint of a lock token.
+func lockOwner(tok string) string {
+	sum := sha256.Sum256([]byte(tok))
+	return hex.EncodeToString(sum[:4])
+}
+
+// adminAuthorized reports whether r carries the admin token from
+// MINIMARK_ADMIN_TOKEN as a bearer token. Without it set, nobody is.
+func adminAuthorized(r *http.Request) bool {
+	want := os.Getenv("MINIMARK_ADMIN_TOKEN")
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return want != "" && ok && subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+// handleLocks lists the locks that have not expired, by file.
+func handleLocks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(activeLocks())
+}
+
+// activeLocks returns the locks that have not expired, by file.
+func activeLocks() []activeLock {
+	now := time.Now()
+	active := []activeLock{}
+	locksMu.Lock()
+	for name, li := range locks {
+		if now.Before(li.expires) {
+			active = append(active, activeLock{File: name, Expires: li.expires, Owner: lockOwner(li.token), Editor: li.editor, Since: li.since})
+		}
+	}
+	locksMu.Unlock()
+	sort.Slice(active, func(i, j int) bool { return active[i].File < active[j].File })
+	return active
+}
+
+// handleBreakLock drops the lock on `file` whoever holds it, e.g. one left
+// by a crashed client with a long TTL. It needs the admin token.
+func handleBreakLock(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminAuthorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="minimark"`)
+		http.Error(w, "admin token required", http.StatusUnauthorized)
+		return
+	}
+	name := r.URL.Query().Get("file")
+	if name == "" || filepath.Base(name) != name {
+		http.Error(w, "invalid filename", http.StatusBadRequest)
+		return
+	}
+	locksMu.Lock()
+	li, ok := locks[name]
+	if ok {
+		delete(locks, name)
+		stateChanged()
+	}
+	locksMu.Unlock()
+	if !ok || time.Now().After(li.expires) {
+		http.Error(w, "not locked", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandleLocks(t *testing.T) {
+	chdirTemp(t)
+	locks = map[string]lockInfo{
+		"b.md":    {token: "tok-b", expires: time.Now().Add(time.Minute)},
+		"a.md":    {token: "tok-a", expires: time.Now().Add(time.Minute)},
+		"gone.md": {token: "tok-c", expires: time.Now().Add(-time.Second)},
+	}
+	rr := httptest.NewRecorder()
+	handleLocks(rr, httptest.NewRequest(http.MethodGet, "/locks", nil))
+	var got []activeLock
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].File != "a.md" || got[1].File != "b.md" {
+		t.Fatalf("locks = %+v", got)
+	}
+	if got[0].Owner != lockOwner("tok-a") || got[0].Owner == "tok-a" {
+		t.Errorf("owner = %q", got[0].Owner)
+	}
+}
+
+func TestHandleBreakLock(t *testing.T) {
+	chdirTemp(t)
+	locks = map[string]lockInfo{"a.md": {token: "tok", expires: time.Now().Add(time.Hour)}}
+	breakLock := func(file, auth string) int {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/locks/break?file="+file, nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		handleBreakLock(rr, req)
+		return rr.Code
+	}
+	t.Setenv("MINIMARK_ADMIN_TOKEN", "")
+	if code := breakLock("a.md", "Bearer "); code != http.StatusUnauthorized {
+		t.Fatalf("without admin token configured = %d", code)
+	}
+	t.Setenv("MINIMARK_ADMIN_TOKEN", "secret")
+	for _, auth := range []string{"", "Bearer wrong", "secret"} {
+		if code := breakLock("a.md", auth); code != http.StatusUnauthorized {
+			t.Errorf("auth %q = %d", auth, code)
+		}
+	}
+	if !hasValidLock("a.md", "tok") {
+		t.Fatal("lock broken without authorization")
+	}
+	if code := breakLock("../a.md", "Bearer secret"); code != http.StatusBadRequest {
+		t.Errorf("bad filename = %d", code)
+	}
+	if code := breakLock("a.md", "Bearer secret"); code != http.StatusNoContent {
+		t.Fatalf("break = %d", code)
+	}
+	if hasValidLock("a.md", "tok") {
+		t.Error("lock still held")
+	}
+	if code := breakLock("a.md", "Bearer secret"); code != http.StatusNotFound {
+		t.Errorf("break unlocked file = %d", code)
+	}
+}
@@ -1,24 +1,28 @@
 package main
 
 import (
+	"bytes"
 	"crypto/rand"
+	"crypto/sha256"
 	"embed"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"io/fs"
 	"log"
+	"mime"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
-	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode"
 )
 
 //go:embed static/*
@@ -26,47 +30,214 @@ var embeddedIncludes embed.FS
 
 func main() {
 	addr := flag.String("addr", "localhost:8080", "address to listen on, e.g. localhost:8080 or 127.0.0.1:8080")
-	exportHTML := flag.Bool("export", true, "export HTML to ./docs using cmark-gfm on save")
+	exportHTML := flag.Bool("export", true, "export HTML to ./docs, or the -out folder, on save")
+	flag.BoolVar(&preferCmark, "cmark", false, "render Markdown with cmark-gfm, when installed, instead of the built-in renderer")
+	flag.StringVar(&converterFlag, "converter", "", "render Markdown with this command, e.g. 'pandoc -f gfm -t html5 {input}'")
+	flag.BoolVar(&readerHTML, "reader", false, "also export a reader-mode page per file to ./docs/reader")
+	flag.BoolVar(&printBreaks, "print-breaks", false, "start each top-level section of exported pages on a new printed page")
+	flag.BoolVar(&checkHTML, "check-html", false, "validate exported pages and log structural HTML problems")
+	flag.BoolVar(&embedCSV, "embed-csv", false, "render paragraphs that only link to a local .csv file as tables")
+	flag.BoolVar(&numberFigures, "number-figures", false, "number the captions of exported figures")
+	flag.StringVar(&siteTheme, "theme", "", "bundled look for exports when there is no _includes: docs, blog or plain")
+	flag.StringVar(&colorScheme, "color-scheme", schemeAuto, "default color scheme of exported pages: auto, light or dark")
+	flag.BoolVar(&liveReload, "live-reload", true, "reload previews under /docs/ on export, and re-export when notes, _includes or _data change on disk")
+	flag.StringVar(&symlinkPolicy, "symlinks", symlinksFollow, "symlink handling when scanning and copying: follow or skip")
+	flag.DurationVar(&serverOpts.ReadHeaderTimeout, "read-header-timeout", 10*time.Second, "time allowed to read request headers (0 for no limit)")
+	flag.DurationVar(&serverOpts.ReadTimeout, "read-timeout", time.Minute, "time allowed to read a whole request (0 for no limit)")
+	flag.DurationVar(&serverOpts.WriteTimeout, "write-timeout", 2*time.Minute, "time allowed to handle a request and write the response (0 for no limit)")
+	flag.DurationVar(&serverOpts.IdleTimeout, "idle-timeout", 2*time.Minute, "time an idle keep-alive connection is kept open (0 for no limit)")
+	flag.IntVar(&serverOpts.MaxHeaderBytes, "max-header-bytes", http.DefaultMaxHeaderBytes, "maximum size of request headers in bytes")
+	flag.BoolVar(&serverOpts.HTTP2, "http2", true, "allow HTTP/2 (only served over TLS)")
+	flag.StringVar(&serverOpts.TLSCert, "tls-cert", "", "serve HTTPS with this certificate file (requires -tls-key)")
+	flag.StringVar(&serverOpts.TLSKey, "tls-key", "", "private key file for -tls-cert")
+	keyFile := flag.String("key-file", "", "file holding the key for encrypted notes (default: $MINIMARK_PASSPHRASE)")
+	flag.StringVar(&outFlag, "out", "", "folder inside -dir to export HTML to (default: docs)")
+	flag.StringVar(&workspaceDir, "dir", "", "directory of notes to serve (default: the current directory)")
+	flag.DurationVar(&lockTTL, "lock-ttl", lockTTL, "how long an editor's file lock lasts without a refresh")
+	flag.DurationVar(&maxLockTTL, "max-lock-ttl", maxLockTTL, "longest lock TTL clients may ask for with /lock?ttl=")
 	flag.Parse()
+	if err := enterWorkspace(workspaceDir, &serverOpts.TLSCert, &serverOpts.TLSKey, keyFile); err != nil {
+		fmt.Fprintf(os.Stderr, "minimark: %v\n", err)
+		os.Exit(2)
+	}
+	if err := validServerOptions(serverOpts); err != nil {
+		fmt.Fprintf(os.Stderr, "minimark: %v\n", err)
+		os.Exit(2)
+	}
+	if err := validSymlinkPolicy(symlinkPolicy); err != nil {
+		fmt.Fprintf(os.Stderr, "minimark: %v\n", err)
+		os.Exit(2)
+	}
+	if err := validSiteTheme(siteTheme); err != nil {
+		fmt.Fprintf(os.Stderr, "minimark: %v\n", err)
+		os.Exit(2)
+	}
+	if err := validColorScheme(colorScheme); err != nil {
+		fmt.Fprintf(os.Stderr, "minimark: %v\n", err)
+		os.Exit(2)
+	}
+	if err := validateOut(outFlag); err != nil {
+		fmt.Fprintf(os.Stderr, "minimark: %v\n", err)
+		os.Exit(2)
+	}
+	if err := validLockTTL(lockTTL, maxLockTTL); err != nil {
+		fmt.Fprintf(os.Stderr, "minimark: %v\n", err)
+		os.Exit(2)
+	}
+
+	c, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "minimark: %v\n", err)
+		os.Exit(2)
+	}
+	config = c
+	setExportDir()
+	// Client subcommands only talk to a running server, so the converter
+	// and the note key are checked for the server and local renders alone.
+	// The converter may come from either the flag or the config, so it is
+	// checked once they are merged
+	args := flag.Args()
+	if len(args) == 0 || localSubcommand(args[0]) {
+		if err := checkConverter(); err != nil {
+			fmt.Fprintf(os.Stderr, "minimark: %v\n", err)
+			os.Exit(2)
+		}
+		if err := loadNoteSecret(*keyFile); err != nil {
+			fmt.Fprintf(os.Stderr, "minimark: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	// Subcommands (cat, put, ls, ...) talk to a running server and exit.
+	if len(args) > 0 {
+		ok, err := runSubcommand(args, os.Stdin, os.Stdout)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "minimark: unknown command %q\n", args[0])
+			os.Exit(2)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "minimark: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	http.Handle("/", rootHandler())
-	http.Handle("/docs/", http.StripPrefix("/docs/", http.FileServer(http.Dir("docs"))))
-	http.HandleFunc("/new", handleNew)
-	http.HandleFunc("/open", openLastMarkdown)
-	http.HandleFunc("/files", handleFiles)
-	http.HandleFunc("/index", handleLoadIndex)
-	http.HandleFunc("/save", handleSave)
-	http.HandleFunc("/lock", handleLock)
-	http.HandleFunc("/unlock", handleUnlock)
-
-	// Discover cmark-gfm availability
+	// Restore locks, sessions, pins, and recent files from the last run
+	if p, err := filepath.Abs(wsPath(filepath.Join(".minimark", "state.json"))); err == nil {
+		statePath = p
+		if err := loadState(); err != nil {
+			log.Printf("state not restored: %v", err)
+		}
+	}
+
+	// Pick the Markdown renderer
 	if *exportHTML {
-		if path, err := exec.LookPath("cmark-gfm"); err == nil {
-			cmarkPath = path
-			log.Printf("cmark-gfm found at %s; will export HTML on save.", path)
-		} else {
-			log.Printf("cmark-gfm not found; docs will not be exported. Install cmark-gfm to enable exports.")
+		cmarkPath = findConverter()
+		switch {
+		case converterTemplate() != "":
+			log.Printf("Exporting HTML on save with %q.", cmarkPath)
+		case cmarkPath != builtinConverter:
+			log.Printf("cmark-gfm found at %s; will export HTML on save.", cmarkPath)
+		case preferCmark:
+			log.Printf("cmark-gfm not found; exporting HTML on save with the built-in renderer.")
+		default:
+			log.Printf("Exporting HTML on save with the built-in renderer.")
 		}
 	} else {
 		log.Printf("HTML export disabled by flag.")
 	}
 
-	// Clean docs and export all current markdown files on startup
-	if err := cleanAndExportAll("docs"); err != nil {
-		log.Printf("initial docs export failed: %v", err)
-	}
-	// Copy any local includes to docs on startup (best-effort), after cleaning
-	if err := copyIncludesToDocs("_includes", "docs"); err != nil {
-		log.Printf("copy includes failed: %v", err)
+	// Clean docs and export all current markdown files on startup; later
+	// exports run in the background
+	exportSite()
+	exports = newExportQueue()
+	go exports.run()
+	go watchPresence()
+	if liveReload {
+		go watchIncludes("_includes", reloadIncludes, nil)
+		go watchIncludes(layoutsDir, reloadIncludes, nil)
+		go watchNotes()
+		go watchIncludes(dataDir, reloadIncludes, nil)
 	}
 
-	log.Printf("Serving embedded UI on http://%s\n", *addr)
-	if err := http.ListenAndServe(*addr, nil); err != nil {
+	scheme := "http"
+	if serverOpts.TLSCert != "" {
+		scheme = "https"
+	}
+	log.Printf("Serving embedded UI on %s://%s\n", scheme, *addr)
+	if err := serve(newServer(*addr, securityHeaders(compression(newMux())), serverOpts), serverOpts); err != nil {
 		log.Fatal(err)
 	}
 }
 
+// newMux registers all HTTP routes served by the editor.
+func newMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/", rootHandler())
+	var docs http.Handler = http.StripPrefix("/docs/", http.FileServer(http.Dir(wsPath(exportDir))))
+	view := viewHandler()
+	if liveReload {
+		docs = withLiveReload(docs)
+		view = withLiveReload(view)
+	}
+	mux.Handle("/docs/", docs)
+	mux.Handle("/view/", view)
+	mux.HandleFunc("/events", handleEvents)
+	mux.HandleFunc("/export/status", handleExportStatus)
+	mux.HandleFunc("/ws", handleWebSocket)
+	mux.HandleFunc("/new", handleNew)
+	mux.HandleFunc("/open", openLastMarkdown)
+	mux.HandleFunc("/files", handleFiles)
+	mux.HandleFunc("/list", handleList)
+	mux.HandleFunc("/index", handleLoadIndex)
+	mux.HandleFunc("/save", handleSave)
+	mux.HandleFunc("/patch", handlePatch)
+	mux.HandleFunc("/diff", handleDiff)
+	mux.HandleFunc("/lock", handleLock)
+	mux.HandleFunc("/unlock", handleUnlock)
+	mux.HandleFunc("/locks", handleLocks)
+	mux.HandleFunc("/locks/break", handleBreakLock)
+	mux.HandleFunc("/delete", handleDelete)
+	mux.HandleFunc("/rename", handleRename)
+	mux.HandleFunc("/session", handleSession)
+	mux.HandleFunc("/undo", handleUndo)
+	mux.HandleFunc("/history", handleHistory)
+	mux.HandleFunc("/restore", handleRestore)
+	mux.HandleFunc("/recovery", handleRecovery)
+	mux.HandleFunc("/snapshots", handleSnapshots)
+	mux.HandleFunc("/upload", handleUpload)
+	mux.HandleFunc("/attachments", handleAttachments)
+	mux.HandleFunc("/attachments/delete", handleDeleteAttachment)
+	mux.HandleFunc("/preview", handlePreview)
+	mux.HandleFunc("/outline", handleOutline)
+	mux.HandleFunc("/search", handleSearch)
+	mux.HandleFunc("/replace", handleReplace)
+	mux.HandleFunc("/batch", handleBatch)
+	mux.HandleFunc("/split", handleSplit)
+	mux.HandleFunc("/merge", handleMerge)
+	mux.HandleFunc("/backlinks", handleBacklinks)
+	mux.HandleFunc("/linkmeta", handleLinkMeta)
+	mux.HandleFunc("/pins", handlePins)
+	mux.HandleFunc("/recent", handleRecent)
+	mux.HandleFunc("/visibility", handleVisibility)
+	mux.HandleFunc("/share", handleShare)
+	mux.HandleFunc("/email", handleEmail)
+	mux.HandleFunc("/pdf", handlePDF)
+	mux.HandleFunc("/content", handleContent)
+	mux.HandleFunc("/content/", handleContent)
+	mux.HandleFunc("/webmention", handleWebmention)
+	mux.HandleFunc("/ap/", handleActivityPub)
+	mux.HandleFunc("/.well-known/webfinger", handleWebFinger)
+	mux.HandleFunc("/micropub", handleMicropub)
+	mux.HandleFunc("/calendar", handleCalendar)
+	mux.HandleFunc("/tasks", handleTasks)
+	mux.HandleFunc("/shared/", handleShared)
+	return mux
+}
+
 func rootHandler() http.Handler {
+	// Not in every system mime table; browsers expect it for the PWA manifest
+	_ = mime.AddExtensionType(".webmanifest", "application/manifest+json")
 	sub, err := fs.Sub(embeddedIncludes, "static")
 	if err != nil {
 		// If embedding misconfigured, fail loudly at runtime
@@ -80,7 +251,7 @@ func rootHandler() http.Handler {
 // handleLoadIndex streams the contents of ./index.md as text/plain.
 func handleLoadIndex(w http.ResponseWriter, r *http.Request) {
 	const indexPath = "index.md"
-	b, err := os.ReadFile(indexPath)
+	f, err := os.Open(wsPath(indexPath))
 	if err != nil {
 		if os.IsNotExist(err) {
 			http.Error(w, "index.md not found", http.StatusNotFound)
@@ -89,12 +260,8 @@ func handleLoadIndex(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	w.Header().Set("X-Filename", filepath.Base(indexPath))
-	if _, err := w.Write(b); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+	defer f.Close()
+	streamMarkdown(w, f, indexPath)
 }
 
 // handleSave writes the request body to the given file in the current
@@ -127,42 +294,140 @@ func handleSave(w http.ResponseWriter, r *http.Request) {
 	// Require a valid lock token
 	token := r.Header.Get("X-Lock")
 	if !hasValidLock(name, token) {
-		http.Error(w, "file is locked by another editor", http.StatusLocked)
+		stashRecovery(name, data, "locked")
+		lockedError(w, name)
+		return
+	}
+	// Refuse to overwrite changes the client has not seen; the previous
+	// content is also kept so the save can be undone
+	prev, prevErr := readNote(name)
+	if errors.Is(prevErr, errNoNoteKey) || errors.Is(prevErr, errBadNoteKey) {
+		http.Error(w, prevErr.Error(), http.StatusInternalServerError)
 		return
 	}
+	if ifMatchFails(r, prev, prevErr == nil) {
+		stashRecovery(name, data, "conflict")
+		writeSaveConflict(w, name, prev, prevErr == nil, data)
+		return
+	}
+	writeSave(w, name, data, prev, prevErr == nil)
+}
+
+// writeSave stores data as name, whose previous content prev is pushed to
+// the undo history when it existed, renaming the file after its first H1
+// unless reserved, and answers with the resulting filenames.
+func writeSave(w http.ResponseWriter, name string, data, prev []byte, existed bool) {
+	// Pasted images are stored as files to keep notes small; encrypted
+	// notes keep theirs inline so nothing leaks into assets
+	rewritten := false
+	if !encryptedNote(name) {
+		data, rewritten = extractDataImages(data)
+	}
 	// Decide final target filename based on first H1, unless reserved
 	targetName := decideFilenameFromContent(name, data)
 	// If renaming, avoid overwriting any existing file by picking a unique name
 	if targetName != name {
 		targetName = uniqueAvailableName(targetName)
 	}
-	if err := os.WriteFile(targetName, data, 0644); err != nil {
+	if existed {
+		snapshotNote(name, prev, data)
+	}
+	sealed, err := sealNote(data, encryptedNote(name) || encryptedNote(targetName))
+	if err == nil {
+		err = os.WriteFile(wsPath(targetName), sealed, 0644)
+	}
+	if err != nil {
+		stashRecovery(name, data, err.Error())
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	// If we renamed, remove the previous file and its exported HTML (best-effort).
 	if targetName != name {
-		_ = os.Remove(name)
+		_ = os.Remove(wsPath(name))
 		// Compute old HTML out name using current mapping rules
-		oldOutName := htmlOutNameFor(filepath.Base(name))
-		_ = os.Remove(filepath.Join("docs", oldOutName))
-	}
-	outName := htmlOutNameFor(filepath.Base(targetName))
-	// Trigger export after save if available/enabled for this file only
-	if cmarkPath != "" {
-		outPath := filepath.Join("docs", outName)
-		if err := exportMarkdownTo(cmarkPath, targetName, outPath); err != nil {
-			log.Printf("export error for %s: %v", targetName, err)
-		}
+		removeExport(exportDir, htmlOutNameFor(filepath.Base(name)))
+		renameUndo(name, targetName)
+		renameSnapshots(name, targetName)
+		docIndex.update(".", name)
+	}
+	if existed {
+		pushUndo(targetName, prev, data)
 	}
+	outName := afterSave(targetName)
 	// Return the filename so the client can update state
 	w.Header().Set("X-Filename", filepath.Base(targetName))
 	w.Header().Set("X-HTML-Filename", outName)
+	setRevision(w.Header(), contentETag(data))
+	if rewritten {
+		// The saved text differs from the one sent
+		w.Header().Set("X-Content-Rewritten", "true")
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
 var cmarkPath string // discovered at startup if available
 
+// afterSave runs the follow-up work for a just-written file: it refreshes
+// the file's metadata and exports it into docs when an exporter is available
+// and the file is not ignored, in the background while the server runs. It
+// returns the HTML filename.
+func afterSave(name string) string {
+	docIndex.update(".", name)
+	outName := htmlOutNameFor(filepath.Base(name))
+	if cmarkPath != "" && !loadIgnore(".").Match(name, false) {
+		if exports != nil {
+			exports.enqueue(name)
+		} else {
+			_ = exportNote(name)
+		}
+	}
+	return outName
+}
+
+// exportNote exports name, the uploads it links and the pages that depend
+// on it, tells previews to reload, and sends any webmentions and
+// ActivityPub posts. It returns the error from exporting the note itself,
+// which is also logged.
+func exportNote(name string) error {
+	exportMu.Lock()
+	defer exportMu.Unlock()
+	outName := htmlOutNameFor(filepath.Base(name))
+	err := exportMarkdownTo(cmarkPath, name, filepath.Join(exportDir, outName))
+	if err != nil {
+		log.Printf("export error for %s: %v", name, err)
+	}
+	if err := publishUploads(name, exportDir); err != nil && !os.IsNotExist(err) {
+		log.Printf("uploads of %s not published: %v", name, err)
+	}
+	exportTranslations(cmarkPath, name)
+	exportSeriesMembers(cmarkPath, name)
+	writeSitePages(cmarkPath, exportDir)
+	reloads.broadcast(outName)
+	if wm := config.Webmention; wm != nil && wm.Send {
+		go sendWebmentions(name)
+	}
+	if config.ActivityPub != nil {
+		go publishActivity(name)
+	}
+	return err
+}
+
+// exportPage exports the page of name alone and tells previews to reload,
+// for changes such as received webmentions that only alter what is shown
+// around the note: pages depending on it are left as they are, and no
+// webmentions or ActivityPub posts are sent.
+func exportPage(name string) error {
+	exportMu.Lock()
+	defer exportMu.Unlock()
+	outName := htmlOutNameFor(filepath.Base(name))
+	err := exportMarkdownTo(cmarkPath, name, filepath.Join(exportDir, outName))
+	if err != nil {
+		log.Printf("export error for %s: %v", name, err)
+	}
+	reloads.broadcast(outName)
+	return err
+}
+
 // htmlOutNameFor computes the output HTML filename for a given markdown basename.
 // Special-case: readme.md -> index.html if no index.md exists.
 func htmlOutNameFor(mdBase string) string {
@@ -173,79 +438,198 @@ func htmlOutNameFor(mdBase string) string {
 }
 
 // exportMarkdownTo converts a single Markdown file to HTML using cmark-gfm and
-// writes it to outPath, wrapping with optional _includes/header/footer.
+// writes it to outPath, wrapping with optional _includes/header/footer. With
+// reader mode enabled the reader variant is written too.
 func exportMarkdownTo(cmark, src, outPath string) error {
 	if !strings.EqualFold(filepath.Ext(src), ".md") {
 		return nil
 	}
-	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+	// Encrypted notes would be published in the clear
+	if encryptedNote(src) {
+		unpublish(outPath)
+		return nil
+	}
+	md, err := os.ReadFile(wsPath(src))
+	if err != nil {
+		return err
+	}
+	if notePrivate(md) {
+		unpublish(outPath)
+		return nil
+	}
+	if err := os.MkdirAll(wsPath(filepath.Dir(outPath)), 0755); err != nil {
 		return err
 	}
-	cmd := exec.Command(cmark, src)
-	body, err := cmd.Output()
+	page, err := renderPageWith(cmark, src, md, true)
 	if err != nil {
 		return err
 	}
-	var header, footer []byte
-	if b, err := os.ReadFile(filepath.Join("_includes", "header.html")); err == nil {
-		header = b
+	if err := os.WriteFile(wsPath(outPath), page, 0644); err != nil {
+		return err
+	}
+	if err := writePageMeta(src, outPath, md); err != nil {
+		return err
+	}
+	if checkHTML {
+		for _, p := range validateHTML(page) {
+			log.Printf("%s: %s", outPath, p)
+		}
 	}
-	if b, err := os.ReadFile(filepath.Join("_includes", "footer.html")); err == nil {
-		footer = b
+	if readerHTML {
+		return exportReaderTo(cmark, src, md, readerOutPath(outPath))
+	}
+	return nil
+}
+
+// renderPage runs the full export pipeline on Markdown source: conversion via
+// cmark-gfm followed by wrapping with the optional _includes/header/footer,
+// or those of the bundled theme when there is no _includes directory.
+func renderPage(cmark string, md []byte) ([]byte, error) {
+	return renderPageAs(cmark, "", md)
+}
+
+// renderPageAs is renderPage for the file name, which adds the links between
+// its translations.
+func renderPageAs(cmark, name string, md []byte) ([]byte, error) {
+	return renderPageWith(cmark, name, md, false)
+}
+
+// renderPageWith is renderPageAs, keeping the converted body in the render
+// cache when cached is set.
+func renderPageWith(cmark, name string, md []byte, cached bool) ([]byte, error) {
+	body, err := convertMarkdownWith(cmark, md, cached)
+	if err != nil {
+		return nil, err
+	}
+	header, footer, ok := pageLayout(name, md)
+	if !ok {
+		header, footer = pageIncludes(name)
+	}
+	if header != nil {
+		header = applyPageHooks(ensureFootnotesLink(ensurePrintLink(header)), md)
+	}
+	if footer != nil {
+		footer = applyPageHooks(footer, md)
+	}
+	header, footer = injectAssets(header, footer)
+	header = applyRobots(md, header)
+	header, footer = applyAnalytics(md, header, footer)
+	header, footer = applyRelated(name, header, footer)
+	header, footer = applyBreadcrumbs(name, md, header, footer)
+	if name != "" {
+		header, footer, body = applyLanguages(name, header, footer, body)
+	}
+	header, footer, body = applySeries(name, header, footer, body)
+	lang := pageLang(name, md)
+	header, footer, body = applyComments(md, lang, header, footer, body)
+	header, footer, body = applyWebmentions(name, header, footer, body)
+	header, body = applyPageLang(lang, header, body)
+	header, footer = applyData(header, footer)
+	header, footer = applyPDFHook(name, header, footer)
+	if printBreaks {
+		body = append(append([]byte(`<div class="print-breaks">`+"\n"), body...), "</div>\n"...)
 	}
 	composed := make([]byte, 0, len(header)+len(body)+len(footer))
 	composed = append(composed, header...)
 	composed = append(composed, body...)
 	composed = append(composed, footer...)
-	return os.WriteFile(outPath, composed, 0644)
+	page := applySRI(composed)
+	if pw := pagePassword(md); pw != "" {
+		return protectPage(page, pw)
+	}
+	return applyExportCSP(page), nil
+}
+
+// convertMarkdown converts Markdown to HTML with cmark-gfm, dropping front
+// matter and expanding shortcodes first and applying the export's rewrites
+// to the result.
+func convertMarkdown(cmark string, md []byte) ([]byte, error) {
+	return convertMarkdownWith(cmark, md, false)
+}
+
+// convertMarkdownWith is convertMarkdown, using the render cache when cached
+// is set.
+func convertMarkdownWith(cmark string, md []byte, cached bool) ([]byte, error) {
+	_, md = parseFrontMatter(md)
+	md, blocks := expandShortcodes(md)
+	body, err := cmarkRender(cmark, md, cached)
+	if err != nil {
+		return nil, err
+	}
+	return restoreShortcodes(postProcessHTML(body), blocks), nil
+}
+
+// postProcessHTML applies the export's rewrites to converted HTML: figures,
+// CSV tables, PlantUML diagrams, oEmbed links, link cards, and footnotes.
+func postProcessHTML(body []byte) []byte {
+	return footnoteMarkup(linkCards(oembedLinks(plantumlDiagrams(csvTables(figurize(body))))))
+}
+
+// insertBeforeTag inserts s in front of the first occurrence of tag
+// (matched case-insensitively). b is returned unchanged if tag is absent.
+func insertBeforeTag(b []byte, tag, s string) []byte {
+	i := bytes.Index(bytes.ToLower(b), []byte(tag))
+	if i < 0 {
+		return b
+	}
+	out := make([]byte, 0, len(b)+len(s))
+	out = append(out, b[:i]...)
+	out = append(out, s...)
+	return append(out, b[i:]...)
 }
 
 // cleanAndExportAll removes the docs directory and recreates it, then exports
-// all top-level .md files in the current working directory into docs using
-// cmark-gfm if available.
+// all top-level .md files in the current working directory into docs, unless
+// exports are disabled.
 func cleanAndExportAll(docsDir string) error {
 	// If exporter not available, leave docs untouched
 	if cmarkPath == "" {
 		return nil
 	}
 	// Remove any existing docs directory (best-effort) and recreate it
-	_ = os.RemoveAll(docsDir)
-	if err := os.MkdirAll(docsDir, 0755); err != nil {
+	_ = os.RemoveAll(wsPath(docsDir))
+	if err := os.MkdirAll(wsPath(docsDir), 0755); err != nil {
 		return err
 	}
-	entries, err := os.ReadDir(".")
+	files, err := listMarkdownFiles(".")
 	if err != nil {
 		return err
 	}
-	for _, e := range entries {
-		if e.IsDir() {
-			continue
-		}
-		name := e.Name()
-		if !strings.EqualFold(filepath.Ext(name), ".md") {
-			continue
-		}
+	for _, name := range files {
 		outName := htmlOutNameFor(filepath.Base(name))
 		outPath := filepath.Join(docsDir, outName)
 		if err := exportMarkdownTo(cmarkPath, name, outPath); err != nil {
 			log.Printf("export error for %s: %v", name, err)
 		}
 	}
+	writeSitePages(cmarkPath, docsDir)
+	pruneRenderCache()
 	return nil
 }
 
-// fileExistsLower checks for a file in the current directory by lowercased name.
+// writeSitePages regenerates the pages derived from the whole workspace
+// (language indexes, archives, categories, and series), then the sitemap,
+// the search index, and the _headers file that covers them.
+func writeSitePages(cmark, docsDir string) {
+	writeLanguageIndexes(cmark, docsDir)
+	writeArchives(cmark, docsDir)
+	writeCategories(cmark, docsDir)
+	writeSeries(cmark, docsDir)
+	writeTaxonomies(cmark, docsDir)
+	writeSitemap(docsDir)
+	writeSearchIndex(docsDir)
+	writeCSPHeaders(docsDir)
+}
+
+// fileExistsLower checks for a markdown file in the current directory by
+// lowercased name. Files matched by .minimarkignore are treated as absent.
 func fileExistsLower(name string) bool {
-	want := strings.ToLower(name)
-	entries, err := os.ReadDir(".")
+	names, err := docIndex.listing(".")
 	if err != nil {
 		return false
 	}
-	for _, e := range entries {
-		if e.IsDir() {
-			continue
-		}
-		if strings.ToLower(e.Name()) == want {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
 			return true
 		}
 	}
@@ -255,6 +639,16 @@ func fileExistsLower(name string) bool {
 var atxH1Re = regexp.MustCompile(`(?m)^\s*#\s+(.+?)\s*$`)
 var setextH1Re = regexp.MustCompile(`(?m)^\s*([^\r\n]+?)\s*\r?\n[ \t]*=+[ \t]*$`)
 
+// pageTitle returns the title of a Markdown document: its front matter
+// title, else its first H1.
+func pageTitle(md []byte) string {
+	fields, body := parseFrontMatter(md)
+	if t := fields["title"]; t != "" {
+		return t
+	}
+	return extractTitle(body)
+}
+
 func extractTitle(content []byte) string {
 	s := string(content)
 	atxIdx := atxH1Re.FindStringSubmatchIndex(s)
@@ -271,15 +665,22 @@ func extractTitle(content []byte) string {
 }
 
 // decideFilenameFromContent returns a filename to write to, possibly renamed
-// from the first H1 in the content. It never renames index.md or readme.md.
+// from the front matter slug: or title:, or else the first H1 in the
+// content. It never renames index.md or readme.md.
 func decideFilenameFromContent(current string, content []byte) string {
 	base := filepath.Base(current)
 	lower := strings.ToLower(base)
 	if lower == "index.md" || lower == "readme.md" {
 		return base
 	}
-	// Look for first ATX H1: lines starting with '# '
-	title := extractTitle(content)
+	fields, body := parseFrontMatter(content)
+	title := fields["slug"]
+	if title == "" {
+		title = fields["title"]
+	}
+	if title == "" {
+		title = extractTitle(body)
+	}
 	if title == "" {
 		return base
 	}
@@ -320,22 +721,33 @@ func uniqueAvailableName(preferred string) string {
 	preferred = filepath.Base(preferred)
 	ext := filepath.Ext(preferred)
 	base := strings.TrimSuffix(preferred, ext)
-	if _, err := os.Stat(preferred); os.IsNotExist(err) {
+	if _, err := os.Stat(wsPath(preferred)); os.IsNotExist(err) {
 		return preferred
 	}
 	for i := 1; ; i++ {
 		candidate := fmt.Sprintf("%s-%d%s", base, i, ext)
-		if _, err := os.Stat(candidate); os.IsNotExist(err) {
+		if _, err := os.Stat(wsPath(candidate)); os.IsNotExist(err) {
 			return candidate
 		}
 	}
 }
 
 // copyIncludesToDocs copies all files and folders from srcDir (e.g. "_includes")
-// into dstDir (e.g. "docs"). If srcDir doesn't exist, it does nothing.
+// into dstDir (e.g. "docs"), then adds the default print and theme assets
+// srcDir does not override. If srcDir doesn't exist, the bundled theme's
+// assets are copied instead, or nothing when no theme is selected.
 func copyIncludesToDocs(srcDir, dstDir string) error {
-	info, err := os.Stat(srcDir)
+	info, err := os.Stat(wsPath(srcDir))
 	if err != nil {
+		if os.IsNotExist(err) && siteTheme != "" {
+			if err := os.MkdirAll(wsPath(dstDir), 0755); err != nil {
+				return err
+			}
+			if err := copyThemeAssets(dstDir); err != nil {
+				return err
+			}
+			return writeDefaultAssets(dstDir)
+		}
 		if os.IsNotExist(err) {
 			return nil
 		}
@@ -344,25 +756,49 @@ func copyIncludesToDocs(srcDir, dstDir string) error {
 	if !info.IsDir() {
 		return nil
 	}
-	if err := os.MkdirAll(dstDir, 0755); err != nil {
+	if err := os.MkdirAll(wsPath(dstDir), 0755); err != nil {
 		return err
 	}
-	return copyTree(srcDir, dstDir)
+	if err := copyTree(srcDir, dstDir); err != nil {
+		return err
+	}
+	return writeDefaultAssets(dstDir)
 }
 
+// copyTree recursively copies src into dst. Symlinks are handled according
+// to symlinkPolicy; directory links that lead back into the tree are skipped.
 func copyTree(src, dst string) error {
-	entries, err := os.ReadDir(src)
+	return copyTreeSeen(src, dst, map[string]bool{realDir(src): true})
+}
+
+// copyTreeSeen implements copyTree. ancestors holds the real paths of the
+// directories being copied above src; a directory among them is a cycle.
+// Other directories reached twice, like two links to one folder, are copied
+// each time.
+func copyTreeSeen(src, dst string, ancestors map[string]bool) error {
+	entries, err := os.ReadDir(wsPath(src))
 	if err != nil {
 		return err
 	}
 	for _, e := range entries {
 		sPath := filepath.Join(src, e.Name())
 		dPath := filepath.Join(dst, e.Name())
-		if e.IsDir() {
-			if err := os.MkdirAll(dPath, 0755); err != nil {
+		info, ok := resolveEntry(src, e)
+		if !ok {
+			continue
+		}
+		if info.IsDir() {
+			real := realDir(sPath)
+			if ancestors[real] {
+				continue
+			}
+			if err := os.MkdirAll(wsPath(dPath), 0755); err != nil {
 				return err
 			}
-			if err := copyTree(sPath, dPath); err != nil {
+			ancestors[real] = true
+			err := copyTreeSeen(sPath, dPath, ancestors)
+			delete(ancestors, real)
+			if err != nil {
 				return err
 			}
 			continue
@@ -376,12 +812,12 @@ func copyTree(src, dst string) error {
 }
 
 func copyFile(src, dst string) error {
-	in, err := os.Open(src)
+	in, err := os.Open(wsPath(src))
 	if err != nil {
 		return err
 	}
 	defer in.Close()
-	out, err := os.Create(dst)
+	out, err := os.Create(wsPath(dst))
 	if err != nil {
 		return err
 	}
@@ -390,17 +826,78 @@ func copyFile(src, dst string) error {
 		return err
 	}
 	// Best-effort to copy file mode
-	if fi, err := os.Stat(src); err == nil {
-		_ = os.Chmod(dst, fi.Mode())
+	if fi, err := os.Stat(wsPath(src)); err == nil {
+		_ = os.Chmod(wsPath(dst), fi.Mode())
 	}
 	return nil
 }
 
-// --------- Simple per-file locks with 1s TTL ---------
+// --------- Simple per-file locks with a short TTL ---------
+// Lock changes are persisted with the rest of the state (see store.go).
 
 type lockInfo struct {
 	token   string
 	expires time.Time
+	ttl     time.Duration // granted on /lock; 0 means lockTTL
+	editor  string        // display name from X-Editor, if given
+	since   time.Time     // when the holder took the lock
+}
+
+// holder describes who holds the lock, e.g. "locked by Joe since 14:02".
+func (li lockInfo) holder() string {
+	who := li.editor
+	if who == "" {
+		who = "another editor"
+	}
+	if li.since.IsZero() {
+		return "locked by " + who
+	}
+	return "locked by " + who + " since " + li.since.Local().Format("15:04")
+}
+
+// maxEditorName bounds the X-Editor display names kept with locks.
+const maxEditorName = 64
+
+// editorName cleans an X-Editor display name: control characters are
+// dropped and it is cut to maxEditorName runes.
+func editorName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(s))
+	if r := []rune(s); len(r) > maxEditorName {
+		s = string(r[:maxEditorName])
+	}
+	return s
+}
+
+// lockHolder describes who holds the lock on name, or falls back to
+// another editor when the lock has gone.
+func lockHolder(name string) string {
+	name = filepath.Base(name)
+	now := time.Now()
+	locksMu.Lock()
+	defer locksMu.Unlock()
+	if li, ok := locks[name]; ok && now.Before(li.expires) {
+		return li.holder()
+	}
+	return lockInfo{}.holder()
+}
+
+// lockedError answers 423 for a request without the lock on name, saying
+// who holds it.
+func lockedError(w http.ResponseWriter, name string) {
+	http.Error(w, "file is "+lockHolder(name), http.StatusLocked)
+}
+
+// lifetime is how far each refresh of the lock extends it.
+func (li lockInfo) lifetime() time.Duration {
+	if li.ttl > 0 {
+		return li.ttl
+	}
+	return lockTTL
 }
 
 var (
@@ -408,8 +905,45 @@ var (
 	locksMu sync.Mutex
 )
 
-const lockTTL = time.Second
+// lockTTL is how long locks last unless the client asks for another TTL,
+// which is capped at maxLockTTL. Both are set by flags.
+var (
+	lockTTL    = time.Second
+	maxLockTTL = time.Minute
+)
 
+// validLockTTL checks the -lock-ttl and -max-lock-ttl flags.
+func validLockTTL(ttl, max time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("invalid lock TTL %v", ttl)
+	}
+	if max < ttl {
+		return fmt.Errorf("max lock TTL %v is shorter than the lock TTL %v", max, ttl)
+	}
+	return nil
+}
+
+// parseLockTTL parses the ttl query param of /lock, in seconds or as a
+// duration such as 30s, capped at maxLockTTL. It returns 0 when s is
+// empty.
+func parseLockTTL(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if _, err := strconv.Atoi(s); err == nil {
+		s += "s"
+	}
+	ttl, err := time.ParseDuration(s)
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("invalid ttl %q", s)
+	}
+	return min(ttl, maxLockTTL), nil
+}
+
+// handleLock takes or refreshes the lock on `file`. A `ttl` param asks
+// for a lifetime other than lockTTL, which later refreshes keep. The
+// token is sent in X-Lock, with the expiry granted in X-Lock-Expires and
+// X-Lock-TTL (seconds).
 func handleLock(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -420,6 +954,11 @@ func handleLock(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "missing file", http.StatusBadRequest)
 		return
 	}
+	ttl, err := parseLockTTL(r.URL.Query().Get("ttl"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	reqToken := r.Header.Get("X-Lock")
 	now := time.Now()
 
@@ -427,27 +966,36 @@ func handleLock(w http.ResponseWriter, r *http.Request) {
 	defer locksMu.Unlock()
 
 	li, exists := locks[name]
+	status := http.StatusCreated
 	if exists && now.Before(li.expires) {
-		if reqToken != "" && reqToken == li.token {
-			// Refresh lock
-			li.expires = now.Add(lockTTL)
-			locks[name] = li
-			w.Header().Set("X-Lock", li.token)
-			w.WriteHeader(http.StatusOK)
+		if reqToken == "" || reqToken != li.token {
+			// Locked by someone else
+			http.Error(w, "file is "+li.holder(), http.StatusLocked)
 			return
 		}
-		// Locked by someone else
-		http.Error(w, "locked", http.StatusLocked)
-		return
+		// Refresh lock
+		status = http.StatusOK
+	} else {
+		// Acquire new lock
+		li = lockInfo{token: reqToken, since: now}
+		if li.token == "" {
+			li.token = newToken()
+		}
 	}
-	// Acquire new lock
-	tok := reqToken
-	if tok == "" {
-		tok = newToken()
+	if editor := editorName(r.Header.Get("X-Editor")); editor != "" {
+		li.editor = editor
 	}
-	locks[name] = lockInfo{token: tok, expires: now.Add(lockTTL)}
-	w.Header().Set("X-Lock", tok)
-	w.WriteHeader(http.StatusCreated)
+	if ttl > 0 {
+		li.ttl = ttl
+	}
+	li.expires = now.Add(li.lifetime())
+	locks[name] = li
+	// Persist refreshes too, so a restart restores the current expiry
+	stateChanged()
+	w.Header().Set("X-Lock", li.token)
+	w.Header().Set("X-Lock-Expires", li.expires.UTC().Format(time.RFC3339Nano))
+	w.Header().Set("X-Lock-TTL", strconv.FormatFloat(li.lifetime().Seconds(), 'f', -1, 64))
+	w.WriteHeader(status)
 }
 
 func handleUnlock(w http.ResponseWriter, r *http.Request) {
@@ -461,6 +1009,7 @@ func handleUnlock(w http.ResponseWriter, r *http.Request) {
 	defer locksMu.Unlock()
 	if li, ok := locks[name]; ok && li.token == tok {
 		delete(locks, name)
+		stateChanged()
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
@@ -478,6 +1027,7 @@ func hasValidLock(name, tok string) bool {
 	}
 	if now.After(li.expires) {
 		delete(locks, name)
+		stateChanged()
 		return false
 	}
 	return li.token == tok
@@ -494,8 +1044,59 @@ func transferLock(oldName, newName, tok string) {
 		return
 	}
 	delete(locks, oldName)
-	li.expires = now.Add(lockTTL)
+	li.expires = now.Add(li.lifetime())
 	locks[newName] = li
+	stateChanged()
+}
+
+// acquireLock takes the lock for name on behalf of a server-side operation.
+// It fails if another editor currently holds the lock.
+func acquireLock(name string) (string, bool) {
+	name = filepath.Base(name)
+	now := time.Now()
+	locksMu.Lock()
+	defer locksMu.Unlock()
+	if li, ok := locks[name]; ok && now.Before(li.expires) {
+		return "", false
+	}
+	tok := newToken()
+	locks[name] = lockInfo{token: tok, expires: now.Add(lockTTL), since: now}
+	stateChanged()
+	return tok, true
+}
+
+// holdLock refreshes the live lock on name held by tok with the default
+// lifetime, as a WebSocket holding it does, naming editor as the holder
+// when given. It fails if the lock is gone, as when it expired or was
+// broken, or another editor holds it; locks are only taken with /lock.
+func holdLock(name, tok, editor string) bool {
+	name = filepath.Base(name)
+	now := time.Now()
+	locksMu.Lock()
+	defer locksMu.Unlock()
+	li, ok := locks[name]
+	if !ok || !now.Before(li.expires) || li.token != tok {
+		return false
+	}
+	if editor = editorName(editor); editor != "" {
+		li.editor = editor
+	}
+	li.ttl = 0
+	li.expires = now.Add(lockTTL)
+	locks[name] = li
+	stateChanged()
+	return true
+}
+
+// releaseLock drops the lock for name if tok still owns it.
+func releaseLock(name, tok string) {
+	name = filepath.Base(name)
+	locksMu.Lock()
+	defer locksMu.Unlock()
+	if li, ok := locks[name]; ok && li.token == tok {
+		delete(locks, name)
+		stateChanged()
+	}
 }
 
 func newToken() string {
@@ -510,13 +1111,13 @@ func newToken() string {
 // the file was created, or 200 OK if it already existed (rare, due to unique naming).
 func handleNew(w http.ResponseWriter, r *http.Request) {
 	name := "untitled.md"
-	if _, err := os.Stat(name); err == nil {
+	if _, err := os.Stat(wsPath(name)); err == nil {
 		name = uniqueAvailableName(name)
 	} else if !os.IsNotExist(err) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	f, err := os.OpenFile(wsPath(name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -539,21 +1140,27 @@ func openLastMarkdown(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "invalid filename", http.StatusBadRequest)
 			return
 		}
-		b, err := os.ReadFile(name)
+		serveMarkdownFile(w, name)
+		return
+	}
+
+	// With sort/filter options, open the first matching file instead.
+	if q := r.URL.Query(); hasListQuery(q) {
+		lq, err := parseListQuery(q, "recent")
 		if err != nil {
-			if os.IsNotExist(err) {
-				http.Error(w, "not found", http.StatusNotFound)
-				return
-			}
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.Header().Set("X-Filename", filepath.Base(name))
-		w.Header().Set("X-HTML-Filename", htmlOutNameFor(filepath.Base(name)))
-		if _, err := w.Write(b); err != nil {
+		files, err := queryMarkdownFiles(".", lq)
+		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
+		if len(files) == 0 {
+			http.Error(w, "no matching file", http.StatusNotFound)
+			return
+		}
+		serveMarkdownFile(w, files[0])
 		return
 	}
 
@@ -571,54 +1178,158 @@ func openLastMarkdown(w http.ResponseWriter, r *http.Request) {
 		}
 		_ = created // not used further; just informational
 	}
+	serveMarkdownFile(w, file)
+}
 
-	b, err := os.ReadFile(file)
+// serveMarkdownFile streams a markdown file as text/plain along with its
+// filename headers and records it as recently opened.
+func serveMarkdownFile(w http.ResponseWriter, file string) {
+	f, err := os.Open(wsPath(file))
 	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	defer f.Close()
+	noteRecent(filepath.Base(file))
+	streamMarkdown(w, f, file)
+}
 
+// streamMarkdown copies the open file f, named file, to w without holding
+// it in memory. A first pass computes the ETag; the second sends exactly
+// the bytes hashed. Once part of the body is out a failure can no longer
+// change the status, so it is only logged.
+func streamMarkdown(w http.ResponseWriter, f *os.File, file string) {
+	if encryptedFile(f) {
+		serveEncryptedNote(w, f, file)
+		return
+	}
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.FormatInt(n, 10))
 	w.Header().Set("X-Filename", filepath.Base(file))
 	w.Header().Set("X-HTML-Filename", htmlOutNameFor(filepath.Base(file)))
-	if _, err := w.Write(b); err != nil {
+	setRevision(w.Header(), formatETag(h.Sum(nil)))
+	written, err := io.CopyN(w, f, n)
+	if err == nil {
+		return
+	}
+	if written == 0 {
+		w.Header().Del("Content-Length")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	log.Printf("sending %s: stopped after %d of %d bytes: %v", file, written, n, err)
 }
 
 // handleFiles lists all top-level .md files in the current directory as JSON.
+// Files are sorted case-insensitively unless the query selects another sort
+// (recent, created, size) or filters by tag, folder, or since. With limit,
+// offset, or fields the response is a page of file objects instead.
 func handleFiles(w http.ResponseWriter, r *http.Request) {
-	entries, err := os.ReadDir(".")
+	q := r.URL.Query()
+	lq, err := parseListQuery(q, "alpha")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p, err := parseListPage(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	docs, err := queryMarkdownDocs(".", lq)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if hasListPage(q) {
+		_ = json.NewEncoder(w).Encode(paginate(docs, p))
+		return
+	}
+	files := make([]string, 0, len(docs))
+	for _, d := range docs {
+		files = append(files, d.Name)
+	}
+	_ = json.NewEncoder(w).Encode(files)
+}
+
+// listEntry is one file in the /list response.
+type listEntry struct {
+	Name  string    `json:"name"`
+	Title string    `json:"title"`
+	Size  int64     `json:"size"`
+	MTime time.Time `json:"mtime"`
+}
+
+// handleList returns the Markdown files with their title, size and
+// modification time, for file pickers. It takes the same filters and sort
+// orders as /files.
+func handleList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	lq, err := parseListQuery(r.URL.Query(), "alpha")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	docs, err := queryMarkdownDocs(".", lq)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	list := make([]listEntry, 0, len(docs))
+	for _, d := range docs {
+		list = append(list, listEntry{Name: d.Name, Title: d.Title, Size: d.Size, MTime: d.ModTime})
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(list)
+}
+
+// listMarkdownFiles returns the basenames of all top-level .md files in dir
+// that are not matched by .minimarkignore, applying the symlink policy.
+func listMarkdownFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(wsPath(dir))
+	if err != nil {
+		return nil, err
+	}
+	ign := loadIgnore(dir)
 	var files []string
 	for _, e := range entries {
-		if e.IsDir() {
+		if info, ok := resolveEntry(dir, e); !ok || info.IsDir() {
 			continue
 		}
 		name := e.Name()
-		if strings.EqualFold(filepath.Ext(name), ".md") {
-			files = append(files, filepath.Base(name))
+		if strings.EqualFold(filepath.Ext(name), ".md") && !ign.Match(name, false) {
+			files = append(files, name)
 		}
 	}
-	// Sort case-insensitive
-	sort.Slice(files, func(i, j int) bool { return strings.ToLower(files[i]) < strings.ToLower(files[j]) })
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	_ = json.NewEncoder(w).Encode(files)
+	return files, nil
 }
 
 // createFileIfNotExists ensures a file with the given name exists in the
 // current working directory. It returns the path, whether it was created, and an error.
 func createFileIfNotExists(name string) (string, bool, error) {
-	if _, err := os.Stat(name); err == nil {
+	if _, err := os.Stat(wsPath(name)); err == nil {
 		return name, false, nil
 	} else if !os.IsNotExist(err) {
 		return "", false, err
 	}
-	f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	f, err := os.OpenFile(wsPath(name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
 	if err != nil {
 		return "", false, err
 	}
@@ -627,27 +1338,34 @@ func createFileIfNotExists(name string) (string, bool, error) {
 }
 
 // findLastMarkdownFile returns the path to the most recently modified .md file
-// in dir. Returns empty string if none found.
+// in dir, skipping files matched by .minimarkignore. A front matter `updated:`
+// or `date:` field takes precedence over the file's mtime. Returns empty
+// string if none found.
 func findLastMarkdownFile(dir string) (string, error) {
-	entries, err := os.ReadDir(dir)
+	docs, err := docIndex.refresh(dir)
+	if err != nil {
+		return "", err
+	}
+	names, err := docIndex.listing(dir)
 	if err != nil {
 		return "", err
 	}
+	updated := make(map[string]time.Time, len(docs))
+	for _, d := range docs {
+		updated[d.Name] = d.Updated
+	}
 	var latestPath string
 	var latestTime time.Time
-	for _, e := range entries {
-		if e.IsDir() {
-			continue
-		}
-		name := e.Name()
-		if !strings.EqualFold(filepath.Ext(name), ".md") {
-			continue
-		}
-		info, err := e.Info()
-		if err != nil {
-			continue
+	for _, name := range names {
+		mt, ok := updated[name]
+		if !ok {
+			// Unreadable files are not indexed; fall back to their mtime
+			info, err := os.Stat(wsPath(filepath.Join(dir, name)))
+			if err != nil {
+				continue
+			}
+			mt = info.ModTime()
 		}
-		mt := info.ModTime()
 		if latestPath == "" || mt.After(latestTime) {
 			latestPath = filepath.Join(dir, name)
 			latestTime = mt
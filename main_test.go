@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -100,6 +101,43 @@ func TestHandleLoadIndex_WriteError(t *testing.T) {
 	}
 }
 
+// shortWriter accepts limit bytes, then fails.
+type shortWriter struct {
+	errWriter
+	n, limit int
+}
+
+func (s *shortWriter) Write(p []byte) (int, error) {
+	if s.n+len(p) > s.limit {
+		k := s.limit - s.n
+		s.n = s.limit
+		return k, io.ErrClosedPipe
+	}
+	s.n += len(p)
+	return len(p), nil
+}
+
+func TestStreamMarkdown(t *testing.T) {
+	chdirTemp(t)
+	big := strings.Repeat("# line of a long log\n", 50000)
+	writeFiles(t, map[string]string{"log.md": big})
+	rr := httptest.NewRecorder()
+	openLastMarkdown(rr, httptest.NewRequest(http.MethodGet, "/open?file=log.md", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != big {
+		t.Fatalf("status %d, %d bytes", rr.Code, rr.Body.Len())
+	}
+	h := rr.Header()
+	if h.Get("Content-Length") != strconv.Itoa(len(big)) || h.Get("ETag") != contentETag([]byte(big)) || h.Get("X-Filename") != "log.md" {
+		t.Fatalf("headers = %v", h)
+	}
+	// A write failing part way through is logged, not answered with a 500
+	sw := &shortWriter{limit: 100}
+	openLastMarkdown(sw, httptest.NewRequest(http.MethodGet, "/open?file=log.md", nil))
+	if sw.code != 0 || sw.n != 100 {
+		t.Fatalf("code %d after %d bytes", sw.code, sw.n)
+	}
+}
+
 func TestSlugify(t *testing.T) {
 	cases := map[string]string{
 		"Hello World":         "hello-world",
@@ -142,6 +180,9 @@ func TestDecideFilenameFromContent(t *testing.T) {
 		{"from-title", "note.md", "# My Note", "my-note.md"},
 		{"same-slug", "my-note.md", "# My Note", "my-note.md"},
 		{"no-title", "x.md", "body only", "x.md"},
+		{"front-matter-title", "x.md", "---\ntitle: Trip Notes\n---\n# Other", "trip-notes.md"},
+		{"front-matter-slug", "x.md", "---\ntitle: Trip Notes\nslug: rome-2024\n---\n# Other", "rome-2024.md"},
+		{"h1-after-front-matter", "x.md", "---\ntags: [a]\n# not a title\n---\n# Real", "real.md"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -455,6 +496,95 @@ func TestHandleLock_ErrorsAndContention(t *testing.T) {
 	}
 }
 
+func TestHandleLock_TTL(t *testing.T) {
+	chdirTemp(t)
+	locks = make(map[string]lockInfo)
+	t.Cleanup(func() { lockTTL, maxLockTTL = time.Second, time.Minute })
+	lockTTL, maxLockTTL = 2*time.Second, 30*time.Second
+	lock := func(target, tok string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, target, nil)
+		req.Header.Set("X-Lock", tok)
+		handleLock(rr, req)
+		return rr
+	}
+	granted := func(rr *httptest.ResponseRecorder) time.Duration {
+		t.Helper()
+		exp, err := time.Parse(time.RFC3339Nano, rr.Header().Get("X-Lock-Expires"))
+		if err != nil {
+			t.Fatalf("X-Lock-Expires: %v", err)
+		}
+		return time.Until(exp).Round(time.Second)
+	}
+
+	rr := lock("/lock?file=a.md", "")
+	if rr.Code != http.StatusCreated || granted(rr) != 2*time.Second || rr.Header().Get("X-Lock-TTL") != "2" {
+		t.Fatalf("default ttl: %d %s %s", rr.Code, rr.Header().Get("X-Lock-Expires"), rr.Header().Get("X-Lock-TTL"))
+	}
+	tok := rr.Header().Get("X-Lock")
+	// Asking on refresh changes the TTL, which later refreshes keep
+	if rr := lock("/lock?file=a.md&ttl=10", tok); rr.Code != http.StatusOK || granted(rr) != 10*time.Second {
+		t.Fatalf("ttl=10: %d %s", rr.Code, rr.Header().Get("X-Lock-Expires"))
+	}
+	if rr := lock("/lock?file=a.md", tok); granted(rr) != 10*time.Second {
+		t.Fatalf("refresh lost ttl: %s", rr.Header().Get("X-Lock-Expires"))
+	}
+	if rr := lock("/lock?file=b.md&ttl=1h", ""); rr.Code != http.StatusCreated || rr.Header().Get("X-Lock-TTL") != "30" {
+		t.Fatalf("capped ttl: %d %s", rr.Code, rr.Header().Get("X-Lock-TTL"))
+	}
+	for _, bad := range []string{"0", "-5s", "soon", "NaN"} {
+		if rr := lock("/lock?file=c.md&ttl="+bad, ""); rr.Code != http.StatusBadRequest {
+			t.Errorf("ttl=%s: %d", bad, rr.Code)
+		}
+	}
+	if err := validLockTTL(time.Minute, time.Second); err == nil {
+		t.Error("max below ttl accepted")
+	}
+	if err := validLockTTL(0, time.Second); err == nil {
+		t.Error("zero ttl accepted")
+	}
+}
+
+func TestHandleLock_Editor(t *testing.T) {
+	chdirTemp(t)
+	locks = make(map[string]lockInfo)
+	lock := func(tok, editor string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/lock?file=a.md", nil)
+		req.Header.Set("X-Lock", tok)
+		req.Header.Set("X-Editor", editor)
+		handleLock(rr, req)
+		return rr
+	}
+	rr := lock("", "  Joe\x00 ")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("lock = %d", rr.Code)
+	}
+	tok := rr.Header().Get("X-Lock")
+	since := locks["a.md"].since.Local().Format("15:04")
+	rr = lock("", "Ann")
+	if rr.Code != http.StatusLocked || strings.TrimSpace(rr.Body.String()) != "file is locked by Joe since "+since {
+		t.Errorf("contended lock = %d %q", rr.Code, rr.Body.String())
+	}
+	// A refresh keeps the holder's name and start time
+	if rr := lock(tok, ""); rr.Code != http.StatusOK || locks["a.md"].editor != "Joe" {
+		t.Fatalf("refresh = %d, editor %q", rr.Code, locks["a.md"].editor)
+	}
+
+	// Saves without the lock say who has it too
+	rr = httptest.NewRecorder()
+	handleSave(rr, httptest.NewRequest(http.MethodPost, "/save?file=a.md", strings.NewReader("x")))
+	if rr.Code != http.StatusLocked || !strings.Contains(rr.Body.String(), "locked by Joe since ") {
+		t.Errorf("save = %d %q", rr.Code, rr.Body.String())
+	}
+	if got := lockHolder("free.md"); got != "locked by another editor" {
+		t.Errorf("lockHolder without a lock = %q", got)
+	}
+	if got := editorName(strings.Repeat("é", 100)); len([]rune(got)) != maxEditorName {
+		t.Errorf("long name kept %d runes", len([]rune(got)))
+	}
+}
+
 func TestHandleLock_UseProvidedToken(t *testing.T) {
 	chdirTemp(t)
 	locks = make(map[string]lockInfo)
@@ -1042,3 +1172,20 @@ func TestCleanAndExportAll_NoCmarkLeavesDocs(t *testing.T) {
 		t.Fatalf("docs should be untouched when no cmark: %v", err)
 	}
 }
+
+func TestRootHandlerServesPWAAssets(t *testing.T) {
+	for path, ct := range map[string]string{
+		"/sw.js":                "javascript",
+		"/manifest.webmanifest": "application/manifest+json",
+		"/icon.svg":             "image/svg+xml",
+	} {
+		rr := httptest.NewRecorder()
+		rootHandler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d", path, rr.Code)
+		}
+		if got := rr.Header().Get("Content-Type"); !strings.Contains(got, ct) {
+			t.Fatalf("%s: content-type = %q; want %q", path, got, ct)
+		}
+	}
+}
@@ -0,0 +1,1338 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// builtinConverter stands in for the converter path when Markdown is
+// rendered in-process rather than by cmark-gfm.
+const builtinConverter = "builtin"
+
+// preferCmark renders with cmark-gfm, when it is installed, instead of the
+// built-in renderer.
+var preferCmark bool
+
+// findConverter returns the configured converter command, else the path
+// of cmark-gfm when it is preferred and installed, else builtinConverter.
+func findConverter() string {
+	if tmpl := converterTemplate(); tmpl != "" {
+		return tmpl
+	}
+	if preferCmark {
+		if path, err := exec.LookPath("cmark-gfm"); err == nil {
+			return path
+		}
+	}
+	return builtinConverter
+}
+
+// renderMarkdown converts md to HTML in-process, following cmark-gfm's
+// defaults and output closely enough for the export's rewrites: CommonMark
+// with GFM tables, strikethrough, task lists and autolinks, raw HTML
+// omitted and unsafe link schemes dropped. Footnotes are parsed when a
+// footnote style is configured, as cmark-gfm is then run with --footnotes.
+func renderMarkdown(md []byte) []byte {
+	r := &mdRenderer{
+		refs:      map[string]mdLinkRef{},
+		notes:     map[string][]*mdBlock{},
+		noteIndex: map[string]int{},
+		noteRefs:  map[string]int{},
+		footnotes: config.Footnotes != "",
+	}
+	src := strings.ReplaceAll(string(md), "\r\n", "\n")
+	src = strings.ReplaceAll(src, "\r", "\n")
+	src = strings.ReplaceAll(src, "\x00", "�")
+	lines := strings.Split(strings.TrimSuffix(src, "\n"), "\n")
+	for i, l := range lines {
+		lines[i] = expandTabs(l)
+	}
+	if src == "" {
+		lines = nil
+	}
+	blocks := r.parseBlocks(lines)
+	var out bytes.Buffer
+	r.renderBlocks(&out, blocks, false)
+	r.renderFootnotes(&out)
+	return out.Bytes()
+}
+
+type mdLinkRef struct{ dest, title string }
+
+type mdBlockKind int
+
+const (
+	mdParagraph mdBlockKind = iota
+	mdHeading
+	mdRule
+	mdCode
+	mdQuote
+	mdList
+	mdItem
+	mdHTML
+	mdTable
+)
+
+type mdBlock struct {
+	kind       mdBlockKind
+	text       string // inline source, or code block content
+	info       string // fenced code info string
+	level      int    // heading level
+	children   []*mdBlock
+	afterBlank bool // preceded by a blank line within its container
+
+	// lists and items
+	ordered   bool
+	bullet    byte // '-', '+', '*', or the delimiter '.' or ')'
+	start     int
+	tight     bool
+	endsBlank bool // the item ended with a blank line
+	task      int  // 0: not a task, 1: open, 2: done
+
+	// tables
+	align []string
+	rows  [][]string // header first
+}
+
+type mdRenderer struct {
+	refs      map[string]mdLinkRef
+	notes     map[string][]*mdBlock // footnote definitions by label
+	noteOrder []string              // labels in order of first reference
+	noteIndex map[string]int        // label -> footnote number
+	noteRefs  map[string]int        // label -> references so far
+	footnotes bool
+}
+
+// expandTabs replaces tabs in the leading whitespace of line with spaces,
+// to four-column tab stops.
+func expandTabs(line string) string {
+	if !strings.Contains(line, "\t") {
+		return line
+	}
+	var b strings.Builder
+	col := 0
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\t':
+			n := 4 - col%4
+			b.WriteString(strings.Repeat(" ", n))
+			col += n
+		case ' ':
+			b.WriteByte(' ')
+			col++
+		default:
+			b.WriteString(line[i:])
+			return b.String()
+		}
+	}
+	return b.String()
+}
+
+func isBlankLine(s string) bool { return strings.TrimSpace(s) == "" }
+
+func indentOf(s string) int {
+	n := 0
+	for n < len(s) && s[n] == ' ' {
+		n++
+	}
+	return n
+}
+
+// stripIndent removes up to n leading spaces from s.
+func stripIndent(s string, n int) string {
+	i := 0
+	for i < n && i < len(s) && s[i] == ' ' {
+		i++
+	}
+	return s[i:]
+}
+
+var (
+	mdATXRe      = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+|$)(.*)$`)
+	mdATXCloseRe = regexp.MustCompile(`(?:^|[ \t]+)#+[ \t]*$`)
+	mdRuleRe     = regexp.MustCompile(`^ {0,3}(?:(?:\*[ \t]*){3,}|(?:-[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	mdFenceRe    = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})[ \t]*([^\n]*)$")
+	mdSetextRe   = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+	mdRefDefRe   = regexp.MustCompile(`^ {0,3}\[((?:[^\]\\]|\\.){1,999})\]:[ \t]*(<[^>\n]*>|\S+)(?:[ \t]+("(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'|\((?:[^)\\]|\\.)*\)))?[ \t]*$`)
+	mdNoteDefRe  = regexp.MustCompile(`^ {0,3}\[\^([^\]\s]+)\]:[ \t]?(.*)$`)
+	mdTableSepRe = regexp.MustCompile(`^ {0,3}\|?[ \t]*:?-+:?[ \t]*(?:\|[ \t]*:?-+:?[ \t]*)*\|?[ \t]*$`)
+	mdHTMLOpenRe = regexp.MustCompile(`^ {0,3}(?:<[A-Za-z][A-Za-z0-9-]*(?:\s+[A-Za-z_:][A-Za-z0-9_.:-]*(?:\s*=\s*(?:[^\s"'=<>` + "`" + `]+|'[^']*'|"[^"]*"))?)*\s*/?>|</[A-Za-z][A-Za-z0-9-]*\s*>)[ \t]*$`)
+	mdTaskRe     = regexp.MustCompile(`^\[([ xX])\](?:[ \t]+|$)`)
+)
+
+// mdHTMLBlockTags start an HTML block that ends at a blank line.
+var mdHTMLBlockTags = map[string]bool{}
+
+func init() {
+	for _, t := range strings.Fields(`address article aside base basefont blockquote body caption center col colgroup dd details dialog
+		dir div dl dt fieldset figcaption figure footer form frame frameset h1 h2 h3 h4 h5 h6 head header hr html iframe
+		legend li link main menu menuitem nav noframes ol optgroup option p param search section summary table tbody td
+		tfoot th thead title tr track ul`) {
+		mdHTMLBlockTags[t] = true
+	}
+}
+
+// htmlBlockStart reports whether line opens an HTML block, and the text
+// that closes it ("" for one ending at a blank line). Complete tags alone on
+// a line only start a block outside a paragraph.
+func htmlBlockStart(line string, inParagraph bool) (bool, string) {
+	s := strings.TrimLeft(line, " ")
+	if indentOf(line) > 3 || !strings.HasPrefix(s, "<") {
+		return false, ""
+	}
+	lower := strings.ToLower(s)
+	for _, tag := range []string{"script", "pre", "style", "textarea"} {
+		if strings.HasPrefix(lower, "<"+tag) {
+			rest := lower[len(tag)+1:]
+			if rest == "" || rest[0] == ' ' || rest[0] == '>' || rest[0] == '\t' {
+				return true, "</" + tag + ">"
+			}
+		}
+	}
+	switch {
+	case strings.HasPrefix(s, "<!--"):
+		return true, "-->"
+	case strings.HasPrefix(s, "<?"):
+		return true, "?>"
+	case strings.HasPrefix(s, "<![CDATA["):
+		return true, "]]>"
+	case len(s) > 2 && s[1] == '!' && s[2] >= 'A' && s[2] <= 'Z':
+		return true, ">"
+	}
+	name := strings.TrimPrefix(lower[1:], "/")
+	end := 0
+	for end < len(name) && (name[end] >= 'a' && name[end] <= 'z' || name[end] >= '0' && name[end] <= '9') {
+		end++
+	}
+	if rest := name[end:]; mdHTMLBlockTags[name[:end]] && (rest == "" || rest[0] == ' ' || rest[0] == '\t' || rest[0] == '>' || strings.HasPrefix(rest, "/>")) {
+		return true, ""
+	}
+	if !inParagraph && mdHTMLOpenRe.MatchString(line) {
+		return true, ""
+	}
+	return false, ""
+}
+
+// listMarker parses a list item marker at the start of line, returning the
+// item's content indent and the rest of the line after the marker.
+func listMarker(line string) (b *mdBlock, width int, rest string, ok bool) {
+	indent := indentOf(line)
+	if indent > 3 || indent >= len(line) {
+		return nil, 0, "", false
+	}
+	s := line[indent:]
+	b = &mdBlock{kind: mdList}
+	var n int
+	if c := s[0]; c == '-' || c == '+' || c == '*' {
+		b.bullet, n = c, 1
+	} else {
+		for n < len(s) && n < 9 && s[n] >= '0' && s[n] <= '9' {
+			n++
+		}
+		if n == 0 || n >= len(s) || (s[n] != '.' && s[n] != ')') {
+			return nil, 0, "", false
+		}
+		b.ordered, b.bullet = true, s[n]
+		b.start, _ = strconv.Atoi(s[:n])
+		n++
+	}
+	after := s[n:]
+	if after != "" && after[0] != ' ' {
+		return nil, 0, "", false
+	}
+	spaces := indentOf(after)
+	switch {
+	case spaces == len(after):
+		return b, indent + n + 1, "", true
+	case spaces >= 5:
+		return b, indent + n + 1, after[1:], true
+	}
+	return b, indent + n + spaces, after[spaces:], true
+}
+
+// interrupts reports whether line starts a block that ends a paragraph.
+func interrupts(line string) bool {
+	if mdATXRe.MatchString(line) || mdRuleRe.MatchString(line) || mdFenceRe.MatchString(line) {
+		return true
+	}
+	if s := strings.TrimLeft(line, " "); indentOf(line) <= 3 && strings.HasPrefix(s, ">") {
+		return true
+	}
+	if ok, _ := htmlBlockStart(line, true); ok {
+		return true
+	}
+	if b, _, rest, ok := listMarker(line); ok && rest != "" && (!b.ordered || b.start == 1) {
+		return true
+	}
+	return false
+}
+
+// splitTableRow splits a table row into cells at unescaped pipes, dropping
+// the optional leading and trailing pipe.
+func splitTableRow(line string) []string {
+	s := strings.TrimSpace(line)
+	s = strings.TrimPrefix(s, "|")
+	if strings.HasSuffix(s, "|") && !strings.HasSuffix(s, `\|`) {
+		s = s[:len(s)-1]
+	}
+	var cells []string
+	var cur strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == '|':
+			cur.WriteByte('|')
+			i++
+		case s[i] == '|':
+			cells = append(cells, strings.TrimSpace(cur.String()))
+			cur.Reset()
+		default:
+			cur.WriteByte(s[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cur.String()))
+}
+
+// tableStart reports whether lines[i] and lines[i+1] are a table's header
+// and delimiter rows.
+func tableStart(lines []string, i int) bool {
+	if i+1 >= len(lines) || !strings.Contains(lines[i], "|") || !mdTableSepRe.MatchString(lines[i+1]) {
+		return false
+	}
+	return len(splitTableRow(lines[i])) == len(splitTableRow(lines[i+1]))
+}
+
+// parseBlocks parses lines, already stripped of their container's prefix,
+// into blocks.
+func (r *mdRenderer) parseBlocks(lines []string) []*mdBlock {
+	var out []*mdBlock
+	blank := false
+	add := func(b *mdBlock) {
+		b.afterBlank = blank && len(out) > 0
+		out = append(out, b)
+		blank = false
+	}
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		if isBlankLine(line) {
+			blank = true
+			i++
+			continue
+		}
+		indent := indentOf(line)
+
+		if indent >= 4 {
+			var code []string
+			j := i
+			for j < len(lines) && (isBlankLine(lines[j]) || indentOf(lines[j]) >= 4) {
+				code = append(code, stripIndent(lines[j], 4))
+				j++
+			}
+			for len(code) > 0 && isBlankLine(code[len(code)-1]) {
+				code = code[:len(code)-1]
+				j--
+			}
+			add(&mdBlock{kind: mdCode, text: strings.Join(code, "\n") + "\n"})
+			i = j
+			continue
+		}
+
+		if m := mdFenceRe.FindStringSubmatch(line); m != nil && !(m[2][0] == '`' && strings.Contains(m[3], "`")) {
+			fenceIndent, fence := len(m[1]), m[2]
+			var code []string
+			j := i + 1
+			for ; j < len(lines); j++ {
+				l := lines[j]
+				if indentOf(l) <= 3 {
+					t := strings.TrimSpace(l)
+					if strings.HasPrefix(t, fence) && strings.Trim(t, fence[:1]) == "" {
+						j++
+						break
+					}
+				}
+				code = append(code, stripIndent(l, fenceIndent))
+			}
+			text := strings.Join(code, "\n")
+			if len(code) > 0 {
+				text += "\n"
+			}
+			add(&mdBlock{kind: mdCode, text: text, info: unescapeMarkdown(strings.TrimSpace(m[3]))})
+			i = j
+			continue
+		}
+
+		if m := mdATXRe.FindStringSubmatch(line); m != nil {
+			text := mdATXCloseRe.ReplaceAllString(strings.TrimSpace(m[2]), "")
+			if strings.Trim(strings.TrimSpace(m[2]), "#") == "" {
+				text = ""
+			}
+			add(&mdBlock{kind: mdHeading, level: len(m[1]), text: strings.TrimSpace(text)})
+			i++
+			continue
+		}
+
+		if mdRuleRe.MatchString(line) {
+			add(&mdBlock{kind: mdRule})
+			i++
+			continue
+		}
+
+		if s := line[indent:]; strings.HasPrefix(s, ">") {
+			var inner []string
+			j := i
+			for j < len(lines) {
+				l := lines[j]
+				if t := strings.TrimLeft(l, " "); indentOf(l) <= 3 && strings.HasPrefix(t, ">") {
+					t = t[1:]
+					if strings.HasPrefix(t, " ") {
+						t = t[1:]
+					}
+					inner = append(inner, t)
+				} else if !isBlankLine(l) && len(inner) > 0 && !isBlankLine(inner[len(inner)-1]) && !interrupts(l) && indentOf(inner[len(inner)-1]) < 4 {
+					inner = append(inner, l) // lazy continuation
+				} else {
+					break
+				}
+				j++
+			}
+			add(&mdBlock{kind: mdQuote, children: r.parseBlocks(inner)})
+			i = j
+			continue
+		}
+
+		if ok, end := htmlBlockStart(line, false); ok {
+			j := i
+			for j < len(lines) {
+				l := lines[j]
+				j++
+				if end == "" {
+					if j < len(lines) && isBlankLine(lines[j]) {
+						break
+					}
+				} else if strings.Contains(strings.ToLower(l), end) {
+					break
+				}
+			}
+			add(&mdBlock{kind: mdHTML})
+			i = j
+			continue
+		}
+
+		if list, _, _, ok := listMarker(line); ok {
+			i = r.parseList(lines, i, list)
+			add(list)
+			continue
+		}
+
+		if r.footnotes {
+			if m := mdNoteDefRe.FindStringSubmatch(line); m != nil {
+				body := []string{m[2]}
+				j := i + 1
+				for j < len(lines) && (isBlankLine(lines[j]) || indentOf(lines[j]) >= 4 ||
+					(!isBlankLine(lines[j-1]) && !interrupts(lines[j]) && !mdNoteDefRe.MatchString(lines[j]))) {
+					body = append(body, stripIndent(lines[j], 4))
+					j++
+				}
+				label := normalizeLabel(m[1])
+				if _, dup := r.notes[label]; !dup {
+					r.notes[label] = r.parseBlocks(body)
+				}
+				blank = false
+				i = j
+				continue
+			}
+		}
+
+		if tableStart(lines, i) {
+			t := &mdBlock{kind: mdTable}
+			for _, cell := range splitTableRow(lines[i+1]) {
+				left, right := strings.HasPrefix(cell, ":"), strings.HasSuffix(cell, ":")
+				switch {
+				case left && right:
+					t.align = append(t.align, "center")
+				case left:
+					t.align = append(t.align, "left")
+				case right:
+					t.align = append(t.align, "right")
+				default:
+					t.align = append(t.align, "")
+				}
+			}
+			t.rows = append(t.rows, splitTableRow(lines[i]))
+			j := i + 2
+			for j < len(lines) && !isBlankLine(lines[j]) && !interrupts(lines[j]) {
+				t.rows = append(t.rows, splitTableRow(lines[j]))
+				j++
+			}
+			add(t)
+			i = j
+			continue
+		}
+
+		// A paragraph, or link reference definitions, or a setext heading
+		para := []string{strings.TrimLeft(line, " ")}
+		j := i + 1
+		heading := 0
+		for j < len(lines) {
+			l := lines[j]
+			if isBlankLine(l) {
+				break
+			}
+			if m := mdSetextRe.FindStringSubmatch(l); m != nil {
+				heading = 1
+				if m[1][0] == '-' {
+					heading = 2
+				}
+				j++
+				break
+			}
+			if interrupts(l) || tableStart(lines, j) {
+				break
+			}
+			para = append(para, strings.TrimLeft(l, " "))
+			j++
+		}
+		para = r.takeRefDefs(para)
+		switch {
+		case len(para) == 0 && heading == 0:
+		case len(para) == 0:
+			// Only definitions: the underline is text, or a rule for ---
+			if heading == 2 {
+				add(&mdBlock{kind: mdRule})
+			} else {
+				add(&mdBlock{kind: mdParagraph, text: strings.TrimSpace(lines[j-1])})
+			}
+		case heading > 0:
+			add(&mdBlock{kind: mdHeading, level: heading, text: strings.TrimSpace(strings.Join(para, "\n"))})
+		default:
+			add(&mdBlock{kind: mdParagraph, text: strings.TrimRight(strings.Join(para, "\n"), " \t")})
+		}
+		i = j
+	}
+	return out
+}
+
+// takeRefDefs records the link reference definitions at the start of a
+// paragraph and returns the remaining lines.
+func (r *mdRenderer) takeRefDefs(para []string) []string {
+	for len(para) > 0 {
+		m := mdRefDefRe.FindStringSubmatch(para[0])
+		n := 1
+		if m == nil && len(para) > 1 {
+			// The title may be on the next line
+			m = mdRefDefRe.FindStringSubmatch(para[0] + " " + para[1])
+			n = 2
+		}
+		if m == nil || strings.HasPrefix(m[1], "^") && r.footnotes {
+			break
+		}
+		label := normalizeLabel(m[1])
+		if label == "" {
+			break
+		}
+		if _, dup := r.refs[label]; !dup {
+			dest := strings.TrimSuffix(strings.TrimPrefix(m[2], "<"), ">")
+			title := ""
+			if len(m[3]) >= 2 {
+				title = m[3][1 : len(m[3])-1]
+			}
+			r.refs[label] = mdLinkRef{dest: unescapeMarkdown(dest), title: unescapeMarkdown(title)}
+		}
+		para = para[n:]
+	}
+	return para
+}
+
+// parseList parses the list starting at lines[i], whose first marker was
+// parsed into list, and returns the index of the first line after it.
+func (r *mdRenderer) parseList(lines []string, i int, list *mdBlock) int {
+	list.tight = true
+	for i < len(lines) {
+		b, width, rest, ok := listMarker(lines[i])
+		if !ok || b.ordered != list.ordered || b.bullet != list.bullet || mdRuleRe.MatchString(lines[i]) {
+			break
+		}
+		item := []string{rest}
+		j := i + 1
+		if rest == "" && j < len(lines) && isBlankLine(lines[j]) {
+			item = nil // an empty item
+		} else {
+		collect:
+			for j < len(lines) {
+				l := lines[j]
+				switch {
+				case isBlankLine(l):
+					item = append(item, "")
+				case indentOf(l) >= width:
+					item = append(item, l[width:])
+				case len(item) > 0 && !isBlankLine(item[len(item)-1]) && !interrupts(l) && !tableStart(lines, j) &&
+					!mdSetextRe.MatchString(l) && !isListStart(l):
+					item = append(item, strings.TrimLeft(l, " ")) // lazy continuation
+				default:
+					break collect
+				}
+				j++
+			}
+		}
+		endsBlank := false
+		for len(item) > 0 && item[len(item)-1] == "" {
+			item = item[:len(item)-1]
+			endsBlank = true
+		}
+		li := &mdBlock{kind: mdItem, endsBlank: endsBlank}
+		if len(item) > 0 {
+			if m := mdTaskRe.FindStringSubmatch(item[0]); m != nil && (len(item) > 1 || len(item[0]) > len(m[0])) {
+				li.task = 1
+				if m[1] != " " {
+					li.task = 2
+				}
+				item[0] = item[0][len(m[0]):]
+			}
+		}
+		li.children = r.parseBlocks(item)
+		for _, c := range li.children {
+			if c.afterBlank {
+				list.tight = false
+			}
+		}
+		if n := len(list.children); n > 0 && list.children[n-1].endsBlank {
+			list.tight = false
+		}
+		list.children = append(list.children, li)
+		i = j
+		if endsBlank && (i >= len(lines) || !isListStart(lines[i])) {
+			break
+		}
+	}
+	return i
+}
+
+func isListStart(line string) bool {
+	_, _, _, ok := listMarker(line)
+	return ok && !mdRuleRe.MatchString(line)
+}
+
+// normalizeLabel folds a link label for matching.
+func normalizeLabel(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+var mdEntityRe = regexp.MustCompile(`^&(?:#[xX][0-9a-fA-F]{1,6}|#[0-9]{1,7}|[A-Za-z][A-Za-z0-9]{1,31});`)
+
+// unescapeMarkdown resolves backslash escapes and entity references.
+func unescapeMarkdown(s string) string {
+	if !strings.ContainsAny(s, `\&`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && isASCIIPunct(s[i+1]):
+			b.WriteByte(s[i+1])
+			i++
+		case s[i] == '&':
+			if m := mdEntityRe.FindString(s[i:]); m != "" {
+				b.WriteString(html.UnescapeString(m))
+				i += len(m) - 1
+			} else {
+				b.WriteByte('&')
+			}
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+func isASCIIPunct(c byte) bool {
+	return c < 128 && unicode.IsPunct(rune(c)) || strings.IndexByte("$+<=>^`|~", c) >= 0
+}
+
+// escapeText escapes s for HTML text and attribute values as cmark does.
+func escapeText(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;").Replace(s)
+}
+
+// escapeHref percent-encodes the characters of a URL that are not safe in
+// an href, as cmark does.
+func escapeHref(u string) string {
+	const safe = "-_.+!*'(),%#@?=;:/,+&$~"
+	var b strings.Builder
+	for i := 0; i < len(u); i++ {
+		c := u[i]
+		switch {
+		case c == '&':
+			b.WriteString("&amp;")
+		case c == '\'':
+			b.WriteString("&#x27;")
+		case c < 128 && (c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte(safe, c) >= 0):
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+var mdSafeDataRe = regexp.MustCompile(`(?i)^data:image/(?:png|gif|jpeg|webp)`)
+
+// safeURL drops links with schemes that can run code, as cmark does
+// without --unsafe.
+func safeURL(u string) string {
+	l := strings.ToLower(strings.TrimSpace(u))
+	for _, scheme := range []string{"javascript:", "vbscript:", "file:", "data:"} {
+		if strings.HasPrefix(l, scheme) && !mdSafeDataRe.MatchString(l) {
+			return ""
+		}
+	}
+	return u
+}
+
+// ---- rendering blocks ----
+
+// cr starts a new line in out unless it is empty or already at one.
+func cr(out *bytes.Buffer) {
+	if out.Len() > 0 && out.Bytes()[out.Len()-1] != '\n' {
+		out.WriteByte('\n')
+	}
+}
+
+func (r *mdRenderer) renderBlocks(out *bytes.Buffer, blocks []*mdBlock, tight bool) {
+	for _, b := range blocks {
+		switch b.kind {
+		case mdParagraph:
+			if tight {
+				out.WriteString(r.inline(b.text))
+			} else {
+				cr(out)
+				fmt.Fprintf(out, "<p>%s</p>\n", r.inline(b.text))
+			}
+		case mdHeading:
+			cr(out)
+			fmt.Fprintf(out, "<h%d>%s</h%d>\n", b.level, r.inline(b.text), b.level)
+		case mdRule:
+			cr(out)
+			out.WriteString("<hr />\n")
+		case mdCode:
+			cr(out)
+			out.WriteString("<pre><code")
+			if lang := strings.Fields(b.info); len(lang) > 0 {
+				fmt.Fprintf(out, ` class="language-%s"`, escapeText(lang[0]))
+			}
+			fmt.Fprintf(out, ">%s</code></pre>\n", escapeText(b.text))
+		case mdQuote:
+			cr(out)
+			out.WriteString("<blockquote>\n")
+			r.renderBlocks(out, b.children, false)
+			cr(out)
+			out.WriteString("</blockquote>\n")
+		case mdList:
+			cr(out)
+			switch {
+			case !b.ordered:
+				out.WriteString("<ul>\n")
+			case b.start != 1:
+				fmt.Fprintf(out, "<ol start=\"%d\">\n", b.start)
+			default:
+				out.WriteString("<ol>\n")
+			}
+			for _, li := range b.children {
+				cr(out)
+				out.WriteString("<li>")
+				switch li.task {
+				case 1:
+					out.WriteString(`<input type="checkbox" disabled="" /> `)
+				case 2:
+					out.WriteString(`<input type="checkbox" checked="" disabled="" /> `)
+				}
+				r.renderBlocks(out, li.children, b.tight)
+				if !b.tight || len(li.children) > 0 && li.children[len(li.children)-1].kind != mdParagraph {
+					cr(out)
+				}
+				out.WriteString("</li>\n")
+			}
+			if b.ordered {
+				out.WriteString("</ol>\n")
+			} else {
+				out.WriteString("</ul>\n")
+			}
+		case mdHTML:
+			cr(out)
+			out.WriteString("<!-- raw HTML omitted -->\n")
+		case mdTable:
+			r.renderTable(out, b)
+		}
+	}
+}
+
+func (r *mdRenderer) renderTable(out *bytes.Buffer, t *mdBlock) {
+	cr(out)
+	out.WriteString("<table>\n<thead>\n")
+	for i, row := range t.rows {
+		if i == 1 {
+			out.WriteString("<tbody>\n")
+		}
+		out.WriteString("<tr>\n")
+		tag := "td"
+		if i == 0 {
+			tag = "th"
+		}
+		for c, align := range t.align {
+			cell := ""
+			if c < len(row) {
+				cell = row[c]
+			}
+			if align != "" {
+				fmt.Fprintf(out, "<%s align=\"%s\">%s</%s>\n", tag, align, r.inline(cell), tag)
+			} else {
+				fmt.Fprintf(out, "<%s>%s</%s>\n", tag, r.inline(cell), tag)
+			}
+		}
+		out.WriteString("</tr>\n")
+		if i == 0 {
+			out.WriteString("</thead>\n")
+		}
+	}
+	if len(t.rows) > 1 {
+		out.WriteString("</tbody>\n")
+	}
+	out.WriteString("</table>\n")
+}
+
+// renderFootnotes writes the referenced footnotes, numbered in order of
+// first reference, with links back to each reference.
+func (r *mdRenderer) renderFootnotes(out *bytes.Buffer) {
+	if len(r.noteOrder) == 0 {
+		return
+	}
+	cr(out)
+	out.WriteString("<section class=\"footnotes\" data-footnotes>\n<ol>\n")
+	// Rendering a note may reference further notes, which are appended
+	for i := 0; i < len(r.noteOrder); i++ {
+		label := r.noteOrder[i]
+		id := escapeText(label)
+		var note bytes.Buffer
+		r.renderBlocks(&note, r.notes[label], false)
+		var back strings.Builder
+		n := r.noteIndex[label]
+		for k := 1; k <= r.noteRefs[label]; k++ {
+			ref, idx, sup := "fnref-"+id, strconv.Itoa(n), ""
+			if k > 1 {
+				ref += "-" + strconv.Itoa(k)
+				idx += "-" + strconv.Itoa(k)
+				sup = fmt.Sprintf(`<sup class="footnote-ref">%d</sup>`, k)
+			}
+			fmt.Fprintf(&back, ` <a href="#%s" class="footnote-backref" data-footnote-backref data-footnote-backref-idx="%s" aria-label="Back to reference %s">↩%s</a>`, ref, idx, idx, sup)
+		}
+		body := note.Bytes()
+		if bytes.HasSuffix(body, []byte("</p>\n")) {
+			body = append(body[:len(body)-len("</p>\n")], back.String()+"</p>\n"...)
+		} else {
+			body = append(body, strings.TrimPrefix(back.String(), " ")+"\n"...)
+		}
+		fmt.Fprintf(out, "<li id=\"fn-%s\">\n%s</li>\n", id, body)
+	}
+	out.WriteString("</ol>\n</section>\n")
+}
+
+// ---- inline content ----
+
+// mdNode is a piece of rendered inline HTML in a linked list, so emphasis
+// and links can wrap ranges of it.
+type mdNode struct {
+	html       string
+	prev, next *mdNode
+}
+
+// mdDelim is a run of *, _ or ~ that may open or close emphasis.
+type mdDelim struct {
+	node              *mdNode
+	ch                byte
+	n, orig           int
+	canOpen, canClose bool
+	dead              bool
+}
+
+// mdBracket is an unmatched [ or ![.
+type mdBracket struct {
+	node   *mdNode
+	pos    int // source offset just past the bracket
+	image  bool
+	active bool
+	delims int // len(delims) when the bracket was seen
+}
+
+type mdInline struct {
+	r          *mdRenderer
+	head, tail *mdNode
+	delims     []*mdDelim
+	brackets   []*mdBracket
+	text       strings.Builder // pending plain text, unescaped
+}
+
+func (p *mdInline) flush() {
+	if p.text.Len() > 0 {
+		s := p.text.String()
+		p.text.Reset()
+		p.push(escapeText(s))
+	}
+}
+
+func (p *mdInline) push(html string) *mdNode {
+	n := &mdNode{html: html, prev: p.tail}
+	if p.tail != nil {
+		p.tail.next = n
+	} else {
+		p.head = n
+	}
+	p.tail = n
+	return n
+}
+
+func insertAfter(at *mdNode, html string) {
+	n := &mdNode{html: html, prev: at, next: at.next}
+	if at.next != nil {
+		at.next.prev = n
+	}
+	at.next = n
+}
+
+func insertBefore(at *mdNode, html string) {
+	n := &mdNode{html: html, prev: at.prev, next: at}
+	if at.prev != nil {
+		at.prev.next = n
+	}
+	at.prev = n
+}
+
+var (
+	mdAutolinkRe   = regexp.MustCompile(`^<([A-Za-z][A-Za-z0-9.+-]{1,31}:[^<>\x00-\x20]*)>`)
+	mdEmailLinkRe  = regexp.MustCompile(`^<([a-zA-Z0-9.!#$%&'*+/=?^_{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*)>`)
+	mdInlineHTMLRe = regexp.MustCompile(`^(?:<[A-Za-z][A-Za-z0-9-]*(?:\s+[A-Za-z_:][A-Za-z0-9_.:-]*(?:\s*=\s*(?:[^\s"'=<>` + "`" + `]+|'[^']*'|"[^"]*"))?)*\s*/?>|</[A-Za-z][A-Za-z0-9-]*\s*>|<!---->|<!--(?:-?[^>-])(?:-?[^-])*-->|<\?.*?\?>|<![A-Z]+\s+[^>]*>|<!\[CDATA\[(?s:.*?)\]\]>)`)
+	mdWebLinkRe    = regexp.MustCompile(`^(?:https?://|www\.)[A-Za-z0-9_-]+(?:\.[A-Za-z0-9_-]+)*[^\s<]*`)
+	mdNoteRefRe    = regexp.MustCompile(`^\[\^([^\]\s]+)\]`)
+)
+
+// inline renders the inline content s.
+func (r *mdRenderer) inline(s string) string {
+	p := &mdInline{r: r}
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch c {
+		case '\\':
+			if i+1 < len(s) && s[i+1] == '\n' {
+				p.flush()
+				p.push("<br />\n")
+				i += 2
+				continue
+			}
+			if i+1 < len(s) && isASCIIPunct(s[i+1]) {
+				p.text.WriteByte(s[i+1])
+				i += 2
+				continue
+			}
+		case '`':
+			n := 0
+			for i+n < len(s) && s[i+n] == '`' {
+				n++
+			}
+			if end := closingBackticks(s, i+n, n); end >= 0 {
+				code := strings.ReplaceAll(s[i+n:end], "\n", " ")
+				if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+					code = code[1 : len(code)-1]
+				}
+				p.flush()
+				p.push("<code>" + escapeText(code) + "</code>")
+				i = end + n
+			} else {
+				p.text.WriteString(s[i : i+n])
+				i += n
+			}
+			continue
+		case '*', '_', '~':
+			n := 0
+			for i+n < len(s) && s[i+n] == c {
+				n++
+			}
+			if c == '~' && n > 2 {
+				p.text.WriteString(s[i : i+n])
+				i += n
+				continue
+			}
+			before, _ := utf8.DecodeLastRuneInString(s[:i])
+			if i == 0 {
+				before = '\n'
+			}
+			after, _ := utf8.DecodeRuneInString(s[i+n:])
+			if i+n == len(s) {
+				after = '\n'
+			}
+			left := !unicode.IsSpace(after) && (!isPunctRune(after) || unicode.IsSpace(before) || isPunctRune(before))
+			right := !unicode.IsSpace(before) && (!isPunctRune(before) || unicode.IsSpace(after) || isPunctRune(after))
+			d := &mdDelim{ch: c, n: n, orig: n, canOpen: left, canClose: right}
+			if c == '_' {
+				d.canOpen = left && (!right || isPunctRune(before))
+				d.canClose = right && (!left || isPunctRune(after))
+			}
+			p.flush()
+			d.node = p.push(s[i : i+n])
+			p.delims = append(p.delims, d)
+			i += n
+			continue
+		case '!':
+			if i+1 < len(s) && s[i+1] == '[' {
+				p.flush()
+				p.brackets = append(p.brackets, &mdBracket{node: p.push("!["), pos: i + 2, image: true, active: true, delims: len(p.delims)})
+				i += 2
+				continue
+			}
+		case '[':
+			if r.footnotes {
+				if m := mdNoteRefRe.FindStringSubmatch(s[i:]); m != nil {
+					if html, ok := r.noteRef(m[1]); ok {
+						p.flush()
+						p.push(html)
+						i += len(m[0])
+						continue
+					}
+				}
+			}
+			p.flush()
+			p.brackets = append(p.brackets, &mdBracket{node: p.push("["), pos: i + 1, active: true, delims: len(p.delims)})
+			i++
+			continue
+		case ']':
+			if n, ok := p.closeBracket(s, i); ok {
+				i = n
+				continue
+			}
+			p.text.WriteByte(']')
+			i++
+			continue
+		case '<':
+			if m := mdAutolinkRe.FindStringSubmatch(s[i:]); m != nil {
+				p.flush()
+				p.push(fmt.Sprintf(`<a href="%s">%s</a>`, escapeHref(safeURL(m[1])), escapeText(m[1])))
+				i += len(m[0])
+				continue
+			}
+			if m := mdEmailLinkRe.FindStringSubmatch(s[i:]); m != nil {
+				p.flush()
+				p.push(fmt.Sprintf(`<a href="mailto:%s">%s</a>`, escapeHref(m[1]), escapeText(m[1])))
+				i += len(m[0])
+				continue
+			}
+			if m := mdInlineHTMLRe.FindString(s[i:]); m != "" {
+				p.flush()
+				p.push("<!-- raw HTML omitted -->")
+				i += len(m)
+				continue
+			}
+		case '&':
+			if m := mdEntityRe.FindString(s[i:]); m != "" {
+				p.text.WriteString(html.UnescapeString(m))
+				i += len(m)
+				continue
+			}
+		case '\n':
+			pending := p.text.String()
+			trimmed := strings.TrimRight(pending, " ")
+			p.text.Reset()
+			p.text.WriteString(trimmed)
+			p.flush()
+			if len(pending)-len(trimmed) >= 2 {
+				p.push("<br />\n")
+			} else {
+				p.push("\n")
+			}
+			i++
+			continue
+		case 'h', 'w':
+			if i == 0 || strings.IndexByte(" \t\n*_~(", s[i-1]) >= 0 {
+				if m := mdWebLinkRe.FindString(s[i:]); m != "" {
+					if link := trimAutolink(m); link != "" {
+						href := link
+						if c == 'w' {
+							href = "http://" + link
+						}
+						p.flush()
+						p.push(fmt.Sprintf(`<a href="%s">%s</a>`, escapeHref(href), escapeText(link)))
+						i += len(link)
+						continue
+					}
+				}
+			}
+		}
+		p.text.WriteByte(c)
+		i++
+	}
+	p.flush()
+	p.processEmphasis(0)
+	var b strings.Builder
+	for n := p.head; n != nil; n = n.next {
+		b.WriteString(n.html)
+	}
+	return b.String()
+}
+
+func isPunctRune(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
+
+// closingBackticks finds the next run of exactly n backticks in s from
+// offset from.
+func closingBackticks(s string, from, n int) int {
+	for i := from; i < len(s); {
+		if s[i] != '`' {
+			i++
+			continue
+		}
+		j := i
+		for j < len(s) && s[j] == '`' {
+			j++
+		}
+		if j-i == n {
+			return i
+		}
+		i = j
+	}
+	return -1
+}
+
+// trimAutolink drops trailing punctuation, and closing parentheses without
+// a match, from an extended autolink.
+func trimAutolink(link string) string {
+	for link != "" {
+		last := link[len(link)-1]
+		switch {
+		case strings.IndexByte("?!.,:*_~'\"", last) >= 0:
+			link = link[:len(link)-1]
+		case last == ')' && strings.Count(link, ")") > strings.Count(link, "("):
+			link = link[:len(link)-1]
+		case last == ';':
+			if i := strings.LastIndexByte(link, '&'); i >= 0 && mdEntityRe.MatchString(link[i:]) {
+				link = link[:i]
+			} else {
+				return link
+			}
+		default:
+			return link
+		}
+	}
+	return link
+}
+
+// noteRef renders a reference to the footnote label, numbering the note on
+// its first reference.
+func (r *mdRenderer) noteRef(label string) (string, bool) {
+	key := normalizeLabel(label)
+	if _, ok := r.notes[key]; !ok {
+		return "", false
+	}
+	n, seen := r.noteIndex[key]
+	if !seen {
+		r.noteOrder = append(r.noteOrder, key)
+		n = len(r.noteOrder)
+		r.noteIndex[key] = n
+	}
+	r.noteRefs[key]++
+	id := "fnref-" + escapeText(key)
+	if k := r.noteRefs[key]; k > 1 {
+		id += "-" + strconv.Itoa(k)
+	}
+	return fmt.Sprintf(`<sup class="footnote-ref"><a href="#fn-%s" id="%s" data-footnote-ref>%d</a></sup>`, escapeText(key), id, n), true
+}
+
+// closeBracket handles the ] at s[i]: if it closes a link or image, the
+// bracket's content is wrapped and the offset past the link is returned.
+func (p *mdInline) closeBracket(s string, i int) (int, bool) {
+	if len(p.brackets) == 0 {
+		return 0, false
+	}
+	b := p.brackets[len(p.brackets)-1]
+	p.brackets = p.brackets[:len(p.brackets)-1]
+	if !b.active {
+		return 0, false
+	}
+	dest, title, end, ok := parseInlineLink(s, i+1)
+	if !ok {
+		label := s[b.pos:i]
+		end = i + 1
+		if rest := s[i+1:]; strings.HasPrefix(rest, "[") {
+			if j := strings.IndexByte(rest, ']'); j >= 0 {
+				if j > 1 {
+					label = rest[1:j] // [text][label]; [text][] uses the text
+				}
+				end = i + 2 + j
+			}
+		}
+		ref, found := p.r.refs[normalizeLabel(label)]
+		if !found {
+			return 0, false
+		}
+		dest, title = ref.dest, ref.title
+	}
+	p.flush()
+	p.processEmphasis(b.delims)
+	p.delims = p.delims[:b.delims]
+
+	titleAttr := ""
+	if title != "" {
+		titleAttr = ` title="` + escapeText(title) + `"`
+	}
+	href := escapeHref(safeURL(dest))
+	if b.image {
+		var alt strings.Builder
+		for n := b.node.next; n != nil; n = n.next {
+			alt.WriteString(n.html)
+		}
+		b.node.next, p.tail = nil, b.node
+		b.node.html = fmt.Sprintf(`<img src="%s" alt="%s"%s />`, href, anyTagRe.ReplaceAllString(alt.String(), ""), titleAttr)
+	} else {
+		b.node.html = fmt.Sprintf(`<a href="%s"%s>`, href, titleAttr)
+		p.push("</a>")
+		// No links inside links
+		for _, o := range p.brackets {
+			if !o.image {
+				o.active = false
+			}
+		}
+	}
+	return end, true
+}
+
+// parseInlineLink parses `(destination "title")` at s[i:].
+func parseInlineLink(s string, i int) (dest, title string, end int, ok bool) {
+	if i >= len(s) || s[i] != '(' {
+		return "", "", 0, false
+	}
+	j := skipLinkSpace(s, i+1)
+	if j < len(s) && s[j] == '<' {
+		k := j + 1
+		for k < len(s) && s[k] != '>' && s[k] != '\n' && s[k] != '<' {
+			if s[k] == '\\' {
+				k++
+			}
+			k++
+		}
+		if k >= len(s) || s[k] != '>' {
+			return "", "", 0, false
+		}
+		dest, j = s[j+1:k], k+1
+	} else {
+		depth, k := 0, j
+		for k < len(s) {
+			c := s[k]
+			if c == '\\' && k+1 < len(s) && isASCIIPunct(s[k+1]) {
+				k += 2
+				continue
+			}
+			if c <= ' ' {
+				break
+			}
+			if c == '(' {
+				depth++
+			} else if c == ')' {
+				if depth == 0 {
+					break
+				}
+				depth--
+			}
+			k++
+		}
+		if depth != 0 {
+			return "", "", 0, false
+		}
+		dest, j = s[j:k], k
+	}
+	k := skipLinkSpace(s, j)
+	if k > j && k < len(s) && (s[k] == '"' || s[k] == '\'' || s[k] == '(') {
+		closer := s[k]
+		if closer == '(' {
+			closer = ')'
+		}
+		m := k + 1
+		for m < len(s) && s[m] != closer {
+			if s[m] == '\\' {
+				m++
+			}
+			m++
+		}
+		if m >= len(s) {
+			return "", "", 0, false
+		}
+		title, k = s[k+1:m], skipLinkSpace(s, m+1)
+	}
+	if k >= len(s) || s[k] != ')' {
+		return "", "", 0, false
+	}
+	return unescapeMarkdown(dest), unescapeMarkdown(title), k + 1, true
+}
+
+func skipLinkSpace(s string, i int) int {
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t' || s[i] == '\n') {
+		i++
+	}
+	return i
+}
+
+// processEmphasis matches the delimiter runs from index bottom into <em>,
+// <strong> and <del> elements.
+func (p *mdInline) processEmphasis(bottom int) {
+	ds := p.delims[bottom:]
+	for ci, c := range ds {
+		if c.dead || !c.canClose {
+			continue
+		}
+		for c.n > 0 {
+			oi := -1
+			for j := ci - 1; j >= 0; j-- {
+				o := ds[j]
+				if o.dead || o.ch != c.ch || !o.canOpen || o.n == 0 {
+					continue
+				}
+				if c.ch == '~' {
+					if o.n != c.n {
+						continue
+					}
+				} else if (o.canClose || c.canOpen) && (o.orig+c.orig)%3 == 0 && !(o.orig%3 == 0 && c.orig%3 == 0) {
+					continue
+				}
+				oi = j
+				break
+			}
+			if oi < 0 {
+				break
+			}
+			o := ds[oi]
+			use, tag := 1, "em"
+			switch {
+			case c.ch == '~':
+				use, tag = c.n, "del"
+			case o.n >= 2 && c.n >= 2:
+				use, tag = 2, "strong"
+			}
+			o.n -= use
+			c.n -= use
+			o.node.html = o.node.html[:o.n]
+			c.node.html = c.node.html[:c.n]
+			insertAfter(o.node, "<"+tag+">")
+			insertBefore(c.node, "</"+tag+">")
+			for _, between := range ds[oi+1 : ci] {
+				between.dead = true
+			}
+			if o.n == 0 {
+				o.dead = true
+			}
+		}
+		if c.n == 0 {
+			c.dead = true
+		}
+	}
+}
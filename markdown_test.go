@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	cases := []struct{ in, want string }{
+		{"# Title #\n\nSome *em*, **strong**, ***both*** and ~~gone~~.\n",
+			"<h1>Title</h1>\n<p>Some <em>em</em>, <strong>strong</strong>, <em><strong>both</strong></em> and <del>gone</del>.</p>\n"},
+		{"Setext\n======\n\nSub\n---\n", "<h1>Setext</h1>\n<h2>Sub</h2>\n"},
+		{"snake_case_name and _under_ and *a **b** c*\n",
+			"<p>snake_case_name and <em>under</em> and <em>a <strong>b</strong> c</em></p>\n"},
+		{"a  \nb\\\nc\nd\n", "<p>a<br />\nb<br />\nc\nd</p>\n"},
+		{"`code <b>` and `` a`b ``\n", "<p><code>code &lt;b&gt;</code> and <code>a`b</code></p>\n"},
+		{"\\*not em\\* &copy; &bogus; 5 < 6 & \"q\"\n", "<p>*not em* © &amp;bogus; 5 &lt; 6 &amp; &quot;q&quot;</p>\n"},
+		{"```go\nfmt.Println(\"<hi>\")\n```\n\n    indented\n",
+			"<pre><code class=\"language-go\">fmt.Println(&quot;&lt;hi&gt;&quot;)\n</code></pre>\n<pre><code>indented\n</code></pre>\n"},
+		{"> quoted\nlazy\n>\n> - item\n", "<blockquote>\n<p>quoted\nlazy</p>\n<ul>\n<li>item</li>\n</ul>\n</blockquote>\n"},
+		{"- one\n- two\n  - nested\n- [x] done\n- [ ] todo\n",
+			"<ul>\n<li>one</li>\n<li>two\n<ul>\n<li>nested</li>\n</ul>\n</li>\n<li><input type=\"checkbox\" checked=\"\" disabled=\"\" /> done</li>\n<li><input type=\"checkbox\" disabled=\"\" /> todo</li>\n</ul>\n"},
+		{"3. three\n\n4. four\n", "<ol start=\"3\">\n<li>\n<p>three</p>\n</li>\n<li>\n<p>four</p>\n</li>\n</ol>\n"},
+		{"* a\n\n---\n", "<ul>\n<li>a</li>\n</ul>\n<hr />\n"},
+		{"[link](/a \"T\") [ref][r] [r] ![img](a.png \"A & B\") <https://x.org> www.example.com/x. https://e.com/(a)).\n\n[r]: https://r.example \"Ref\"\n",
+			"<p><a href=\"/a\" title=\"T\">link</a> <a href=\"https://r.example\" title=\"Ref\">ref</a> <a href=\"https://r.example\" title=\"Ref\">r</a> " +
+				"<img src=\"a.png\" alt=\"img\" title=\"A &amp; B\" /> <a href=\"https://x.org\">https://x.org</a> " +
+				"<a href=\"http://www.example.com/x\">www.example.com/x</a>. <a href=\"https://e.com/(a)\">https://e.com/(a)</a>).</p>\n"},
+		{"[*em* `code`](a b) [x](javascript:alert(1)) ![*alt*](i.png)\n",
+			"<p>[<em>em</em> <code>code</code>](a b) <a href=\"\">x</a> <img src=\"i.png\" alt=\"alt\" /></p>\n"},
+		{"[a [b](/b)](/a)\n", "<p>[a <a href=\"/b\">b</a>](/a)</p>\n"},
+		{"<div>\n*raw*\n</div>\n\ntext <span>x</span>\n", "<!-- raw HTML omitted -->\n<p>text <!-- raw HTML omitted -->x<!-- raw HTML omitted --></p>\n"},
+		{"| a | b: | c |\n|:--|:-:|--:|\n| 1 | \\| | `x` |\n| 2 |\n",
+			"<table>\n<thead>\n<tr>\n<th align=\"left\">a</th>\n<th align=\"center\">b:</th>\n<th align=\"right\">c</th>\n</tr>\n</thead>\n<tbody>\n" +
+				"<tr>\n<td align=\"left\">1</td>\n<td align=\"center\">|</td>\n<td align=\"right\"><code>x</code></td>\n</tr>\n" +
+				"<tr>\n<td align=\"left\">2</td>\n<td align=\"center\"></td>\n<td align=\"right\"></td>\n</tr>\n</tbody>\n</table>\n"},
+		{"[a b]: /url\n", ""},
+		{"", ""},
+	}
+	for _, c := range cases {
+		if got := string(renderMarkdown([]byte(c.in))); got != c.want {
+			t.Errorf("renderMarkdown(%q) =\n%q\nwant\n%q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestRenderMarkdown_Footnotes(t *testing.T) {
+	t.Cleanup(func() { config.Footnotes = "" })
+	in := "Claim[^a] and again[^a], then[^b].\n\n[^a]: A *source*.\n[^b]: First.\n\n    Second.\n"
+	if got := string(renderMarkdown([]byte(in))); strings.Contains(got, "footnote") {
+		t.Errorf("footnotes rendered without a footnote style:\n%s", got)
+	}
+	config.Footnotes = footnotesPopover
+	want := "<p>Claim<sup class=\"footnote-ref\"><a href=\"#fn-a\" id=\"fnref-a\" data-footnote-ref>1</a></sup> and again" +
+		"<sup class=\"footnote-ref\"><a href=\"#fn-a\" id=\"fnref-a-2\" data-footnote-ref>1</a></sup>, then" +
+		"<sup class=\"footnote-ref\"><a href=\"#fn-b\" id=\"fnref-b\" data-footnote-ref>2</a></sup>.</p>\n" +
+		"<section class=\"footnotes\" data-footnotes>\n<ol>\n<li id=\"fn-a\">\n<p>A <em>source</em>." +
+		" <a href=\"#fnref-a\" class=\"footnote-backref\" data-footnote-backref data-footnote-backref-idx=\"1\" aria-label=\"Back to reference 1\">↩</a>" +
+		" <a href=\"#fnref-a-2\" class=\"footnote-backref\" data-footnote-backref data-footnote-backref-idx=\"1-2\" aria-label=\"Back to reference 1-2\">↩<sup class=\"footnote-ref\">2</sup></a></p>\n</li>\n" +
+		"<li id=\"fn-b\">\n<p>First.</p>\n<p>Second. <a href=\"#fnref-b\" class=\"footnote-backref\" data-footnote-backref data-footnote-backref-idx=\"2\" aria-label=\"Back to reference 2\">↩</a></p>\n</li>\n" +
+		"</ol>\n</section>\n"
+	if got := string(renderMarkdown([]byte(in))); got != want {
+		t.Errorf("footnotes =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestConvertMarkdown_Builtin(t *testing.T) {
+	// The built-in renderer feeds the same rewrites as cmark-gfm
+	body, err := convertMarkdown(builtinConverter, []byte("![Cat](cat.png \"A cat\")\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(body); got != "<figure><img src=\"cat.png\" alt=\"Cat\" title=\"A cat\" /><figcaption>A cat</figcaption></figure>\n" {
+		t.Errorf("convertMarkdown = %q", got)
+	}
+}
+
+func TestConvertMarkdown_FrontMatter(t *testing.T) {
+	md := []byte("---\ntitle: Trip\ndate: 2024-05-01T10:00:00Z\ntags: [travel, food & drink]\n---\n# Rome\n")
+	body, err := convertMarkdown(builtinConverter, md)
+	if err != nil || string(body) != "<h1>Rome</h1>\n" {
+		t.Errorf("convertMarkdown = %q, %v", body, err)
+	}
+	got := string(applyPageHooks([]byte("<title>{{title}}</title><time>{{date}}</time><p>{{tags}}</p>"), md))
+	if !strings.HasPrefix(got, "<title>Trip</title><time>2024-05-01</time><p>travel, food &amp; drink</p>") {
+		t.Errorf("page hooks = %q", got)
+	}
+}
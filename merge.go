@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// mergeRequest is the JSON body accepted by POST /merge.
+type mergeRequest struct {
+	Files  []string `json:"files"`  // in the order they are combined
+	Target string   `json:"target"` // a new note, or one of Files
+	// Title heads the merged note; it defaults to the first file's title.
+	Title string `json:"title,omitempty"`
+	// Trash moves the merged files, other than the target, to .trash.
+	Trash bool `json:"trash,omitempty"`
+}
+
+type mergeResponse struct {
+	File    string   `json:"file"`
+	Trashed []string `json:"trashed,omitempty"` // paths in the trash
+}
+
+// noteName returns the title of the note name with content: its front
+// matter title or first H1, else its filename.
+func noteName(name string, content []byte) string {
+	if t := pageTitle(content); t != "" {
+		return t
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// mergeNotes combines notes (by name, in order) under a `#` title. Each
+// note becomes a `##` section headed by its title, with its own H1 dropped
+// and its other headings shifted to sit below; a note titled like the
+// merged note has no heading of its own. Front matter is dropped, apart
+// from private: and password:, which carry over from any note setting them.
+func mergeNotes(title string, names []string, contents [][]byte) []byte {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "# %s\n", title)
+	keep := map[string]string{}
+	for i, content := range contents {
+		fields, body := parseFrontMatter(content)
+		for _, key := range []string{"private", "password"} {
+			if v := fields[key]; v != "" && keep[key] == "" {
+				keep[key] = v
+			}
+		}
+		hs := parseHeadings(body)
+		if len(hs) > 0 && hs[0].Level == 1 && hs[0].Text == extractTitle(body) {
+			body = append(append([]byte{}, body[:hs[0].Start]...), body[hs[0].End:]...)
+			hs = parseHeadings(body)
+		}
+		noteTitle := noteName(names[i], content)
+		level := 2 // where the note's top headings go
+		if noteTitle != title {
+			fmt.Fprintf(&out, "\n## %s\n", noteTitle)
+			level = 3
+		}
+		if len(hs) > 0 {
+			top := hs[0].Level
+			for _, h := range hs {
+				if h.Level < top {
+					top = h.Level
+				}
+			}
+			body = shiftHeadings(body, level-top)
+		}
+		if body = bytes.TrimSpace(body); len(body) > 0 {
+			out.WriteString("\n")
+			out.Write(body)
+			out.WriteString("\n")
+		}
+	}
+	data := out.Bytes()
+	for _, key := range []string{"private", "password"} {
+		if v := keep[key]; v != "" {
+			data = setFrontMatterField(data, key, v)
+		}
+	}
+	return data
+}
+
+// handleMerge concatenates the notes listed in the JSON body into target,
+// adjusting heading levels so each note becomes a section, and exports the
+// result. Every note involved is locked while merging.
+func handleMerge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req mergeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Files) < 2 {
+		http.Error(w, "merge needs at least two files", http.StatusBadRequest)
+		return
+	}
+	validName := func(name string) bool {
+		return name != "" && filepath.Base(name) == name && strings.EqualFold(filepath.Ext(name), ".md")
+	}
+	seen := map[string]bool{}
+	for _, name := range req.Files {
+		if !validName(name) || seen[name] {
+			http.Error(w, fmt.Sprintf("invalid or repeated filename %q", name), http.StatusBadRequest)
+			return
+		}
+		seen[name] = true
+	}
+	if !validName(req.Target) {
+		http.Error(w, "invalid target", http.StatusBadRequest)
+		return
+	}
+	targetIsSource := seen[req.Target]
+	if _, err := os.Stat(wsPath(req.Target)); err == nil && !targetIsSource {
+		http.Error(w, "target already exists", http.StatusConflict)
+		return
+	}
+
+	names := req.Files
+	if !targetIsSource {
+		names = append(append([]string{}, req.Files...), req.Target)
+	}
+	for _, name := range names {
+		tok, ok := acquireLock(name)
+		if !ok {
+			http.Error(w, name+" is "+lockHolder(name), http.StatusLocked)
+			return
+		}
+		defer releaseLock(name, tok)
+	}
+	contents := make([][]byte, len(req.Files))
+	encrypted := encryptedNote(req.Target)
+	var prev []byte
+	for i, name := range req.Files {
+		b, err := readNote(name)
+		if err != nil {
+			if os.IsNotExist(err) {
+				http.Error(w, fmt.Sprintf("%s not found", name), http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		contents[i] = b
+		encrypted = encrypted || encryptedNote(name)
+		if name == req.Target {
+			prev = b
+		}
+	}
+
+	title := strings.Join(strings.Fields(req.Title), " ")
+	if title == "" {
+		title = noteName(req.Files[0], contents[0])
+	}
+	data := mergeNotes(title, req.Files, contents)
+	sealed, err := sealNote(data, encrypted)
+	if err == nil {
+		err = os.WriteFile(wsPath(req.Target), sealed, 0644)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if prev != nil {
+		pushUndo(req.Target, prev, data)
+	}
+	resp := mergeResponse{File: req.Target}
+	if req.Trash {
+		for _, name := range req.Files {
+			if name == req.Target {
+				continue
+			}
+			dst, err := moveToTrash(name)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			resp.Trashed = append(resp.Trashed, filepath.ToSlash(dst))
+		}
+	}
+	afterSave(req.Target)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(resp)
+}
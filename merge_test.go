@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func postMerge(t *testing.T, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	handleMerge(rr, httptest.NewRequest(http.MethodPost, "/merge", strings.NewReader(body)))
+	return rr
+}
+
+func TestHandleMerge(t *testing.T) {
+	chdirTemp(t)
+	locks = make(map[string]lockInfo)
+	writeFiles(t, map[string]string{
+		"week.md":    "# Week\n\nPlans.\n\n## Goals\n\nShip it.\n",
+		"monday.md":  "---\nprivate: true\ntags: [log]\n---\n# Monday\n\nWoke up.\n\n## Lunch\n\nSoup.\n",
+		"tuesday.md": "Just text.\n\n### Deep\n\nx\n",
+	})
+	if err := os.Mkdir(trashDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, map[string]string{filepath.Join(trashDir, "monday.md"): "older"})
+
+	rr := postMerge(t, `{"files": ["week.md", "monday.md", "tuesday.md"], "target": "week.md", "trash": true}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("merge: %d %s", rr.Code, rr.Body.String())
+	}
+	var resp mergeResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.File != "week.md" || strings.Join(resp.Trashed, ",") != ".trash/monday-1.md,.trash/tuesday.md" {
+		t.Errorf("response %+v", resp)
+	}
+	want := "---\nprivate: true\n---\n# Week\n\nPlans.\n\n## Goals\n\nShip it.\n\n## Monday\n\nWoke up.\n\n### Lunch\n\nSoup.\n\n## tuesday\n\nJust text.\n\n### Deep\n\nx\n"
+	if b, _ := os.ReadFile("week.md"); string(b) != want {
+		t.Errorf("week.md =\n%q\nwant\n%q", b, want)
+	}
+	for _, name := range []string{"monday.md", "tuesday.md"} {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%s not trashed", name)
+		}
+	}
+	if prev, ok := popUndo("week.md"); !ok || !strings.HasPrefix(string(prev), "# Week\n\nPlans.") {
+		t.Errorf("undo %q %v", prev, ok)
+	}
+	if len(locks) != 0 {
+		t.Errorf("locks left: %v", locks)
+	}
+}
+
+func TestHandleMerge_NewTargetAndErrors(t *testing.T) {
+	chdirTemp(t)
+	locks = make(map[string]lockInfo)
+	writeFiles(t, map[string]string{"a.md": "# A\n\nalpha\n", "b.md": "# B\n\nbeta\n"})
+
+	for body, code := range map[string]int{
+		`{"files": ["a.md"], "target": "c.md"}`:               http.StatusBadRequest,
+		`{"files": ["a.md", "a.md"], "target": "c.md"}`:       http.StatusBadRequest,
+		`{"files": ["a.md", "../b.md"], "target": "c.md"}`:    http.StatusBadRequest,
+		`{"files": ["a.md", "b.md"], "target": "c.txt"}`:      http.StatusBadRequest,
+		`{"files": ["a.md", "missing.md"], "target": "c.md"}`: http.StatusNotFound,
+	} {
+		if rr := postMerge(t, body); rr.Code != code {
+			t.Errorf("%s: %d, want %d", body, rr.Code, code)
+		}
+	}
+
+	locks["b.md"] = lockInfo{token: "other", expires: time.Now().Add(time.Hour)}
+	if rr := postMerge(t, `{"files": ["a.md", "b.md"], "target": "c.md"}`); rr.Code != http.StatusLocked {
+		t.Errorf("locked: %d", rr.Code)
+	}
+	delete(locks, "b.md")
+
+	rr := postMerge(t, `{"files": ["a.md", "b.md"], "target": "c.md", "title": "Both\nnotes"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("merge: %d %s", rr.Code, rr.Body.String())
+	}
+	if b, _ := os.ReadFile("c.md"); string(b) != "# Both notes\n\n## A\n\nalpha\n\n## B\n\nbeta\n" {
+		t.Errorf("c.md = %q", b)
+	}
+	if _, err := os.Stat("a.md"); err != nil {
+		t.Error("a.md removed without trash")
+	}
+	if rr := postMerge(t, `{"files": ["a.md", "b.md"], "target": "c.md"}`); rr.Code != http.StatusConflict {
+		t.Errorf("existing target: %d", rr.Code)
+	}
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --------- Persistent metadata index ---------
+
+// docMeta is what the index knows about one markdown file.
+type docMeta struct {
+	Name    string    `json:"name"`
+	Title   string    `json:"title"`
+	Tags    []string  `json:"tags,omitempty"`
+	Date    time.Time `json:"date,omitempty"` // front matter date
+	Updated time.Time `json:"updated"`        // ordering time, see docTime
+	ModTime time.Time `json:"mtime"`
+	Size    int64     `json:"size"`
+	Links   []string  `json:"links,omitempty"` // link targets as written
+	Words   int       `json:"words"`
+	// Content is the note's Markdown, which /search matches against. It is
+	// kept in memory only, so saves don't rewrite every note's body; entries
+	// loaded from disk are without it until refreshContent reads it.
+	// Encrypted notes are marked instead and keep their content out.
+	Content    string `json:"-"`
+	hasContent bool
+	Encrypted  bool `json:"encrypted,omitempty"`
+	// Lang and TranslationOf come from front matter lang: and translation_of:.
+	Lang          string `json:"lang,omitempty"`
+	TranslationOf string `json:"translation_of,omitempty"`
+	// Category is the normalized front matter category:, e.g. "Guides/Networking".
+	Category string `json:"category,omitempty"`
+	// Series and SeriesPart come from front matter series: and series_part:.
+	Series     string `json:"series,omitempty"`
+	SeriesPart int    `json:"series_part,omitempty"`
+	// Private notes (private: or draft: front matter, or encrypted) are
+	// never exported.
+	Private bool `json:"private,omitempty"`
+	Rev     int  `json:"rev"` // docMetaRev when the entry was read
+}
+
+// docMetaRev is bumped when docMeta gains fields, so entries persisted by
+// older versions are re-read.
+const docMetaRev = 6
+
+// metaIndex caches docMeta for every markdown file in a directory and
+// persists it to .minimark/index.json, so only files whose size or mtime
+// changed are re-read.
+type metaIndex struct {
+	mu        sync.Mutex
+	root      string // absolute directory the index describes
+	docs      map[string]docMeta
+	list      *dirListing // cached markdown file names in root
+	saveTimer *time.Timer // pending save scheduled by update
+}
+
+// dirListing is a cached scan of a directory's markdown files. It stays
+// valid while neither the directory nor its ignore file changes; saves
+// through the server drop it too.
+type dirListing struct {
+	names     []string
+	dirMod    time.Time
+	ignoreMod time.Time
+	scanned   time.Time
+}
+
+// listingRacyWindow guards against file systems with coarse timestamps: a
+// scan taken this soon after the directory changed may have missed a change
+// made in the same tick, so it is not reused.
+const listingRacyWindow = time.Second
+
+var docIndex = &metaIndex{}
+
+// indexSaveDelay coalesces the saves of quick successive updates, such as a
+// batch or a series export, into one write. An update lost to a crash
+// meanwhile is harmless: its file's size or mtime no longer matches, so it
+// is re-read on the next refresh.
+const indexSaveDelay = 250 * time.Millisecond
+
+// indexPath is where the index is persisted, relative to its directory.
+var indexPath = filepath.Join(".minimark", "index.json")
+
+// load switches the index to dir, reading its persisted state. Callers hold mu.
+func (x *metaIndex) load(dir string) {
+	abs, err := filepath.Abs(wsPath(dir))
+	if err != nil {
+		abs = dir
+	}
+	if x.docs != nil && x.root == abs {
+		return
+	}
+	if x.saveTimer != nil {
+		// The index being left is written before it is dropped
+		x.saveTimer.Stop()
+		x.saveTimer = nil
+		x.save()
+	}
+	x.root = abs
+	x.docs = map[string]docMeta{}
+	x.list = nil
+	b, err := os.ReadFile(wsPath(filepath.Join(dir, indexPath)))
+	if err != nil {
+		return
+	}
+	var docs []docMeta
+	if err := json.Unmarshal(b, &docs); err != nil {
+		log.Printf("ignoring corrupt metadata index: %v", err)
+		return
+	}
+	for _, d := range docs {
+		x.docs[d.Name] = d
+	}
+}
+
+// save persists the index. Callers hold mu.
+func (x *metaIndex) save() {
+	docs := make([]docMeta, 0, len(x.docs))
+	for _, d := range x.docs {
+		docs = append(docs, d)
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].Name < docs[j].Name })
+	b, err := json.Marshal(docs)
+	if err != nil {
+		return
+	}
+	path := filepath.Join(x.root, indexPath)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	// Write then rename so a crash never leaves a truncated index
+	tmp := path + ".tmp"
+	err = os.WriteFile(tmp, b, 0644)
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		log.Printf("metadata index not saved: %v", err)
+	}
+}
+
+// saveSoon schedules a save of the index, like stateChanged does for the
+// server state. Callers hold mu.
+func (x *metaIndex) saveSoon() {
+	if x.saveTimer != nil {
+		return
+	}
+	var t *time.Timer
+	t = time.AfterFunc(indexSaveDelay, func() {
+		x.mu.Lock()
+		defer x.mu.Unlock()
+		if x.saveTimer != t {
+			return
+		}
+		x.saveTimer = nil
+		// Nothing is written for a workspace that went away meanwhile
+		if _, err := os.Stat(x.root); err == nil {
+			x.save()
+		}
+	})
+	x.saveTimer = t
+}
+
+// flush writes a scheduled save straight away.
+func (x *metaIndex) flush() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.saveTimer != nil {
+		x.saveTimer.Stop()
+		x.saveTimer = nil
+		x.save()
+	}
+}
+
+// listing returns the markdown files in dir like listMarkdownFiles, from
+// the cached scan when the directory has not changed since.
+func (x *metaIndex) listing(dir string) ([]string, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.load(dir)
+	return x.listLocked(dir)
+}
+
+// listLocked implements listing. Callers hold mu and have loaded dir.
+func (x *metaIndex) listLocked(dir string) ([]string, error) {
+	info, err := os.Stat(wsPath(dir))
+	if err != nil {
+		return nil, err
+	}
+	var ignoreMod time.Time
+	if ig, err := os.Stat(wsPath(filepath.Join(dir, ignoreFileName))); err == nil {
+		ignoreMod = ig.ModTime()
+	}
+	if l := x.list; l != nil && l.dirMod.Equal(info.ModTime()) && l.ignoreMod.Equal(ignoreMod) && l.scanned.Sub(l.dirMod) > listingRacyWindow {
+		return append([]string(nil), l.names...), nil
+	}
+	scanned := time.Now()
+	names, err := listMarkdownFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	x.list = &dirListing{names: names, dirMod: info.ModTime(), ignoreMod: ignoreMod, scanned: scanned}
+	return append([]string(nil), names...), nil
+}
+
+// refresh reconciles the index with the markdown files in dir, re-reading
+// only new or changed files, and returns a snapshot of all entries.
+func (x *metaIndex) refresh(dir string) ([]docMeta, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.refreshLocked(dir)
+}
+
+// refreshContent is refresh, with the content of every entry that is not
+// encrypted.
+func (x *metaIndex) refreshContent(dir string) ([]docMeta, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	docs, err := x.refreshLocked(dir)
+	if err != nil {
+		return nil, err
+	}
+	for i, d := range docs {
+		if d.hasContent || d.Encrypted {
+			continue
+		}
+		b, err := os.ReadFile(wsPath(filepath.Join(dir, d.Name)))
+		if err != nil {
+			continue
+		}
+		d.Content, d.hasContent = string(b), true
+		docs[i] = d
+		x.docs[d.Name] = d
+	}
+	return docs, nil
+}
+
+// refreshLocked implements refresh. Callers hold mu.
+func (x *metaIndex) refreshLocked(dir string) ([]docMeta, error) {
+	x.load(dir)
+	names, err := x.listLocked(dir)
+	if err != nil {
+		return nil, err
+	}
+	changed := false
+	present := make(map[string]bool, len(names))
+	for _, name := range names {
+		present[name] = true
+		info, err := os.Stat(wsPath(filepath.Join(dir, name)))
+		if err != nil {
+			continue
+		}
+		if d, ok := x.docs[name]; ok && d.Rev == docMetaRev && d.Size == info.Size() && d.ModTime.Equal(info.ModTime()) {
+			continue
+		}
+		if d, ok := readDocMeta(dir, name); ok {
+			x.docs[name] = d
+			changed = true
+		}
+	}
+	for name := range x.docs {
+		if !present[name] {
+			delete(x.docs, name)
+			changed = true
+		}
+	}
+	if changed {
+		if x.saveTimer != nil {
+			x.saveTimer.Stop()
+			x.saveTimer = nil
+		}
+		x.save()
+	}
+	docs := make([]docMeta, 0, len(x.docs))
+	for _, name := range names {
+		if d, ok := x.docs[name]; ok {
+			docs = append(docs, d)
+		}
+	}
+	return docs, nil
+}
+
+// update re-indexes a single file in dir after it was written, or drops it
+// if it no longer exists.
+func (x *metaIndex) update(dir, name string) {
+	seenNotes.record(filepath.Join(dir, name))
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.load(dir)
+	x.list = nil
+	if d, ok := readDocMeta(dir, name); ok {
+		x.docs[name] = d
+	} else {
+		delete(x.docs, name)
+	}
+	x.saveSoon()
+}
+
+var (
+	mdLinkRe   = regexp.MustCompile(`\]\(\s*<?([^)\s>]+)>?(?:\s+"[^"]*")?\s*\)`)
+	autoLinkRe = regexp.MustCompile(`<(https?://[^>\s]+)>`)
+	// bareURLRe matches URLs written out in the text, which GFM links too,
+	// without the punctuation ending a sentence.
+	bareURLRe = regexp.MustCompile(`(?:^|[ \t\n])(https?://[^\s<>]*[^\s<>.,;:!?'")\]*_~])`)
+)
+
+// readDocMeta reads and analyses one markdown file.
+func readDocMeta(dir, name string) (docMeta, bool) {
+	path := filepath.Join(dir, name)
+	info, err := os.Stat(wsPath(path))
+	if err != nil {
+		return docMeta{}, false
+	}
+	b, err := os.ReadFile(wsPath(path))
+	if err != nil {
+		return docMeta{}, false
+	}
+	// Keep the content of encrypted notes out of the persisted index
+	if isEncryptedNote(b) {
+		return docMeta{Name: name, Updated: info.ModTime(), ModTime: info.ModTime(), Size: info.Size(), Encrypted: true, Private: true, Rev: docMetaRev}, true
+	}
+	fields, body := parseFrontMatter(b)
+	d := docMeta{
+		Name:       name,
+		Title:      fields["title"],
+		Tags:       frontMatterList(fields["tags"]),
+		Updated:    docTime(path, info),
+		ModTime:    info.ModTime(),
+		Size:       info.Size(),
+		Links:      extractLinks(body),
+		Words:      len(strings.Fields(string(body))),
+		Content:    string(b),
+		hasContent: true,
+
+		Lang:          fields["lang"],
+		TranslationOf: fields["translation_of"],
+		Category:      normalizeCategory(fields["category"]),
+		Series:        unquote(strings.TrimSpace(fields["series"])),
+		Private:       notePrivate(b),
+		Rev:           docMetaRev,
+	}
+	if d.Title == "" {
+		d.Title = extractTitle(body)
+	}
+	if t, ok := parseFrontMatterDate(fields["date"]); ok {
+		d.Date = t
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(fields["series_part"])); err == nil && n > 0 {
+		d.SeriesPart = n
+	}
+	return d, true
+}
+
+// extractLinks returns the targets of inline Markdown links, autolinks and
+// bare URLs.
+func extractLinks(md []byte) []string {
+	var links []string
+	for _, m := range mdLinkRe.FindAllSubmatch(md, -1) {
+		links = append(links, string(m[1]))
+	}
+	for _, m := range autoLinkRe.FindAllSubmatch(md, -1) {
+		links = append(links, string(m[1]))
+	}
+	for _, m := range bareURLRe.FindAllSubmatch(md, -1) {
+		links = append(links, string(m[1]))
+	}
+	return links
+}
+
+// localLinkTarget maps a link target to the markdown basename it points at
+// within the workspace ("note.html#x" -> "note.md"), or "" for external links.
+func localLinkTarget(link string) string {
+	if strings.Contains(link, "://") || strings.HasPrefix(link, "mailto:") || strings.HasPrefix(link, "#") {
+		return ""
+	}
+	if i := strings.IndexAny(link, "#?"); i >= 0 {
+		link = link[:i]
+	}
+	base := filepath.Base(filepath.FromSlash(link))
+	ext := strings.ToLower(filepath.Ext(base))
+	if ext != ".md" && ext != ".html" {
+		return ""
+	}
+	return strings.TrimSuffix(base, filepath.Ext(base)) + ".md"
+}
+
+// handleBacklinks lists, as JSON, the files whose links point at the file
+// given by the `file` query param.
+func handleBacklinks(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("file")
+	if name == "" || filepath.Base(name) != name {
+		http.Error(w, "invalid filename", http.StatusBadRequest)
+		return
+	}
+	docs, err := docIndex.refresh(".")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// index.html may stand for readme.md
+	targets := map[string]bool{strings.ToLower(name): true}
+	if htmlOutNameFor(name) == "index.html" {
+		targets["index.md"] = true
+	}
+	backlinks := []string{}
+	for _, d := range docs {
+		if d.Name == name {
+			continue
+		}
+		for _, l := range d.Links {
+			if t := localLinkTarget(l); t != "" && targets[strings.ToLower(t)] {
+				backlinks = append(backlinks, d.Name)
+				break
+			}
+		}
+	}
+	sort.Slice(backlinks, func(i, j int) bool { return strings.ToLower(backlinks[i]) < strings.ToLower(backlinks[j]) })
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(backlinks)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetaIndex_RefreshAndPersist(t *testing.T) {
+	chdirTemp(t)
+	writeFiles(t, map[string]string{
+		"a.md": "---\ntitle: Alpha\ntags: [x]\ndate: 2024-01-02\n---\nsee [b](b.md) and <https://example.com>\nhttps://example.org/x.\n",
+		"b.md": "# Bee\nthree words here",
+	})
+	x := &metaIndex{}
+	docs, err := x.refresh(".")
+	if err != nil || len(docs) != 2 {
+		t.Fatalf("docs = %+v err=%v", docs, err)
+	}
+	a := docs[0]
+	if a.Title != "Alpha" || !reflect.DeepEqual(a.Tags, []string{"x"}) || a.Date.IsZero() || a.Words != 5 {
+		t.Fatalf("a = %+v", a)
+	}
+	if !reflect.DeepEqual(a.Links, []string{"b.md", "https://example.com", "https://example.org/x"}) {
+		t.Fatalf("links = %v", a.Links)
+	}
+	if docs[1].Title != "Bee" || docs[1].Content != "# Bee\nthree words here" {
+		t.Fatalf("b = %+v", docs[1])
+	}
+	if b, err := os.ReadFile(indexPath); err != nil || strings.Contains(string(b), "three words") {
+		t.Fatalf("index not persisted without content: %s %v", b, err)
+	}
+
+	// A fresh index loads the persisted state; removed files are dropped
+	if err := os.Remove("b.md"); err != nil {
+		t.Fatal(err)
+	}
+	y := &metaIndex{}
+	docs, err = y.refresh(".")
+	if err != nil || len(docs) != 1 || docs[0].Name != "a.md" {
+		t.Fatalf("docs = %+v err=%v", docs, err)
+	}
+	// Content is read again when it is asked for
+	docs, err = y.refreshContent(".")
+	if err != nil || len(docs) != 1 || !strings.Contains(docs[0].Content, "see [b](b.md)") {
+		t.Fatalf("docs = %+v err=%v", docs, err)
+	}
+}
+
+func TestMetaIndex_UpdateSavesLater(t *testing.T) {
+	chdirTemp(t)
+	writeFiles(t, map[string]string{"a.md": "# A"})
+	x := &metaIndex{}
+	if _, err := x.refresh("."); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, map[string]string{"b.md": "# B", "c.md": "# C"})
+	x.update(".", "b.md")
+	x.update(".", "c.md")
+	if b, _ := os.ReadFile(indexPath); strings.Contains(string(b), "b.md") {
+		t.Fatalf("saved on update: %s", b)
+	}
+	x.flush()
+	b, err := os.ReadFile(indexPath)
+	if err != nil || !strings.Contains(string(b), `"b.md"`) || !strings.Contains(string(b), `"c.md"`) {
+		t.Fatalf("index after flush: %s %v", b, err)
+	}
+	if _, err := os.Stat(indexPath + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left: %v", err)
+	}
+}
+
+func TestMetaIndex_CorruptIndexIgnored(t *testing.T) {
+	chdirTemp(t)
+	writeFiles(t, map[string]string{"a.md": "# A"})
+	if err := os.MkdirAll(".minimark", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(indexPath, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	docs, err := (&metaIndex{}).refresh(".")
+	if err != nil || len(docs) != 1 || docs[0].Title != "A" {
+		t.Fatalf("docs = %+v err=%v", docs, err)
+	}
+}
+
+func TestLocalLinkTarget(t *testing.T) {
+	cases := map[string]string{
+		"note.md":            "note.md",
+		"docs/note.html#top": "note.md",
+		"note.html?x=1":      "note.md",
+		"https://x.com/a.md": "",
+		"mailto:a@b.c":       "",
+		"#section":           "",
+		"image.png":          "",
+	}
+	for in, want := range cases {
+		if got := localLinkTarget(in); got != want {
+			t.Errorf("localLinkTarget(%q) = %q; want %q", in, got, want)
+		}
+	}
+}
+
+func TestHandleBacklinks(t *testing.T) {
+	chdirTemp(t)
+	docIndex = &metaIndex{}
+	writeFiles(t, map[string]string{
+		"target.md": "# Target",
+		"a.md":      "[t](target.html)",
+		"b.md":      "[t](target.md#part)",
+		"c.md":      "[other](other.md)",
+	})
+	rr := httptest.NewRecorder()
+	handleBacklinks(rr, httptest.NewRequest(http.MethodGet, "/backlinks?file=target.md", nil))
+	var got []string
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []string{"a.md", "b.md"}) {
+		t.Fatalf("backlinks = %v", got)
+	}
+	rr = httptest.NewRecorder()
+	handleBacklinks(rr, httptest.NewRequest(http.MethodGet, "/backlinks?file=../x.md", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("got %d", rr.Code)
+	}
+}
+
+func TestMetaIndex_OldEntriesReread(t *testing.T) {
+	chdirTemp(t)
+	writeFiles(t, map[string]string{"a.md": "---\nlang: de\n---\n# A"})
+	info, err := os.Stat("a.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An entry persisted before Lang existed, matching size and mtime
+	old, _ := json.Marshal([]docMeta{{Name: "a.md", Title: "A", Size: info.Size(), ModTime: info.ModTime()}})
+	if err := os.MkdirAll(".minimark", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(indexPath, old, 0644); err != nil {
+		t.Fatal(err)
+	}
+	docs, err := (&metaIndex{}).refresh(".")
+	if err != nil || len(docs) != 1 || docs[0].Lang != "de" || docs[0].Rev != docMetaRev {
+		t.Fatalf("docs = %+v err=%v", docs, err)
+	}
+}
+
+func TestMetaIndex_ListingCache(t *testing.T) {
+	chdirTemp(t)
+	writeFiles(t, map[string]string{"a.md": "# A"})
+	old := time.Now().Add(-time.Hour)
+	// touchDir backdates the workspace as if it last changed an hour ago
+	touchDir := func() {
+		t.Helper()
+		if err := os.Chtimes(".", old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	touchDir()
+	x := &metaIndex{}
+	if names, err := x.listing("."); err != nil || !reflect.DeepEqual(names, []string{"a.md"}) {
+		t.Fatalf("names = %v, %v", names, err)
+	}
+	// A change the directory's mtime does not reveal is served from the cache
+	writeFiles(t, map[string]string{"b.md": "# B"})
+	touchDir()
+	if names, _ := x.listing("."); !reflect.DeepEqual(names, []string{"a.md"}) {
+		t.Fatalf("cached names = %v", names)
+	}
+	// Saves drop the cache
+	x.update(".", "b.md")
+	touchDir()
+	if names, _ := x.listing("."); !reflect.DeepEqual(names, []string{"a.md", "b.md"}) {
+		t.Fatalf("names after update = %v", names)
+	}
+	// So do directory and ignore file changes
+	writeFiles(t, map[string]string{ignoreFileName: "a.md\n"})
+	if names, _ := x.listing("."); !reflect.DeepEqual(names, []string{"b.md"}) {
+		t.Fatalf("names after ignore = %v", names)
+	}
+}
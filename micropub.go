@@ -0,0 +1,476 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// micropubConfig enables the Micropub endpoint (https://micropub.spec.indieweb.org/)
+// at /micropub. Clients authenticate with MINIMARK_MICROPUB_TOKEN, or with
+// an IndieAuth token checked against TokenEndpoint.
+type micropubConfig struct {
+	// TokenEndpoint verifies IndieAuth access tokens, e.g.
+	// "https://tokens.indieauth.com/token".
+	TokenEndpoint string `json:"token_endpoint,omitempty"`
+	// Me is the identity tokens must be issued for; it defaults to site_url.
+	Me string `json:"me,omitempty"`
+}
+
+var micropubClient = &http.Client{Timeout: 10 * time.Second}
+
+// micropubFieldRe matches the extra properties kept as front matter, such
+// as in-reply-to or location.
+var micropubFieldRe = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// micropubFields maps Micropub properties onto front matter fields; content
+// is the note body and post-status the private: flag.
+var micropubFields = map[string]string{
+	"name":      "title",
+	"summary":   "description",
+	"published": "date",
+	"updated":   "updated",
+	"category":  "tags",
+}
+
+func validateMicropub(m *micropubConfig) error {
+	if m == nil || m.TokenEndpoint == "" {
+		return nil
+	}
+	if u, err := url.Parse(m.TokenEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("micropub: token_endpoint %q must be an absolute http or https URL", m.TokenEndpoint)
+	}
+	return nil
+}
+
+// micropubError answers with the error format the spec defines.
+func micropubError(w http.ResponseWriter, code int, kind, desc string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": kind, "error_description": desc})
+}
+
+func sameMe(a, b string) bool {
+	return strings.EqualFold(strings.TrimSuffix(a, "/"), strings.TrimSuffix(b, "/"))
+}
+
+// micropubScopes returns the scopes granted to the request's token.
+func micropubScopes(r *http.Request, token string) ([]string, error) {
+	if token == "" {
+		return nil, errors.New("missing access token")
+	}
+	if static := os.Getenv("MINIMARK_MICROPUB_TOKEN"); static != "" && subtle.ConstantTimeCompare([]byte(token), []byte(static)) == 1 {
+		return []string{"create", "update"}, nil
+	}
+	m := config.Micropub
+	if m.TokenEndpoint == "" {
+		return nil, errors.New("invalid access token")
+	}
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, m.TokenEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+	resp, err := micropubClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var info struct {
+		Me    string `json:"me"`
+		Scope string `json:"scope"`
+	}
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&info) != nil {
+		return nil, errors.New("invalid access token")
+	}
+	me := m.Me
+	if me == "" {
+		me = config.SiteURL
+	}
+	if !sameMe(info.Me, me) {
+		return nil, errors.New("token was issued for another site")
+	}
+	return strings.Fields(info.Scope), nil
+}
+
+// micropubRequest is a create or update request, from a form or JSON.
+type micropubRequest struct {
+	Action     string
+	URL        string
+	Properties map[string][]string
+	Replace    map[string][]string
+	Add        map[string][]string
+	Delete     map[string][]string // a nil list deletes the property
+}
+
+// jsonValues flattens Micropub JSON values: strings, and objects such as
+// {"html": ...} or {"value": ...}.
+func jsonValues(raw []json.RawMessage) []string {
+	var out []string
+	for _, v := range raw {
+		var s string
+		if json.Unmarshal(v, &s) == nil {
+			out = append(out, s)
+			continue
+		}
+		var obj map[string]any
+		if json.Unmarshal(v, &obj) == nil {
+			for _, k := range []string{"html", "value"} {
+				if s, ok := obj[k].(string); ok {
+					out = append(out, s)
+					break
+				}
+			}
+		}
+	}
+	return out
+}
+
+func jsonProperties(raw map[string][]json.RawMessage) map[string][]string {
+	props := map[string][]string{}
+	for k, v := range raw {
+		props[k] = jsonValues(v)
+	}
+	return props
+}
+
+// parseMicropub reads a Micropub POST body and returns its access token.
+func parseMicropub(r *http.Request) (micropubRequest, string, error) {
+	req := micropubRequest{Properties: map[string][]string{}}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == r.Header.Get("Authorization") {
+		token = ""
+	}
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mt == "application/json" {
+		var body struct {
+			Type       []string                     `json:"type"`
+			Properties map[string][]json.RawMessage `json:"properties"`
+			Action     string                       `json:"action"`
+			URL        string                       `json:"url"`
+			Replace    map[string][]json.RawMessage `json:"replace"`
+			Add        map[string][]json.RawMessage `json:"add"`
+			Delete     json.RawMessage              `json:"delete"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&body); err != nil {
+			return req, token, errors.New("invalid JSON")
+		}
+		if body.Action == "" && (len(body.Type) == 0 || body.Type[0] != "h-entry") {
+			return req, token, errors.New("only h-entry posts are supported")
+		}
+		req.Action, req.URL = body.Action, body.URL
+		req.Properties = jsonProperties(body.Properties)
+		req.Replace, req.Add = jsonProperties(body.Replace), jsonProperties(body.Add)
+		req.Delete = map[string][]string{}
+		var names []string
+		var values map[string][]json.RawMessage
+		if json.Unmarshal(body.Delete, &names) == nil {
+			for _, n := range names {
+				req.Delete[n] = nil
+			}
+		} else if json.Unmarshal(body.Delete, &values) == nil {
+			req.Delete = jsonProperties(values)
+		}
+		return req, token, nil
+	}
+	if err := r.ParseMultipartForm(1 << 20); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return req, token, errors.New("invalid form")
+	}
+	if token == "" {
+		token = r.PostForm.Get("access_token")
+	}
+	req.Action, req.URL = r.PostForm.Get("action"), r.PostForm.Get("url")
+	if req.Action == "" && r.PostForm.Get("h") != "entry" {
+		return req, token, errors.New("only h=entry posts are supported")
+	}
+	for k, v := range r.PostForm {
+		if k == "h" || k == "access_token" || k == "action" || k == "url" {
+			continue
+		}
+		req.Properties[strings.TrimSuffix(k, "[]")] = append(req.Properties[strings.TrimSuffix(k, "[]")], v...)
+	}
+	return req, token, nil
+}
+
+// setMicropubProperty sets property k of the note md to values. Values
+// stored as front matter are kept to one line.
+func setMicropubProperty(md []byte, k string, values []string) []byte {
+	if k != "content" {
+		for i, v := range values {
+			values[i] = strings.Join(strings.Fields(v), " ")
+		}
+	}
+	switch {
+	case k == "content":
+		fields := md[:len(md)-len(frontMatterBody(md))]
+		return append(append([]byte{}, fields...), strings.TrimSpace(strings.Join(values, "\n\n"))+"\n"...)
+	case k == "category":
+		return setFrontMatterField(md, "tags", formatFrontMatterList(values))
+	case k == "post-status":
+		private := ""
+		if len(values) > 0 && values[0] == "draft" {
+			private = "true"
+		}
+		return setFrontMatterField(md, "private", private)
+	case micropubFields[k] != "":
+		return setFrontMatterField(md, micropubFields[k], strings.Join(values, " "))
+	case micropubFieldRe.MatchString(k) && !strings.HasPrefix(k, "mp-") && k != "private" && k != "password":
+		return setFrontMatterField(md, k, strings.Join(values, " "))
+	}
+	return md
+}
+
+func frontMatterBody(md []byte) []byte {
+	_, body := parseFrontMatter(md)
+	return body
+}
+
+// micropubProperties returns the Micropub properties of the note md.
+func micropubProperties(md []byte) map[string][]string {
+	fields, body := parseFrontMatter(md)
+	props := map[string][]string{"content": {strings.TrimSpace(string(body))}}
+	for prop, field := range micropubFields {
+		if v := fields[field]; v != "" {
+			if prop == "category" {
+				props[prop] = frontMatterList(v)
+			} else {
+				props[prop] = []string{unquote(v)}
+			}
+		}
+	}
+	if p, _ := strconv.ParseBool(fields["private"]); p {
+		props["post-status"] = []string{"draft"}
+	} else {
+		props["post-status"] = []string{"published"}
+	}
+	return props
+}
+
+// micropubPostURL is where the note name can be read: its published page,
+// else its live view on this server.
+func micropubPostURL(r *http.Request, name string) string {
+	if config.SiteURL != "" {
+		return sitePageURL(htmlOutNameFor(name))
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/view/" + url.PathEscape(contentSlug(name))
+}
+
+// micropubNote maps a post URL back to its note, or "".
+func micropubNote(u string) string {
+	if page := sitePageName(u); page != "" && config.SiteURL != "" {
+		return noteForPage(page)
+	}
+	p, err := url.Parse(u)
+	if err != nil || !strings.HasPrefix(p.Path, "/view/") {
+		return ""
+	}
+	return noteForPage(strings.TrimPrefix(p.Path, "/view/") + ".html")
+}
+
+// micropubFilename picks the file for a new post from mp-slug, its name or
+// the start of its content.
+func micropubFilename(props map[string][]string) string {
+	var slug string
+	for _, k := range []string{"mp-slug", "name", "content"} {
+		if v := props[k]; len(v) > 0 {
+			words := strings.Fields(anyTagRe.ReplaceAllString(v[0], " "))
+			if len(words) > 8 {
+				words = words[:8]
+			}
+			if slug = slugify(strings.Join(words, " ")); slug != "" {
+				break
+			}
+		}
+	}
+	if slug == "" {
+		slug = "note-" + time.Now().Format("20060102-150405")
+	}
+	return uniqueAvailableName(slug + ".md")
+}
+
+// handleMicropub is the Micropub endpoint. POST creates notes from h-entry
+// posts (form-encoded or JSON) and applies JSON updates to existing ones,
+// through the same write, undo and export steps as saves. GET answers the
+// config, syndicate-to and source queries.
+func handleMicropub(w http.ResponseWriter, r *http.Request) {
+	if config.Micropub == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method == http.MethodGet {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == r.Header.Get("Authorization") {
+			token = r.URL.Query().Get("access_token")
+		}
+		if _, err := micropubScopes(r, token); err != nil {
+			micropubError(w, http.StatusUnauthorized, "unauthorized", err.Error())
+			return
+		}
+		micropubQuery(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	req, token, perr := parseMicropub(r)
+	scopes, err := micropubScopes(r, token)
+	if err != nil {
+		micropubError(w, http.StatusUnauthorized, "unauthorized", err.Error())
+		return
+	}
+	if perr != nil {
+		micropubError(w, http.StatusBadRequest, "invalid_request", perr.Error())
+		return
+	}
+	scope := req.Action
+	if scope == "" {
+		scope = "create"
+	}
+	if scope != "create" && scope != "update" {
+		micropubError(w, http.StatusBadRequest, "invalid_request", "unsupported action "+req.Action)
+		return
+	}
+	granted := false
+	for _, s := range scopes {
+		granted = granted || s == scope || (scope == "create" && s == "post")
+	}
+	if !granted {
+		micropubError(w, http.StatusForbidden, "insufficient_scope", "token lacks the "+scope+" scope")
+		return
+	}
+	if scope == "create" {
+		micropubCreate(w, r, req)
+	} else {
+		micropubUpdate(w, r, req)
+	}
+}
+
+func micropubCreate(w http.ResponseWriter, r *http.Request, req micropubRequest) {
+	props := req.Properties
+	if len(props["content"]) == 0 && len(props["name"]) == 0 {
+		micropubError(w, http.StatusBadRequest, "invalid_request", "content or name is required")
+		return
+	}
+	if len(props["published"]) == 0 {
+		props["published"] = []string{time.Now().Format(time.RFC3339)}
+	}
+	var md []byte
+	for _, k := range []string{"name", "summary", "published", "category", "post-status", "content"} {
+		if v, ok := props[k]; ok {
+			md = setMicropubProperty(md, k, v)
+		}
+	}
+	for k, v := range props {
+		if _, core := micropubFields[k]; !core && k != "content" && k != "post-status" {
+			md = setMicropubProperty(md, k, v)
+		}
+	}
+	name := micropubFilename(props)
+	if err := writeNote(name, md); err != nil {
+		micropubError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	afterSave(name)
+	w.Header().Set("Location", micropubPostURL(r, name))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func micropubUpdate(w http.ResponseWriter, r *http.Request, req micropubRequest) {
+	name := micropubNote(req.URL)
+	if name == "" {
+		micropubError(w, http.StatusBadRequest, "invalid_request", "no post at "+req.URL)
+		return
+	}
+	tok, ok := acquireLock(name)
+	if !ok {
+		micropubError(w, http.StatusLocked, "invalid_request", "the post is being edited")
+		return
+	}
+	defer releaseLock(name, tok)
+	prev, err := readNote(name)
+	if err != nil {
+		micropubError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	md := prev
+	for k, v := range req.Replace {
+		md = setMicropubProperty(md, k, v)
+	}
+	cur := micropubProperties(md)
+	for k, v := range req.Add {
+		md = setMicropubProperty(md, k, append(cur[k], v...))
+	}
+	cur = micropubProperties(md)
+	for k, v := range req.Delete {
+		var keep []string
+		if v != nil {
+			drop := map[string]bool{}
+			for _, d := range v {
+				drop[d] = true
+			}
+			for _, c := range cur[k] {
+				if !drop[c] {
+					keep = append(keep, c)
+				}
+			}
+		}
+		md = setMicropubProperty(md, k, keep)
+	}
+	if err := writeNote(name, md); err != nil {
+		micropubError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	pushUndo(name, prev, md)
+	afterSave(name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// micropubQuery answers GET /micropub?q=config|syndicate-to|source.
+func micropubQuery(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var v any
+	switch q.Get("q") {
+	case "config", "syndicate-to":
+		v = map[string]any{"syndicate-to": []any{}}
+	case "source":
+		name := micropubNote(q.Get("url"))
+		md, err := readNote(name)
+		if name == "" || err != nil {
+			micropubError(w, http.StatusBadRequest, "invalid_request", "no post at "+q.Get("url"))
+			return
+		}
+		props := micropubProperties(md)
+		if want := q["properties[]"]; len(want) > 0 {
+			only := map[string][]string{}
+			for _, k := range want {
+				if p, ok := props[k]; ok {
+					only[k] = p
+				}
+			}
+			v = map[string]any{"properties": only}
+		} else {
+			v = map[string]any{"type": []string{"h-entry"}, "properties": props}
+		}
+	default:
+		micropubError(w, http.StatusBadRequest, "invalid_request", "unsupported query")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(v)
+}
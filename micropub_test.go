@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+func setupMicropub(t *testing.T) {
+	t.Helper()
+	chdirTemp(t)
+	locks = make(map[string]lockInfo)
+	config.SiteURL = "https://example.com/"
+	config.Micropub = &micropubConfig{}
+	t.Setenv("MINIMARK_MICROPUB_TOKEN", "secret")
+	t.Cleanup(func() { config.SiteURL, config.Micropub = "", nil })
+}
+
+func micropubDo(t *testing.T, req *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	handleMicropub(rr, req)
+	return rr
+}
+
+func TestMicropubCreateForm(t *testing.T) {
+	setupMicropub(t)
+	form := url.Values{
+		"h":          {"entry"},
+		"name":       {"Morning walk"},
+		"content":    {"Saw a heron."},
+		"category[]": {"birds", "walks"},
+		"published":  {"2024-05-01T08:00:00Z"},
+		"summary":    {"A short\nwalk"},
+	}
+	post := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/micropub", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return micropubDo(t, req)
+	}
+	if rr := post(""); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("no token: %d", rr.Code)
+	}
+	if rr := post("wrong"); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong token: %d", rr.Code)
+	}
+	rr := post("secret")
+	if rr.Code != http.StatusCreated || rr.Header().Get("Location") != "https://example.com/morning-walk.html" {
+		t.Fatalf("create: %d %q %s", rr.Code, rr.Header().Get("Location"), rr.Body.String())
+	}
+	b, _ := os.ReadFile("morning-walk.md")
+	fields, body := parseFrontMatter(b)
+	if fields["title"] != "Morning walk" || fields["tags"] != "[birds, walks]" || fields["date"] != "2024-05-01T08:00:00Z" ||
+		fields["description"] != "A short walk" || string(body) != "Saw a heron.\n" {
+		t.Errorf("note:\n%s", b)
+	}
+	// A second post with the same name gets its own file
+	if rr := post("secret"); rr.Header().Get("Location") != "https://example.com/morning-walk-1.html" {
+		t.Errorf("second post at %q", rr.Header().Get("Location"))
+	}
+}
+
+func TestMicropubJSONUpdateAndSource(t *testing.T) {
+	setupMicropub(t)
+	send := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/micropub", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer secret")
+		return micropubDo(t, req)
+	}
+	rr := send(`{"type": ["h-entry"], "properties": {"content": [{"html": "<p>Draft <b>idea</b></p>"}], "category": ["a", "b"], "post-status": ["draft"]}}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", rr.Code, rr.Body.String())
+	}
+	name := "draft-idea.md"
+	if b, err := os.ReadFile(name); err != nil || !strings.Contains(string(b), "private: true") {
+		t.Fatalf("draft not private: %s %v", b, err)
+	}
+	u := rr.Header().Get("Location")
+	rr = send(`{"action": "update", "url": "` + u + `", "replace": {"name": ["Idea"], "post-status": ["published"]}, "add": {"category": ["c"]}, "delete": {"category": ["a"]}}`)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("update: %d %s", rr.Code, rr.Body.String())
+	}
+	b, _ := os.ReadFile(name)
+	fields, _ := parseFrontMatter(b)
+	if fields["title"] != "Idea" || fields["tags"] != "[b, c]" || fields["private"] != "" {
+		t.Errorf("updated note:\n%s", b)
+	}
+	if rr := send(`{"action": "update", "url": "https://example.com/missing.html", "replace": {"name": ["x"]}}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("missing post: %d", rr.Code)
+	}
+	if rr := send(`{"action": "delete", "url": "` + u + `"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("delete: %d", rr.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/micropub?q=source&url="+url.QueryEscape(u), nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr = micropubDo(t, req)
+	var src struct {
+		Properties map[string][]string `json:"properties"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &src); err != nil {
+		t.Fatalf("%v: %s", err, rr.Body.String())
+	}
+	if src.Properties["name"][0] != "Idea" || strings.Join(src.Properties["category"], ",") != "b,c" || src.Properties["post-status"][0] != "published" {
+		t.Errorf("source %v", src.Properties)
+	}
+}
+
+func TestMicropubTokenEndpoint(t *testing.T) {
+	setupMicropub(t)
+	t.Setenv("MINIMARK_MICROPUB_TOKEN", "")
+	tokens := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Authorization") {
+		case "Bearer mine":
+			w.Write([]byte(`{"me": "https://example.com", "scope": "create"}`))
+		case "Bearer theirs":
+			w.Write([]byte(`{"me": "https://elsewhere.example/", "scope": "create update"}`))
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer tokens.Close()
+	config.Micropub.TokenEndpoint = tokens.URL
+	post := func(token, body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/micropub", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		return micropubDo(t, req).Code
+	}
+	create := `{"type": ["h-entry"], "properties": {"content": ["hello"]}}`
+	if code := post("theirs", create); code != http.StatusUnauthorized {
+		t.Errorf("foreign token: %d", code)
+	}
+	if code := post("mine", create); code != http.StatusCreated {
+		t.Errorf("create: %d", code)
+	}
+	if code := post("mine", `{"action": "update", "url": "https://example.com/hello.html", "replace": {"name": ["x"]}}`); code != http.StatusForbidden {
+		t.Errorf("update without scope: %d", code)
+	}
+}
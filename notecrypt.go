@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// encryptedNoteMagic starts every note stored encrypted. The rest of the
+// file is the base64 of salt, nonce and AES-256-GCM ciphertext.
+const encryptedNoteMagic = "MINIMARK-ENCRYPTED-1\n"
+
+const (
+	noteSaltSize  = 16
+	noteNonceSize = 12
+)
+
+// noteSecret is the passphrase or key file contents that encrypted notes
+// are keyed by; nil when neither is configured.
+var noteSecret []byte
+
+var (
+	noteKeysMu sync.Mutex
+	noteKeys   = map[string][]byte{} // salt -> key derived from noteSecret
+	noteSalt   []byte                // salt for notes written by this process
+)
+
+var (
+	errNoNoteKey  = errors.New("note is encrypted; start the server with -key-file or MINIMARK_PASSPHRASE")
+	errBadNoteKey = errors.New("cannot decrypt note: wrong key or damaged file")
+)
+
+// loadNoteSecret sets noteSecret from keyFile, or else from the
+// MINIMARK_PASSPHRASE environment variable.
+func loadNoteSecret(keyFile string) error {
+	if keyFile == "" {
+		if p := os.Getenv("MINIMARK_PASSPHRASE"); p != "" {
+			noteSecret = []byte(p)
+		}
+		return nil
+	}
+	b, err := os.ReadFile(wsPath(keyFile))
+	if err != nil {
+		return err
+	}
+	if b = bytes.TrimSpace(b); len(b) == 0 {
+		return fmt.Errorf("key file %s is empty", keyFile)
+	}
+	noteSecret = b
+	return nil
+}
+
+// validEncryptPatterns checks the encrypt patterns in minimark.json.
+func validEncryptPatterns(patterns []string) error {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid encrypt pattern %q", p)
+		}
+	}
+	return nil
+}
+
+// isEncryptedNote reports whether b is a note stored encrypted.
+func isEncryptedNote(b []byte) bool {
+	return bytes.HasPrefix(b, []byte(encryptedNoteMagic))
+}
+
+// encryptedFile reports whether f holds an encrypted note, leaving it at
+// the start.
+func encryptedFile(f *os.File) bool {
+	magic := make([]byte, len(encryptedNoteMagic))
+	n, _ := io.ReadFull(f, magic)
+	_, _ = f.Seek(0, io.SeekStart)
+	return isEncryptedNote(magic[:n])
+}
+
+// encryptedNote reports whether name is kept encrypted on disk: it matches
+// an encrypt pattern in minimark.json or is already stored encrypted.
+func encryptedNote(name string) bool {
+	base := filepath.Base(name)
+	for _, p := range config.Encrypt {
+		if ok, _ := path.Match(p, base); ok {
+			return true
+		}
+	}
+	f, err := os.Open(wsPath(name))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	return encryptedFile(f)
+}
+
+// noteKey returns the key for salt, deriving it once per salt.
+func noteKey(salt []byte) []byte {
+	noteKeysMu.Lock()
+	defer noteKeysMu.Unlock()
+	key, ok := noteKeys[string(salt)]
+	if !ok {
+		key = pbkdf2SHA256(noteSecret, salt, protectIterations, 32)
+		noteKeys[string(salt)] = key
+	}
+	return key
+}
+
+func noteCipher(salt []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(noteKey(salt))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealNote returns data as stored for a note: encrypted when encrypt is
+// set, which requires a configured key.
+func sealNote(data []byte, encrypt bool) ([]byte, error) {
+	if !encrypt {
+		return data, nil
+	}
+	if noteSecret == nil {
+		return nil, errNoNoteKey
+	}
+	noteKeysMu.Lock()
+	if noteSalt == nil {
+		noteSalt = make([]byte, noteSaltSize)
+		if _, err := rand.Read(noteSalt); err != nil {
+			noteSalt = nil
+			noteKeysMu.Unlock()
+			return nil, err
+		}
+	}
+	salt := noteSalt
+	noteKeysMu.Unlock()
+	gcm, err := noteCipher(salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, noteNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	raw := append(append(append([]byte{}, salt...), nonce...), gcm.Seal(nil, nonce, data, nil)...)
+	return []byte(encryptedNoteMagic + base64.StdEncoding.EncodeToString(raw) + "\n"), nil
+}
+
+// openNote returns the content of a note as read from disk, decrypting it
+// when it is stored encrypted.
+func openNote(b []byte) ([]byte, error) {
+	if !isEncryptedNote(b) {
+		return b, nil
+	}
+	if noteSecret == nil {
+		return nil, errNoNoteKey
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b[len(encryptedNoteMagic):])))
+	if err != nil || len(raw) < noteSaltSize+noteNonceSize {
+		return nil, errBadNoteKey
+	}
+	salt, nonce := raw[:noteSaltSize], raw[noteSaltSize:noteSaltSize+noteNonceSize]
+	gcm, err := noteCipher(salt)
+	if err != nil {
+		return nil, err
+	}
+	data, err := gcm.Open(nil, nonce, raw[noteSaltSize+noteNonceSize:], nil)
+	if err != nil {
+		return nil, errBadNoteKey
+	}
+	return data, nil
+}
+
+// readNote reads the note name, decrypting it if needed.
+func readNote(name string) ([]byte, error) {
+	b, err := os.ReadFile(wsPath(name))
+	if err != nil {
+		return nil, err
+	}
+	return openNote(b)
+}
+
+// writeNote writes data as the note name, encrypted if name is kept
+// encrypted.
+func writeNote(name string, data []byte) error {
+	b, err := sealNote(data, encryptedNote(name))
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(wsPath(name), b, 0644)
+}
+
+// serveEncryptedNote is streamMarkdown for an encrypted note, which is
+// decrypted in memory.
+func serveEncryptedNote(w http.ResponseWriter, f *os.File, file string) {
+	b, err := io.ReadAll(f)
+	if err == nil {
+		b, err = openNote(b)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Filename", filepath.Base(file))
+	w.Header().Set("X-HTML-Filename", htmlOutNameFor(filepath.Base(file)))
+	setRevision(w.Header(), contentETag(b))
+	_, _ = w.Write(b)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// withNoteSecret configures secret as the note key, with a cheap key
+// derivation for tests.
+func withNoteSecret(t *testing.T, secret string) {
+	t.Helper()
+	oldIter := protectIterations
+	protectIterations = 10
+	noteSecret = []byte(secret)
+	noteSalt = nil
+	noteKeys = map[string][]byte{}
+	t.Cleanup(func() {
+		protectIterations = oldIter
+		noteSecret = nil
+		noteSalt = nil
+		noteKeys = map[string][]byte{}
+	})
+}
+
+func TestEncryptedNotes_SaveOpenExport(t *testing.T) {
+	chdirTemp(t)
+	locks = make(map[string]lockInfo)
+	withNoteSecret(t, "s3cret")
+	withConfig(t, siteConfig{Encrypt: []string{"diary*.md"}})
+
+	tok := lockFile(t, "diary.md")
+	if rr := saveFile(t, "diary.md", tok, "# Diary\n\nDear diary"); rr.Code != http.StatusNoContent {
+		t.Fatalf("save: %d %s", rr.Code, rr.Body.String())
+	}
+	raw, err := os.ReadFile("diary.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isEncryptedNote(raw) || strings.Contains(string(raw), "Dear diary") {
+		t.Fatalf("stored in the clear: %q", raw)
+	}
+
+	rr := httptest.NewRecorder()
+	openLastMarkdown(rr, httptest.NewRequest(http.MethodGet, "/open?file=diary.md", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != "# Diary\n\nDear diary" {
+		t.Fatalf("open = %d %q", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("ETag") != contentETag([]byte("# Diary\n\nDear diary")) {
+		t.Fatalf("ETag not of the plaintext: %s", rr.Header().Get("ETag"))
+	}
+
+	// An encrypted note stays encrypted when it is no longer designated
+	config.Encrypt = nil
+	if err := writeNote("diary.md", []byte("# Diary\n\nMore")); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile("diary.md"); !isEncryptedNote(b) {
+		t.Fatal("note decrypted on rewrite")
+	}
+	if b, err := readNote("diary.md"); err != nil || string(b) != "# Diary\n\nMore" {
+		t.Fatalf("readNote = %q, %v", b, err)
+	}
+
+	os.MkdirAll("docs", 0755)
+	os.WriteFile("docs/diary.html", []byte("stale"), 0644)
+	if err := exportMarkdownTo("cmark-gfm", "diary.md", "docs/diary.html"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat("docs/diary.html"); !os.IsNotExist(err) {
+		t.Fatal("encrypted note exported")
+	}
+}
+
+func TestEncryptedNotes_WrongOrMissingKey(t *testing.T) {
+	chdirTemp(t)
+	withNoteSecret(t, "right")
+	sealed, err := sealNote([]byte("private"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile("n.md", sealed, 0644)
+
+	withNoteSecret(t, "wrong")
+	if _, err := readNote("n.md"); !errors.Is(err, errBadNoteKey) {
+		t.Fatalf("wrong key: %v", err)
+	}
+	noteSecret = nil
+	if _, err := readNote("n.md"); !errors.Is(err, errNoNoteKey) {
+		t.Fatalf("no key: %v", err)
+	}
+	if _, err := sealNote([]byte("x"), true); !errors.Is(err, errNoNoteKey) {
+		t.Fatalf("sealing without a key: %v", err)
+	}
+	// Saving without the key must not clobber the note
+	locks = make(map[string]lockInfo)
+	tok := lockFile(t, "n.md")
+	if rr := saveFile(t, "n.md", tok, "# N\nplain"); rr.Code != http.StatusInternalServerError {
+		t.Fatalf("save without key: %d", rr.Code)
+	}
+	if b, _ := os.ReadFile("n.md"); string(b) != string(sealed) {
+		t.Fatal("encrypted note overwritten")
+	}
+}
+
+func TestLoadNoteSecret(t *testing.T) {
+	chdirTemp(t)
+	t.Cleanup(func() { noteSecret = nil })
+	t.Setenv("MINIMARK_PASSPHRASE", "from env")
+	if err := loadNoteSecret(""); err != nil || string(noteSecret) != "from env" {
+		t.Fatalf("env: %q %v", noteSecret, err)
+	}
+	os.WriteFile("key", []byte("from file\n"), 0600)
+	if err := loadNoteSecret("key"); err != nil || string(noteSecret) != "from file" {
+		t.Fatalf("file: %q %v", noteSecret, err)
+	}
+	os.WriteFile("empty", nil, 0600)
+	if err := loadNoteSecret("empty"); err == nil {
+		t.Fatal("empty key file accepted")
+	}
+}
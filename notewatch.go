@@ -0,0 +1,99 @@
+package main
+
+import (
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// fileChanges fans out the names of Markdown files changed on disk by
+// something other than the server, such as an editor or git pull.
+var fileChanges = &reloadHub{clients: map[chan string]bool{}}
+
+// noteStamp is the size and mtime a note had when last seen.
+type noteStamp struct {
+	size int64
+	mod  time.Time
+}
+
+// noteStamps remembers the notes the server wrote or already handled, so
+// the watcher only acts on changes made behind its back.
+type noteStamps struct {
+	mu sync.Mutex
+	m  map[string]noteStamp
+}
+
+var seenNotes = &noteStamps{m: map[string]noteStamp{}}
+
+// record notes the current state of name, or that it is gone.
+func (s *noteStamps) record(name string) {
+	info, err := os.Stat(wsPath(name))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		delete(s.m, name)
+		return
+	}
+	s.m[name] = noteStamp{info.Size(), info.ModTime()}
+}
+
+// scan compares the workspace's notes with what was last seen and
+// returns the names that changed or appeared and those that disappeared,
+// marking them seen.
+func (s *noteStamps) scan() (changed, removed []string) {
+	names, err := listMarkdownFiles(".")
+	if err != nil {
+		return nil, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	present := make(map[string]bool, len(names))
+	for _, name := range names {
+		info, err := os.Stat(wsPath(name))
+		if err != nil {
+			continue
+		}
+		present[name] = true
+		cur := noteStamp{info.Size(), info.ModTime()}
+		if prev, ok := s.m[name]; !ok || prev.size != cur.size || !prev.mod.Equal(cur.mod) {
+			s.m[name] = cur
+			changed = append(changed, name)
+		}
+	}
+	for name := range s.m {
+		if !present[name] {
+			delete(s.m, name)
+			removed = append(removed, name)
+		}
+	}
+	return changed, removed
+}
+
+// watchNotes polls the workspace and re-exports notes changed outside the
+// server, telling the editor and previews about them. It never returns.
+func watchNotes() {
+	seenNotes.scan()
+	for {
+		time.Sleep(includesPollInterval)
+		changed, removed := seenNotes.scan()
+		for _, name := range changed {
+			log.Printf("%s changed on disk; re-exporting", name)
+			afterSave(name)
+			fileChanges.broadcast(name)
+		}
+		for _, name := range removed {
+			log.Printf("%s removed on disk", name)
+			outName := htmlOutNameFor(name)
+			docIndex.update(".", name)
+			exportMu.Lock()
+			removeExport(exportDir, outName)
+			if cmarkPath != "" {
+				writeSitePages(cmarkPath, exportDir)
+			}
+			exportMu.Unlock()
+			reloads.broadcast(outName)
+			fileChanges.broadcast(name)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestNoteStampsScan(t *testing.T) {
+	chdirTemp(t)
+	seenNotes = &noteStamps{m: map[string]noteStamp{}}
+	writeFiles(t, map[string]string{"a.md": "a", "b.md": "b", "c.txt": "c"})
+	if changed, removed := seenNotes.scan(); !reflect.DeepEqual(changed, []string{"a.md", "b.md"}) || removed != nil {
+		t.Fatalf("first scan: %v %v", changed, removed)
+	}
+	if changed, removed := seenNotes.scan(); changed != nil || removed != nil {
+		t.Fatalf("unchanged: %v %v", changed, removed)
+	}
+
+	// Writes by the server are indexed and not reported
+	writeFiles(t, map[string]string{"a.md": "saved by the editor"})
+	docIndex.update(".", "a.md")
+	if changed, _ := seenNotes.scan(); changed != nil {
+		t.Errorf("server write reported: %v", changed)
+	}
+
+	writeFiles(t, map[string]string{"b.md": "pulled from git", "d.md": "new"})
+	if err := os.Remove("a.md"); err != nil {
+		t.Fatal(err)
+	}
+	if changed, removed := seenNotes.scan(); !reflect.DeepEqual(changed, []string{"b.md", "d.md"}) || !reflect.DeepEqual(removed, []string{"a.md"}) {
+		t.Errorf("external changes: %v %v", changed, removed)
+	}
+}
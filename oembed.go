@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// oembedProvider allows bare links to a host (and its subdomains) to be
+// expanded. Endpoint may be left out for the providers in knownOEmbed.
+type oembedProvider struct {
+	Host     string `json:"host"`
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// knownOEmbed maps well-known hosts to their oEmbed endpoints.
+var knownOEmbed = map[string]string{
+	"youtube.com":    "https://www.youtube.com/oembed",
+	"youtu.be":       "https://www.youtube.com/oembed",
+	"vimeo.com":      "https://vimeo.com/api/oembed.json",
+	"soundcloud.com": "https://soundcloud.com/oembed",
+	"flickr.com":     "https://www.flickr.com/services/oembed/",
+	"twitter.com":    "https://publish.twitter.com/oembed",
+	"x.com":          "https://publish.twitter.com/oembed",
+	"codepen.io":     "https://codepen.io/api/oembed",
+}
+
+// oembedCacheDir keeps provider responses so exports don't refetch them;
+// entries older than oembedCacheTTL are refreshed.
+var oembedCacheDir = filepath.Join(".minimark", "oembed")
+
+const oembedCacheTTL = 7 * 24 * time.Hour
+
+// A paragraph holding only a URL, bare or as an autolink (<https://...>).
+var bareLinkRe = regexp.MustCompile(`<p>(?:(https?://[^\s<"]+)|<a href="(https?://[^"]+)">(https?://[^<]+)</a>)</p>`)
+
+var oembedClient = &http.Client{Timeout: 10 * time.Second}
+
+type oembedResponse struct {
+	Type  string `json:"type"`
+	HTML  string `json:"html"`
+	URL   string `json:"url"`
+	Title string `json:"title"`
+}
+
+// validateOEmbed checks the configured providers.
+func validateOEmbed(providers []oembedProvider) error {
+	for _, p := range providers {
+		if p.Host == "" {
+			return fmt.Errorf("oembed provider without host")
+		}
+		if p.Endpoint == "" {
+			if knownOEmbed[strings.TrimPrefix(p.Host, "www.")] == "" {
+				return fmt.Errorf("oembed provider %q needs an endpoint", p.Host)
+			}
+			continue
+		}
+		if u, err := url.Parse(p.Endpoint); err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+			return fmt.Errorf("oembed endpoint %q is not an http(s) URL", p.Endpoint)
+		}
+	}
+	return nil
+}
+
+// oembedLinks replaces paragraphs holding only a link to an allowed host
+// with the provider's embed. Links that can't be expanded stay as they are.
+func oembedLinks(body []byte) []byte {
+	if len(config.OEmbed) == 0 {
+		return body
+	}
+	return bareLinkRe.ReplaceAllFunc(body, func(m []byte) []byte {
+		sub := bareLinkRe.FindSubmatch(m)
+		link := string(sub[1])
+		if link == "" {
+			if string(sub[2]) != string(sub[3]) {
+				return m // a labelled link, not a pasted URL
+			}
+			link = string(sub[2])
+		}
+		link = html.UnescapeString(link)
+		endpoint := oembedEndpoint(link)
+		if endpoint == "" {
+			return m
+		}
+		embed, err := fetchOEmbed(endpoint, link)
+		if err != nil {
+			log.Printf("oembed %s: %v", link, err)
+			return m
+		}
+		if e := embedHTML(embed); e != "" {
+			return []byte(`<div class="embed">` + e + `</div>`)
+		}
+		return m
+	})
+}
+
+// oembedEndpoint returns the endpoint for link, or "" if its host is not
+// allowed.
+func oembedEndpoint(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, p := range config.OEmbed {
+		h := strings.ToLower(strings.TrimPrefix(p.Host, "www."))
+		if host != h && !strings.HasSuffix(host, "."+h) {
+			continue
+		}
+		if p.Endpoint != "" {
+			return p.Endpoint
+		}
+		return knownOEmbed[h]
+	}
+	return ""
+}
+
+func embedHTML(r oembedResponse) string {
+	switch r.Type {
+	case "video", "rich":
+		return r.HTML
+	case "photo":
+		if r.URL != "" {
+			return fmt.Sprintf(`<img src="%s" alt="%s">`, html.EscapeString(r.URL), html.EscapeString(r.Title))
+		}
+	}
+	return ""
+}
+
+// fetchOEmbed asks endpoint about link, using the cache when it is fresh.
+func fetchOEmbed(endpoint, link string) (oembedResponse, error) {
+	var r oembedResponse
+	sum := sha256.Sum256([]byte(endpoint + "\n" + link))
+	cached := filepath.Join(oembedCacheDir, hex.EncodeToString(sum[:])+".json")
+	if info, err := os.Stat(wsPath(cached)); err == nil && time.Since(info.ModTime()) < oembedCacheTTL {
+		if b, err := os.ReadFile(wsPath(cached)); err == nil && json.Unmarshal(b, &r) == nil {
+			return r, nil
+		}
+	}
+	sep := "?"
+	if strings.Contains(endpoint, "?") {
+		sep = "&"
+	}
+	resp, err := oembedClient.Get(endpoint + sep + "format=json&url=" + url.QueryEscape(link))
+	if err != nil {
+		return r, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return r, fmt.Errorf("provider returned %s", resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return r, err
+	}
+	if err := json.Unmarshal(b, &r); err != nil {
+		return r, err
+	}
+	if err := os.MkdirAll(wsPath(oembedCacheDir), 0755); err == nil {
+		_ = os.WriteFile(wsPath(cached), b, 0644)
+	}
+	return r, nil
+}
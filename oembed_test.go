@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOEmbedLinks(t *testing.T) {
+	chdirTemp(t)
+	var asked []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		asked = append(asked, r.URL.Query().Get("url"))
+		if r.URL.Query().Get("format") != "json" {
+			http.Error(w, "format", http.StatusNotImplemented)
+			return
+		}
+		switch r.URL.Query().Get("url") {
+		case "https://media.example.com/v/1":
+			w.Write([]byte(`{"type":"video","html":"<iframe src=\"x\"></iframe>"}`))
+		case "https://media.example.com/p/2":
+			w.Write([]byte(`{"type":"photo","url":"https://img.example.com/2.jpg","title":"Two"}`))
+		default:
+			w.Write([]byte(`{"type":"link"}`))
+		}
+	}))
+	defer srv.Close()
+	withConfig(t, siteConfig{OEmbed: []oembedProvider{{Host: "example.com", Endpoint: srv.URL + "/oembed"}}})
+
+	cases := map[string]string{
+		"<p>https://media.example.com/v/1</p>":                                             `<div class="embed"><iframe src="x"></iframe></div>`,
+		`<p><a href="https://media.example.com/p/2">https://media.example.com/p/2</a></p>`: `<div class="embed"><img src="https://img.example.com/2.jpg" alt="Two"></div>`,
+		"<p>https://media.example.com/l/3</p>":                                             "<p>https://media.example.com/l/3</p>",
+		`<p><a href="https://media.example.com/v/1">watch</a></p>`:                         `<p><a href="https://media.example.com/v/1">watch</a></p>`,
+		"<p>https://other.org/v/1</p>":                                                     "<p>https://other.org/v/1</p>",
+		"<p>see https://media.example.com/v/1</p>":                                         "<p>see https://media.example.com/v/1</p>",
+	}
+	for in, want := range cases {
+		if got := string(oembedLinks([]byte(in))); got != want {
+			t.Errorf("%s: got %s", in, got)
+		}
+	}
+	if len(asked) != 3 {
+		t.Fatalf("provider asked about %q", asked)
+	}
+	// Repeat exports use the cache
+	oembedLinks([]byte("<p>https://media.example.com/v/1</p>"))
+	if len(asked) != 3 {
+		t.Fatalf("provider asked again: %q", asked)
+	}
+}
+
+func TestOEmbedEndpoint(t *testing.T) {
+	withConfig(t, siteConfig{OEmbed: []oembedProvider{{Host: "www.youtube.com"}, {Host: "vimeo.com"}}})
+	cases := map[string]string{
+		"https://www.youtube.com/watch?v=x": "https://www.youtube.com/oembed",
+		"https://youtube.com/watch?v=x":     "https://www.youtube.com/oembed",
+		"https://vimeo.com/1":               "https://vimeo.com/api/oembed.json",
+		"https://notvimeo.com/1":            "",
+		"https://youtu.be/x":                "",
+	}
+	for in, want := range cases {
+		if got := oembedEndpoint(in); got != want {
+			t.Errorf("oembedEndpoint(%q) = %q; want %q", in, got, want)
+		}
+	}
+}
+
+func TestValidateOEmbed(t *testing.T) {
+	good := []oembedProvider{{Host: "youtube.com"}, {Host: "x.org", Endpoint: "https://x.org/oembed"}}
+	if err := validateOEmbed(good); err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range []oembedProvider{{}, {Host: "unknown.org"}, {Host: "x.org", Endpoint: "file:///etc/passwd"}} {
+		if validateOEmbed([]oembedProvider{bad}) == nil {
+			t.Errorf("%+v accepted", bad)
+		}
+	}
+}
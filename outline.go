@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// heading is a Markdown heading with the byte range of its source lines.
+type heading struct {
+	Level    int        `json:"level"`
+	Text     string     `json:"text"`
+	Start    int        `json:"start"` // offset of the first byte of the heading
+	End      int        `json:"end"`   // offset just past the heading (incl. setext underline)
+	Children []*heading `json:"children,omitempty"`
+}
+
+var (
+	atxHeadingRe      = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	setextUnderlineRe = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+	fenceRe           = regexp.MustCompile("^ {0,3}(```+|~~~+)")
+)
+
+// parseHeadings returns the ATX and setext headings of content in document
+// order, skipping front matter and fenced code blocks.
+func parseHeadings(content []byte) []heading {
+	_, body := parseFrontMatter(content)
+	offset := len(content) - len(body)
+	var out []heading
+	fence := ""
+	prevStart, prevText := -1, "" // candidate paragraph line for a setext heading
+	for len(body) > 0 {
+		lineEnd := bytes.IndexByte(body, '\n')
+		next := lineEnd + 1
+		if lineEnd < 0 {
+			lineEnd, next = len(body), len(body)
+		}
+		line := strings.TrimRight(string(body[:lineEnd]), "\r")
+		start := offset
+		offset += next
+		body = body[next:]
+
+		if fence != "" {
+			if strings.HasPrefix(strings.TrimSpace(line), fence) {
+				fence = ""
+			}
+			continue
+		}
+		if m := fenceRe.FindStringSubmatch(line); m != nil {
+			fence = m[1]
+			prevStart = -1
+			continue
+		}
+		if m := atxHeadingRe.FindStringSubmatch(line); m != nil {
+			out = append(out, heading{Level: len(m[1]), Text: strings.TrimSpace(m[2]), Start: start, End: offset})
+			prevStart = -1
+			continue
+		}
+		if m := setextUnderlineRe.FindStringSubmatch(line); m != nil && prevStart >= 0 {
+			level := 1
+			if m[1][0] == '-' {
+				level = 2
+			}
+			out = append(out, heading{Level: level, Text: prevText, Start: prevStart, End: offset})
+			prevStart = -1
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			prevStart = -1
+			continue
+		}
+		prevStart, prevText = start, strings.TrimSpace(line)
+	}
+	return out
+}
+
+// buildOutline nests a flat heading list into a tree: each heading becomes a
+// child of the closest preceding heading with a lower level.
+func buildOutline(flat []heading) []*heading {
+	var roots []*heading
+	var stack []*heading
+	for i := range flat {
+		h := &flat[i]
+		for len(stack) > 0 && stack[len(stack)-1].Level >= h.Level {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			roots = append(roots, h)
+		} else {
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, h)
+		}
+		stack = append(stack, h)
+	}
+	return roots
+}
+
+// handleOutline returns the heading tree of the file given by the `file`
+// query param as JSON.
+func handleOutline(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("file")
+	if name == "" || filepath.Base(name) != name {
+		http.Error(w, "invalid filename", http.StatusBadRequest)
+		return
+	}
+	b, err := readNote(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	outline := buildOutline(parseHeadings(b))
+	if outline == nil {
+		outline = []*heading{}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(outline)
+}
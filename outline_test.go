@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestParseHeadings(t *testing.T) {
+	src := "---\ntitle: x\n---\n# One #\ntext\n\nTwo\n---\n```\n# not a heading\n```\n### Three\n\n---\n"
+	hs := parseHeadings([]byte(src))
+	if len(hs) != 3 {
+		t.Fatalf("headings = %+v", hs)
+	}
+	want := []struct {
+		level int
+		text  string
+	}{{1, "One"}, {2, "Two"}, {3, "Three"}}
+	for i, w := range want {
+		if hs[i].Level != w.level || hs[i].Text != w.text {
+			t.Errorf("heading %d = %+v; want %+v", i, hs[i], w)
+		}
+	}
+	// Offsets point into the original source
+	if got := src[hs[0].Start:hs[0].End]; got != "# One #\n" {
+		t.Fatalf("range = %q", got)
+	}
+	if got := src[hs[1].Start:hs[1].End]; got != "Two\n---\n" {
+		t.Fatalf("setext range = %q", got)
+	}
+}
+
+func TestBuildOutline(t *testing.T) {
+	flat := []heading{{Level: 1, Text: "A"}, {Level: 2, Text: "B"}, {Level: 3, Text: "C"}, {Level: 2, Text: "D"}, {Level: 1, Text: "E"}}
+	tree := buildOutline(flat)
+	if len(tree) != 2 || len(tree[0].Children) != 2 || tree[0].Children[0].Children[0].Text != "C" || tree[1].Text != "E" {
+		t.Fatalf("unexpected tree")
+	}
+}
+
+func TestHandleOutline(t *testing.T) {
+	chdirTemp(t)
+	if err := os.WriteFile("a.md", []byte("# A\n## B\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handleOutline(rr, httptest.NewRequest(http.MethodGet, "/outline?file=a.md", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d", rr.Code)
+	}
+	var tree []*heading
+	if err := json.Unmarshal(rr.Body.Bytes(), &tree); err != nil {
+		t.Fatal(err)
+	}
+	if len(tree) != 1 || tree[0].Text != "A" || len(tree[0].Children) != 1 {
+		t.Fatalf("tree = %s", rr.Body.String())
+	}
+	for url, want := range map[string]int{"/outline?file=../a.md": 400, "/outline?file=missing.md": 404} {
+		rr := httptest.NewRecorder()
+		handleOutline(rr, httptest.NewRequest(http.MethodGet, url, nil))
+		if rr.Code != want {
+			t.Errorf("%s = %d; want %d", url, rr.Code, want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// pageMeta is the structured data written next to each exported page as
+// docs/<slug>.json, for search services and site frontends.
+type pageMeta struct {
+	Title    string   `json:"title"`
+	URL      string   `json:"url"`    // the page, relative to docs
+	Source   string   `json:"source"` // the markdown file
+	Date     string   `json:"date,omitempty"`
+	Updated  string   `json:"updated,omitempty"`
+	Tags     []string `json:"tags"`
+	Category string   `json:"category,omitempty"`
+	Lang     string   `json:"lang,omitempty"`
+	Words    int      `json:"words"`
+	Excerpt  string   `json:"excerpt"`
+	Links    []string `json:"links"`
+}
+
+// maxExcerpt is the length, in characters, excerpts are cut to.
+const maxExcerpt = 200
+
+var (
+	mdImageRe      = regexp.MustCompile(`!\[[^\]]*\]\([^)]*\)`)
+	mdInlineLinkRe = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	mdEmphasisRe   = regexp.MustCompile("[*_`~]+")
+)
+
+// pageMetaPath returns where the metadata for the page at outPath goes.
+func pageMetaPath(outPath string) string {
+	return strings.TrimSuffix(outPath, filepath.Ext(outPath)) + ".json"
+}
+
+// pageExcerpt returns the front matter description: or excerpt:, else the
+// text of the first paragraph of body, cut to maxExcerpt characters.
+func pageExcerpt(fields map[string]string, body []byte) string {
+	for _, key := range []string{"description", "excerpt"} {
+		if v := unquote(strings.TrimSpace(fields[key])); v != "" {
+			return v
+		}
+	}
+	var para []string
+	inFence := false
+	for _, line := range strings.Split(string(body), "\n") {
+		t := strings.TrimSpace(line)
+		if strings.HasPrefix(t, "```") || strings.HasPrefix(t, "~~~") {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+		if t == "" {
+			if len(para) > 0 {
+				break
+			}
+			continue
+		}
+		// Headings, lists, quotes, tables, rules, HTML and shortcodes are
+		// not prose
+		if len(para) == 0 && (strings.HasPrefix(t, "#") || strings.HasPrefix(t, ">") || strings.HasPrefix(t, "|") ||
+			strings.HasPrefix(t, "<") || strings.HasPrefix(t, "{{") || strings.HasPrefix(t, "- ") ||
+			strings.HasPrefix(t, "* ") || strings.HasPrefix(t, "---") || strings.HasPrefix(t, "===")) {
+			continue
+		}
+		para = append(para, t)
+	}
+	s := strings.Join(para, " ")
+	s = mdImageRe.ReplaceAllString(s, "")
+	s = mdInlineLinkRe.ReplaceAllString(s, "$1")
+	s = anyTagRe.ReplaceAllString(s, "")
+	s = strings.Join(strings.Fields(mdEmphasisRe.ReplaceAllString(s, "")), " ")
+	if r := []rune(s); len(r) > maxExcerpt {
+		s = strings.TrimSpace(string(r[:maxExcerpt-1])) + "…"
+	}
+	return s
+}
+
+// buildPageMeta describes the note src, whose content is md, exported as
+// the page outName.
+func buildPageMeta(src, outName string, md []byte) pageMeta {
+	fields, body := parseFrontMatter(md)
+	m := pageMeta{
+		Title:    pageTitle(md),
+		URL:      outName,
+		Source:   filepath.Base(src),
+		Tags:     frontMatterList(fields["tags"]),
+		Category: normalizeCategory(fields["category"]),
+		Lang:     pageLang(src, md),
+		Words:    len(strings.Fields(string(body))),
+		Excerpt:  pageExcerpt(fields, body),
+		Links:    extractLinks(body),
+	}
+	if t, ok := parseFrontMatterDate(fields["date"]); ok {
+		m.Date = t.Format(time.RFC3339)
+	}
+	if info, err := os.Stat(wsPath(src)); err == nil {
+		m.Updated = docTime(src, info).Format(time.RFC3339)
+	}
+	if m.Tags == nil {
+		m.Tags = []string{}
+	}
+	if m.Links == nil {
+		m.Links = []string{}
+	}
+	return m
+}
+
+// writePageMeta writes the metadata for the page at outPath. Password
+// protected pages get none, since it would give their content away.
+func writePageMeta(src, outPath string, md []byte) error {
+	path := pageMetaPath(outPath)
+	if pagePassword(md) != "" {
+		_ = os.Remove(wsPath(path))
+		return nil
+	}
+	b, err := json.MarshalIndent(buildPageMeta(src, filepath.Base(outPath), md), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(wsPath(path), append(b, '\n'), 0644)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPageExcerpt(t *testing.T) {
+	cases := []struct {
+		fields map[string]string
+		body   string
+		want   string
+	}{
+		{nil, "# Title\n\nFirst *para* with a [link](x.html)\nand ![img](i.png)more.\n\nSecond.\n", "First para with a link and more."},
+		{nil, "```\ncode\n```\n\n- list\n\nProse.\n", "Prose."},
+		{map[string]string{"description": `"Set by hand"`}, "Body.\n", "Set by hand"},
+		{nil, strings.Repeat("word ", 100), strings.TrimSpace(strings.Repeat("word ", 40))[:maxExcerpt-1] + "…"},
+	}
+	for _, c := range cases {
+		if got := pageExcerpt(c.fields, []byte(c.body)); got != c.want {
+			t.Errorf("pageExcerpt(%q) = %q, want %q", c.body, got, c.want)
+		}
+	}
+}
+
+func TestExportWritesPageMeta(t *testing.T) {
+	chdirTemp(t)
+	cmark := echoCmark(t)
+	writeFiles(t, map[string]string{
+		"trip.md":   "---\ntitle: Trip\ndate: 2024-05-01\ntags: [travel, food]\n---\nWe went to [Rome](rome.md).\n",
+		"locked.md": "---\npassword: s3cret\n---\nSecret words.\n",
+	})
+	if err := exportMarkdownTo(cmark, "trip.md", filepath.Join("docs", "trip.html")); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join("docs", "trip.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m pageMeta
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Title != "Trip" || m.URL != "trip.html" || m.Source != "trip.md" || !strings.HasPrefix(m.Date, "2024-05-01") ||
+		strings.Join(m.Tags, ",") != "travel,food" || m.Words != 4 || m.Excerpt != "We went to Rome." ||
+		len(m.Links) != 1 || m.Links[0] != "rome.md" {
+		t.Errorf("meta = %+v", m)
+	}
+
+	if err := exportMarkdownTo(cmark, "locked.md", filepath.Join("docs", "locked.html")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join("docs", "locked.json")); !os.IsNotExist(err) {
+		t.Errorf("protected page has metadata: %v", err)
+	}
+
+	removeExport("docs", "trip.html")
+	if _, err := os.Stat(filepath.Join("docs", "trip.json")); !os.IsNotExist(err) {
+		t.Errorf("metadata left after removal: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// partialsDir is the folder of an _includes directory holding the named
+// pieces that headers, footers and other partials pull in with
+// {{template "name" .}}.
+const partialsDir = "partials"
+
+// maxPartialDepth bounds how deeply partials may include each other.
+const maxPartialDepth = 10
+
+// partialRe matches {{template "name"}}, with or without the trailing dot
+// Go templates use to pass the page along.
+var partialRe = regexp.MustCompile(`\{\{-?\s*template\s+"([^"]+)"\s*\.?\s*-?\}\}`)
+
+// partialPath returns the path of the partial name relative to a partials
+// folder: name.html, or name itself when it has an extension. Names that
+// leave the folder are rejected.
+func partialPath(name string) (string, bool) {
+	clean := path.Clean(name)
+	if name == "" || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") || strings.Contains(name, `\`) {
+		return "", false
+	}
+	if path.Ext(clean) == "" {
+		clean += ".html"
+	}
+	return filepath.FromSlash(clean), true
+}
+
+// expandPartials replaces every {{template "name"}} in b with the partial's
+// contents, taken from the first of the includes dirs that has it, and
+// expands partials within partials. Missing, invalid and recursive partials
+// are logged and dropped.
+func expandPartials(b []byte, dirs []string) []byte {
+	return expandPartialsIn(b, dirs, nil)
+}
+
+func expandPartialsIn(b []byte, dirs, stack []string) []byte {
+	if !bytes.Contains(b, []byte("{{")) {
+		return b
+	}
+	return partialRe.ReplaceAllFunc(b, func(m []byte) []byte {
+		name := string(partialRe.FindSubmatch(m)[1])
+		for _, s := range stack {
+			if s == name {
+				log.Printf("partial %q includes itself", name)
+				return nil
+			}
+		}
+		if len(stack) >= maxPartialDepth {
+			log.Printf("partial %q nested more than %d deep", name, maxPartialDepth)
+			return nil
+		}
+		p, ok := partialPath(name)
+		if !ok {
+			log.Printf("invalid partial name %q", name)
+			return nil
+		}
+		data := readInclude(dirs, filepath.Join(partialsDir, p))
+		if data == nil {
+			log.Printf("partial %q not found", name)
+			return nil
+		}
+		return expandPartialsIn(data, dirs, append(stack, name))
+	})
+}
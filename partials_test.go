@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func writePartial(t *testing.T, name, body string) {
+	t.Helper()
+	p := filepath.Join("_includes", partialsDir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExpandPartials(t *testing.T) {
+	chdirTemp(t)
+	writePartial(t, "nav.html", `<nav>{{template "links" .}}</nav>`)
+	writePartial(t, "links.html", `<a href="index.html">Home</a>`)
+	writePartial(t, "menus/side.html", `<aside></aside>`)
+	writePartial(t, "loop.html", `[{{template "loop" .}}]`)
+
+	cases := []struct{ in, want string }{
+		{`<body>{{template "nav" .}}`, `<body><nav><a href="index.html">Home</a></nav>`},
+		{`{{ template "menus/side" }}`, `<aside></aside>`},
+		{`{{template "links.html"}}`, `<a href="index.html">Home</a>`},
+		{`a{{template "missing" .}}b`, `ab`},
+		{`a{{template "../secret" .}}b`, `ab`},
+		{`{{template "loop" .}}`, `[]`},
+		{`{{title}}`, `{{title}}`},
+	}
+	for _, c := range cases {
+		if got := string(expandPartials([]byte(c.in), []string{"_includes"})); got != c.want {
+			t.Errorf("expandPartials(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestRenderPage_Partials(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows")
+	}
+	chdirTemp(t)
+	os.MkdirAll("_includes", 0755)
+	os.WriteFile(filepath.Join("_includes", "header.html"), []byte(`<html><head>{{template "head" .}}</head><body>`), 0644)
+	os.WriteFile(filepath.Join("_includes", "footer.html"), []byte(`{{template "foot" .}}</body></html>`), 0644)
+	writePartial(t, "head.html", "<title>{{title}}</title>")
+	writePartial(t, "foot.html", "<footer>bye</footer>")
+	script := filepath.Join(t.TempDir(), "cmark.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho '<p>Body</p>'\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	page, err := renderPage(script, []byte("# Partial Page\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"<title>Partial Page</title>", "<footer>bye</footer></body>"} {
+		if !strings.Contains(string(page), want) {
+			t.Fatalf("page missing %q:\n%s", want, page)
+		}
+	}
+}
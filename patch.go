@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// --------- Patch-based saves ---------
+
+// patchEdit replaces the bytes [Start, End) of the base revision with Text.
+type patchEdit struct {
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Text  string `json:"text"`
+}
+
+// patchRequest is the JSON form of a /patch body. Base is the ETag of the
+// content the edits were made against; If-Match may state it instead.
+type patchRequest struct {
+	Base  string      `json:"base"`
+	Edits []patchEdit `json:"edits"`
+}
+
+// errPatchMismatch reports a patch that does not fit the base revision.
+var errPatchMismatch = errors.New("patch does not apply")
+
+// handlePatch applies a unified diff (text/x-diff or text/plain) or JSON
+// edits to a file and saves the result like /save. The base revision must
+// be the file's current ETag; otherwise the patch is refused with 412 and
+// the current ETag, so the client can reload and retry.
+func handlePatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.URL.Query().Get("file")
+	if name == "" || filepath.Base(name) != name {
+		http.Error(w, "invalid filename", http.StatusBadRequest)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !hasValidLock(name, r.Header.Get("X-Lock")) {
+		lockedError(w, name)
+		return
+	}
+	base := r.Header.Get("If-Match")
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var req patchRequest
+	if ct == "application/json" {
+		if err := json.Unmarshal(body, &req); err != nil {
+			http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Base != "" {
+			base = req.Base
+		}
+	}
+	if base == "" {
+		http.Error(w, "missing base revision", http.StatusBadRequest)
+		return
+	}
+	prev, err := readNote(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if etag := contentETag(prev); !sameRevision(base, etag) {
+		setRevision(w.Header(), etag)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusPreconditionFailed)
+		_ = json.NewEncoder(w).Encode(saveConflict{Error: "file changed on disk", File: name, ETag: etag})
+		return
+	}
+	var data string
+	if ct == "application/json" {
+		data, err = applyEdits(string(prev), req.Edits)
+	} else {
+		data, err = applyUnifiedDiff(string(prev), string(body))
+	}
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errPatchMismatch) {
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	writeSave(w, name, []byte(data), prev, true)
+}
+
+// applyEdits applies non-overlapping edits, whose offsets refer to base, in
+// any order.
+func applyEdits(base string, edits []patchEdit) (string, error) {
+	edits = append([]patchEdit(nil), edits...)
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].Start < edits[j].Start })
+	var b strings.Builder
+	pos := 0
+	for _, e := range edits {
+		if e.Start < pos || e.End < e.Start || e.End > len(base) {
+			return "", fmt.Errorf("%w: edit %d-%d is out of range or overlaps another", errPatchMismatch, e.Start, e.End)
+		}
+		b.WriteString(base[pos:e.Start])
+		b.WriteString(e.Text)
+		pos = e.End
+	}
+	b.WriteString(base[pos:])
+	if !utf8.ValidString(b.String()) && utf8.ValidString(base) {
+		return "", fmt.Errorf("%w: edit splits a character", errPatchMismatch)
+	}
+	return b.String(), nil
+}
+
+var hunkHeaderRe = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// diffLine is one line of a hunk: ' ' context, '-' removed or '+' added,
+// with its line ending.
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// applyUnifiedDiff applies a unified diff to base. Context and removed
+// lines must match base exactly; file headers before the first hunk are
+// ignored.
+func applyUnifiedDiff(base, patch string) (string, error) {
+	lines := strings.SplitAfter(base, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	var out strings.Builder
+	pos := 0 // next base line to copy
+	hunks := 0
+	plines := strings.SplitAfter(patch, "\n")
+	for i := 0; i < len(plines); {
+		m := hunkHeaderRe.FindStringSubmatch(plines[i])
+		i++
+		if m == nil {
+			if hunks > 0 && strings.TrimSpace(plines[i-1]) != "" {
+				return "", fmt.Errorf("unexpected line in diff: %q", strings.TrimRight(plines[i-1], "\n"))
+			}
+			continue
+		}
+		hunks++
+		start, oldCount := hunkRange(m[1], m[2])
+		_, newCount := hunkRange(m[3], m[4])
+		var hunk []diffLine
+		olds, news := 0, 0
+		for i < len(plines) && (olds < oldCount || news < newCount || strings.HasPrefix(plines[i], `\`)) {
+			l := plines[i]
+			i++
+			if strings.HasPrefix(l, `\`) {
+				// "\ No newline at end of file" applies to the line before
+				if n := len(hunk); n > 0 {
+					hunk[n-1].text = strings.TrimSuffix(hunk[n-1].text, "\n")
+				}
+				continue
+			}
+			if l == "" {
+				break
+			}
+			if l == "\n" {
+				l = " \n" // blank context line with its space trimmed
+			}
+			op := l[0]
+			switch op {
+			case ' ':
+				olds++
+				news++
+			case '-':
+				olds++
+			case '+':
+				news++
+			default:
+				return "", fmt.Errorf("invalid hunk line: %q", strings.TrimRight(l, "\n"))
+			}
+			hunk = append(hunk, diffLine{op, l[1:]})
+		}
+		if olds != oldCount || news != newCount {
+			return "", errors.New("truncated hunk")
+		}
+		if oldCount > 0 {
+			start-- // 1-based; an empty old range names the line before
+		}
+		if start < pos || start > len(lines) {
+			return "", fmt.Errorf("%w: hunk at line %s is out of order or range", errPatchMismatch, m[1])
+		}
+		for _, l := range lines[pos:start] {
+			out.WriteString(l)
+		}
+		pos = start
+		for _, l := range hunk {
+			if l.op != '+' {
+				if pos >= len(lines) || lines[pos] != l.text {
+					return "", fmt.Errorf("%w: line %d differs", errPatchMismatch, pos+1)
+				}
+				pos++
+			}
+			if l.op != '-' {
+				out.WriteString(l.text)
+			}
+		}
+	}
+	if hunks == 0 {
+		return "", errors.New("no hunks in diff")
+	}
+	for _, l := range lines[pos:] {
+		out.WriteString(l)
+	}
+	return out.String(), nil
+}
+
+// hunkRange parses the start and count of a hunk header range; the count
+// defaults to 1.
+func hunkRange(start, count string) (int, int) {
+	s, _ := strconv.Atoi(start)
+	n := 1
+	if count != "" {
+		n, _ = strconv.Atoi(count)
+	}
+	return s, n
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestApplyUnifiedDiff(t *testing.T) {
+	base := "a\nb\nc\nd\n"
+	cases := []struct{ patch, want string }{
+		{"--- a/x.md\n+++ b/x.md\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n", "a\nB\nc\nd\n"},
+		{"@@ -0,0 +1 @@\n+z\n", "z\na\nb\nc\nd\n"},
+		{"@@ -2,0 +3 @@\n+x\n@@ -4 +5,0 @@\n-d\n", "a\nb\nx\nc\n"},
+		{"@@ -3,2 +3,2 @@\n c\n-d\n+e\n\\ No newline at end of file\n", "a\nb\nc\ne"},
+	}
+	for _, c := range cases {
+		got, err := applyUnifiedDiff(base, c.patch)
+		if err != nil || got != c.want {
+			t.Errorf("%q: got %q, %v", c.patch, got, err)
+		}
+	}
+	if got, err := applyUnifiedDiff("a\nb", "@@ -2 +2 @@\n-b\n\\ No newline at end of file\n+b\n"); err != nil || got != "a\nb\n" {
+		t.Errorf("missing newline: got %q, %v", got, err)
+	}
+	for _, bad := range []string{"@@ -1,2 +1,2 @@\n a\n-x\n+y\n", "@@ -9 +9 @@\n-z\n+y\n"} {
+		if _, err := applyUnifiedDiff(base, bad); !errors.Is(err, errPatchMismatch) {
+			t.Errorf("%q: err = %v", bad, err)
+		}
+	}
+	for _, bad := range []string{"", "@@ -1,2 +1,2 @@\n a\n", "@@ -1 +1 @@\n?a\n"} {
+		if _, err := applyUnifiedDiff(base, bad); err == nil || errors.Is(err, errPatchMismatch) {
+			t.Errorf("%q: err = %v", bad, err)
+		}
+	}
+}
+
+func TestApplyEdits(t *testing.T) {
+	got, err := applyEdits("hello world", []patchEdit{{Start: 6, End: 11, Text: "there"}, {Start: 0, End: 0, Text: "> "}})
+	if err != nil || got != "> hello there" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	for _, bad := range [][]patchEdit{{{Start: 2, End: 1}}, {{Start: 0, End: 99}}, {{Start: 0, End: 3}, {Start: 2, End: 4}}} {
+		if _, err := applyEdits("hello", bad); !errors.Is(err, errPatchMismatch) {
+			t.Errorf("%+v: err = %v", bad, err)
+		}
+	}
+	if _, err := applyEdits("héllo", []patchEdit{{Start: 2, End: 2, Text: "x"}}); err == nil {
+		t.Fatal("edit inside a character accepted")
+	}
+}
+
+func TestHandlePatch(t *testing.T) {
+	chdirTemp(t)
+	locks = make(map[string]lockInfo)
+	writeFiles(t, map[string]string{"note.md": "one\ntwo\n"})
+	tok := lockFile(t, "note.md")
+	patch := func(ct, ifMatch, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/patch?file=note.md", strings.NewReader(body))
+		req.Header.Set("X-Lock", tok)
+		req.Header.Set("Content-Type", ct)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		handlePatch(rr, req)
+		return rr
+	}
+	etag := contentETag([]byte("one\ntwo\n"))
+	rr := patch("text/x-diff", etag, "@@ -2 +2 @@\n-two\n+2\n")
+	if rr.Code != http.StatusNoContent || rr.Header().Get("ETag") != contentETag([]byte("one\n2\n")) {
+		t.Fatalf("diff patch = %d %q", rr.Code, rr.Body.String())
+	}
+	rr = patch("application/json", "", `{"base": `+strconv.Quote(rr.Header().Get("ETag"))+`, "edits": [{"start": 0, "end": 3, "text": "1"}]}`)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("json patch = %d %q", rr.Code, rr.Body.String())
+	}
+	if b, _ := os.ReadFile("note.md"); string(b) != "1\n2\n" {
+		t.Fatalf("file = %q", b)
+	}
+	// Undo steps back through patches like saves
+	if rr := undo("note.md", tok); rr.Body.String() != "one\n2\n" {
+		t.Fatalf("undo = %q", rr.Body.String())
+	}
+
+	if rr := patch("text/x-diff", etag, "@@ -1 +1 @@\n-one\n+x\n"); rr.Code != http.StatusPreconditionFailed || rr.Header().Get("ETag") != contentETag([]byte("one\n2\n")) {
+		t.Fatalf("stale base = %d", rr.Code)
+	}
+	if rr := patch("text/x-diff", contentETag([]byte("one\n2\n")), "@@ -1 +1 @@\n-uno\n+x\n"); rr.Code != http.StatusConflict {
+		t.Fatalf("mismatch = %d", rr.Code)
+	}
+	if rr := patch("text/x-diff", "", "@@ -1 +1 @@\n-one\n+x\n"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("no base = %d", rr.Code)
+	}
+	tok = "stale"
+	if rr := patch("text/x-diff", etag, ""); rr.Code != http.StatusLocked {
+		t.Fatalf("unlocked = %d", rr.Code)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// pdfHook expands to the page's /pdf URL in headers and footers, for a
+// "Download as PDF" link on pages served by the editor.
+const pdfHook = "{{pdf}}"
+
+// applyPDFHook expands {{pdf}} for the file name.
+func applyPDFHook(name string, header, footer []byte) ([]byte, []byte) {
+	link := []byte(html.EscapeString("/pdf?file=" + url.QueryEscape(name)))
+	return bytes.ReplaceAll(header, []byte(pdfHook), link), bytes.ReplaceAll(footer, []byte(pdfHook), link)
+}
+
+// pdfBrowsers are the headless browsers /pdf prints with, in order of
+// preference. Printing through a browser keeps print.css and any
+// configured styles.
+var pdfBrowsers = []string{"chromium", "chromium-browser", "google-chrome", "google-chrome-stable", "microsoft-edge"}
+
+// pdfTimeout bounds one browser run.
+var pdfTimeout = time.Minute
+
+var errNoPDFBrowser = errors.New("PDF export requires Chromium or Google Chrome")
+
+// pdfBrowser returns the first installed browser in pdfBrowsers.
+func pdfBrowser() (string, error) {
+	for _, name := range pdfBrowsers {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	return "", errNoPDFBrowser
+}
+
+// printPDF prints the HTML page to PDF with the headless browser, resolving
+// its assets against docsDir.
+func printPDF(browser string, page []byte, docsDir string) ([]byte, error) {
+	abs, err := filepath.Abs(wsPath(docsDir))
+	if err != nil {
+		return nil, err
+	}
+	base := (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs) + "/"}).String()
+	tmp, err := os.MkdirTemp("", "minimark-pdf-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	in, out := filepath.Join(tmp, "page.html"), filepath.Join(tmp, "page.pdf")
+	if err := os.WriteFile(in, withBase(page, base), 0600); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), pdfTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, browser, "--headless", "--disable-gpu", "--no-pdf-header-footer",
+		"--user-data-dir="+filepath.Join(tmp, "profile"), "--print-to-pdf="+out,
+		(&url.URL{Scheme: "file", Path: filepath.ToSlash(in)}).String())
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	pdf, err := os.ReadFile(out)
+	if err != nil || !bytes.HasPrefix(pdf, []byte("%PDF")) {
+		return nil, fmt.Errorf("browser did not write a PDF: %s", strings.TrimSpace(stderr.String()))
+	}
+	return pdf, nil
+}
+
+// handlePDF renders a note like its export and returns it as a PDF
+// download:
+//
+//	GET /pdf?file=notes.md
+//
+// Password-protected pages are refused, since the PDF would not be.
+func handlePDF(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.URL.Query().Get("file")
+	if name == "" || filepath.Base(name) != name || !strings.EqualFold(filepath.Ext(name), ".md") {
+		http.Error(w, "invalid filename", http.StatusBadRequest)
+		return
+	}
+	if cmarkPath == "" {
+		http.Error(w, "HTML export is disabled", http.StatusServiceUnavailable)
+		return
+	}
+	browser, err := pdfBrowser()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	md, err := readNote(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if pagePassword(md) != "" {
+		http.Error(w, "page is password protected", http.StatusForbidden)
+		return
+	}
+	page, err := renderPageAs(cmarkPath, name, md)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	pdf, err := printPDF(browser, page, exportDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	slug := strings.TrimSuffix(htmlOutNameFor(name), ".html")
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": slug + ".pdf"}))
+	w.Header().Set("Cache-Control", "no-cache")
+	_, _ = w.Write(pdf)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakeBrowser puts a "chromium" on PATH that writes a PDF holding the page
+// it was asked to print.
+func fakeBrowser(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows")
+	}
+	bin := t.TempDir()
+	script := `#!/bin/sh
+for a in "$@"; do
+  case "$a" in
+    --print-to-pdf=*) out="${a#--print-to-pdf=}" ;;
+    file://*) in="${a#file://}" ;;
+  esac
+done
+{ printf '%%PDF-1.4\n'; cat "$in"; } > "$out"
+`
+	if err := os.WriteFile(filepath.Join(bin, "chromium"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestApplyPDFHook(t *testing.T) {
+	h, f := applyPDFHook("Trip Notes.md", []byte(`<a href="{{pdf}}">PDF</a>`), []byte("{{pdf}}"))
+	if string(h) != `<a href="/pdf?file=Trip+Notes.md">PDF</a>` || string(f) != "/pdf?file=Trip+Notes.md" {
+		t.Errorf("got %s, %s", h, f)
+	}
+}
+
+func TestHandlePDF(t *testing.T) {
+	chdirTemp(t)
+	cmarkPath = echoCmark(t)
+	t.Cleanup(func() { cmarkPath = "" })
+	writeFiles(t, map[string]string{
+		"Trip Notes.md": "# Trip\n",
+		"locked.md":     "---\npassword: s3cret\n---\n# Locked\n",
+	})
+	get := func(query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handlePDF(rr, httptest.NewRequest(http.MethodGet, "/pdf?"+query, nil))
+		return rr
+	}
+
+	path := os.Getenv("PATH")
+	t.Setenv("PATH", t.TempDir())
+	if rr := get("file=Trip+Notes.md"); rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("without a browser: %d", rr.Code)
+	}
+
+	t.Setenv("PATH", path)
+	fakeBrowser(t)
+	for query, code := range map[string]int{
+		"file=../x.md":    http.StatusBadRequest,
+		"file=missing.md": http.StatusNotFound,
+		"file=locked.md":  http.StatusForbidden,
+	} {
+		if rr := get(query); rr.Code != code {
+			t.Errorf("%s: %d, want %d", query, rr.Code, code)
+		}
+	}
+	rr := get("file=Trip+Notes.md")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/pdf" {
+		t.Errorf("content type %q", ct)
+	}
+	if cd := rr.Header().Get("Content-Disposition"); !strings.Contains(cd, `"Trip Notes.pdf"`) {
+		t.Errorf("disposition %q", cd)
+	}
+	body := rr.Body.String()
+	if !strings.HasPrefix(body, "%PDF") || !strings.Contains(body, "# Trip") || !strings.Contains(body, `<base href="file://`) {
+		t.Errorf("pdf %q", body)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// plantumlCacheDir keeps rendered diagrams so unchanged ones are not sent
+// to the server or jar again on every save.
+var plantumlCacheDir = filepath.Join(".minimark", "plantuml")
+
+var (
+	plantumlFenceRe = regexp.MustCompile(`(?s)<pre><code class="language-plantuml">(.*?)</code></pre>`)
+	xmlPrologRe     = regexp.MustCompile(`^\s*<\?xml[^>]*\?>\s*`)
+)
+
+var plantumlClient = &http.Client{Timeout: 15 * time.Second}
+
+// plantumlDiagrams replaces ```plantuml fences with inline SVG rendered by
+// the configured PlantUML server or jar. Without either, or when rendering
+// fails, the code block is kept.
+func plantumlDiagrams(body []byte) []byte {
+	if config.PlantUMLServer == "" && config.PlantUMLJar == "" {
+		return body
+	}
+	return plantumlFenceRe.ReplaceAllFunc(body, func(m []byte) []byte {
+		src := html.UnescapeString(string(plantumlFenceRe.FindSubmatch(m)[1]))
+		svg, err := plantumlSVG(src)
+		if err != nil {
+			log.Printf("plantuml: %v", err)
+			return m
+		}
+		return []byte(`<figure class="plantuml">` + string(xmlPrologRe.ReplaceAll(svg, nil)) + "</figure>")
+	})
+}
+
+// plantumlSVG renders src, using the cache when possible.
+func plantumlSVG(src string) ([]byte, error) {
+	sum := sha256.Sum256([]byte(src))
+	cached := filepath.Join(plantumlCacheDir, hex.EncodeToString(sum[:])+".svg")
+	if b, err := os.ReadFile(wsPath(cached)); err == nil {
+		return b, nil
+	}
+	var svg []byte
+	var err error
+	if config.PlantUMLJar != "" {
+		svg, err = plantumlJar(src)
+	} else {
+		svg, err = plantumlServer(src)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Contains(svg, []byte("<svg")) {
+		return nil, fmt.Errorf("renderer did not return SVG")
+	}
+	if err := os.MkdirAll(wsPath(plantumlCacheDir), 0755); err == nil {
+		_ = os.WriteFile(wsPath(cached), svg, 0644)
+	}
+	return svg, nil
+}
+
+func plantumlJar(src string) ([]byte, error) {
+	cmd := workspaceCommand("java", "-jar", config.PlantUMLJar, "-tsvg", "-pipe")
+	cmd.Stdin = strings.NewReader(src)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+func plantumlServer(src string) ([]byte, error) {
+	url := strings.TrimRight(config.PlantUMLServer, "/") + "/svg/" + plantumlEncode([]byte(src))
+	resp, err := plantumlClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+}
+
+// plantumlAlphabet is PlantUML's variant of base64.
+const plantumlAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz-_"
+
+// plantumlEncode deflates src and encodes it for a PlantUML server URL.
+func plantumlEncode(src []byte) string {
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.BestCompression)
+	_, _ = w.Write(src)
+	_ = w.Close()
+	data := buf.Bytes()
+	var sb strings.Builder
+	for i := 0; i < len(data); i += 3 {
+		var b [3]byte
+		copy(b[:], data[i:])
+		sb.WriteByte(plantumlAlphabet[b[0]>>2])
+		sb.WriteByte(plantumlAlphabet[(b[0]&0x3)<<4|b[1]>>4])
+		sb.WriteByte(plantumlAlphabet[(b[1]&0xF)<<2|b[2]>>6])
+		sb.WriteByte(plantumlAlphabet[b[2]&0x3F])
+	}
+	return sb.String()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// plantumlDecode reverses plantumlEncode.
+func plantumlDecode(t *testing.T, s string) string {
+	t.Helper()
+	var data []byte
+	for i := 0; i+3 < len(s); i += 4 {
+		var v [4]byte
+		for j := range v {
+			v[j] = byte(strings.IndexByte(plantumlAlphabet, s[i+j]))
+		}
+		data = append(data, v[0]<<2|v[1]>>4, v[1]<<4|v[2]>>2, v[2]<<6|v[3])
+	}
+	b, err := io.ReadAll(flate.NewReader(bytes.NewReader(data)))
+	if err != nil && err != io.ErrUnexpectedEOF {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestPlantumlDiagrams_Server(t *testing.T) {
+	chdirTemp(t)
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, plantumlDecode(t, strings.TrimPrefix(r.URL.Path, "/uml/svg/")))
+		w.Write([]byte(`<?xml version="1.0"?><svg><text>A</text></svg>`))
+	}))
+	defer srv.Close()
+	withConfig(t, siteConfig{PlantUMLServer: srv.URL + "/uml/"})
+
+	in := []byte("<pre><code class=\"language-plantuml\">A -&gt; B\n</code></pre>\n")
+	out := string(plantumlDiagrams(in))
+	if out != "<figure class=\"plantuml\"><svg><text>A</text></svg></figure>\n" {
+		t.Fatalf("out = %q", out)
+	}
+	if len(got) != 1 || got[0] != "A -> B\n" {
+		t.Fatalf("server saw %q", got)
+	}
+	// A second render of the same diagram is served from the cache
+	plantumlDiagrams(in)
+	if len(got) != 1 {
+		t.Fatalf("server called %d times", len(got))
+	}
+}
+
+func TestPlantumlDiagrams_FailureKeepsBlock(t *testing.T) {
+	chdirTemp(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad diagram", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+	in := []byte(`<pre><code class="language-plantuml">nope</code></pre>`)
+	if out := plantumlDiagrams(in); !bytes.Equal(out, in) {
+		t.Fatalf("unconfigured: %q", out)
+	}
+	withConfig(t, siteConfig{PlantUMLServer: srv.URL})
+	if out := plantumlDiagrams(in); !bytes.Equal(out, in) {
+		t.Fatalf("failed render: %q", out)
+	}
+}
+
+func TestPlantumlDiagrams_Jar(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows")
+	}
+	chdirTemp(t)
+	bin := t.TempDir()
+	script := "#!/bin/sh\n[ \"$3\" = -tsvg ] && [ \"$4\" = -pipe ] || exit 1\nread -r line; printf '<svg>%s</svg>' \"$line\"\n"
+	if err := os.WriteFile(filepath.Join(bin, "java"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+	withConfig(t, siteConfig{PlantUMLJar: "plantuml.jar", PlantUMLServer: "http://127.0.0.1:1"})
+	out := string(plantumlDiagrams([]byte(`<pre><code class="language-plantuml">x</code></pre>`)))
+	if out != "<figure class=\"plantuml\"><svg>x</svg></figure>" {
+		t.Fatalf("out = %q", out)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// presenceChanges fans out the files being edited, as a JSON presence
+// list, whenever it changes.
+var presenceChanges = &reloadHub{clients: map[chan string]bool{}}
+
+// presencePollInterval is how often watchPresence looks at the locks,
+// which expire without notice.
+var presencePollInterval = 500 * time.Millisecond
+
+// presence is a file being edited and who by; Owner is the lockOwner of
+// the editor's lock and Editor its display name, if it gave one.
+type presence struct {
+	File   string `json:"file"`
+	Owner  string `json:"owner"`
+	Editor string `json:"editor,omitempty"`
+}
+
+// currentPresence lists the files locked right now, by file.
+func currentPresence() []presence {
+	list := []presence{}
+	for _, l := range activeLocks() {
+		list = append(list, presence{File: l.File, Owner: l.Owner, Editor: l.Editor})
+	}
+	return list
+}
+
+// presenceJSON returns currentPresence encoded for a presence event.
+func presenceJSON() string {
+	b, _ := json.Marshal(currentPresence())
+	return string(b)
+}
+
+// watchPresence polls the locks and broadcasts the presence list when
+// files start or stop being edited. It never returns.
+func watchPresence() {
+	last := presenceJSON()
+	for {
+		time.Sleep(presencePollInterval)
+		if cur := presenceJSON(); cur != last {
+			last = cur
+			presenceChanges.broadcast(cur)
+		}
+	}
+}
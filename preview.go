@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+)
+
+// maxPreviewSize bounds the Markdown a /preview request may post.
+const maxPreviewSize = 10 << 20
+
+// handlePreview renders the Markdown in the request body exactly as it
+// would be exported, with the same converter, includes and layouts,
+// without writing anything, not even to the render cache. The optional `file` query param names the note
+// being edited, for folder includes, series and language links. Password
+// protection is left off so the editor can show the page. Link cards only
+// show pages a saved note links to.
+func handlePreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.URL.Query().Get("file")
+	if name != "" && filepath.Base(name) != name {
+		http.Error(w, "invalid filename", http.StatusBadRequest)
+		return
+	}
+	md, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPreviewSize))
+	if err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			http.Error(w, "note too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if fields, _ := parseFrontMatter(md); fields["password"] != "" {
+		md = setFrontMatterField(md, "password", "")
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	serveRendered(w, name, md, "/docs/")
+}
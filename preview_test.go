@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestHandlePreview(t *testing.T) {
+	chdirTemp(t)
+	post := func(query, md string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handlePreview(rr, httptest.NewRequest(http.MethodPost, "/preview"+query, strings.NewReader(md)))
+		return rr
+	}
+	if rr := post("", "# Hi\n"); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("export disabled: %d", rr.Code)
+	}
+	cmarkPath = builtinConverter
+	t.Cleanup(func() { cmarkPath = "" })
+	if err := os.Mkdir("_includes", 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, map[string]string{filepath.Join("_includes", "header.html"): "<html><head><title>{{title}}</title></head><body>\n"})
+
+	rr := post("?file=note.md", "---\ntitle: Draft\npassword: secret\n---\n*hi*\n")
+	body := rr.Body.String()
+	if rr.Code != http.StatusOK || !strings.Contains(body, "<title>Draft</title>") || !strings.Contains(body, "<p><em>hi</em></p>") || !strings.Contains(body, `<base href="/docs/">`) {
+		t.Errorf("preview: %d %q", rr.Code, body)
+	}
+	if entries, _ := os.ReadDir("."); len(entries) != 1 {
+		t.Errorf("preview wrote files: %v", entries)
+	}
+	if rr := post("?file=../x.md", "x"); rr.Code != http.StatusBadRequest {
+		t.Errorf("bad name: %d", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	handlePreview(rr, httptest.NewRequest(http.MethodGet, "/preview", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: %d", rr.Code)
+	}
+}
+
+func TestHandlePreview_TooLarge(t *testing.T) {
+	chdirTemp(t)
+	cmarkPath = builtinConverter
+	t.Cleanup(func() { cmarkPath = "" })
+	rr := httptest.NewRecorder()
+	handlePreview(rr, httptest.NewRequest(http.MethodPost, "/preview", strings.NewReader(strings.Repeat("a", maxPreviewSize+1))))
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("large body: %d", rr.Code)
+	}
+}
+
+func TestHandlePreview_NoRenderCache(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows")
+	}
+	chdirTemp(t)
+	cmark := filepath.Join(t.TempDir(), "cmark-gfm")
+	if err := os.WriteFile(cmark, []byte("#!/bin/sh\ncat\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	cmarkPath = cmark
+	t.Cleanup(func() { cmarkPath = "" })
+	for _, md := range []string{"d", "dr", "dra", "draf"} {
+		rr := httptest.NewRecorder()
+		handlePreview(rr, httptest.NewRequest(http.MethodPost, "/preview", strings.NewReader(md)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("preview: %d %s", rr.Code, rr.Body.String())
+		}
+	}
+	if _, err := os.Stat(renderCacheDir); !os.IsNotExist(err) {
+		t.Fatalf("previews filled the render cache: %v", err)
+	}
+}
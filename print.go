@@ -0,0 +1,19 @@
+package main
+
+import "bytes"
+
+// printBreaks wraps exported pages so print.css starts each top-level
+// section on a new page, for handouts and long documents.
+var printBreaks bool
+
+// printLink references the print stylesheet from exported pages.
+const printLink = `<link rel="stylesheet" type="text/css" href="print.css" media="print">`
+
+// ensurePrintLink adds the print stylesheet link to a header that has a
+// </head> but does not reference print.css yet.
+func ensurePrintLink(header []byte) []byte {
+	if bytes.Contains(header, []byte("print.css")) {
+		return header
+	}
+	return insertBeforeTag(header, "</head>", printLink+"\n")
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestEnsurePrintLink(t *testing.T) {
+	cases := []struct{ in, want string }{
+		{"<head><title>x</title></head><body>", "<head><title>x</title>" + printLink + "\n</head><body>"},
+		{"<HEAD></HEAD>", "<HEAD>" + printLink + "\n</HEAD>"},
+		{`<head><link href="print.css"></head>`, `<head><link href="print.css"></head>`},
+		{"<h>H</h>", "<h>H</h>"},
+	}
+	for _, c := range cases {
+		if got := string(ensurePrintLink([]byte(c.in))); got != c.want {
+			t.Errorf("ensurePrintLink(%q) = %q; want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestCopyIncludesToDocs_DefaultAssets(t *testing.T) {
+	chdirTemp(t)
+	if err := os.MkdirAll("_includes", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyIncludesToDocs("_includes", "docs"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join("docs", "print.css"))
+	if err != nil || !strings.Contains(string(b), "@media print") {
+		t.Fatalf("default print.css not written: %v", err)
+	}
+	for _, name := range defaultAssets {
+		if _, err := os.Stat(filepath.Join("docs", name)); err != nil {
+			t.Fatalf("default %s not written: %v", name, err)
+		}
+	}
+
+	// A print.css in _includes wins over the default
+	if err := os.WriteFile(filepath.Join("_includes", "print.css"), []byte("custom"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyIncludesToDocs("_includes", "docs"); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(filepath.Join("docs", "print.css")); string(b) != "custom" {
+		t.Fatalf("got %q", b)
+	}
+}
+
+func TestRenderPage_PrintBreaks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows")
+	}
+	chdirTemp(t)
+	printBreaks = true
+	t.Cleanup(func() { printBreaks = false })
+	script := filepath.Join(t.TempDir(), "cmark.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho '<p>Body</p>'\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	page, err := renderPage(script, []byte("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.ReplaceAll(string(page), "\n", ""); got != `<div class="print-breaks"><p>Body</p></div>` {
+		t.Fatalf("got %q", got)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"html"
+)
+
+// protectIterations is the PBKDF2-SHA256 work factor for page passwords,
+// following OWASP's recommendation. Browsers derive the key in well under
+// a second.
+var protectIterations = 600000
+
+// protectedPayload is the encrypted page as embedded in its wrapper.
+type protectedPayload struct {
+	Salt       string `json:"salt"`
+	IV         string `json:"iv"`
+	Data       string `json:"data"`
+	Iterations int    `json:"iterations"`
+}
+
+// pagePassword returns the password: front matter of the page md, or "".
+func pagePassword(md []byte) string {
+	fields, _ := parseFrontMatter(md)
+	return fields["password"]
+}
+
+// pbkdf2SHA256 derives a keyLen-byte key from password and salt (RFC 8018).
+func pbkdf2SHA256(password, salt []byte, iter, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	var key []byte
+	for block := uint32(1); len(key) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(binary.BigEndian.AppendUint32(nil, block))
+		u := prf.Sum(nil)
+		t := append([]byte{}, u...)
+		for i := 1; i < iter; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
+
+// encryptPage encrypts page with AES-256-GCM under a key derived from
+// password with a fresh salt.
+func encryptPage(page []byte, password string) (protectedPayload, error) {
+	salt := make([]byte, 16)
+	iv := make([]byte, 12)
+	if _, err := rand.Read(salt); err != nil {
+		return protectedPayload{}, err
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return protectedPayload{}, err
+	}
+	block, err := aes.NewCipher(pbkdf2SHA256([]byte(password), salt, protectIterations, 32))
+	if err != nil {
+		return protectedPayload{}, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return protectedPayload{}, err
+	}
+	enc := base64.StdEncoding
+	return protectedPayload{
+		Salt:       enc.EncodeToString(salt),
+		IV:         enc.EncodeToString(iv),
+		Data:       enc.EncodeToString(gcm.Seal(nil, iv, page, nil)),
+		Iterations: protectIterations,
+	}, nil
+}
+
+// unlockScript decrypts the payload with the entered password using Web
+// Crypto and replaces the document with the page.
+const unlockScript = `(function () {
+  var form = document.getElementById('unlock');
+  var p = JSON.parse(document.getElementById('payload').textContent);
+  function bytes(b64) { return Uint8Array.from(atob(b64), function (c) { return c.charCodeAt(0); }); }
+  form.addEventListener('submit', function (e) {
+    e.preventDefault();
+    var pw = new TextEncoder().encode(document.getElementById('password').value);
+    crypto.subtle.importKey('raw', pw, 'PBKDF2', false, ['deriveKey']).then(function (k) {
+      return crypto.subtle.deriveKey({name: 'PBKDF2', salt: bytes(p.salt), iterations: p.iterations, hash: 'SHA-256'},
+        k, {name: 'AES-GCM', length: 256}, false, ['decrypt']);
+    }).then(function (key) {
+      return crypto.subtle.decrypt({name: 'AES-GCM', iv: bytes(p.iv)}, key, bytes(p.data));
+    }).then(function (page) {
+      document.open();
+      document.write(new TextDecoder().decode(page));
+      document.close();
+    }, function () {
+      document.getElementById('unlock-error').hidden = false;
+    });
+  });
+})();`
+
+// protectPage returns the wrapper published in place of page when it has a
+// password: a form that decrypts page in the browser. Only the wrapper is
+// readable without the password, so it is not indexed and has a generic
+// title. With export_csp set to "meta", its policy also covers page.
+func protectPage(page []byte, password string) ([]byte, error) {
+	payload, err := encryptPage(page, password)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	wrapper := []byte(fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Protected page</title>
+<style>
+body{font:17px/1.5 -apple-system,Helvetica,Arial,sans-serif;max-width:24em;margin:4em auto;padding:0 1em}
+input,button{font:inherit;padding:.25em .5em}
+</style>
+</head>
+<body>
+<form id="unlock">
+<p><label for="password">This page is password protected.</label></p>
+<p><input id="password" type="password" autocomplete="current-password" required autofocus> <button type="submit">Open</button></p>
+<p id="unlock-error" role="alert" hidden>Wrong password.</p>
+</form>
+<script id="payload" type="application/json">%s</script>
+<script>
+%s
+</script>
+</body>
+</html>
+`, data, unlockScript))
+	if config.ExportCSP != cspMeta {
+		return wrapper, nil
+	}
+	tag := fmt.Sprintf("<meta http-equiv=\"Content-Security-Policy\" content=\"%s\">\n", html.EscapeString(pageCSP(append(append([]byte{}, page...), wrapper...))))
+	return insertBeforeTag(wrapper, "<meta name=\"viewport\"", tag), nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestPBKDF2SHA256(t *testing.T) {
+	cases := []struct {
+		iter int
+		want string
+	}{
+		{1, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{2, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+		{4096, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+	}
+	for _, c := range cases {
+		if got := hex.EncodeToString(pbkdf2SHA256([]byte("password"), []byte("salt"), c.iter, 32)); got != c.want {
+			t.Errorf("%d iterations: got %s, want %s", c.iter, got, c.want)
+		}
+	}
+}
+
+var payloadRe = regexp.MustCompile(`(?s)<script id="payload" type="application/json">(.*?)</script>`)
+
+// decryptWrapper reverses protectPage the way the browser does.
+func decryptWrapper(t *testing.T, wrapper []byte, password string) string {
+	t.Helper()
+	m := payloadRe.FindSubmatch(wrapper)
+	if m == nil {
+		t.Fatalf("no payload in %s", wrapper)
+	}
+	var p protectedPayload
+	if err := json.Unmarshal(m[1], &p); err != nil {
+		t.Fatal(err)
+	}
+	dec := func(s string) []byte {
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	block, _ := aes.NewCipher(pbkdf2SHA256([]byte(password), dec(p.Salt), p.Iterations, 32))
+	gcm, _ := cipher.NewGCM(block)
+	page, err := gcm.Open(nil, dec(p.IV), dec(p.Data), nil)
+	if err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	return string(page)
+}
+
+func TestRenderPage_Password(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows")
+	}
+	chdirTemp(t)
+	old := protectIterations
+	protectIterations = 10
+	t.Cleanup(func() { protectIterations = old })
+	withConfig(t, siteConfig{ExportCSP: cspMeta})
+	os.MkdirAll("_includes", 0755)
+	os.WriteFile(filepath.Join("_includes", "header.html"), []byte("<html><head><title>{{title}}</title></head><body>\n"), 0644)
+	script := filepath.Join(t.TempDir(), "cmark.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho '<p>Launch plans</p>'\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	md := []byte("---\npassword: hunter2\n---\n# Secret Project\n")
+
+	for name, render := range map[string]func() ([]byte, error){
+		"page":   func() ([]byte, error) { return renderPageAs(script, "secret.md", md) },
+		"reader": func() ([]byte, error) { return renderReaderPage(script, "secret.md", md) },
+	} {
+		wrapper, err := render()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, leak := range []string{"Launch plans", "Secret Project", "hunter2"} {
+			if strings.Contains(string(wrapper), leak) {
+				t.Errorf("%s: wrapper leaks %q", name, leak)
+			}
+		}
+		for _, want := range []string{`<meta name="robots" content="noindex">`, "Content-Security-Policy", `id="unlock"`} {
+			if !strings.Contains(string(wrapper), want) {
+				t.Errorf("%s: wrapper missing %q", name, want)
+			}
+		}
+		if page := decryptWrapper(t, wrapper, "hunter2"); !strings.Contains(page, "<p>Launch plans</p>") {
+			t.Errorf("%s: decrypted page = %q", name, page)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"html"
+	"os"
+	"path/filepath"
+)
+
+// readerHTML enables the reader-mode variant of each export, written to
+// docs/reader/<name>.html alongside the regular page.
+var readerHTML bool
+
+// readerDir is the docs subdirectory holding reader-mode pages.
+const readerDir = "reader"
+
+// readerCSS is inlined into every reader page so it renders the same when
+// embedded in an app or pasted into an email.
+const readerCSS = `body{max-width:40em;margin:2em auto;padding:0 1em;font:17px/1.6 Georgia,serif;color:#222;background:#fff}
+h1,h2,h3,h4{font-family:-apple-system,Helvetica,Arial,sans-serif;line-height:1.25}
+img{max-width:100%;height:auto}
+pre,code{font:14px/1.4 Menlo,Consolas,monospace;background:#f5f5f5}
+pre{padding:.75em;overflow-x:auto}
+blockquote{margin-inline-start:0;padding-inline-start:1em;border-inline-start:3px solid #ddd;color:#555}
+[dir=rtl] pre,[dir=rtl] code{direction:ltr;text-align:left}
+table{border-collapse:collapse}td,th{border:1px solid #ddd;padding:.25em .5em}
+figure{margin:1.5em 0}figcaption{font-size:.9em;color:#555;text-align:center}
+.video iframe{display:block;width:100%;aspect-ratio:16/9;height:auto;border:0}
+.embed{margin:1.5em 0}.embed iframe,.embed img{max-width:100%}
+.link-card{display:block;margin:1.5em 0;padding:.75em 1em;border:1px solid #ddd;border-radius:6px;color:inherit;text-decoration:none}.link-card-icon{vertical-align:middle;margin-inline-end:.5em}.link-card-title{font-weight:bold}.link-card-description,.link-card-host{display:block;margin-top:.25em;font-size:.9em;color:#555}
+a{color:#0645ad}`
+
+// readerOutPath returns the reader-mode path for a regular export path.
+func readerOutPath(outPath string) string {
+	return filepath.Join(filepath.Dir(outPath), readerDir, filepath.Base(outPath))
+}
+
+// renderReaderPage converts Markdown to a standalone HTML document without
+// the _includes header/footer: front matter is dropped and only minimal
+// inlined CSS is applied.
+func renderReaderPage(cmark, name string, md []byte) ([]byte, error) {
+	_, body := parseFrontMatter(md)
+	out, err := convertMarkdown(cmark, body)
+	if err != nil {
+		return nil, err
+	}
+	title := pageTitle(md)
+	var b bytes.Buffer
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	b.WriteString("<meta name=\"viewport\" content=\"width=device-width, initial-scale=1\">\n")
+	b.WriteString("<title>" + html.EscapeString(title) + "</title>\n")
+	if robots := pageRobots(md); robots != "" {
+		b.WriteString("<meta name=\"robots\" content=\"" + html.EscapeString(robots) + "\">\n")
+	}
+	b.WriteString("<style>\n" + readerCSS + "\n</style>\n</head>\n<body>\n<article>\n")
+	b.Write(out)
+	b.WriteString("</article>\n</body>\n</html>\n")
+	page := b.Bytes()
+	if lang := pageLang(name, md); lang != "" {
+		page, _ = setHTMLLang(page, lang)
+	}
+	if pw := pagePassword(md); pw != "" {
+		return protectPage(page, pw)
+	}
+	return applyExportCSP(page), nil
+}
+
+// exportReaderTo writes the reader-mode page for the file name, whose
+// content is md, to outPath.
+func exportReaderTo(cmark, name string, md []byte, outPath string) error {
+	if err := os.MkdirAll(wsPath(filepath.Dir(outPath)), 0755); err != nil {
+		return err
+	}
+	page, err := renderReaderPage(cmark, name, md)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(wsPath(outPath), page, 0644)
+}
+
+// removeExport deletes the exported page outName from docsDir, including its
+// metadata and reader-mode variant (best-effort).
+func removeExport(docsDir, outName string) {
+	_ = os.Remove(wsPath(filepath.Join(docsDir, outName)))
+	_ = os.Remove(wsPath(pageMetaPath(filepath.Join(docsDir, outName))))
+	_ = os.Remove(wsPath(filepath.Join(docsDir, readerDir, outName)))
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestExportMarkdownTo_Reader(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows")
+	}
+	chdirTemp(t)
+	readerHTML = true
+	t.Cleanup(func() { readerHTML = false })
+	script := filepath.Join(t.TempDir(), "cmark.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\nread -r line\nprintf '<p>%s</p>' \"$line\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll("_includes", 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, map[string]string{
+		"in.md": "---\ntitle: A & B\n---\nBody\n",
+		filepath.Join("_includes", "header.html"): "<h>H</h>",
+	})
+	if err := exportMarkdownTo(script, "in.md", filepath.Join("docs", "in.html")); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join("docs", "reader", "in.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(b)
+	for _, want := range []string{"<title>A &amp; B</title>", "<style>", "<p>Body</p>"} {
+		if !strings.Contains(page, want) {
+			t.Fatalf("reader page missing %q:\n%s", want, page)
+		}
+	}
+	if strings.Contains(page, "<h>H</h>") {
+		t.Fatalf("reader page should not include the site header")
+	}
+
+	removeExport("docs", "in.html")
+	for _, p := range []string{filepath.Join("docs", "in.html"), filepath.Join("docs", "reader", "in.html")} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Fatalf("%s should be removed", p)
+		}
+	}
+}
+
+func TestExportMarkdownTo_ReaderDisabled(t *testing.T) {
+	chdirTemp(t)
+	if err := os.WriteFile("in.md", []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := exportMarkdownTo("/bin/echo", "in.md", filepath.Join("docs", "in.html")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join("docs", "reader")); !os.IsNotExist(err) {
+		t.Fatalf("reader dir should not exist when disabled")
+	}
+}
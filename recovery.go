@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// recoveryDir holds bodies of saves that failed, so the text is never lost.
+var recoveryDir = filepath.Join(".minimark", "recovery")
+
+// recoveryDraft describes a stashed body; the content lives next to it in
+// <id>.md.
+type recoveryDraft struct {
+	ID     string    `json:"id"` // sha256 of the content
+	File   string    `json:"file"`
+	Reason string    `json:"reason"`
+	Size   int       `json:"size"`
+	Time   time.Time `json:"time"`
+}
+
+var recoveryIDRe = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// stashRecovery stores data from a failed save of file under its content
+// hash (best-effort). Identical content is stored once.
+func stashRecovery(file string, data []byte, reason string) {
+	sum := sha256.Sum256(data)
+	id := hex.EncodeToString(sum[:])
+	if err := os.MkdirAll(wsPath(recoveryDir), 0755); err != nil {
+		log.Printf("recovery stash failed for %s: %v", file, err)
+		return
+	}
+	sealed, err := sealNote(data, encryptedNote(file))
+	if err == nil {
+		err = os.WriteFile(wsPath(filepath.Join(recoveryDir, id+".md")), sealed, 0644)
+	}
+	if err != nil {
+		log.Printf("recovery stash failed for %s: %v", file, err)
+		return
+	}
+	meta, _ := json.Marshal(recoveryDraft{ID: id, File: file, Reason: reason, Size: len(data), Time: time.Now()})
+	_ = os.WriteFile(wsPath(filepath.Join(recoveryDir, id+".json")), meta, 0644)
+	log.Printf("save of %s failed (%s); body stashed as recovery draft %s", file, reason, id)
+}
+
+// handleRecovery lists stashed drafts as JSON, newest first, or with
+// ?id=<hash> returns the content of one draft.
+func handleRecovery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if id := r.URL.Query().Get("id"); id != "" {
+		if !recoveryIDRe.MatchString(id) {
+			http.Error(w, "invalid id", http.StatusBadRequest)
+			return
+		}
+		b, err := os.ReadFile(wsPath(filepath.Join(recoveryDir, id+".md")))
+		if err == nil {
+			b, err = openNote(b)
+		}
+		if err != nil {
+			if os.IsNotExist(err) {
+				http.Error(w, "not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write(b)
+		return
+	}
+	drafts := []recoveryDraft{}
+	entries, err := os.ReadDir(wsPath(recoveryDir))
+	if err != nil && !os.IsNotExist(err) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		b, err := os.ReadFile(wsPath(filepath.Join(recoveryDir, e.Name())))
+		if err != nil {
+			continue
+		}
+		var d recoveryDraft
+		if json.Unmarshal(b, &d) == nil {
+			drafts = append(drafts, d)
+		}
+	}
+	sort.Slice(drafts, func(i, j int) bool { return drafts[i].Time.After(drafts[j].Time) })
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(drafts)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecovery_StashOnLockedSave(t *testing.T) {
+	chdirTemp(t)
+	locks = make(map[string]lockInfo)
+	rr := saveFile(t, "note.md", "stale", "precious words")
+	if rr.Code != http.StatusLocked {
+		t.Fatalf("expected 423, got %d", rr.Code)
+	}
+	// Same body twice is stored once
+	saveFile(t, "note.md", "stale", "precious words")
+
+	rr = httptest.NewRecorder()
+	handleRecovery(rr, httptest.NewRequest(http.MethodGet, "/recovery", nil))
+	var drafts []recoveryDraft
+	if err := json.Unmarshal(rr.Body.Bytes(), &drafts); err != nil {
+		t.Fatal(err)
+	}
+	if len(drafts) != 1 || drafts[0].File != "note.md" || drafts[0].Reason != "locked" {
+		t.Fatalf("drafts = %+v", drafts)
+	}
+
+	rr = httptest.NewRecorder()
+	handleRecovery(rr, httptest.NewRequest(http.MethodGet, "/recovery?id="+drafts[0].ID, nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != "precious words" {
+		t.Fatalf("draft = %d %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestHandleRecovery_EmptyAndErrors(t *testing.T) {
+	chdirTemp(t)
+	rr := httptest.NewRecorder()
+	handleRecovery(rr, httptest.NewRequest(http.MethodGet, "/recovery", nil))
+	if strings.TrimSpace(rr.Body.String()) != "[]" {
+		t.Fatalf("expected empty list, got %q", rr.Body.String())
+	}
+	cases := []struct {
+		method, url string
+		want        int
+	}{
+		{http.MethodPost, "/recovery", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/recovery?id=../../etc", http.StatusBadRequest},
+		{http.MethodGet, "/recovery?id=" + strings.Repeat("a", 64), http.StatusNotFound},
+	}
+	for _, c := range cases {
+		rr := httptest.NewRecorder()
+		handleRecovery(rr, httptest.NewRequest(c.method, c.url, nil))
+		if rr.Code != c.want {
+			t.Errorf("%s %s = %d; want %d", c.method, c.url, rr.Code, c.want)
+		}
+	}
+}
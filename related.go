@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// relatedHook expands to a list of pages related to the one being exported.
+const relatedHook = "{{related}}"
+
+// maxRelated bounds the related pages listed per page.
+const maxRelated = 5
+
+// Weights of the signals relating two pages.
+const (
+	relatedTagWeight    = 2 // per shared tag
+	relatedLinkWeight   = 3 // per direct link between them
+	relatedSharedWeight = 1 // per page both link to
+)
+
+// relatedPages ranks the pages in docs by how related they are to name:
+// shared tags, direct links either way, and pages both link to. Only pages
+// in the same language are considered; unrelated ones are left out.
+func relatedPages(name string, docs []docMeta) []docMeta {
+	var self docMeta
+	found := false
+	for _, d := range docs {
+		if d.Name == name {
+			self, found = d, true
+		}
+	}
+	if !found {
+		return nil
+	}
+	linksOf := func(d docMeta) map[string]bool {
+		out := map[string]bool{}
+		for _, l := range d.Links {
+			if t := localLinkTarget(l); t != "" {
+				out[strings.ToLower(t)] = true
+			}
+		}
+		return out
+	}
+	tags := map[string]bool{}
+	for _, t := range self.Tags {
+		tags[strings.ToLower(t)] = true
+	}
+	selfLinks := linksOf(self)
+	lang := docLang(self)
+	type scored struct {
+		d     docMeta
+		score int
+	}
+	var ranked []scored
+	for _, d := range docs {
+		if d.Name == name || docLang(d) != lang {
+			continue
+		}
+		score := 0
+		for _, t := range d.Tags {
+			if tags[strings.ToLower(t)] {
+				score += relatedTagWeight
+			}
+		}
+		links := linksOf(d)
+		if selfLinks[strings.ToLower(d.Name)] {
+			score += relatedLinkWeight
+		}
+		if links[strings.ToLower(name)] {
+			score += relatedLinkWeight
+		}
+		for t := range links {
+			if selfLinks[t] && t != strings.ToLower(name) && t != strings.ToLower(d.Name) {
+				score += relatedSharedWeight
+			}
+		}
+		if score > 0 {
+			ranked = append(ranked, scored{d, score})
+		}
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].score != ranked[j].score {
+			return ranked[i].score > ranked[j].score
+		}
+		return strings.ToLower(docTitle(ranked[i].d)) < strings.ToLower(docTitle(ranked[j].d))
+	})
+	if len(ranked) > maxRelated {
+		ranked = ranked[:maxRelated]
+	}
+	out := make([]docMeta, len(ranked))
+	for i, r := range ranked {
+		out[i] = r.d
+	}
+	return out
+}
+
+// relatedInUse reports whether an include or layout expands relatedHook.
+func relatedInUse() bool {
+	found := false
+	for _, dir := range []string{"_includes", layoutsDir} {
+		_ = walkWorkspace(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || found {
+				return nil
+			}
+			if b, err := os.ReadFile(wsPath(path)); err == nil && bytes.Contains(b, []byte(relatedHook)) {
+				found = true
+			}
+			return nil
+		})
+	}
+	return found
+}
+
+// relatedLists returns the names in the related list of every published
+// page, or nil when no page shows one.
+func relatedLists() (map[string][]string, error) {
+	if !relatedInUse() {
+		return nil, nil
+	}
+	docs, err := docIndex.refresh(".")
+	if err != nil {
+		return nil, err
+	}
+	docs = publishedDocs(docs)
+	lists := make(map[string][]string, len(docs))
+	for _, d := range docs {
+		for _, r := range relatedPages(d.Name, docs) {
+			lists[d.Name] = append(lists[d.Name], r.Name)
+		}
+	}
+	return lists, nil
+}
+
+// relatedList renders the related pages of name as a list, or "" if there
+// are none.
+func relatedList(name string) string {
+	docs, err := docIndex.refresh(".")
+	if err != nil {
+		log.Printf("related pages of %s: %v", name, err)
+		return ""
+	}
+	docs = publishedDocs(docs)
+	related := relatedPages(filepath.Base(name), docs)
+	if len(related) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(`<ul class="related">` + "\n")
+	for _, d := range related {
+		fmt.Fprintf(&b, "<li><a href=\"%s\">%s</a></li>\n", html.EscapeString(htmlOutNameFor(d.Name)), html.EscapeString(docTitle(d)))
+	}
+	b.WriteString("</ul>\n")
+	return b.String()
+}
+
+// applyRelated expands {{related}} in a page's header and footer.
+func applyRelated(name string, header, footer []byte) ([]byte, []byte) {
+	hook := []byte(relatedHook)
+	if !bytes.Contains(header, hook) && !bytes.Contains(footer, hook) {
+		return header, footer
+	}
+	list := ""
+	if name != "" {
+		list = relatedList(name)
+	}
+	return bytes.ReplaceAll(header, hook, []byte(list)), bytes.ReplaceAll(footer, hook, []byte(list))
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRelatedPages(t *testing.T) {
+	docs := []docMeta{
+		{Name: "go.md", Title: "Go", Tags: []string{"lang", "Backend"}, Links: []string{"tools.md", "style.html"}},
+		{Name: "rust.md", Title: "Rust", Tags: []string{"lang", "backend"}}, // 2 tags: 4
+		{Name: "tools.md", Title: "Tools"},                                              // linked from go: 3
+		{Name: "style.md", Title: "Style", Links: []string{"go.html"}},                  // links both ways: 6
+		{Name: "lint.md", Title: "Lint", Links: []string{"tools.md#x", "style.md"}},     // shares two targets: 2
+		{Name: "cats.md", Title: "Cats", Tags: []string{"pets"}},                        // unrelated
+		{Name: "go.de.md", Title: "Go (de)", Tags: []string{"lang"}, Lang: "de"},        // other language
+		{Name: "zig.md", Title: "Zig", Tags: []string{"lang"}, Links: []string{"x.md"}}, // 1 tag: 2
+	}
+	var got []string
+	for _, d := range relatedPages("go.md", docs) {
+		got = append(got, d.Name)
+	}
+	want := []string{"style.md", "rust.md", "tools.md", "lint.md", "zig.md"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("related = %v; want %v", got, want)
+	}
+	if r := relatedPages("missing.md", docs); r != nil {
+		t.Fatalf("missing page: %v", r)
+	}
+}
+
+func TestApplyRelated(t *testing.T) {
+	chdirTemp(t)
+	docIndex = &metaIndex{}
+	writeFiles(t, map[string]string{
+		"a.md": "---\ntags: [x]\n---\n# A <1>",
+		"b.md": "---\ntags: [x]\n---\n# B & co",
+		"c.md": "# C",
+	})
+	header, footer := applyRelated("a.md", []byte("<h>"), []byte("<aside>{{related}}</aside>"))
+	want := "<aside><ul class=\"related\">\n<li><a href=\"b.html\">B &amp; co</a></li>\n</ul>\n</aside>"
+	if string(header) != "<h>" || string(footer) != want {
+		t.Fatalf("got %q %q", header, footer)
+	}
+	if _, footer := applyRelated("c.md", nil, []byte("{{related}}")); string(footer) != "" {
+		t.Fatalf("no related pages: %q", footer)
+	}
+	if _, footer := applyRelated("", nil, []byte("{{related}}")); string(footer) != "" {
+		t.Fatalf("unnamed page: %q", footer)
+	}
+}
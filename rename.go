@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type renameResponse struct {
+	File string `json:"file"`
+	HTML string `json:"html"` // the exported filename
+}
+
+// handleRename renames the note `from` to `to`, both basenames given as
+// query params. The caller must hold the lock on from, which moves to the
+// new name along with the undo history and the exported page. An existing
+// note is never overwritten.
+func handleRename(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	from, to := q.Get("from"), q.Get("to")
+	for _, name := range []string{from, to} {
+		if name == "" || filepath.Base(name) != name || !strings.EqualFold(filepath.Ext(name), ".md") {
+			http.Error(w, "invalid filename", http.StatusBadRequest)
+			return
+		}
+	}
+	if from == to {
+		http.Error(w, "from and to are the same", http.StatusBadRequest)
+		return
+	}
+	tok := r.Header.Get("X-Lock")
+	if !hasValidLock(from, tok) {
+		lockedError(w, from)
+		return
+	}
+	src, err := os.Stat(wsPath(from))
+	if os.IsNotExist(err) {
+		http.Error(w, "file not found", http.StatusNotFound)
+		return
+	}
+	// A case-only rename finds the note itself on case-insensitive systems
+	if dst, err := os.Stat(wsPath(to)); err == nil && !os.SameFile(src, dst) {
+		http.Error(w, "target already exists", http.StatusConflict)
+		return
+	}
+	toTok, ok := acquireLock(to)
+	if !ok {
+		http.Error(w, "target is "+lockHolder(to), http.StatusLocked)
+		return
+	}
+	releaseLock(to, toTok)
+
+	if err := moveNote(from, to); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	removeExport(exportDir, htmlOutNameFor(from))
+	docIndex.update(".", from)
+	renameUndo(from, to)
+	renameSnapshots(from, to)
+	transferLock(from, to, tok)
+	outName := afterSave(to)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(renameResponse{File: to, HTML: outName})
+}
+
+// moveNote renames the note from to to. Notes matching an encrypt pattern
+// only under their new name are sealed on the way.
+func moveNote(from, to string) error {
+	if !encryptedNote(to) || encryptedNote(from) {
+		return os.Rename(wsPath(from), wsPath(to))
+	}
+	data, err := readNote(from)
+	if err != nil {
+		return err
+	}
+	sealed, err := sealNote(data, true)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(wsPath(to), sealed, 0644); err != nil {
+		return err
+	}
+	return os.Remove(wsPath(from))
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHandleRename(t *testing.T) {
+	chdirTemp(t)
+	locks = make(map[string]lockInfo)
+	cmarkPath = builtinConverter
+	t.Cleanup(func() { cmarkPath = "" })
+	writeFiles(t, map[string]string{"a.md": "# A\n", "taken.md": "x"})
+	if err := os.Mkdir("docs", 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, map[string]string{filepath.Join("docs", "a.html"): "old"})
+	tok, _ := acquireLock("a.md")
+	pushUndo("a.md", []byte("# Before\n"), []byte("# A\n"))
+
+	rename := func(query, tok string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/rename"+query, nil)
+		req.Header.Set("X-Lock", tok)
+		handleRename(rr, req)
+		return rr
+	}
+	locks["held.md"] = lockInfo{token: "other", expires: time.Now().Add(time.Hour)}
+	for query, code := range map[string]int{
+		"?from=a.md&to=../b.md":    http.StatusBadRequest,
+		"?from=a.md&to=b.txt":      http.StatusBadRequest,
+		"?from=a.md&to=a.md":       http.StatusBadRequest,
+		"?from=missing.md&to=b.md": http.StatusLocked,
+		"?from=a.md&to=taken.md":   http.StatusConflict,
+		"?from=a.md&to=held.md":    http.StatusLocked,
+	} {
+		if rr := rename(query, tok); rr.Code != code {
+			t.Errorf("%s: %d, want %d", query, rr.Code, code)
+		}
+	}
+	if rr := rename("?from=a.md&to=b.md", "wrong"); rr.Code != http.StatusLocked {
+		t.Errorf("wrong token: %d", rr.Code)
+	}
+
+	rr := rename("?from=a.md&to=b.md", tok)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("rename: %d %s", rr.Code, rr.Body.String())
+	}
+	var resp renameResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || resp != (renameResponse{File: "b.md", HTML: "b.html"}) {
+		t.Errorf("response %+v, %v", resp, err)
+	}
+	if b, err := os.ReadFile("b.md"); err != nil || string(b) != "# A\n" {
+		t.Errorf("b.md = %q, %v", b, err)
+	}
+	for _, p := range []string{"a.md", filepath.Join("docs", "a.html")} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s left behind", p)
+		}
+	}
+	if _, err := os.Stat(filepath.Join("docs", "b.html")); err != nil {
+		t.Errorf("export not moved: %v", err)
+	}
+	if !hasValidLock("b.md", tok) || hasValidLock("a.md", tok) {
+		t.Errorf("lock not transferred: %v", locks)
+	}
+	if prev, ok := popUndo("b.md"); !ok || string(prev) != "# Before\n" {
+		t.Errorf("undo history %q %v", prev, ok)
+	}
+
+	tok, _ = acquireLock("missing.md")
+	if rr := rename("?from=missing.md&to=c.md", tok); rr.Code != http.StatusNotFound {
+		t.Errorf("missing note: %d", rr.Code)
+	}
+}
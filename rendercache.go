@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// renderCacheDir keeps cmark-gfm output keyed by its input, so re-exports
+// of unchanged pages, such as those triggered by navigation or series
+// changes elsewhere, skip running the converter. Only exported notes are
+// cached: pages rendered on request may be decrypted or unsaved notes,
+// which must not be left on disk.
+var renderCacheDir = filepath.Join(".minimark", "render")
+
+// renderCacheVersion is part of every key; bump it when the way cmark-gfm
+// is run changes.
+const renderCacheVersion = 2
+
+var (
+	renderUsedMu sync.Mutex
+	renderUsed   = map[string]bool{} // cache entries read or written since startup
+)
+
+// renderKey identifies the output of cmark for md: the converter command,
+// the size and mtime of the program it runs, its arguments, and the
+// Markdown after shortcode expansion, which already holds any included
+// source files.
+func renderKey(cmark string, md []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "minimark render %d\n%s\n%q\n", renderCacheVersion, cmark, converterArgs())
+	if info, err := os.Stat(wsPath(converterProgram(cmark))); err == nil {
+		fmt.Fprintf(h, "%d %d\n", info.Size(), info.ModTime().UnixNano())
+	}
+	h.Write(md)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cmarkRender converts md with cmark. With cached set it reuses a cached
+// result when the converter and input are unchanged. The built-in renderer
+// is fast enough not to need the cache.
+func cmarkRender(cmark string, md []byte, cached bool) ([]byte, error) {
+	if cmark == builtinConverter {
+		return renderMarkdown(md), nil
+	}
+	if !cached {
+		return runConverter(cmark, md)
+	}
+	key := renderKey(cmark, md)
+	file := filepath.Join(renderCacheDir, key+".html")
+	renderUsedMu.Lock()
+	renderUsed[key] = true
+	renderUsedMu.Unlock()
+	if b, err := os.ReadFile(wsPath(file)); err == nil {
+		return b, nil
+	}
+	body, err := runConverter(cmark, md)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(wsPath(renderCacheDir), 0755); err == nil {
+		_ = os.WriteFile(wsPath(file), body, 0644)
+	}
+	return body, nil
+}
+
+// pruneRenderCache removes cached renders not used since startup. It runs
+// after a full export, when every current page has been rendered.
+func pruneRenderCache() {
+	entries, err := os.ReadDir(wsPath(renderCacheDir))
+	if err != nil {
+		return
+	}
+	renderUsedMu.Lock()
+	defer renderUsedMu.Unlock()
+	for _, e := range entries {
+		if key := strings.TrimSuffix(e.Name(), ".html"); !renderUsed[key] {
+			if err := os.Remove(wsPath(filepath.Join(renderCacheDir, e.Name()))); err != nil {
+				log.Printf("render cache: %v", err)
+			}
+		}
+	}
+}
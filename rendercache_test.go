@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCmarkRender_Cache(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows")
+	}
+	dir := chdirTemp(t)
+	// The fake converter wraps its input and counts its runs
+	cmark := filepath.Join(t.TempDir(), "cmark-gfm")
+	script := "#!/bin/sh\necho run >> " + filepath.Join(dir, "runs") + "\nwhile IFS= read -r line; do printf '<p>%s</p>\\n' \"$line\"; done\n"
+	if err := os.WriteFile(cmark, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	runs := func() int {
+		b, _ := os.ReadFile(filepath.Join(dir, "runs"))
+		return strings.Count(string(b), "run")
+	}
+	for i := 0; i < 2; i++ {
+		out, err := cmarkRender(cmark, []byte("hello\n"), true)
+		if err != nil || string(out) != "<p>hello</p>\n" {
+			t.Fatalf("out = %q, %v", out, err)
+		}
+	}
+	if runs() != 1 {
+		t.Fatalf("converter ran %d times", runs())
+	}
+	if _, err := cmarkRender(cmark, []byte("other\n"), true); err != nil || runs() != 2 {
+		t.Fatalf("new input: %d runs, %v", runs(), err)
+	}
+
+	// Entries not used since startup are pruned
+	stale := filepath.Join(renderCacheDir, strings.Repeat("0", 64)+".html")
+	if err := os.WriteFile(stale, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pruneRenderCache()
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Fatalf("stale entry kept: %v", err)
+	}
+	if entries, _ := os.ReadDir(renderCacheDir); len(entries) != 2 {
+		t.Fatalf("cache has %d entries", len(entries))
+	}
+}
+
+func TestRenderPageAs_LeavesNoCache(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows")
+	}
+	chdirTemp(t)
+	cmark := filepath.Join(t.TempDir(), "cmark-gfm")
+	if err := os.WriteFile(cmark, []byte("#!/bin/sh\ncat\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Pages rendered on request may be decrypted notes
+	if _, err := renderPageAs(cmark, "secret.md", []byte("top secret\n")); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err := os.ReadDir(renderCacheDir); err == nil && len(entries) > 0 {
+		t.Fatalf("cache has %d entries", len(entries))
+	}
+}
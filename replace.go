@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// replaceRequest is the JSON body accepted by POST /replace.
+type replaceRequest struct {
+	Pattern     string   `json:"pattern"`
+	Replacement string   `json:"replacement"`
+	Regex       bool     `json:"regex"`   // treat pattern as a Go regexp; replacement may use $1
+	Files       []string `json:"files"`   // explicit files; overrides glob
+	Glob        string   `json:"glob"`    // file glob, default "*.md"
+	DryRun      bool     `json:"dry_run"` // only report what would change
+}
+
+type replaceResponse struct {
+	DryRun bool            `json:"dry_run"`
+	Files  []replaceResult `json:"files"`
+}
+
+type replaceResult struct {
+	File     string           `json:"file"`
+	Matches  int              `json:"matches"`
+	Previews []replacePreview `json:"previews,omitempty"`
+	Error    string           `json:"error,omitempty"`
+}
+
+type replacePreview struct {
+	Line   int    `json:"line"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// maxReplacePreviews bounds the previews reported per file.
+const maxReplacePreviews = 5
+
+// handleReplace performs a search-and-replace across markdown files. With
+// dry_run it only reports per-file matches and previews; otherwise it locks,
+// rewrites, and re-exports each changed file. Files locked by an editor are
+// skipped and reported with an error.
+func handleReplace(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req replaceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Pattern == "" {
+		http.Error(w, "missing pattern", http.StatusBadRequest)
+		return
+	}
+	replace, err := newReplacer(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	files, err := replaceScope(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	results := []replaceResult{}
+	for _, name := range files {
+		res := replaceResult{File: name}
+		b, err := readNote(name)
+		if err != nil {
+			res.Error = err.Error()
+			results = append(results, res)
+			continue
+		}
+		content := string(b)
+		updated, n := replace(content)
+		if n == 0 {
+			continue
+		}
+		res.Matches = n
+		res.Previews = replacePreviews(content, replace)
+		if !req.DryRun {
+			if err := rewriteLocked(name, b, []byte(updated)); err != nil {
+				res.Error = err.Error()
+			}
+		}
+		results = append(results, res)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(replaceResponse{DryRun: req.DryRun, Files: results})
+}
+
+// newReplacer returns a function that applies the replacement to a string
+// and reports how many matches it replaced.
+func newReplacer(req replaceRequest) (func(string) (string, int), error) {
+	if !req.Regex {
+		return func(s string) (string, int) {
+			n := strings.Count(s, req.Pattern)
+			if n == 0 {
+				return s, 0
+			}
+			return strings.ReplaceAll(s, req.Pattern, req.Replacement), n
+		}, nil
+	}
+	re, err := regexp.Compile(req.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex: %w", err)
+	}
+	return func(s string) (string, int) {
+		n := len(re.FindAllStringIndex(s, -1))
+		if n == 0 {
+			return s, 0
+		}
+		return re.ReplaceAllString(s, req.Replacement), n
+	}, nil
+}
+
+// replaceScope resolves the files a replace request applies to.
+func replaceScope(req replaceRequest) ([]string, error) {
+	if len(req.Files) > 0 {
+		for _, f := range req.Files {
+			if filepath.Base(f) != f || !strings.EqualFold(filepath.Ext(f), ".md") {
+				return nil, fmt.Errorf("invalid filename %q", f)
+			}
+		}
+		return req.Files, nil
+	}
+	glob := req.Glob
+	if glob == "" {
+		glob = "*.md"
+	}
+	if _, err := filepath.Match(glob, ""); err != nil {
+		return nil, fmt.Errorf("invalid glob %q", glob)
+	}
+	all, err := docIndex.listing(".")
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, name := range all {
+		if ok, _ := filepath.Match(glob, name); ok {
+			files = append(files, name)
+		}
+	}
+	return files, nil
+}
+
+// replacePreviews returns before/after pairs for the first lines of content
+// that the replacement changes.
+func replacePreviews(content string, replace func(string) (string, int)) []replacePreview {
+	var out []replacePreview
+	for i, line := range strings.Split(content, "\n") {
+		if after, n := replace(line); n > 0 && after != line {
+			out = append(out, replacePreview{Line: i + 1, Before: line, After: after})
+			if len(out) == maxReplacePreviews {
+				break
+			}
+		}
+	}
+	return out
+}
+
+// rewriteLocked replaces the content of name while holding its lock, records
+// the previous content for undo, and re-exports the file.
+func rewriteLocked(name string, prev, data []byte) error {
+	tok, ok := acquireLock(name)
+	if !ok {
+		return fmt.Errorf("file is locked by another editor")
+	}
+	defer releaseLock(name, tok)
+	if err := writeNote(name, data); err != nil {
+		return err
+	}
+	pushUndo(name, prev, data)
+	afterSave(name)
+	return nil
+}
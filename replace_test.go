@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func postReplace(t *testing.T, body string) (int, replaceResponse) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	handleReplace(rr, httptest.NewRequest(http.MethodPost, "/replace", strings.NewReader(body)))
+	var resp replaceResponse
+	if rr.Code == http.StatusOK {
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rr.Code, resp
+}
+
+func TestHandleReplace_DryRunAndApply(t *testing.T) {
+	chdirTemp(t)
+	locks = make(map[string]lockInfo)
+	files := map[string]string{
+		"a.md":     "Acme rocks\nno match\nAcme and Acme\n",
+		"b.md":     "nothing here\n",
+		"c.txt.md": "Acme\n",
+	}
+	for name, body := range files {
+		if err := os.WriteFile(name, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	code, resp := postReplace(t, `{"pattern":"Acme","replacement":"Globex","glob":"a*","dry_run":true}`)
+	if code != http.StatusOK || len(resp.Files) != 1 {
+		t.Fatalf("dry run = %d %+v", code, resp)
+	}
+	res := resp.Files[0]
+	if res.File != "a.md" || res.Matches != 3 || len(res.Previews) != 2 || res.Previews[1].Line != 3 || res.Previews[1].After != "Globex and Globex" {
+		t.Fatalf("result = %+v", res)
+	}
+	if b, _ := os.ReadFile("a.md"); string(b) != files["a.md"] {
+		t.Fatalf("dry run must not write")
+	}
+
+	// Apply with a regex; c.txt.md is locked by an editor and skipped
+	locks["c.txt.md"] = lockInfo{token: "other", expires: time.Now().Add(time.Hour)}
+	code, resp = postReplace(t, `{"pattern":"Ac(me)","replacement":"X$1","regex":true}`)
+	if code != http.StatusOK || len(resp.Files) != 2 {
+		t.Fatalf("apply = %d %+v", code, resp)
+	}
+	if b, _ := os.ReadFile("a.md"); string(b) != "Xme rocks\nno match\nXme and Xme\n" {
+		t.Fatalf("a.md = %q", string(b))
+	}
+	if resp.Files[1].File != "c.txt.md" || resp.Files[1].Error == "" {
+		t.Fatalf("locked file should report error: %+v", resp.Files[1])
+	}
+	if b, _ := os.ReadFile("c.txt.md"); string(b) != "Acme\n" {
+		t.Fatalf("locked file must not change")
+	}
+	if _, ok := locks["a.md"]; ok {
+		t.Fatalf("server lock should be released")
+	}
+}
+
+func TestHandleReplace_Errors(t *testing.T) {
+	chdirTemp(t)
+	rr := httptest.NewRecorder()
+	handleReplace(rr, httptest.NewRequest(http.MethodGet, "/replace", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("got %d", rr.Code)
+	}
+	for _, body := range []string{
+		`{`,
+		`{"pattern":""}`,
+		`{"pattern":"(","regex":true}`,
+		`{"pattern":"x","files":["../a.md"]}`,
+		`{"pattern":"x","glob":"["}`,
+	} {
+		if code, _ := postReplace(t, body); code != http.StatusBadRequest {
+			t.Errorf("%s = %d; want 400", body, code)
+		}
+	}
+}
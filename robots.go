@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// robotsDirectiveRe matches one robots directive, such as "noindex" or
+// "max-snippet:50".
+var robotsDirectiveRe = regexp.MustCompile(`^[a-z][a-z-]*(:\s*[a-z0-9_-]+)?$`)
+
+// pageRobots returns the normalized robots: front matter of the page md,
+// e.g. "noindex, nofollow", or "" when it has none. Malformed directives
+// are logged and dropped.
+func pageRobots(md []byte) string {
+	fields, _ := parseFrontMatter(md)
+	return normalizeRobots(fields["robots"])
+}
+
+func normalizeRobots(v string) string {
+	var out []string
+	for _, d := range strings.Split(v, ",") {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if d == "" {
+			continue
+		}
+		if !robotsDirectiveRe.MatchString(d) {
+			log.Printf("ignoring robots directive %q", d)
+			continue
+		}
+		out = append(out, d)
+	}
+	return strings.Join(out, ", ")
+}
+
+// robotsNoIndex reports whether robots keeps a page out of search results.
+func robotsNoIndex(robots string) bool {
+	for _, d := range strings.Split(robots, ", ") {
+		if d == "noindex" || d == "none" {
+			return true
+		}
+	}
+	return false
+}
+
+// applyRobots adds a robots meta tag for page md's robots: front matter to
+// its header, before </head> or at the start when there is none.
+func applyRobots(md, header []byte) []byte {
+	robots := pageRobots(md)
+	if robots == "" {
+		return header
+	}
+	tag := fmt.Sprintf(`<meta name="robots" content="%s">`+"\n", html.EscapeString(robots))
+	if h := insertBeforeTag(header, "</head>", tag); len(h) > len(header) {
+		return h
+	}
+	return append([]byte(tag), header...)
+}
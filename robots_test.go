@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeRobots(t *testing.T) {
+	cases := map[string]string{
+		"":                           "",
+		"noindex, nofollow":          "noindex, nofollow",
+		" NoIndex ,, max-snippet:50": "noindex, max-snippet:50",
+		`noindex, "><script>`:        "noindex",
+	}
+	for in, want := range cases {
+		if got := normalizeRobots(in); got != want {
+			t.Errorf("normalizeRobots(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if !robotsNoIndex("nofollow, noindex") || !robotsNoIndex("none") || robotsNoIndex("nofollow") {
+		t.Error("robotsNoIndex misreads directives")
+	}
+}
+
+func TestApplyRobots(t *testing.T) {
+	md := []byte("---\nrobots: noindex, nofollow\n---\n# Draft\n")
+	tag := `<meta name="robots" content="noindex, nofollow">` + "\n"
+	if got := string(applyRobots(md, []byte("<html><head><title>x</title></head><body>"))); !strings.Contains(got, tag+"</head>") {
+		t.Errorf("tag not in head: %q", got)
+	}
+	if got := string(applyRobots(md, nil)); got != tag {
+		t.Errorf("without a header got %q", got)
+	}
+	if got := string(applyRobots([]byte("# Public\n"), []byte("<head></head>"))); got != "<head></head>" {
+		t.Errorf("page without robots changed: %q", got)
+	}
+}
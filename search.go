@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// searchLimit is how many results /search returns unless asked for fewer;
+// maxSearchLimit bounds what may be asked for.
+const (
+	searchLimit    = 20
+	maxSearchLimit = 200
+)
+
+// snippetRadius is about how much text a search snippet shows on each side
+// of the match.
+const snippetRadius = 60
+
+// searchTitleWeight is what a match in the title or file name counts for,
+// against one for each match in the body.
+const searchTitleWeight = 10
+
+// searchResult is one note in the /search response.
+type searchResult struct {
+	File    string `json:"file"`
+	Title   string `json:"title"`
+	Snippet string `json:"snippet"`        // text around the first match in the body
+	Line    int    `json:"line,omitempty"` // line of that match, from 1
+	Matches int    `json:"matches"`
+}
+
+// searchTerms splits q into words and "quoted phrases", matched without
+// regard to case.
+func searchTerms(q string) []*regexp.Regexp {
+	var terms []*regexp.Regexp
+	for i, part := range strings.Split(q, `"`) {
+		words := []string{strings.TrimSpace(part)}
+		if i%2 == 0 {
+			words = strings.Fields(part)
+		}
+		for _, w := range words {
+			if w != "" {
+				terms = append(terms, regexp.MustCompile(`(?i)`+regexp.QuoteMeta(w)))
+			}
+		}
+	}
+	return terms
+}
+
+// searchNote matches terms against the note name with the given title and
+// content md. Every term must occur in the file name, title, or body; ok is
+// false otherwise.
+func searchNote(name, title string, md []byte, terms []*regexp.Regexp) (searchResult, bool) {
+	_, body := parseFrontMatter(md)
+	res := searchResult{File: name, Title: title}
+	first := -1
+	for _, re := range terms {
+		head := len(re.FindAllStringIndex(title, -1)) + len(re.FindAllStringIndex(name, -1))
+		hits := re.FindAllIndex(body, -1)
+		if head == 0 && len(hits) == 0 {
+			return searchResult{}, false
+		}
+		res.Matches += head*searchTitleWeight + len(hits)
+		if len(hits) > 0 && (first < 0 || hits[0][0] < first) {
+			first = hits[0][0]
+		}
+	}
+	if first >= 0 {
+		res.Snippet = snippet(body, first)
+		res.Line = bytes.Count(md[:len(md)-len(body)+first], []byte("\n")) + 1
+	} else {
+		res.Snippet = snippet(body, 0)
+	}
+	return res, true
+}
+
+// snippet returns the text of body around offset at, on one line, with an
+// ellipsis where it was cut.
+func snippet(body []byte, at int) string {
+	start, end := max(at-snippetRadius, 0), min(at+snippetRadius, len(body))
+	for start > 0 && !utf8.RuneStart(body[start]) {
+		start--
+	}
+	for end < len(body) && !utf8.RuneStart(body[end]) {
+		end++
+	}
+	// Cut at word boundaries, unless a word fills the whole side
+	if start > 0 {
+		if i := bytes.IndexAny(body[start:at], " \t\r\n"); i >= 0 {
+			start += i + 1
+		}
+	}
+	if end < len(body) {
+		if i := bytes.LastIndexAny(body[at:end], " \t\r\n"); i > 0 {
+			end = at + i
+		}
+	}
+	s := strings.Join(strings.Fields(string(body[start:end])), " ")
+	if start > 0 {
+		s = "…" + s
+	}
+	if end < len(body) {
+		s += "…"
+	}
+	return s
+}
+
+// handleSearch finds the notes matching `q`, best first: every word or
+// "quoted phrase" in q must occur in the note, and matches in its title or
+// file name count most. Notes are matched in the metadata index, which
+// keeps their content in memory; encrypted notes are kept out of it, so they are read
+// and searched only while their key is loaded. `limit` caps the results.
+func handleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	terms := searchTerms(q.Get("q"))
+	if len(terms) == 0 {
+		http.Error(w, "missing q", http.StatusBadRequest)
+		return
+	}
+	limit := searchLimit
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxSearchLimit)
+	}
+	docs, err := docIndex.refreshContent(".")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	results := []searchResult{}
+	for _, d := range docs {
+		md, title := []byte(d.Content), d.Title
+		if d.Encrypted {
+			if md, err = readNote(d.Name); err != nil {
+				continue
+			}
+			title = pageTitle(md)
+		}
+		if res, ok := searchNote(d.Name, title, md, terms); ok {
+			results = append(results, res)
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Matches > results[j].Matches })
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(results)))
+	_ = json.NewEncoder(w).Encode(results[:min(len(results), limit)])
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSearchTerms(t *testing.T) {
+	var got []string
+	for _, re := range searchTerms(`  release "Next Week" notes.md `) {
+		got = append(got, re.String())
+	}
+	want := []string{`(?i)release`, `(?i)Next Week`, `(?i)notes\.md`}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("terms = %q", got)
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	body := []byte(strings.Repeat("lorem ipsum ", 20) + "the needle\nis  here " + strings.Repeat("dolor sit ", 20))
+	at := strings.Index(string(body), "needle")
+	s := snippet(body, at)
+	if !strings.HasPrefix(s, "…") || !strings.HasSuffix(s, "…") || !strings.Contains(s, "the needle is here") {
+		t.Errorf("snippet = %q", s)
+	}
+	if !strings.HasPrefix(s, "…lorem ") && !strings.HasPrefix(s, "…ipsum ") || !strings.HasSuffix(s, " dolor…") && !strings.HasSuffix(s, " sit…") {
+		t.Errorf("snippet cuts a word: %q", s)
+	}
+	if s := snippet([]byte("short note"), 6); s != "short note" {
+		t.Errorf("short snippet = %q", s)
+	}
+	// Cuts never split a rune
+	if s := snippet([]byte(strings.Repeat("é", 100)), 100); !strings.HasPrefix(s, "…é") {
+		t.Errorf("rune snippet = %q", s)
+	}
+}
+
+func searchFor(t *testing.T, query string) ([]searchResult, *httptest.ResponseRecorder) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	handleSearch(rr, httptest.NewRequest(http.MethodGet, "/search?"+query, nil))
+	var res []searchResult
+	if rr.Code == http.StatusOK {
+		if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return res, rr
+}
+
+func TestHandleSearch(t *testing.T) {
+	chdirTemp(t)
+	writeFiles(t, map[string]string{
+		"garden.md":  "---\ntitle: Garden Plans\n---\nPlant tomatoes in May.\nWater the garden daily.\n",
+		"recipes.md": "# Recipes\n\nTomato soup needs ripe tomatoes from the garden.\n",
+		"work.md":    "# Work\n\nQuarterly plans.\n",
+		"notes.txt":  "tomatoes",
+	})
+
+	res, _ := searchFor(t, "q=tomato")
+	if len(res) != 2 {
+		t.Fatalf("results = %+v", res)
+	}
+	// Two body matches beat one
+	if res[0].File != "recipes.md" || res[0].Title != "Recipes" || res[0].Matches != 2 || res[0].Line != 3 {
+		t.Errorf("first = %+v", res[0])
+	}
+	if res[1].File != "garden.md" || res[1].Title != "Garden Plans" || res[1].Line != 4 || res[1].Snippet != "Plant tomatoes in May. Water the garden daily." {
+		t.Errorf("second = %+v", res[1])
+	}
+
+	// A title match ranks first; every term must match
+	res, _ = searchFor(t, "q="+url.QueryEscape("garden"))
+	if len(res) != 2 || res[0].File != "garden.md" {
+		t.Errorf("garden = %+v", res)
+	}
+	res, _ = searchFor(t, "q="+url.QueryEscape("garden soup"))
+	if len(res) != 1 || res[0].File != "recipes.md" {
+		t.Errorf("garden soup = %+v", res)
+	}
+	res, _ = searchFor(t, "q="+url.QueryEscape(`"soup needs"`))
+	if len(res) != 1 || res[0].File != "recipes.md" {
+		t.Errorf("phrase = %+v", res)
+	}
+	if res, _ = searchFor(t, "q="+url.QueryEscape(`"needs soup"`)); len(res) != 0 {
+		t.Errorf("phrase out of order = %+v", res)
+	}
+
+	// A file name match alone is enough; the snippet is the start of the note
+	res, _ = searchFor(t, "q=work.md")
+	if len(res) != 1 || res[0].Line != 0 || res[0].Snippet != "# Work Quarterly plans." {
+		t.Errorf("file name = %+v", res)
+	}
+
+	res, rr := searchFor(t, "q=tomato&limit=1")
+	if len(res) != 1 || rr.Header().Get("X-Total-Count") != "2" {
+		t.Errorf("limit = %+v, total %q", res, rr.Header().Get("X-Total-Count"))
+	}
+	if res, _ := searchFor(t, "q=zucchini"); res == nil || len(res) != 0 {
+		t.Errorf("no match = %#v", res)
+	}
+}
+
+func TestHandleSearch_Index(t *testing.T) {
+	chdirTemp(t)
+	docIndex = &metaIndex{}
+	withNoteSecret(t, "key")
+	sealed, err := sealNote([]byte("# Diary\n\nTomatoes again.\n"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, map[string]string{"plain.md": "# Plain\n\nTomatoes.\n", "diary.md": string(sealed)})
+
+	// Search reads the index, which holds plain notes in memory but not
+	// encrypted ones, and persists neither
+	res, _ := searchFor(t, "q=tomatoes")
+	if len(res) != 2 || res[0].Title != "Diary" && res[1].Title != "Diary" {
+		t.Fatalf("results = %+v", res)
+	}
+	if d := docIndex.docs["plain.md"]; !strings.Contains(d.Content, "Tomatoes.") {
+		t.Errorf("plain.md = %+v", d)
+	}
+	b, err := os.ReadFile(indexPath)
+	if err != nil || strings.Contains(string(b), "Tomatoes") || strings.Contains(string(b), "again") {
+		t.Errorf("index = %s, %v", b, err)
+	}
+
+	// Without the key, encrypted notes are left out
+	noteSecret = nil
+	if res, _ := searchFor(t, "q=tomatoes"); len(res) != 1 || res[0].File != "plain.md" {
+		t.Errorf("without key = %+v", res)
+	}
+}
+
+func TestHandleSearch_BadRequests(t *testing.T) {
+	chdirTemp(t)
+	for _, q := range []string{"", "q=", "q=%20%22%22", "q=a&limit=0", "q=a&limit=x"} {
+		if _, rr := searchFor(t, q); rr.Code != http.StatusBadRequest {
+			t.Errorf("%q = %d", q, rr.Code)
+		}
+	}
+	rr := httptest.NewRecorder()
+	handleSearch(rr, httptest.NewRequest(http.MethodPost, "/search?q=a", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST = %d", rr.Code)
+	}
+}
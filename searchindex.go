@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// searchIndexFile is the client-side search index written to the docs root.
+const searchIndexFile = "search-index.json"
+
+// searchDoc is one page in the search index. The index is a plain array
+// of these, which lunr (with ref "url") and Fuse.js both load as is.
+type searchDoc struct {
+	URL      string   `json:"url"` // the page, relative to docs
+	Title    string   `json:"title"`
+	Headings []string `json:"headings"`
+	Tags     []string `json:"tags,omitempty"`
+	Lang     string   `json:"lang,omitempty"`
+	Body     string   `json:"body"`
+}
+
+// mdBlockMarkerRe matches the quote, list and task markers starting a line.
+var mdBlockMarkerRe = regexp.MustCompile(`^ {0,3}(?:>[ \t]*)*(?:[-*+][ \t]+|\d+[.)][ \t]+)?(?:\[[ xX]\][ \t]+)?`)
+
+// markdownPlainText returns the prose of the Markdown body md on one line:
+// ATX headings, fenced code, rules, link definitions, shortcodes, HTML tags
+// and link targets are left out, and the text of links and emphasis is kept.
+func markdownPlainText(md []byte) string {
+	var words []string
+	fence := ""
+	for _, line := range strings.Split(string(md), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if fence != "" {
+			if strings.HasPrefix(strings.TrimSpace(line), fence) {
+				fence = ""
+			}
+			continue
+		}
+		if m := fenceRe.FindStringSubmatch(line); m != nil {
+			fence = m[1]
+			continue
+		}
+		if atxHeadingRe.MatchString(line) || mdRuleRe.MatchString(line) || mdSetextRe.MatchString(line) ||
+			mdRefDefRe.MatchString(line) || mdTableSepRe.MatchString(line) {
+			continue
+		}
+		line = mdBlockMarkerRe.ReplaceAllString(line, "")
+		line = shortcodeRe.ReplaceAllString(line, "")
+		line = mdImageRe.ReplaceAllString(line, "")
+		line = mdInlineLinkRe.ReplaceAllString(line, "$1")
+		line = anyTagRe.ReplaceAllString(line, "")
+		line = strings.ReplaceAll(mdEmphasisRe.ReplaceAllString(line, ""), "|", " ")
+		words = append(words, strings.Fields(line)...)
+	}
+	return strings.Join(words, " ")
+}
+
+// searchIndexEntry describes the published page d for the search index. It
+// returns false for pages that opt out with search_exclude:, are marked
+// noindex by robots:, or are password-protected.
+func searchIndexEntry(d docMeta) (searchDoc, bool) {
+	md, err := readNote(d.Name)
+	if err != nil {
+		return searchDoc{}, false
+	}
+	fields, body := parseFrontMatter(md)
+	if exclude, _ := strconv.ParseBool(fields["search_exclude"]); exclude || robotsNoIndex(normalizeRobots(fields["robots"])) || fields["password"] != "" {
+		return searchDoc{}, false
+	}
+	sd := searchDoc{URL: htmlOutNameFor(d.Name), Title: d.Title, Headings: []string{}, Tags: d.Tags, Lang: d.Lang, Body: markdownPlainText(body)}
+	if sd.Title == "" {
+		sd.Title = strings.TrimSuffix(d.Name, filepath.Ext(d.Name))
+	}
+	for _, h := range parseHeadings(md) {
+		if t := strings.TrimSpace(mdEmphasisRe.ReplaceAllString(mdInlineLinkRe.ReplaceAllString(h.Text, "$1"), "")); t != "" {
+			sd.Headings = append(sd.Headings, t)
+		}
+	}
+	return sd, true
+}
+
+// writeSearchIndex writes docs/search-index.json with the title, headings
+// and text of every published page, so the exported site can offer search
+// without a server.
+func writeSearchIndex(docsDir string) {
+	docs, err := docIndex.refresh(".")
+	if err != nil {
+		log.Printf("search index not written: %v", err)
+		return
+	}
+	index := []searchDoc{}
+	for _, d := range publishedDocs(docs) {
+		if sd, ok := searchIndexEntry(d); ok {
+			index = append(index, sd)
+		}
+	}
+	b, err := json.Marshal(index)
+	if err == nil {
+		err = os.WriteFile(wsPath(filepath.Join(docsDir, searchIndexFile)), append(b, '\n'), 0644)
+	}
+	if err != nil {
+		log.Printf("search index not written: %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMarkdownPlainText(t *testing.T) {
+	md := "# Title\n\nSome **bold** and [a link](x.html) ![pic](p.png).\n\n" +
+		"- item one\n1. item two\n> quoted <em>text</em>\n- [x] done\n\n" +
+		"```go\ncode()\n```\n\n| a | b |\n|---|---|\n| c | d |\n\n---\n\n" +
+		"Setext\n======\n\n[ref]: https://example.com\n{{youtube id=abc}}\n"
+	want := "Some bold and a link . item one item two quoted text done a b c d Setext"
+	if got := markdownPlainText([]byte(md)); got != want {
+		t.Errorf("plain text =\n%q, want\n%q", got, want)
+	}
+}
+
+func TestWriteSearchIndex(t *testing.T) {
+	chdirTemp(t)
+	docIndex = &metaIndex{}
+	writeFiles(t, map[string]string{
+		"guide.md":    "---\ntitle: The Guide\ntags: [help, docs]\nlang: en\n---\n# Start *here*\n\nRead this first.\n\n## Install\n\nRun the [installer](setup.html).\n",
+		"untitled.md": "Just text.\n",
+		"draft.md":    "---\ndraft: true\n---\n# Draft\n",
+		"private.md":  "---\nprivate: true\n---\n# Private\n",
+		"hidden.md":   "---\nsearch_exclude: true\n---\n# Hidden\n",
+		"noindex.md":  "---\nrobots: noindex\n---\n# Draft\n",
+		"locked.md":   "---\npassword: hunter2\n---\n# Locked\n",
+	})
+	os.MkdirAll("docs", 0755)
+
+	writeSearchIndex("docs")
+	b, err := os.ReadFile(filepath.Join("docs", searchIndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index []searchDoc
+	if err := json.Unmarshal(b, &index); err != nil {
+		t.Fatal(err)
+	}
+	if len(index) != 2 {
+		t.Fatalf("index = %+v", index)
+	}
+	g := index[0]
+	if g.URL != "guide.html" || g.Title != "The Guide" || g.Lang != "en" || len(g.Tags) != 2 ||
+		len(g.Headings) != 2 || g.Headings[0] != "Start here" || g.Headings[1] != "Install" ||
+		g.Body != "Read this first. Run the installer." {
+		t.Errorf("guide = %+v", g)
+	}
+	if u := index[1]; u.URL != "untitled.html" || u.Title != "untitled" || u.Headings == nil || u.Body != "Just text." {
+		t.Errorf("untitled = %+v", u)
+	}
+}
+
+func TestWriteSearchIndex_Empty(t *testing.T) {
+	chdirTemp(t)
+	docIndex = &metaIndex{}
+	os.MkdirAll("docs", 0755)
+	writeSearchIndex("docs")
+	if b, err := os.ReadFile(filepath.Join("docs", searchIndexFile)); err != nil || string(b) != "[]\n" {
+		t.Errorf("empty index = %q, %v", b, err)
+	}
+}
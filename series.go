@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// seriesDir is where the series index pages go inside docs.
+const seriesDir = "series"
+
+// seriesHook marks where a series member's part navigation goes; without it
+// the navigation follows the content.
+const seriesHook = "{{series}}"
+
+// seriesMembers returns the pages of series in docs in reading order: by
+// series_part, then pages without a part by date and title.
+func seriesMembers(docs []docMeta, series string) []docMeta {
+	var members []docMeta
+	for _, d := range docs {
+		if d.Series != "" && strings.EqualFold(d.Series, series) {
+			members = append(members, d)
+		}
+	}
+	sort.SliceStable(members, func(i, j int) bool {
+		a, b := members[i], members[j]
+		if (a.SeriesPart > 0) != (b.SeriesPart > 0) {
+			return a.SeriesPart > 0
+		}
+		if a.SeriesPart != b.SeriesPart {
+			return a.SeriesPart < b.SeriesPart
+		}
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		return strings.ToLower(docTitle(a)) < strings.ToLower(docTitle(b))
+	})
+	return members
+}
+
+// seriesURL returns the index page of series, relative to the docs root.
+func seriesURL(series string) string {
+	slug := strings.Trim(slugify(series), "-")
+	if slug == "" {
+		slug = "series"
+	}
+	return seriesDir + "/" + slug + "/index.html"
+}
+
+// partNumber is the part shown for the member at index i.
+func partNumber(d docMeta, i int) int {
+	if d.SeriesPart > 0 {
+		return d.SeriesPart
+	}
+	return i + 1
+}
+
+// seriesNav renders the part navigation for the page exported from name,
+// or "" when it is not part of a series.
+func seriesNav(name string) string {
+	docs, err := docIndex.refresh(".")
+	if err != nil {
+		log.Printf("series navigation of %s: %v", name, err)
+		return ""
+	}
+	docs = publishedDocs(docs)
+	base := filepath.Base(name)
+	var series string
+	for _, d := range docs {
+		if d.Name == base {
+			series = d.Series
+		}
+	}
+	if series == "" {
+		return ""
+	}
+	members := seriesMembers(docs, series)
+	at := -1
+	for i, d := range members {
+		if d.Name == base {
+			at = i
+		}
+	}
+	link := func(rel, arrow string, i int) string {
+		d := members[i]
+		label := fmt.Sprintf("Part %d: %s", partNumber(d, i), docTitle(d))
+		if rel == "prev" {
+			label = arrow + " " + label
+		} else {
+			label += " " + arrow
+		}
+		return fmt.Sprintf(`<a rel="%s" href="%s">%s</a>`, rel, html.EscapeString(htmlOutNameFor(d.Name)), html.EscapeString(label))
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, `<nav class="series-nav" aria-label="Series"><p><a href="%s">%s</a>, part %d of %d</p>`,
+		html.EscapeString(seriesURL(series)), html.EscapeString(members[0].Series), partNumber(members[at], at), len(members))
+	if at > 0 {
+		b.WriteString(link("prev", "←", at-1))
+	}
+	if at < len(members)-1 {
+		b.WriteString(link("next", "→", at+1))
+	}
+	b.WriteString("</nav>\n")
+	return b.String()
+}
+
+// applySeries adds the part navigation of the page exported from name at
+// the {{series}} hook, or after the content.
+func applySeries(name string, header, footer, body []byte) ([]byte, []byte, []byte) {
+	nav := ""
+	if name != "" {
+		nav = seriesNav(name)
+	}
+	hook := []byte(seriesHook)
+	if bytes.Contains(header, hook) || bytes.Contains(footer, hook) {
+		return bytes.ReplaceAll(header, hook, []byte(nav)), bytes.ReplaceAll(footer, hook, []byte(nav)), body
+	}
+	return header, footer, append(body, nav...)
+}
+
+// exportSeriesMembers re-exports the other pages in name's series, whose
+// navigation may name it.
+func exportSeriesMembers(cmark, name string) {
+	docs, err := docIndex.refresh(".")
+	if err != nil {
+		return
+	}
+	for _, d := range docs {
+		if d.Name != name || d.Series == "" {
+			continue
+		}
+		for _, m := range seriesMembers(docs, d.Series) {
+			if m.Name == name || loadIgnore(".").Match(m.Name, false) {
+				continue
+			}
+			if err := exportMarkdownTo(cmark, m.Name, filepath.Join(exportDir, htmlOutNameFor(m.Name))); err != nil {
+				log.Printf("export error for %s: %v", m.Name, err)
+			}
+		}
+	}
+}
+
+// writeSeries exports docs/series/<series>/index.html for every series,
+// listing its parts in order.
+func writeSeries(cmark, docsDir string) {
+	docs, err := docIndex.refresh(".")
+	if err != nil {
+		log.Printf("series pages not written: %v", err)
+		return
+	}
+	docs = publishedDocs(docs)
+	_ = os.RemoveAll(wsPath(filepath.Join(docsDir, seriesDir)))
+	done := map[string]bool{}
+	for _, d := range docs {
+		key := strings.ToLower(d.Series)
+		if d.Series == "" || done[key] {
+			continue
+		}
+		done[key] = true
+		members := seriesMembers(docs, d.Series)
+		var md strings.Builder
+		fmt.Fprintf(&md, "# %s\n\n", members[0].Series)
+		for i, m := range members {
+			fmt.Fprintf(&md, "%d. [%s](%s)\n", partNumber(m, i), markdownLinkText(docTitle(m)), htmlOutNameFor(m.Name))
+		}
+		out := seriesURL(d.Series)
+		page, err := nestedPage(cmark, strings.Repeat("../", strings.Count(out, "/")), md.String())
+		writeNestedPage(filepath.Join(docsDir, filepath.FromSlash(out)), page, err)
+	}
+}
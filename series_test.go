@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSeriesNavAndIndex(t *testing.T) {
+	chdirTemp(t)
+	docIndex = &metaIndex{}
+	writeFiles(t, map[string]string{
+		"intro.md":   "---\nseries: \"Learning Go\"\nseries_part: 1\n---\n# Intro",
+		"types.md":   "---\nseries: learning go\nseries_part: 2\n---\n# Types & values",
+		"extra.md":   "---\nseries: Learning Go\n---\n# Extra",
+		"lone.md":    "# Lone",
+		"pointer.md": "---\nseries: Learning Go\nseries_part: 3\n---\n# Pointers",
+	})
+	want := `<nav class="series-nav" aria-label="Series"><p><a href="series/learning-go/index.html">Learning Go</a>, part 2 of 4</p>` +
+		`<a rel="prev" href="intro.html">← Part 1: Intro</a><a rel="next" href="pointer.html">Part 3: Pointers →</a></nav>` + "\n"
+	if got := seriesNav("types.md"); got != want {
+		t.Fatalf("nav = %q", got)
+	}
+	// Parts without a number follow the numbered ones
+	if got := seriesNav("extra.md"); !strings.Contains(got, "part 4 of 4") || strings.Contains(got, `rel="next"`) {
+		t.Fatalf("last part nav = %q", got)
+	}
+	if got := seriesNav("lone.md"); got != "" {
+		t.Fatalf("lone page nav = %q", got)
+	}
+	_, _, body := applySeries("intro.md", nil, nil, []byte("<p>x</p>\n"))
+	if !strings.HasPrefix(string(body), "<p>x</p>\n<nav class=\"series-nav\"") {
+		t.Fatalf("body = %q", body)
+	}
+	header, _, body := applySeries("lone.md", []byte("<h>{{series}}"), nil, []byte("<p>x</p>"))
+	if string(header) != "<h>" || string(body) != "<p>x</p>" {
+		t.Fatalf("got %q %q", header, body)
+	}
+
+	cmark := echoCmark(t)
+	writeSeries(cmark, "docs")
+	b, err := os.ReadFile(filepath.Join("docs", seriesDir, "learning-go", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantIndex := "<base href=\"../../\">\n# Learning Go\n\n1. [Intro](intro.html)\n2. [Types & values](types.html)\n3. [Pointers](pointer.html)\n4. [Extra](extra.html)\n"
+	if string(b) != wantIndex {
+		t.Fatalf("index = %q", b)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// serverOptions tunes the editor's HTTP server; see the flags in main.
+type serverOptions struct {
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	// HTTP2 allows HTTP/2, which Go only negotiates over TLS.
+	HTTP2   bool
+	TLSCert string
+	TLSKey  string
+}
+
+var serverOpts = serverOptions{HTTP2: true}
+
+func validServerOptions(o serverOptions) error {
+	for _, d := range []time.Duration{o.ReadHeaderTimeout, o.ReadTimeout, o.WriteTimeout, o.IdleTimeout} {
+		if d < 0 {
+			return fmt.Errorf("invalid timeout %v", d)
+		}
+	}
+	if o.MaxHeaderBytes < 0 {
+		return fmt.Errorf("invalid max header size %d", o.MaxHeaderBytes)
+	}
+	if (o.TLSCert == "") != (o.TLSKey == "") {
+		return errors.New("-tls-cert and -tls-key must be used together")
+	}
+	return nil
+}
+
+// newServer returns the server for h on addr. Zero timeouts are unlimited.
+func newServer(addr string, h http.Handler, o serverOptions) *http.Server {
+	s := &http.Server{
+		Addr:              addr,
+		Handler:           h,
+		ReadHeaderTimeout: o.ReadHeaderTimeout,
+		ReadTimeout:       o.ReadTimeout,
+		WriteTimeout:      o.WriteTimeout,
+		IdleTimeout:       o.IdleTimeout,
+		MaxHeaderBytes:    o.MaxHeaderBytes,
+	}
+	if !o.HTTP2 {
+		// A non-nil empty map turns off Go's automatic HTTP/2
+		s.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
+	return s
+}
+
+// serve runs s until it fails, over TLS when a certificate is configured.
+func serve(s *http.Server, o serverOptions) error {
+	if o.TLSCert != "" {
+		return s.ListenAndServeTLS(o.TLSCert, o.TLSKey)
+	}
+	return s.ListenAndServe()
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestValidServerOptions(t *testing.T) {
+	if err := validServerOptions(serverOptions{ReadTimeout: time.Second, TLSCert: "c.pem", TLSKey: "k.pem"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range []serverOptions{{ReadTimeout: -1}, {IdleTimeout: -time.Second}, {MaxHeaderBytes: -1}, {TLSCert: "c.pem"}, {TLSKey: "k.pem"}} {
+		if err := validServerOptions(bad); err == nil {
+			t.Errorf("%+v: expected error", bad)
+		}
+	}
+}
+
+func TestNewServer(t *testing.T) {
+	h := http.NotFoundHandler()
+	o := serverOptions{ReadHeaderTimeout: 2 * time.Second, WriteTimeout: time.Minute, MaxHeaderBytes: 4096, HTTP2: true}
+	s := newServer("localhost:0", h, o)
+	if s.Addr != "localhost:0" || s.ReadHeaderTimeout != 2*time.Second || s.WriteTimeout != time.Minute || s.MaxHeaderBytes != 4096 {
+		t.Fatalf("server = %+v", s)
+	}
+	if s.TLSNextProto != nil {
+		t.Fatal("HTTP/2 should be left to the default")
+	}
+	o.HTTP2 = false
+	if s := newServer("localhost:0", h, o); s.TLSNextProto == nil || len(s.TLSNextProto) != 0 {
+		t.Fatalf("HTTP/2 not disabled: %v", s.TLSNextProto)
+	}
+}
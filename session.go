@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// --------- Per-client editing sessions ---------
+
+// sessionState is the UI state a client stores so it can resume where it
+// left off, possibly from another machine.
+type sessionState struct {
+	Files   []sessionFile `json:"files"`            // open files, in tab order
+	Active  string        `json:"active,omitempty"` // file being edited
+	Updated time.Time     `json:"updated"`
+}
+
+type sessionFile struct {
+	Name   string `json:"name"`
+	Cursor int    `json:"cursor"`
+	Scroll int    `json:"scroll"`
+}
+
+// Sessions are persisted with the rest of the state (see store.go).
+var (
+	sessions   = make(map[string]sessionState)
+	sessionsMu sync.Mutex
+)
+
+var sessionIDRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+const maxSessionBody = 64 << 10
+
+// handleSession serves GET and PUT /session?id=<id>, reading or replacing the
+// stored state for that session id.
+func handleSession(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		id = r.Header.Get("X-Session")
+	}
+	if !sessionIDRe.MatchString(id) {
+		http.Error(w, "invalid session id", http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		sessionsMu.Lock()
+		st, ok := sessions[id]
+		sessionsMu.Unlock()
+		if !ok {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(st)
+	case http.MethodPut:
+		var st sessionState
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxSessionBody)).Decode(&st); err != nil {
+			http.Error(w, "invalid session state: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		st.Updated = time.Now()
+		sessionsMu.Lock()
+		sessions[id] = st
+		sessionsMu.Unlock()
+		stateChanged()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleSession_PutGet(t *testing.T) {
+	sessions = make(map[string]sessionState)
+	rr := httptest.NewRecorder()
+	handleSession(rr, httptest.NewRequest(http.MethodGet, "/session?id=laptop", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rr.Code)
+	}
+
+	body := `{"files":[{"name":"a.md","cursor":12,"scroll":40}],"active":"a.md"}`
+	rr = httptest.NewRecorder()
+	handleSession(rr, httptest.NewRequest(http.MethodPut, "/session?id=laptop", strings.NewReader(body)))
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("put status = %d", rr.Code)
+	}
+
+	// Header id is accepted too
+	rr = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/session", nil)
+	req.Header.Set("X-Session", "laptop")
+	handleSession(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("get status = %d", rr.Code)
+	}
+	var st sessionState
+	if err := json.Unmarshal(rr.Body.Bytes(), &st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Active != "a.md" || len(st.Files) != 1 || st.Files[0].Cursor != 12 || st.Updated.IsZero() {
+		t.Fatalf("state = %+v", st)
+	}
+}
+
+func TestHandleSession_Errors(t *testing.T) {
+	sessions = make(map[string]sessionState)
+	cases := []struct {
+		method, url, body string
+		want              int
+	}{
+		{http.MethodGet, "/session", "", http.StatusBadRequest},
+		{http.MethodGet, "/session?id=../x", "", http.StatusBadRequest},
+		{http.MethodPut, "/session?id=a", "{", http.StatusBadRequest},
+		{http.MethodDelete, "/session?id=a", "", http.StatusMethodNotAllowed},
+	}
+	for _, c := range cases {
+		rr := httptest.NewRecorder()
+		handleSession(rr, httptest.NewRequest(c.method, c.url, strings.NewReader(c.body)))
+		if rr.Code != c.want {
+			t.Errorf("%s %s = %d; want %d", c.method, c.url, rr.Code, c.want)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// shareKeyPath holds the secret share links are signed with, so links stay
+// valid across restarts. Deleting it revokes every link.
+var shareKeyPath = filepath.Join(".minimark", "share.key")
+
+const (
+	defaultShareTTL = 24 * time.Hour
+	maxShareTTL     = 30 * 24 * time.Hour
+)
+
+var (
+	shareKeyMu sync.Mutex
+	shareKey   []byte
+)
+
+// shareSecret returns the signing secret, creating shareKeyPath on first
+// use.
+func shareSecret() ([]byte, error) {
+	shareKeyMu.Lock()
+	defer shareKeyMu.Unlock()
+	if shareKey != nil {
+		return shareKey, nil
+	}
+	if b, err := os.ReadFile(wsPath(shareKeyPath)); err == nil && len(b) >= 32 {
+		shareKey = b
+		return shareKey, nil
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(wsPath(filepath.Dir(shareKeyPath)), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(wsPath(shareKeyPath), key, 0600); err != nil {
+		return nil, err
+	}
+	shareKey = key
+	return shareKey, nil
+}
+
+func shareMAC(key []byte, payload string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(payload))
+	return m.Sum(nil)
+}
+
+// signShare returns the token granting read access to name until expires:
+// the file and expiry, then their signature.
+func signShare(name string, expires time.Time) (string, error) {
+	key, err := shareSecret()
+	if err != nil {
+		return "", err
+	}
+	payload := name + "\n" + strconv.FormatInt(expires.Unix(), 10)
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(payload)) + "." + enc.EncodeToString(shareMAC(key, payload)), nil
+}
+
+var errBadShare = errors.New("invalid or expired share link")
+
+// verifyShare returns the file a token grants access to, provided its
+// signature holds and it has not expired at now.
+func verifyShare(token string, now time.Time) (string, error) {
+	enc := base64.RawURLEncoding
+	p, s, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", errBadShare
+	}
+	payload, err1 := enc.DecodeString(p)
+	sig, err2 := enc.DecodeString(s)
+	if err1 != nil || err2 != nil {
+		return "", errBadShare
+	}
+	key, err := shareSecret()
+	if err != nil {
+		return "", err
+	}
+	if !hmac.Equal(sig, shareMAC(key, string(payload))) {
+		return "", errBadShare
+	}
+	name, exp, _ := strings.Cut(string(payload), "\n")
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || !now.Before(time.Unix(unix, 0)) || filepath.Base(name) != name {
+		return "", errBadShare
+	}
+	return name, nil
+}
+
+type shareLink struct {
+	File    string    `json:"file"`
+	URL     string    `json:"url"`
+	Expires time.Time `json:"expires"`
+}
+
+// handleShare creates a link to a read-only rendered view of the file given
+// by the `file` query param, valid for `ttl` (a duration such as "2h",
+// default 24h, at most 30 days), and answers it as JSON.
+func handleShare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.URL.Query().Get("file")
+	if name == "" || filepath.Base(name) != name || !strings.EqualFold(filepath.Ext(name), ".md") {
+		http.Error(w, "invalid filename", http.StatusBadRequest)
+		return
+	}
+	ttl := defaultShareTTL
+	if v := r.URL.Query().Get("ttl"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > maxShareTTL {
+			http.Error(w, "ttl must be a positive duration of at most 720h", http.StatusBadRequest)
+			return
+		}
+		ttl = d
+	}
+	if _, err := os.Stat(wsPath(name)); err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	expires := time.Now().Add(ttl).Truncate(time.Second)
+	token, err := signShare(name, expires)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(shareLink{File: name, URL: "/shared/" + token, Expires: expires})
+}
+
+// handleShared serves /shared/<token>: the shared file rendered like its
+// export, with assets resolved against /docs/.
+func handleShared(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name, err := verifyShare(strings.TrimPrefix(r.URL.Path, "/shared/"), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	md, err := readNote(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	serveRendered(w, name, md, "/docs/")
+}
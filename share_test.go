@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func resetShareKey(t *testing.T) {
+	t.Helper()
+	shareKey = nil
+	t.Cleanup(func() { shareKey = nil })
+}
+
+func TestSignVerifyShare(t *testing.T) {
+	chdirTemp(t)
+	resetShareKey(t)
+	now := time.Now()
+	token, err := signShare("note.md", now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, err := verifyShare(token, now); err != nil || name != "note.md" {
+		t.Fatalf("verify = %q, %v", name, err)
+	}
+	if _, err := verifyShare(token, now.Add(2*time.Hour)); err != errBadShare {
+		t.Fatalf("expired token accepted: %v", err)
+	}
+	forged, _ := signShare("other.md", now.Add(time.Hour))
+	payload, _, _ := strings.Cut(forged, ".")
+	_, sig, _ := strings.Cut(token, ".")
+	if _, err := verifyShare(payload+"."+sig, now); err != errBadShare {
+		t.Fatalf("mismatched signature accepted: %v", err)
+	}
+	for _, bad := range []string{"", "abc", "a.b.c", "!!.!!"} {
+		if _, err := verifyShare(bad, now); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+
+	// The key survives a restart; removing it revokes links
+	shareKey = nil
+	if _, err := verifyShare(token, now); err != nil {
+		t.Fatalf("token invalid after reload: %v", err)
+	}
+	os.Remove(shareKeyPath)
+	shareKey = nil
+	if _, err := verifyShare(token, now); err != errBadShare {
+		t.Fatalf("token valid after key removal: %v", err)
+	}
+}
+
+func TestHandleShare(t *testing.T) {
+	chdirTemp(t)
+	resetShareKey(t)
+	cmarkPath = echoCmark(t)
+	t.Cleanup(func() { cmarkPath = "" })
+	writeFiles(t, map[string]string{"note.md": "# Shared note\n"})
+
+	post := func(query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handleShare(rr, httptest.NewRequest(http.MethodPost, "/share?"+query, nil))
+		return rr
+	}
+	for query, code := range map[string]int{
+		"file=../note.md":         http.StatusBadRequest,
+		"file=missing.md":         http.StatusNotFound,
+		"file=note.md&ttl=999h":   http.StatusBadRequest,
+		"file=note.md&ttl=-1h":    http.StatusBadRequest,
+		"file=note.md&ttl=banana": http.StatusBadRequest,
+	} {
+		if rr := post(query); rr.Code != code {
+			t.Errorf("%s: %d, want %d", query, rr.Code, code)
+		}
+	}
+	rr := post("file=note.md&ttl=2h")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("share: %d %s", rr.Code, rr.Body.String())
+	}
+	var link shareLink
+	if err := json.Unmarshal(rr.Body.Bytes(), &link); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(link.Expires); d < time.Hour || d > 2*time.Hour {
+		t.Fatalf("expires in %v", d)
+	}
+
+	rr = httptest.NewRecorder()
+	newMux().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, link.URL, nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "# Shared note") || !strings.Contains(rr.Body.String(), `<base href="/docs/">`) {
+		t.Fatalf("shared view = %d %q", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("X-Robots-Tag") != "noindex" {
+		t.Fatal("shared view may be indexed")
+	}
+
+	rr = httptest.NewRecorder()
+	newMux().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, link.URL+"x", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("tampered link = %d", rr.Code)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A shortcode is a directive such as {{code path=x.go lines=1-5}} in
+// Markdown, expanded at export time. Handlers return either Markdown, which
+// is converted with the rest of the page, or raw HTML, which is spliced in
+// after conversion (cmark-gfm would otherwise omit it).
+type shortcodeFunc func(args shortcodeArgs) (md, rawHTML string, err error)
+
+// shortcodeArgs holds key=value arguments and positional ones in order.
+type shortcodeArgs struct {
+	named      map[string]string
+	positional []string
+}
+
+var shortcodes = map[string]shortcodeFunc{
+	"code":    codeShortcode,
+	"data":    dataShortcode,
+	"youtube": youtubeShortcode,
+	"vimeo":   vimeoShortcode,
+}
+
+var (
+	shortcodeRe    = regexp.MustCompile(`(\\?)\{\{([a-z][a-z0-9_-]*)((?:\s+(?:[A-Za-z_][A-Za-z0-9_-]*=)?(?:"[^"]*"|[^}\s"]+))*)\s*\}\}`)
+	shortcodeArgRe = regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_-]*)=("[^"]*"|\S+)|("[^"]*"|\S+)`)
+)
+
+// placeholderPrefix marks where a shortcode's raw HTML goes in the
+// converted output.
+const placeholderPrefix = "MINIMARKSHORTCODE"
+
+func parseShortcodeArgs(s string) shortcodeArgs {
+	a := shortcodeArgs{named: map[string]string{}}
+	for _, m := range shortcodeArgRe.FindAllStringSubmatch(s, -1) {
+		if m[1] != "" {
+			a.named[m[1]] = strings.Trim(m[2], `"`)
+		} else {
+			a.positional = append(a.positional, strings.Trim(m[3], `"`))
+		}
+	}
+	return a
+}
+
+// expandShortcodes replaces the registered shortcodes in md, outside fenced
+// code blocks. A leading backslash (\{{code ...}}) keeps a shortcode
+// literal. It returns the new Markdown and the raw HTML blocks referenced
+// by placeholders.
+func expandShortcodes(md []byte) ([]byte, []string) {
+	var blocks []string
+	var out bytes.Buffer
+	fence := ""
+	for _, line := range bytes.SplitAfter(md, []byte("\n")) {
+		trimmed := strings.TrimSpace(string(line))
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				fence = ""
+			}
+			out.Write(line)
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			out.Write(line)
+			continue
+		}
+		out.Write(shortcodeRe.ReplaceAllFunc(line, func(m []byte) []byte {
+			sub := shortcodeRe.FindSubmatch(m)
+			fn, ok := shortcodes[string(sub[2])]
+			if !ok {
+				return m
+			}
+			if len(sub[1]) > 0 {
+				return m[1:]
+			}
+			md, raw, err := fn(parseShortcodeArgs(string(sub[3])))
+			if err != nil {
+				log.Printf("shortcode %s: %v", sub[2], err)
+				return []byte(fmt.Sprintf("**%s: %s**", sub[2], err))
+			}
+			if raw != "" {
+				blocks = append(blocks, raw)
+				return []byte(placeholderPrefix + strconv.Itoa(len(blocks)-1))
+			}
+			return []byte(md)
+		}))
+	}
+	return out.Bytes(), blocks
+}
+
+// restoreShortcodes puts the raw HTML blocks back in place of their
+// placeholders, unwrapping the paragraph a placeholder stands alone in.
+func restoreShortcodes(body []byte, blocks []string) []byte {
+	for i := len(blocks) - 1; i >= 0; i-- {
+		token := []byte(placeholderPrefix + strconv.Itoa(i))
+		para := append(append([]byte("<p>"), token...), "</p>"...)
+		body = bytes.ReplaceAll(body, para, []byte(blocks[i]))
+		body = bytes.ReplaceAll(body, token, []byte(blocks[i]))
+	}
+	return body
+}
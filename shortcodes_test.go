@@ -0,0 +1,109 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseShortcodeArgs(t *testing.T) {
+	a := parseShortcodeArgs(` path=a.go lines=1-3 "two words" title="x y" last`)
+	want := map[string]string{"path": "a.go", "lines": "1-3", "title": "x y"}
+	if !reflect.DeepEqual(a.named, want) || !reflect.DeepEqual(a.positional, []string{"two words", "last"}) {
+		t.Fatalf("got %+v", a)
+	}
+}
+
+func TestExpandShortcodes(t *testing.T) {
+	shortcodes["test-html"] = func(a shortcodeArgs) (string, string, error) {
+		return "", "<b>" + a.positional[0] + "</b>", nil
+	}
+	t.Cleanup(func() { delete(shortcodes, "test-html") })
+	md := "{{test-html one}}\n\n```\n{{test-html two}}\n```\n\\{{test-html three}} {{unknown x}}\n"
+	out, blocks := expandShortcodes([]byte(md))
+	want := placeholderPrefix + "0\n\n```\n{{test-html two}}\n```\n{{test-html three}} {{unknown x}}\n"
+	if string(out) != want || !reflect.DeepEqual(blocks, []string{"<b>one</b>"}) {
+		t.Fatalf("out = %q blocks = %q", out, blocks)
+	}
+	body := restoreShortcodes([]byte("<p>"+placeholderPrefix+"0</p>\n<p>a "+placeholderPrefix+"0</p>"), blocks)
+	if string(body) != "<b>one</b>\n<p>a <b>one</b></p>" {
+		t.Fatalf("body = %q", body)
+	}
+}
+
+func TestCodeShortcode(t *testing.T) {
+	chdirTemp(t)
+	if err := os.MkdirAll("src", 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, map[string]string{filepath.Join("src", "main.go"): "package main\n\nfunc main() {\n\tprintln(\"```\")\n}\n"})
+	out, _ := expandShortcodes([]byte("{{code path=src/main.go lines=3-5}}\n"))
+	want := "````go\nfunc main() {\n\tprintln(\"```\")\n}\n````\n"
+	if string(out) != want {
+		t.Fatalf("got %q; want %q", out, want)
+	}
+	out, _ = expandShortcodes([]byte("{{code src/main.go lines=1 lang=text}}"))
+	if string(out) != "```text\npackage main\n```" {
+		t.Fatalf("got %q", out)
+	}
+	for _, bad := range []string{"{{code path=../x.go}}", "{{code path=src/main.go lines=4-99}}", "{{code path=nope.go}}", "{{code}}"} {
+		out, _ := expandShortcodes([]byte(bad))
+		if !strings.HasPrefix(string(out), "**code: ") {
+			t.Errorf("%s: got %q", bad, out)
+		}
+	}
+}
+
+func TestCodeShortcode_CodeRoot(t *testing.T) {
+	dir := chdirTemp(t)
+	if err := os.Mkdir("notes", 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, map[string]string{"lib.go": "package lib"})
+	if err := os.Chdir(filepath.Join(dir, "notes")); err != nil {
+		t.Fatal(err)
+	}
+	withConfig(t, siteConfig{CodeRoot: ".."})
+	out, _ := expandShortcodes([]byte("{{code path=../lib.go}}"))
+	if string(out) != "```go\npackage lib\n```" {
+		t.Fatalf("got %q", out)
+	}
+}
+
+func TestParseLineRange(t *testing.T) {
+	cases := []struct {
+		spec     string
+		from, to int
+		ok       bool
+	}{
+		{"2-4", 2, 4, true}, {"3", 3, 3, true}, {"3-", 3, 10, true},
+		{"0-2", 0, 0, false}, {"5-4", 0, 0, false}, {"9-11", 0, 0, false}, {"x", 0, 0, false},
+	}
+	for _, c := range cases {
+		from, to, err := parseLineRange(c.spec, 10)
+		if (err == nil) != c.ok || from != c.from || to != c.to {
+			t.Errorf("parseLineRange(%q) = %d, %d, %v", c.spec, from, to, err)
+		}
+	}
+}
+
+func TestVideoShortcodes(t *testing.T) {
+	cases := map[string]string{
+		`{{youtube dQw4w9WgXcQ title="A <demo>"}}`: `<div class="video"><iframe src="https://www.youtube-nocookie.com/embed/dQw4w9WgXcQ" title="A &lt;demo&gt;" loading="lazy" allow="fullscreen; picture-in-picture" allowfullscreen></iframe></div>`,
+		`{{vimeo id=76979871}}`:                    `<div class="video"><iframe src="https://player.vimeo.com/video/76979871?dnt=1" title="Vimeo video" loading="lazy" allow="fullscreen; picture-in-picture" allowfullscreen></iframe></div>`,
+	}
+	for in, want := range cases {
+		_, blocks := expandShortcodes([]byte(in))
+		if len(blocks) != 1 || blocks[0] != want {
+			t.Errorf("%s: blocks = %q", in, blocks)
+		}
+	}
+	for _, bad := range []string{`{{youtube abc<script>}}`, "{{vimeo abc}}", "{{youtube}}"} {
+		out, blocks := expandShortcodes([]byte(bad))
+		if len(blocks) != 0 || !strings.Contains(string(out), "invalid video id") {
+			t.Errorf("%s: got %q", bad, out)
+		}
+	}
+}
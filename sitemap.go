@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// sitemapFile is the sitemap written to the docs root.
+const sitemapFile = "sitemap.xml"
+
+// sitemapChangeFreqs are the change frequencies the sitemap protocol allows.
+var sitemapChangeFreqs = []string{"always", "hourly", "daily", "weekly", "monthly", "yearly", "never"}
+
+type sitemapURL struct {
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod,omitempty"`
+	ChangeFreq string `xml:"changefreq,omitempty"`
+	Priority   string `xml:"priority,omitempty"`
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+func validateSiteURL(s string) error {
+	if s == "" {
+		return nil
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("site_url %q must be an absolute http or https URL", s)
+	}
+	return nil
+}
+
+// sitemapEntry returns the sitemap entry for the page d, tuned by its front
+// matter sitemap_priority:, sitemap_changefreq: and sitemap_exclude:. It
+// returns false for excluded pages, those marked noindex by robots: and
+// password-protected ones. Invalid settings are logged and left out of the
+// entry.
+func sitemapEntry(base string, d docMeta) (sitemapURL, bool) {
+	fields := readFileFrontMatter(d.Name)
+	if exclude, _ := strconv.ParseBool(fields["sitemap_exclude"]); exclude || robotsNoIndex(normalizeRobots(fields["robots"])) || fields["password"] != "" {
+		return sitemapURL{}, false
+	}
+	e := sitemapURL{Loc: base + url.PathEscape(htmlOutNameFor(d.Name))}
+	if !d.Updated.IsZero() {
+		e.LastMod = d.Updated.Format("2006-01-02")
+	}
+	if p := fields["sitemap_priority"]; p != "" {
+		if f, err := strconv.ParseFloat(p, 64); err == nil && f >= 0 && f <= 1 {
+			e.Priority = strconv.FormatFloat(f, 'f', 1, 64)
+		} else {
+			log.Printf("%s: sitemap_priority %q must be between 0.0 and 1.0", d.Name, p)
+		}
+	}
+	if cf := strings.ToLower(fields["sitemap_changefreq"]); cf != "" {
+		valid := false
+		for _, f := range sitemapChangeFreqs {
+			valid = valid || cf == f
+		}
+		if valid {
+			e.ChangeFreq = cf
+		} else {
+			log.Printf("%s: sitemap_changefreq %q must be one of %v", d.Name, cf, sitemapChangeFreqs)
+		}
+	}
+	return e, true
+}
+
+// writeSitemap writes docs/sitemap.xml listing every exported page under
+// site_url from minimark.json. Without site_url there is no sitemap, since
+// its URLs must be absolute.
+func writeSitemap(docsDir string) {
+	path := filepath.Join(docsDir, sitemapFile)
+	if config.SiteURL == "" {
+		_ = os.Remove(wsPath(path))
+		return
+	}
+	docs, err := docIndex.refresh(".")
+	if err != nil {
+		log.Printf("sitemap not written: %v", err)
+		return
+	}
+	docs = publishedDocs(docs)
+	base := strings.TrimSuffix(config.SiteURL, "/") + "/"
+	set := sitemapURLSet{XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+	for _, d := range docs {
+		if e, ok := sitemapEntry(base, d); ok {
+			set.URLs = append(set.URLs, e)
+		}
+	}
+	b, err := xml.MarshalIndent(set, "", "  ")
+	if err == nil {
+		err = os.WriteFile(wsPath(path), append([]byte(xml.Header), append(b, '\n')...), 0644)
+	}
+	if err != nil {
+		log.Printf("sitemap not written: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteSitemap(t *testing.T) {
+	chdirTemp(t)
+	docIndex = &metaIndex{}
+	writeFiles(t, map[string]string{
+		"index.md":   "---\nupdated: 2024-05-01\nsitemap_priority: 1\nsitemap_changefreq: Weekly\n---\n# Home",
+		"a page.md":  "# Spaces",
+		"private.md": "---\nsitemap_exclude: true\n---\n# Private",
+		"draft.md":   "---\nrobots: noindex\n---\n# Draft",
+		"bad.md":     "---\nsitemap_priority: 2\nsitemap_changefreq: often\n---\n# Bad",
+	})
+	os.MkdirAll("docs", 0755)
+	path := filepath.Join("docs", sitemapFile)
+
+	writeSitemap("docs")
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("sitemap written without site_url")
+	}
+
+	withConfig(t, siteConfig{SiteURL: "https://example.com/site"})
+	writeSitemap("docs")
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(b)
+	for _, want := range []string{
+		`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`,
+		"<loc>https://example.com/site/index.html</loc>\n    <lastmod>2024-05-01</lastmod>\n    <changefreq>weekly</changefreq>\n    <priority>1.0</priority>",
+		"<loc>https://example.com/site/a%20page.html</loc>",
+		"<loc>https://example.com/site/bad.html</loc>",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("sitemap missing %q:\n%s", want, got)
+		}
+	}
+	for _, unwanted := range []string{"private.html", "draft.html", "often", "<priority>2"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("sitemap has %q:\n%s", unwanted, got)
+		}
+	}
+}
+
+func TestValidateSiteURL(t *testing.T) {
+	for _, ok := range []string{"", "https://example.com", "http://localhost:8000/docs/"} {
+		if err := validateSiteURL(ok); err != nil {
+			t.Errorf("%q: %v", ok, err)
+		}
+	}
+	for _, bad := range []string{"example.com", "/docs", "ftp://example.com"} {
+		if validateSiteURL(bad) == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// snapshotDir holds the contents notes had before each save, in
+// <file>/<id>.md, so a bad save can be recovered without git.
+var snapshotDir = filepath.Join(".minimark", "snapshots")
+
+// snapshotKeep bounds how many snapshots are kept per file; older ones
+// are removed as new ones are taken.
+const snapshotKeep = 50
+
+// snapshotIDLayout names snapshots after the UTC time they were taken,
+// so they sort by name.
+const snapshotIDLayout = "20060102T150405.000000000Z"
+
+var snapshotIDRe = regexp.MustCompile(`^\d{8}T\d{6}\.\d{9}Z$`)
+
+// snapshot describes one stored version of a note.
+type snapshot struct {
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+	Size int64     `json:"size"` // bytes on disk, sealed for encrypted notes
+}
+
+// snapshotNote stores prev, the content name had before a save writing
+// cur, and drops the oldest snapshots beyond snapshotKeep (best-effort).
+// Saves that do not change the content are skipped.
+func snapshotNote(name string, prev, cur []byte) {
+	if bytes.Equal(prev, cur) {
+		return
+	}
+	name = filepath.Base(name)
+	dir := filepath.Join(snapshotDir, name)
+	sealed, err := sealNote(prev, encryptedNote(name))
+	if err == nil {
+		err = os.MkdirAll(wsPath(dir), 0755)
+	}
+	if err == nil {
+		id := time.Now().UTC().Format(snapshotIDLayout)
+		err = os.WriteFile(wsPath(filepath.Join(dir, id+".md")), sealed, 0644)
+	}
+	if err != nil {
+		log.Printf("snapshot of %s failed: %v", name, err)
+		return
+	}
+	snaps := listSnapshots(name)
+	for _, s := range snaps[min(len(snaps), snapshotKeep):] {
+		_ = os.Remove(wsPath(filepath.Join(dir, s.ID+".md")))
+	}
+}
+
+// listSnapshots returns the snapshots of name, newest first.
+func listSnapshots(name string) []snapshot {
+	entries, _ := os.ReadDir(wsPath(filepath.Join(snapshotDir, name)))
+	snaps := []snapshot{}
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".md")
+		if !ok || !snapshotIDRe.MatchString(id) {
+			continue
+		}
+		t, err := time.Parse(snapshotIDLayout, id)
+		info, ierr := e.Info()
+		if err != nil || ierr != nil {
+			continue
+		}
+		snaps = append(snaps, snapshot{ID: id, Time: t, Size: info.Size()})
+	}
+	sort.Slice(snaps, func(i, j int) bool { return snaps[i].ID > snaps[j].ID })
+	return snaps
+}
+
+// renameSnapshots moves the snapshots of oldName to newName after a
+// rename, unless newName already has some.
+func renameSnapshots(oldName, newName string) {
+	from := filepath.Join(snapshotDir, filepath.Base(oldName))
+	to := filepath.Join(snapshotDir, filepath.Base(newName))
+	if _, err := os.Stat(wsPath(to)); err == nil {
+		return
+	}
+	_ = os.Rename(wsPath(from), wsPath(to))
+}
+
+// handleSnapshots lists the snapshots of the note given by `file` as
+// JSON, newest first, or with ?id= returns the content of one.
+func handleSnapshots(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	name := q.Get("file")
+	if name == "" || filepath.Base(name) != name {
+		http.Error(w, "invalid filename", http.StatusBadRequest)
+		return
+	}
+	id := q.Get("id")
+	if id == "" {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(listSnapshots(name))
+		return
+	}
+	if !snapshotIDRe.MatchString(id) {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	b, err := os.ReadFile(wsPath(filepath.Join(snapshotDir, name, id+".md")))
+	if err == nil {
+		b, err = openNote(b)
+	}
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	setRevision(w.Header(), contentETag(b))
+	_, _ = w.Write(b)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHandleSave_Snapshots(t *testing.T) {
+	chdirTemp(t)
+	locks = make(map[string]lockInfo)
+	writeFiles(t, map[string]string{"note.md": "v1"})
+	tok := lockFile(t, "note.md")
+	save := func(body string) {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/save?file=note.md", strings.NewReader(body))
+		req.Header.Set("X-Lock", tok)
+		handleSave(rr, req)
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("save = %d: %s", rr.Code, rr.Body.String())
+		}
+	}
+	save("v2")
+	save("v2") // unchanged: no snapshot
+	save("v3")
+
+	rr := httptest.NewRecorder()
+	handleSnapshots(rr, httptest.NewRequest(http.MethodGet, "/snapshots?file=note.md", nil))
+	var snaps []snapshot
+	if err := json.Unmarshal(rr.Body.Bytes(), &snaps); err != nil {
+		t.Fatal(err)
+	}
+	if len(snaps) != 2 {
+		t.Fatalf("snapshots = %+v", snaps)
+	}
+	for i, want := range []string{"v2", "v1"} {
+		rr := httptest.NewRecorder()
+		handleSnapshots(rr, httptest.NewRequest(http.MethodGet, "/snapshots?file=note.md&id="+snaps[i].ID, nil))
+		if rr.Code != http.StatusOK || rr.Body.String() != want {
+			t.Errorf("snapshot %d = %d %q, want %q", i, rr.Code, rr.Body.String(), want)
+		}
+	}
+
+	for target, code := range map[string]int{
+		"/snapshots?file=note.md&id=../x":                       http.StatusBadRequest,
+		"/snapshots?file=../note.md":                            http.StatusBadRequest,
+		"/snapshots?file=note.md&id=20000101T000000.000000000Z": http.StatusNotFound,
+	} {
+		rr := httptest.NewRecorder()
+		handleSnapshots(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		if rr.Code != code {
+			t.Errorf("%s = %d, want %d", target, rr.Code, code)
+		}
+	}
+	rr = httptest.NewRecorder()
+	handleSnapshots(rr, httptest.NewRequest(http.MethodGet, "/snapshots?file=other.md", nil))
+	if strings.TrimSpace(rr.Body.String()) != "[]" {
+		t.Errorf("no snapshots = %q", rr.Body.String())
+	}
+
+	// Renaming the note by its heading takes the snapshots along
+	save("# Renamed\n")
+	if snaps := listSnapshots("renamed.md"); len(snaps) != 3 {
+		t.Errorf("snapshots after rename = %+v", snaps)
+	}
+}
+
+func TestSnapshotNote_Rotation(t *testing.T) {
+	chdirTemp(t)
+	dir := filepath.Join(snapshotDir, "note.md")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < snapshotKeep; i++ {
+		id := "20200101T000000.0000000" + string(rune('0'+i/10)) + string(rune('0'+i%10)) + "Z"
+		if err := os.WriteFile(filepath.Join(dir, id+".md"), []byte("old"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snapshotNote("note.md", []byte("prev"), []byte("cur"))
+	snaps := listSnapshots("note.md")
+	if len(snaps) != snapshotKeep {
+		t.Fatalf("kept %d snapshots", len(snaps))
+	}
+	if snaps[len(snaps)-1].ID != "20200101T000000.000000001Z" {
+		t.Errorf("oldest kept = %s", snaps[len(snaps)-1].ID)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, snaps[0].ID+".md")); string(b) != "prev" {
+		t.Errorf("newest = %q", b)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type splitResponse struct {
+	File  string   `json:"file"`
+	Notes []string `json:"notes"` // the new notes, in document order
+}
+
+// noteSection is the part of a note from a heading up to the next heading
+// of the same or a higher level.
+type noteSection struct {
+	Title      string
+	Start, End int
+}
+
+// splitSections returns the sections of content headed at level.
+func splitSections(content []byte, level int) []noteSection {
+	hs := parseHeadings(content)
+	var out []noteSection
+	for i, h := range hs {
+		if h.Level != level {
+			continue
+		}
+		end := len(content)
+		for _, next := range hs[i+1:] {
+			if next.Level <= level {
+				end = next.Start
+				break
+			}
+		}
+		out = append(out, noteSection{Title: h.Text, Start: h.Start, End: end})
+	}
+	return out
+}
+
+// shiftHeadings moves every heading in content by delta levels, clamped to
+// 1..6. Setext headings are rewritten as ATX headings.
+func shiftHeadings(content []byte, delta int) []byte {
+	if delta == 0 {
+		return content
+	}
+	var out bytes.Buffer
+	prev := 0
+	for _, h := range parseHeadings(content) {
+		level := h.Level + delta
+		if level < 1 {
+			level = 1
+		} else if level > 6 {
+			level = 6
+		}
+		out.Write(content[prev:h.Start])
+		out.WriteString(strings.Repeat("#", level))
+		if h.Text != "" {
+			out.WriteString(" " + h.Text)
+		}
+		out.WriteString("\n")
+		prev = h.End
+	}
+	out.Write(content[prev:])
+	return out.Bytes()
+}
+
+// ensureBlankLine ends b with an empty line, unless b is empty, so that
+// what follows starts a new block.
+func ensureBlankLine(b *bytes.Buffer) {
+	if b.Len() == 0 || bytes.HasSuffix(b.Bytes(), []byte("\n\n")) {
+		return
+	}
+	if !bytes.HasSuffix(b.Bytes(), []byte("\n")) {
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+}
+
+// handleSplit moves each section of the file given by `file` headed at
+// `level` (default 2) into a note of its own, named after the heading, and
+// replaces the sections in the original with links to the new notes. New
+// notes keep the original's private: and password: settings.
+func handleSplit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	name := q.Get("file")
+	if name == "" || filepath.Base(name) != name || !strings.EqualFold(filepath.Ext(name), ".md") {
+		http.Error(w, "invalid filename", http.StatusBadRequest)
+		return
+	}
+	level := 2
+	if s := q.Get("level"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > 6 {
+			http.Error(w, "level must be between 1 and 6", http.StatusBadRequest)
+			return
+		}
+		level = n
+	}
+	tok, ok := acquireLock(name)
+	if !ok {
+		lockedError(w, name)
+		return
+	}
+	defer releaseLock(name, tok)
+	prev, err := readNote(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sections := splitSections(prev, level)
+	if len(sections) == 0 {
+		http.Error(w, fmt.Sprintf("no level %d headings to split at", level), http.StatusBadRequest)
+		return
+	}
+
+	fields, _ := parseFrontMatter(prev)
+	var created []string
+	var rest bytes.Buffer
+	at := 0
+	for _, s := range sections {
+		slug := slugify(s.Title)
+		if slug == "" {
+			slug = "section"
+		}
+		note := bytes.TrimSpace(shiftHeadings(prev[s.Start:s.End], 1-level))
+		note = append(note, '\n')
+		for _, key := range []string{"private", "password"} {
+			if v := fields[key]; v != "" {
+				note = setFrontMatterField(note, key, v)
+			}
+		}
+		newName := uniqueAvailableName(slug + ".md")
+		sealed, err := sealNote(note, encryptedNote(name) || encryptedNote(newName))
+		if err == nil {
+			err = os.WriteFile(wsPath(newName), sealed, 0644)
+		}
+		if err != nil {
+			for _, c := range created {
+				_ = os.Remove(wsPath(c))
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		created = append(created, newName)
+
+		gap := prev[at:s.Start]
+		rest.Write(gap)
+		if at == 0 || len(gap) > 0 {
+			ensureBlankLine(&rest)
+		}
+		fmt.Fprintf(&rest, "- [%s](%s)\n", markdownLinkText(s.Title), htmlOutNameFor(newName))
+		at = s.End
+	}
+	if tail := prev[at:]; len(bytes.TrimSpace(tail)) > 0 {
+		ensureBlankLine(&rest)
+		rest.Write(tail)
+	}
+	data := rest.Bytes()
+	if err := writeNote(name, data); err != nil {
+		for _, c := range created {
+			_ = os.Remove(wsPath(c))
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	pushUndo(name, prev, data)
+	for _, c := range created {
+		afterSave(c)
+	}
+	afterSave(name)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(splitResponse{File: name, Notes: created})
+}
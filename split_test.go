@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func postSplit(t *testing.T, query string) *httptest.ResponseRecorder {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	handleSplit(rr, httptest.NewRequest(http.MethodPost, "/split?"+query, nil))
+	return rr
+}
+
+func TestHandleSplit(t *testing.T) {
+	chdirTemp(t)
+	locks = make(map[string]lockInfo)
+	writeFiles(t, map[string]string{
+		"big.md": "---\nprivate: true\n---\n# Big\n\nIntro.\n\n## Setup\n\nInstall it.\n\n### Linux\n\nUse apt.\n\n## Usage [basics]\n" +
+			"Run it.\n\n```\n## not a heading\n```\n\n# Appendix\n\nThe end.\n",
+		"setup.md": "taken",
+	})
+	rr := postSplit(t, "file=big.md")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("split: %d %s", rr.Code, rr.Body.String())
+	}
+	var resp splitResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Notes) != 2 || resp.Notes[0] != "setup-1.md" || resp.Notes[1] != "usage-basics.md" {
+		t.Fatalf("notes %v", resp.Notes)
+	}
+	want := map[string]string{
+		"big.md":          "---\nprivate: true\n---\n# Big\n\nIntro.\n\n- [Setup](setup-1.html)\n- [Usage \\[basics\\]](usage-basics.html)\n\n# Appendix\n\nThe end.\n",
+		"setup-1.md":      "---\nprivate: true\n---\n# Setup\n\nInstall it.\n\n## Linux\n\nUse apt.\n",
+		"usage-basics.md": "---\nprivate: true\n---\n# Usage [basics]\nRun it.\n\n```\n## not a heading\n```\n",
+	}
+	for name, body := range want {
+		if b, _ := os.ReadFile(name); string(b) != body {
+			t.Errorf("%s =\n%q\nwant\n%q", name, b, body)
+		}
+	}
+	if prev, ok := popUndo("big.md"); !ok || len(prev) == 0 {
+		t.Error("original not in undo history")
+	}
+	if len(locks) != 0 {
+		t.Errorf("locks left: %v", locks)
+	}
+
+	for query, code := range map[string]int{
+		"file=big.md&level=4":     http.StatusBadRequest,
+		"file=big.md&level=9":     http.StatusBadRequest,
+		"file=../big.md":          http.StatusBadRequest,
+		"file=missing.md":         http.StatusNotFound,
+		"file=setup-1.md&level=x": http.StatusBadRequest,
+	} {
+		if rr := postSplit(t, query); rr.Code != code {
+			t.Errorf("%s: %d, want %d", query, rr.Code, code)
+		}
+	}
+}
+
+func TestShiftHeadings(t *testing.T) {
+	in := "Title\n=====\n\n## Sub\n\n###### Deep\n"
+	if got := string(shiftHeadings([]byte(in), 1)); got != "## Title\n\n### Sub\n\n###### Deep\n" {
+		t.Errorf("down: %q", got)
+	}
+	if got := string(shiftHeadings([]byte(in), -1)); got != "# Title\n\n# Sub\n\n##### Deep\n" {
+		t.Errorf("up: %q", got)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	sriTagRe  = regexp.MustCompile(`(?i)<(?:link|script)\b[^>]*>`)
+	sriAttrRe = regexp.MustCompile(`(?i)\s(href|src)\s*=\s*("[^"]*"|'[^']*')`)
+	sriRelRe  = regexp.MustCompile(`(?i)\srel\s*=\s*["']?(?:stylesheet|modulepreload|preload)\b`)
+	sriHasRe  = regexp.MustCompile(`(?i)\sintegrity\s*=`)
+)
+
+// applySRI adds integrity attributes to the stylesheets and scripts in b
+// that refer to local assets, when sri is enabled in minimark.json.
+func applySRI(b []byte) []byte {
+	if !config.SRI {
+		return b
+	}
+	return sriTagRe.ReplaceAllFunc(b, func(tag []byte) []byte {
+		isLink := strings.EqualFold(string(tag[1:5]), "link")
+		if sriHasRe.Match(tag) || (isLink && !sriRelRe.Match(tag)) {
+			return tag
+		}
+		m := sriAttrRe.FindSubmatch(tag)
+		if m == nil || isLink != strings.EqualFold(string(m[1]), "href") {
+			return tag
+		}
+		ref := strings.Trim(string(m[2]), `"'`)
+		if i := strings.IndexAny(ref, "?#"); i >= 0 {
+			ref = ref[:i]
+		}
+		if isRemoteAsset(ref) || !insideWorkspace(ref) {
+			return tag
+		}
+		asset, ok := exportedAsset(path.Clean(ref))
+		if !ok {
+			return tag
+		}
+		sum := sha512.Sum384(asset)
+		attr := ` integrity="sha384-` + base64.StdEncoding.EncodeToString(sum[:]) + `"`
+		end := len(tag) - 1
+		if tag[end-1] == '/' {
+			end--
+			for tag[end-1] == ' ' {
+				end--
+			}
+		}
+		out := append([]byte{}, tag[:end]...)
+		out = append(out, attr...)
+		return append(out, tag[end:]...)
+	})
+}
+
+// exportedAsset returns the content the local asset ref has, or will have
+// once copied, in docs: the copy already there, else the source that wins
+// in the startup copy order (configured assets over _includes or the theme
+// over the embedded defaults).
+func exportedAsset(ref string) ([]byte, bool) {
+	if b, err := os.ReadFile(wsPath(filepath.Join(exportDir, filepath.FromSlash(ref)))); err == nil {
+		return b, true
+	}
+	for _, r := range append(append([]string{}, config.Styles...), config.Scripts...) {
+		if !isRemoteAsset(r) && path.Clean(r) == ref {
+			b, err := os.ReadFile(wsPath(filepath.FromSlash(ref)))
+			return b, err == nil
+		}
+	}
+	if info, err := os.Stat(wsPath("_includes")); err == nil && info.IsDir() {
+		if b, err := os.ReadFile(wsPath(filepath.Join("_includes", filepath.FromSlash(ref)))); err == nil {
+			return b, true
+		}
+	} else if siteTheme != "" && ref != "header.html" && ref != "footer.html" {
+		if b, err := embeddedIncludes.ReadFile(path.Join("static", "themes", siteTheme, ref)); err == nil {
+			return b, true
+		}
+	}
+	for _, name := range defaultAssets {
+		if name == ref {
+			b, err := embeddedIncludes.ReadFile("static/" + name)
+			return b, err == nil
+		}
+	}
+	return nil, false
+}
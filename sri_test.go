@@ -0,0 +1,55 @@
+package main
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func sri(b []byte) string {
+	sum := sha512.Sum384(b)
+	return "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func TestApplySRI(t *testing.T) {
+	chdirTemp(t)
+	if err := os.MkdirAll("_includes", 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, map[string]string{
+		filepath.Join("_includes", "neat.css"): "body{}",
+		filepath.Join("_includes", "site.js"):  "go()",
+	})
+	header := `<link rel="stylesheet" href="neat.css?v=2"><script src="site.js"></script>` +
+		`<link rel="stylesheet" href="https://cdn.example.com/x.css"><link rel="icon" href="neat.css">` +
+		`<script src="missing.js"></script><script src="theme.js" integrity="sha384-x"></script><link rel="stylesheet" href="print.css" />`
+	if got := string(applySRI([]byte(header))); got != header {
+		t.Fatalf("disabled: %s", got)
+	}
+
+	withConfig(t, siteConfig{SRI: true})
+	printCSS, err := embeddedIncludes.ReadFile("static/print.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<link rel="stylesheet" href="neat.css?v=2" integrity="` + sri([]byte("body{}")) + `">` +
+		`<script src="site.js" integrity="` + sri([]byte("go()")) + `"></script>` +
+		`<link rel="stylesheet" href="https://cdn.example.com/x.css"><link rel="icon" href="neat.css">` +
+		`<script src="missing.js"></script><script src="theme.js" integrity="sha384-x"></script>` +
+		`<link rel="stylesheet" href="print.css" integrity="` + sri(printCSS) + `" />`
+	if got := string(applySRI([]byte(header))); got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+
+	// Once copied, the docs version is what the browser gets
+	if err := os.MkdirAll("docs", 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, map[string]string{filepath.Join("docs", "site.js"): "went()"})
+	want = `<script src="site.js" integrity="` + sri([]byte("went()")) + `"></script>`
+	if got := string(applySRI([]byte(`<script src="site.js"></script>`))); got != want {
+		t.Fatalf("got %s", got)
+	}
+}
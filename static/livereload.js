@@ -0,0 +1,31 @@
+// Live reload for pages previewed under /docs/ and /view/. The server sends
+// a "reload" event naming the re-exported page, or "*" when the whole site
+// was rebuilt (e.g. after an _includes change), over /ws, or /events where
+// WebSockets are unavailable.
+(function () {
+  var page = decodeURIComponent(location.pathname.replace(/^\/(docs|view)\//, ''));
+  if (page === '' || page.charAt(page.length - 1) === '/') page += 'index.html';
+  else if (page.indexOf('.') < 0) page += '.html';
+  var reload = function (data) {
+    if (data === '*' || data === page) location.reload();
+  };
+  var listen = function () {
+    if (typeof EventSource === 'undefined') return;
+    new EventSource('/events').addEventListener('reload', function (e) { reload(e.data); });
+  };
+  if (typeof WebSocket === 'undefined') return listen();
+  var opened = false;
+  var connect = function () {
+    var ws = new WebSocket((location.protocol === 'https:' ? 'wss://' : 'ws://') + location.host + '/ws');
+    ws.onopen = function () { opened = true; };
+    ws.onmessage = function (e) {
+      var msg = JSON.parse(e.data);
+      if (msg.event === 'reload') reload(msg.data);
+    };
+    ws.onclose = function () {
+      if (opened) setTimeout(connect, 2000);
+      else listen();
+    };
+  };
+  connect();
+})();
@@ -10,7 +10,54 @@ document.addEventListener('keydown', function(e) {
 let currentFilename = 'index.md';
 let currentLock = '';
 let saveTimer = null;
+let dirty = false; // typed since the last successful save
+// Revision of the open file as last loaded or saved, sent as If-Match
+let currentRevision = '';
 let currentHtmlFilename = 'index.html';
+let sessionTimer = null;
+// Session id shared by every browser that should resume the same state
+const sessionId = localStorage.getItem('minimarkSession') || 'default';
+// Saves made while offline, keyed by filename (latest content wins)
+const queueKey = 'minimarkQueue';
+// Lock TTL asked for, in seconds; locks are refreshed at half the TTL granted
+const lockTTL = 10;
+let lockRefreshMs = 500;
+// Open /ws connection holding the lock instead; it is released when the
+// socket closes
+let lockSocket = null;
+// Presence owner of this editor, and the files others are editing
+let myOwner = '';
+let editing = [];
+// Name shown to others when this editor holds a lock, if set
+const editorName = localStorage.getItem('minimarkEditor') || '';
+const lockHeaders = (token) => {
+    const headers = {};
+    if (token) headers['X-Lock'] = token;
+    if (editorName) headers['X-Editor'] = editorName;
+    return headers;
+};
+// Turn a 423 answer ("file is locked by Joe since 14:02") into a notice
+const lockedMessage = async (res) => {
+    const text = (await res.text()).trim();
+    return text ? `${text.charAt(0).toUpperCase()}${text.slice(1)}.` : '';
+};
+
+// Install as an app and cache the UI shell for offline use
+if ('serviceWorker' in navigator) {
+    navigator.serviceWorker.register('/sw.js').catch((err) => console.warn('Service worker not registered:', err));
+}
+
+const loadQueue = () => {
+    try { return JSON.parse(localStorage.getItem(queueKey)) || {}; } catch (_) { return {}; }
+};
+const storeQueue = (queue) => {
+    try { localStorage.setItem(queueKey, JSON.stringify(queue)); } catch (_) {}
+};
+const queueSave = (name, body) => {
+    const queue = loadQueue();
+    queue[name] = body;
+    storeQueue(queue);
+};
 
 window.addEventListener('DOMContentLoaded', async () => {
     const textarea = document.getElementById('typebox');
@@ -22,12 +69,51 @@ window.addEventListener('DOMContentLoaded', async () => {
     let menuSelection = null;
     if (!textarea) return;
 
-    const updateHtmlNameFromHeaders = (headers) => {
+    // Take the exported page name and revision from a file response
+    const applyFileHeaders = (headers) => {
         if (!headers || typeof headers.get !== 'function') return;
         const value = headers.get('X-HTML-Filename');
         if (value) {
             currentHtmlFilename = value;
         }
+        currentRevision = headers.get('X-Revision') || '';
+    };
+    // Hold currentLock over the socket, or give up what it holds
+    const holdLock = () => {
+        if (!lockSocket || lockSocket.readyState !== WebSocket.OPEN) return;
+        const msg = currentLock ? { event: 'hold', file: currentFilename, lock: currentLock, editor: editorName } : { event: 'release' };
+        lockSocket.send(JSON.stringify(msg));
+    };
+    // Mark files open in other editors in the picker
+    const showEditing = () => {
+        if (!filepicker) return;
+        for (const o of filepicker.options) {
+            const p = editing.find((e) => e.file === o.value);
+            o.textContent = !p ? o.value : p.editor ? `${o.value} (being edited by ${p.editor})` : `${o.value} (being edited)`;
+        }
+    };
+    // Follow a rename done by the server on save (first H1 changed)
+    const applySavedName = (oldName, newName) => {
+        if (!newName || newName === oldName) return;
+        if (currentFilename === oldName) {
+            currentFilename = newName;
+            document.title = `Minimark - ${newName}`;
+            holdLock();
+        }
+        if (filepicker) {
+            let found = false;
+            for (const o of filepicker.options) {
+                if (o.value === oldName) {
+                    o.value = newName; o.textContent = newName; found = true; break;
+                }
+            }
+            if (!found) {
+                const opt = document.createElement('option');
+                opt.value = newName; opt.textContent = newName;
+                filepicker.appendChild(opt);
+            }
+            if (currentFilename === newName) filepicker.value = newName;
+        }
     };
     if (menu) {
         const openMenu = () => {
@@ -99,12 +185,32 @@ window.addEventListener('DOMContentLoaded', async () => {
                     window.open(url, '_blank', 'noopener');
                 }
                 closeMenu();
+                return;
+            }
+
+            if (event.key && event.key.toLowerCase() === 'f') {
+                event.preventDefault();
+                closeMenu();
+                findNote();
             }
         });
     }
+    // Resume the server-side session (active file, cursor, scroll) if any
+    let session = null;
     try {
-        // Load most recently edited markdown file
-        const res = await fetch('/open', { cache: 'no-store' });
+        const sres = await fetch(`/session?id=${encodeURIComponent(sessionId)}`, { cache: 'no-store' });
+        if (sres.ok) session = await sres.json();
+    } catch (_) {}
+
+    try {
+        // Load the session's active file, else the most recently edited one
+        let res = null;
+        if (session && session.active) {
+            res = await fetch(`/open?file=${encodeURIComponent(session.active)}`, { cache: 'no-store' });
+        }
+        if (!res || !res.ok) {
+            res = await fetch('/open', { cache: 'no-store' });
+        }
         if (!res.ok) {
             textarea.value = '';
             console.warn('Failed to load last markdown file:', res.status);
@@ -114,26 +220,99 @@ window.addEventListener('DOMContentLoaded', async () => {
             const name = res.headers.get('X-Filename') || 'untitled.md';
             currentFilename = name;
             document.title = `Minimark - ${name}`;
-            updateHtmlNameFromHeaders(res.headers);
+            applyFileHeaders(res.headers);
+            const saved = session && Array.isArray(session.files) ? session.files.find(f => f.name === name) : null;
+            if (saved) {
+                const pos = Math.min(saved.cursor || 0, textarea.value.length);
+                textarea.setSelectionRange(pos, pos);
+                textarea.scrollTop = saved.scroll || 0;
+            }
         }
     } catch (err) {
         console.error('Error fetching markdown:', err);
     }
 
-    // Simple lock with 1s TTL, refresh every 500ms
-    const setLockedUI = () => {
+    // Store session state (debounced) when the cursor or scroll position moves
+    const saveSession = () => {
+        if (sessionTimer) clearTimeout(sessionTimer);
+        sessionTimer = setTimeout(async () => {
+            const state = {
+                files: [{ name: currentFilename, cursor: textarea.selectionStart || 0, scroll: Math.round(textarea.scrollTop) }],
+                active: currentFilename,
+            };
+            try {
+                await fetch(`/session?id=${encodeURIComponent(sessionId)}`, {
+                    method: 'PUT',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify(state),
+                });
+            } catch (_) {}
+        }, 1000);
+    };
+    for (const ev of ['keyup', 'click', 'scroll']) {
+        textarea.addEventListener(ev, saveSession);
+    }
+
+    // Send saves queued while offline, taking each file's lock for the write.
+    // If the lock is taken by someone else the save still goes through, and
+    // the server keeps the content as a recovery draft.
+    let flushing = false;
+    const flushQueue = async () => {
+        if (flushing) return;
+        flushing = true;
+        try {
+            const queue = loadQueue();
+            for (const name of Object.keys(queue)) {
+                const isCurrent = name === currentFilename;
+                let token = isCurrent ? currentLock : '';
+                const lres = await fetch(`/lock?file=${encodeURIComponent(name)}&ttl=${lockTTL}`, { method: 'POST', headers: lockHeaders(token) });
+                token = (lres.status === 200 || lres.status === 201) ? (lres.headers.get('X-Lock') || '') : '';
+                const res = await fetch(`/save?file=${encodeURIComponent(name)}`, {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'text/plain; charset=utf-8', 'X-Filename': name, 'X-Lock': token },
+                    body: queue[name],
+                });
+                if (res.status === 204 && isCurrent) {
+                    applyFileHeaders(res.headers);
+                    applySavedName(name, res.headers.get('X-Filename'));
+                }
+                // Release locks taken just for this write
+                if (token && token !== currentLock) {
+                    await fetch(`/unlock?file=${encodeURIComponent(name)}`, { method: 'POST', headers: { 'X-Lock': token } });
+                }
+                const rest = loadQueue();
+                if (rest[name] === queue[name]) delete rest[name];
+                storeQueue(rest);
+            }
+        } catch (err) {
+            console.warn('Queued saves not sent yet:', err);
+        } finally {
+            flushing = false;
+        }
+    };
+    window.addEventListener('online', flushQueue);
+    // Content queued by an earlier visit is newer than what the server has
+    const pending = loadQueue();
+    if (typeof pending[currentFilename] === 'string') {
+        textarea.value = pending[currentFilename];
+    }
+    await flushQueue();
+
+    // Lock the file, refreshing before the granted TTL runs out
+    const setLockedUI = (message) => {
+        const text = message || 'Locked by another browser tab/window.';
         textarea.disabled = true;
-        textarea.placeholder = 'Locked by another browser tab/window.';
-        textarea.title = 'Locked by another browser tab/window.';
+        textarea.placeholder = text;
+        textarea.title = text;
     };
 
     // Try to acquire the lock once
     try {
-        const res = await fetch(`/lock?file=${encodeURIComponent(currentFilename)}`, { method: 'POST' });
+        const res = await fetch(`/lock?file=${encodeURIComponent(currentFilename)}&ttl=${lockTTL}`, { method: 'POST', headers: lockHeaders() });
         if (res.status === 201) {
             currentLock = res.headers.get('X-Lock') || '';
         } else {
-            setLockedUI();
+            setLockedUI(await lockedMessage(res));
             return;
         }
     } catch (err) {
@@ -142,16 +321,22 @@ window.addEventListener('DOMContentLoaded', async () => {
         return;
     }
 
-    // Refresh our lock every 500ms; do not auto-reacquire if we lose it
-    setInterval(async () => {
-        if (!currentLock) return;
-        try {
-            await fetch(`/lock?file=${encodeURIComponent(currentFilename)}`, {
-                method: 'POST',
-                headers: { 'X-Lock': currentLock }
-            });
-        } catch (_) {}
-    }, 500);
+    // Refresh our lock unless the socket holds it; do not auto-reacquire
+    // if we lose it
+    const refreshLock = async () => {
+        if (currentLock && !lockSocket) {
+            try {
+                const res = await fetch(`/lock?file=${encodeURIComponent(currentFilename)}&ttl=${lockTTL}`, {
+                    method: 'POST',
+                    headers: lockHeaders(currentLock)
+                });
+                const ttl = parseFloat(res.headers.get('X-Lock-TTL'));
+                if (ttl > 0) lockRefreshMs = ttl * 500;
+            } catch (_) {}
+        }
+        setTimeout(refreshLock, lockRefreshMs);
+    };
+    setTimeout(refreshLock, lockRefreshMs);
 
     // Populate file dropdown
     try {
@@ -172,54 +357,130 @@ window.addEventListener('DOMContentLoaded', async () => {
         }
     } catch (_) {}
 
+    // Save the textarea unless the file changed on disk since it was loaded
+    // or last saved here, e.g. by a stale tab; then ask before overwriting
+    const save = async () => {
+        const headers = {
+            'Content-Type': 'text/plain; charset=utf-8',
+            'X-Filename': currentFilename,
+            'X-Lock': currentLock,
+        };
+        if (currentRevision) headers['If-Match'] = currentRevision;
+        try {
+            const res = await fetch(`/save?file=${encodeURIComponent(currentFilename)}`, {
+                method: 'POST',
+                headers,
+                body: textarea.value
+            });
+            if (res.status === 204) {
+                dirty = false;
+                applyFileHeaders(res.headers);
+                applySavedName(currentFilename, res.headers.get('X-Filename'));
+                // Embedded images were stored as files; show the links
+                if (res.headers.get('X-Content-Rewritten')) reloadFromDisk(currentFilename);
+            } else if (res.status === 423) {
+                console.warn('File locked by another editor; disabling input.');
+                setLockedUI(await lockedMessage(res));
+            } else if (res.status === 412) {
+                const conflict = await res.json().catch(() => ({}));
+                if (confirm(`${currentFilename} changed on disk since you opened it. Overwrite it with your text?`)) {
+                    currentRevision = conflict.etag || '';
+                    await save();
+                } else {
+                    dirty = false;
+                    await reloadFromDisk(currentFilename);
+                }
+            } else {
+                console.warn('Unexpected save response:', res.status);
+            }
+        } catch (err) {
+            // Offline: keep the content and send it when the server is reachable again
+            console.warn('Autosave failed; queued until online:', err);
+            queueSave(currentFilename, textarea.value);
+        }
+    };
+
     // Debounced autosave on input (500ms idle)
     textarea.addEventListener('input', () => {
+        dirty = true;
         if (saveTimer) clearTimeout(saveTimer);
-        saveTimer = setTimeout(async () => {
+        saveTimer = setTimeout(save, 500);
+    });
+
+    // Store images pasted from the clipboard and link them instead
+    textarea.addEventListener('paste', (e) => {
+        const items = e.clipboardData ? Array.from(e.clipboardData.items) : [];
+        const image = items.find((i) => i.kind === 'file' && i.type.startsWith('image/'));
+        if (!image) return;
+        e.preventDefault();
+        const reader = new FileReader();
+        reader.onload = async () => {
             try {
-                const res = await fetch(`/save?file=${encodeURIComponent(currentFilename)}`, {
+                const res = await fetch('/upload', {
                     method: 'POST',
-                    headers: {
-                        'Content-Type': 'text/plain; charset=utf-8',
-                        'X-Filename': currentFilename,
-                        'X-Lock': currentLock,
-                    },
-                    body: textarea.value
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({ files: [{ data: reader.result }] }),
                 });
-                if (res.status === 204) {
-                    updateHtmlNameFromHeaders(res.headers);
-                    const newName = res.headers.get('X-Filename');
-                    if (newName && newName !== currentFilename) {
-                        const oldName = currentFilename;
-                        currentFilename = newName;
-                        document.title = `Minimark - ${newName}`;
-                        if (filepicker) {
-                            let found = false;
-                            for (const o of filepicker.options) {
-                                if (o.value === oldName) {
-                                    o.value = newName; o.textContent = newName; found = true; break;
-                                }
-                            }
-                            if (!found) {
-                                const opt = document.createElement('option');
-                                opt.value = newName; opt.textContent = newName;
-                                filepicker.appendChild(opt);
-                            }
-                            filepicker.value = newName;
-                        }
-                    }
-                } else if (res.status === 423) {
-                    console.warn('File locked by another editor; disabling input.');
-                    setLockedUI();
-                } else {
-                    console.warn('Unexpected save response:', res.status);
+                if (!res.ok) {
+                    console.warn('Upload failed:', res.status);
+                    return;
                 }
+                const { files } = await res.json();
+                textarea.setRangeText(`![](${files[0].path})`, textarea.selectionStart, textarea.selectionEnd, 'end');
+                textarea.dispatchEvent(new Event('input'));
             } catch (err) {
-                console.error('Autosave failed:', err);
+                console.warn('Upload failed:', err);
             }
-        }, 500);
+        };
+        reader.readAsDataURL(image.getAsFile());
     });
 
+    // Pick up changes made to the open file outside the editor, e.g. by a
+    // git pull, unless there are unsaved edits
+    const reloadFromDisk = async (name) => {
+        if (name !== currentFilename || dirty) return;
+        try {
+            const res = await fetch(`/open?file=${encodeURIComponent(name)}`, { cache: 'no-store' });
+            if (!res.ok || name !== currentFilename || dirty) return;
+            const text = await res.text();
+            currentRevision = res.headers.get('X-Revision') || '';
+            if (text === textarea.value) return;
+            const start = textarea.selectionStart, end = textarea.selectionEnd, scroll = textarea.scrollTop;
+            textarea.value = text;
+            textarea.setSelectionRange(Math.min(start, text.length), Math.min(end, text.length));
+            textarea.scrollTop = scroll;
+        } catch (_) {}
+    };
+    if (typeof WebSocket !== 'undefined') {
+        const connect = () => {
+            const ws = new WebSocket(`${location.protocol === 'https:' ? 'wss' : 'ws'}://${location.host}/ws`);
+            ws.onopen = () => {
+                lockSocket = ws;
+                holdLock();
+            };
+            ws.onmessage = (e) => {
+                const msg = JSON.parse(e.data);
+                if (msg.event === 'file') reloadFromDisk(msg.data);
+                if (msg.event === 'hold') {
+                    myOwner = msg.data.owner;
+                    if (!msg.data.held && msg.data.file === currentFilename) {
+                        currentLock = '';
+                        setLockedUI();
+                    }
+                }
+                if (msg.event === 'presence') {
+                    editing = msg.data.filter((p) => p.owner !== myOwner);
+                    showEditing();
+                }
+            };
+            ws.onclose = () => {
+                if (lockSocket === ws) lockSocket = null;
+                setTimeout(connect, 2000);
+            };
+        };
+        connect();
+    }
+
     // Release lock on unload
     window.addEventListener('beforeunload', async () => {
         if (!currentLock) return;
@@ -245,6 +506,7 @@ window.addEventListener('DOMContentLoaded', async () => {
                     });
                 } catch (_) {}
                 currentLock = '';
+                holdLock();
             }
             try {
                 const res = await fetch('/new', { method: 'POST' });
@@ -252,7 +514,7 @@ window.addEventListener('DOMContentLoaded', async () => {
                     console.warn('Failed to create new file:', res.status);
                     return;
                 }
-                updateHtmlNameFromHeaders(res.headers);
+                applyFileHeaders(res.headers);
                 const newName = (await res.text()).trim();
                 currentFilename = newName || 'untitled.md';
                 document.title = `Minimark - ${currentFilename}`;
@@ -267,15 +529,14 @@ window.addEventListener('DOMContentLoaded', async () => {
                     filepicker.value = currentFilename;
                 }
                 // Acquire lock for new file
-                const lres = await fetch(`/lock?file=${encodeURIComponent(currentFilename)}`, { method: 'POST' });
+                const lres = await fetch(`/lock?file=${encodeURIComponent(currentFilename)}&ttl=${lockTTL}`, { method: 'POST', headers: lockHeaders() });
                 if (lres.status === 201) {
                     currentLock = lres.headers.get('X-Lock') || '';
+                    holdLock();
                 } else {
                     // If cannot lock, disable editing
                     textarea.value = '';
-                    textarea.disabled = true;
-                    textarea.placeholder = 'Locked by another browser tab/window.';
-                    textarea.title = 'Locked by another browser tab/window.';
+                    setLockedUI(await lockedMessage(lres));
                     return;
                 }
                 // Start editing the new empty file
@@ -290,6 +551,33 @@ window.addEventListener('DOMContentLoaded', async () => {
         });
     }
 
+    // Search the notes and open the one picked from the results
+    async function findNote() {
+        const q = prompt('Find notes containing:');
+        if (!q || !q.trim()) return;
+        let results = [];
+        try {
+            const res = await fetch(`/search?q=${encodeURIComponent(q)}`, { cache: 'no-store' });
+            if (!res.ok) { alert(await res.text()); return; }
+            results = await res.json();
+        } catch (err) {
+            console.warn('Search failed:', err);
+            return;
+        }
+        if (!results.length) { alert(`No notes contain ${q}.`); return; }
+        let pick = 0;
+        if (results.length > 1) {
+            const list = results.map((r, i) => `${i + 1}. ${r.title || r.file} (${r.file})\n    ${r.snippet}`).join('\n');
+            const answer = prompt(`${list}\n\nOpen which note?`, '1');
+            pick = parseInt(answer, 10) - 1;
+            if (!(pick >= 0 && pick < results.length)) return;
+        }
+        if (filepicker && results[pick].file !== currentFilename) {
+            filepicker.value = results[pick].file;
+            filepicker.dispatchEvent(new Event('change'));
+        }
+    }
+
     // Switch file when picker changes
     if (filepicker) {
         filepicker.addEventListener('change', async () => {
@@ -301,22 +589,25 @@ window.addEventListener('DOMContentLoaded', async () => {
                     await fetch(`/unlock?file=${encodeURIComponent(currentFilename)}`, { method: 'POST', headers: { 'X-Lock': currentLock } });
                 } catch (_) {}
                 currentLock = '';
+                holdLock();
             }
             try {
                 const res = await fetch(`/open?file=${encodeURIComponent(next)}`, { cache: 'no-store' });
                 if (!res.ok) { console.warn('Open failed:', res.status); return; }
-                updateHtmlNameFromHeaders(res.headers);
+                applyFileHeaders(res.headers);
                 const text = await res.text();
                 textarea.value = text;
                 const name = res.headers.get('X-Filename') || next;
                 currentFilename = name;
                 document.title = `Minimark - ${name}`;
+                saveSession();
                 // Acquire lock for selected file
-                const lres = await fetch(`/lock?file=${encodeURIComponent(currentFilename)}`, { method: 'POST' });
+                const lres = await fetch(`/lock?file=${encodeURIComponent(currentFilename)}&ttl=${lockTTL}`, { method: 'POST', headers: lockHeaders() });
                 if (lres.status === 201) {
                     currentLock = lres.headers.get('X-Lock') || '';
+                    holdLock();
                 } else {
-                    setLockedUI();
+                    setLockedUI(await lockedMessage(lres));
                 }
             } catch (err) { console.error('Open error:', err); }
         });
@@ -0,0 +1,39 @@
+// Service worker for the editor: caches the UI shell so the editor opens
+// offline. API calls always go to the network; minimark.js queues saves
+// that fail while offline.
+const CACHE = 'minimark-shell-v1';
+const SHELL = ['/', '/minimark.js', '/neat.css', '/custom.css', '/manifest.webmanifest', '/icon.svg'];
+
+self.addEventListener('install', (event) => {
+    event.waitUntil(caches.open(CACHE).then((cache) => cache.addAll(SHELL)).then(() => self.skipWaiting()));
+});
+
+self.addEventListener('activate', (event) => {
+    event.waitUntil(
+        caches.keys()
+            .then((keys) => Promise.all(keys.filter((k) => k !== CACHE).map((k) => caches.delete(k))))
+            .then(() => self.clients.claim())
+    );
+});
+
+// Network first so a running server always serves the latest UI; fall back
+// to the cached shell when offline.
+self.addEventListener('fetch', (event) => {
+    const req = event.request;
+    if (req.method !== 'GET') return;
+    const url = new URL(req.url);
+    if (url.origin !== self.location.origin) return;
+    const path = req.mode === 'navigate' ? '/' : url.pathname;
+    if (!SHELL.includes(path)) return;
+    event.respondWith(
+        fetch(req)
+            .then((res) => {
+                if (res.ok) {
+                    const copy = res.clone();
+                    caches.open(CACHE).then((cache) => cache.put(path, copy));
+                }
+                return res;
+            })
+            .catch(() => caches.match(path))
+    );
+});
@@ -0,0 +1,63 @@
+// Light/dark theme toggle for exported pages. The server-side default comes
+// from the script's data-default attribute; a reader's choice is remembered
+// in localStorage.
+(function () {
+  var light = document.getElementById('theme-light');
+  var dark = document.getElementById('theme-dark');
+  if (!light || !dark) return;
+  var script = document.currentScript;
+  var fallback = (script && script.getAttribute('data-default')) || 'auto';
+  var key = 'minimarkTheme';
+
+  function stored() {
+    try { return localStorage.getItem(key); } catch (e) { return null; }
+  }
+
+  function apply(theme) {
+    if (theme === 'light') {
+      light.media = 'all';
+      dark.media = 'not all';
+    } else if (theme === 'dark') {
+      light.media = 'not all';
+      dark.media = 'all';
+    } else {
+      theme = 'auto';
+      light.media = '(prefers-color-scheme: light)';
+      dark.media = '(prefers-color-scheme: dark)';
+    }
+    document.documentElement.setAttribute('data-theme', theme);
+  }
+
+  function effective() {
+    var t = document.documentElement.getAttribute('data-theme');
+    if (t === 'light' || t === 'dark') return t;
+    return window.matchMedia && window.matchMedia('(prefers-color-scheme: dark)').matches ? 'dark' : 'light';
+  }
+
+  function toggle(e) {
+    if (e) e.preventDefault();
+    var next = effective() === 'dark' ? 'light' : 'dark';
+    try { localStorage.setItem(key, next); } catch (err) {}
+    apply(next);
+  }
+
+  apply(stored() || fallback);
+
+  document.addEventListener('DOMContentLoaded', function () {
+    var toggles = document.querySelectorAll('[data-theme-toggle]');
+    if (toggles.length === 0) {
+      var btn = document.createElement('button');
+      btn.type = 'button';
+      btn.className = 'theme-toggle';
+      btn.setAttribute('data-theme-toggle', '');
+      btn.setAttribute('aria-label', 'Toggle dark mode');
+      btn.textContent = '◐';
+      btn.style.cssText = 'position:fixed;top:.75em;right:.75em;cursor:pointer';
+      document.body.appendChild(btn);
+      toggles = [btn];
+    }
+    for (var i = 0; i < toggles.length; i++) {
+      toggles[i].addEventListener('click', toggle);
+    }
+  });
+})();
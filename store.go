@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// --------- Persistent operational state ---------
+
+// statePath is where locks, sessions, pins, and recent files are persisted.
+// It is set at startup; when empty, state lives in memory only.
+var statePath string
+
+// stateFlushDelay coalesces bursts of changes (e.g. lock refreshes) into a
+// single write.
+const stateFlushDelay = 250 * time.Millisecond
+
+// maxRecent bounds the recently opened files list.
+const maxRecent = 20
+
+type persistedState struct {
+	Locks    map[string]persistedLock `json:"locks"`
+	Sessions map[string]sessionState  `json:"sessions"`
+	Pins     []string                 `json:"pins"`
+	Recent   []string                 `json:"recent"`
+}
+
+type persistedLock struct {
+	Token   string        `json:"token"`
+	Expires time.Time     `json:"expires"`
+	TTL     time.Duration `json:"ttl,omitempty"`
+	Editor  string        `json:"editor,omitempty"`
+	Since   time.Time     `json:"since"`
+}
+
+var (
+	pins    []string // pinned files, in pin order
+	recent  []string // recently opened files, newest first
+	prefsMu sync.Mutex
+
+	flushMu    sync.Mutex
+	flushTimer *time.Timer // the scheduled write, nil when none
+	flushPath  string      // where the scheduled write goes
+	flushing   sync.WaitGroup
+)
+
+// loadState restores persisted state from statePath. Expired locks are
+// dropped.
+func loadState() error {
+	b, err := os.ReadFile(wsPath(statePath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var st persistedState
+	if err := json.Unmarshal(b, &st); err != nil {
+		return err
+	}
+	now := time.Now()
+	locksMu.Lock()
+	for name, l := range st.Locks {
+		if now.Before(l.Expires) {
+			locks[name] = lockInfo{token: l.Token, expires: l.Expires, ttl: l.TTL, editor: l.Editor, since: l.Since}
+		}
+	}
+	locksMu.Unlock()
+	sessionsMu.Lock()
+	for id, s := range st.Sessions {
+		sessions[id] = s
+	}
+	sessionsMu.Unlock()
+	prefsMu.Lock()
+	pins, recent = st.Pins, st.Recent
+	prefsMu.Unlock()
+	return nil
+}
+
+// stateChanged schedules a write of the persisted state. It is safe to call
+// while holding any of the state mutexes.
+func stateChanged() {
+	if statePath == "" {
+		return
+	}
+	flushMu.Lock()
+	defer flushMu.Unlock()
+	if flushTimer != nil {
+		return
+	}
+	// The path is fixed now, in case statePath changes before the write
+	path := wsPath(statePath)
+	flushPath = path
+	flushing.Add(1)
+	flushTimer = time.AfterFunc(stateFlushDelay, func() {
+		defer flushing.Done()
+		flushMu.Lock()
+		flushTimer = nil
+		flushMu.Unlock()
+		if err := saveStateTo(path); err != nil {
+			log.Printf("state not saved: %v", err)
+		}
+	})
+}
+
+// flushState writes a scheduled state change straight away and waits for
+// any write already under way.
+func flushState() {
+	flushMu.Lock()
+	t, path := flushTimer, flushPath
+	flushTimer = nil
+	flushMu.Unlock()
+	if t != nil && t.Stop() {
+		if err := saveStateTo(path); err != nil {
+			log.Printf("state not saved: %v", err)
+		}
+		flushing.Done()
+	}
+	flushing.Wait()
+}
+
+// saveState writes a snapshot of the current state to statePath.
+func saveState() error {
+	return saveStateTo(wsPath(statePath))
+}
+
+// saveStateTo writes a snapshot of the current state to path.
+func saveStateTo(path string) error {
+	st := persistedState{Locks: map[string]persistedLock{}, Sessions: map[string]sessionState{}}
+	locksMu.Lock()
+	for name, li := range locks {
+		st.Locks[name] = persistedLock{Token: li.token, Expires: li.expires, TTL: li.ttl, Editor: li.editor, Since: li.since}
+	}
+	locksMu.Unlock()
+	sessionsMu.Lock()
+	for id, s := range sessions {
+		st.Sessions[id] = s
+	}
+	sessionsMu.Unlock()
+	prefsMu.Lock()
+	st.Pins = append([]string(nil), pins...)
+	st.Recent = append([]string(nil), recent...)
+	prefsMu.Unlock()
+
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// Write then rename so a crash never leaves a truncated file. The state
+	// holds lock and session tokens, so only the owner may read it; a
+	// leftover temporary file would keep its old mode, so it goes first
+	tmp := path + ".tmp"
+	_ = os.Remove(tmp)
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// noteRecent moves name to the front of the recently opened list.
+func noteRecent(name string) {
+	prefsMu.Lock()
+	recent = prependUnique(recent, name, maxRecent)
+	prefsMu.Unlock()
+	stateChanged()
+}
+
+func prependUnique(list []string, name string, max int) []string {
+	out := []string{name}
+	for _, n := range list {
+		if n != name && len(out) < max {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// handleRecent returns the recently opened files as JSON, newest first.
+func handleRecent(w http.ResponseWriter, r *http.Request) {
+	prefsMu.Lock()
+	list := append([]string{}, recent...)
+	prefsMu.Unlock()
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(list)
+}
+
+// handlePins lists pinned files (GET), pins a file (POST ?file=), or unpins
+// it (DELETE ?file=).
+func handlePins(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		name := r.URL.Query().Get("file")
+		if name == "" || filepath.Base(name) != name {
+			http.Error(w, "invalid filename", http.StatusBadRequest)
+			return
+		}
+		prefsMu.Lock()
+		switch r.Method {
+		case http.MethodPost:
+			found := false
+			for _, p := range pins {
+				found = found || p == name
+			}
+			if !found {
+				pins = append(pins, name)
+			}
+		case http.MethodDelete:
+			kept := pins[:0]
+			for _, p := range pins {
+				if p != name {
+					kept = append(kept, p)
+				}
+			}
+			pins = kept
+		default:
+			prefsMu.Unlock()
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		prefsMu.Unlock()
+		stateChanged()
+	}
+	prefsMu.Lock()
+	list := append([]string{}, pins...)
+	prefsMu.Unlock()
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(list)
+}
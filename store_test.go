@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestState_SaveAndLoad(t *testing.T) {
+	dir := chdirTemp(t)
+	locks = map[string]lockInfo{
+		"live.md":    {token: "t1", expires: time.Now().Add(time.Hour)},
+		"expired.md": {token: "t2", expires: time.Now().Add(-time.Second)},
+	}
+	sessions = map[string]sessionState{"laptop": {Active: "live.md"}}
+	pins, recent = []string{"p.md"}, []string{"r.md"}
+
+	statePath = filepath.Join(dir, ".minimark", "state.json")
+	t.Cleanup(func() { statePath = "" })
+	if err := saveState(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("state file mode %v, want 0600", info.Mode().Perm())
+	}
+
+	locks = make(map[string]lockInfo)
+	sessions = make(map[string]sessionState)
+	pins, recent = nil, nil
+	if err := loadState(); err != nil {
+		t.Fatal(err)
+	}
+	statePath = ""
+	if li, ok := locks["live.md"]; !ok || li.token != "t1" {
+		t.Fatalf("live lock not restored: %v", locks)
+	}
+	if _, ok := locks["expired.md"]; ok {
+		t.Fatalf("expired lock should be dropped")
+	}
+	if sessions["laptop"].Active != "live.md" {
+		t.Fatalf("sessions = %v", sessions)
+	}
+	if !reflect.DeepEqual(pins, []string{"p.md"}) || !reflect.DeepEqual(recent, []string{"r.md"}) {
+		t.Fatalf("pins = %v recent = %v", pins, recent)
+	}
+}
+
+func TestHandleLock_PersistsRefresh(t *testing.T) {
+	dir := chdirTemp(t)
+	locks = make(map[string]lockInfo)
+	statePath = filepath.Join(dir, ".minimark", "state.json")
+	t.Cleanup(func() {
+		flushState()
+		statePath = ""
+	})
+	lock := func(target, tok string) string {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, target, nil)
+		req.Header.Set("X-Lock", tok)
+		handleLock(rr, req)
+		return rr.Header().Get("X-Lock")
+	}
+	persisted := func() persistedLock {
+		flushState()
+		b, err := os.ReadFile(statePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var st persistedState
+		if err := json.Unmarshal(b, &st); err != nil {
+			t.Fatal(err)
+		}
+		return st.Locks["a.md"]
+	}
+
+	tok := lock("/lock?file=a.md", "")
+	first := persisted()
+	// Refreshing with a new TTL is written out as well
+	lock("/lock?file=a.md&ttl=30", tok)
+	if l := persisted(); l.TTL != 30*time.Second || !l.Expires.After(first.Expires) {
+		t.Errorf("refresh not persisted: %+v, first %+v", l, first)
+	}
+}
+
+func TestLoadState_Missing(t *testing.T) {
+	dir := chdirTemp(t)
+	statePath = filepath.Join(dir, "missing.json")
+	t.Cleanup(func() { statePath = "" })
+	if err := loadState(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func decodeList(t *testing.T, rr *httptest.ResponseRecorder) []string {
+	t.Helper()
+	var list []string
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+func TestHandlePins(t *testing.T) {
+	pins = nil
+	for _, step := range []struct {
+		method, url string
+		want        []string
+	}{
+		{http.MethodPost, "/pins?file=a.md", []string{"a.md"}},
+		{http.MethodPost, "/pins?file=b.md", []string{"a.md", "b.md"}},
+		{http.MethodPost, "/pins?file=a.md", []string{"a.md", "b.md"}},
+		{http.MethodDelete, "/pins?file=a.md", []string{"b.md"}},
+		{http.MethodGet, "/pins", []string{"b.md"}},
+	} {
+		rr := httptest.NewRecorder()
+		handlePins(rr, httptest.NewRequest(step.method, step.url, nil))
+		if got := decodeList(t, rr); !reflect.DeepEqual(got, step.want) {
+			t.Fatalf("%s %s = %v; want %v", step.method, step.url, got, step.want)
+		}
+	}
+	rr := httptest.NewRecorder()
+	handlePins(rr, httptest.NewRequest(http.MethodPost, "/pins?file=../x.md", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("got %d", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	handlePins(rr, httptest.NewRequest(http.MethodPut, "/pins?file=x.md", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("got %d", rr.Code)
+	}
+}
+
+func TestRecentTracksOpens(t *testing.T) {
+	chdirTemp(t)
+	recent = nil
+	writeFiles(t, map[string]string{"a.md": "a", "b.md": "b"})
+	for _, f := range []string{"a.md", "b.md", "a.md"} {
+		openLastMarkdown(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/open?file="+f, nil))
+	}
+	rr := httptest.NewRecorder()
+	handleRecent(rr, httptest.NewRequest(http.MethodGet, "/recent", nil))
+	if got := decodeList(t, rr); !reflect.DeepEqual(got, []string{"a.md", "b.md"}) {
+		t.Fatalf("recent = %v", got)
+	}
+	if got := prependUnique([]string{"a", "b", "c"}, "d", 3); !reflect.DeepEqual(got, []string{"d", "a", "b"}) {
+		t.Fatalf("prependUnique = %v", got)
+	}
+}
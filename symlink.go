@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Symlink policies for workspace scans and the recursive _includes copy.
+const (
+	symlinksFollow = "follow" // resolve links, skipping broken ones and cycles
+	symlinksSkip   = "skip"   // ignore links entirely
+)
+
+var symlinkPolicy = symlinksFollow // set from the -symlinks flag
+
+func validSymlinkPolicy(p string) error {
+	if p != symlinksFollow && p != symlinksSkip {
+		return fmt.Errorf("invalid symlink policy %q (want %q or %q)", p, symlinksFollow, symlinksSkip)
+	}
+	return nil
+}
+
+// resolveEntry applies the symlink policy to a directory entry found in dir.
+// It returns the info of the entry (or of its target when following a link)
+// and false if the entry should be skipped.
+func resolveEntry(dir string, e fs.DirEntry) (fs.FileInfo, bool) {
+	if e.Type()&fs.ModeSymlink == 0 {
+		info, err := e.Info()
+		return info, err == nil
+	}
+	if symlinkPolicy == symlinksSkip {
+		return nil, false
+	}
+	info, err := os.Stat(wsPath(filepath.Join(dir, e.Name())))
+	if err != nil {
+		// Broken link
+		return nil, false
+	}
+	return info, true
+}
+
+// realDir returns the symlink-free absolute path of dir, used to detect
+// cycles when following directory links.
+func realDir(dir string) string {
+	p, err := filepath.EvalSymlinks(wsPath(dir))
+	if err != nil {
+		return dir
+	}
+	if abs, err := filepath.Abs(wsPath(p)); err == nil {
+		return abs
+	}
+	return p
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func withSymlinkPolicy(t *testing.T, p string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows")
+	}
+	prev := symlinkPolicy
+	symlinkPolicy = p
+	t.Cleanup(func() { symlinkPolicy = prev })
+}
+
+func TestValidSymlinkPolicy(t *testing.T) {
+	if validSymlinkPolicy("follow") != nil || validSymlinkPolicy("skip") != nil {
+		t.Fatalf("expected valid policies")
+	}
+	if validSymlinkPolicy("maybe") == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestCopyTree_FollowSymlinksWithCycle(t *testing.T) {
+	withSymlinkPolicy(t, symlinksFollow)
+	chdirTemp(t)
+	shared := t.TempDir()
+	if err := os.WriteFile(filepath.Join(shared, "s.css"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join("src", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Linked shared folder, a cycle back to src, and a broken link
+	if err := os.Symlink(shared, filepath.Join("src", "shared")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("..", filepath.Join("src", "sub", "loop")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("missing", filepath.Join("src", "broken")); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyTree("src", "dst"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join("dst", "shared", "s.css")); err != nil {
+		t.Fatalf("linked folder not copied: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join("dst", "sub", "loop")); !os.IsNotExist(err) {
+		t.Fatalf("cycle should be skipped")
+	}
+	if _, err := os.Lstat(filepath.Join("dst", "broken")); !os.IsNotExist(err) {
+		t.Fatalf("broken link should be skipped")
+	}
+}
+
+func TestCopyTree_FollowSymlinksDiamond(t *testing.T) {
+	withSymlinkPolicy(t, symlinksFollow)
+	chdirTemp(t)
+	shared := t.TempDir()
+	if err := os.WriteFile(filepath.Join(shared, "s.css"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll("src", 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Two links to the same folder are not a cycle; both are copied
+	for _, name := range []string{"a", "b"} {
+		if err := os.Symlink(shared, filepath.Join("src", name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := copyTree("src", "dst"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b"} {
+		if _, err := os.Stat(filepath.Join("dst", name, "s.css")); err != nil {
+			t.Errorf("%s not copied: %v", name, err)
+		}
+	}
+}
+
+func TestCopyTree_SkipSymlinks(t *testing.T) {
+	withSymlinkPolicy(t, symlinksSkip)
+	chdirTemp(t)
+	if err := os.MkdirAll("src", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(t.TempDir(), filepath.Join("src", "shared")); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyTree("src", "dst"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join("dst", "shared")); !os.IsNotExist(err) {
+		t.Fatalf("symlink should be skipped")
+	}
+}
+
+func TestListMarkdownFiles_SymlinkPolicy(t *testing.T) {
+	withSymlinkPolicy(t, symlinksFollow)
+	chdirTemp(t)
+	target := filepath.Join(t.TempDir(), "t.md")
+	if err := os.WriteFile(target, []byte("t"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, "linked.md"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("nowhere.md", "broken.md"); err != nil {
+		t.Fatal(err)
+	}
+	files, err := listMarkdownFiles(".")
+	if err != nil || len(files) != 1 || files[0] != "linked.md" {
+		t.Fatalf("follow: files = %v err=%v", files, err)
+	}
+	symlinkPolicy = symlinksSkip
+	files, err = listMarkdownFiles(".")
+	if err != nil || len(files) != 0 {
+		t.Fatalf("skip: files = %v err=%v", files, err)
+	}
+}
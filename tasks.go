@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// task is a GFM task list item found in a note.
+type task struct {
+	File string   `json:"file"`
+	Line int      `json:"line"` // 1-based, counting front matter
+	Text string   `json:"text"`
+	Done bool     `json:"done"`
+	Due  string   `json:"due,omitempty"`
+	Tags []string `json:"tags,omitempty"` // the note's tags and #tags in the item
+}
+
+var (
+	taskItemRe = regexp.MustCompile(`^\s*(?:[-*+]|\d+[.)])\s+\[([ xX])\]\s+(.*)$`)
+	// taskDueRe matches due dates written as due:2024-05-01,
+	// @due(2024-05-01) or 📅 2024-05-01.
+	taskDueRe = regexp.MustCompile(`(?:\bdue:\s*|@due\(|📅\s*)(\d{4}-\d{2}-\d{2})\)?`)
+	taskTagRe = regexp.MustCompile(`(?:^|\s)#([\p{L}\p{N}_/-]+)`)
+)
+
+// noteTasks returns the task items in the note name, skipping fenced code.
+func noteTasks(name string, md []byte) []task {
+	fields, _ := parseFrontMatter(md)
+	noteTags := frontMatterList(fields["tags"])
+	var tasks []task
+	inFence := false
+	for i, line := range strings.Split(string(md), "\n") {
+		t := strings.TrimSpace(line)
+		if strings.HasPrefix(t, "```") || strings.HasPrefix(t, "~~~") {
+			inFence = !inFence
+			continue
+		}
+		m := taskItemRe.FindStringSubmatch(strings.TrimRight(line, "\r"))
+		if inFence || m == nil {
+			continue
+		}
+		it := task{File: name, Line: i + 1, Text: strings.TrimSpace(m[2]), Done: m[1] != " "}
+		if d := taskDueRe.FindStringSubmatch(it.Text); d != nil {
+			it.Due = d[1]
+		}
+		it.Tags = append(it.Tags, noteTags...)
+		for _, tag := range taskTagRe.FindAllStringSubmatch(it.Text, -1) {
+			it.Tags = append(it.Tags, tag[1])
+		}
+		tasks = append(tasks, it)
+	}
+	return tasks
+}
+
+// handleTasks lists the task items across the workspace as JSON, in file
+// and line order:
+//
+//	GET /tasks?status=open&tag=work&due=2024-05-31
+//
+// status is open, done or all (the default); tag keeps items in notes with
+// that tag or carrying it as a #tag; due keeps items due on or before that
+// date.
+func handleTasks(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	status := q.Get("status")
+	if status != "" && status != "open" && status != "done" && status != "all" {
+		http.Error(w, "status must be open, done or all", http.StatusBadRequest)
+		return
+	}
+	due := q.Get("due")
+	if due != "" {
+		if _, err := time.Parse("2006-01-02", due); err != nil {
+			http.Error(w, "due must be a date like 2024-05-31", http.StatusBadRequest)
+			return
+		}
+	}
+	tag := strings.TrimPrefix(q.Get("tag"), "#")
+	files, err := docIndex.listing(".")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tasks := []task{}
+	for _, name := range files {
+		md, err := readNote(name)
+		if err != nil {
+			continue
+		}
+		for _, it := range noteTasks(name, md) {
+			switch {
+			case status == "open" && it.Done, status == "done" && !it.Done:
+			case tag != "" && !hasTag(it.Tags, tag):
+			case due != "" && (it.Due == "" || it.Due > due):
+			default:
+				tasks = append(tasks, it)
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(tasks)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNoteTasks(t *testing.T) {
+	md := "---\ntags: [work]\n---\n# Plan\n\n- [ ] Write report due:2024-05-01 #writing\n- [x] Book room\n1. [ ] Call @due(2024-04-02)\n* [X] 📅 2024-03-01 done\n\n```\n- [ ] not a task\n```\n- [] nor this\n"
+	got := noteTasks("plan.md", []byte(md))
+	if len(got) != 4 {
+		t.Fatalf("tasks = %+v", got)
+	}
+	want := []struct {
+		line int
+		done bool
+		due  string
+	}{{6, false, "2024-05-01"}, {7, true, ""}, {8, false, "2024-04-02"}, {9, true, "2024-03-01"}}
+	for i, w := range want {
+		if got[i].Line != w.line || got[i].Done != w.done || got[i].Due != w.due {
+			t.Errorf("task %d = %+v, want %+v", i, got[i], w)
+		}
+	}
+	if got[0].Text != "Write report due:2024-05-01 #writing" || !hasTag(got[0].Tags, "work") || !hasTag(got[0].Tags, "writing") {
+		t.Errorf("first task = %+v", got[0])
+	}
+}
+
+func TestHandleTasks(t *testing.T) {
+	chdirTemp(t)
+	writeFiles(t, map[string]string{
+		"a.md": "- [ ] open task due:2024-05-01\n- [x] finished\n",
+		"b.md": "---\ntags: [home]\n---\n- [ ] fix sink\n- [ ] later #errand due:2024-09-01\n",
+	})
+	get := func(query string) []task {
+		rr := httptest.NewRecorder()
+		handleTasks(rr, httptest.NewRequest(http.MethodGet, "/tasks?"+query, nil))
+		var tasks []task
+		if err := json.Unmarshal(rr.Body.Bytes(), &tasks); err != nil {
+			t.Fatalf("%s: %v: %s", query, err, rr.Body.String())
+		}
+		return tasks
+	}
+	for query, want := range map[string]int{
+		"":                                    4,
+		"status=open":                         3,
+		"status=done":                         1,
+		"tag=home":                            2,
+		"tag=%23errand":                       1,
+		"due=2024-06-30":                      1,
+		"status=open&tag=home&due=2024-12-31": 1,
+	} {
+		if got := get(query); len(got) != want {
+			t.Errorf("%q: %d tasks, want %d: %+v", query, len(got), want, got)
+		}
+	}
+	if got := get(""); got[0].File != "a.md" || got[0].Line != 1 || got[3].File != "b.md" || got[3].Line != 5 {
+		t.Errorf("order: %+v", got)
+	}
+	rr := httptest.NewRecorder()
+	handleTasks(rr, httptest.NewRequest(http.MethodGet, "/tasks?status=maybe", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("bad status: %d", rr.Code)
+	}
+}
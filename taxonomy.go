@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// taxonomyConfig declares a custom taxonomy such as "authors": pages list
+// their terms in a front matter field, and exports get an index of the
+// terms plus a page per term.
+type taxonomyConfig struct {
+	// Name is the taxonomy's folder inside docs, e.g. "authors".
+	Name string `json:"name"`
+	// Field is the front matter field holding the terms (default: Name).
+	// Like tags, it takes one term or a list: "author: [Ann, Bob]".
+	Field string `json:"field,omitempty"`
+	// Title heads the index page (default: Name, capitalized).
+	Title string `json:"title,omitempty"`
+}
+
+var taxonomyNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// reservedTaxonomies are the docs folders minimark already writes.
+var reservedTaxonomies = []string{archiveDir, categoryDir, seriesDir, readerDir, uploadsDir}
+
+func validateTaxonomies(list []taxonomyConfig, languages []string) error {
+	seen := map[string]bool{}
+	for _, t := range list {
+		if !taxonomyNameRe.MatchString(t.Name) {
+			return fmt.Errorf("taxonomies: invalid name %q", t.Name)
+		}
+		for _, r := range reservedTaxonomies {
+			if t.Name == r {
+				return fmt.Errorf("taxonomies: %q is reserved", t.Name)
+			}
+		}
+		for _, l := range languages {
+			if t.Name == l {
+				return fmt.Errorf("taxonomies: %q is a language folder", t.Name)
+			}
+		}
+		if seen[t.Name] {
+			return fmt.Errorf("taxonomies: %q declared twice", t.Name)
+		}
+		seen[t.Name] = true
+	}
+	return nil
+}
+
+func (t taxonomyConfig) field() string {
+	if t.Field != "" {
+		return t.Field
+	}
+	return t.Name
+}
+
+func (t taxonomyConfig) title() string {
+	if t.Title != "" {
+		return t.Title
+	}
+	return strings.ToUpper(t.Name[:1]) + t.Name[1:]
+}
+
+// termSlug names a term's folder. Terms with the same slug share a page.
+func termSlug(term string) string {
+	if s := strings.Trim(slugify(term), "-"); s != "" {
+		return s
+	}
+	if s := url.PathEscape(strings.ToLower(term)); strings.Trim(s, ".") != "" {
+		return s
+	}
+	return "term"
+}
+
+// taxonomyTerm is one term and the pages using it; the first spelling seen
+// is shown.
+type taxonomyTerm struct {
+	name  string
+	slug  string
+	pages []docMeta
+}
+
+// taxonomyTerms groups docs by their terms in taxonomy t, ordered by name.
+func taxonomyTerms(docs []docMeta, t taxonomyConfig) []*taxonomyTerm {
+	bySlug := map[string]*taxonomyTerm{}
+	var terms []*taxonomyTerm
+	for _, d := range docs {
+		fields := readFileFrontMatter(d.Name)
+		seen := map[string]bool{}
+		for _, name := range frontMatterList(fields[t.field()]) {
+			slug := termSlug(name)
+			if seen[slug] {
+				continue
+			}
+			seen[slug] = true
+			term, ok := bySlug[slug]
+			if !ok {
+				term = &taxonomyTerm{name: name, slug: slug}
+				bySlug[slug] = term
+				terms = append(terms, term)
+			}
+			term.pages = append(term.pages, d)
+		}
+	}
+	sort.Slice(terms, func(i, j int) bool { return strings.ToLower(terms[i].name) < strings.ToLower(terms[j].name) })
+	for _, term := range terms {
+		sort.Slice(term.pages, func(i, j int) bool {
+			return strings.ToLower(docTitle(term.pages[i])) < strings.ToLower(docTitle(term.pages[j]))
+		})
+	}
+	return terms
+}
+
+// writeTaxonomies exports docs/<taxonomy>/index.html, listing the terms of
+// every configured taxonomy with their page counts, and
+// docs/<taxonomy>/<term>/index.html listing each term's pages.
+func writeTaxonomies(cmark, docsDir string) {
+	if len(config.Taxonomies) == 0 {
+		return
+	}
+	docs, err := docIndex.refresh(".")
+	if err != nil {
+		log.Printf("taxonomy pages not written: %v", err)
+		return
+	}
+	docs = publishedDocs(docs)
+	for _, t := range config.Taxonomies {
+		root := filepath.Join(docsDir, t.Name)
+		_ = os.RemoveAll(wsPath(root)) // drop terms that no longer have pages
+		terms := taxonomyTerms(docs, t)
+
+		var index strings.Builder
+		fmt.Fprintf(&index, "# %s\n\n", t.title())
+		for _, term := range terms {
+			fmt.Fprintf(&index, "- [%s](%s/%s/index.html) (%d)\n", markdownLinkText(term.name), t.Name, term.slug, len(term.pages))
+		}
+		page, err := nestedPage(cmark, "../", index.String())
+		writeNestedPage(filepath.Join(root, "index.html"), page, err)
+
+		for _, term := range terms {
+			var md strings.Builder
+			fmt.Fprintf(&md, "# %s\n\n[%s](%s/index.html)\n\n", term.name, markdownLinkText(t.title()), t.Name)
+			for _, d := range term.pages {
+				fmt.Fprintf(&md, "- [%s](%s)\n", markdownLinkText(docTitle(d)), htmlOutNameFor(d.Name))
+			}
+			page, err := nestedPage(cmark, "../../", md.String())
+			writeNestedPage(filepath.Join(root, filepath.FromSlash(term.slug), "index.html"), page, err)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateTaxonomies(t *testing.T) {
+	if err := validateTaxonomies([]taxonomyConfig{{Name: "authors"}, {Name: "products", Field: "product"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range [][]taxonomyConfig{
+		{{Name: "Authors"}}, {{Name: "../x"}}, {{Name: ""}}, {{Name: categoryDir}}, {{Name: readerDir}}, {{Name: uploadsDir}},
+		{{Name: "de"}}, {{Name: "authors"}, {Name: "authors"}},
+	} {
+		if err := validateTaxonomies(bad, []string{"en", "de"}); err == nil {
+			t.Errorf("%+v: expected error", bad)
+		}
+	}
+}
+
+func TestWriteTaxonomies(t *testing.T) {
+	chdirTemp(t)
+	docIndex = &metaIndex{}
+	withConfig(t, siteConfig{Taxonomies: []taxonomyConfig{{Name: "authors", Field: "author"}}})
+	writeFiles(t, map[string]string{
+		"a.md": "---\nauthor: [Ann Lee, \"Bob\"]\n---\n# Alpha",
+		"b.md": "---\nauthor: ann lee\n---\n# Beta",
+		"c.md": "# Anonymous",
+	})
+	if err := os.MkdirAll(filepath.Join("docs", "authors", "gone"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTaxonomies(echoCmark(t), "docs")
+
+	read := func(parts ...string) string {
+		b, err := os.ReadFile(filepath.Join(append([]string{"docs", "authors"}, parts...)...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	wantIndex := "<base href=\"../\">\n# Authors\n\n- [Ann Lee](authors/ann-lee/index.html) (2)\n- [Bob](authors/bob/index.html) (1)\n"
+	if got := read("index.html"); got != wantIndex {
+		t.Fatalf("index = %q", got)
+	}
+	wantAnn := "<base href=\"../../\">\n# Ann Lee\n\n[Authors](authors/index.html)\n\n- [Alpha](a.html)\n- [Beta](b.html)\n"
+	if got := read("ann-lee", "index.html"); got != wantAnn {
+		t.Fatalf("ann = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join("docs", "authors", "gone")); !os.IsNotExist(err) {
+		t.Fatalf("stale term folder kept: %v", err)
+	}
+}
+
+func TestTermSlug(t *testing.T) {
+	for in, want := range map[string]string{"Widget Pro": "widget-pro", "日本": "%E6%97%A5%E6%9C%AC", "..": "term"} {
+		if got := termSlug(in); got != want {
+			t.Errorf("termSlug(%q) = %q; want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// siteTheme names the bundled theme used for exports when the workspace has
+// no _includes directory. Empty means pages are exported unwrapped.
+var siteTheme string
+
+// bundledThemes are the looks embedded under static/themes.
+var bundledThemes = []string{"docs", "blog", "plain"}
+
+func validSiteTheme(t string) error {
+	if t == "" {
+		return nil
+	}
+	for _, b := range bundledThemes {
+		if t == b {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown theme %q (want one of %v)", t, bundledThemes)
+}
+
+// pageIncludes returns the header and footer that wrap the exported page
+// name. Each comes from the nearest _includes directory that has it (see
+// includesDirs), with its partials expanded; when there is no _includes at
+// the root, the bundled theme's fill in.
+func pageIncludes(name string) (header, footer []byte) {
+	dirs := includesDirs(name)
+	header = readInclude(dirs, "header.html")
+	footer = readInclude(dirs, "footer.html")
+	if _, err := os.Stat(wsPath("_includes")); os.IsNotExist(err) && siteTheme != "" {
+		dir := path.Join("static", "themes", siteTheme)
+		if header == nil {
+			header, _ = embeddedIncludes.ReadFile(path.Join(dir, "header.html"))
+		}
+		if footer == nil {
+			footer, _ = embeddedIncludes.ReadFile(path.Join(dir, "footer.html"))
+		}
+	}
+	if header != nil {
+		header = expandPartials(header, dirs)
+	}
+	if footer != nil {
+		footer = expandPartials(footer, dirs)
+	}
+	return header, footer
+}
+
+// includesDirs returns the _includes directories that apply to the page
+// name, nearest first: those in the page's folder and each folder above it,
+// then the root _includes. A folder's includes override the ones above it
+// for every page in its subtree.
+func includesDirs(name string) []string {
+	var dirs []string
+	if name != "" && filepath.IsLocal(name) {
+		for dir := filepath.Dir(name); dir != "."; dir = filepath.Dir(dir) {
+			p := filepath.Join(dir, "_includes")
+			if info, err := os.Stat(wsPath(p)); err == nil && info.IsDir() {
+				dirs = append(dirs, p)
+			}
+		}
+	}
+	return append(dirs, "_includes")
+}
+
+// readInclude returns the contents of file from the first of dirs that has
+// it, or nil.
+func readInclude(dirs []string, file string) []byte {
+	for _, d := range dirs {
+		if b, err := os.ReadFile(wsPath(filepath.Join(d, file))); err == nil {
+			return b
+		}
+	}
+	return nil
+}
+
+// copyThemeAssets writes the bundled theme's stylesheets and other assets
+// (everything but its header and footer) into dstDir.
+func copyThemeAssets(dstDir string) error {
+	dir := path.Join("static", "themes", siteTheme)
+	return fs.WalkDir(embeddedIncludes, dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel := p[len(dir):]
+		if rel == "/header.html" || rel == "/footer.html" {
+			return nil
+		}
+		dst := filepath.Join(dstDir, filepath.FromSlash(rel))
+		if d.IsDir() {
+			return os.MkdirAll(wsPath(dst), 0755)
+		}
+		b, err := embeddedIncludes.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(wsPath(dst), b, 0644)
+	})
+}
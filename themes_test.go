@@ -0,0 +1,121 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func withSiteTheme(t *testing.T, theme string) {
+	t.Helper()
+	siteTheme = theme
+	t.Cleanup(func() { siteTheme = "" })
+}
+
+func TestRenderPage_BundledTheme(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows")
+	}
+	chdirTemp(t)
+	withSiteTheme(t, "blog")
+	script := filepath.Join(t.TempDir(), "cmark.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho '<p>Body</p>'\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	page, err := renderPage(script, []byte("# Fish & Chips\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"<title>Fish &amp; Chips</title>", `href="theme.css"`, `class="theme-blog"`, "data-theme-toggle", "<p>Body</p>", "</html>"} {
+		if !strings.Contains(string(page), want) {
+			t.Fatalf("page missing %q:\n%s", want, page)
+		}
+	}
+
+	// An _includes directory overrides the theme, even when empty
+	if err := os.MkdirAll("_includes", 0755); err != nil {
+		t.Fatal(err)
+	}
+	page, err = renderPage(script, []byte("# T\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(page)); got != "<p>Body</p>" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestCopyIncludesToDocs_BundledTheme(t *testing.T) {
+	chdirTemp(t)
+	withSiteTheme(t, "docs")
+	if err := copyIncludesToDocs("_includes", "docs"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"theme.css", "print.css", "theme.js"} {
+		if _, err := os.Stat(filepath.Join("docs", name)); err != nil {
+			t.Fatalf("%s not copied: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join("docs", "header.html")); !os.IsNotExist(err) {
+		t.Fatalf("theme header should not be copied")
+	}
+	// The theme's own palettes win over the generic defaults
+	b, _ := os.ReadFile(filepath.Join("docs", "theme-dark.css"))
+	if !strings.Contains(string(b), "docs theme") {
+		t.Fatalf("theme-dark.css is not the theme's: %q", b)
+	}
+}
+
+func TestValidSiteTheme(t *testing.T) {
+	for _, th := range append([]string{""}, bundledThemes...) {
+		if err := validSiteTheme(th); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if validSiteTheme("fancy") == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestRenderPageAs_DirectoryIncludes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows")
+	}
+	chdirTemp(t)
+	for p, body := range map[string]string{
+		"_includes/header.html":               "<header>root</header>",
+		"_includes/footer.html":               "<footer>root</footer>",
+		"_includes/partials/nav.html":         "<nav>root</nav>",
+		"blog/_includes/header.html":          `<header>blog {{template "nav" .}}</header>`,
+		"blog/_includes/partials/nav.html":    "<nav>blog</nav>",
+		"blog/drafts/_includes/footer.html":   "<footer>drafts</footer>",
+		"docs-src/guide/_includes/.gitignore": "",
+	} {
+		os.MkdirAll(filepath.Dir(p), 0755)
+		os.WriteFile(p, []byte(body), 0644)
+	}
+	script := filepath.Join(t.TempDir(), "cmark.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho '<p>Body</p>'\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string][]string{
+		"index.md":             {"<header>root</header>", "<footer>root</footer>"},
+		"blog/post.md":         {"<header>blog <nav>blog</nav></header>", "<footer>root</footer>"},
+		"blog/drafts/wip.md":   {"<header>blog <nav>blog</nav></header>", "<footer>drafts</footer>"},
+		"docs-src/guide/a.md":  {"<header>root</header>", "<footer>root</footer>"},
+		"../outside/escape.md": {"<header>root</header>"},
+	}
+	for name, wants := range cases {
+		page, err := renderPageAs(script, name, []byte("# Page\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range wants {
+			if !strings.Contains(string(page), want) {
+				t.Errorf("%s: page missing %q:\n%s", name, want, page)
+			}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// trashDir holds notes removed through the API, so they can be recovered
+// by hand. Like other folders it is not listed or exported.
+const trashDir = ".trash"
+
+// moveToTrash moves the note name into trashDir, adding -1, -2, ... to its
+// basename when the trash already holds one by that name, and removes its
+// export. It returns the path in the trash.
+func moveToTrash(name string) (string, error) {
+	if err := os.MkdirAll(wsPath(trashDir), 0755); err != nil {
+		return "", err
+	}
+	ext := filepath.Ext(name)
+	dst := filepath.Join(trashDir, name)
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(wsPath(dst)); os.IsNotExist(err) {
+			break
+		}
+		dst = filepath.Join(trashDir, fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, ext), i, ext))
+	}
+	if err := os.Rename(wsPath(name), wsPath(dst)); err != nil {
+		return "", err
+	}
+	removeExport(exportDir, htmlOutNameFor(name))
+	docIndex.update(".", name)
+	return dst, nil
+}
+
+type deleteResponse struct {
+	File    string `json:"file"`
+	Trashed string `json:"trashed"` // path in the trash
+}
+
+// handleDelete moves the note given by the `file` query param to the trash
+// and removes its export. The caller must hold the note's lock, which is
+// released.
+func handleDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.URL.Query().Get("file")
+	if name == "" || filepath.Base(name) != name || !strings.EqualFold(filepath.Ext(name), ".md") {
+		http.Error(w, "invalid filename", http.StatusBadRequest)
+		return
+	}
+	tok := r.Header.Get("X-Lock")
+	if !hasValidLock(name, tok) {
+		lockedError(w, name)
+		return
+	}
+	if _, err := os.Stat(wsPath(name)); os.IsNotExist(err) {
+		http.Error(w, "file not found", http.StatusNotFound)
+		return
+	}
+	dst, err := moveToTrash(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	releaseLock(name, tok)
+	if cmarkPath != "" {
+		exportMu.Lock()
+		writeSitePages(cmarkPath, exportDir)
+		exportMu.Unlock()
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(deleteResponse{File: name, Trashed: filepath.ToSlash(dst)})
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHandleDelete(t *testing.T) {
+	chdirTemp(t)
+	locks = make(map[string]lockInfo)
+	writeFiles(t, map[string]string{"note.md": "# Note\n"})
+	if err := os.Mkdir("docs", 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, map[string]string{filepath.Join("docs", "note.html"): "<h1>Note</h1>"})
+	tok, _ := acquireLock("note.md")
+
+	del := func(query, tok string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/delete"+query, nil)
+		req.Header.Set("X-Lock", tok)
+		handleDelete(rr, req)
+		return rr
+	}
+	for query, code := range map[string]int{
+		"?file=../note.md": http.StatusBadRequest,
+		"?file=note.txt":   http.StatusBadRequest,
+		"?file=note.md":    http.StatusLocked, // wrong token
+	} {
+		if rr := del(query, "wrong"); rr.Code != code {
+			t.Errorf("%s: %d, want %d", query, rr.Code, code)
+		}
+	}
+
+	rr := del("?file=note.md", tok)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("delete: %d %s", rr.Code, rr.Body.String())
+	}
+	var resp deleteResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || resp.Trashed != ".trash/note.md" {
+		t.Errorf("response %+v, %v", resp, err)
+	}
+	if b, err := os.ReadFile(filepath.Join(trashDir, "note.md")); err != nil || string(b) != "# Note\n" {
+		t.Errorf("trashed note %q, %v", b, err)
+	}
+	for _, p := range []string{"note.md", filepath.Join("docs", "note.html")} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s left behind", p)
+		}
+	}
+	if len(locks) != 0 {
+		t.Errorf("lock kept: %v", locks)
+	}
+
+	// A second note of the same name gets a numbered trash entry
+	writeFiles(t, map[string]string{"note.md": "again"})
+	tok, _ = acquireLock("note.md")
+	if rr := del("?file=note.md", tok); rr.Code != http.StatusOK || !json.Valid(rr.Body.Bytes()) {
+		t.Fatalf("second delete: %d", rr.Code)
+	}
+	if _, err := os.Stat(filepath.Join(trashDir, "note-1.md")); err != nil {
+		t.Error(err)
+	}
+	tok, _ = acquireLock("gone.md")
+	if rr := del("?file=gone.md", tok); rr.Code != http.StatusNotFound {
+		t.Errorf("missing file: %d", rr.Code)
+	}
+}
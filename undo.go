@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"path/filepath"
+	"sync"
+)
+
+// --------- Per-file undo history of saved states ---------
+
+// undoDepth bounds how many previous saves are kept per file.
+const undoDepth = 20
+
+var (
+	undoStacks = make(map[string][][]byte) // basename -> previous contents, oldest first
+	undoMu     sync.Mutex
+)
+
+// pushUndo records prev as the state to restore if the save that wrote
+// cur to name is undone. Saves that did not change the content are skipped.
+func pushUndo(name string, prev, cur []byte) {
+	if bytes.Equal(prev, cur) {
+		return
+	}
+	name = filepath.Base(name)
+	undoMu.Lock()
+	defer undoMu.Unlock()
+	stack := append(undoStacks[name], prev)
+	if len(stack) > undoDepth {
+		stack = stack[len(stack)-undoDepth:]
+	}
+	undoStacks[name] = stack
+}
+
+// popUndo removes and returns the most recent previous state of name.
+func popUndo(name string) ([]byte, bool) {
+	name = filepath.Base(name)
+	undoMu.Lock()
+	defer undoMu.Unlock()
+	stack := undoStacks[name]
+	if len(stack) == 0 {
+		return nil, false
+	}
+	prev := stack[len(stack)-1]
+	if len(stack) == 1 {
+		delete(undoStacks, name)
+	} else {
+		undoStacks[name] = stack[:len(stack)-1]
+	}
+	return prev, true
+}
+
+// renameUndo moves the history of oldName to newName after a rename.
+func renameUndo(oldName, newName string) {
+	oldName, newName = filepath.Base(oldName), filepath.Base(newName)
+	undoMu.Lock()
+	defer undoMu.Unlock()
+	if stack, ok := undoStacks[oldName]; ok {
+		delete(undoStacks, oldName)
+		undoStacks[newName] = stack
+	}
+}
+
+// handleUndo reverts the last save of the file given by the `file` query
+// param. It requires the caller to hold the file's lock, re-exports the
+// file, and responds with the restored content.
+func handleUndo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.URL.Query().Get("file")
+	if name == "" || filepath.Base(name) != name {
+		http.Error(w, "invalid filename", http.StatusBadRequest)
+		return
+	}
+	if !hasValidLock(name, r.Header.Get("X-Lock")) {
+		lockedError(w, name)
+		return
+	}
+	prev, ok := popUndo(name)
+	if !ok {
+		http.Error(w, "nothing to undo", http.StatusConflict)
+		return
+	}
+	if err := writeNote(name, prev); err != nil {
+		// Keep the state so the undo can be retried
+		undoMu.Lock()
+		undoStacks[name] = append(undoStacks[name], prev)
+		undoMu.Unlock()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	outName := afterSave(name)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Filename", name)
+	w.Header().Set("X-HTML-Filename", outName)
+	setRevision(w.Header(), contentETag(prev))
+	_, _ = w.Write(prev)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// lockFile acquires a lock through the handler and returns the token.
+func lockFile(t *testing.T, name string) string {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	handleLock(rr, httptest.NewRequest(http.MethodPost, "/lock?file="+name, nil))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("lock %s: status %d", name, rr.Code)
+	}
+	return rr.Header().Get("X-Lock")
+}
+
+func saveFile(t *testing.T, name, tok, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/save?file="+name, strings.NewReader(body))
+	req.Header.Set("X-Lock", tok)
+	handleSave(rr, req)
+	return rr
+}
+
+func undo(name, tok string) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/undo?file="+name, nil)
+	req.Header.Set("X-Lock", tok)
+	handleUndo(rr, req)
+	return rr
+}
+
+func TestHandleUndo_RevertsSaves(t *testing.T) {
+	chdirTemp(t)
+	locks = make(map[string]lockInfo)
+	undoStacks = make(map[string][][]byte)
+	if err := os.WriteFile("index.md", []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tok := lockFile(t, "index.md")
+	saveFile(t, "index.md", tok, "v2")
+	saveFile(t, "index.md", tok, "v2") // unchanged save is not recorded
+	saveFile(t, "index.md", tok, "v3")
+
+	for _, want := range []string{"v2", "v1"} {
+		rr := undo("index.md", tok)
+		if rr.Code != http.StatusOK || rr.Body.String() != want {
+			t.Fatalf("undo = %d %q; want %q", rr.Code, rr.Body.String(), want)
+		}
+		if b, _ := os.ReadFile("index.md"); string(b) != want {
+			t.Fatalf("file = %q; want %q", string(b), want)
+		}
+	}
+	if rr := undo("index.md", tok); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 with empty history, got %d", rr.Code)
+	}
+}
+
+func TestHandleUndo_FollowsRename(t *testing.T) {
+	chdirTemp(t)
+	locks = make(map[string]lockInfo)
+	undoStacks = make(map[string][][]byte)
+	if err := os.WriteFile("note.md", []byte("draft"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tok := lockFile(t, "note.md")
+	if rr := saveFile(t, "note.md", tok, "# Titled"); rr.Header().Get("X-Filename") != "titled.md" {
+		t.Fatalf("expected rename, got %q", rr.Header().Get("X-Filename"))
+	}
+	tok = lockFile(t, "titled.md")
+	if rr := undo("titled.md", tok); rr.Code != http.StatusOK || rr.Body.String() != "draft" {
+		t.Fatalf("undo = %d %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestHandleUndo_Errors(t *testing.T) {
+	chdirTemp(t)
+	locks = make(map[string]lockInfo)
+	rr := httptest.NewRecorder()
+	handleUndo(rr, httptest.NewRequest(http.MethodGet, "/undo?file=a.md", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("got %d", rr.Code)
+	}
+	if rr := undo("../a.md", ""); rr.Code != http.StatusBadRequest {
+		t.Fatalf("got %d", rr.Code)
+	}
+	if rr := undo("a.md", "nope"); rr.Code != http.StatusLocked {
+		t.Fatalf("got %d", rr.Code)
+	}
+}
+
+func TestPushUndo_Bounded(t *testing.T) {
+	undoStacks = make(map[string][][]byte)
+	for i := 0; i < undoDepth+5; i++ {
+		pushUndo("a.md", []byte(fmt.Sprint(i)), []byte("cur"))
+	}
+	if n := len(undoStacks["a.md"]); n != undoDepth {
+		t.Fatalf("depth = %d", n)
+	}
+	if prev, _ := popUndo("a.md"); string(prev) != fmt.Sprint(undoDepth+4) {
+		t.Fatalf("top = %q", string(prev))
+	}
+}
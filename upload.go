@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// uploadsDir holds files uploaded or pasted into notes, which link them as
+// assets/<name>. A file is copied into the export directory once a public
+// note links it, so images pasted into private notes stay private.
+const uploadsDir = "assets"
+
+// maxUploadSize bounds the body of an /upload request.
+const maxUploadSize = 20 << 20
+
+// uploadTypes maps the media types accepted as uploads to the extension
+// they are stored with.
+var uploadTypes = map[string]string{
+	"image/png":       ".png",
+	"image/jpeg":      ".jpg",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"image/avif":      ".avif",
+	"application/pdf": ".pdf",
+}
+
+// uploadedFile is one stored file in the /upload response.
+type uploadedFile struct {
+	Name string `json:"name"`
+	Path string `json:"path"` // what notes link to, e.g. assets/shot.png
+	Size int    `json:"size"`
+}
+
+type uploadResponse struct {
+	Files []uploadedFile `json:"files"`
+}
+
+// dataUpload is a file sent to /upload as a base64 data: URI, as pasted
+// from the clipboard. Name is optional.
+type dataUpload struct {
+	Name string `json:"name"`
+	Data string `json:"data"`
+}
+
+type uploadRequest struct {
+	Files []dataUpload `json:"files"`
+}
+
+var uploadNameRe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// uploadName makes a safe file name from a client's name and the
+// extension the upload is stored with.
+func uploadName(name, ext string) string {
+	base := filepath.Base(filepath.ToSlash(name))
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	base = strings.Trim(uploadNameRe.ReplaceAllString(base, "-"), "-.")
+	if base == "" {
+		base = "upload"
+	}
+	return base + ext
+}
+
+// pastedName names pasted data after its content, so pasting the same
+// image again reuses the file.
+func pastedName(data []byte, ext string) string {
+	sum := sha256.Sum256(data)
+	return "paste-" + hex.EncodeToString(sum[:6]) + ext
+}
+
+// uploadExt returns the extension a file called name is stored with, or
+// false when its type is not accepted.
+func uploadExt(name string) (string, bool) {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == ".jpeg" {
+		ext = ".jpg"
+	}
+	for _, e := range uploadTypes {
+		if e == ext {
+			return ext, true
+		}
+	}
+	return "", false
+}
+
+// decodeDataURI decodes a base64 data: URI of an accepted type, returning
+// the content and the extension to store it with.
+func decodeDataURI(uri string) ([]byte, string, error) {
+	rest, ok := strings.CutPrefix(uri, "data:")
+	meta, payload, found := strings.Cut(rest, ",")
+	if !ok || !found {
+		return nil, "", errors.New("not a data URI")
+	}
+	mediaType, isBase64 := strings.CutSuffix(meta, ";base64")
+	if !isBase64 {
+		return nil, "", errors.New("data URI is not base64")
+	}
+	mt, _, err := mime.ParseMediaType(mediaType)
+	if err != nil {
+		return nil, "", err
+	}
+	ext, ok := uploadTypes[mt]
+	if !ok {
+		return nil, "", fmt.Errorf("unsupported type %s", mt)
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(payload), ""))
+	if err != nil {
+		return nil, "", err
+	}
+	return data, ext, nil
+}
+
+// storeUpload writes data to uploadsDir as name, or as name-1, name-2 ...
+// when another file has the name. A file with the same content is reused.
+func storeUpload(name string, data []byte) (uploadedFile, error) {
+	if err := os.MkdirAll(wsPath(uploadsDir), 0755); err != nil {
+		return uploadedFile{}, err
+	}
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		existing, err := os.ReadFile(wsPath(filepath.Join(uploadsDir, name)))
+		if os.IsNotExist(err) {
+			if err := os.WriteFile(wsPath(filepath.Join(uploadsDir, name)), data, 0644); err != nil {
+				return uploadedFile{}, err
+			}
+			break
+		}
+		if err != nil {
+			return uploadedFile{}, err
+		}
+		if bytes.Equal(existing, data) {
+			break
+		}
+		name = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+	return uploadedFile{Name: name, Path: uploadsDir + "/" + name, Size: len(data)}, nil
+}
+
+// uploadNames returns the names of the files in uploadsDir.
+func uploadNames() ([]string, error) {
+	entries, err := os.ReadDir(wsPath(uploadsDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	var names []string
+	for _, e := range entries {
+		if e.Type().IsRegular() {
+			names = append(names, e.Name())
+		}
+	}
+	return names, err
+}
+
+// publishUploads copies the uploads linked by the note name into dstDir
+// when the note is public.
+func publishUploads(name, dstDir string) error {
+	md, err := os.ReadFile(wsPath(name))
+	if err != nil {
+		return err
+	}
+	if !bytes.Contains(md, []byte(uploadsDir+"/")) || !publicNote(md) {
+		return nil
+	}
+	names, err := uploadNames()
+	if err != nil {
+		return err
+	}
+	for _, u := range names {
+		if !referencesUpload(md, u) {
+			continue
+		}
+		dst := filepath.Join(dstDir, uploadsDir, u)
+		if err := os.MkdirAll(wsPath(filepath.Dir(dst)), 0755); err != nil {
+			return err
+		}
+		if err := copyFile(filepath.Join(uploadsDir, u), dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyUploads copies the uploads linked by public notes into dstDir.
+func copyUploads(dstDir string) error {
+	notes, err := listMarkdownFiles(".")
+	if err != nil {
+		return err
+	}
+	for _, note := range notes {
+		if err := publishUploads(note, dstDir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dataImageRe matches base64 data: URI images in Markdown images and HTML
+// src attributes; group 1 is the URI.
+var dataImageRe = regexp.MustCompile(`(?:\]\(|src=["'])(data:image/[\w.+-]+;base64,[A-Za-z0-9+/]+=*)[)"']`)
+
+// extractDataImages stores the data: URI images embedded in md as uploads
+// and links the files instead, reporting whether it changed anything.
+// Images of other types, or that cannot be stored, are left in place.
+func extractDataImages(md []byte) ([]byte, bool) {
+	changed := false
+	out := dataImageRe.ReplaceAllFunc(md, func(m []byte) []byte {
+		sub := dataImageRe.FindSubmatchIndex(m)
+		data, ext, err := decodeDataURI(string(m[sub[2]:sub[3]]))
+		if err != nil {
+			return m
+		}
+		f, err := storeUpload(pastedName(data, ext), data)
+		if err != nil {
+			log.Printf("pasted image not stored: %v", err)
+			return m
+		}
+		changed = true
+		return append(append(append([]byte{}, m[:sub[2]]...), f.Path...), m[sub[3]:]...)
+	})
+	return out, changed
+}
+
+// handleUpload stores files in uploadsDir: multipart/form-data with one or
+// more `file` parts, or JSON whose files carry base64 data: URIs, such as
+// images pasted from the clipboard. It answers 201 with the stored names
+// and the paths to link them by.
+func handleUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	var stored []uploadedFile
+	store := func(name string, data []byte) bool {
+		f, err := storeUpload(name, data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return false
+		}
+		stored = append(stored, f)
+		return true
+	}
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch ct {
+	case "application/json":
+		var req uploadRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, u := range req.Files {
+			data, ext, err := decodeDataURI(u.Data)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			name := pastedName(data, ext)
+			if u.Name != "" {
+				name = uploadName(u.Name, ext)
+			}
+			if !store(name, data) {
+				return
+			}
+		}
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(maxUploadSize); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, fh := range r.MultipartForm.File["file"] {
+			ext, ok := uploadExt(fh.Filename)
+			if !ok {
+				http.Error(w, "unsupported file type: "+fh.Filename, http.StatusUnsupportedMediaType)
+				return
+			}
+			f, err := fh.Open()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			var data bytes.Buffer
+			_, err = data.ReadFrom(f)
+			f.Close()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if !store(uploadName(fh.Filename, ext), data.Bytes()) {
+				return
+			}
+		}
+	default:
+		http.Error(w, "send multipart/form-data or application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+	if len(stored) == 0 {
+		http.Error(w, "no files", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(uploadResponse{Files: stored})
+}
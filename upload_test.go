@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// pngData is the start of a PNG file, enough to tell uploads apart.
+var pngData = []byte("\x89PNG\r\n\x1a\n fake image")
+
+func TestHandleUpload_DataURI(t *testing.T) {
+	chdirTemp(t)
+	uri := "data:image/png;base64," + base64.StdEncoding.EncodeToString(pngData)
+	post := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		handleUpload(rr, req)
+		return rr
+	}
+	rr := post(`{"files": [{"data": "` + uri + `"}, {"name": "../My Shot.jpeg", "data": "` + uri + `"}]}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("upload = %d: %s", rr.Code, rr.Body.String())
+	}
+	var res uploadResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	want := pastedName(pngData, ".png")
+	if len(res.Files) != 2 || res.Files[0].Name != want || res.Files[0].Path != "assets/"+want || res.Files[1].Name != "My-Shot.png" {
+		t.Fatalf("files = %+v", res.Files)
+	}
+	if b, _ := os.ReadFile(filepath.Join(uploadsDir, want)); !bytes.Equal(b, pngData) {
+		t.Errorf("stored %q", b)
+	}
+
+	// A different file under a taken name gets a free one
+	other := "data:image/png;base64," + base64.StdEncoding.EncodeToString([]byte("other"))
+	rr = post(`{"files": [{"name": "My Shot.png", "data": "` + other + `"}]}`)
+	if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil || res.Files[0].Name != "My-Shot-1.png" {
+		t.Errorf("second upload = %s", rr.Body.String())
+	}
+
+	for _, bad := range []string{
+		`{"files": [{"data": "data:text/html;base64,PGI+"}]}`,
+		`{"files": [{"data": "data:image/png,notbase64"}]}`,
+		`{"files": [{"data": "data:image/png;base64,!!!"}]}`,
+		`{"files": []}`,
+		`{`,
+	} {
+		if rr := post(bad); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s = %d", bad, rr.Code)
+		}
+	}
+}
+
+func TestHandleUpload_Multipart(t *testing.T) {
+	chdirTemp(t)
+	upload := func(name string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, _ := mw.CreateFormFile("file", name)
+		fw.Write(pngData)
+		mw.Close()
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		handleUpload(rr, req)
+		return rr
+	}
+	rr := upload("screen shot.PNG")
+	if rr.Code != http.StatusCreated || !strings.Contains(rr.Body.String(), `"path":"assets/screen-shot.png"`) {
+		t.Fatalf("upload = %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := upload("page.html"); rr.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("html upload = %d", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	handleUpload(rr, httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("x")))
+	if rr.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("plain body = %d", rr.Code)
+	}
+}
+
+func TestHandleSave_ExtractsDataImages(t *testing.T) {
+	chdirTemp(t)
+	locks = make(map[string]lockInfo)
+	writeFiles(t, map[string]string{"note.md": "# Note\n"})
+	tok := lockFile(t, "note.md")
+	uri := "data:image/png;base64," + base64.StdEncoding.EncodeToString(pngData)
+	body := "# Note\n\n![shot](" + uri + ")\n<img src=\"" + uri + "\">\n\n`data:image/png;base64,AAAA`\n"
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/save?file=note.md", strings.NewReader(body))
+	req.Header.Set("X-Lock", tok)
+	handleSave(rr, req)
+	if rr.Code != http.StatusNoContent || rr.Header().Get("X-Content-Rewritten") != "true" {
+		t.Fatalf("save = %d, rewritten %q", rr.Code, rr.Header().Get("X-Content-Rewritten"))
+	}
+	path := "assets/" + pastedName(pngData, ".png")
+	want := "# Note\n\n![shot](" + path + ")\n<img src=\"" + path + "\">\n\n`data:image/png;base64,AAAA`\n"
+	if b, _ := os.ReadFile("note.md"); string(b) != want {
+		t.Errorf("saved %q", b)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHandleSave_PrivateUploadsNotExported(t *testing.T) {
+	chdirTemp(t)
+	cmarkPath = echoCmark(t)
+	t.Cleanup(func() { cmarkPath = "" })
+	locks = make(map[string]lockInfo)
+	writeFiles(t, map[string]string{"note.md": "---\nprivate: true\n---\n", "post.md": "# Post\n"})
+	uri := "data:image/png;base64," + base64.StdEncoding.EncodeToString(pngData)
+	exported := filepath.Join(exportDir, uploadsDir, pastedName(pngData, ".png"))
+	save := func(name, body string) {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/save?file="+name, strings.NewReader(body))
+		req.Header.Set("X-Lock", lockFile(t, name))
+		handleSave(rr, req)
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("save %s = %d %s", name, rr.Code, rr.Body.String())
+		}
+	}
+
+	save("note.md", "---\nprivate: true\n---\n![shot]("+uri+")\n")
+	if _, err := os.Stat(exported); !os.IsNotExist(err) {
+		t.Errorf("image of a private note exported: %v", err)
+	}
+	// Linking it from a public note publishes it
+	save("post.md", "# Post\n\n![shot](assets/"+pastedName(pngData, ".png")+")\n")
+	if _, err := os.Stat(exported); err != nil {
+		t.Errorf("image of a public note not exported: %v", err)
+	}
+}
+
+func TestCopyUploads(t *testing.T) {
+	chdirTemp(t)
+	if err := os.Mkdir(uploadsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, map[string]string{
+		"post.md":           "![](assets/shared.png) ![](assets/public.png)\n",
+		"secret.md":         "---\nprivate: true\n---\n![](assets/shared.png) ![](assets/private.png)\n",
+		"draft.md":          "---\ndraft: true\n---\n![](assets/draft.png)\n",
+		"assets/shared.png": "s", "assets/public.png": "p", "assets/private.png": "x",
+		"assets/draft.png": "d", "assets/orphan.png": "o",
+	})
+	if err := copyUploads("docs"); err != nil {
+		t.Fatal(err)
+	}
+	for name, published := range map[string]bool{"shared.png": true, "public.png": true, "private.png": false, "draft.png": false, "orphan.png": false} {
+		if _, err := os.Stat(filepath.Join("docs", uploadsDir, name)); (err == nil) != published {
+			t.Errorf("%s published = %v, want %v", name, err == nil, published)
+		}
+	}
+}
+
+func TestCopyUploads_None(t *testing.T) {
+	chdirTemp(t)
+	writeFiles(t, map[string]string{"post.md": "![](assets/missing.png)\n"})
+	if err := copyUploads("docs"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat("docs"); !os.IsNotExist(err) {
+		t.Errorf("docs created: %v", err)
+	}
+}
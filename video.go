@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+)
+
+var (
+	youtubeIDRe = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+	vimeoIDRe   = regexp.MustCompile(`^[0-9]{1,12}$`)
+)
+
+// youtubeShortcode embeds a YouTube video from the privacy-enhanced
+// youtube-nocookie.com domain:
+//
+//	{{youtube dQw4w9WgXcQ title="Demo"}}
+func youtubeShortcode(a shortcodeArgs) (string, string, error) {
+	return videoEmbed(a, youtubeIDRe, "https://www.youtube-nocookie.com/embed/%s", "YouTube")
+}
+
+// vimeoShortcode embeds a Vimeo video with tracking disabled:
+//
+//	{{vimeo 76979871}}
+func vimeoShortcode(a shortcodeArgs) (string, string, error) {
+	return videoEmbed(a, vimeoIDRe, "https://player.vimeo.com/video/%s?dnt=1", "Vimeo")
+}
+
+// videoEmbed returns a responsive iframe for the video id given as the first
+// positional argument or id=.
+func videoEmbed(a shortcodeArgs, idRe *regexp.Regexp, src, site string) (string, string, error) {
+	id := a.named["id"]
+	if id == "" && len(a.positional) > 0 {
+		id = a.positional[0]
+	}
+	if !idRe.MatchString(id) {
+		return "", "", fmt.Errorf("invalid video id %q", id)
+	}
+	title := a.named["title"]
+	if title == "" {
+		title = site + " video"
+	}
+	return "", fmt.Sprintf(`<div class="video"><iframe src="%s" title="%s" loading="lazy" allow="fullscreen; picture-in-picture" allowfullscreen></iframe></div>`,
+		fmt.Sprintf(src, id), html.EscapeString(title)), nil
+}
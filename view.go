@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// serveRendered renders the note name, whose content is md, through the
+// export pipeline and serves it, with a <base href> when base is set.
+func serveRendered(w http.ResponseWriter, name string, md []byte, base string) {
+	if cmarkPath == "" {
+		http.Error(w, "HTML export is disabled", http.StatusServiceUnavailable)
+		return
+	}
+	page, err := renderPageAs(cmarkPath, name, md)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if base != "" {
+		page = withBase(page, base)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(page)
+}
+
+// noteForPage returns the note exported as the HTML page out, or "".
+func noteForPage(out string) string {
+	files, err := listMarkdownFiles(".")
+	if err != nil {
+		return ""
+	}
+	for _, f := range files {
+		if htmlOutNameFor(f) == out {
+			return f
+		}
+	}
+	return ""
+}
+
+// viewHandler serves /view/: a live rendering of the workspace laid out
+// like docs. /view/note and /view/note.html render note.md on request, so
+// the page is always current; other paths, such as stylesheets and the
+// generated site pages, come from docs. Private and encrypted notes are not
+// served.
+func viewHandler() http.Handler {
+	docs := http.StripPrefix("/view/", http.FileServer(http.Dir(wsPath(exportDir))))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rel := strings.TrimPrefix(r.URL.Path, "/view/")
+		if rel == "" {
+			rel = "index.html"
+		}
+		if path.Ext(rel) == "" && !strings.Contains(rel, "/") {
+			rel += ".html"
+		}
+		if path.Ext(rel) != ".html" || strings.Contains(rel, "/") {
+			docs.ServeHTTP(w, r)
+			return
+		}
+		name := noteForPage(rel)
+		if name == "" {
+			docs.ServeHTTP(w, r)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		md, err := os.ReadFile(wsPath(name))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if isEncryptedNote(md) || notePrivate(md) {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-cache")
+		serveRendered(w, name, md, "")
+	})
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestViewHandler(t *testing.T) {
+	chdirTemp(t)
+	if err := os.Mkdir("docs", 0755); err != nil {
+		t.Fatal(err)
+	}
+	cmarkPath = echoCmark(t)
+	t.Cleanup(func() { cmarkPath = "" })
+	writeFiles(t, map[string]string{
+		"README.md":     "# Home\n",
+		"note.md":       "# Live note\n",
+		"private.md":    "---\nprivate: true\n---\n# Hidden\n",
+		"docs/neat.css": "body{}",
+	})
+	h := viewHandler()
+	get := func(p string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, p, nil))
+		return rr
+	}
+	for _, p := range []string{"/view/note", "/view/note.html"} {
+		rr := get(p)
+		if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Live note") {
+			t.Fatalf("%s: %d %q", p, rr.Code, rr.Body.String())
+		}
+	}
+	if rr := get("/view/"); !strings.Contains(rr.Body.String(), "Home") {
+		t.Errorf("index: %d %q", rr.Code, rr.Body.String())
+	}
+
+	// The view follows edits without an export
+	if err := os.WriteFile("note.md", []byte("# Edited note\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if rr := get("/view/note"); !strings.Contains(rr.Body.String(), "Edited note") {
+		t.Errorf("stale view: %q", rr.Body.String())
+	}
+	if rr := get("/view/neat.css"); rr.Code != http.StatusOK || rr.Body.String() != "body{}" {
+		t.Errorf("asset: %d %q", rr.Code, rr.Body.String())
+	}
+	for _, p := range []string{"/view/private", "/view/missing.html"} {
+		if rr := get(p); rr.Code != http.StatusNotFound {
+			t.Errorf("%s: %d, want 404", p, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// notePrivate reports whether the note whose content is md must not be
+// exported: it has `private: true` or `draft: true` front matter.
+func notePrivate(md []byte) bool {
+	fields, _ := parseFrontMatter(md)
+	private, _ := strconv.ParseBool(fields["private"])
+	draft, _ := strconv.ParseBool(fields["draft"])
+	return private || draft
+}
+
+// publishedDocs returns the docs that are exported, leaving out private
+// and encrypted notes, so site pages do not list or link to them.
+func publishedDocs(docs []docMeta) []docMeta {
+	var out []docMeta
+	for _, d := range docs {
+		if !d.Private {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// unpublish removes the export at outPath along with its metadata and
+// reader-mode variant.
+func unpublish(outPath string) {
+	removeExport(filepath.Dir(outPath), filepath.Base(outPath))
+}
+
+type visibility struct {
+	File    string `json:"file"`
+	Private bool   `json:"private"`
+}
+
+// handleVisibility reports, as JSON, whether the file given by the `file`
+// query param is private. POST with private=true or false changes it by
+// setting or removing the file's private: front matter; this requires the
+// file's lock, can be undone, and re-exports or unpublishes the file.
+func handleVisibility(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("file")
+	if name == "" || filepath.Base(name) != name {
+		http.Error(w, "invalid filename", http.StatusBadRequest)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	prev, err := readNote(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data := prev
+	if r.Method == http.MethodPost {
+		private, err := strconv.ParseBool(r.URL.Query().Get("private"))
+		if err != nil {
+			http.Error(w, "private must be true or false", http.StatusBadRequest)
+			return
+		}
+		if !hasValidLock(name, r.Header.Get("X-Lock")) {
+			lockedError(w, name)
+			return
+		}
+		value := ""
+		if private {
+			value = "true"
+		}
+		data = setFrontMatterField(prev, "private", value)
+		if err := writeNote(name, data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		pushUndo(name, prev, data)
+		afterSave(name)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	setRevision(w.Header(), contentETag(data))
+	_ = json.NewEncoder(w).Encode(visibility{File: name, Private: notePrivate(data)})
+}
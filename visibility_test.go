@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNotePrivate(t *testing.T) {
+	cases := []struct {
+		md   string
+		want bool
+	}{
+		{"# Public", false},
+		{"---\nprivate: true\n---\n# Secret", true},
+		{"---\nprivate: false\n---\n# Open", false},
+		{"---\ndraft: true\n---\n# Unfinished", true},
+	}
+	for _, c := range cases {
+		if got := notePrivate([]byte(c.md)); got != c.want {
+			t.Errorf("notePrivate(%q) = %v", c.md, got)
+		}
+	}
+}
+
+func TestPrivateNotesAreNotExported(t *testing.T) {
+	chdirTemp(t)
+	docIndex = &metaIndex{}
+	cmark := echoCmark(t)
+	withConfig(t, siteConfig{Archive: true, SiteURL: "https://example.com"})
+	writeFiles(t, map[string]string{
+		"public.md": "---\ndate: 2024-01-02\n---\n# Public post",
+		"secret.md": "---\ndate: 2024-01-03\nprivate: true\n---\n# Secret post",
+	})
+	os.MkdirAll(filepath.Join("docs", readerDir), 0755)
+	os.WriteFile(filepath.Join("docs", "secret.html"), []byte("old"), 0644)
+	os.WriteFile(filepath.Join("docs", readerDir, "secret.html"), []byte("old"), 0644)
+	cmarkPath = cmark
+	t.Cleanup(func() { cmarkPath = "" })
+	if err := cleanAndExportAll("docs"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join("docs", "public.html")); err != nil {
+		t.Fatal("public page not exported")
+	}
+	if _, err := os.Stat(filepath.Join("docs", "secret.html")); !os.IsNotExist(err) {
+		t.Fatal("private page exported")
+	}
+	for _, p := range []string{filepath.Join("docs", archiveDir, "2024", "index.html"), filepath.Join("docs", sitemapFile)} {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(b), "secret") || strings.Contains(string(b), "Secret") {
+			t.Errorf("%s lists the private page:\n%s", p, b)
+		}
+	}
+
+	// Making a stale export private removes it, reader variant included
+	os.WriteFile(filepath.Join("docs", readerDir, "secret.html"), []byte("old"), 0644)
+	if err := exportMarkdownTo(cmark, "secret.md", filepath.Join("docs", "secret.html")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join("docs", readerDir, "secret.html")); !os.IsNotExist(err) {
+		t.Fatal("private reader page left behind")
+	}
+}
+
+func TestHandleVisibility(t *testing.T) {
+	chdirTemp(t)
+	locks = make(map[string]lockInfo)
+	undoStacks = make(map[string][][]byte)
+	writeFiles(t, map[string]string{"note.md": "---\ntags: [a]\n---\n# Note\n"})
+
+	get := func(method, query, tok string) (*httptest.ResponseRecorder, visibility) {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/visibility?"+query, nil)
+		req.Header.Set("X-Lock", tok)
+		handleVisibility(rr, req)
+		var v visibility
+		_ = json.Unmarshal(rr.Body.Bytes(), &v)
+		return rr, v
+	}
+	if rr, v := get(http.MethodGet, "file=note.md", ""); rr.Code != http.StatusOK || v.Private {
+		t.Fatalf("get = %d %+v", rr.Code, v)
+	}
+	if rr, _ := get(http.MethodPost, "file=note.md&private=true", "nope"); rr.Code != http.StatusLocked {
+		t.Fatalf("post without lock = %d", rr.Code)
+	}
+	tok := lockFile(t, "note.md")
+	if rr, _ := get(http.MethodPost, "file=note.md&private=maybe", tok); rr.Code != http.StatusBadRequest {
+		t.Fatalf("bad value = %d", rr.Code)
+	}
+	if rr, v := get(http.MethodPost, "file=note.md&private=true", tok); rr.Code != http.StatusOK || !v.Private {
+		t.Fatalf("make private = %d %+v", rr.Code, v)
+	}
+	if b, _ := os.ReadFile("note.md"); string(b) != "---\ntags: [a]\nprivate: true\n---\n# Note\n" {
+		t.Fatalf("file = %q", b)
+	}
+	if rr, v := get(http.MethodPost, "file=note.md&private=false", tok); rr.Code != http.StatusOK || v.Private {
+		t.Fatalf("make public = %d %+v", rr.Code, v)
+	}
+	if b, _ := os.ReadFile("note.md"); string(b) != "---\ntags: [a]\n---\n# Note\n" {
+		t.Fatalf("file = %q", b)
+	}
+	if rr, _ := get(http.MethodGet, "file=missing.md", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("missing = %d", rr.Code)
+	}
+}
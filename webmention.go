@@ -0,0 +1,510 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// webmentionConfig enables Webmention (https://www.w3.org/TR/webmention/)
+// for the published site at site_url.
+type webmentionConfig struct {
+	// Endpoint is the public URL of this server's /webmention. Exported
+	// pages advertise it, so other sites can notify them of links.
+	Endpoint string `json:"endpoint,omitempty"`
+	// Send notifies the external pages a note links to when it is exported.
+	Send bool `json:"send,omitempty"`
+}
+
+// webmentionHook places the list of mentions; without it the list follows
+// the page content.
+const webmentionHook = "{{webmentions}}"
+
+// webmention is a verified incoming mention of a page.
+type webmention struct {
+	Source   string    `json:"source"`
+	Target   string    `json:"target"`
+	Title    string    `json:"title,omitempty"`
+	Received time.Time `json:"received"`
+}
+
+// webmentionStore records the mentions sent and received, persisted to
+// .minimark/webmentions.json.
+type webmentionStore struct {
+	mu       sync.Mutex
+	loaded   bool
+	Sent     map[string][]string     `json:"sent"`     // note -> targets notified
+	Received map[string][]webmention `json:"received"` // page -> mentions
+}
+
+var webmentions = &webmentionStore{}
+
+var webmentionPath = filepath.Join(".minimark", "webmentions.json")
+
+// webmentionClient discovers endpoints and sends mentions. Endpoints come
+// from the linked sites' pages and headers, so it only connects to public
+// addresses too.
+var webmentionClient = newPublicClient()
+
+// webmentionVerifyClient fetches the sources of received mentions. Anyone
+// can name a source, so it only connects to public addresses, redirects
+// included, and never reaches this host or its network.
+var webmentionVerifyClient = newPublicClient()
+
+// newPublicClient returns a client that only connects to public addresses,
+// for fetching URLs that requests name.
+func newPublicClient() *http.Client {
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{Timeout: 10 * time.Second, Control: publicDialControl}).DialContext,
+		},
+	}
+}
+
+// verifyingWebmentions tracks the received mentions being verified.
+var verifyingWebmentions sync.WaitGroup
+
+// webmentionSlots bounds the received mentions verified at once; while
+// they are all taken, further mentions are refused with 503 Service
+// Unavailable for their senders to retry.
+var webmentionSlots = make(chan struct{}, 16)
+
+// maxPageWebmentions bounds the mentions kept for one page. Mentions from
+// new sources beyond it are refused; known sources still update theirs.
+var maxPageWebmentions = 200
+
+// webmentionSendMu serializes sending, so quick saves notify a target once.
+var webmentionSendMu sync.Mutex
+
+const webmentionReadLimit = 1 << 20
+
+var (
+	linkHeaderRe = regexp.MustCompile(`^\s*<([^>]*)>\s*;(.*)$`)
+	relParamRe   = regexp.MustCompile(`(?i)\brel\s*=\s*("[^"]*"|[^;\s]+)`)
+	relLinkTagRe = regexp.MustCompile(`(?is)<(?:link|a)\b([^>]*)>`)
+)
+
+func validateWebmention(w *webmentionConfig, siteURL string) error {
+	if w == nil {
+		return nil
+	}
+	if siteURL == "" {
+		return errors.New("webmention: requires site_url")
+	}
+	if w.Endpoint != "" {
+		if u, err := url.Parse(w.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("webmention: endpoint %q must be an absolute http or https URL", w.Endpoint)
+		}
+	}
+	return nil
+}
+
+// load reads the persisted store once. Callers hold mu.
+func (s *webmentionStore) load() {
+	if s.loaded {
+		return
+	}
+	s.loaded = true
+	s.Sent, s.Received = map[string][]string{}, map[string][]webmention{}
+	if b, err := os.ReadFile(wsPath(webmentionPath)); err == nil {
+		if err := json.Unmarshal(b, s); err != nil {
+			log.Printf("ignoring corrupt webmention store: %v", err)
+		}
+	}
+	if s.Sent == nil {
+		s.Sent = map[string][]string{}
+	}
+	if s.Received == nil {
+		s.Received = map[string][]webmention{}
+	}
+}
+
+// save persists the store. Callers hold mu.
+func (s *webmentionStore) save() {
+	b, err := json.Marshal(s)
+	if err == nil {
+		err = os.MkdirAll(wsPath(filepath.Dir(webmentionPath)), 0755)
+	}
+	if err == nil {
+		err = os.WriteFile(wsPath(webmentionPath), b, 0644)
+	}
+	if err != nil {
+		log.Printf("webmention store not saved: %v", err)
+	}
+}
+
+// received returns the mentions of the page outName.
+func (s *webmentionStore) received(outName string) []webmention {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.load()
+	return append([]webmention{}, s.Received[outName]...)
+}
+
+// sitePageURL is the published URL of the page outName.
+func sitePageURL(outName string) string {
+	return strings.TrimSuffix(config.SiteURL, "/") + "/" + url.PathEscape(outName)
+}
+
+// sitePageName maps a URL on the published site to its page name, or "".
+func sitePageName(target string) string {
+	base, err := url.Parse(strings.TrimSuffix(config.SiteURL, "/") + "/")
+	if err != nil {
+		return ""
+	}
+	u, err := url.Parse(target)
+	if err != nil || !strings.EqualFold(u.Host, base.Host) || !strings.HasPrefix(u.Path, base.Path) {
+		return ""
+	}
+	name := strings.TrimPrefix(u.Path, base.Path)
+	if name == "" {
+		name = "index.html"
+	}
+	if strings.Contains(name, "/") || !strings.HasSuffix(name, ".html") {
+		return ""
+	}
+	return name
+}
+
+// discoverWebmention returns the Webmention endpoint of target from its
+// Link header or its first <link> or <a> with rel="webmention", or "" when
+// it has none.
+func discoverWebmention(target string) (string, error) {
+	resp, err := webmentionClient.Get(target)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("%s returned %s", target, resp.Status)
+	}
+	base := resp.Request.URL // after redirects
+	resolve := func(ref string) (string, error) {
+		u, err := url.Parse(ref)
+		if err != nil {
+			return "", err
+		}
+		return base.ResolveReference(u).String(), nil
+	}
+	for _, h := range resp.Header.Values("Link") {
+		for _, link := range strings.Split(h, ",") {
+			m := linkHeaderRe.FindStringSubmatch(link)
+			if m == nil {
+				continue
+			}
+			if rel := relParamRe.FindStringSubmatch(m[2]); rel != nil && hasRel(strings.Trim(rel[1], `"`), "webmention") {
+				return resolve(m[1])
+			}
+		}
+	}
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt != "text/html" && mt != "application/xhtml+xml" {
+		return "", nil
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, webmentionReadLimit))
+	if err != nil {
+		return "", err
+	}
+	for _, tag := range relLinkTagRe.FindAllSubmatch(b, -1) {
+		attrs := tagAttrs(string(tag[1]))
+		if href, ok := attrs["href"]; ok && hasRel(attrs["rel"], "webmention") {
+			return resolve(href)
+		}
+	}
+	return "", nil
+}
+
+func hasRel(rel, want string) bool {
+	for _, r := range strings.Fields(strings.ToLower(rel)) {
+		if r == want {
+			return true
+		}
+	}
+	return false
+}
+
+// sendWebmentions notifies the external pages the note name links to that
+// have not been notified yet. Targets that fail are retried on the next
+// export.
+func sendWebmentions(name string) {
+	webmentionSendMu.Lock()
+	defer webmentionSendMu.Unlock()
+	md, err := os.ReadFile(wsPath(name))
+	if err != nil || !publicNote(md) {
+		return
+	}
+	_, body := parseFrontMatter(md)
+	source := sitePageURL(htmlOutNameFor(name))
+	var targets []string
+	seen := map[string]bool{}
+	for _, l := range extractLinks(body) {
+		if u, err := url.Parse(l); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || seen[l] || sitePageName(l) != "" {
+			continue
+		}
+		seen[l] = true
+		targets = append(targets, l)
+	}
+	webmentions.mu.Lock()
+	webmentions.load()
+	sent := map[string]bool{}
+	for _, t := range webmentions.Sent[name] {
+		sent[t] = true
+	}
+	webmentions.mu.Unlock()
+	var done []string
+	for _, target := range targets {
+		if !sent[target] {
+			if err := sendWebmention(source, target); err != nil {
+				log.Printf("webmention for %s not sent: %v", target, err)
+				continue
+			}
+		}
+		done = append(done, target)
+	}
+	webmentions.mu.Lock()
+	webmentions.Sent[name] = done
+	webmentions.save()
+	webmentions.mu.Unlock()
+}
+
+// sendWebmention tells target's endpoint, if it has one, that source links
+// to it.
+func sendWebmention(source, target string) error {
+	endpoint, err := discoverWebmention(target)
+	if err != nil || endpoint == "" {
+		return err
+	}
+	resp, err := webmentionClient.PostForm(endpoint, url.Values{"source": {source}, "target": {target}})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s returned %s", endpoint, resp.Status)
+	}
+	return nil
+}
+
+// nonPublicNets are ranges that are not on the public internet but that
+// the net.IP predicates miss: "this network" and carrier-grade NAT.
+var nonPublicNets = []*net.IPNet{
+	{IP: net.IPv4(0, 0, 0, 0), Mask: net.CIDRMask(8, 32)},
+	{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)},
+}
+
+// publicDialControl refuses connections to loopback, private, link-local,
+// shared, unspecified and multicast addresses.
+func publicDialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || inNets(ip, nonPublicNets) {
+		return fmt.Errorf("%s is not a public address", host)
+	}
+	return nil
+}
+
+func inNets(ip net.IP, nets []*net.IPNet) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyWebmention fetches source and returns its title when it links to
+// target. gone is set when source no longer exists.
+func verifyWebmention(source, target string) (title string, gone bool, err error) {
+	resp, err := webmentionVerifyClient.Get(source)
+	if err != nil {
+		return "", false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusGone || resp.StatusCode == http.StatusNotFound {
+		return "", true, nil
+	}
+	if resp.StatusCode/100 != 2 {
+		return "", false, fmt.Errorf("source returned %s", resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, webmentionReadLimit))
+	if err != nil {
+		return "", false, err
+	}
+	if !bytes.Contains(b, []byte(target)) && !bytes.Contains(b, []byte(html.EscapeString(target))) {
+		return "", false, errors.New("source does not link to target")
+	}
+	if t := titleTagRe.FindSubmatch(b); t != nil {
+		title = strings.TrimSpace(spaceRunRe.ReplaceAllString(html.UnescapeString(string(t[1])), " "))
+	}
+	return title, false, nil
+}
+
+// handleWebmention receives webmentions for the published site:
+//
+//	POST /webmention  source=<their page>&target=<our page>
+//
+// The target must be a published page. The request is answered with 202
+// Accepted, and the source is then fetched in the background to check that
+// it links to the target; the page alone is re-exported with the mention.
+// A source that is gone removes its mention. While too many mentions are
+// being verified the request is answered with 503. GET /webmention?file=note.md
+// lists the mentions of a note as JSON.
+func handleWebmention(w http.ResponseWriter, r *http.Request) {
+	if config.Webmention == nil {
+		http.Error(w, "webmentions are not enabled; add webmention to minimark.json", http.StatusNotFound)
+		return
+	}
+	if r.Method == http.MethodGet {
+		name := r.URL.Query().Get("file")
+		if name == "" || filepath.Base(name) != name {
+			http.Error(w, "invalid filename", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(webmentions.received(htmlOutNameFor(name)))
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	source, target := r.PostFormValue("source"), r.PostFormValue("target")
+	su, err := url.Parse(source)
+	if err != nil || (su.Scheme != "http" && su.Scheme != "https") || su.Host == "" || source == target {
+		http.Error(w, "invalid source", http.StatusBadRequest)
+		return
+	}
+	page := sitePageName(target)
+	name := ""
+	if page != "" {
+		name = noteForPage(page)
+	}
+	if name == "" {
+		http.Error(w, "target is not a page on this site", http.StatusBadRequest)
+		return
+	}
+	if md, err := os.ReadFile(wsPath(name)); err != nil || !publicNote(md) {
+		http.Error(w, "target is not a page on this site", http.StatusBadRequest)
+		return
+	}
+	select {
+	case webmentionSlots <- struct{}{}:
+	default:
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "too many webmentions being verified; try again later", http.StatusServiceUnavailable)
+		return
+	}
+	verifyingWebmentions.Add(1)
+	go func() {
+		defer verifyingWebmentions.Done()
+		defer func() { <-webmentionSlots }()
+		if err := receiveWebmention(source, target, page, name); err != nil {
+			log.Printf("webmention from %s to %s rejected: %v", source, target, err)
+		}
+	}()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// receiveWebmention verifies the mention of target, the page of the note
+// name, by source, records it, and re-exports the page.
+func receiveWebmention(source, target, page, name string) error {
+	title, gone, err := verifyWebmention(source, target)
+	if err != nil {
+		return err
+	}
+	webmentions.mu.Lock()
+	webmentions.load()
+	var kept []webmention
+	for _, m := range webmentions.Received[page] {
+		if m.Source != source {
+			kept = append(kept, m)
+		}
+	}
+	if !gone {
+		if len(kept) >= maxPageWebmentions && len(kept) == len(webmentions.Received[page]) {
+			webmentions.mu.Unlock()
+			return fmt.Errorf("%s already has %d mentions", page, len(kept))
+		}
+		kept = append(kept, webmention{Source: source, Target: target, Title: title, Received: time.Now().UTC()})
+	}
+	webmentions.Received[page] = kept
+	webmentions.save()
+	webmentions.mu.Unlock()
+	republishPage(name)
+	return nil
+}
+
+// republishPage re-exports the page of name, which is unchanged but for
+// what is shown around it, through the export queue while the server runs.
+func republishPage(name string) {
+	if cmarkPath == "" || loadIgnore(".").Match(name, false) {
+		return
+	}
+	if exports != nil {
+		exports.enqueuePage(name)
+	} else {
+		_ = exportPage(name)
+	}
+}
+
+// webmentionList renders the mentions of a page.
+func webmentionList(mentions []webmention) string {
+	if len(mentions) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("<section class=\"webmentions\">\n<h2>Mentions</h2>\n<ul>\n")
+	for _, m := range mentions {
+		text := m.Title
+		if text == "" {
+			if u, err := url.Parse(m.Source); err == nil {
+				text = pathTitle(u)
+			}
+		}
+		fmt.Fprintf(&b, "<li><a href=\"%s\" rel=\"nofollow ugc\">%s</a></li>\n", html.EscapeString(m.Source), html.EscapeString(text))
+	}
+	b.WriteString("</ul>\n</section>\n")
+	return b.String()
+}
+
+// applyWebmentions advertises the Webmention endpoint in a page's header and
+// places the mentions of the page name at the hook, else after body.
+func applyWebmentions(name string, header, footer, body []byte) ([]byte, []byte, []byte) {
+	list := ""
+	if wm := config.Webmention; wm != nil && name != "" {
+		if wm.Endpoint != "" && header != nil {
+			header = insertBeforeTag(header, "</head>", fmt.Sprintf("<link rel=\"webmention\" href=\"%s\">\n", html.EscapeString(wm.Endpoint)))
+		}
+		list = webmentionList(webmentions.received(htmlOutNameFor(filepath.Base(name))))
+	}
+	hook := []byte(webmentionHook)
+	if bytes.Contains(header, hook) || bytes.Contains(footer, hook) {
+		if header != nil {
+			header = bytes.ReplaceAll(header, hook, []byte(list))
+		}
+		if footer != nil {
+			footer = bytes.ReplaceAll(footer, hook, []byte(list))
+		}
+		return header, footer, body
+	}
+	return header, footer, append(body, list...)
+}
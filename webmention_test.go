@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func resetWebmentions(t *testing.T) {
+	t.Helper()
+	config.SiteURL = "https://example.com/blog/"
+	config.Webmention = &webmentionConfig{Endpoint: "https://notes.example.com/webmention", Send: true}
+	webmentions = &webmentionStore{}
+	t.Cleanup(func() {
+		config.SiteURL, config.Webmention = "", nil
+		webmentions = &webmentionStore{}
+	})
+}
+
+func TestLoadConfig_Webmention(t *testing.T) {
+	chdirTemp(t)
+	for _, bad := range []string{
+		`{"webmention": {"send": true}}`,
+		`{"site_url": "https://example.com/", "webmention": {"endpoint": "/webmention"}}`,
+	} {
+		if err := os.WriteFile("minimark.json", []byte(bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadConfig("minimark.json"); err == nil {
+			t.Errorf("%s accepted", bad)
+		}
+	}
+}
+
+func TestSitePageName(t *testing.T) {
+	resetWebmentions(t)
+	for target, want := range map[string]string{
+		"https://example.com/blog/trip.html":   "trip.html",
+		"https://example.com/blog/":            "index.html",
+		"https://EXAMPLE.com/blog/trip.html#x": "trip.html",
+		"https://example.com/other/trip.html":  "",
+		"https://evil.com/blog/trip.html":      "",
+		"https://example.com/blog/a/b.html":    "",
+	} {
+		if got := sitePageName(target); got != want {
+			t.Errorf("sitePageName(%q) = %q, want %q", target, got, want)
+		}
+	}
+}
+
+func TestSendWebmentions(t *testing.T) {
+	chdirTemp(t)
+	resetWebmentions(t)
+	var mu sync.Mutex
+	var received []url.Values
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/header":
+			w.Header().Set("Link", `<https://other.example/x>; rel="preload", </endpoint>; rel="webmention"`)
+		case "/html":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<a href="/nope">x</a><link rel="webmention" href="` + srv.URL + `/endpoint">`))
+		case "/endpoint":
+			r.ParseForm()
+			mu.Lock()
+			received = append(received, r.PostForm)
+			mu.Unlock()
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}))
+	defer srv.Close()
+	// The test site is on loopback, which the sending client refuses
+	client := webmentionClient
+	webmentionClient = srv.Client()
+	t.Cleanup(func() { webmentionClient = client })
+	writeFiles(t, map[string]string{
+		"trip.md": "See [a](" + srv.URL + "/header), [b](" + srv.URL + "/html), [c](" + srv.URL + "/none) and [us](https://example.com/blog/x.html).\n",
+	})
+	sendWebmentions("trip.md")
+	if len(received) != 2 {
+		t.Fatalf("sent %d webmentions: %v", len(received), received)
+	}
+	for _, v := range received {
+		if v.Get("source") != "https://example.com/blog/trip.html" || !strings.HasPrefix(v.Get("target"), srv.URL) {
+			t.Errorf("sent %v", v)
+		}
+	}
+	// Targets already notified are not notified again
+	sendWebmentions("trip.md")
+	if len(received) != 2 {
+		t.Errorf("resent: %d", len(received))
+	}
+}
+
+func TestHandleWebmention(t *testing.T) {
+	chdirTemp(t)
+	resetWebmentions(t)
+	config.Webmention.Send = false
+	cmarkPath = echoCmark(t)
+	t.Cleanup(func() { cmarkPath = "" })
+	if err := os.Mkdir("docs", 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, map[string]string{"trip.md": "# Trip\n", "hidden.md": "---\nprivate: true\n---\n"})
+	status := http.StatusOK
+	src := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		if r.URL.Path == "/links" {
+			w.Write([]byte(`<title>Their &amp; post</title><a href="https://example.com/blog/trip.html">trip</a>`))
+		}
+	}))
+	defer src.Close()
+	// The test source is on loopback, which the verifying client refuses
+	verifyClient := webmentionVerifyClient
+	webmentionVerifyClient = src.Client()
+	t.Cleanup(func() { webmentionVerifyClient = verifyClient })
+	post := func(source, target string) *httptest.ResponseRecorder {
+		form := url.Values{"source": {source}, "target": {target}}
+		req := httptest.NewRequest(http.MethodPost, "/webmention", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		handleWebmention(rr, req)
+		verifyingWebmentions.Wait()
+		return rr
+	}
+	for _, c := range [][2]string{
+		{"ftp://x", "https://example.com/blog/trip.html"},
+		{src.URL + "/links", "https://example.com/blog/missing.html"},
+		{src.URL + "/links", "https://example.com/blog/hidden.html"},
+	} {
+		if rr := post(c[0], c[1]); rr.Code != http.StatusBadRequest {
+			t.Errorf("%v: %d, want 400", c, rr.Code)
+		}
+	}
+	// Sources are verified after answering
+	if rr := post(src.URL+"/nolink", "https://example.com/blog/trip.html"); rr.Code != http.StatusAccepted {
+		t.Errorf("no link: %d, want 202", rr.Code)
+	}
+	if got := webmentions.received("trip.html"); len(got) != 0 {
+		t.Errorf("unverified mention kept: %v", got)
+	}
+
+	if rr := post(src.URL+"/links", "https://example.com/blog/trip.html"); rr.Code != http.StatusAccepted {
+		t.Fatalf("status %d: %s", rr.Code, rr.Body.String())
+	}
+	page, _ := os.ReadFile(filepath.Join("docs", "trip.html"))
+	if !strings.Contains(string(page), `<a href="`+src.URL+`/links" rel="nofollow ugc">Their &amp; post</a>`) {
+		t.Errorf("mention not shown:\n%s", page)
+	}
+
+	rr := httptest.NewRecorder()
+	handleWebmention(rr, httptest.NewRequest(http.MethodGet, "/webmention?file=trip.md", nil))
+	var list []webmention
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil || len(list) != 1 || list[0].Title != "Their & post" {
+		t.Fatalf("list %v, %v", list, err)
+	}
+
+	// A deleted source removes its mention
+	status = http.StatusGone
+	if rr := post(src.URL+"/links", "https://example.com/blog/trip.html"); rr.Code != http.StatusAccepted {
+		t.Fatalf("deletion: %d", rr.Code)
+	}
+	if got := webmentions.received("trip.html"); len(got) != 0 {
+		t.Errorf("mention kept: %v", got)
+	}
+
+	// Pages keep a bounded number of mentions
+	status = http.StatusOK
+	limit := maxPageWebmentions
+	maxPageWebmentions = 1
+	t.Cleanup(func() { maxPageWebmentions = limit })
+	post(src.URL+"/links", "https://example.com/blog/trip.html")
+	post(src.URL+"/links?again", "https://example.com/blog/trip.html")
+	if got := webmentions.received("trip.html"); len(got) != 1 || got[0].Source != src.URL+"/links" {
+		t.Errorf("mentions past the limit: %v", got)
+	}
+
+	// Mentions are refused while every verification slot is taken
+	for i := 0; i < cap(webmentionSlots); i++ {
+		webmentionSlots <- struct{}{}
+	}
+	rr = post(src.URL+"/links", "https://example.com/blog/trip.html")
+	for i := 0; i < cap(webmentionSlots); i++ {
+		<-webmentionSlots
+	}
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("queue full: %d, want 503", rr.Code)
+	}
+}
+
+func TestVerifyWebmention_PublicOnly(t *testing.T) {
+	src := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<a href="https://example.com/blog/trip.html">trip</a>`))
+	}))
+	defer src.Close()
+	if _, _, err := verifyWebmention(src.URL, "https://example.com/blog/trip.html"); err == nil || !strings.Contains(err.Error(), "not a public address") {
+		t.Errorf("loopback source: %v", err)
+	}
+	if _, err := discoverWebmention(src.URL); err == nil || !strings.Contains(err.Error(), "not a public address") {
+		t.Errorf("loopback target: %v", err)
+	}
+	if err := sendWebmention("https://example.com/blog/trip.html", src.URL); err == nil {
+		t.Error("sent to a loopback endpoint")
+	}
+	for addr, public := range map[string]bool{
+		"127.0.0.1:80":          false,
+		"10.1.2.3:80":           false,
+		"192.168.0.1:443":       false,
+		"169.254.169.254:80":    false,
+		"0.0.0.0:80":            false,
+		"0.1.2.3:80":            false,
+		"100.64.0.1:80":         false,
+		"100.127.255.254:80":    false,
+		"100.128.0.1:80":        true,
+		"[::1]:80":              false,
+		"[fe80::1]:80":          false,
+		"[fd00::1]:80":          false,
+		"[::ffff:127.0.0.1]:80": false,
+		"93.184.216.34:443":     true,
+		"[2606:4700::1]:443":    true,
+	} {
+		if err := publicDialControl("tcp", addr, nil); (err == nil) != public {
+			t.Errorf("%s: %v", addr, err)
+		}
+	}
+}
+
+func TestApplyWebmentions(t *testing.T) {
+	chdirTemp(t)
+	resetWebmentions(t)
+	header, _, body := applyWebmentions("trip.md", []byte("<head></head>"), nil, []byte("x"))
+	if string(header) != "<head><link rel=\"webmention\" href=\"https://notes.example.com/webmention\">\n</head>" || string(body) != "x" {
+		t.Errorf("header %q body %q", header, body)
+	}
+	_, footer, _ := applyWebmentions("trip.md", nil, []byte("a{{webmentions}}b"), nil)
+	if string(footer) != "ab" {
+		t.Errorf("footer %q", footer)
+	}
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// wsGUID is appended to the client's key to accept a WebSocket handshake
+// (RFC 6455, section 4.2.2).
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket opcodes the server handles.
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+// wsProtocolError is the close status for frames the server does not
+// accept (RFC 6455, section 7.4.1).
+const wsProtocolError = 1002
+
+// errWSFragmented is returned for fragmented client messages, which this
+// endpoint's short commands never need.
+var errWSFragmented = errors.New("fragmented frames are not supported")
+
+// wsMaxFrame bounds frames read from clients, which only send control
+// frames and short commands to this endpoint.
+const wsMaxFrame = 4096
+
+// wsEvent is one message pushed over /ws: "reload" with an HTML page under
+// docs (or reloadAll), "file" with a Markdown file changed on disk,
+// "presence" with the []presence of files being edited, or "hold" with
+// the holdStatus answering a hold command.
+type wsEvent struct {
+	Event string `json:"event"`
+	Data  any    `json:"data"`
+}
+
+// wsCommand is a message from the client. "hold" keeps the lock on File,
+// taken with token Lock, for as long as the socket is open, naming Editor
+// as the holder like X-Editor does; "release" gives it up.
+type wsCommand struct {
+	Event  string `json:"event"`
+	File   string `json:"file"`
+	Lock   string `json:"lock"`
+	Editor string `json:"editor,omitempty"`
+}
+
+// holdStatus tells a client whether its socket holds the lock on File.
+// Owner is the client's own presence owner.
+type holdStatus struct {
+	File  string `json:"file"`
+	Held  bool   `json:"held"`
+	Owner string `json:"owner"`
+}
+
+func wsAccept(key string) string {
+	h := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// upgradeWebSocket completes the opening handshake and hands over the
+// connection, or answers with an error and returns false. Handshakes from
+// pages on other origins are refused with 403.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (net.Conn, *bufio.ReadWriter, bool) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet || !headerHasToken(r.Header, "Connection", "upgrade") ||
+		!headerHasToken(r.Header, "Upgrade", "websocket") || key == "" {
+		http.Error(w, "WebSocket upgrade required", http.StatusUpgradeRequired)
+		return nil, nil, false
+	}
+	// Browsers send their page's Origin; only the editor's own pages may
+	// connect, or any site open in the browser could listen and hold locks
+	if origin := r.Header.Get("Origin"); origin != "" {
+		if u, err := url.Parse(origin); err != nil || !strings.EqualFold(u.Host, r.Host) {
+			http.Error(w, "cross-origin WebSocket refused", http.StatusForbidden)
+			return nil, nil, false
+		}
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, nil, false
+	}
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	_ = conn.SetDeadline(time.Time{})
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + wsAccept(key) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, nil, false
+	}
+	return conn, rw, true
+}
+
+// headerHasToken reports whether the comma-separated header name holds
+// token, ignoring case.
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeWSFrame writes one unmasked, unfragmented server frame.
+func writeWSFrame(w *bufio.Writer, op byte, payload []byte) error {
+	w.WriteByte(0x80 | op)
+	switch n := len(payload); {
+	case n < 126:
+		w.WriteByte(byte(n))
+	case n <= 0xFFFF:
+		w.WriteByte(126)
+		_ = binary.Write(w, binary.BigEndian, uint16(n))
+	default:
+		w.WriteByte(127)
+		_ = binary.Write(w, binary.BigEndian, uint64(n))
+	}
+	w.Write(payload)
+	return w.Flush()
+}
+
+// readWSFrame reads one client frame, which must be masked and whole, and
+// returns its opcode and unmasked payload.
+func readWSFrame(r *bufio.Reader) (byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return 0, nil, err
+	}
+	if head[1]&0x80 == 0 {
+		return 0, nil, errors.New("unmasked client frame")
+	}
+	if head[0]&0x80 == 0 || head[0]&0x0F == wsContinuation {
+		return 0, nil, errWSFragmented
+	}
+	n := uint64(head[1] & 0x7F)
+	switch n {
+	case 126:
+		var n16 uint16
+		if err := binary.Read(r, binary.BigEndian, &n16); err != nil {
+			return 0, nil, err
+		}
+		n = uint64(n16)
+	case 127:
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+			return 0, nil, err
+		}
+	}
+	if n > wsMaxFrame {
+		return 0, nil, errors.New("frame too large")
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(r, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return head[0] & 0x0F, payload, nil
+}
+
+// handleWebSocket pushes reload, file and presence events to the editor
+// and to previews as JSON text messages, like /events does as server-sent
+// events. An editor can also hold its file's lock over the socket instead
+// of refreshing it; the lock is released when the socket closes.
+func handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, rw, ok := upgradeWebSocket(w, r)
+	if !ok {
+		return
+	}
+	defer conn.Close()
+	pages := reloads.subscribe()
+	defer reloads.unsubscribe(pages)
+	files := fileChanges.subscribe()
+	defer fileChanges.unsubscribe(files)
+	editors := presenceChanges.subscribe()
+	defer presenceChanges.unsubscribe(editors)
+
+	// The reader answers pings, passes on commands and notices the client
+	// leaving; frames are written from this goroutine only
+	pongs := make(chan []byte, 1)
+	commands := make(chan wsCommand)
+	done := make(chan struct{})
+	stop := make(chan struct{})
+	defer close(stop)
+	// closing is the payload of the close frame answering the client,
+	// set by the reader before done is closed
+	var closing []byte
+	go func() {
+		defer close(done)
+		for {
+			op, payload, err := readWSFrame(rw.Reader)
+			if errors.Is(err, errWSFragmented) {
+				closing = binary.BigEndian.AppendUint16(nil, wsProtocolError)
+				closing = append(closing, err.Error()...)
+			}
+			if err != nil || op == wsClose {
+				return
+			}
+			switch op {
+			case wsPing:
+				select {
+				case pongs <- payload:
+				default:
+				}
+			case wsText:
+				var cmd wsCommand
+				if json.Unmarshal(payload, &cmd) != nil {
+					continue
+				}
+				select {
+				case commands <- cmd:
+				case <-stop:
+					return
+				}
+			}
+		}
+	}()
+
+	// held is the lock this socket keeps alive, if any
+	var held wsCommand
+	defer func() {
+		if held.File != "" {
+			releaseLock(held.File, held.Lock)
+		}
+	}()
+	// Locks are refreshed twice per lifetime, however short it is set
+	heartbeat := time.NewTicker(max(lockTTL/2, time.Millisecond))
+	defer heartbeat.Stop()
+	send := func(op byte, payload []byte) bool {
+		_ = conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		return writeWSFrame(rw.Writer, op, payload) == nil
+	}
+	event := func(name string, data any) bool {
+		b, _ := json.Marshal(wsEvent{Event: name, Data: data})
+		return send(wsText, b)
+	}
+	// hold keeps cmd's lock, giving up any other; it reports false, and
+	// tells the client, when the lock is gone or another editor has it
+	hold := func(cmd wsCommand) bool {
+		if held.File != "" && (held.File != cmd.File || held.Lock != cmd.Lock) {
+			releaseLock(held.File, held.Lock)
+		}
+		held = wsCommand{}
+		ok := cmd.File != "" && filepath.Base(cmd.File) == cmd.File && cmd.Lock != "" && holdLock(cmd.File, cmd.Lock, cmd.Editor)
+		if ok {
+			held = cmd
+		}
+		return event("hold", holdStatus{File: cmd.File, Held: ok, Owner: lockOwner(cmd.Lock)})
+	}
+	if !event("presence", json.RawMessage(presenceJSON())) {
+		return
+	}
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		ok := true
+		select {
+		case <-done:
+			_ = send(wsClose, closing)
+			return
+		case p := <-pongs:
+			ok = send(wsPong, p)
+		case page := <-pages:
+			ok = event("reload", page)
+		case name := <-files:
+			ok = event("file", name)
+		case list := <-editors:
+			ok = event("presence", json.RawMessage(list))
+		case cmd := <-commands:
+			switch cmd.Event {
+			case "hold":
+				ok = hold(cmd)
+			case "release":
+				if held.File != "" {
+					releaseLock(held.File, held.Lock)
+					held = wsCommand{}
+				}
+			}
+		case <-heartbeat.C:
+			// A lock that expired or was broken is not taken again; the
+			// client has to take it with /lock
+			if held.File != "" && !holdLock(held.File, held.Lock, held.Editor) {
+				ok = event("hold", holdStatus{File: held.File, Held: false, Owner: lockOwner(held.Lock)})
+				held = wsCommand{}
+			}
+		case <-keepAlive.C:
+			ok = send(wsPing, nil)
+		}
+		if !ok {
+			return
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWSAccept(t *testing.T) {
+	// The example handshake from RFC 6455
+	if got := wsAccept("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("wsAccept = %s", got)
+	}
+}
+
+// readServerFrame reads one unmasked frame sent by the server.
+func readServerFrame(t *testing.T, r *bufio.Reader) (byte, string) {
+	t.Helper()
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		t.Fatal(err)
+	}
+	payload := make([]byte, head[1]&0x7F)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatal(err)
+	}
+	return head[0] & 0x0F, string(payload)
+}
+
+// writeClientFrame writes one masked client frame.
+func writeClientFrame(conn net.Conn, op byte, payload string) {
+	mask := []byte{1, 2, 3, 4}
+	frame := append([]byte{0x80 | op, 0x80 | byte(len(payload))}, mask...)
+	for i := 0; i < len(payload); i++ {
+		frame = append(frame, payload[i]^mask[i%4])
+	}
+	conn.Write(frame)
+}
+
+// dialWS opens a WebSocket to srv and reads the presence event sent on
+// connecting.
+func dialWS(t *testing.T, srv *httptest.Server) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	io.WriteString(conn, "GET /ws HTTP/1.1\r\nHost: x\r\nOrigin: http://x\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	r := bufio.NewReader(conn)
+	res, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusSwitchingProtocols || res.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("handshake: %d %v", res.StatusCode, res.Header)
+	}
+	if op, msg := readServerFrame(t, r); op != wsText || !strings.HasPrefix(msg, `{"event":"presence","data":[`) {
+		t.Fatalf("first frame %d %q", op, msg)
+	}
+	return conn, r
+}
+
+func TestHandleWebSocket(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(handleWebSocket))
+	defer srv.Close()
+
+	// Plain requests are refused
+	res, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUpgradeRequired {
+		t.Errorf("plain GET: %d", res.StatusCode)
+	}
+
+	conn, r := dialWS(t, srv)
+
+	reloads.broadcast("note.html")
+	if op, msg := readServerFrame(t, r); op != wsText || msg != `{"event":"reload","data":"note.html"}` {
+		t.Errorf("reload frame %d %q", op, msg)
+	}
+	fileChanges.broadcast("note.md")
+	var ev wsEvent
+	if op, msg := readServerFrame(t, r); op != wsText || json.Unmarshal([]byte(msg), &ev) != nil || ev != (wsEvent{"file", "note.md"}) {
+		t.Errorf("file frame %d %q", op, msg)
+	}
+
+	// A masked ping is answered, and a close is echoed
+	writeClientFrame(conn, wsPing, "hi")
+	if op, msg := readServerFrame(t, r); op != wsPong || msg != "hi" {
+		t.Errorf("pong %d %q", op, msg)
+	}
+	writeClientFrame(conn, wsClose, "")
+	if op, _ := readServerFrame(t, r); op != wsClose {
+		t.Errorf("close answered with %d", op)
+	}
+}
+
+func TestHandleWebSocket_Fragmented(t *testing.T) {
+	old := lockTTL
+	lockTTL = time.Nanosecond // the heartbeat still ticks
+	t.Cleanup(func() { lockTTL = old })
+	srv := httptest.NewServer(http.HandlerFunc(handleWebSocket))
+	defer srv.Close()
+	conn, r := dialWS(t, srv)
+
+	// The first part of a message, without FIN, closes the socket
+	frame := []byte{wsText, 0x80 | 2, 0, 0, 0, 0, '{', '"'}
+	conn.Write(frame)
+	op, msg := readServerFrame(t, r)
+	if op != wsClose || len(msg) < 2 || int(msg[0])<<8|int(msg[1]) != wsProtocolError {
+		t.Errorf("fragment answered with %d %q", op, msg)
+	}
+
+	conn, r = dialWS(t, srv)
+	writeClientFrame(conn, wsContinuation, "x")
+	if op, _ := readServerFrame(t, r); op != wsClose {
+		t.Errorf("continuation answered with %d", op)
+	}
+}
+
+// takeLock gives tok the lock on name, as /lock does.
+func takeLock(t *testing.T, name, tok string) {
+	t.Helper()
+	locksMu.Lock()
+	defer locksMu.Unlock()
+	now := time.Now()
+	locks[name] = lockInfo{token: tok, expires: now.Add(lockTTL), since: now}
+}
+
+func TestHandleWebSocket_CrossOrigin(t *testing.T) {
+	for _, origin := range []string{"https://evil.example", "http://localhost:9999", "null"} {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/ws", nil)
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		req.Header.Set("Sec-WebSocket-Version", "13")
+		req.Header.Set("Origin", origin)
+		rr := httptest.NewRecorder()
+		handleWebSocket(rr, req)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("origin %s: %d, want 403", origin, rr.Code)
+		}
+	}
+}
+
+func TestHandleWebSocket_HoldLock(t *testing.T) {
+	locks = make(map[string]lockInfo)
+	srv := httptest.NewServer(http.HandlerFunc(handleWebSocket))
+	defer srv.Close()
+	hold := func(conn net.Conn, r *bufio.Reader, file, tok string) holdStatus {
+		t.Helper()
+		b, _ := json.Marshal(wsCommand{Event: "hold", File: file, Lock: tok})
+		writeClientFrame(conn, wsText, string(b))
+		var ev struct {
+			Event string
+			Data  holdStatus
+		}
+		if _, msg := readServerFrame(t, r); json.Unmarshal([]byte(msg), &ev) != nil || ev.Event != "hold" {
+			t.Fatalf("hold answer %q", msg)
+		}
+		return ev.Data
+	}
+
+	conn, r := dialWS(t, srv)
+	// Holding does not take a lock that /lock did not grant
+	if st := hold(conn, r, "a.md", "tok-a"); st.Held || hasValidLock("a.md", "tok-a") {
+		t.Fatalf("hold without a lock = %+v", st)
+	}
+	takeLock(t, "a.md", "tok-a")
+	if st := hold(conn, r, "a.md", "tok-a"); !st.Held || st.Owner != lockOwner("tok-a") {
+		t.Fatalf("hold = %+v", st)
+	}
+	// The heartbeat keeps the lock past its TTL while the socket is open
+	time.Sleep(lockTTL * 3 / 2)
+	if !hasValidLock("a.md", "tok-a") {
+		t.Fatal("lock not kept alive")
+	}
+
+	// Another editor cannot hold the same file, and sees who has it
+	conn2, r2 := dialWS(t, srv)
+	if st := hold(conn2, r2, "a.md", "tok-b"); st.Held {
+		t.Fatal("second editor holds a locked file")
+	}
+	presenceChanges.broadcast(presenceJSON())
+	if _, msg := readServerFrame(t, r2); msg != `{"event":"presence","data":[{"file":"a.md","owner":"`+lockOwner("tok-a")+`"}]}` {
+		t.Errorf("presence %q", msg)
+	}
+
+	// Closing the socket releases the lock
+	writeClientFrame(conn, wsClose, "")
+	for deadline := time.Now().Add(2 * time.Second); hasValidLock("a.md", "tok-a"); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("lock kept after the socket closed")
+		}
+	}
+}
+
+func TestHandleWebSocket_BrokenLock(t *testing.T) {
+	chdirTemp(t)
+	locks = make(map[string]lockInfo)
+	t.Setenv("MINIMARK_ADMIN_TOKEN", "admin")
+	srv := httptest.NewServer(http.HandlerFunc(handleWebSocket))
+	defer srv.Close()
+	conn, r := dialWS(t, srv)
+	takeLock(t, "a.md", "tok-a")
+	b, _ := json.Marshal(wsCommand{Event: "hold", File: "a.md", Lock: "tok-a"})
+	writeClientFrame(conn, wsText, string(b))
+	if _, msg := readServerFrame(t, r); !strings.Contains(msg, `"held":true`) {
+		t.Fatalf("hold answer %q", msg)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/locks/break?file=a.md", nil)
+	req.Header.Set("Authorization", "Bearer admin")
+	handleBreakLock(rr, req)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("break = %d", rr.Code)
+	}
+
+	// The next heartbeat tells the client instead of taking the lock again
+	for {
+		var ev struct {
+			Event string
+			Data  holdStatus
+		}
+		if _, msg := readServerFrame(t, r); json.Unmarshal([]byte(msg), &ev) != nil || ev.Event != "hold" {
+			continue
+		}
+		if ev.Data.Held || ev.Data.File != "a.md" {
+			t.Errorf("heartbeat = %+v", ev.Data)
+		}
+		break
+	}
+	locksMu.Lock()
+	_, relocked := locks["a.md"]
+	locksMu.Unlock()
+	if relocked {
+		t.Error("heartbeat took the broken lock again")
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// workspaceDir is the -dir directory holding the notes; empty means the
+// current directory.
+var workspaceDir string
+
+// workspaceRoot is the absolute path of the notes directory, or empty to
+// use the current directory. Paths in the workspace are kept relative to
+// it, as note names are, and resolved with wsPath when files are touched.
+var workspaceRoot string
+
+// wsPath resolves name, relative to the workspace, to a path to open.
+// Absolute paths are returned as is.
+func wsPath(name string) string {
+	if workspaceRoot == "" || filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(workspaceRoot, name)
+}
+
+// walkWorkspace walks dir in the workspace like filepath.WalkDir, passing
+// fn paths that start with dir as given rather than resolved.
+func walkWorkspace(dir string, fn fs.WalkDirFunc) error {
+	root := wsPath(dir)
+	if root == dir {
+		return filepath.WalkDir(dir, fn)
+	}
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if rel, relErr := filepath.Rel(root, p); relErr == nil {
+			p = filepath.Join(dir, rel)
+		}
+		return fn(p, d, err)
+	})
+}
+
+// workspaceCommand is exec.Command run in the workspace.
+func workspaceCommand(name string, args ...string) *exec.Cmd {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = workspaceRoot
+	return cmd
+}
+
+// enterWorkspace makes dir the workspace root. paths, given on the command
+// line relative to where minimark was started, are made absolute so they
+// are not taken to be inside the workspace.
+func enterWorkspace(dir string, paths ...*string) error {
+	if dir == "" {
+		return nil
+	}
+	for _, p := range paths {
+		if *p == "" || filepath.IsAbs(*p) {
+			continue
+		}
+		abs, err := filepath.Abs(*p)
+		if err != nil {
+			return err
+		}
+		*p = abs
+	}
+	root, err := filepath.Abs(dir)
+	if err == nil {
+		var info os.FileInfo
+		if info, err = os.Stat(root); err == nil && !info.IsDir() {
+			err = fmt.Errorf("not a directory")
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("-dir %s: %w", dir, err)
+	}
+	workspaceRoot = root
+	return nil
+}
+
+// exportDir is where HTML exports are written: -out, else out in
+// minimark.json, else docs. It is emptied on startup, so it must be a
+// folder of its own inside the workspace.
+var exportDir = "docs"
+
+// outFlag is the -out directory, which overrides out in minimark.json.
+var outFlag string
+
+// workspaceDirs are folders the workspace keeps its own files in, which
+// cannot double as the export directory.
+var workspaceDirs = []string{"_includes", layoutsDir, dataDir, ".minimark", trashDir, uploadsDir}
+
+func validateOut(dir string) error {
+	if dir == "" {
+		return nil
+	}
+	clean := path.Clean(filepath.ToSlash(dir))
+	if !insideWorkspace(clean) || clean == "." {
+		return fmt.Errorf("out %q must be a folder inside the workspace", dir)
+	}
+	for _, d := range workspaceDirs {
+		if clean == d || strings.HasPrefix(clean, d+"/") || strings.HasPrefix(d, clean+"/") {
+			return fmt.Errorf("out %q overlaps %s", dir, d)
+		}
+	}
+	return nil
+}
+
+// reservedPath reports whether p, relative to the workspace, lies in one
+// of workspaceDirs or the export directory.
+func reservedPath(p string) bool {
+	clean := path.Clean(filepath.ToSlash(p))
+	for _, d := range append([]string{filepath.ToSlash(exportDir)}, workspaceDirs...) {
+		if clean == d || strings.HasPrefix(clean, d+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// setExportDir picks the export directory from -out or the config.
+func setExportDir() {
+	for _, dir := range []string{outFlag, config.Out} {
+		if dir != "" {
+			exportDir = filepath.Clean(dir)
+			return
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEnterWorkspace(t *testing.T) {
+	start := chdirTemp(t)
+	t.Cleanup(func() { workspaceRoot = "" })
+	if err := os.Mkdir("notes", 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, map[string]string{"key": "secret", "file.md": "x"})
+	key, abs := "key", "/etc/cert.pem"
+	if err := enterWorkspace("notes", &key, &abs); err != nil {
+		t.Fatal(err)
+	}
+	// The working directory is left alone
+	if wd, _ := os.Getwd(); wd != start {
+		t.Errorf("working directory %s", wd)
+	}
+	if workspaceRoot != filepath.Join(start, "notes") || wsPath("a.md") != filepath.Join(start, "notes", "a.md") || wsPath(abs) != abs {
+		t.Errorf("workspace root %s", workspaceRoot)
+	}
+	if b, err := os.ReadFile(wsPath(key)); err != nil || string(b) != "secret" {
+		t.Errorf("key path %s: %q, %v", key, b, err)
+	}
+	if abs != "/etc/cert.pem" {
+		t.Errorf("absolute path changed to %s", abs)
+	}
+
+	if err := enterWorkspace(filepath.Join(start, "file.md")); err == nil {
+		t.Error("file accepted as -dir")
+	}
+	if err := enterWorkspace(filepath.Join(start, "missing")); err == nil {
+		t.Error("missing -dir accepted")
+	}
+}
+
+func TestWorkspaceRoot_Handlers(t *testing.T) {
+	start := chdirTemp(t)
+	locks = make(map[string]lockInfo)
+	docIndex = &metaIndex{}
+	t.Cleanup(func() { workspaceRoot = "" })
+	if err := os.MkdirAll(filepath.Join("notes", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, map[string]string{
+		filepath.Join("notes", "a.md"):        "# A\n",
+		filepath.Join("notes", "sub", "b.md"): "# B\n",
+		"stray.md":                            "# Stray\n",
+	})
+	if err := enterWorkspace("notes"); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := listMarkdownFiles(".")
+	if err != nil || len(names) != 1 || names[0] != "a.md" {
+		t.Errorf("notes = %v, %v", names, err)
+	}
+	var walked []string
+	walkWorkspace(".", func(p string, d fs.DirEntry, err error) error {
+		walked = append(walked, p)
+		return err
+	})
+	if strings.Join(walked, " ") != ". a.md sub sub/b.md" {
+		t.Errorf("walked %q", walked)
+	}
+
+	tok := lockFile(t, "a.md")
+	if rr := saveFile(t, "a.md", tok, "# A\n\nSaved.\n"); rr.Code != http.StatusNoContent {
+		t.Fatalf("save = %d %s", rr.Code, rr.Body.String())
+	}
+	if b, _ := os.ReadFile(filepath.Join(start, "notes", "a.md")); string(b) != "# A\n\nSaved.\n" {
+		t.Errorf("saved %q", b)
+	}
+	if _, err := os.Stat(filepath.Join(start, "a.md")); !os.IsNotExist(err) {
+		t.Errorf("note written to the working directory: %v", err)
+	}
+	if cmd := workspaceCommand("git", "status"); cmd.Dir != workspaceRoot {
+		t.Errorf("command runs in %q", cmd.Dir)
+	}
+}
+
+func TestExportDir(t *testing.T) {
+	for _, dir := range []string{"public", "_site", "site/notes/", "./out"} {
+		if err := validateOut(dir); err != nil {
+			t.Errorf("validateOut(%q): %v", dir, err)
+		}
+	}
+	for _, dir := range []string{".", "./", "..", "../site", "/tmp/site", "_includes", "_layouts", "_data/out", ".minimark", "x/.."} {
+		if err := validateOut(dir); err == nil {
+			t.Errorf("validateOut(%q) accepted", dir)
+		}
+	}
+
+	t.Cleanup(func() { exportDir, outFlag, config.Out = "docs", "", "" })
+	config.Out = "public/"
+	setExportDir()
+	if exportDir != "public" {
+		t.Errorf("config out: %s", exportDir)
+	}
+	outFlag = "_site"
+	setExportDir()
+	if exportDir != "_site" {
+		t.Errorf("-out: %s", exportDir)
+	}
+
+	// A full export follows the configured folder
+	chdirTemp(t)
+	writeFiles(t, map[string]string{"note.md": "# Note\n"})
+	cmarkPath = builtinConverter
+	t.Cleanup(func() { cmarkPath = "" })
+	exportSite()
+	if _, err := os.Stat(filepath.Join("_site", "note.html")); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat("docs"); !os.IsNotExist(err) {
+		t.Errorf("docs written: %v", err)
+	}
+}